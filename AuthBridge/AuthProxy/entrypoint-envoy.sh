@@ -8,6 +8,39 @@ GO_PROCESSOR_PID=$!
 # Give go-processor a moment to start
 sleep 2
 
+# Render the listener and admin ports the webhook moved off their defaults
+ENVOY_CONFIG=/etc/envoy/envoy.yaml
+if [ -n "$ENVOY_OUTBOUND_PORT$ENVOY_INBOUND_PORT$ENVOY_ADMIN_PORT" ]; then
+    echo "Rendering Envoy ports: outbound=${ENVOY_OUTBOUND_PORT:-15123} inbound=${ENVOY_INBOUND_PORT:-15124} admin=${ENVOY_ADMIN_PORT:-9901}"
+    sed -e "s/port_value: 15123\b/port_value: ${ENVOY_OUTBOUND_PORT:-15123}/" \
+        -e "s/port_value: 15124\b/port_value: ${ENVOY_INBOUND_PORT:-15124}/" \
+        -e "s/port_value: 9901\b/port_value: ${ENVOY_ADMIN_PORT:-9901}/" \
+        "$ENVOY_CONFIG" > /tmp/envoy.yaml
+    ENVOY_CONFIG=/tmp/envoy.yaml
+fi
+
+# Move the admin interface to a Unix socket only the Envoy user can open, or remove it,
+# so the application containers cannot reach it on the shared loopback interface
+case "$ENVOY_ADMIN" in
+uds|disabled)
+    echo "Rendering Envoy admin interface: $ENVOY_ADMIN"
+    awk -v mode="$ENVOY_ADMIN" '
+        /^admin:/ {
+            skip = 1
+            if (mode == "uds") print "admin:\n  address:\n    pipe:\n      path: /tmp/envoy-admin.sock\n      mode: 384"
+            next
+        }
+        skip && /^[^ #]/ { skip = 0 }
+        !skip
+    ' "$ENVOY_CONFIG" > /tmp/envoy-admin.yaml
+    ENVOY_CONFIG=/tmp/envoy-admin.yaml
+    ;;
+""|localhost) ;;
+*)
+    echo "Unknown ENVOY_ADMIN $ENVOY_ADMIN, keeping the admin interface of $ENVOY_CONFIG" >&2
+    ;;
+esac
+
 # Start Envoy in the foreground
 echo "Starting Envoy..."
-exec /usr/local/bin/envoy -c /etc/envoy/envoy.yaml --service-cluster auth-proxy --service-node auth-proxy --log-level debug
+exec /usr/local/bin/envoy -c "$ENVOY_CONFIG" --service-cluster auth-proxy --service-node auth-proxy --log-level debug
@@ -0,0 +1,130 @@
+// extproc-load generates ext_proc load against a go-processor and reports the latency
+// the processor adds to each request. With -processor it starts the binary itself, wired
+// to an in-memory IdP, so a run needs neither Keycloak nor a cluster.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+	"github.com/huang195/auth-proxy/pkg/extprocload"
+)
+
+// processorAddr is where go-processor listens
+const processorAddr = "127.0.0.1:9090"
+
+func main() {
+	os.Exit(execute())
+}
+
+// execute runs the load and returns the exit code, after the deferred cleanup stopped the
+// processor
+func execute() int {
+	addr := flag.String("addr", processorAddr, "ext_proc address of a running processor")
+	streams := flag.Int("streams", 50, "concurrent ext_proc streams")
+	requests := flag.Int("requests", 10000, "total requests")
+	warmup := flag.Int("warmup", 100, "requests sent before measuring")
+	token := flag.String("token", "", "bearer token for a running processor; empty sends requests without one")
+	processor := flag.String("processor", "", "path of a go-processor binary to start against the in-memory IdP")
+	idpLatency := flag.Duration("idp-latency", 0, "delay of every token endpoint response of the in-memory IdP")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg := extprocload.Config{Streams: *streams, Requests: *requests}
+	if *token != "" {
+		cfg.Token = func() string { return *token }
+	}
+	if *processor != "" {
+		idp := exchangetest.NewIdP()
+		defer idp.Close()
+		idp.SetLatency(*idpLatency)
+		secret := exchangetest.RandomSecret()
+		idp.AddClient("extproc-load", secret)
+		idp.AddAudience("auth-target")
+
+		cmd, err := startProcessor(ctx, *processor, idp.TokenURL(), secret)
+		if err != nil {
+			log.Printf("failed to start %s: %v", *processor, err)
+			return 1
+		}
+		defer func() {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}()
+		*addr = processorAddr
+		cfg.Token = func() string { return idp.Issue("alice", "extproc-load") }
+	}
+
+	result, err := run(ctx, *addr, *warmup, cfg)
+	if err != nil {
+		log.Printf("load run failed: %v", err)
+	}
+	fmt.Println(result)
+	if err != nil || result.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// run sends the warmup requests, then measures cfg.Requests
+func run(ctx context.Context, addr string, warmup int, cfg extprocload.Config) (extprocload.Result, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return extprocload.Result{}, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+	cfg.Client = v3.NewExternalProcessorClient(conn)
+
+	if warmup > 0 {
+		warm := cfg
+		warm.Requests = warmup
+		if _, err := extprocload.Run(ctx, warm); err != nil {
+			return extprocload.Result{}, fmt.Errorf("warmup interrupted: %w", err)
+		}
+	}
+	return extprocload.Run(ctx, cfg)
+}
+
+// startProcessor runs the binary with the exchange configured against the IdP and waits
+// until it accepts connections
+func startProcessor(ctx context.Context, path, tokenURL, secret string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = append(os.Environ(),
+		"TOKEN_URL="+tokenURL,
+		"CLIENT_ID=extproc-load",
+		"CLIENT_SECRET="+secret,
+		"CLIENT_ID_FILE=/nonexistent",
+		"CLIENT_SECRET_FILE=/nonexistent",
+		"TARGET_AUDIENCE=auth-target",
+		"TARGET_SCOPES=openid",
+		"LOG_LEVEL=error",
+	)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if conn, err := net.DialTimeout("tcp", processorAddr, time.Second); err == nil {
+			conn.Close()
+			return cmd, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_ = cmd.Process.Kill()
+	return nil, fmt.Errorf("processor did not listen on %s within 10s", processorAddr)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const (
+	// extProcAttributesKey holds the attributes Envoy sends with request_attributes
+	extProcAttributesKey = "envoy.filters.http.ext_proc"
+
+	defaultAuditPathSegments = 2
+)
+
+// Outcomes of a token exchange in audit events and metrics
+const (
+	exchangeResultExchanged = "exchanged"
+	exchangeResultReused    = "reused"
+	exchangeResultStale     = "stale"
+	exchangeResultFailed    = "failed"
+)
+
+// auditPathSegments is the number of path segments kept in metric labels
+var auditPathSegments = defaultAuditPathSegments
+
+var tokenExchanges = newCounterVec("authbridge_token_exchanges_total",
+	"Token exchanges by request method, authority, path prefix and result",
+	"method", "authority", "path", "result")
+
+// requestAttributes describe the request an exchange was made for
+type requestAttributes struct {
+	Method    string
+	Path      string
+	Authority string
+	// Source is the address of the caller, from Envoy's source.address attribute or the
+	// first x-forwarded-for entry
+	Source string
+}
+
+// loadAudit reads AUDIT_PATH_SEGMENTS
+func loadAudit() error {
+	auditPathSegments = defaultAuditPathSegments
+	if value := os.Getenv("AUDIT_PATH_SEGMENTS"); value != "" {
+		segments, err := strconv.Atoi(value)
+		if err != nil || segments < 0 {
+			return fmt.Errorf("invalid AUDIT_PATH_SEGMENTS %q: must be a non-negative integer", value)
+		}
+		auditPathSegments = segments
+	}
+	return nil
+}
+
+// requestAttributesOf reads the attributes of the header phase
+func requestAttributesOf(req *v3.ProcessingRequest, headers []*core.HeaderValue) requestAttributes {
+	attrs := requestAttributes{
+		Method:    getHeaderValue(headers, ":method"),
+		Path:      getHeaderValue(headers, ":path"),
+		Authority: getHeaderValue(headers, ":authority"),
+	}
+	if source := req.GetAttributes()[extProcAttributesKey].GetFields()["source.address"]; source != nil {
+		attrs.Source = source.GetStringValue()
+	}
+	if attrs.Source == "" {
+		forwarded, _, _ := strings.Cut(getHeaderValue(headers, "x-forwarded-for"), ",")
+		attrs.Source = strings.TrimSpace(forwarded)
+	}
+	return attrs
+}
+
+// auditExchange logs who called what: the caller, the request and the outcome of the
+// exchange, with the actor chain of the issued token when identities are chained. It
+// also counts the exchange, labeled with the request's method, authority and path prefix,
+// and hands the event to the audit exporter.
+func auditExchange(attrs requestAttributes, requestID, subjectToken, token, audience, result string) {
+	subject, _ := tokenClaims(subjectToken)["sub"].(string)
+	fields := map[string]string{
+		"result": result, "request_id": requestID, "sub": subject, "method": attrs.Method,
+		"authority": attrs.Authority, "path": pathWithoutQuery(attrs.Path), "source": attrs.Source, "audience": audience,
+	}
+	line := fmt.Sprintf("[Audit] result=%s request_id=%s sub=%s method=%s authority=%s path=%s source=%s audience=%s",
+		result, requestID, subject, attrs.Method, attrs.Authority, fields["path"], attrs.Source, audience)
+	if identityChain.Enabled() && token != "" {
+		fields["actors"] = strings.Join(actorChain(tokenClaims(token)), " <- ")
+		line += " actors=" + fields["actors"]
+	}
+	log.Print(line)
+	auditExport.Export("token_exchange", fields)
+	tokenExchanges.Inc(attrs.Method, hostOnly(attrs.Authority), pathLabel(attrs.Path), result)
+}
+
+func pathWithoutQuery(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	return path
+}
+
+// pathLabel keeps the first AUDIT_PATH_SEGMENTS segments of a path, so IDs in later
+// segments do not become label values
+func pathLabel(path string) string {
+	segments := strings.Split(strings.Trim(pathWithoutQuery(path), "/"), "/")
+	if len(segments) > auditPathSegments {
+		segments = segments[:auditPathSegments]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// hostOnly drops the port of an authority
+func hostOnly(authority string) string {
+	if host, _, err := net.SplitHostPort(authority); err == nil {
+		return host
+	}
+	return authority
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Sinks audit events are exported to
+const (
+	auditSinkHTTP = "http"
+	// auditSinkKafka posts to the topic URL of a Kafka REST proxy, e.g.
+	// http://kafka-rest:8082/topics/authbridge-audit; the processor has no Kafka client
+	auditSinkKafka  = "kafka"
+	auditSinkSyslog = "syslog"
+)
+
+const (
+	defaultAuditExportBuffer        = 10000
+	defaultAuditExportBatchSize     = 100
+	defaultAuditExportFlushInterval = time.Second
+	defaultAuditExportTimeout       = 5 * time.Second
+	// auditExportRetries are the further attempts at a batch, after 1s, 2s and 4s
+	auditExportRetries = 3
+	// syslogPriority is facility local0, severity informational
+	syslogPriority = 16*8 + 6
+)
+
+// auditExport sends the audit events to AUDIT_EXPORT_URL when set, nil otherwise
+var auditExport *AuditExporter
+
+var (
+	auditEventsExported = newCounter("authbridge_audit_events_exported_total",
+		"Audit events delivered to the export sink")
+	auditEventsDropped = newCounterVec("authbridge_audit_events_dropped_total",
+		"Audit events not delivered to the export sink, by reason", "reason")
+	auditExportFailures = newCounter("authbridge_audit_export_failures_total",
+		"Failed attempts to deliver a batch of audit events")
+)
+
+// auditEvent is an exported audit event: the fields of its [Audit] log line, with
+// "time" and "event"
+type auditEvent map[string]string
+
+// AuditExporter buffers audit events and delivers them in batches from a goroutine of its
+// own. The request path only enqueues: when the buffer is full, because the sink is slow
+// or down, events are dropped and counted instead of delaying the request.
+type AuditExporter struct {
+	Sink          string
+	URL           string
+	BatchSize     int
+	FlushInterval time.Duration
+	Timeout       time.Duration
+	HTTPClient    *http.Client
+
+	events chan auditEvent
+	// conn is the syslog connection, dialed again after a failure
+	conn net.Conn
+}
+
+// loadAuditExport reads AUDIT_EXPORT_URL, AUDIT_EXPORT_SINK, AUDIT_EXPORT_BUFFER,
+// AUDIT_EXPORT_BATCH_SIZE, AUDIT_EXPORT_FLUSH_INTERVAL and AUDIT_EXPORT_TIMEOUT, and starts
+// the exporter
+func loadAuditExport() error {
+	auditExport = nil
+	rawURL := os.Getenv("AUDIT_EXPORT_URL")
+	if rawURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid AUDIT_EXPORT_URL %q", rawURL)
+	}
+	exporter := &AuditExporter{
+		Sink:          os.Getenv("AUDIT_EXPORT_SINK"),
+		URL:           rawURL,
+		BatchSize:     defaultAuditExportBatchSize,
+		FlushInterval: defaultAuditExportFlushInterval,
+		Timeout:       defaultAuditExportTimeout,
+	}
+	if exporter.Sink == "" {
+		exporter.Sink = auditSinkHTTP
+	}
+	switch exporter.Sink {
+	case auditSinkHTTP, auditSinkKafka:
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("invalid AUDIT_EXPORT_URL %q: the %s sink needs an http or https URL", rawURL, exporter.Sink)
+		}
+	case auditSinkSyslog:
+		if parsed.Scheme != "udp" && parsed.Scheme != "tcp" {
+			return fmt.Errorf("invalid AUDIT_EXPORT_URL %q: the syslog sink needs a udp:// or tcp:// URL", rawURL)
+		}
+	default:
+		return fmt.Errorf("invalid AUDIT_EXPORT_SINK %q: must be %s, %s or %s",
+			exporter.Sink, auditSinkHTTP, auditSinkKafka, auditSinkSyslog)
+	}
+
+	buffer := defaultAuditExportBuffer
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{{"AUDIT_EXPORT_BUFFER", &buffer}, {"AUDIT_EXPORT_BATCH_SIZE", &exporter.BatchSize}} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("invalid %s %q: must be a positive integer", setting.name, value)
+			}
+			*setting.value = parsed
+		}
+	}
+	for _, setting := range []struct {
+		name  string
+		value *time.Duration
+	}{{"AUDIT_EXPORT_FLUSH_INTERVAL", &exporter.FlushInterval}, {"AUDIT_EXPORT_TIMEOUT", &exporter.Timeout}} {
+		if value := os.Getenv(setting.name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				return fmt.Errorf("invalid %s %q: must be a positive duration", setting.name, value)
+			}
+			*setting.value = parsed
+		}
+	}
+	exporter.HTTPClient = &http.Client{Timeout: exporter.Timeout}
+	exporter.events = make(chan auditEvent, buffer)
+	newGaugeFunc("authbridge_audit_export_queue", "Audit events waiting for export",
+		func() float64 { return float64(len(exporter.events)) })
+
+	log.Printf("[Audit Export] Exporting audit events to the %s sink %s, buffer %d, batches of %d",
+		exporter.Sink, parsed.Redacted(), buffer, exporter.BatchSize)
+	go exporter.run()
+	auditExport = exporter
+	return nil
+}
+
+// Export enqueues an event without blocking; it is dropped when the buffer is full
+func (e *AuditExporter) Export(event string, fields map[string]string) {
+	if e == nil {
+		return
+	}
+	exported := auditEvent{"time": time.Now().UTC().Format(time.RFC3339Nano), "event": event}
+	for key, value := range fields {
+		exported[key] = value
+	}
+	select {
+	case e.events <- exported:
+	default:
+		auditEventsDropped.Inc("buffer_full")
+	}
+}
+
+// run sends a batch when it is full or FlushInterval after its first event
+func (e *AuditExporter) run() {
+	batch := make([]auditEvent, 0, e.BatchSize)
+	timer := time.NewTimer(e.FlushInterval)
+	timer.Stop()
+	for {
+		select {
+		case event := <-e.events:
+			if len(batch) == 0 {
+				timer.Reset(e.FlushInterval)
+			}
+			batch = append(batch, event)
+			if len(batch) < e.BatchSize {
+				continue
+			}
+			timer.Stop()
+		case <-timer.C:
+		}
+		e.deliver(batch)
+		batch = batch[:0]
+	}
+}
+
+// deliver sends a batch, retrying with backoff; events keep queueing, and are dropped
+// once the buffer is full, while the sink is down
+func (e *AuditExporter) deliver(batch []auditEvent) {
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		sent, err := e.send(batch)
+		auditEventsExported.Add(int64(sent))
+		if batch = batch[sent:]; err == nil {
+			return
+		}
+		auditExportFailures.Add(1)
+		if attempt == auditExportRetries {
+			log.Printf("[Audit Export] Dropping %d audit events: %v", len(batch), err)
+			for range batch {
+				auditEventsDropped.Inc("export_failed")
+			}
+			return
+		}
+		log.Printf("[Audit Export] Export failed, retrying in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send returns the number of events delivered from the start of the batch
+func (e *AuditExporter) send(batch []auditEvent) (int, error) {
+	var err error
+	switch e.Sink {
+	case auditSinkKafka:
+		records := make([]map[string]auditEvent, len(batch))
+		for i, event := range batch {
+			records[i] = map[string]auditEvent{"value": event}
+		}
+		err = e.post("application/vnd.kafka.json.v2+json", map[string]any{"records": records})
+	case auditSinkSyslog:
+		return e.sendSyslog(batch)
+	default:
+		err = e.post("application/json", batch)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// post sends the batch as one JSON document; any 2xx status is a delivery
+func (e *AuditExporter) post(contentType string, body any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := e.HTTPClient.Post(e.URL, contentType, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendSyslog writes each event as an RFC 5424 message with a JSON body: one datagram per
+// event over UDP, newline-delimited over TCP
+func (e *AuditExporter) sendSyslog(batch []auditEvent) (int, error) {
+	if e.conn == nil {
+		parsed, _ := url.Parse(e.URL)
+		conn, err := net.DialTimeout(parsed.Scheme, parsed.Host, e.Timeout)
+		if err != nil {
+			return 0, err
+		}
+		e.conn = conn
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	for sent, event := range batch {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return sent, err
+		}
+		message := fmt.Sprintf("<%d>1 %s %s authbridge - - - %s\n", syslogPriority, event["time"], hostname, payload)
+		_ = e.conn.SetWriteDeadline(time.Now().Add(e.Timeout))
+		if _, err := e.conn.Write([]byte(message)); err != nil {
+			e.conn.Close()
+			e.conn = nil
+			return sent, err
+		}
+	}
+	return len(batch), nil
+}
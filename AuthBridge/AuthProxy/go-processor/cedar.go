@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// cedarPolicySyncInterval is how often CEDAR_POLICY_FILE is checked for changes
+const cedarPolicySyncInterval = 10 * time.Second
+
+// CedarClient asks a Cedar authorization server (cedar-agent, usually a sidecar) whether
+// a request is allowed. The request maps to the Cedar entities
+//
+//	principal: User::"<token sub>"
+//	action:    Action::"<HTTP method>"
+//	resource:  Service::"<host>"
+//
+// and the whole PolicyInput is the context, so policies see the same document as with OPA.
+// Cedar only allows or denies; the exchange parameters stay as configured.
+type CedarClient struct {
+	// URL is the authorization endpoint, e.g. http://127.0.0.1:8180/v1/is_authorized
+	URL string
+	// PolicyURL is the endpoint SyncPolicies replaces the policies at, e.g.
+	// http://127.0.0.1:8180/v1/policies
+	PolicyURL string
+	// FailOpen allows requests when the server is unreachable or returns an error
+	FailOpen   bool
+	HTTPClient *http.Client
+}
+
+type cedarRequest struct {
+	Principal string         `json:"principal"`
+	Action    string         `json:"action"`
+	Resource  string         `json:"resource"`
+	Context   map[string]any `json:"context"`
+}
+
+type cedarResponse struct {
+	Decision    string `json:"decision"`
+	Diagnostics struct {
+		Reason []string `json:"reason"`
+		Errors []string `json:"errors"`
+	} `json:"diagnostics"`
+}
+
+// Name identifies the engine in logs
+func (c *CedarClient) Name() string {
+	return "Cedar"
+}
+
+// Decide evaluates the Cedar policies for the request
+func (c *CedarClient) Decide(input PolicyInput) PolicyDecision {
+	result, err := c.authorize(input)
+	if err != nil {
+		log.Printf("[Cedar] Authorization request failed: %v", err)
+		return failedDecision(c.FailOpen)
+	}
+	if len(result.Diagnostics.Errors) > 0 {
+		log.Printf("[Cedar] Policy errors: %v", result.Diagnostics.Errors)
+	}
+	decision := PolicyDecision{Allow: result.Decision == "Allow"}
+	if !decision.Allow {
+		decision.Reason = "denied by Cedar policy"
+		if len(result.Diagnostics.Reason) > 0 {
+			decision.Reason = fmt.Sprintf("denied by Cedar policy %v", result.Diagnostics.Reason)
+		}
+	}
+	return decision
+}
+
+func (c *CedarClient) authorize(input PolicyInput) (cedarResponse, error) {
+	var result cedarResponse
+	subject, _ := input.Token["sub"].(string)
+	context, err := cedarContext(input)
+	if err != nil {
+		return result, err
+	}
+	payload, err := json.Marshal(cedarRequest{
+		Principal: cedarEntity("User", subject),
+		Action:    cedarEntity("Action", input.Attributes.Method),
+		Resource:  cedarEntity("Service", input.Attributes.Host),
+		Context:   context,
+	})
+	if err != nil {
+		return result, err
+	}
+	resp, err := c.HTTPClient.Post(c.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result, nil
+}
+
+// SyncPolicies pushes the policies in file (cedar-agent's JSON format, a list of
+// {"id", "content"} objects) to the server, and again whenever the file changes
+func (c *CedarClient) SyncPolicies(file string, interval time.Duration) {
+	var pushed []byte
+	for {
+		pushed = c.syncPolicies(file, pushed)
+		time.Sleep(interval)
+	}
+}
+
+// syncPolicies pushes file unless its content was pushed already, and returns the
+// content the server has now
+func (c *CedarClient) syncPolicies(file string, pushed []byte) []byte {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		log.Printf("[Cedar] Failed to read policy file %s: %v", file, err)
+		return pushed
+	}
+	if bytes.Equal(content, pushed) {
+		return pushed
+	}
+	if err := c.putPolicies(content); err != nil {
+		log.Printf("[Cedar] Failed to load policies from %s: %v", file, err)
+		return pushed
+	}
+	log.Printf("[Cedar] Loaded policies from %s", file)
+	return content
+}
+
+func (c *CedarClient) putPolicies(content []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.PolicyURL, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// cedarPolicyURL derives cedar-agent's policy endpoint from its authorization endpoint,
+// which must end in /is_authorized
+func cedarPolicyURL(authorizeURL string) (string, error) {
+	parsed, err := url.Parse(authorizeURL)
+	if err != nil {
+		return "", err
+	}
+	base, ok := strings.CutSuffix(parsed.Path, "/is_authorized")
+	if !ok {
+		return "", fmt.Errorf("cannot derive the policy endpoint from %s: set CEDAR_POLICY_URL", authorizeURL)
+	}
+	parsed.Path = base + "/policies"
+	parsed.RawPath = ""
+	return parsed.String(), nil
+}
+
+// cedarEntity formats an entity UID such as User::"alice"
+func cedarEntity(entityType, id string) string {
+	quoted, _ := json.Marshal(id)
+	return entityType + "::" + string(quoted)
+}
+
+// cedarContext converts the input into a Cedar context record. Cedar has no null or
+// floating point values, so nulls are dropped and fractional numbers become strings.
+func cedarContext(input PolicyInput) (map[string]any, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	context, _ := cedarValue(document).(map[string]any)
+	return context, nil
+}
+
+func cedarValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		record := map[string]any{}
+		for key, element := range v {
+			if converted := cedarValue(element); converted != nil {
+				record[key] = converted
+			}
+		}
+		return record
+	case []any:
+		set := []any{}
+		for _, element := range v {
+			if converted := cedarValue(element); converted != nil {
+				set = append(set, converted)
+			}
+		}
+		return set
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return fmt.Sprint(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCedarValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{name: "string", value: "alice", want: "alice"},
+		{name: "boolean", value: true, want: true},
+		{name: "whole number", value: float64(1700000000), want: int64(1700000000)},
+		{name: "negative whole number", value: float64(-3), want: int64(-3)},
+		{name: "fraction", value: 1.5, want: "1.5"},
+		{name: "number beyond float precision", value: 1e20, want: "1e+20"},
+		{name: "null", value: nil, want: nil},
+		{
+			name:  "record with nulls",
+			value: map[string]any{"sub": "alice", "email": nil, "nested": map[string]any{"acr": nil, "level": 2.0}},
+			want:  map[string]any{"sub": "alice", "nested": map[string]any{"level": int64(2)}},
+		},
+		{
+			name:  "set with nulls",
+			value: []any{"admin", nil, 0.25},
+			want:  []any{"admin", "0.25"},
+		},
+		{name: "empty set", value: []any{nil}, want: []any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cedarValue(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cedarValue(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCedarContext(t *testing.T) {
+	var claims map[string]any
+	if err := json.Unmarshal([]byte(`{"sub":"alice","exp":1700000000,"score":0.5,"email":null}`), &claims); err != nil {
+		t.Fatal(err)
+	}
+	context, err := cedarContext(PolicyInput{
+		Attributes: RequestAttributes{Method: "GET", Host: "billing", Headers: map[string]string{}},
+		Token:      claims,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"sub": "alice", "exp": int64(1700000000), "score": "0.5"}
+	if got := context["token"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("context.token = %#v, want %#v", got, want)
+	}
+	if got := context["attributes"].(map[string]any)["host"]; got != "billing" {
+		t.Errorf("context.attributes.host = %#v", got)
+	}
+}
+
+func TestCedarEntity(t *testing.T) {
+	for id, want := range map[string]string{
+		"alice":      `User::"alice"`,
+		"":           `User::""`,
+		`evil"::"id`: `User::"evil\"::\"id"`,
+	} {
+		if got := cedarEntity("User", id); got != want {
+			t.Errorf("cedarEntity(User, %q) = %s, want %s", id, got, want)
+		}
+	}
+}
+
+func TestCedarClientDecide(t *testing.T) {
+	discardLogs(t)
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		failOpen bool
+		want     PolicyDecision
+	}{
+		{name: "allow", status: http.StatusOK, body: `{"decision":"Allow"}`, want: PolicyDecision{Allow: true}},
+		{name: "deny", status: http.StatusOK, body: `{"decision":"Deny"}`, want: PolicyDecision{Reason: "denied by Cedar policy"}},
+		{
+			name:   "deny naming the policies",
+			status: http.StatusOK,
+			body:   `{"decision":"Deny","diagnostics":{"reason":["forbid-billing"]}}`,
+			want:   PolicyDecision{Reason: "denied by Cedar policy [forbid-billing]"},
+		},
+		{name: "allow with policy errors", status: http.StatusOK, body: `{"decision":"Allow","diagnostics":{"errors":["bad"]}}`, want: PolicyDecision{Allow: true}},
+		{name: "invalid JSON", status: http.StatusOK, body: `not json`, want: failedDecision(false)},
+		{name: "server error", status: http.StatusInternalServerError, want: failedDecision(false)},
+		{name: "server error failing open", status: http.StatusInternalServerError, failOpen: true, want: failedDecision(true)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received cedarRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := &CedarClient{URL: server.URL + "/v1/is_authorized", FailOpen: tt.failOpen, HTTPClient: server.Client()}
+			got := client.Decide(PolicyInput{
+				Attributes: RequestAttributes{Method: "POST", Host: "billing"},
+				Token:      map[string]any{"sub": "alice"},
+			})
+			if got != tt.want {
+				t.Errorf("Decide() = %+v, want %+v", got, tt.want)
+			}
+			if received.Principal != `User::"alice"` || received.Action != `Action::"POST"` || received.Resource != `Service::"billing"` {
+				t.Errorf("Cedar received %+v", received)
+			}
+		})
+	}
+}
+
+func TestCedarPolicyURL(t *testing.T) {
+	for authorizeURL, want := range map[string]string{
+		"http://127.0.0.1:8180/v1/is_authorized": "http://127.0.0.1:8180/v1/policies",
+		"http://cedar/agent/v1/is_authorized":    "http://cedar/agent/v1/policies",
+		"http://cedar/authorize":                 "",
+		"http://cedar/v1/is_authorized/":         "",
+	} {
+		got, err := cedarPolicyURL(authorizeURL)
+		if want == "" {
+			if err == nil {
+				t.Errorf("cedarPolicyURL(%s) = %s, want an error", authorizeURL, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("cedarPolicyURL(%s) = %s, %v, want %s", authorizeURL, got, err, want)
+		}
+	}
+}
+
+func TestLoadPolicyEngineNeedsCedarPolicyURL(t *testing.T) {
+	defer func(engine PolicyEngine) { policyEngine = engine }(policyEngine)
+	t.Setenv("CEDAR_URL", "http://cedar/authorize")
+	t.Setenv("CEDAR_POLICY_FILE", filepath.Join(t.TempDir(), "policies.json"))
+	err := loadPolicyEngine()
+	if err == nil || !strings.Contains(err.Error(), "CEDAR_POLICY_URL") {
+		t.Errorf("loadPolicyEngine() = %v, want an error naming CEDAR_POLICY_URL", err)
+	}
+}
+
+func TestCedarSyncPolicies(t *testing.T) {
+	discardLogs(t)
+	var puts []string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v1/policies" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		puts = append(puts, string(body))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "policies.json")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := &CedarClient{URL: server.URL + "/v1/is_authorized", PolicyURL: server.URL + "/v1/policies", HTTPClient: server.Client()}
+
+	pushed := client.syncPolicies(file, nil)
+	if len(puts) != 0 || pushed != nil {
+		t.Fatalf("pushed %v without a policy file", puts)
+	}
+	write(`[{"id":"a"}]`)
+	pushed = client.syncPolicies(file, pushed)
+	pushed = client.syncPolicies(file, pushed)
+	if !reflect.DeepEqual(puts, []string{`[{"id":"a"}]`}) {
+		t.Fatalf("puts = %v, want the file pushed once", puts)
+	}
+
+	write(`[{"id":"b"}]`)
+	status = http.StatusBadRequest
+	pushed = client.syncPolicies(file, pushed)
+	if string(pushed) != `[{"id":"a"}]` {
+		t.Fatalf("a rejected push was recorded as %s", pushed)
+	}
+	status = http.StatusOK
+	pushed = client.syncPolicies(file, pushed)
+	if string(pushed) != `[{"id":"b"}]` || len(puts) != 3 {
+		t.Fatalf("puts = %v, want the rejected file pushed again", puts)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+// Actor token sources (ACTOR_TOKEN_SOURCE)
+const (
+	actorSourceNone              = "none"
+	actorSourceClientCredentials = "client-credentials"
+	actorSourceFile              = "file"
+)
+
+const (
+	defaultMaxChainDepth  = 5
+	defaultActorTokenFile = "/opt/jwt_svid.token"
+)
+
+// ActorToken is the RFC 8693 actor_token sent with a token exchange; the zero value sends none
+type ActorToken struct {
+	Token string
+	Type  string
+}
+
+// IdentityChain names this workload as the actor of every exchange. When agent A calls
+// agent B with a token A obtained by exchange, B's exchange keeps the user as sub and
+// nests A's act claim under B's, so the token received upstream names every agent on
+// the path.
+type IdentityChain struct {
+	Source string
+	// File holds the actor token for the file source, e.g. the JWT-SVID from spiffe-helper
+	File string
+	// MaxDepth is the most actors an exchanged token may name; 0 means unlimited
+	MaxDepth int
+
+	mu      sync.Mutex
+	cached  string
+	expires time.Time
+}
+
+var identityChain = &IdentityChain{Source: actorSourceNone, MaxDepth: defaultMaxChainDepth}
+
+// loadIdentityChain reads ACTOR_TOKEN_SOURCE, ACTOR_TOKEN_FILE and MAX_CHAIN_DEPTH
+func loadIdentityChain() error {
+	chain := &IdentityChain{
+		Source:   strings.ToLower(strings.TrimSpace(os.Getenv("ACTOR_TOKEN_SOURCE"))),
+		File:     defaultActorTokenFile,
+		MaxDepth: defaultMaxChainDepth,
+	}
+	if chain.Source == "" {
+		chain.Source = actorSourceNone
+	}
+	if chain.Source != actorSourceNone && chain.Source != actorSourceClientCredentials && chain.Source != actorSourceFile {
+		return fmt.Errorf("invalid ACTOR_TOKEN_SOURCE %q: must be %s, %s or %s", chain.Source, actorSourceNone, actorSourceClientCredentials, actorSourceFile)
+	}
+	if file := os.Getenv("ACTOR_TOKEN_FILE"); file != "" {
+		chain.File = file
+	}
+	if value := os.Getenv("MAX_CHAIN_DEPTH"); value != "" {
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth < 0 {
+			return fmt.Errorf("invalid MAX_CHAIN_DEPTH %q: must be a non-negative integer", value)
+		}
+		chain.MaxDepth = depth
+	}
+
+	log.Printf("[Identity Chain] Actor token source: %s, max chain depth: %d", chain.Source, chain.MaxDepth)
+	identityChain = chain
+	return nil
+}
+
+// Enabled reports whether exchanges carry an actor token
+func (c *IdentityChain) Enabled() bool {
+	return c.Source == actorSourceClientCredentials || c.Source == actorSourceFile
+}
+
+// Prepare returns the actor token for exchanging subjectToken, or an ImmediateResponse
+// denying the request when adding this workload would exceed MaxDepth
+func (c *IdentityChain) Prepare(subjectToken, clientID, clientSecret, tokenURL string) (ActorToken, *v3.ImmediateResponse, error) {
+	if !c.Enabled() {
+		return ActorToken{}, nil, nil
+	}
+	actors := actorChain(tokenClaims(subjectToken))
+	if c.MaxDepth > 0 && len(actors)+1 > c.MaxDepth {
+		log.Printf("[Identity Chain] Denied: chain %v plus this workload exceeds MAX_CHAIN_DEPTH %d", actors, c.MaxDepth)
+		return ActorToken{}, policyDeniedResponse(PolicyDecision{
+			Reason: fmt.Sprintf("delegation chain exceeds %d actors", c.MaxDepth),
+		}), nil
+	}
+	actor, err := c.actorToken(clientID, clientSecret, tokenURL)
+	if err != nil {
+		return ActorToken{}, nil, fmt.Errorf("failed to get actor token: %w", err)
+	}
+	return actor, nil, nil
+}
+
+// Reset drops the cached actor token, which belongs to the previous client credentials
+func (c *IdentityChain) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cached = ""
+	c.expires = time.Time{}
+}
+
+func (c *IdentityChain) actorToken(clientID, clientSecret, tokenURL string) (ActorToken, error) {
+	if c.Source == actorSourceFile {
+		// read on every exchange, spiffe-helper rotates the file
+		token, err := readFileContent(c.File)
+		if err != nil {
+			return ActorToken{}, err
+		}
+		return ActorToken{Token: token, Type: exchange.JWTTokenType}, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != "" && time.Now().Before(c.expires) {
+		return ActorToken{Token: c.cached, Type: exchange.AccessTokenType}, nil
+	}
+	token, expiresIn, err := clientCredentialsToken(clientID, clientSecret, tokenURL)
+	if err != nil {
+		return ActorToken{}, err
+	}
+	c.cached = token
+	// renew CLOCK_SKEW before the token expires on the IdP's clock
+	c.expires = time.Now().Add(time.Duration(expiresIn)*time.Second - clockSkew)
+	return ActorToken{Token: token, Type: exchange.AccessTokenType}, nil
+}
+
+// grantError is an error response to the client credentials grant
+type grantError struct {
+	Status int
+	Body   string
+}
+
+func (e *grantError) Error() string {
+	return fmt.Sprintf("client credentials grant failed with status %d: %s", e.Status, e.Body)
+}
+
+// clientCredentialsToken fetches a token for this workload's own client
+func clientCredentialsToken(clientID, clientSecret, tokenURL string) (string, int, error) {
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	if !exchange.MutualTLS(clientAuthMethod) {
+		data.Set("client_secret", clientSecret)
+	}
+	data.Set("grant_type", "client_credentials")
+
+	resp, err := idpClient.PostForm(tokenURL, data)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, &grantError{Status: resp.StatusCode, Body: string(body)}
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	return token.AccessToken, token.ExpiresIn, nil
+}
+
+// actorChain lists the actors of a token's nested act claims, the current actor first
+func actorChain(claims map[string]any) []string {
+	actors := []string{}
+	act, _ := claims["act"].(map[string]any)
+	for act != nil {
+		actor, _ := act["sub"].(string)
+		if actor == "" {
+			actor, _ = act["client_id"].(string)
+		}
+		actors = append(actors, actor)
+		act, _ = act["act"].(map[string]any)
+	}
+	return actors
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const (
+	defaultCredentialsWait         = 60 * time.Second
+	defaultCredentialsPollInterval = 2 * time.Second
+)
+
+// Failure policies for requests that arrive before the client credentials
+const (
+	// credentialsPolicyPassthrough forwards the request with the caller's token
+	credentialsPolicyPassthrough = "passthrough"
+	// credentialsPolicyDeny answers 503, so the caller retries once the credentials arrived
+	credentialsPolicyDeny = "deny"
+)
+
+// CredentialsWait describes how the processor waits for the credential files of
+// client-registration. The gRPC port is bound from the start; requests arriving before
+// the credentials follow Policy.
+type CredentialsWait struct {
+	// Wait bounds the polling of the credential files; later files are still picked up by
+	// the rotation watcher
+	Wait         time.Duration
+	PollInterval time.Duration
+	Policy       string
+}
+
+var credentialsWait = CredentialsWait{
+	Wait:         defaultCredentialsWait,
+	PollInterval: defaultCredentialsPollInterval,
+	Policy:       credentialsPolicyPassthrough,
+}
+
+// loadCredentialsWait reads CREDENTIALS_WAIT, CREDENTIALS_POLL_INTERVAL and
+// CREDENTIALS_FAILURE_POLICY
+func loadCredentialsWait() error {
+	wait := CredentialsWait{
+		Wait:         defaultCredentialsWait,
+		PollInterval: defaultCredentialsPollInterval,
+		Policy:       credentialsPolicyPassthrough,
+	}
+	if value := os.Getenv("CREDENTIALS_WAIT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("invalid CREDENTIALS_WAIT %q: must be a non-negative duration", value)
+		}
+		wait.Wait = parsed
+	}
+	if value := os.Getenv("CREDENTIALS_POLL_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid CREDENTIALS_POLL_INTERVAL %q: must be a positive duration", value)
+		}
+		wait.PollInterval = parsed
+	}
+	if value := os.Getenv("CREDENTIALS_FAILURE_POLICY"); value != "" {
+		switch value {
+		case credentialsPolicyPassthrough, credentialsPolicyDeny:
+			wait.Policy = value
+		default:
+			return fmt.Errorf("invalid CREDENTIALS_FAILURE_POLICY %q: must be %s or %s",
+				value, credentialsPolicyPassthrough, credentialsPolicyDeny)
+		}
+	}
+	credentialsWait = wait
+	return nil
+}
+
+// startCredentialsWait loads the credentials available now and, when some are missing,
+// polls the credential files in the background, so the processor serves while
+// client-registration finishes
+func startCredentialsWait() {
+	loadConfig()
+	if credentialsLoaded() {
+		return
+	}
+	go waitForCredentials(credentialsWait.Wait, credentialsWait.PollInterval)
+}
+
+// waitForCredentials polls the credential files until the client ID and, unless the client
+// authenticates with a certificate, the secret have content or maxWait passed, then reloads
+// the configuration
+func waitForCredentials(maxWait, interval time.Duration) bool {
+	clientIDFile := credentialFile("CLIENT_ID_FILE", "/shared/client-id.txt")
+	clientSecretFile := credentialFile("CLIENT_SECRET_FILE", "/shared/client-secret.txt")
+
+	log.Printf("[Config] Waiting for credential files (max %v, every %v), requests are handled with policy %s meanwhile",
+		maxWait, interval, credentialsWait.Policy)
+	deadline := time.Now().Add(maxWait)
+	for {
+		// a missing secret file leaves clientSecret empty, which certificate authentication allows
+		clientID, _ := readFileContent(clientIDFile)
+		clientSecret, _ := readFileContent(clientSecretFile)
+		if clientAuthenticated(clientID, clientSecret) {
+			log.Printf("[Config] Credential files are ready")
+			loadConfig()
+			return true
+		}
+		if !time.Now().Add(interval).Before(deadline) {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	log.Printf("[Config] Timeout waiting for credentials, the rotation watcher picks them up when they arrive")
+	return false
+}
+
+// credentialsLoaded reports whether the client credentials are known
+func credentialsLoaded() bool {
+	clientID, clientSecret, _, _, _ := getConfig()
+	return clientAuthenticated(clientID, clientSecret)
+}
+
+// credentialsPendingResponse denies a request that needs the client credentials before they
+// are loaded, if the failure policy says so
+func credentialsPendingResponse(clientID, clientSecret string) *v3.ImmediateResponse {
+	if credentialsWait.Policy != credentialsPolicyDeny || clientAuthenticated(clientID, clientSecret) {
+		return nil
+	}
+	log.Printf("[Config] Denied a request: client credentials are not loaded yet")
+	return policyDeniedResponse(PolicyDecision{Status: http.StatusServiceUnavailable, Reason: "client credentials are not loaded yet"})
+}
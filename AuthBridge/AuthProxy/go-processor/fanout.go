@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const defaultFanoutCacheEntries = 10000
+
+// FanoutExchange is an additional audience a request's token is exchanged for, for
+// aggregating upstreams that call several services on the caller's behalf
+type FanoutExchange struct {
+	Audience string `json:"audience"`
+	Scopes   string `json:"scopes"`
+	// Header carries the token; it defaults to x-token-<audience>
+	Header string `json:"header,omitempty"`
+	// Prefix precedes the token in Header
+	Prefix string `json:"prefix,omitempty"`
+}
+
+var (
+	fanoutExchanges []FanoutExchange
+	fanoutCache     = newTokenCache(defaultFanoutCacheEntries, fanoutCacheEvictions, fanoutCacheEntries)
+)
+
+var (
+	fanoutCacheHits = newCounter("authbridge_fanout_cache_hits_total",
+		"Fan-out exchanges answered from the token cache")
+	fanoutCacheMisses = newCounter("authbridge_fanout_cache_misses_total",
+		"Fan-out exchanges sent to the token endpoint")
+	fanoutCacheEvictions = newCounter("authbridge_fanout_cache_evictions_total",
+		"Tokens evicted from the fan-out cache to stay within FANOUT_CACHE_MAX_ENTRIES")
+	fanoutCacheEntries = newGauge("authbridge_fanout_cache_entries",
+		"Tokens in the fan-out cache")
+)
+
+// loadFanout reads FANOUT_EXCHANGES, a JSON list of exchanges, or FANOUT_EXCHANGES_FILE,
+// and FANOUT_CACHE_MAX_ENTRIES
+func loadFanout() error {
+	var exchanges []FanoutExchange
+	config := os.Getenv("FANOUT_EXCHANGES")
+	if file := os.Getenv("FANOUT_EXCHANGES_FILE"); file != "" {
+		content, err := readFileContent(file)
+		if err != nil {
+			return fmt.Errorf("failed to read FANOUT_EXCHANGES_FILE: %w", err)
+		}
+		config = content
+	}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &exchanges); err != nil {
+			return fmt.Errorf("failed to parse fan-out exchanges: %w", err)
+		}
+	}
+	headers := map[string]bool{}
+	for i := range exchanges {
+		fanout := &exchanges[i]
+		if fanout.Audience == "" {
+			return fmt.Errorf("fan-out exchange %d: an audience is required", i)
+		}
+		if fanout.Header == "" {
+			fanout.Header = "x-token-" + fanout.Audience
+		}
+		fanout.Header = strings.ToLower(fanout.Header)
+		if !validHeaderName(fanout.Header) || fanout.Header == "authorization" || fanout.Header == "host" {
+			return fmt.Errorf("fan-out exchange %d: invalid header %q", i, fanout.Header)
+		}
+		if headers[fanout.Header] {
+			return fmt.Errorf("fan-out exchange %d: header %q is used twice", i, fanout.Header)
+		}
+		headers[fanout.Header] = true
+		if strings.ContainsAny(fanout.Prefix, "\r\n") {
+			return fmt.Errorf("fan-out exchange %d: prefix must not contain line breaks", i)
+		}
+	}
+
+	entries := defaultFanoutCacheEntries
+	if value := os.Getenv("FANOUT_CACHE_MAX_ENTRIES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid FANOUT_CACHE_MAX_ENTRIES %q: must be a positive integer", value)
+		}
+		entries = n
+	}
+	if len(exchanges) > 0 {
+		log.Printf("[Fan-out] Exchanging for %d additional audiences, cache max entries: %d", len(exchanges), entries)
+	}
+	fanoutExchanges = exchanges
+	fanoutCache = newTokenCache(entries, fanoutCacheEvictions, fanoutCacheEntries)
+	return nil
+}
+
+// fanoutMutation exchanges subjectToken for every fan-out audience, concurrently and
+// through the cache, and sets each token in its header. With stale-if-error, a failed
+// exchange falls back to the cached token. A header without a token is removed, so
+// upstream never sees a value the caller set itself.
+func fanoutMutation(mutation *v3.HeaderMutation, subjectToken, clientID, clientSecret, tokenURL, requestID string, logs requestLog) {
+	if len(fanoutExchanges) == 0 {
+		return
+	}
+	actor, denial, err := identityChain.Prepare(subjectToken, clientID, clientSecret, tokenURL)
+	tokens := make([]string, len(fanoutExchanges))
+	if denial == nil && err == nil {
+		var wg sync.WaitGroup
+		for i, fanout := range fanoutExchanges {
+			if token := fanoutCache.Get(subjectToken, fanout.Audience, fanout.Scopes); token != "" {
+				fanoutCacheHits.Add(1)
+				tokens[i] = token
+				continue
+			}
+			fanoutCacheMisses.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := exchangeToken(clientID, clientSecret, tokenURL, subjectToken, fanout.Audience, fanout.Scopes, requestID, actor, logs)
+				if err != nil {
+					log.Printf("[Fan-out] Exchange for audience %s failed: %v", fanout.Audience, err)
+					tokens[i] = staleToken(fanoutCache, err, subjectToken, fanout.Audience, fanout.Scopes, staleExchangeFanout)
+					return
+				}
+				fanoutCache.Put(subjectToken, fanout.Audience, fanout.Scopes, token)
+				tokens[i] = token
+			}()
+		}
+		wg.Wait()
+	} else {
+		log.Printf("[Fan-out] Skipping the fan-out exchanges: no actor token")
+		if denial == nil {
+			for i, fanout := range fanoutExchanges {
+				tokens[i] = staleToken(fanoutCache, err, subjectToken, fanout.Audience, fanout.Scopes, staleExchangeFanout)
+			}
+		}
+	}
+
+	for i, fanout := range fanoutExchanges {
+		if tokens[i] == "" {
+			mutation.RemoveHeaders = append(mutation.RemoveHeaders, fanout.Header)
+			continue
+		}
+		mutation.SetHeaders = append(mutation.SetHeaders, overwrite(fanout.Header, fanout.Prefix+tokens[i]))
+	}
+}
+
+// fanoutHeaders removes the fan-out headers from a request that is not exchanged
+func fanoutHeaders(mutation *v3.HeaderMutation, headers []*core.HeaderValue) {
+	for _, fanout := range fanoutExchanges {
+		if getHeaderValue(headers, fanout.Header) != "" {
+			mutation.RemoveHeaders = append(mutation.RemoveHeaders, fanout.Header)
+		}
+	}
+}
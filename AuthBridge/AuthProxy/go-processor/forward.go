@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// defaultOriginalTokenHeader is the header that carries the inbound token upstream, the
+// name oauth2-proxy and several MCP servers read
+const defaultOriginalTokenHeader = "x-forwarded-access-token"
+
+// originalTokenHeader carries the inbound token upstream next to the exchanged token in
+// Authorization; empty disables forwarding
+var originalTokenHeader string
+
+// loadOriginalTokenForwarding reads FORWARD_ORIGINAL_TOKEN and FORWARD_ORIGINAL_TOKEN_HEADER
+func loadOriginalTokenForwarding() error {
+	originalTokenHeader = ""
+	value := os.Getenv("FORWARD_ORIGINAL_TOKEN")
+	if value == "" {
+		return nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid FORWARD_ORIGINAL_TOKEN %q: %w", value, err)
+	}
+	if !enabled {
+		return nil
+	}
+	header := strings.ToLower(strings.TrimSpace(os.Getenv("FORWARD_ORIGINAL_TOKEN_HEADER")))
+	if header == "" {
+		header = defaultOriginalTokenHeader
+	}
+	if !validHeaderName(header) || header == "authorization" {
+		return fmt.Errorf("invalid FORWARD_ORIGINAL_TOKEN_HEADER %q: must be a header name other than authorization", header)
+	}
+	originalTokenHeader = header
+	return nil
+}
+
+// validHeaderName reports whether name is an HTTP field name (RFC 9110 token)
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// forwardOriginalToken adds the inbound token to an allowed request when the exchange
+// replaced it. Otherwise it removes the header, so upstream never sees a value the
+// caller set itself.
+func forwardOriginalToken(resp *v3.ProcessingResponse, headers []*core.HeaderValue, original, forwarded string) {
+	if originalTokenHeader == "" {
+		return
+	}
+	rh, ok := resp.Response.(*v3.ProcessingResponse_RequestHeaders)
+	if !ok {
+		return
+	}
+	if original != "" && forwarded != original {
+		mutation := headerMutation(rh.RequestHeaders)
+		mutation.SetHeaders = append(mutation.SetHeaders, &core.HeaderValueOption{
+			Header:       &core.HeaderValue{Key: originalTokenHeader, RawValue: []byte(original)},
+			AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+		})
+		return
+	}
+	if getHeaderValue(headers, originalTokenHeader) != "" {
+		mutation := headerMutation(rh.RequestHeaders)
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, originalTokenHeader)
+	}
+}
+
+// headerMutation returns the header mutation of a headers response, creating it if needed
+func headerMutation(resp *v3.HeadersResponse) *v3.HeaderMutation {
+	if resp.Response == nil {
+		resp.Response = &v3.CommonResponse{}
+	}
+	if resp.Response.HeaderMutation == nil {
+		resp.Response.HeaderMutation = &v3.HeaderMutation{}
+	}
+	return resp.Response.HeaderMutation
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Headers a trusted gateway sets to choose the exchange parameters of a request. They are
+// removed before the request is forwarded, whoever set them.
+const (
+	gatewayAudienceHeader = "x-kagenti-audience"
+	gatewayScopesHeader   = "x-kagenti-scopes"
+)
+
+// trustedGateways are the ext_proc clients whose gateway headers are honored, nil when off
+var trustedGateways *TrustedGateways
+
+// TrustedGateways identifies gateways by the address of their ext_proc connection or by
+// the verified client certificate of the gRPC TLS handshake
+type TrustedGateways struct {
+	CIDRs []netip.Prefix
+	// Identities are URI SANs (e.g. SPIFFE IDs) or DNS SANs of gateway certificates
+	Identities []string
+}
+
+// loadTrustedGateways reads TRUSTED_GATEWAY_CIDRS and TRUSTED_GATEWAY_IDENTITIES. Identities
+// need the client certificates the gRPC TLS settings verify (see loadExtProcTLS).
+func loadTrustedGateways(clientCertsVerified bool) error {
+	trustedGateways = nil
+	gateways := &TrustedGateways{}
+	for _, value := range splitList(os.Getenv("TRUSTED_GATEWAY_CIDRS")) {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(value)
+			if addrErr != nil {
+				return fmt.Errorf("invalid TRUSTED_GATEWAY_CIDRS entry %q: %w", value, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		gateways.CIDRs = append(gateways.CIDRs, prefix.Masked())
+	}
+	gateways.Identities = splitList(os.Getenv("TRUSTED_GATEWAY_IDENTITIES"))
+	if len(gateways.Identities) > 0 && !clientCertsVerified {
+		return fmt.Errorf("TRUSTED_GATEWAY_IDENTITIES needs EXTPROC_TLS_CLIENT_CA_FILE to verify gateway certificates")
+	}
+	if len(gateways.CIDRs) == 0 && len(gateways.Identities) == 0 {
+		return nil
+	}
+	log.Printf("[Trusted Gateway] Honoring %s and %s from %v %v", gatewayAudienceHeader, gatewayScopesHeader,
+		gateways.CIDRs, gateways.Identities)
+	trustedGateways = gateways
+	return nil
+}
+
+// Trusted reports whether the ext_proc client of the stream is a trusted gateway
+func (g *TrustedGateways) Trusted(ctx context.Context) bool {
+	if g == nil {
+		return false
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	if tcp, ok := p.Addr.(*net.TCPAddr); ok {
+		if addr, ok := netip.AddrFromSlice(tcp.IP); ok {
+			addr = addr.Unmap()
+			for _, prefix := range g.CIDRs {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+		}
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return false
+	}
+	leaf := info.State.VerifiedChains[0][0]
+	for _, uri := range leaf.URIs {
+		if slices.Contains(g.Identities, uri.String()) {
+			return true
+		}
+	}
+	for _, name := range leaf.DNSNames {
+		if slices.Contains(g.Identities, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatewayParameters returns the audience and scopes requested by the gateway headers;
+// values with control characters, or an audience with spaces, are ignored
+func gatewayParameters(headers []*core.HeaderValue) (audience, scopes string) {
+	audience = strings.TrimSpace(getHeaderValue(headers, gatewayAudienceHeader))
+	if strings.ContainsFunc(audience, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		log.Printf("[Trusted Gateway] Ignoring invalid %s %q", gatewayAudienceHeader, audience)
+		audience = ""
+	}
+	scopes = strings.Join(strings.Fields(getHeaderValue(headers, gatewayScopesHeader)), " ")
+	if strings.ContainsFunc(scopes, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		log.Printf("[Trusted Gateway] Ignoring invalid %s %q", gatewayScopesHeader, scopes)
+		scopes = ""
+	}
+	return audience, scopes
+}
+
+// stripGatewayHeaders removes the gateway headers from an allowed request
+func stripGatewayHeaders(resp *v3.ProcessingResponse, headers []*core.HeaderValue) {
+	rh, ok := resp.Response.(*v3.ProcessingResponse_RequestHeaders)
+	if !ok {
+		return
+	}
+	for _, header := range []string{gatewayAudienceHeader, gatewayScopesHeader} {
+		if getHeaderValue(headers, header) != "" {
+			mutation := headerMutation(rh.RequestHeaders)
+			mutation.RemoveHeaders = append(mutation.RemoveHeaders, header)
+		}
+	}
+}
+
+// loadExtProcTLS reads EXTPROC_TLS_CERT_FILE and EXTPROC_TLS_KEY_FILE, which make the gRPC
+// server speak TLS, and EXTPROC_TLS_CLIENT_CA_FILE, which requires and verifies client
+// certificates. The server certificate is reloaded when it rotates. It returns no options
+// without a certificate.
+func loadExtProcTLS() (opts []grpc.ServerOption, clientCertsVerified bool, err error) {
+	certFile, keyFile := os.Getenv("EXTPROC_TLS_CERT_FILE"), os.Getenv("EXTPROC_TLS_KEY_FILE")
+	caFile := os.Getenv("EXTPROC_TLS_CLIENT_CA_FILE")
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, false, fmt.Errorf("EXTPROC_TLS_CLIENT_CA_FILE needs EXTPROC_TLS_CERT_FILE and EXTPROC_TLS_KEY_FILE")
+		}
+		return nil, false, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, false, fmt.Errorf("EXTPROC_TLS_CERT_FILE and EXTPROC_TLS_KEY_FILE must be set together")
+	}
+	files := &certificateFiles{certFile: certFile, keyFile: keyFile}
+	if _, err := files.get(); err != nil {
+		return nil, false, err
+	}
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return files.get() },
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read EXTPROC_TLS_CLIENT_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, false, fmt.Errorf("EXTPROC_TLS_CLIENT_CA_FILE %s has no PEM certificates", caFile)
+		}
+		config.ClientCAs, config.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	log.Printf("[Trusted Gateway] Serving ext_proc over TLS, client certificates verified: %v", caFile != "")
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, caFile != "", nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/url"
+	"slices"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+)
+
+// fakeStream replays requests to Process and records its responses
+type fakeStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  []*v3.ProcessingRequest
+	responses []*v3.ProcessingResponse
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) Recv() (*v3.ProcessingRequest, error) {
+	if len(s.requests) == 0 {
+		return nil, io.EOF
+	}
+	req := s.requests[0]
+	s.requests = s.requests[1:]
+	return req, nil
+}
+
+func (s *fakeStream) Send(resp *v3.ProcessingResponse) error {
+	s.responses = append(s.responses, resp)
+	return nil
+}
+
+// tcpPeer returns a context whose ext_proc client connects from ip
+func tcpPeer(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+}
+
+// tlsPeer returns a context whose ext_proc client presented cert, verified when verified is set
+func tlsPeer(t *testing.T, cert *x509.Certificate, verified bool) context.Context {
+	t.Helper()
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 40000},
+		AuthInfo: credentials.TLSInfo{State: state},
+	})
+}
+
+func TestTrustedGatewaysTrusted(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://cluster.local/ns/gateway/sa/gateway")
+	otherID, _ := url.Parse("spiffe://cluster.local/ns/default/sa/agent")
+	gatewayCert := &x509.Certificate{URIs: []*url.URL{spiffeID}}
+	dnsCert := &x509.Certificate{DNSNames: []string{"gateway.gateway.svc"}}
+	otherCert := &x509.Certificate{URIs: []*url.URL{otherID}, DNSNames: []string{"agent.default.svc"}}
+
+	t.Setenv("TRUSTED_GATEWAY_CIDRS", "10.0.0.0/8, fd00::/64")
+	t.Setenv("TRUSTED_GATEWAY_IDENTITIES", spiffeID.String()+",gateway.gateway.svc")
+	if err := loadTrustedGateways(true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedGateways = nil })
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{name: "address in a CIDR", ctx: tcpPeer("10.1.2.3"), want: true},
+		{name: "IPv4-mapped address in a CIDR", ctx: tcpPeer("::ffff:10.1.2.3"), want: true},
+		{name: "IPv6 address in a CIDR", ctx: tcpPeer("fd00::5"), want: true},
+		{name: "address outside the CIDRs", ctx: tcpPeer("192.168.0.1")},
+		{name: "no peer", ctx: context.Background()},
+		{name: "verified URI SAN", ctx: tlsPeer(t, gatewayCert, true), want: true},
+		{name: "verified DNS SAN", ctx: tlsPeer(t, dnsCert, true), want: true},
+		{name: "verified certificate of another workload", ctx: tlsPeer(t, otherCert, true)},
+		{name: "unverified gateway certificate", ctx: tlsPeer(t, gatewayCert, false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trustedGateways.Trusted(tt.ctx); got != tt.want {
+				t.Errorf("Trusted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	var off *TrustedGateways
+	if off.Trusted(tcpPeer("10.1.2.3")) {
+		t.Error("nil TrustedGateways trusted a peer")
+	}
+}
+
+func TestLoadTrustedGateways(t *testing.T) {
+	t.Cleanup(func() { trustedGateways = nil })
+	tests := []struct {
+		name, cidrs, identities string
+		clientCertsVerified     bool
+		wantCIDRs               []string
+		wantOff, wantErr        bool
+	}{
+		{name: "off", wantOff: true},
+		{name: "CIDRs and bare addresses", cidrs: "10.1.2.3/8, 192.168.0.1 ,fd00::1", wantCIDRs: []string{"10.0.0.0/8", "192.168.0.1/32", "fd00::1/128"}},
+		{name: "invalid CIDR", cidrs: "10.0.0.0/33", wantErr: true},
+		{name: "invalid address", cidrs: "gateway", wantErr: true},
+		{name: "identities with verified client certificates", identities: "spiffe://cluster.local/ns/gateway/sa/gateway", clientCertsVerified: true},
+		{name: "identities without verified client certificates", identities: "spiffe://cluster.local/ns/gateway/sa/gateway", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_GATEWAY_CIDRS", tt.cidrs)
+			t.Setenv("TRUSTED_GATEWAY_IDENTITIES", tt.identities)
+			err := loadTrustedGateways(tt.clientCertsVerified)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTrustedGateways() = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr || tt.wantOff {
+				if trustedGateways != nil {
+					t.Errorf("trustedGateways = %+v, want nil", trustedGateways)
+				}
+				return
+			}
+			var cidrs []string
+			for _, prefix := range trustedGateways.CIDRs {
+				cidrs = append(cidrs, prefix.String())
+			}
+			if !slices.Equal(cidrs, tt.wantCIDRs) {
+				t.Errorf("CIDRs = %v, want %v", cidrs, tt.wantCIDRs)
+			}
+		})
+	}
+}
+
+func TestGatewayParameters(t *testing.T) {
+	tests := []struct {
+		name, audience, scopes   string
+		wantAudience, wantScopes string
+	}{
+		{name: "none"},
+		{name: "audience and scopes", audience: " billing ", scopes: " openid   billing ", wantAudience: "billing", wantScopes: "openid billing"},
+		{name: "audience with a space", audience: "billing admin", scopes: "openid", wantScopes: "openid"},
+		{name: "audience with a control character", audience: "billing\x00", scopes: "openid", wantScopes: "openid"},
+		{name: "scopes with a control character", audience: "billing", scopes: "openid\x7f", wantAudience: "billing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardLogs(t)
+			var headers []*core.HeaderValue
+			if tt.audience != "" {
+				headers = append(headers, &core.HeaderValue{Key: gatewayAudienceHeader, RawValue: []byte(tt.audience)})
+			}
+			if tt.scopes != "" {
+				headers = append(headers, &core.HeaderValue{Key: gatewayScopesHeader, RawValue: []byte(tt.scopes)})
+			}
+			audience, scopes := gatewayParameters(headers)
+			if audience != tt.wantAudience || scopes != tt.wantScopes {
+				t.Errorf("gatewayParameters() = %q, %q, want %q, %q", audience, scopes, tt.wantAudience, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestStripGatewayHeaders(t *testing.T) {
+	headers := []*core.HeaderValue{
+		{Key: "authorization", RawValue: []byte("Bearer token")},
+		{Key: gatewayAudienceHeader, RawValue: []byte("billing")},
+		{Key: gatewayScopesHeader, RawValue: []byte("openid")},
+	}
+	resp := &v3.ProcessingResponse{Response: &v3.ProcessingResponse_RequestHeaders{RequestHeaders: &v3.HeadersResponse{}}}
+	stripGatewayHeaders(resp, headers)
+	removed := resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetRemoveHeaders()
+	if want := []string{gatewayAudienceHeader, gatewayScopesHeader}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveHeaders = %v, want %v", removed, want)
+	}
+
+	resp = &v3.ProcessingResponse{Response: &v3.ProcessingResponse_RequestHeaders{RequestHeaders: &v3.HeadersResponse{}}}
+	stripGatewayHeaders(resp, headers[:1])
+	if resp.GetRequestHeaders().GetResponse() != nil {
+		t.Errorf("request without gateway headers got a mutation: %v", resp.GetRequestHeaders().GetResponse())
+	}
+
+	denied := &v3.ProcessingResponse{Response: &v3.ProcessingResponse_ImmediateResponse{ImmediateResponse: &v3.ImmediateResponse{}}}
+	stripGatewayHeaders(denied, headers)
+	if denied.GetImmediateResponse() == nil {
+		t.Error("stripGatewayHeaders replaced an immediate response")
+	}
+}
+
+// TestProcessGatewayHeaders exchanges tokens for the audience of the gateway headers only
+// when a trusted gateway sends them, and never forwards the headers
+func TestProcessGatewayHeaders(t *testing.T) {
+	discardLogs(t)
+	idp := exchangetest.NewIdP()
+	defer idp.Close()
+	secret := exchangetest.RandomSecret()
+	idp.AddClient("agent", secret)
+	idp.AddAudience("default-target")
+	idp.AddAudience("gateway-target")
+	t.Setenv("TOKEN_URL", idp.TokenURL())
+	t.Setenv("CLIENT_ID", "agent")
+	t.Setenv("CLIENT_SECRET", secret)
+	t.Setenv("CLIENT_ID_FILE", "/nonexistent")
+	t.Setenv("CLIENT_SECRET_FILE", "/nonexistent")
+	t.Setenv("TARGET_AUDIENCE", "default-target")
+	t.Setenv("TARGET_SCOPES", "openid")
+	loadConfig()
+
+	t.Setenv("TRUSTED_GATEWAY_CIDRS", "10.0.0.0/8")
+	if err := loadTrustedGateways(false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { trustedGateways = nil })
+
+	tests := []struct {
+		name, peer, wantAudience, wantScopes string
+	}{
+		{name: "trusted gateway", peer: "10.0.0.5", wantAudience: "gateway-target", wantScopes: "openid billing"},
+		{name: "untrusted peer", peer: "192.168.0.5", wantAudience: "default-target", wantScopes: "openid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &fakeStream{ctx: tcpPeer(tt.peer), requests: []*v3.ProcessingRequest{{
+				Request: &v3.ProcessingRequest_RequestHeaders{RequestHeaders: &v3.HttpHeaders{Headers: &core.HeaderMap{
+					Headers: []*core.HeaderValue{
+						{Key: ":method", RawValue: []byte("GET")},
+						{Key: ":path", RawValue: []byte("/")},
+						{Key: ":authority", RawValue: []byte("billing")},
+						{Key: "authorization", RawValue: []byte("Bearer " + idp.Issue(tt.name, "agent"))},
+						{Key: gatewayAudienceHeader, RawValue: []byte("gateway-target")},
+						{Key: gatewayScopesHeader, RawValue: []byte("openid billing")},
+					},
+				}}},
+			}}}
+			_ = (&processor{}).Process(stream)
+			if len(stream.responses) != 1 {
+				t.Fatalf("got %d responses, want 1", len(stream.responses))
+			}
+			mutation := stream.responses[0].GetRequestHeaders().GetResponse().GetHeaderMutation()
+			var exchanged string
+			for _, header := range mutation.GetSetHeaders() {
+				if header.GetHeader().GetKey() == "authorization" {
+					exchanged = string(header.GetHeader().GetRawValue())
+				}
+			}
+			if exchanged == "" {
+				t.Fatalf("token not exchanged: %v", stream.responses[0])
+			}
+			claims := tokenClaims(exchanged[len("Bearer "):])
+			if aud := claims["aud"]; aud != tt.wantAudience && !slices.Contains(toStrings(aud), tt.wantAudience) {
+				t.Errorf("exchanged token audience = %v, want %s", aud, tt.wantAudience)
+			}
+			if scope := claims["scope"]; scope != tt.wantScopes {
+				t.Errorf("exchanged token scope = %v, want %s", scope, tt.wantScopes)
+			}
+			if removed := mutation.GetRemoveHeaders(); !slices.Contains(removed, gatewayAudienceHeader) || !slices.Contains(removed, gatewayScopesHeader) {
+				t.Errorf("RemoveHeaders = %v, want the gateway headers", removed)
+			}
+		})
+	}
+}
+
+// toStrings returns the strings of a JSON array claim
+func toStrings(claim any) []string {
+	values, _ := claim.([]any)
+	var strs []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	return strs
+}
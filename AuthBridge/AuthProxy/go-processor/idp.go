@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"golang.org/x/net/http2"
+)
+
+// idpClient talks to the IdP: the token exchange, the client credentials grant of identity
+// chaining and the JWKS of subject token validation. It honors HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY.
+var idpClient = &http.Client{Transport: newIdPTransport()}
+
+// loadIdPClient reads IDP_HTTP2, which offers only HTTP/2 to TLS endpoints of the IdP
+// instead of negotiating HTTP/1.1 too
+func loadIdPClient() error {
+	forceHTTP2 := false
+	if value := os.Getenv("IDP_HTTP2"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid IDP_HTTP2 %q: %w", value, err)
+		}
+		forceHTTP2 = parsed
+	}
+	transport := newIdPTransport()
+	if forceHTTP2 {
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return fmt.Errorf("failed to configure HTTP/2: %w", err)
+		}
+		transport.TLSClientConfig.NextProtos = []string{http2.NextProtoTLS}
+	}
+	log.Printf("[IdP Client] HTTPS proxy: %v, HTTP proxy: %v, HTTP/2 forced: %v",
+		os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "",
+		os.Getenv("HTTP_PROXY") != "" || os.Getenv("http_proxy") != "", forceHTTP2)
+	idpClient = &http.Client{Transport: transport}
+	return nil
+}
+
+// newIdPTransport copies the default transport, which takes the proxy from the environment,
+// and presents the client certificate of the mTLS authentication methods
+func newIdPTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if clientCertificate != nil {
+		transport.TLSClientConfig = &tls.Config{GetClientCertificate: clientCertificate.GetClientCertificate}
+	}
+	return transport
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+	"github.com/huang195/auth-proxy/pkg/extprocload"
+)
+
+// benchmarkStreams is the number of concurrent ext_proc streams, as from a busy sidecar
+const benchmarkStreams = 32
+
+// BenchmarkProcessTokenExchange measures requests whose token is exchanged at the
+// in-memory IdP. Allocations include the load generator and the IdP, so compare them
+// between revisions rather than reading them as the processor's alone.
+func BenchmarkProcessTokenExchange(b *testing.B) {
+	idp := exchangetest.NewIdP()
+	defer idp.Close()
+	secret := exchangetest.RandomSecret()
+	idp.AddClient("benchmark", secret)
+	idp.AddAudience("auth-target")
+	b.Setenv("TOKEN_URL", idp.TokenURL())
+	b.Setenv("CLIENT_ID", "benchmark")
+	b.Setenv("CLIENT_SECRET", secret)
+	b.Setenv("TARGET_AUDIENCE", "auth-target")
+	b.Setenv("TARGET_SCOPES", "openid")
+
+	token := idp.Issue("alice", "benchmark")
+	runBenchmark(b, func() string { return token })
+}
+
+// BenchmarkProcessPassthrough measures requests without a token, the processor's own cost
+func BenchmarkProcessPassthrough(b *testing.B) {
+	runBenchmark(b, nil)
+}
+
+func runBenchmark(b *testing.B, token func() string) {
+	previous := log.Writer()
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(previous) })
+	b.Setenv("CLIENT_ID_FILE", "/nonexistent")
+	b.Setenv("CLIENT_SECRET_FILE", "/nonexistent")
+	loadConfig()
+
+	client := startProcessor(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	result, err := extprocload.Run(context.Background(), extprocload.Config{
+		Client:   client,
+		Streams:  benchmarkStreams,
+		Requests: b.N,
+		Token:    token,
+	})
+	b.StopTimer()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if result.Errors > 0 {
+		b.Fatalf("%d of %d requests failed", result.Errors, result.Requests)
+	}
+	b.ReportMetric(float64(result.P50.Microseconds()), "p50-µs")
+	b.ReportMetric(float64(result.P99.Microseconds()), "p99-µs")
+}
+
+// startProcessor serves the processor on an in-memory listener
+func startProcessor(b *testing.B) v3.ExternalProcessorClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	v3.RegisterExternalProcessorServer(server, &processor{})
+	go func() { _ = server.Serve(listener) }()
+	b.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { conn.Close() })
+	return v3.NewExternalProcessorClient(conn)
+}
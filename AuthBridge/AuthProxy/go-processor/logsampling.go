@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+var logLinesSampledOut = newCounter("authbridge_log_lines_sampled_out_total",
+	"Routine per-request log lines dropped by LOG_SAMPLE_RATE")
+
+// logSampler picks the requests whose routine lines are logged: one in rate
+type logSampler struct {
+	rate     uint64
+	requests atomic.Uint64
+}
+
+var requestLogs = &logSampler{rate: 1}
+
+// loadLogSampling reads LOG_SAMPLE_RATE
+func loadLogSampling() error {
+	sampler := &logSampler{rate: 1}
+	if value := os.Getenv("LOG_SAMPLE_RATE"); value != "" {
+		rate, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || rate == 0 {
+			return fmt.Errorf("invalid LOG_SAMPLE_RATE %q: must be a positive integer", value)
+		}
+		sampler.rate = rate
+	}
+	if sampler.rate > 1 {
+		log.Printf("[Logging] Logging the routine lines of 1 in %d requests, failures of all", sampler.rate)
+	}
+	requestLogs = sampler
+	return nil
+}
+
+// next returns the log of the next request
+func (s *logSampler) next() requestLog {
+	return requestLog{sampled: s.rate == 1 || s.requests.Add(1)%s.rate == 1}
+}
+
+// requestLog logs the routine lines of one request, such as the progress of a successful
+// exchange, when the request is sampled. Failures are logged with log.Printf regardless.
+type requestLog struct {
+	sampled bool
+}
+
+func (l requestLog) Printf(format string, v ...any) {
+	if !l.sampled {
+		logLinesSampledOut.Add(1)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (l requestLog) Println(v ...any) {
+	if !l.sampled {
+		logLinesSampledOut.Add(1)
+		return
+	}
+	log.Println(v...)
+}
+
+// logHeaders dumps headers at debug level, without the credentials
+func logHeaders(title string, headers []*core.HeaderValue) {
+	if !slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	slog.Debug(title)
+	for _, header := range headers {
+		if strings.EqualFold(header.Key, "authorization") ||
+			strings.EqualFold(header.Key, "x-client-secret") ||
+			strings.EqualFold(header.Key, originalTokenHeader) {
+			continue
+		}
+		slog.Debug(fmt.Sprintf("%s: %s", header.Key, string(header.RawValue)))
+	}
+}
@@ -1,22 +1,21 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
+	"context"
+	"fmt"
 	"log"
 	"net"
-	"net/http"
-	"net/url"
 	"os"
 	"strings"
 	"sync"
-	"time"
 
 	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
 )
 
 // Configuration for token exchange
@@ -35,12 +34,6 @@ type processor struct {
 	v3.UnimplementedExternalProcessorServer
 }
 
-type tokenExchangeResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-}
-
 // readFileContent reads the content of a file, trimming whitespace
 func readFileContent(path string) (string, error) {
 	content, err := os.ReadFile(path)
@@ -100,39 +93,6 @@ func loadConfig() {
 	log.Printf("[Config]   TARGET_SCOPES: %s", globalConfig.TargetScopes)
 }
 
-// waitForCredentials waits for credential files to be available
-// This handles the case where client-registration hasn't finished yet
-func waitForCredentials(maxWait time.Duration) bool {
-	clientIDFile := os.Getenv("CLIENT_ID_FILE")
-	if clientIDFile == "" {
-		clientIDFile = "/shared/client-id.txt"
-	}
-	clientSecretFile := os.Getenv("CLIENT_SECRET_FILE")
-	if clientSecretFile == "" {
-		clientSecretFile = "/shared/client-secret.txt"
-	}
-
-	log.Printf("[Config] Waiting for credential files (max %v)...", maxWait)
-	deadline := time.Now().Add(maxWait)
-	
-	for time.Now().Before(deadline) {
-		// Check if both files exist and have content
-		clientID, err1 := readFileContent(clientIDFile)
-		clientSecret, err2 := readFileContent(clientSecretFile)
-		
-		if err1 == nil && err2 == nil && clientID != "" && clientSecret != "" {
-			log.Printf("[Config] Credential files are ready")
-			return true
-		}
-		
-		log.Printf("[Config] Credentials not ready yet, waiting...")
-		time.Sleep(2 * time.Second)
-	}
-	
-	log.Printf("[Config] Timeout waiting for credentials, will use environment variables if available")
-	return false
-}
-
 // getConfig returns the current configuration
 func getConfig() (clientID, clientSecret, tokenURL, targetAudience, targetScopes string) {
 	globalConfig.mu.RLock()
@@ -145,48 +105,55 @@ func getConfig() (clientID, clientSecret, tokenURL, targetAudience, targetScopes
 // Requires the exchanging client to be in the subject token's audience.
 // When using dynamic credentials from /shared/, this works because the token's
 // audience matches the auto-registered client's SPIFFE ID.
-func exchangeToken(clientID, clientSecret, tokenURL, subjectToken, audience, scopes string) (string, error) {
-	log.Printf("[Token Exchange] Starting token exchange")
-	log.Printf("[Token Exchange] Token URL: %s", tokenURL)
-	log.Printf("[Token Exchange] Client ID: %s", clientID)
-	log.Printf("[Token Exchange] Audience: %s", audience)
-	log.Printf("[Token Exchange] Scopes: %s", scopes)
-
-	data := url.Values{}
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
-	data.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
-	data.Set("subject_token", subjectToken)
-	data.Set("subject_token_type", "urn:ietf:params:oauth:token-type:access_token")
-	data.Set("audience", audience)
-	data.Set("scope", scopes)
-
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil {
-		log.Printf("[Token Exchange] Failed to make request: %v", err)
-		return "", err
+// A non-empty actor token names this workload as the actor (nested act claim).
+// The progress is logged to logs, failures always.
+func exchangeToken(clientID, clientSecret, tokenURL, subjectToken, audience, scopes, requestID string, actor ActorToken, logs requestLog) (string, error) {
+	logs.Printf("[Token Exchange] Starting token exchange")
+	logs.Printf("[Token Exchange] Request ID: %s", requestID)
+	logs.Printf("[Token Exchange] Token URL: %s", tokenURL)
+	logs.Printf("[Token Exchange] Client ID: %s", clientID)
+	logs.Printf("[Token Exchange] Audience: %s", audience)
+	logs.Printf("[Token Exchange] Scopes: %s", scopes)
+
+	req := exchange.Request{
+		SubjectToken: subjectToken,
+		Audience:     []string{audience},
+		Scope:        scopes,
+		RequestID:    requestID,
+		Params:       exchangeParams,
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("[Token Exchange] Failed to read response: %v", err)
-		return "", err
+	if actor.Token != "" {
+		logs.Printf("[Token Exchange] Actor token type: %s", actor.Type)
+		req.ActorToken = actor.Token
+		req.ActorTokenType = actor.Type
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("[Token Exchange] Failed with status %d: %s", resp.StatusCode, string(body))
-		return "", status.Errorf(codes.Internal, "token exchange failed: %s", string(body))
+	client := &exchange.Client{TokenURL: tokenURL, ClientID: clientID, ClientSecret: clientSecret, AuthMethod: clientAuthMethod, HTTPClient: idpClient}
+	tokenResp, err := client.Exchange(context.Background(), req)
+	if err != nil && invalidClient(err) {
+		// The IdP may have rotated the client secret: re-read the credentials and retry once
+		if id, secret, changed := recoverClientCredentials(clientID, clientSecret, requestID); changed {
+			log.Printf("[Token Exchange] Client credentials changed after invalid_client, retrying")
+			client.ClientID, client.ClientSecret = id, secret
+			tokenResp, err = client.Exchange(context.Background(), req)
+			result := recoveryRecovered
+			if err != nil {
+				result = recoveryFailed
+			}
+			auditCredentialRecovery(requestID, clientID, id, result)
+		}
+	}
+	if err != nil {
+		log.Printf("[Token Exchange] %v", err)
+		return "", fmt.Errorf("token exchange failed: %w", err)
 	}
 
-	var tokenResp tokenExchangeResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		log.Printf("[Token Exchange] Failed to parse response: %v", err)
+	logs.Printf("[Token Exchange] Successfully exchanged token")
+	checkCertificateBinding(tokenResp.AccessToken)
+	verifyCtx, cancel := context.WithTimeout(context.Background(), exchangedTokenVerifyTimeout)
+	defer cancel()
+	if err := exchangeVerifier.Verify(verifyCtx, tokenResp.AccessToken, audience); err != nil {
 		return "", err
 	}
-
-	log.Printf("[Token Exchange] Successfully exchanged token")
 	return tokenResp.AccessToken, nil
 }
 
@@ -201,6 +168,12 @@ func getHeaderValue(headers []*core.HeaderValue, key string) string {
 
 func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 	ctx := stream.Context()
+	// Scopes of the token forwarded upstream, for checking the MCP request body
+	var forwardedScopes []string
+	// A trusted gateway chooses the exchange parameters with the gateway headers
+	trustedGateway := trustedGateways.Trusted(ctx)
+	// What the request upgrades to; the exchange then only applies to the handshake
+	upgrade := upgradeNone
 	for {
 		select {
 		case <-ctx.Done():
@@ -217,27 +190,153 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 
 		switch r := req.Request.(type) {
 		case *v3.ProcessingRequest_RequestHeaders:
-			log.Println("=== Request Headers ===")
 			headers := r.RequestHeaders.Headers
-			if headers != nil {
-				for _, header := range headers.Headers {
-					// Don't log sensitive headers
-					if !strings.EqualFold(header.Key, "authorization") &&
-						!strings.EqualFold(header.Key, "x-client-secret") {
-						log.Printf("%s: %s", header.Key, string(header.RawValue))
-					}
+			logHeaders("=== Request Headers ===", headers.GetHeaders())
+			// Routine lines of this request are sampled, failures are always logged
+			logs := requestLogs.next()
+
+			attrs := requestAttributesOf(req, headers.GetHeaders())
+			if upgrade = upgradeOf(headers.GetHeaders()); upgrade != upgradeNone {
+				logs.Printf("[Upgrade] %s handshake to %s, processing the headers only", upgrade, attrs.Authority)
+			}
+
+			// Requests of a bound MCP session without a token act as the bound identity
+			sessionID := mcpSessions.SessionID(headers.GetHeaders())
+			restored := false
+			if headers != nil && getHeaderValue(headers.Headers, "authorization") == "" {
+				if token := mcpSessions.SubjectToken(sessionID); token != "" {
+					logs.Printf("[MCP Session] Restoring the identity bound to session %s", sessionID)
+					headers.Headers = append(headers.Headers, &core.HeaderValue{Key: "authorization", RawValue: []byte("Bearer " + token)})
+					restored = true
 				}
 			}
 
 			// Get configuration (from files or env vars)
 			clientID, clientSecret, tokenURL, targetAudience, targetScopes := getConfig()
 
+			// The token sent upstream: the original one unless the exchange replaces it
+			forwardedToken := getHeaderValue(headers.GetHeaders(), "authorization")
+			forwardedToken = strings.TrimPrefix(strings.TrimPrefix(forwardedToken, "Bearer "), "bearer ")
+			originalToken := forwardedToken
+
+			// Optionally reject subject tokens that fail signature, issuer or audience checks
+			if subjectValidator != nil && forwardedToken != "" {
+				if _, err := subjectValidator.Validate(ctx, forwardedToken); err != nil {
+					log.Printf("[Token Validation] Rejected subject token: %v", err)
+					resp = &v3.ProcessingResponse{
+						Response: &v3.ProcessingResponse_ImmediateResponse{
+							ImmediateResponse: invalidTokenResponse(),
+						},
+					}
+					if err := stream.Send(resp); err != nil {
+						return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+					}
+					continue
+				}
+			}
+
+			// Optionally reject a token replayed from another source address
+			if !restored {
+				if denied := replays.Check(forwardedToken, attrs.Source); denied != nil {
+					resp = &v3.ProcessingResponse{
+						Response: &v3.ProcessingResponse_ImmediateResponse{
+							ImmediateResponse: denied,
+						},
+					}
+					if err := stream.Send(resp); err != nil {
+						return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+					}
+					continue
+				}
+			}
+
+			if denied := mcpSessions.Check(sessionID, forwardedToken); denied != nil {
+				resp = &v3.ProcessingResponse{
+					Response: &v3.ProcessingResponse_ImmediateResponse{
+						ImmediateResponse: denied,
+					},
+				}
+				if err := stream.Send(resp); err != nil {
+					return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+				}
+				continue
+			}
+
+			// Exchange rules pick the behavior and the scopes by path prefix and method
+			rule := matchExchangeRule(headers.GetHeaders())
+			if rule.Scopes != "" {
+				targetScopes = rule.Scopes
+			}
+			if audience, scopes := gatewayParameters(headers.GetHeaders()); audience != "" || scopes != "" {
+				if trustedGateway {
+					logs.Printf("[Trusted Gateway] Gateway requested audience %q and scopes %q", audience, scopes)
+					if audience != "" {
+						targetAudience = audience
+					}
+					if scopes != "" {
+						targetScopes = scopes
+					}
+				} else {
+					log.Printf("[Trusted Gateway] Ignoring %s and %s from an untrusted peer", gatewayAudienceHeader, gatewayScopesHeader)
+				}
+			}
+
+			// The policy engine may deny the request or change the exchange parameters
+			skipExchange := false
+			if policyEngine != nil {
+				decision := policyEngine.Decide(buildPolicyInput(headers.GetHeaders(), forwardedToken, targetAudience, targetScopes))
+				if !decision.Allow {
+					log.Printf("[Policy] %s denied the request: %s", policyEngine.Name(), decision.Reason)
+					resp = &v3.ProcessingResponse{
+						Response: &v3.ProcessingResponse_ImmediateResponse{
+							ImmediateResponse: policyDeniedResponse(decision),
+						},
+					}
+					if err := stream.Send(resp); err != nil {
+						return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+					}
+					continue
+				}
+				if decision.Audience != "" {
+					targetAudience = decision.Audience
+				}
+				if decision.Scopes != "" {
+					targetScopes = decision.Scopes
+				}
+				skipExchange = decision.SkipExchange
+			}
+			if rule.Action == exchangeActionSkip {
+				skipExchange = true
+			}
+
+			// Until the client credentials arrive, the failure policy may deny the request
+			if !skipExchange {
+				if denied := credentialsPendingResponse(clientID, clientSecret); denied != nil {
+					resp = &v3.ProcessingResponse{
+						Response: &v3.ProcessingResponse_ImmediateResponse{
+							ImmediateResponse: denied,
+						},
+					}
+					if err := stream.Send(resp); err != nil {
+						return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+					}
+					continue
+				}
+			}
+
 			// Check if we have all required config
-			if clientID != "" && clientSecret != "" && tokenURL != "" && targetAudience != "" && targetScopes != "" {
-				log.Println("[Token Exchange] Configuration loaded, attempting token exchange")
-				log.Printf("[Token Exchange] Client ID: %s", clientID)
-				log.Printf("[Token Exchange] Target Audience: %s", targetAudience)
-				log.Printf("[Token Exchange] Target Scopes: %s", targetScopes)
+			if skipExchange {
+				logs.Println("[Policy] Policy or exchange rule skips the token exchange")
+				resp = &v3.ProcessingResponse{
+					Response: &v3.ProcessingResponse_RequestHeaders{
+						RequestHeaders: &v3.HeadersResponse{},
+					},
+				}
+			} else if clientAuthenticated(clientID, clientSecret) && tokenURL != "" && targetAudience != "" && targetScopes != "" {
+				logs.Println("[Token Exchange] Configuration loaded, attempting token exchange")
+				logs.Printf("[Token Exchange] Client ID: %s", clientID)
+				logs.Printf("[Token Exchange] Target Audience: %s", targetAudience)
+				logs.Printf("[Token Exchange] Target Scopes: %s", targetScopes)
 
 				// Extract current JWT from Authorization header
 				authHeader := getHeaderValue(headers.Headers, "authorization")
@@ -247,29 +346,66 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 					subjectToken = strings.TrimPrefix(subjectToken, "bearer ")
 
 					if subjectToken != authHeader {
-						// Perform token exchange
-						newToken, err := exchangeToken(clientID, clientSecret, tokenURL, subjectToken, targetAudience, targetScopes)
+						requestID := getHeaderValue(headers.Headers, requestIDHeader)
+
+						// Reuse the token exchanged earlier in the same MCP session
+						newToken := mcpSessions.ExchangedToken(sessionID, subjectToken, targetAudience, targetScopes)
+						result := exchangeResultReused
+						var err error
+						if newToken == "" {
+							result = exchangeResultExchanged
+							// Name this workload as the actor, unless the chain is already too long
+							var actor ActorToken
+							var denial *v3.ImmediateResponse
+							actor, denial, err = identityChain.Prepare(subjectToken, clientID, clientSecret, tokenURL)
+							if denial != nil {
+								resp = &v3.ProcessingResponse{
+									Response: &v3.ProcessingResponse_ImmediateResponse{
+										ImmediateResponse: denial,
+									},
+								}
+								if err := stream.Send(resp); err != nil {
+									return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+								}
+								continue
+							}
+
+							// Perform token exchange
+							if err == nil {
+								newToken, err = exchangeToken(clientID, clientSecret, tokenURL, subjectToken, targetAudience, targetScopes, requestID, actor, logs)
+							}
+							if err == nil {
+								mcpSessions.Bind(sessionID, subjectToken, newToken, targetAudience, targetScopes)
+								rememberExchanged(subjectToken, targetAudience, targetScopes, newToken)
+							} else if stale := staleToken(exchangedTokens, err, subjectToken, targetAudience, targetScopes, staleExchangePrimary); stale != "" {
+								// The token endpoint is down: serve the token exchanged before
+								newToken, err, result = stale, nil, exchangeResultStale
+							}
+						}
+						if err != nil {
+							result = exchangeResultFailed
+						}
+						auditExchange(attrs, requestID, subjectToken, newToken, targetAudience, result)
 						if err == nil {
-							log.Printf("[Token Exchange] Successfully exchanged token, replacing Authorization header")
-							// Create header mutation to replace the Authorization header
+							logs.Printf("[Token Exchange] Successfully exchanged token, attaching it for audience %s", targetAudience)
+							forwardedToken = newToken
+							// Attach the exchanged token where the target audience expects it
 							resp = &v3.ProcessingResponse{
 								Response: &v3.ProcessingResponse_RequestHeaders{
 									RequestHeaders: &v3.HeadersResponse{
 										Response: &v3.CommonResponse{
-											HeaderMutation: &v3.HeaderMutation{
-												SetHeaders: []*core.HeaderValueOption{
-													{
-														Header: &core.HeaderValue{
-															Key:      "authorization",
-															RawValue: []byte("Bearer " + newToken),
-														},
-													},
-												},
-											},
+											HeaderMutation: tokenMutation(targetAudience, newToken, headers.Headers),
 										},
 									},
 								},
 							}
+						} else if denial := exchangedTokenResponse(err); denial != nil {
+							// The IdP issued a token upstream would reject: say so instead of forwarding it
+							resp = &v3.ProcessingResponse{
+								Response: &v3.ProcessingResponse_ImmediateResponse{
+									ImmediateResponse: denial,
+								},
+							}
 						} else {
 							log.Printf("[Token Exchange] Failed to exchange token: %v", err)
 							resp = &v3.ProcessingResponse{
@@ -287,7 +423,7 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 						}
 					}
 				} else {
-					log.Printf("[Token Exchange] No Authorization header found")
+					logs.Printf("[Token Exchange] No Authorization header found")
 					resp = &v3.ProcessingResponse{
 						Response: &v3.ProcessingResponse_RequestHeaders{
 							RequestHeaders: &v3.HeadersResponse{},
@@ -307,20 +443,81 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 				}
 			}
 
-		case *v3.ProcessingRequest_ResponseHeaders:
-			log.Println("=== Response Headers ===")
-			headers := r.ResponseHeaders.Headers
-			if headers != nil {
-				for _, header := range headers.Headers {
-					log.Printf("%s: %s", header.Key, string(header.RawValue))
+			// Require rules deny requests that would reach upstream with the caller's token
+			if rule.Action == exchangeActionRequire && (forwardedToken == "" || forwardedToken == originalToken) {
+				log.Printf("[Exchange Rules] Denied a request whose token was not exchanged")
+				resp = &v3.ProcessingResponse{
+					Response: &v3.ProcessingResponse_ImmediateResponse{
+						ImmediateResponse: policyDeniedResponse(exchangeRequiredDecision(forwardedToken != "")),
+					},
+				}
+				if err := stream.Send(resp); err != nil {
+					return status.Errorf(codes.Unknown, "cannot send stream response: %v", err)
+				}
+				continue
+			}
+
+			// A restored token reaches upstream even when it is not exchanged
+			if rh, ok := resp.Response.(*v3.ProcessingResponse_RequestHeaders); ok && restored && rh.RequestHeaders.GetResponse() == nil {
+				rh.RequestHeaders.Response = &v3.CommonResponse{
+					HeaderMutation: &v3.HeaderMutation{
+						SetHeaders: []*core.HeaderValueOption{
+							{Header: &core.HeaderValue{Key: "authorization", RawValue: []byte("Bearer " + forwardedToken)}},
+						},
+					},
 				}
 			}
+			forwardOriginalToken(resp, headers.GetHeaders(), originalToken, forwardedToken)
+			stripGatewayHeaders(resp, headers.GetHeaders())
+
+			// Tokens for the fan-out audiences go in their own headers
+			if rh, ok := resp.Response.(*v3.ProcessingResponse_RequestHeaders); ok && len(fanoutExchanges) > 0 {
+				if !skipExchange && originalToken != "" && clientAuthenticated(clientID, clientSecret) && tokenURL != "" {
+					fanoutMutation(headerMutation(rh.RequestHeaders), originalToken, clientID, clientSecret, tokenURL,
+						getHeaderValue(headers.GetHeaders(), requestIDHeader), logs)
+				} else {
+					fanoutHeaders(headerMutation(rh.RequestHeaders), headers.GetHeaders())
+				}
+			}
+			mcpSessions.Forget(sessionID, headers.GetHeaders())
+
+			// Buffer MCP requests so tools/call can be checked against the token's scopes
+			if upgrade == upgradeNone && toolAuthz.Inspects(headers.GetHeaders()) {
+				forwardedScopes = tokenScopes(forwardedToken)
+				resp.ModeOverride = bufferRequestBody()
+			}
+			// Frames and tunnelled bytes after the handshake are none of the processor's business
+			if upgrade != upgradeNone {
+				resp.ModeOverride = handshakeOnly()
+			}
+
+		case *v3.ProcessingRequest_RequestBody:
+			resp = &v3.ProcessingResponse{
+				Response: &v3.ProcessingResponse_RequestBody{
+					RequestBody: &v3.BodyResponse{},
+				},
+			}
+			if toolAuthz.Enabled() && upgrade == upgradeNone {
+				if denied := toolAuthz.Check(r.RequestBody.Body, forwardedScopes); denied != nil {
+					resp = &v3.ProcessingResponse{
+						Response: &v3.ProcessingResponse_ImmediateResponse{
+							ImmediateResponse: denied,
+						},
+					}
+				}
+			}
+
+		case *v3.ProcessingRequest_ResponseHeaders:
+			logHeaders("=== Response Headers ===", r.ResponseHeaders.Headers.GetHeaders())
 			resp = &v3.ProcessingResponse{
 				Response: &v3.ProcessingResponse_ResponseHeaders{
 					ResponseHeaders: &v3.HeadersResponse{},
 				},
 			}
 
+		case *v3.ProcessingRequest_ResponseBody, *v3.ProcessingRequest_RequestTrailers, *v3.ProcessingRequest_ResponseTrailers:
+			resp = passThrough(req)
+
 		default:
 			log.Printf("Unknown request type: %T\n", r)
 		}
@@ -332,14 +529,135 @@ func (p *processor) Process(stream v3.ExternalProcessor_ProcessServer) error {
 }
 
 func main() {
+	if err := setupLogging("go-processor"); err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
 	log.Println("=== Go External Processor Starting ===")
 
-	// Wait for credential files from client-registration (up to 60 seconds)
-	// This handles the startup race condition with client-registration container
-	waitForCredentials(60 * time.Second)
+	// Client authentication at the token endpoint: client secret or TLS client certificate
+	if err := loadClientAuth(); err != nil {
+		log.Fatalf("failed to load client authentication: %v", err)
+	}
+
+	// Load configuration from files (or environment variables as fallback). Credential
+	// files client-registration has not written yet are loaded in the background, so the
+	// gRPC port is bound right away; credentials from the per-workload Secret are
+	// available immediately.
+	if err := loadCredentialsWait(); err != nil {
+		log.Fatalf("failed to load credential wait settings: %v", err)
+	}
+	startCredentialsWait()
+
+	// Clock drift tolerated by token validation and the token caches
+	if err := loadClockSkew(); err != nil {
+		log.Fatalf("failed to load clock skew: %v", err)
+	}
+
+	// Proxy and HTTP/2 settings of the IdP connections
+	if err := loadIdPClient(); err != nil {
+		log.Fatalf("failed to load IdP client settings: %v", err)
+	}
+
+	// Optional OPA or Cedar policy decisions
+	if err := loadPolicyEngine(); err != nil {
+		log.Fatalf("failed to load policy engine: %v", err)
+	}
+	if policyEngine != nil {
+		log.Printf("[Policy] Using %s policy engine", policyEngine.Name())
+	}
+
+	// Optional validation of the subject tokens
+	if err := loadSubjectValidation(context.Background()); err != nil {
+		log.Fatalf("failed to load subject token validation: %v", err)
+	}
+
+	// Optional verification of the tokens the IdP returns
+	if err := loadExchangedTokenVerification(context.Background()); err != nil {
+		log.Fatalf("failed to load exchanged token verification: %v", err)
+	}
+
+	// Optional rejection of subject tokens replayed from another source address
+	if err := loadReplayDetection(); err != nil {
+		log.Fatalf("failed to load replay detection: %v", err)
+	}
+
+	// Optional additional parameters of the token exchange
+	if err := loadExchangeParams(); err != nil {
+		log.Fatalf("failed to load exchange parameters: %v", err)
+	}
+
+	// Optional sampling of the per-request log lines
+	if err := loadLogSampling(); err != nil {
+		log.Fatalf("failed to load log sampling: %v", err)
+	}
+
+	// Optional MCP tool-level authorization
+	if err := loadToolAuthz(); err != nil {
+		log.Fatalf("failed to load tool authorization: %v", err)
+	}
+
+	// Optional agent-to-agent identity chaining
+	if err := loadIdentityChain(); err != nil {
+		log.Fatalf("failed to load identity chaining: %v", err)
+	}
+
+	// Optional binding of exchanged tokens to MCP sessions
+	if err := loadSessionStore(); err != nil {
+		log.Fatalf("failed to load MCP session store: %v", err)
+	}
 
-	// Load configuration from files (or environment variables as fallback)
-	loadConfig()
+	// Optional exchange behavior by path prefix and method
+	if err := loadExchangeRules(); err != nil {
+		log.Fatalf("failed to load exchange rules: %v", err)
+	}
+
+	// Optional exchanges for additional audiences
+	if err := loadFanout(); err != nil {
+		log.Fatalf("failed to load fan-out exchanges: %v", err)
+	}
+
+	// Optional serving of cached tokens while the token endpoint is unavailable
+	if err := loadStaleIfError(); err != nil {
+		log.Fatalf("failed to load stale-if-error settings: %v", err)
+	}
+
+	// Optional per-audience placement of the exchanged token
+	if err := loadTokenPlacement(); err != nil {
+		log.Fatalf("failed to load token placement: %v", err)
+	}
+
+	// Optional forwarding of the inbound token next to the exchanged one
+	if err := loadOriginalTokenForwarding(); err != nil {
+		log.Fatalf("failed to load original token forwarding: %v", err)
+	}
+
+	// Components holding credentials re-read them when they rotate
+	if err := loadRotation(); err != nil {
+		log.Fatalf("failed to start credential rotation: %v", err)
+	}
+
+	// Optional Prometheus metrics of the processor's caches and exchanges
+	if err := loadAudit(); err != nil {
+		log.Fatalf("failed to load audit settings: %v", err)
+	}
+	if err := startMetricsServer(); err != nil {
+		log.Fatalf("failed to start metrics server: %v", err)
+	}
+
+	// Optional export of the audit events to an HTTP, Kafka REST proxy or syslog sink
+	if err := loadAuditExport(); err != nil {
+		log.Fatalf("failed to load audit export settings: %v", err)
+	}
+
+	// Optional TLS of the ext_proc server, and the gateways trusted to choose the exchange
+	// parameters per request
+	serverOpts, clientCertsVerified, err := loadExtProcTLS()
+	if err != nil {
+		log.Fatalf("failed to load ext_proc TLS settings: %v", err)
+	}
+	if err := loadTrustedGateways(clientCertsVerified); err != nil {
+		log.Fatalf("failed to load trusted gateways: %v", err)
+	}
 
 	// Start gRPC server
 	port := ":9090"
@@ -348,7 +666,7 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(serverOpts...)
 	v3.RegisterExternalProcessorServer(grpcServer, &processor{})
 
 	log.Printf("Starting Go external processor on %s", port)
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+)
+
+// Exchange rule actions
+const (
+	// exchangeActionExchange exchanges the token when possible and forwards the original
+	// one otherwise, the behavior without rules
+	exchangeActionExchange = "exchange"
+	// exchangeActionSkip forwards the original token without contacting the IdP
+	exchangeActionSkip = "skip"
+	// exchangeActionRequire denies requests whose token was not exchanged
+	exchangeActionRequire = "require"
+)
+
+// ExchangeRule selects the exchange behavior and scopes of requests by path prefix and method
+type ExchangeRule struct {
+	PathPrefix string `json:"path_prefix"`
+	// Methods the rule applies to; empty applies to all methods
+	Methods []string `json:"methods,omitempty"`
+	// Action defaults to exchange
+	Action string `json:"action,omitempty"`
+	// Scopes replace TARGET_SCOPES in the exchange request
+	Scopes string `json:"scopes,omitempty"`
+}
+
+// exchangeRules are matched in order; the first matching rule decides
+var exchangeRules []ExchangeRule
+
+// loadExchangeRules reads EXCHANGE_RULES, a JSON list of rules, or EXCHANGE_RULES_FILE
+func loadExchangeRules() error {
+	var rules []ExchangeRule
+	config := os.Getenv("EXCHANGE_RULES")
+	if file := os.Getenv("EXCHANGE_RULES_FILE"); file != "" {
+		content, err := readFileContent(file)
+		if err != nil {
+			return fmt.Errorf("failed to read EXCHANGE_RULES_FILE: %w", err)
+		}
+		config = content
+	}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &rules); err != nil {
+			return fmt.Errorf("failed to parse exchange rules: %w", err)
+		}
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			return fmt.Errorf("exchange rule %d: path_prefix %q must start with /", i, rule.PathPrefix)
+		}
+		if rule.Action == "" {
+			rule.Action = exchangeActionExchange
+		}
+		switch rule.Action {
+		case exchangeActionExchange, exchangeActionSkip, exchangeActionRequire:
+		default:
+			return fmt.Errorf("exchange rule %d: invalid action %q: must be %s, %s or %s",
+				i, rule.Action, exchangeActionExchange, exchangeActionSkip, exchangeActionRequire)
+		}
+		if rule.Scopes != "" && rule.Action == exchangeActionSkip {
+			return fmt.Errorf("exchange rule %d: scopes have no effect with action %s", i, exchangeActionSkip)
+		}
+		for j, method := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(strings.TrimSpace(method))
+		}
+	}
+	if len(rules) > 0 {
+		log.Printf("[Exchange Rules] Loaded %d rules", len(rules))
+	}
+	exchangeRules = rules
+	return nil
+}
+
+// matchExchangeRule returns the first rule matching the request, or a rule that exchanges
+// with the configured scopes
+func matchExchangeRule(headers []*core.HeaderValue) ExchangeRule {
+	method := getHeaderValue(headers, ":method")
+	path, _, _ := strings.Cut(getHeaderValue(headers, ":path"), "?")
+	for _, rule := range exchangeRules {
+		if !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if len(rule.Methods) > 0 && !slices.Contains(rule.Methods, method) {
+			continue
+		}
+		return rule
+	}
+	return ExchangeRule{Action: exchangeActionExchange}
+}
+
+// exchangeRequiredDecision denies a request a require rule covers: 401 without a token,
+// 403 when the exchange did not succeed
+func exchangeRequiredDecision(hasToken bool) PolicyDecision {
+	if !hasToken {
+		return PolicyDecision{Status: http.StatusUnauthorized, Reason: "a bearer token is required"}
+	}
+	return PolicyDecision{Status: http.StatusForbidden, Reason: "the token could not be exchanged"}
+}
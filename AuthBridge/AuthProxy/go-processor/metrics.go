@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultMaxSeries bounds the label sets of each labeled metric
+const defaultMaxSeries = 500
+
+// overflowLabel replaces every label value of a series beyond the metric's maxSeries
+const overflowLabel = "other"
+
+// collector is a metric exported in the Prometheus text format. The processor keeps to
+// the standard library, so the few metrics it has are written by hand.
+type collector interface {
+	metricName() string
+	write(w io.Writer)
+}
+
+// metric is a counter or gauge
+type metric struct {
+	name, help, kind string
+	value            atomic.Int64
+	// read, if set, computes a gauge on every scrape
+	read func() float64
+}
+
+func (m *metric) Add(delta int64) { m.value.Add(delta) }
+func (m *metric) Set(value int64) { m.value.Store(value) }
+
+func (m *metric) metricName() string { return m.name }
+
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	if m.read != nil {
+		fmt.Fprintf(w, "%s %g\n", m.name, m.read())
+	} else {
+		fmt.Fprintf(w, "%s %d\n", m.name, m.value.Load())
+	}
+}
+
+// counterVec is a counter with labels. Once it holds maxSeries label sets, new ones are
+// counted under "other", so callers cannot create series without bound.
+type counterVec struct {
+	name, help string
+	labels     []string
+	maxSeries  int
+
+	mu     sync.Mutex
+	series map[string]*atomic.Int64
+}
+
+// Inc counts one event for the label values, given in the order of the labels
+func (c *counterVec) Inc(values ...string) {
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	counter, ok := c.series[key]
+	if !ok {
+		if len(c.series) >= c.maxSeries {
+			overflow := make([]string, len(c.labels))
+			for i := range overflow {
+				overflow[i] = overflowLabel
+			}
+			key = strings.Join(overflow, "\x00")
+			counter = c.series[key]
+		}
+		if counter == nil {
+			counter = &atomic.Int64{}
+			c.series[key] = counter
+		}
+	}
+	c.mu.Unlock()
+	counter.Add(1)
+}
+
+func (c *counterVec) metricName() string { return c.name }
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		values := strings.Split(key, "\x00")
+		pairs := make([]string, len(c.labels))
+		for i, label := range c.labels {
+			pairs[i] = label + "=" + strconv.Quote(values[i])
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", c.name, strings.Join(pairs, ","), c.series[key].Load())
+	}
+	c.mu.Unlock()
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   = map[string]collector{}
+)
+
+func register(c collector) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics[c.metricName()] = c
+}
+
+func newMetric(name, kind, help string) *metric {
+	m := &metric{name: name, help: help, kind: kind}
+	register(m)
+	return m
+}
+
+func newCounter(name, help string) *metric { return newMetric(name, "counter", help) }
+func newGauge(name, help string) *metric   { return newMetric(name, "gauge", help) }
+
+// newGaugeFunc registers a gauge computed by read on every scrape
+func newGaugeFunc(name, help string, read func() float64) *metric {
+	m := newMetric(name, "gauge", help)
+	m.read = read
+	return m
+}
+
+// newCounterVec registers a counter with labels, bounded to defaultMaxSeries label sets
+// until METRICS_MAX_SERIES is loaded
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, maxSeries: defaultMaxSeries, series: map[string]*atomic.Int64{}}
+	register(c)
+	return c
+}
+
+// writeMetrics writes every metric in the Prometheus text format, sorted by name
+func writeMetrics(w io.Writer) {
+	metricsMu.Lock()
+	sorted := make([]collector, 0, len(metrics))
+	for _, c := range metrics {
+		sorted = append(sorted, c)
+	}
+	metricsMu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].metricName() < sorted[j].metricName() })
+	for _, c := range sorted {
+		c.write(w)
+	}
+}
+
+// startMetricsServer serves /metrics on METRICS_ADDR and bounds the labeled metrics to
+// METRICS_MAX_SERIES label sets each; without METRICS_ADDR it serves none, the address
+// would otherwise take a port in the workload's network namespace
+func startMetricsServer() error {
+	if value := os.Getenv("METRICS_MAX_SERIES"); value != "" {
+		maxSeries, err := strconv.Atoi(value)
+		if err != nil || maxSeries <= 0 {
+			return fmt.Errorf("invalid METRICS_MAX_SERIES %q: must be a positive integer", value)
+		}
+		metricsMu.Lock()
+		for _, c := range metrics {
+			if vec, ok := c.(*counterVec); ok {
+				vec.mu.Lock()
+				vec.maxSeries = maxSeries
+				vec.mu.Unlock()
+			}
+		}
+		metricsMu.Unlock()
+	}
+
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	go func() {
+		log.Printf("[Metrics] Serving /metrics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("[Metrics] Metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+const (
+	defaultClientCertFile = "/opt/svid.pem"
+	defaultClientKeyFile  = "/opt/svid_key.pem"
+)
+
+// clientAuthMethod is how the processor authenticates at the token endpoint
+var clientAuthMethod = exchange.ClientSecretPost
+
+// clientCertificate is the TLS client certificate of the mTLS methods, nil otherwise
+var clientCertificate *certificateFiles
+
+// certificateFiles loads a certificate and key from PEM files and reloads them when the
+// certificate file changes, as spiffe-helper rotates the X.509 SVID. It serves the client
+// certificate at the token endpoint and the ext_proc server certificate.
+type certificateFiles struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// loadClientAuth reads CLIENT_AUTH_METHOD and, for tls_client_auth and
+// self_signed_tls_client_auth, CLIENT_CERT_FILE and CLIENT_KEY_FILE
+func loadClientAuth() error {
+	method := strings.TrimSpace(os.Getenv("CLIENT_AUTH_METHOD"))
+	switch method {
+	case "", exchange.ClientSecretPost:
+		clientAuthMethod, clientCertificate = exchange.ClientSecretPost, nil
+		return nil
+	case exchange.TLSClientAuth, exchange.SelfSignedTLSClientAuth:
+	default:
+		return fmt.Errorf("invalid CLIENT_AUTH_METHOD %q: must be %s, %s or %s",
+			method, exchange.ClientSecretPost, exchange.TLSClientAuth, exchange.SelfSignedTLSClientAuth)
+	}
+	files := &certificateFiles{
+		certFile: credentialFile("CLIENT_CERT_FILE", defaultClientCertFile),
+		keyFile:  credentialFile("CLIENT_KEY_FILE", defaultClientKeyFile),
+	}
+	// spiffe-helper may not have written the SVID yet; the handshake loads it
+	if _, err := files.get(); err != nil {
+		log.Printf("[mTLS] Client certificate not loaded yet: %v", err)
+	}
+	log.Printf("[mTLS] Authenticating at the token endpoint with %s, certificate %s", method, files.certFile)
+	clientAuthMethod, clientCertificate = method, files
+	return nil
+}
+
+// clientAuthenticated reports whether the processor has what its authentication method
+// needs: a client ID and, unless it authenticates with a certificate, a client secret
+func clientAuthenticated(clientID, clientSecret string) bool {
+	return clientID != "" && (clientSecret != "" || exchange.MutualTLS(clientAuthMethod))
+}
+
+// GetClientCertificate serves tls.Config.GetClientCertificate
+func (f *certificateFiles) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return f.get()
+}
+
+// get returns the certificate, reloading it when the file changed
+func (f *certificateFiles) get() (*tls.Certificate, error) {
+	info, err := os.Stat(f.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cert != nil && info.ModTime().Equal(f.modified) {
+		return f.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate %s: %w", f.certFile, err)
+	}
+	log.Printf("[mTLS] Loaded certificate %s, expires %s", f.certFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	f.cert, f.modified = &cert, info.ModTime()
+	return f.cert, nil
+}
+
+// checkCertificateBinding warns when the IdP bound a token to a certificate other than the
+// client certificate; upstream services verifying the binding would reject it
+func checkCertificateBinding(token string) {
+	cnf, _ := tokenClaims(token)["cnf"].(map[string]any)
+	bound, _ := cnf[exchange.ThumbprintClaim].(string)
+	if bound == "" || clientCertificate == nil {
+		return
+	}
+	cert, err := clientCertificate.get()
+	if err != nil {
+		return
+	}
+	if thumbprint := exchange.Thumbprint(cert.Leaf); bound != thumbprint {
+		log.Printf("[mTLS] Issued token is bound to certificate %s, the client certificate is %s", bound, thumbprint)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+)
+
+// writeCertificate writes a new self-signed certificate and its key to PEM files in dir,
+// with the certificate file modified at modified
+func writeCertificate(t *testing.T, dir, commonName string, modified time.Time) (certFile, keyFile string) {
+	t.Helper()
+	cert, err := exchangetest.NewCertificate(commonName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertificateFilesReload(t *testing.T) {
+	discardLogs(t)
+	dir := t.TempDir()
+	modified := time.Now().Add(-time.Hour)
+	certFile, keyFile := writeCertificate(t, dir, "first", modified)
+	files := &certificateFiles{certFile: certFile, keyFile: keyFile}
+
+	first, err := files.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := files.get(); again != first {
+		t.Error("unchanged certificate was loaded again")
+	}
+
+	// spiffe-helper rotated the SVID
+	writeCertificate(t, dir, "second", modified.Add(time.Minute))
+	rotated, err := files.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Leaf.Subject.CommonName != "second" {
+		t.Errorf("certificate after rotation = %s, want second", rotated.Leaf.Subject.CommonName)
+	}
+
+	// files that cannot be loaded are reported, not served
+	other := &certificateFiles{certFile: certFile, keyFile: filepath.Join(dir, "missing.pem")}
+	if _, err := other.get(); err == nil || !strings.Contains(err.Error(), "failed to load certificate") {
+		t.Errorf("get() with a missing key = %v", err)
+	}
+	missing := &certificateFiles{certFile: filepath.Join(dir, "missing.pem"), keyFile: keyFile}
+	if _, err := missing.get(); err == nil || !strings.Contains(err.Error(), "failed to read certificate") {
+		t.Errorf("get() with a missing certificate = %v", err)
+	}
+}
+
+func TestLoadExtProcTLS(t *testing.T) {
+	discardLogs(t)
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "ext-proc", time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	ca, _ := os.ReadFile(certFile)
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "not-pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, cert, key, ca string
+		wantOpts            bool
+		wantVerified        bool
+		// err is a substring of the expected error, empty for valid settings
+		err string
+	}{
+		{name: "plaintext"},
+		{name: "TLS", cert: certFile, key: keyFile, wantOpts: true},
+		{name: "TLS verifying client certificates", cert: certFile, key: keyFile, ca: caFile, wantOpts: true, wantVerified: true},
+		{name: "certificate without key", cert: certFile, err: "must be set together"},
+		{name: "client CA without certificate", ca: caFile, err: "needs EXTPROC_TLS_CERT_FILE"},
+		{name: "missing certificate", cert: filepath.Join(dir, "missing.pem"), key: keyFile, err: "failed to read certificate"},
+		{name: "missing client CA", cert: certFile, key: keyFile, ca: filepath.Join(dir, "missing.pem"), err: "EXTPROC_TLS_CLIENT_CA_FILE"},
+		{name: "client CA without certificates", cert: certFile, key: keyFile, ca: notPEM, err: "no PEM certificates"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EXTPROC_TLS_CERT_FILE", tt.cert)
+			t.Setenv("EXTPROC_TLS_KEY_FILE", tt.key)
+			t.Setenv("EXTPROC_TLS_CLIENT_CA_FILE", tt.ca)
+			opts, verified, err := loadExtProcTLS()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("loadExtProcTLS() = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (len(opts) > 0) != tt.wantOpts || verified != tt.wantVerified {
+				t.Errorf("loadExtProcTLS() = %d options, verified %v, want options %v, verified %v",
+					len(opts), verified, tt.wantOpts, tt.wantVerified)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// requestIDHeader is set by Envoy on every request; it is logged and forwarded to the token
+// endpoint so that an exchange can be traced back to the proxied request
+const requestIDHeader = "x-request-id"
+
+// setupLogging routes the log package through slog with the service attribute, as text or
+// JSON (LOG_FORMAT) at LOG_LEVEL, the settings of the kagenti-webhook binaries
+func setupLogging(service string) error {
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", value)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", format)
+	}
+	slog.SetDefault(slog.New(handler).With("service", service))
+	// slog handlers add their own timestamp
+	log.SetFlags(0)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// OPAClient asks an OPA server (usually a sidecar) for a decision on each request.
+// OPA loads the Rego policies from a watched ConfigMap directory or a bundle service.
+type OPAClient struct {
+	// URL is the decision endpoint, e.g. http://127.0.0.1:8181/v1/data/authbridge/decision
+	URL string
+	// FailOpen allows requests when OPA is unreachable or returns an error
+	FailOpen   bool
+	HTTPClient *http.Client
+}
+
+// Name identifies the engine in logs
+func (c *OPAClient) Name() string {
+	return "OPA"
+}
+
+// Decide queries the policy with the input document. A boolean result is read as allow;
+// an object result is a PolicyDecision.
+func (c *OPAClient) Decide(input PolicyInput) PolicyDecision {
+	decision, err := c.query(input)
+	if err != nil {
+		log.Printf("[OPA] Policy query failed: %v", err)
+		return failedDecision(c.FailOpen)
+	}
+	return decision
+}
+
+func (c *OPAClient) query(input PolicyInput) (PolicyDecision, error) {
+	payload, err := json.Marshal(map[string]any{"input": input})
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	resp, err := c.HTTPClient.Post(c.URL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return PolicyDecision{}, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	// an undefined result means the policy or its package is missing
+	if len(body.Result) == 0 {
+		return PolicyDecision{}, fmt.Errorf("policy result is undefined")
+	}
+	var decision PolicyDecision
+	var allow bool
+	if err := json.Unmarshal(body.Result, &allow); err == nil {
+		decision.Allow = allow
+	} else if err := json.Unmarshal(body.Result, &decision); err != nil {
+		return PolicyDecision{}, fmt.Errorf("failed to decode policy result: %w", err)
+	}
+	return decision, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOPAClientDecide(t *testing.T) {
+	discardLogs(t)
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		failOpen bool
+		want     PolicyDecision
+	}{
+		{name: "boolean allow", status: http.StatusOK, body: `{"result":true}`, want: PolicyDecision{Allow: true}},
+		{name: "boolean deny", status: http.StatusOK, body: `{"result":false}`, want: PolicyDecision{}},
+		{
+			name:   "object result",
+			status: http.StatusOK,
+			body:   `{"result":{"allow":true,"audience":"billing","scopes":"openid billing","skip_exchange":false}}`,
+			want:   PolicyDecision{Allow: true, Audience: "billing", Scopes: "openid billing"},
+		},
+		{
+			name:   "object denial",
+			status: http.StatusOK,
+			body:   `{"result":{"allow":false,"reason":"not on call","status":401}}`,
+			want:   PolicyDecision{Reason: "not on call", Status: http.StatusUnauthorized},
+		},
+		{name: "undefined result", status: http.StatusOK, body: `{}`, want: failedDecision(false)},
+		{name: "undefined result failing open", status: http.StatusOK, body: `{}`, failOpen: true, want: failedDecision(true)},
+		{name: "result of another type", status: http.StatusOK, body: `{"result":"yes"}`, want: failedDecision(false)},
+		{name: "invalid JSON", status: http.StatusOK, body: `not json`, want: failedDecision(false)},
+		{name: "server error", status: http.StatusInternalServerError, body: `{"result":true}`, want: failedDecision(false)},
+		{name: "server error failing open", status: http.StatusInternalServerError, failOpen: true, want: failedDecision(true)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received struct {
+				Input PolicyInput `json:"input"`
+			}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+					t.Errorf("invalid query: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := &OPAClient{URL: server.URL, FailOpen: tt.failOpen, HTTPClient: server.Client()}
+			input := PolicyInput{
+				Attributes: RequestAttributes{Method: "GET", Host: "billing"},
+				Token:      map[string]any{"sub": "alice"},
+			}
+			if got := client.Decide(input); got != tt.want {
+				t.Errorf("Decide() = %+v, want %+v", got, tt.want)
+			}
+			if received.Input.Attributes.Host != "billing" || received.Input.Token["sub"] != "alice" {
+				t.Errorf("OPA received input %+v", received.Input)
+			}
+		})
+	}
+}
+
+func TestOPAClientUnreachable(t *testing.T) {
+	discardLogs(t)
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	for _, failOpen := range []bool{false, true} {
+		client := &OPAClient{URL: url, FailOpen: failOpen, HTTPClient: http.DefaultClient}
+		if got := client.Decide(PolicyInput{}); got != failedDecision(failOpen) {
+			t.Errorf("Decide() with FailOpen %v = %+v, want %+v", failOpen, got, failedDecision(failOpen))
+		}
+	}
+}
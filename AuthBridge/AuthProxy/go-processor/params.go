@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+)
+
+// reservedExchangeParams are the form parameters of the exchange itself
+var reservedExchangeParams = []string{
+	"grant_type", "client_id", "client_secret", "subject_token", "subject_token_type",
+	"actor_token", "actor_token_type", "requested_token_type", "audience", "resource", "scope",
+}
+
+// exchangeParams are sent with every token exchange, e.g. to have the IdP add deployment
+// metadata as claims for downstream policy engines
+var exchangeParams map[string]string
+
+// loadExchangeParams reads EXCHANGE_PARAMS, a JSON object of form parameters, or
+// EXCHANGE_PARAMS_FILE. ${VAR} in a value is replaced by the environment variable VAR.
+func loadExchangeParams() error {
+	params := map[string]string{}
+	config := os.Getenv("EXCHANGE_PARAMS")
+	if file := os.Getenv("EXCHANGE_PARAMS_FILE"); file != "" {
+		content, err := readFileContent(file)
+		if err != nil {
+			return fmt.Errorf("failed to read EXCHANGE_PARAMS_FILE: %w", err)
+		}
+		config = content
+	}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &params); err != nil {
+			return fmt.Errorf("failed to parse exchange parameters: %w", err)
+		}
+	}
+	names := make([]string, 0, len(params))
+	for name, value := range params {
+		if name == "" || slices.Contains(reservedExchangeParams, name) {
+			return fmt.Errorf("exchange parameter %q cannot be configured", name)
+		}
+		var missing []string
+		params[name] = os.Expand(value, func(variable string) string {
+			expanded, ok := os.LookupEnv(variable)
+			if !ok {
+				missing = append(missing, variable)
+			}
+			return expanded
+		})
+		if len(missing) > 0 {
+			return fmt.Errorf("exchange parameter %q: environment variables %v are not set", name, missing)
+		}
+		names = append(names, name)
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		log.Printf("[Token Exchange] Sending additional parameters: %v", names)
+	}
+	exchangeParams = params
+	return nil
+}
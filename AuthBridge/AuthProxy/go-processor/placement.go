@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// TokenPlacement says where the exchanged token is attached to the upstream request:
+// a header with an optional prefix, a cookie or a query parameter. Exactly one of Header,
+// Cookie and Query is set.
+type TokenPlacement struct {
+	Header string `json:"header,omitempty"`
+	// Prefix precedes the token in Header; it defaults to "Bearer " for authorization and
+	// to none for other headers
+	Prefix *string `json:"prefix,omitempty"`
+	Cookie string  `json:"cookie,omitempty"`
+	Query  string  `json:"query,omitempty"`
+}
+
+// defaultPlacement is the Bearer Authorization header
+var defaultPlacement = TokenPlacement{Header: "authorization"}
+
+// tokenPlacements maps a target audience to its placement; "*" applies to the others
+var tokenPlacements = map[string]TokenPlacement{}
+
+// loadTokenPlacement reads TOKEN_PLACEMENT, a JSON object mapping audiences to
+// placements, or TOKEN_PLACEMENT_FILE
+func loadTokenPlacement() error {
+	placements := map[string]TokenPlacement{}
+	config := os.Getenv("TOKEN_PLACEMENT")
+	if file := os.Getenv("TOKEN_PLACEMENT_FILE"); file != "" {
+		content, err := readFileContent(file)
+		if err != nil {
+			return fmt.Errorf("failed to read TOKEN_PLACEMENT_FILE: %w", err)
+		}
+		config = content
+	}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &placements); err != nil {
+			return fmt.Errorf("failed to parse token placement: %w", err)
+		}
+	}
+	for audience, placement := range placements {
+		placement.Header = strings.ToLower(strings.TrimSpace(placement.Header))
+		if err := placement.validate(); err != nil {
+			return fmt.Errorf("invalid token placement for audience %q: %w", audience, err)
+		}
+		placements[audience] = placement
+	}
+	if len(placements) > 0 {
+		log.Printf("[Token Placement] Custom placement for %d audiences", len(placements))
+	}
+	tokenPlacements = placements
+	return nil
+}
+
+func (p TokenPlacement) validate() error {
+	set := 0
+	for _, value := range []string{p.Header, p.Cookie, p.Query} {
+		if value != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of header, cookie and query must be set")
+	}
+	switch {
+	case p.Header != "" && (!validHeaderName(p.Header) || p.Header == "host"):
+		return fmt.Errorf("header %q is not a header name Envoy lets the ext_proc set", p.Header)
+	case p.Cookie != "" && !validHeaderName(strings.ToLower(p.Cookie)):
+		return fmt.Errorf("cookie %q is not a cookie name", p.Cookie)
+	case p.Query != "" && url.QueryEscape(p.Query) != p.Query:
+		return fmt.Errorf("query parameter %q needs escaping", p.Query)
+	case p.Prefix != nil && p.Header == "":
+		return fmt.Errorf("prefix applies to headers only")
+	case p.Prefix != nil && strings.ContainsAny(*p.Prefix, "\r\n"):
+		return fmt.Errorf("prefix must not contain line breaks")
+	}
+	return nil
+}
+
+// placementFor returns the placement of tokens exchanged for audience
+func placementFor(audience string) TokenPlacement {
+	if placement, ok := tokenPlacements[audience]; ok {
+		return placement
+	}
+	if placement, ok := tokenPlacements["*"]; ok {
+		return placement
+	}
+	return defaultPlacement
+}
+
+// tokenMutation attaches token to the request as the placement of audience says. A
+// placement outside Authorization removes the inbound Authorization header, so the
+// caller's token does not reach upstream with the exchanged one.
+func tokenMutation(audience, token string, headers []*core.HeaderValue) *v3.HeaderMutation {
+	placement := placementFor(audience)
+	mutation := &v3.HeaderMutation{}
+	if placement.Header != "authorization" {
+		mutation.RemoveHeaders = append(mutation.RemoveHeaders, "authorization")
+	}
+	switch {
+	case placement.Cookie != "":
+		mutation.SetHeaders = append(mutation.SetHeaders, overwrite("cookie",
+			withCookie(getHeaderValue(headers, "cookie"), placement.Cookie, token)))
+	case placement.Query != "":
+		mutation.SetHeaders = append(mutation.SetHeaders, overwrite(":path",
+			withQueryParam(getHeaderValue(headers, ":path"), placement.Query, token)))
+	default:
+		prefix := ""
+		if placement.Prefix != nil {
+			prefix = *placement.Prefix
+		} else if placement.Header == "authorization" {
+			prefix = "Bearer "
+		}
+		mutation.SetHeaders = append(mutation.SetHeaders, overwrite(placement.Header, prefix+token))
+	}
+	return mutation
+}
+
+func overwrite(key, value string) *core.HeaderValueOption {
+	return &core.HeaderValueOption{
+		Header:       &core.HeaderValue{Key: key, RawValue: []byte(value)},
+		AppendAction: core.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
+
+// withCookie replaces or adds the cookie name in a Cookie header value
+func withCookie(header, name, value string) string {
+	cookies := []string{name + "=" + value}
+	for _, cookie := range strings.Split(header, ";") {
+		cookie = strings.TrimSpace(cookie)
+		if cookie == "" || strings.HasPrefix(cookie, name+"=") {
+			continue
+		}
+		cookies = append(cookies, cookie)
+	}
+	return strings.Join(cookies, "; ")
+}
+
+// withQueryParam replaces or adds the query parameter name in a request path
+func withQueryParam(path, name, value string) string {
+	path, query, _ := strings.Cut(path, "?")
+	params := []string{name + "=" + url.QueryEscape(value)}
+	for _, param := range strings.Split(query, "&") {
+		if param == "" || param == name || strings.HasPrefix(param, name+"=") {
+			continue
+		}
+		params = append(params, param)
+	}
+	return path + "?" + strings.Join(params, "&")
+}
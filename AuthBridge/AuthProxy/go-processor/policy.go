@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+const defaultPolicyTimeout = 2 * time.Second
+
+// PolicyEngine decides whether a request is allowed and how its token is exchanged.
+// Engines run outside the processor and load their policies themselves, so policy
+// changes apply without a restart.
+type PolicyEngine interface {
+	Name() string
+	Decide(input PolicyInput) PolicyDecision
+}
+
+// PolicyInput is the document every engine evaluates
+type PolicyInput struct {
+	Attributes RequestAttributes `json:"attributes"`
+	Token      map[string]any    `json:"token"`
+	Exchange   ExchangeParams    `json:"exchange"`
+}
+
+// RequestAttributes describe the intercepted request
+type RequestAttributes struct {
+	Method  string            `json:"method"`
+	Scheme  string            `json:"scheme"`
+	Host    string            `json:"host"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+// ExchangeParams are the configured token exchange parameters
+type ExchangeParams struct {
+	Audience string `json:"audience"`
+	Scopes   string `json:"scopes"`
+}
+
+// PolicyDecision is the result of a policy evaluation
+type PolicyDecision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason,omitempty"`
+	// Status is the HTTP status of a denial, 403 by default
+	Status int `json:"status,omitempty"`
+	// Audience and Scopes override TARGET_AUDIENCE and TARGET_SCOPES for this request
+	Audience string `json:"audience,omitempty"`
+	Scopes   string `json:"scopes,omitempty"`
+	// SkipExchange forwards the original token unchanged
+	SkipExchange bool `json:"skip_exchange,omitempty"`
+}
+
+var policyEngine PolicyEngine
+
+// loadPolicyEngine configures OPA (OPA_URL) or Cedar (CEDAR_URL); without either no
+// policy is consulted. CEDAR_POLICY_FILE is pushed to CEDAR_POLICY_URL, which defaults
+// to the policies endpoint next to a CEDAR_URL ending in /is_authorized.
+func loadPolicyEngine() error {
+	opaURL, cedarURL := os.Getenv("OPA_URL"), os.Getenv("CEDAR_URL")
+	switch {
+	case opaURL != "" && cedarURL != "":
+		return fmt.Errorf("OPA_URL and CEDAR_URL are mutually exclusive")
+	case opaURL != "":
+		client, failOpen, err := policyHTTPSettings("OPA")
+		if err != nil {
+			return err
+		}
+		policyEngine = &OPAClient{URL: opaURL, FailOpen: failOpen, HTTPClient: client}
+	case cedarURL != "":
+		client, failOpen, err := policyHTTPSettings("CEDAR")
+		if err != nil {
+			return err
+		}
+		cedar := &CedarClient{URL: cedarURL, FailOpen: failOpen, HTTPClient: client}
+		if file := os.Getenv("CEDAR_POLICY_FILE"); file != "" {
+			cedar.PolicyURL = os.Getenv("CEDAR_POLICY_URL")
+			if cedar.PolicyURL == "" {
+				if cedar.PolicyURL, err = cedarPolicyURL(cedarURL); err != nil {
+					return err
+				}
+			}
+			go cedar.SyncPolicies(file, cedarPolicySyncInterval)
+		}
+		policyEngine = cedar
+	}
+	return nil
+}
+
+// policyHTTPSettings reads <prefix>_TIMEOUT and <prefix>_FAIL_OPEN
+func policyHTTPSettings(prefix string) (*http.Client, bool, error) {
+	timeout := defaultPolicyTimeout
+	if value := os.Getenv(prefix + "_TIMEOUT"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid %s_TIMEOUT %q: %w", prefix, value, err)
+		}
+		timeout = parsed
+	}
+	failOpen := false
+	if value := os.Getenv(prefix + "_FAIL_OPEN"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid %s_FAIL_OPEN %q: %w", prefix, value, err)
+		}
+		failOpen = parsed
+	}
+	return &http.Client{Timeout: timeout}, failOpen, nil
+}
+
+// failedDecision resolves an evaluation error with the engine's fail-open setting
+func failedDecision(failOpen bool) PolicyDecision {
+	return PolicyDecision{Allow: failOpen, Reason: "policy evaluation failed", Status: http.StatusServiceUnavailable}
+}
+
+// buildPolicyInput describes the request; the authorization header is replaced by the
+// token's unverified claims
+func buildPolicyInput(headers []*core.HeaderValue, token, audience, scopes string) PolicyInput {
+	input := PolicyInput{
+		Attributes: RequestAttributes{
+			Method:  getHeaderValue(headers, ":method"),
+			Scheme:  getHeaderValue(headers, ":scheme"),
+			Host:    getHeaderValue(headers, ":authority"),
+			Path:    getHeaderValue(headers, ":path"),
+			Headers: map[string]string{},
+		},
+		Token:    tokenClaims(token),
+		Exchange: ExchangeParams{Audience: audience, Scopes: scopes},
+	}
+	for _, header := range headers {
+		key := strings.ToLower(header.Key)
+		if strings.HasPrefix(key, ":") || key == "authorization" || key == "x-client-secret" {
+			continue
+		}
+		input.Attributes.Headers[key] = string(header.RawValue)
+	}
+	return input
+}
+
+// tokenClaims returns the payload of a JWT without verifying it, or an empty map
+func tokenClaims(token string) map[string]any {
+	claims := map[string]any{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims
+	}
+	_ = json.Unmarshal(payload, &claims)
+	return claims
+}
+
+func policyDeniedResponse(decision PolicyDecision) *v3.ImmediateResponse {
+	code := decision.Status
+	if code == 0 {
+		code = http.StatusForbidden
+	}
+	reason := decision.Reason
+	if reason == "" {
+		reason = "denied by policy"
+	}
+	body, _ := json.Marshal(map[string]string{"error": "forbidden", "reason": reason})
+	return &v3.ImmediateResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+		Headers: &v3.HeaderMutation{
+			SetHeaders: []*core.HeaderValueOption{
+				{Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/json")}},
+			},
+		},
+		Body:    body,
+		Details: "policy_denied",
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+// Outcomes of re-reading the client credentials after invalid_client
+const (
+	// recoveryRecovered: the credentials changed and the retried exchange succeeded
+	recoveryRecovered = "recovered"
+	// recoveryFailed: the credentials changed but the retried exchange failed too
+	recoveryFailed = "failed"
+	// recoveryUnchanged: the credentials are the same, so the exchange is not retried
+	recoveryUnchanged = "unchanged"
+)
+
+var credentialRecoveries = newCounterVec("authbridge_client_credential_recoveries_total",
+	"Client credential re-reads after the token endpoint answered invalid_client, by result",
+	"result")
+
+// credentialRecoveryInterval is the least time between two re-reads, so a client the IdP
+// keeps rejecting does not reload the components on every request
+const credentialRecoveryInterval = 5 * time.Second
+
+// credentialRecovery serializes the re-reads, so a burst of invalid_client answers for the
+// same rotation notifies the components once
+var credentialRecovery struct {
+	sync.Mutex
+	last time.Time
+}
+
+// invalidClient reports whether the token endpoint rejected the client authentication
+func invalidClient(err error) bool {
+	var exchangeErr *exchange.Error
+	return errors.As(err, &exchangeErr) && exchangeErr.Code == "invalid_client"
+}
+
+// recoverClientCredentials re-reads the client credentials after the IdP rejected clientID
+// and clientSecret, e.g. because client-registration rotated the secret in Keycloak and
+// the rotation watcher has not noticed the new file yet. It returns the current credentials
+// and whether they differ, in which case the exchange is worth retrying once.
+func recoverClientCredentials(clientID, clientSecret, requestID string) (string, string, bool) {
+	credentialRecovery.Lock()
+	defer credentialRecovery.Unlock()
+
+	// another request may have re-read them while this one waited
+	currentID, currentSecret, _, _, _ := getConfig()
+	if currentID == clientID && currentSecret == clientSecret && time.Since(credentialRecovery.last) >= credentialRecoveryInterval {
+		credentialRecovery.last = time.Now()
+		rotation.Notify("token endpoint answered invalid_client")
+		currentID, currentSecret, _, _, _ = getConfig()
+	}
+	if currentID == clientID && currentSecret == clientSecret {
+		auditCredentialRecovery(requestID, clientID, currentID, recoveryUnchanged)
+		return clientID, clientSecret, false
+	}
+	return currentID, currentSecret, true
+}
+
+// auditCredentialRecovery logs, counts and exports the outcome of a credential re-read
+func auditCredentialRecovery(requestID, previousID, clientID, result string) {
+	log.Printf("[Audit] event=client_credentials_reloaded result=%s request_id=%s client_id=%s previous_client_id=%s",
+		result, requestID, clientID, previousID)
+	auditExport.Export("client_credentials_reloaded", map[string]string{
+		"result": result, "request_id": requestID, "client_id": clientID, "previous_client_id": previousID,
+	})
+	credentialRecoveries.Inc(result)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const defaultReplayCacheEntries = 100000
+
+var (
+	replaysRejected = newCounter("authbridge_replays_rejected_total",
+		"Subject tokens rejected because their jti was seen from another source address")
+	replayCacheEvictions = newCounter("authbridge_replay_cache_evictions_total",
+		"jti entries evicted to stay within REPLAY_CACHE_MAX_ENTRIES before their token expired")
+	replayCacheEntries = newGauge("authbridge_replay_cache_entries",
+		"jti entries tracked for replay detection")
+)
+
+// ReplayDetector remembers the source address each subject token was first seen from, by
+// its iss and jti, until the token expires. A token arriving from another address is a
+// replay: a bearer token copied off the caller. Tokens without jti or exp are not tracked.
+type ReplayDetector struct {
+	Enabled    bool
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds the entries, the most recently seen first
+	lru *list.List
+}
+
+type seenToken struct {
+	key     string
+	source  string
+	expires time.Time
+}
+
+var replays = &ReplayDetector{}
+
+// loadReplayDetection reads REPLAY_DETECTION and REPLAY_CACHE_MAX_ENTRIES. Detection needs
+// subject token validation: unverified tokens would let anyone record a forged iss and jti
+// from their own address, and so get the real token rejected.
+func loadReplayDetection() error {
+	detector := &ReplayDetector{
+		MaxEntries: defaultReplayCacheEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+	if value := os.Getenv("REPLAY_DETECTION"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid REPLAY_DETECTION %q: %w", value, err)
+		}
+		detector.Enabled = enabled
+	}
+	if value := os.Getenv("REPLAY_CACHE_MAX_ENTRIES"); value != "" {
+		entries, err := strconv.Atoi(value)
+		if err != nil || entries <= 0 {
+			return fmt.Errorf("invalid REPLAY_CACHE_MAX_ENTRIES %q: must be a positive integer", value)
+		}
+		detector.MaxEntries = entries
+	}
+	if detector.Enabled && subjectValidator == nil {
+		return fmt.Errorf("REPLAY_DETECTION requires subject token validation, set SUBJECT_JWKS_URL")
+	}
+	if detector.Enabled {
+		log.Printf("[Replay] Tracking subject token jti values, max entries: %d", detector.MaxEntries)
+	}
+	replays = detector
+	return nil
+}
+
+// Check records the token's source address, the host without the port, and denies the
+// request when the token was seen from another address before. The caller validates the
+// token first.
+func (d *ReplayDetector) Check(token, source string) *v3.ImmediateResponse {
+	if !d.Enabled || token == "" || source == "" {
+		return nil
+	}
+	claims := tokenClaims(token)
+	jti, _ := claims["jti"].(string)
+	expiry := tokenExpiry(token)
+	if jti == "" || expiry.IsZero() {
+		return nil
+	}
+	issuer, _ := claims["iss"].(string)
+	key := issuer + "\x00" + jti
+	source = hostOnly(source)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if element, ok := d.entries[key]; ok {
+		seen := element.Value.(*seenToken)
+		if now.Before(seen.expires) {
+			d.lru.MoveToFront(element)
+			if seen.source == source {
+				return nil
+			}
+			replaysRejected.Add(1)
+			subject, _ := claims["sub"].(string)
+			log.Printf("[Replay] Rejected token jti=%s sub=%s from %s, first seen from %s", jti, subject, source, seen.source)
+			return invalidTokenResponse()
+		}
+		d.remove(element)
+	}
+	d.entries[key] = d.lru.PushFront(&seenToken{key: key, source: source, expires: expiry.Add(clockSkew)})
+	d.evict(now)
+	replayCacheEntries.Set(int64(len(d.entries)))
+	return nil
+}
+
+// evict drops expired entries from the back of the LRU list, then the least recently seen
+// ones until the detector is within MaxEntries; the caller holds the lock
+func (d *ReplayDetector) evict(now time.Time) {
+	for element := d.lru.Back(); element != nil; element = d.lru.Back() {
+		switch {
+		case now.After(element.Value.(*seenToken).expires):
+		case len(d.entries) > d.MaxEntries:
+			replayCacheEvictions.Add(1)
+		default:
+			return
+		}
+		d.remove(element)
+	}
+}
+
+// remove drops an entry; the caller holds the lock
+func (d *ReplayDetector) remove(element *list.Element) {
+	seen := d.lru.Remove(element).(*seenToken)
+	delete(d.entries, seen.key)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"container/list"
+	"strings"
+	"testing"
+	"time"
+
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+func newTestReplayDetector(maxEntries int) *ReplayDetector {
+	return &ReplayDetector{
+		Enabled:    true,
+		MaxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func TestReplayDetectorCheck(t *testing.T) {
+	discardLogs(t)
+	later := time.Now().Add(time.Hour).Unix()
+	token := unsignedToken(map[string]any{"iss": "https://idp", "jti": "1", "sub": "alice", "exp": later})
+
+	tests := []struct {
+		name string
+		// first is the token and source seen before the checked request
+		firstToken, firstSource string
+		token, source           string
+		denied                  bool
+	}{
+		{name: "same source", firstToken: token, firstSource: "10.0.0.1:40000", token: token, source: "10.0.0.1:40000"},
+		{name: "same host from another port", firstToken: token, firstSource: "10.0.0.1:40000", token: token, source: "10.0.0.1:40001"},
+		{name: "same IPv6 host", firstToken: token, firstSource: "[fd00::1]:40000", token: token, source: "[fd00::1]:50000"},
+		{name: "different source", firstToken: token, firstSource: "10.0.0.1:40000", token: token, source: "10.0.0.2:40000", denied: true},
+		{
+			name:       "same jti from another issuer",
+			firstToken: unsignedToken(map[string]any{"iss": "https://other-idp", "jti": "1", "exp": later}), firstSource: "10.0.0.1:40000",
+			token: token, source: "10.0.0.2:40000",
+		},
+		{
+			name:       "other jti",
+			firstToken: unsignedToken(map[string]any{"iss": "https://idp", "jti": "2", "exp": later}), firstSource: "10.0.0.1:40000",
+			token: token, source: "10.0.0.2:40000",
+		},
+		{
+			name:       "token without jti",
+			firstToken: unsignedToken(map[string]any{"iss": "https://idp", "exp": later}), firstSource: "10.0.0.1:40000",
+			token: unsignedToken(map[string]any{"iss": "https://idp", "exp": later}), source: "10.0.0.2:40000",
+		},
+		{
+			name:       "token without exp",
+			firstToken: unsignedToken(map[string]any{"iss": "https://idp", "jti": "1"}), firstSource: "10.0.0.1:40000",
+			token: unsignedToken(map[string]any{"iss": "https://idp", "jti": "1"}), source: "10.0.0.2:40000",
+		},
+		{name: "no source address", firstToken: token, firstSource: "10.0.0.1:40000", token: token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := newTestReplayDetector(10)
+			if denied := detector.Check(tt.firstToken, tt.firstSource); denied != nil {
+				t.Fatalf("first request denied: %s", denied.Body)
+			}
+			denied := detector.Check(tt.token, tt.source)
+			if (denied != nil) != tt.denied {
+				t.Fatalf("Check() = %v, want denied %v", denied, tt.denied)
+			}
+			if denied != nil && denied.Status.Code != typev3.StatusCode_Unauthorized {
+				t.Errorf("status = %v, want %v", denied.Status.Code, typev3.StatusCode_Unauthorized)
+			}
+		})
+	}
+}
+
+func TestReplayDetectorExpiry(t *testing.T) {
+	discardLogs(t)
+	// the token is past exp and CLOCK_SKEW, so the first source is forgotten at once
+	expired := unsignedToken(map[string]any{"jti": "1", "exp": time.Now().Add(-clockSkew - time.Minute).Unix()})
+	detector := newTestReplayDetector(10)
+	if denied := detector.Check(expired, "10.0.0.1:40000"); denied != nil {
+		t.Fatalf("first request denied: %s", denied.Body)
+	}
+	if denied := detector.Check(expired, "10.0.0.2:40000"); denied != nil {
+		t.Errorf("expired entry still denies another source: %s", denied.Body)
+	}
+
+	// an entry is kept for CLOCK_SKEW after exp
+	recent := unsignedToken(map[string]any{"jti": "2", "exp": time.Now().Add(-clockSkew / 2).Unix()})
+	detector.Check(recent, "10.0.0.1:40000")
+	if denied := detector.Check(recent, "10.0.0.2:40000"); denied == nil {
+		t.Error("token within CLOCK_SKEW of exp was not tracked")
+	}
+}
+
+func TestReplayDetectorMaxEntries(t *testing.T) {
+	discardLogs(t)
+	later := time.Now().Add(time.Hour).Unix()
+	first := unsignedToken(map[string]any{"jti": "1", "exp": later})
+	detector := newTestReplayDetector(2)
+	detector.Check(first, "10.0.0.1:40000")
+	detector.Check(unsignedToken(map[string]any{"jti": "2", "exp": later}), "10.0.0.1:40000")
+	detector.Check(unsignedToken(map[string]any{"jti": "3", "exp": later}), "10.0.0.1:40000")
+
+	if len(detector.entries) != 2 {
+		t.Fatalf("entries = %d, want 2", len(detector.entries))
+	}
+	// the least recently seen token was evicted, so another source is no longer detected
+	if denied := detector.Check(first, "10.0.0.2:40000"); denied != nil {
+		t.Errorf("evicted token denied: %s", denied.Body)
+	}
+}
+
+func TestReplayDetectorDisabled(t *testing.T) {
+	token := unsignedToken(map[string]any{"jti": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	detector := &ReplayDetector{}
+	detector.Check(token, "10.0.0.1:40000")
+	if denied := detector.Check(token, "10.0.0.2:40000"); denied != nil {
+		t.Errorf("disabled detector denied a request: %s", denied.Body)
+	}
+}
+
+func TestLoadReplayDetectionNeedsSubjectValidation(t *testing.T) {
+	defer func(detector *ReplayDetector) { replays = detector }(replays)
+	defer func(validator *tokenval.Validator) { subjectValidator = validator }(subjectValidator)
+	t.Setenv("REPLAY_DETECTION", "true")
+
+	subjectValidator = nil
+	err := loadReplayDetection()
+	if err == nil || !strings.Contains(err.Error(), "SUBJECT_JWKS_URL") {
+		t.Errorf("loadReplayDetection() = %v, want an error naming SUBJECT_JWKS_URL", err)
+	}
+
+	verifier, _ := newTestVerifier(t, 0)
+	subjectValidator = verifier.validator
+	if err := loadReplayDetection(); err != nil {
+		t.Fatalf("loadReplayDetection() = %v", err)
+	}
+	if !replays.Enabled {
+		t.Error("replay detection is not enabled")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultRotationPollInterval is how often the credential files are checked for changes
+const defaultRotationPollInterval = 10 * time.Second
+
+// rotationSubscriber re-reads the credential state of one component
+type rotationSubscriber struct {
+	name   string
+	reload func() error
+}
+
+// rotationBus notifies every component holding credentials when they rotate. One watcher
+// polls the credential files and SIGHUP triggers a notification on demand, so components
+// subscribe instead of polling files themselves. Subscribers run one at a time, in the
+// order they subscribed, and a notification never overlaps another.
+type rotationBus struct {
+	mu          sync.Mutex
+	subscribers []rotationSubscriber
+}
+
+var rotation = &rotationBus{}
+
+// Subscribe registers reload to run on every rotation
+func (b *rotationBus) Subscribe(name string, reload func() error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, rotationSubscriber{name: name, reload: reload})
+}
+
+// Notify runs every subscriber; a failing subscriber keeps its previous state and does not
+// stop the others
+func (b *rotationBus) Notify(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	log.Printf("[Rotation] Credentials rotated (%s), notifying %d components", reason, len(b.subscribers))
+	for _, subscriber := range b.subscribers {
+		if err := subscriber.reload(); err != nil {
+			log.Printf("[Rotation] %s failed to reload: %v", subscriber.name, err)
+		}
+	}
+}
+
+// Watch notifies on SIGHUP and whenever the content of one of the files changes
+func (b *rotationBus) Watch(files []string, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	contents := readFiles(files)
+	for {
+		select {
+		case <-hangup:
+			contents = readFiles(files)
+			b.Notify("SIGHUP")
+		case <-ticker.C:
+			current := readFiles(files)
+			for i, file := range files {
+				if !bytes.Equal(current[i], contents[i]) {
+					contents = current
+					b.Notify(fmt.Sprintf("%s changed", file))
+					break
+				}
+			}
+		}
+	}
+}
+
+// readFiles returns the content of each file, nil for files that cannot be read
+func readFiles(files []string) [][]byte {
+	contents := make([][]byte, len(files))
+	for i, file := range files {
+		contents[i], _ = os.ReadFile(file)
+	}
+	return contents
+}
+
+// loadRotation subscribes the credential holders and starts the watcher on the client
+// credential files; ROTATION_POLL_INTERVAL sets the polling interval
+func loadRotation() error {
+	interval := defaultRotationPollInterval
+	if value := os.Getenv("ROTATION_POLL_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid ROTATION_POLL_INTERVAL %q: must be a positive duration", value)
+		}
+		interval = parsed
+	}
+
+	rotation.Subscribe("token exchange config", func() error {
+		loadConfig()
+		return nil
+	})
+	rotation.Subscribe("identity chain", func() error {
+		identityChain.Reset()
+		return nil
+	})
+	rotation.Subscribe("MCP session store", func() error {
+		mcpSessions.ExpireExchanged()
+		return nil
+	})
+	rotation.Subscribe("fan-out token cache", func() error {
+		fanoutCache.Reset()
+		return nil
+	})
+	rotation.Subscribe("stale-if-error token cache", func() error {
+		exchangedTokens.Reset()
+		return nil
+	})
+	if subjectValidator != nil {
+		rotation.Subscribe("subject token validation", func() error {
+			return subjectValidator.Refresh(context.Background())
+		})
+	}
+
+	files := []string{credentialFile("CLIENT_ID_FILE", "/shared/client-id.txt"), credentialFile("CLIENT_SECRET_FILE", "/shared/client-secret.txt")}
+	log.Printf("[Rotation] Watching %v every %s, SIGHUP reloads on demand", files, interval)
+	go rotation.Watch(files, interval)
+	return nil
+}
+
+// credentialFile returns the path in the environment variable, or the default
+func credentialFile(env, fallback string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	return fallback
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+const (
+	// mcpSessionHeader carries the MCP session ID assigned by the server
+	mcpSessionHeader = "mcp-session-id"
+
+	defaultSessionTTL        = 30 * time.Minute
+	defaultSessionMaxEntries = 10000
+	defaultSessionMaxBytes   = 64 << 20
+
+	// sessionBindingOverhead estimates the memory of a binding beyond its strings: the map
+	// entry, the list element and the struct
+	sessionBindingOverhead = 256
+)
+
+var (
+	sessionCacheHits = newCounter("authbridge_session_cache_hits_total",
+		"Exchanges answered with a token cached for the MCP session")
+	sessionCacheMisses = newCounter("authbridge_session_cache_misses_total",
+		"Exchanges of a bound MCP session with no usable cached token")
+	sessionCacheEvictions = newCounter("authbridge_session_cache_evictions_total",
+		"Bindings evicted to stay within MCP_SESSION_MAX_ENTRIES or MCP_SESSION_MAX_BYTES")
+	sessionCacheExpirations = newCounter("authbridge_session_cache_expirations_total",
+		"Bindings dropped after the idle TTL or the expiry of their tokens")
+	sessionCacheEntries = newGauge("authbridge_session_cache_entries",
+		"MCP session bindings stored")
+	sessionCacheBytes = newGauge("authbridge_session_cache_bytes",
+		"Estimated memory of the MCP session bindings")
+	_ = newGaugeFunc("authbridge_session_cache_hit_ratio",
+		"Share of session cache lookups that were hits since the processor started",
+		func() float64 {
+			hits, misses := sessionCacheHits.value.Load(), sessionCacheMisses.value.Load()
+			if hits+misses == 0 {
+				return 0
+			}
+			return float64(hits) / float64(hits+misses)
+		})
+)
+
+// SessionStore binds the token sent and the token exchanged for it to an MCP session, so
+// later requests in the session keep the caller's identity even without an Authorization
+// header. An exchanged token is reused until CLOCK_SKEW before it expires and then exchanged
+// again from the bound subject token; a binding whose tokens have all expired is dropped.
+type SessionStore struct {
+	Enabled bool
+	// TTL drops a binding after the session has been idle this long
+	TTL time.Duration
+	// MaxEntries and MaxBytes, an estimate of the memory of the bindings, bound the store;
+	// the least recently used binding is evicted first
+	MaxEntries int
+	MaxBytes   int
+
+	mu       sync.Mutex
+	bindings map[string]*list.Element
+	// lru holds the bindings, the most recently used first
+	lru   *list.List
+	bytes int
+}
+
+type sessionBinding struct {
+	sessionID string
+	subject   string
+	token     string
+	audience  string
+	scopes    string
+	lastUsed  time.Time
+}
+
+// size estimates the memory a binding takes
+func (b *sessionBinding) size() int {
+	return sessionBindingOverhead + len(b.sessionID) + len(b.subject) + len(b.token) + len(b.audience) + len(b.scopes)
+}
+
+var mcpSessions = &SessionStore{}
+
+// loadSessionStore reads MCP_SESSION_BINDING, MCP_SESSION_TTL, MCP_SESSION_MAX_ENTRIES and
+// MCP_SESSION_MAX_BYTES
+func loadSessionStore() error {
+	store := &SessionStore{
+		TTL:        defaultSessionTTL,
+		MaxEntries: defaultSessionMaxEntries,
+		MaxBytes:   defaultSessionMaxBytes,
+		bindings:   map[string]*list.Element{},
+		lru:        list.New(),
+	}
+	if value := os.Getenv("MCP_SESSION_BINDING"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid MCP_SESSION_BINDING %q: %w", value, err)
+		}
+		store.Enabled = enabled
+	}
+	if value := os.Getenv("MCP_SESSION_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid MCP_SESSION_TTL %q: must be a positive duration", value)
+		}
+		store.TTL = ttl
+	}
+	if value := os.Getenv("MCP_SESSION_MAX_ENTRIES"); value != "" {
+		entries, err := strconv.Atoi(value)
+		if err != nil || entries <= 0 {
+			return fmt.Errorf("invalid MCP_SESSION_MAX_ENTRIES %q: must be a positive integer", value)
+		}
+		store.MaxEntries = entries
+	}
+	if value := os.Getenv("MCP_SESSION_MAX_BYTES"); value != "" {
+		maxBytes, err := strconv.Atoi(value)
+		if err != nil || maxBytes <= 0 {
+			return fmt.Errorf("invalid MCP_SESSION_MAX_BYTES %q: must be a positive integer", value)
+		}
+		store.MaxBytes = maxBytes
+	}
+
+	log.Printf("[MCP Session] Binding enabled: %v, idle TTL: %s, max entries: %d, max bytes: %d",
+		store.Enabled, store.TTL, store.MaxEntries, store.MaxBytes)
+	mcpSessions = store
+	return nil
+}
+
+// SessionID returns the request's MCP session ID, or "" when binding is disabled
+func (s *SessionStore) SessionID(headers []*core.HeaderValue) string {
+	if !s.Enabled {
+		return ""
+	}
+	return getHeaderValue(headers, mcpSessionHeader)
+}
+
+// SubjectToken returns the token bound to the session, to stand in for a missing
+// Authorization header
+func (s *SessionStore) SubjectToken(sessionID string) string {
+	binding, _ := s.lookup(sessionID)
+	return binding.subject
+}
+
+// ExchangedToken returns the token exchanged earlier in the session for the same subject
+// token and exchange parameters, unless it is about to expire
+func (s *SessionStore) ExchangedToken(sessionID, subject, audience, scopes string) string {
+	if sessionID == "" {
+		return ""
+	}
+	binding, ok := s.lookup(sessionID)
+	if !ok || binding.subject != subject || binding.audience != audience || binding.scopes != scopes {
+		sessionCacheMisses.Add(1)
+		return ""
+	}
+	if expiry := tokenExpiry(binding.token); !expiry.IsZero() && time.Until(expiry) < clockSkew {
+		sessionCacheMisses.Add(1)
+		return ""
+	}
+	sessionCacheHits.Add(1)
+	log.Printf("[MCP Session] Reusing the token exchanged for session %s", sessionID)
+	return binding.token
+}
+
+// Check denies a request whose token names a different subject than the one bound to the
+// session. Tokens without a sub claim must be the bound token itself.
+func (s *SessionStore) Check(sessionID, token string) *v3.ImmediateResponse {
+	binding, ok := s.lookup(sessionID)
+	if !ok || token == "" || token == binding.subject {
+		return nil
+	}
+	bound, _ := tokenClaims(binding.subject)["sub"].(string)
+	caller, _ := tokenClaims(token)["sub"].(string)
+	if bound != "" && bound == caller {
+		return nil
+	}
+	log.Printf("[MCP Session] Denied: session %s is bound to subject %q, request carries %q", sessionID, bound, caller)
+	return policyDeniedResponse(PolicyDecision{Reason: "MCP session is bound to another identity"})
+}
+
+// Bind records the tokens of an exchange made in the session
+func (s *SessionStore) Bind(sessionID, subject, token, audience, scopes string) {
+	if sessionID == "" {
+		return
+	}
+	binding := &sessionBinding{
+		sessionID: sessionID,
+		subject:   subject,
+		token:     token,
+		audience:  audience,
+		scopes:    scopes,
+		lastUsed:  time.Now(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.bindings[sessionID]; ok {
+		s.remove(element)
+	}
+	s.bindings[sessionID] = s.lru.PushFront(binding)
+	s.bytes += binding.size()
+	s.evict()
+	s.updateGauges()
+	log.Printf("[MCP Session] Bound session %s, %d sessions stored", sessionID, len(s.bindings))
+}
+
+// ExpireExchanged drops the exchanged tokens, so the next request of each session exchanges
+// its bound token again with the current credentials
+func (s *SessionStore) ExpireExchanged() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, element := range s.bindings {
+		binding := element.Value.(*sessionBinding)
+		s.bytes -= len(binding.token)
+		binding.token = ""
+	}
+	s.updateGauges()
+}
+
+// Forget drops the binding of a session the client terminated with DELETE
+func (s *SessionStore) Forget(sessionID string, headers []*core.HeaderValue) {
+	if sessionID == "" || getHeaderValue(headers, ":method") != http.MethodDelete {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.bindings[sessionID]; ok {
+		s.remove(element)
+		s.updateGauges()
+		log.Printf("[MCP Session] Session %s terminated, binding removed", sessionID)
+	}
+}
+
+// lookup returns a copy of the live binding of a session and marks it used; the copy
+// stays consistent while ExpireExchanged or Bind change the store
+func (s *SessionStore) lookup(sessionID string) (sessionBinding, bool) {
+	if sessionID == "" {
+		return sessionBinding{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.bindings[sessionID]
+	if !ok {
+		return sessionBinding{}, false
+	}
+	binding := element.Value.(*sessionBinding)
+	now := time.Now()
+	if now.Sub(binding.lastUsed) > s.TTL || (expired(binding.subject, now) && (binding.token == "" || expired(binding.token, now))) {
+		s.remove(element)
+		sessionCacheExpirations.Add(1)
+		s.updateGauges()
+		log.Printf("[MCP Session] Binding of session %s expired", sessionID)
+		return sessionBinding{}, false
+	}
+	binding.lastUsed = now
+	s.lru.MoveToFront(element)
+	return *binding, true
+}
+
+// evict drops idle bindings from the back of the LRU list, then the least recently used
+// ones until the store is within its bounds; the caller holds the lock
+func (s *SessionStore) evict() {
+	for element := s.lru.Back(); element != nil; element = s.lru.Back() {
+		binding := element.Value.(*sessionBinding)
+		switch {
+		case time.Since(binding.lastUsed) > s.TTL:
+			sessionCacheExpirations.Add(1)
+		case len(s.bindings) > s.MaxEntries || s.bytes > s.MaxBytes:
+			sessionCacheEvictions.Add(1)
+		default:
+			return
+		}
+		s.remove(element)
+	}
+}
+
+// remove drops a binding; the caller holds the lock
+func (s *SessionStore) remove(element *list.Element) {
+	binding := s.lru.Remove(element).(*sessionBinding)
+	delete(s.bindings, binding.sessionID)
+	s.bytes -= binding.size()
+}
+
+// updateGauges exports the size of the store; the caller holds the lock
+func (s *SessionStore) updateGauges() {
+	sessionCacheEntries.Set(int64(len(s.bindings)))
+	sessionCacheBytes.Set(int64(s.bytes))
+}
+
+// tokenExpiry returns the exp claim of a JWT without verifying it, or the zero time
+func tokenExpiry(token string) time.Time {
+	exp, ok := tokenClaims(token)["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+// expired reports whether a token expired, allowing for CLOCK_SKEW
+func expired(token string, now time.Time) bool {
+	expiry := tokenExpiry(token)
+	return !expiry.IsZero() && now.After(expiry.Add(clockSkew))
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"container/list"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// unsignedToken returns a JWT with the claims and no valid signature, which is all the
+// processor reads from tokens it does not validate
+func unsignedToken(claims map[string]any) string {
+	payload, _ := json.Marshal(claims)
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+func newTestSessionStore(maxEntries, maxBytes int) *SessionStore {
+	return &SessionStore{
+		Enabled:    true,
+		TTL:        time.Hour,
+		MaxEntries: maxEntries,
+		MaxBytes:   maxBytes,
+		bindings:   map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// storedSessions returns the session IDs of the store, the most recently used first
+func storedSessions(s *SessionStore) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for element := s.lru.Front(); element != nil; element = element.Next() {
+		ids = append(ids, element.Value.(*sessionBinding).sessionID)
+	}
+	return ids
+}
+
+func TestSessionStoreExchangedToken(t *testing.T) {
+	discardLogs(t)
+	later := time.Now().Add(time.Hour).Unix()
+	subject := unsignedToken(map[string]any{"sub": "alice", "exp": later})
+	exchanged := unsignedToken(map[string]any{"sub": "alice", "aud": "billing", "exp": later})
+	expiring := unsignedToken(map[string]any{"sub": "alice", "exp": time.Now().Add(clockSkew / 2).Unix()})
+
+	store := newTestSessionStore(10, 1<<20)
+	store.Bind("s1", subject, exchanged, "billing", "openid")
+	store.Bind("s2", subject, expiring, "billing", "openid")
+
+	tests := []struct {
+		name, sessionID, subject, audience, scopes, want string
+	}{
+		{name: "same exchange", sessionID: "s1", subject: subject, audience: "billing", scopes: "openid", want: exchanged},
+		{name: "other subject token", sessionID: "s1", subject: "other", audience: "billing", scopes: "openid"},
+		{name: "other audience", sessionID: "s1", subject: subject, audience: "orders", scopes: "openid"},
+		{name: "other scopes", sessionID: "s1", subject: subject, audience: "billing", scopes: "openid admin"},
+		{name: "token about to expire", sessionID: "s2", subject: subject, audience: "billing", scopes: "openid"},
+		{name: "unknown session", sessionID: "s3", subject: subject, audience: "billing", scopes: "openid"},
+		{name: "no session", subject: subject, audience: "billing", scopes: "openid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := store.ExchangedToken(tt.sessionID, tt.subject, tt.audience, tt.scopes); got != tt.want {
+				t.Errorf("ExchangedToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	store.ExpireExchanged()
+	if got := store.ExchangedToken("s1", subject, "billing", "openid"); got != "" {
+		t.Errorf("ExchangedToken() after ExpireExchanged = %q", got)
+	}
+	if got := store.SubjectToken("s1"); got != subject {
+		t.Errorf("SubjectToken() after ExpireExchanged = %q, want the bound token", got)
+	}
+}
+
+func TestSessionStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	discardLogs(t)
+	store := newTestSessionStore(2, 1<<20)
+	store.Bind("a", "subject-a", "token-a", "billing", "")
+	store.Bind("b", "subject-b", "token-b", "billing", "")
+	store.SubjectToken("a")
+	store.Bind("c", "subject-c", "token-c", "billing", "")
+
+	if got, want := fmt.Sprint(storedSessions(store)), "[c a]"; got != want {
+		t.Errorf("sessions = %s, want %s", got, want)
+	}
+	if got := store.SubjectToken("b"); got != "" {
+		t.Errorf("evicted session b still has subject %q", got)
+	}
+}
+
+func TestSessionStoreByteAccounting(t *testing.T) {
+	discardLogs(t)
+	binding := sessionBinding{sessionID: "a", subject: "subject", token: "token", audience: "billing", scopes: "openid"}
+	size := binding.size()
+	store := newTestSessionStore(10, 2*size)
+
+	store.Bind("a", "subject", "token", "billing", "openid")
+	store.Bind("a", "subject", "token", "billing", "openid")
+	if store.bytes != size {
+		t.Fatalf("bytes after binding a session twice = %d, want %d", store.bytes, size)
+	}
+	store.Bind("b", "subject", "token", "billing", "openid")
+	if store.bytes != 2*size {
+		t.Fatalf("bytes = %d, want %d", store.bytes, 2*size)
+	}
+
+	// a third binding exceeds MaxBytes, so the least recently used one goes
+	store.Bind("c", "subject", "token", "billing", "openid")
+	if got, want := fmt.Sprint(storedSessions(store)), "[c b]"; got != want {
+		t.Errorf("sessions = %s, want %s", got, want)
+	}
+	if store.bytes != 2*size {
+		t.Errorf("bytes after eviction = %d, want %d", store.bytes, 2*size)
+	}
+
+	store.ExpireExchanged()
+	if want := 2 * (size - len("token")); store.bytes != want {
+		t.Errorf("bytes after ExpireExchanged = %d, want %d", store.bytes, want)
+	}
+
+	deleteRequest := []*core.HeaderValue{{Key: ":method", RawValue: []byte("DELETE")}}
+	store.Forget("b", deleteRequest)
+	store.Forget("c", []*core.HeaderValue{{Key: ":method", RawValue: []byte("GET")}})
+	if got, want := fmt.Sprint(storedSessions(store)), "[c]"; got != want {
+		t.Errorf("sessions after Forget = %s, want %s", got, want)
+	}
+	store.Forget("c", deleteRequest)
+	if store.bytes != 0 || len(store.bindings) != 0 {
+		t.Errorf("store not empty after forgetting all sessions: %d bytes, %d bindings", store.bytes, len(store.bindings))
+	}
+}
+
+func TestSessionStoreExpiry(t *testing.T) {
+	discardLogs(t)
+	expiredToken := unsignedToken(map[string]any{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+	liveToken := unsignedToken(map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+
+	store := newTestSessionStore(10, 1<<20)
+	store.Bind("idle", liveToken, liveToken, "billing", "")
+	store.Bind("expired", expiredToken, expiredToken, "billing", "")
+	store.Bind("renewable", expiredToken, liveToken, "billing", "")
+	store.bindings["idle"].Value.(*sessionBinding).lastUsed = time.Now().Add(-2 * store.TTL)
+
+	if got := store.SubjectToken("idle"); got != "" {
+		t.Errorf("idle session kept subject %q", got)
+	}
+	if got := store.SubjectToken("expired"); got != "" {
+		t.Errorf("session with expired tokens kept subject %q", got)
+	}
+	if got := store.SubjectToken("renewable"); got != expiredToken {
+		t.Errorf("session with a live exchanged token lost its binding")
+	}
+	if got, want := fmt.Sprint(storedSessions(store)), "[renewable]"; got != want {
+		t.Errorf("sessions = %s, want %s", got, want)
+	}
+}
+
+func TestSessionStoreCheck(t *testing.T) {
+	discardLogs(t)
+	alice := unsignedToken(map[string]any{"sub": "alice"})
+	store := newTestSessionStore(10, 1<<20)
+	store.Bind("alice", alice, "exchanged", "billing", "")
+	store.Bind("opaque", "opaque-token", "exchanged", "billing", "")
+
+	tests := []struct {
+		name, sessionID, token string
+		denied                 bool
+	}{
+		{name: "same subject", sessionID: "alice", token: alice},
+		{name: "same subject in another token", sessionID: "alice", token: unsignedToken(map[string]any{"sub": "alice", "jti": "2"})},
+		{name: "other subject", sessionID: "alice", token: unsignedToken(map[string]any{"sub": "bob"}), denied: true},
+		{name: "token without sub", sessionID: "alice", token: unsignedToken(map[string]any{}), denied: true},
+		{name: "no token", sessionID: "alice"},
+		{name: "unbound session", sessionID: "other", token: unsignedToken(map[string]any{"sub": "bob"})},
+		{name: "bound token without sub", sessionID: "opaque", token: "opaque-token"},
+		{name: "other token without sub", sessionID: "opaque", token: "other-opaque-token", denied: true},
+		{name: "token with sub for a binding without", sessionID: "opaque", token: alice, denied: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied := store.Check(tt.sessionID, tt.token)
+			if (denied != nil) != tt.denied {
+				t.Fatalf("Check() = %v, want denied %v", denied, tt.denied)
+			}
+			if denied != nil && denied.Status.Code != typev3.StatusCode_Forbidden {
+				t.Errorf("status = %v, want %v", denied.Status.Code, typev3.StatusCode_Forbidden)
+			}
+		})
+	}
+}
+
+// TestSessionStoreConcurrentRotation reads bindings while a rotation drops the exchanged
+// tokens; run with -race
+func TestSessionStoreConcurrentRotation(t *testing.T) {
+	discardLogs(t)
+	store := newTestSessionStore(10, 1<<20)
+	store.Bind("s", "subject", "token", "billing", "")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if got := store.ExchangedToken("s", "subject", "billing", ""); got != "" && got != "token" {
+					t.Errorf("ExchangedToken() = %q", got)
+				}
+				store.Check("s", "subject")
+			}
+		}()
+	}
+	for deadline := time.Now().Add(50 * time.Millisecond); time.Now().Before(deadline); {
+		store.ExpireExchanged()
+		store.Bind("s", "subject", "token", "billing", "")
+		runtime.Gosched()
+	}
+	close(done)
+	wg.Wait()
+}
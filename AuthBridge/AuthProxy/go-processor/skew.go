@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+// clockSkew is the clock drift tolerated between this pod, the IdP and the callers. Cached
+// tokens are renewed this long before they expire, tokens are treated as expired this
+// long after their exp, and subject token validation accepts this skew unless
+// SUBJECT_LEEWAY is set.
+var clockSkew = tokenval.DefaultLeeway
+
+// loadClockSkew reads CLOCK_SKEW
+func loadClockSkew() error {
+	clockSkew = tokenval.DefaultLeeway
+	value := os.Getenv("CLOCK_SKEW")
+	if value == "" {
+		return nil
+	}
+	skew, err := time.ParseDuration(value)
+	if err != nil || skew < 0 {
+		return fmt.Errorf("invalid CLOCK_SKEW %q: must be a non-negative duration", value)
+	}
+	clockSkew = skew
+	log.Printf("[Clock Skew] Tolerating %s of clock drift", clockSkew)
+	return nil
+}
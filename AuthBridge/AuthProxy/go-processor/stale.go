@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+const (
+	defaultStaleGrace        = 5 * time.Minute
+	defaultStaleCacheEntries = 10000
+)
+
+// Exchanges a stale token stands in for, in the stale token metric
+const (
+	staleExchangePrimary = "primary"
+	staleExchangeFanout  = "fanout"
+)
+
+// StaleIfError serves a cached token when the token endpoint is unavailable, instead of
+// forwarding the caller's token. Only outages count: unreachable endpoints and 429 or 5xx
+// answers; a rejected exchange is never answered from the cache.
+type StaleIfError struct {
+	Enabled bool
+	// Grace is how long after its exp a cached token may still be served
+	Grace time.Duration
+}
+
+var staleIfError = StaleIfError{Grace: defaultStaleGrace}
+
+var (
+	staleCacheEvictions = newCounter("authbridge_stale_cache_evictions_total",
+		"Tokens evicted from the stale-if-error cache to stay within STALE_IF_ERROR_MAX_ENTRIES")
+	staleCacheEntries = newGauge("authbridge_stale_cache_entries",
+		"Tokens in the stale-if-error cache")
+	staleTokensServed = newCounterVec("authbridge_stale_tokens_served_total",
+		"Cached tokens served because the token endpoint was unavailable, by exchange",
+		"exchange")
+)
+
+// exchangedTokens keeps the tokens of the primary exchange for stale-if-error; the fan-out
+// exchanges have their own cache
+var exchangedTokens = newTokenCache(defaultStaleCacheEntries, staleCacheEvictions, staleCacheEntries)
+
+// loadStaleIfError reads STALE_IF_ERROR, STALE_IF_ERROR_GRACE and STALE_IF_ERROR_MAX_ENTRIES
+func loadStaleIfError() error {
+	stale := StaleIfError{Grace: defaultStaleGrace}
+	if value := os.Getenv("STALE_IF_ERROR"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid STALE_IF_ERROR %q: %w", value, err)
+		}
+		stale.Enabled = enabled
+	}
+	if value := os.Getenv("STALE_IF_ERROR_GRACE"); value != "" {
+		grace, err := time.ParseDuration(value)
+		if err != nil || grace < 0 {
+			return fmt.Errorf("invalid STALE_IF_ERROR_GRACE %q: must be a non-negative duration", value)
+		}
+		stale.Grace = grace
+	}
+	entries := defaultStaleCacheEntries
+	if value := os.Getenv("STALE_IF_ERROR_MAX_ENTRIES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid STALE_IF_ERROR_MAX_ENTRIES %q: must be a positive integer", value)
+		}
+		entries = n
+	}
+	if stale.Enabled {
+		log.Printf("[Stale] Serving cached tokens up to %s past their expiry while the token endpoint is unavailable, max entries: %d",
+			stale.Grace, entries)
+	}
+	staleIfError = stale
+	exchangedTokens = newTokenCache(entries, staleCacheEvictions, staleCacheEntries)
+	return nil
+}
+
+// retention is how long after its exp a cached token is kept
+func (s StaleIfError) retention() time.Duration {
+	if !s.Enabled {
+		return -clockSkew
+	}
+	return s.Grace
+}
+
+// rememberExchanged caches a token of the primary exchange for stale-if-error
+func rememberExchanged(subjectToken, audience, scopes, token string) {
+	if staleIfError.Enabled {
+		exchangedTokens.Put(subjectToken, audience, scopes, token)
+	}
+}
+
+// staleToken returns the cached token to serve in place of an exchange that failed with
+// err, or "" when stale-if-error is off, the token endpoint was not down or nothing is cached
+func staleToken(cache *tokenCache, err error, subjectToken, audience, scopes, kind string) string {
+	if !staleIfError.Enabled || !idpUnavailable(err) {
+		return ""
+	}
+	token := cache.Stale(subjectToken, audience, scopes)
+	if token == "" {
+		return ""
+	}
+	staleTokensServed.Inc(kind)
+	log.Printf("[Stale] Token endpoint unavailable, serving the cached token for audience %s (expires %s)",
+		audience, tokenExpiry(token).Format(time.RFC3339))
+	return token
+}
+
+// idpUnavailable reports whether err is an outage of the token endpoint rather than a rejection
+func idpUnavailable(err error) bool {
+	var verifyErr *exchangedTokenError
+	if errors.As(err, &verifyErr) {
+		return false
+	}
+	var exchangeErr *exchange.Error
+	if errors.As(err, &exchangeErr) {
+		return exchangeErr.Status == http.StatusTooManyRequests || exchangeErr.Status >= http.StatusInternalServerError
+	}
+	var grantErr *grantError
+	if errors.As(err, &grantErr) {
+		return grantErr.Status == http.StatusTooManyRequests || grantErr.Status >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// tokenCache is an LRU cache of exchanged tokens keyed by the subject token and the
+// exchange parameters. A token is served until CLOCK_SKEW before its exp; with
+// stale-if-error it is kept STALE_IF_ERROR_GRACE past its exp for Stale.
+type tokenCache struct {
+	maxEntries int
+	evictions  *metric
+	size       *metric
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type cachedToken struct {
+	key    string
+	token  string
+	expiry time.Time
+}
+
+// newTokenCache returns a cache that counts its evictions and exports its size in the
+// given metrics
+func newTokenCache(maxEntries int, evictions, size *metric) *tokenCache {
+	return &tokenCache{maxEntries: maxEntries, evictions: evictions, size: size, entries: map[string]*list.Element{}, lru: list.New()}
+}
+
+// tokenCacheKey hashes the subject token, so the cache holds no caller tokens
+func tokenCacheKey(subjectToken, audience, scopes string) string {
+	sum := sha256.Sum256([]byte(subjectToken + "\x00" + audience + "\x00" + scopes))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached token, or "" when there is none or it is about to expire
+func (c *tokenCache) Get(subjectToken, audience, scopes string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element := c.live(tokenCacheKey(subjectToken, audience, scopes))
+	if element == nil {
+		return ""
+	}
+	cached := element.Value.(*cachedToken)
+	if !time.Now().Before(cached.expiry.Add(-clockSkew)) {
+		return ""
+	}
+	c.lru.MoveToFront(element)
+	return cached.token
+}
+
+// Stale returns the cached token even when it is about to expire or expired less than
+// STALE_IF_ERROR_GRACE ago, for serving while the token endpoint is unavailable
+func (c *tokenCache) Stale(subjectToken, audience, scopes string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element := c.live(tokenCacheKey(subjectToken, audience, scopes))
+	if element == nil {
+		return ""
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cachedToken).token
+}
+
+// Put caches a token until its exp; tokens without exp are not cached
+func (c *tokenCache) Put(subjectToken, audience, scopes, token string) {
+	expiry := tokenExpiry(token)
+	if expiry.IsZero() {
+		return
+	}
+	key := tokenCacheKey(subjectToken, audience, scopes)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&cachedToken{key: key, token: token, expiry: expiry})
+	for len(c.entries) > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions.Add(1)
+	}
+	c.size.Set(int64(len(c.entries)))
+}
+
+// Reset drops every token, e.g. after the client credentials rotated
+func (c *tokenCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.size.Set(0)
+}
+
+// live returns the entry of key unless it is past its retention, which it drops; the
+// caller holds the lock
+func (c *tokenCache) live(key string) *list.Element {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(element.Value.(*cachedToken).expiry.Add(staleIfError.retention())) {
+		c.remove(element)
+		return nil
+	}
+	return element
+}
+
+// remove drops an entry; the caller holds the lock
+func (c *tokenCache) remove(element *list.Element) {
+	cached := c.lru.Remove(element).(*cachedToken)
+	delete(c.entries, cached.key)
+	c.size.Set(int64(len(c.entries)))
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// Tool authorization modes (TOOL_AUTHZ_MODE)
+const (
+	toolAuthzOff     = "off"
+	toolAuthzAudit   = "audit"
+	toolAuthzEnforce = "enforce"
+)
+
+const (
+	// defaultToolScopePrefix builds the scope required for tools missing from the policy
+	defaultToolScopePrefix = "tool:"
+
+	// jsonRPCForbidden is the JSON-RPC error code returned for denied tool calls
+	jsonRPCForbidden = -32003
+)
+
+// ToolAuthz checks MCP tools/call requests against the scopes of the forwarded token
+type ToolAuthz struct {
+	Mode string
+	// Policy maps a tool name to the scope it requires; "*" applies to unlisted tools
+	Policy map[string]string
+	// ScopePrefix is prepended to the tool name when the policy has no entry for it
+	ScopePrefix string
+}
+
+var toolAuthz = &ToolAuthz{Mode: toolAuthzOff}
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  struct {
+		Name string `json:"name"`
+	} `json:"params"`
+}
+
+// loadToolAuthz reads TOOL_AUTHZ_MODE, TOOL_POLICY (a JSON object, or TOOL_POLICY_FILE)
+// and TOOL_SCOPE_PREFIX
+func loadToolAuthz() error {
+	authz := &ToolAuthz{
+		Mode:        strings.ToLower(strings.TrimSpace(os.Getenv("TOOL_AUTHZ_MODE"))),
+		Policy:      map[string]string{},
+		ScopePrefix: defaultToolScopePrefix,
+	}
+	if authz.Mode == "" {
+		authz.Mode = toolAuthzOff
+	}
+	if authz.Mode != toolAuthzOff && authz.Mode != toolAuthzAudit && authz.Mode != toolAuthzEnforce {
+		return fmt.Errorf("invalid TOOL_AUTHZ_MODE %q: must be %s, %s or %s", authz.Mode, toolAuthzOff, toolAuthzAudit, toolAuthzEnforce)
+	}
+	if prefix, ok := os.LookupEnv("TOOL_SCOPE_PREFIX"); ok {
+		authz.ScopePrefix = prefix
+	}
+
+	policy := os.Getenv("TOOL_POLICY")
+	if file := os.Getenv("TOOL_POLICY_FILE"); file != "" {
+		content, err := readFileContent(file)
+		if err != nil {
+			return fmt.Errorf("failed to read TOOL_POLICY_FILE: %w", err)
+		}
+		policy = content
+	}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &authz.Policy); err != nil {
+			return fmt.Errorf("failed to parse tool policy: %w", err)
+		}
+	}
+
+	log.Printf("[Tool Authz] Mode: %s, policy entries: %d, scope prefix: %q", authz.Mode, len(authz.Policy), authz.ScopePrefix)
+	toolAuthz = authz
+	return nil
+}
+
+// Enabled reports whether MCP request bodies need to be inspected
+func (a *ToolAuthz) Enabled() bool {
+	return a.Mode == toolAuthzAudit || a.Mode == toolAuthzEnforce
+}
+
+// RequiredScope returns the scope a caller needs to invoke the tool
+func (a *ToolAuthz) RequiredScope(tool string) string {
+	if scope, ok := a.Policy[tool]; ok {
+		return scope
+	}
+	if scope, ok := a.Policy["*"]; ok {
+		return scope
+	}
+	return a.ScopePrefix + tool
+}
+
+// Check returns an ImmediateResponse denying the body's first unauthorized tools/call, or
+// nil. Batches are checked message by message. Bodies that are not JSON-RPC are denied in
+// enforce mode, since a tools/call the processor cannot parse may still be one the MCP
+// server can, and let through in audit mode.
+func (a *ToolAuthz) Check(body []byte, scopes []string) *v3.ImmediateResponse {
+	var requests []jsonRPCRequest
+	var err error
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		var request jsonRPCRequest
+		err = json.Unmarshal(body, &request)
+		requests = []jsonRPCRequest{request}
+	}
+	if err != nil {
+		if a.Mode == toolAuthzAudit {
+			log.Printf("[Tool Authz] Audit: request body is not JSON-RPC: %v", err)
+			return nil
+		}
+		log.Printf("[Tool Authz] Denied a request body that is not JSON-RPC: %v", err)
+		return forbiddenResponse(nil, "Forbidden: tool authorization requires a JSON-RPC request body")
+	}
+
+	granted := map[string]bool{}
+	for _, scope := range scopes {
+		granted[scope] = true
+	}
+	for _, request := range requests {
+		if request.Method != "tools/call" {
+			continue
+		}
+		required := a.RequiredScope(request.Params.Name)
+		if required == "" || granted[required] {
+			log.Printf("[Tool Authz] Allowed tool %q", request.Params.Name)
+			continue
+		}
+		if a.Mode == toolAuthzAudit {
+			log.Printf("[Tool Authz] Audit: tool %q requires scope %q, which the token lacks", request.Params.Name, required)
+			continue
+		}
+		log.Printf("[Tool Authz] Denied tool %q: missing scope %q", request.Params.Name, required)
+		return forbiddenResponse(request.ID, fmt.Sprintf("Forbidden: tool %q requires scope %q", request.Params.Name, required))
+	}
+	return nil
+}
+
+// Inspects reports whether the body of the request must be checked: POSTs with a JSON
+// content-type, and in enforce mode every POST, so that a missing or misleading
+// content-type cannot carry a tools/call past the check
+func (a *ToolAuthz) Inspects(headers []*core.HeaderValue) bool {
+	if !a.Enabled() || !strings.EqualFold(getHeaderValue(headers, ":method"), "POST") {
+		return false
+	}
+	return a.Mode == toolAuthzEnforce || strings.Contains(strings.ToLower(getHeaderValue(headers, "content-type")), "json")
+}
+
+// bufferRequestBody asks Envoy to send the complete request body next; the filter
+// needs allow_mode_override
+func bufferRequestBody() *filterv3.ProcessingMode {
+	return &filterv3.ProcessingMode{
+		RequestHeaderMode:  filterv3.ProcessingMode_SEND,
+		ResponseHeaderMode: filterv3.ProcessingMode_SKIP,
+		RequestBodyMode:    filterv3.ProcessingMode_BUFFERED,
+		ResponseBodyMode:   filterv3.ProcessingMode_NONE,
+	}
+}
+
+// tokenScopes returns the space-separated scope claim of a JWT without verifying it; the
+// token is either the one just issued by the token endpoint or forwarded unchanged
+func tokenScopes(token string) []string {
+	scope, _ := tokenClaims(token)["scope"].(string)
+	return strings.Fields(scope)
+}
+
+func forbiddenResponse(id json.RawMessage, message string) *v3.ImmediateResponse {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	body, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error": map[string]any{
+			"code":    jsonRPCForbidden,
+			"message": message,
+		},
+	})
+	return &v3.ImmediateResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode_Forbidden},
+		Headers: &v3.HeaderMutation{
+			SetHeaders: []*core.HeaderValueOption{
+				{Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/json")}},
+			},
+		},
+		Body:    body,
+		Details: "mcp_tool_forbidden",
+	}
+}
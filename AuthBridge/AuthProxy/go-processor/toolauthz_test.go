@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+)
+
+// discardLogs silences the processor's log output until the test ends
+func discardLogs(tb testing.TB) {
+	previous := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(previous) })
+}
+
+func TestToolAuthzRequiredScope(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy map[string]string
+		tool   string
+		want   string
+	}{
+		{name: "listed tool", policy: map[string]string{"search": "read", "*": "admin"}, tool: "search", want: "read"},
+		{name: "wildcard for unlisted tool", policy: map[string]string{"search": "read", "*": "admin"}, tool: "delete", want: "admin"},
+		{name: "prefix without policy entry", policy: map[string]string{"search": "read"}, tool: "delete", want: "tool:delete"},
+		{name: "listed tool open to all", policy: map[string]string{"ping": "", "*": "admin"}, tool: "ping", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authz := &ToolAuthz{Mode: toolAuthzEnforce, Policy: tt.policy, ScopePrefix: defaultToolScopePrefix}
+			if got := authz.RequiredScope(tt.tool); got != tt.want {
+				t.Errorf("RequiredScope(%q) = %q, want %q", tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolAuthzCheck(t *testing.T) {
+	discardLogs(t)
+	call := func(id, tool string) string {
+		return `{"jsonrpc":"2.0","id":` + id + `,"method":"tools/call","params":{"name":"` + tool + `"}}`
+	}
+	// an oversized batch whose only unauthorized call comes last
+	large := make([]string, 0, 10001)
+	for i := 0; i < 10000; i++ {
+		large = append(large, call("1", "search"))
+	}
+	large = append(large, call("99", "delete"))
+
+	tests := []struct {
+		name   string
+		mode   string
+		body   string
+		scopes []string
+		// deniedID is the JSON-RPC id of the denied call, empty when the body is let through
+		deniedID string
+	}{
+		{name: "granted tool", body: call("1", "search"), scopes: []string{"tool:search"}},
+		{name: "missing scope", body: call("7", "delete"), scopes: []string{"tool:search"}, deniedID: "7"},
+		{name: "missing scope without id", body: `{"jsonrpc":"2.0","method":"tools/call","params":{"name":"delete"}}`, deniedID: "null"},
+		{name: "string id", body: call(`"abc"`, "delete"), deniedID: `"abc"`},
+		{name: "other methods", body: `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`},
+		{name: "audit mode", mode: toolAuthzAudit, body: call("7", "delete")},
+		{name: "batch of granted tools", body: "[" + call("1", "search") + "," + call("2", "search") + "]", scopes: []string{"tool:search"}},
+		{name: "batch with one unauthorized call", body: " [" + call("1", "search") + "," + call("2", "delete") + "]", scopes: []string{"tool:search"}, deniedID: "2"},
+		{name: "batch in audit mode", mode: toolAuthzAudit, body: "[" + call("1", "delete") + "]"},
+		{name: "oversized batch", body: "[" + strings.Join(large, ",") + "]", scopes: []string{"tool:search"}, deniedID: "99"},
+		{name: "not JSON", body: "tools/call delete", deniedID: "null"},
+		{name: "truncated JSON", body: call("7", "delete")[:40], deniedID: "null"},
+		{name: "truncated batch", body: "[" + call("7", "delete"), deniedID: "null"},
+		{name: "empty body", deniedID: "null"},
+		{name: "not JSON in audit mode", mode: toolAuthzAudit, body: "tools/call delete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := tt.mode
+			if mode == "" {
+				mode = toolAuthzEnforce
+			}
+			authz := &ToolAuthz{Mode: mode, Policy: map[string]string{}, ScopePrefix: defaultToolScopePrefix}
+			denied := authz.Check([]byte(tt.body), tt.scopes)
+			if tt.deniedID == "" {
+				if denied != nil {
+					t.Fatalf("Check denied the request: %s", denied.Body)
+				}
+				return
+			}
+			if denied == nil {
+				t.Fatal("Check let the request through")
+			}
+			if denied.Status.Code != typev3.StatusCode_Forbidden {
+				t.Errorf("status = %v, want %v", denied.Status.Code, typev3.StatusCode_Forbidden)
+			}
+			var response struct {
+				ID    json.RawMessage `json:"id"`
+				Error struct {
+					Code int `json:"code"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(denied.Body, &response); err != nil {
+				t.Fatalf("invalid JSON-RPC error %s: %v", denied.Body, err)
+			}
+			if string(response.ID) != tt.deniedID {
+				t.Errorf("id = %s, want %s", response.ID, tt.deniedID)
+			}
+			if response.Error.Code != jsonRPCForbidden {
+				t.Errorf("code = %d, want %d", response.Error.Code, jsonRPCForbidden)
+			}
+		})
+	}
+}
+
+func TestToolAuthzInspects(t *testing.T) {
+	headers := func(method, contentType string) []*core.HeaderValue {
+		return []*core.HeaderValue{{Key: ":method", RawValue: []byte(method)}, {Key: "content-type", RawValue: []byte(contentType)}}
+	}
+	tests := []struct {
+		name    string
+		mode    string
+		headers []*core.HeaderValue
+		want    bool
+	}{
+		{name: "JSON POST", mode: toolAuthzAudit, headers: headers("POST", "application/json"), want: true},
+		{name: "form POST in audit mode", mode: toolAuthzAudit, headers: headers("POST", "application/x-www-form-urlencoded")},
+		{name: "form POST in enforce mode", mode: toolAuthzEnforce, headers: headers("POST", "application/x-www-form-urlencoded"), want: true},
+		{name: "POST without content-type in enforce mode", mode: toolAuthzEnforce, headers: headers("post", ""), want: true},
+		{name: "GET in enforce mode", mode: toolAuthzEnforce, headers: headers("GET", "application/json")},
+		{name: "off", mode: toolAuthzOff, headers: headers("POST", "application/json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (&ToolAuthz{Mode: tt.mode}).Inspects(tt.headers); got != tt.want {
+				t.Errorf("Inspects() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolAuthzEnabled(t *testing.T) {
+	for mode, want := range map[string]bool{toolAuthzOff: false, toolAuthzAudit: true, toolAuthzEnforce: true} {
+		if got := (&ToolAuthz{Mode: mode}).Enabled(); got != want {
+			t.Errorf("Enabled() in mode %s = %v, want %v", mode, got, want)
+		}
+	}
+}
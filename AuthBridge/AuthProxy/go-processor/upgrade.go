@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	filterv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/ext_proc/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// Kinds of requests that turn the stream into a tunnel once the handshake is answered
+const (
+	upgradeNone = ""
+	// upgradeConnect is an HTTP CONNECT tunnel, e.g. HTTPS through the proxy-env listener
+	upgradeConnect = "connect"
+	// upgradeWebSocket is an HTTP/1.1 Upgrade or an HTTP/2 extended CONNECT (RFC 8441)
+	upgradeWebSocket = "websocket"
+)
+
+// upgradeOf returns what the request headers upgrade the connection to, upgradeNone for
+// plain requests. Other HTTP/1.1 upgrades than WebSocket are named after their protocol.
+func upgradeOf(headers []*core.HeaderValue) string {
+	if strings.EqualFold(getHeaderValue(headers, ":method"), "CONNECT") {
+		if protocol := getHeaderValue(headers, ":protocol"); protocol != "" {
+			return strings.ToLower(protocol)
+		}
+		return upgradeConnect
+	}
+	upgrade := getHeaderValue(headers, "upgrade")
+	if upgrade == "" || !headerHasToken(getHeaderValue(headers, "connection"), "upgrade") {
+		return upgradeNone
+	}
+	protocol, _, _ := strings.Cut(upgrade, ",")
+	return strings.ToLower(strings.TrimSpace(protocol))
+}
+
+// headerHasToken reports whether a comma-separated header value lists token
+func headerHasToken(value, token string) bool {
+	for _, item := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// handshakeOnly makes Envoy send nothing after the request headers of an upgrade, so the
+// frames or tunnelled bytes never pass through the processor; the filter needs
+// allow_mode_override
+func handshakeOnly() *filterv3.ProcessingMode {
+	return &filterv3.ProcessingMode{
+		RequestHeaderMode:   filterv3.ProcessingMode_SEND,
+		ResponseHeaderMode:  filterv3.ProcessingMode_SKIP,
+		RequestBodyMode:     filterv3.ProcessingMode_NONE,
+		ResponseBodyMode:    filterv3.ProcessingMode_NONE,
+		RequestTrailerMode:  filterv3.ProcessingMode_SKIP,
+		ResponseTrailerMode: filterv3.ProcessingMode_SKIP,
+	}
+}
+
+// passThrough answers the response body and the trailer messages Envoy sends when its
+// processing mode asks for them, leaving them unchanged. Without allow_mode_override this
+// is also what the frames of an upgraded connection get.
+func passThrough(req *v3.ProcessingRequest) *v3.ProcessingResponse {
+	switch req.Request.(type) {
+	case *v3.ProcessingRequest_ResponseBody:
+		return &v3.ProcessingResponse{Response: &v3.ProcessingResponse_ResponseBody{ResponseBody: &v3.BodyResponse{}}}
+	case *v3.ProcessingRequest_RequestTrailers:
+		return &v3.ProcessingResponse{Response: &v3.ProcessingResponse_RequestTrailers{RequestTrailers: &v3.TrailersResponse{}}}
+	case *v3.ProcessingRequest_ResponseTrailers:
+		return &v3.ProcessingResponse{Response: &v3.ProcessingResponse_ResponseTrailers{ResponseTrailers: &v3.TrailersResponse{}}}
+	}
+	return nil
+}
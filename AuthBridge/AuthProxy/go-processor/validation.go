@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+var subjectValidator *tokenval.Validator
+
+// loadSubjectValidation reads SUBJECT_JWKS_URL, SUBJECT_ISSUERS, SUBJECT_AUDIENCES,
+// SUBJECT_REQUIRED_CLAIMS (comma-separated lists) and SUBJECT_LEEWAY, which defaults to
+// CLOCK_SKEW; without SUBJECT_JWKS_URL subject tokens are not validated
+func loadSubjectValidation(ctx context.Context) error {
+	jwksURL := os.Getenv("SUBJECT_JWKS_URL")
+	if jwksURL == "" {
+		return nil
+	}
+	opts := tokenval.Options{
+		JWKSURL:        jwksURL,
+		Issuers:        splitList(os.Getenv("SUBJECT_ISSUERS")),
+		Audiences:      splitList(os.Getenv("SUBJECT_AUDIENCES")),
+		RequiredClaims: splitList(os.Getenv("SUBJECT_REQUIRED_CLAIMS")),
+		Leeway:         clockSkew,
+		HTTPClient:     idpClient,
+	}
+	if clockSkew == 0 {
+		opts.Leeway = tokenval.NoLeeway
+	}
+	if value := os.Getenv("SUBJECT_LEEWAY"); value != "" {
+		leeway, err := tokenval.ParseLeeway(value)
+		if err != nil {
+			return fmt.Errorf("invalid SUBJECT_LEEWAY: %w", err)
+		}
+		opts.Leeway = leeway
+	}
+	validator, err := tokenval.New(ctx, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Token Validation] JWKS URL: %s, issuers: %v, audiences: %v, leeway: %s",
+		jwksURL, opts.Issuers, opts.Audiences, max(opts.Leeway, 0))
+	subjectValidator = validator
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func invalidTokenResponse() *v3.ImmediateResponse {
+	body, _ := json.Marshal(map[string]string{"error": "invalid_token"})
+	return &v3.ImmediateResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode_Unauthorized},
+		Headers: &v3.HeaderMutation{
+			SetHeaders: []*core.HeaderValueOption{
+				{Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/json")}},
+				{Header: &core.HeaderValue{Key: "www-authenticate", RawValue: []byte(`Bearer error="invalid_token"`)}},
+			},
+		},
+		Body:    body,
+		Details: "invalid_subject_token",
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+// defaultExchangedTokenMaxLifetime bounds how far in the future an exchanged token may expire
+const defaultExchangedTokenMaxLifetime = 24 * time.Hour
+
+// exchangedTokenVerifyTimeout bounds a verification, including the JWKS fetch it may wait
+// for, so that a slow JWKS endpoint cannot stall the stream
+var exchangedTokenVerifyTimeout = 10 * time.Second
+
+var exchangedTokensRejected = newCounter("authbridge_exchanged_tokens_rejected_total",
+	"Tokens returned by the token endpoint that failed verification and were not forwarded")
+
+// exchangeVerifier checks the tokens the IdP returns before they are forwarded, so that
+// an IdP misconfiguration fails at the proxy instead of as a 401 from upstream; nil
+// forwards them unchecked
+var exchangeVerifier *exchangedTokenVerifier
+
+type exchangedTokenVerifier struct {
+	validator *tokenval.Validator
+	// maxLifetime is how far in the future exp may be, 0 for any
+	maxLifetime time.Duration
+}
+
+// exchangedTokenError is a token the IdP issued that failed verification. It is a
+// misconfiguration rather than an outage, so no stale token is served instead.
+type exchangedTokenError struct {
+	Audience string
+	Err      error
+}
+
+func (e *exchangedTokenError) Error() string {
+	return fmt.Sprintf("exchanged token for audience %s failed verification: %v", e.Audience, e.Err)
+}
+
+func (e *exchangedTokenError) Unwrap() error { return e.Err }
+
+// loadExchangedTokenVerification reads EXCHANGED_TOKEN_JWKS_URL, EXCHANGED_TOKEN_ISSUERS
+// (comma-separated) and EXCHANGED_TOKEN_MAX_LIFETIME; without EXCHANGED_TOKEN_JWKS_URL
+// exchanged tokens are forwarded unchecked
+func loadExchangedTokenVerification(ctx context.Context) error {
+	jwksURL := os.Getenv("EXCHANGED_TOKEN_JWKS_URL")
+	if jwksURL == "" {
+		return nil
+	}
+	opts := tokenval.Options{
+		JWKSURL:        jwksURL,
+		Issuers:        splitList(os.Getenv("EXCHANGED_TOKEN_ISSUERS")),
+		RequiredClaims: []string{"exp"},
+		Leeway:         clockSkew,
+		HTTPClient:     idpClient,
+	}
+	if clockSkew == 0 {
+		opts.Leeway = tokenval.NoLeeway
+	}
+	maxLifetime := defaultExchangedTokenMaxLifetime
+	if value := os.Getenv("EXCHANGED_TOKEN_MAX_LIFETIME"); value != "" {
+		lifetime, err := time.ParseDuration(value)
+		if err != nil || lifetime < 0 {
+			return fmt.Errorf("invalid EXCHANGED_TOKEN_MAX_LIFETIME %q: must be a non-negative duration", value)
+		}
+		maxLifetime = lifetime
+	}
+	validator, err := tokenval.New(ctx, opts)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Token Verification] JWKS URL: %s, issuers: %v, max lifetime: %s", jwksURL, opts.Issuers, maxLifetime)
+	exchangeVerifier = &exchangedTokenVerifier{validator: validator, maxLifetime: maxLifetime}
+	return nil
+}
+
+// Verify checks the signature, issuer and expiry of a token exchanged for audience, that
+// it names audience and that it does not expire further than maxLifetime in the future
+func (v *exchangedTokenVerifier) Verify(ctx context.Context, token, audience string) error {
+	if v == nil {
+		return nil
+	}
+	err := v.verify(ctx, token, audience)
+	if err != nil {
+		exchangedTokensRejected.Add(1)
+		err = &exchangedTokenError{Audience: audience, Err: err}
+		log.Printf("[Token Verification] %v", err)
+	}
+	return err
+}
+
+func (v *exchangedTokenVerifier) verify(ctx context.Context, token, audience string) error {
+	parsed, err := v.validator.Validate(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(parsed.Audience(), audience) {
+		return fmt.Errorf("invalid audience: expected %s, got %v", audience, parsed.Audience())
+	}
+	if v.maxLifetime > 0 {
+		if limit := time.Now().Add(v.maxLifetime + clockSkew); parsed.Expiration().After(limit) {
+			return fmt.Errorf("exp %s is more than %s away", parsed.Expiration().Format(time.RFC3339), v.maxLifetime)
+		}
+	}
+	return nil
+}
+
+// exchangedTokenResponse rejects a request whose exchanged token failed verification
+// with 502, naming the failed check, or returns nil for any other error
+func exchangedTokenResponse(err error) *v3.ImmediateResponse {
+	var verifyErr *exchangedTokenError
+	if !errors.As(err, &verifyErr) {
+		return nil
+	}
+	body, _ := json.Marshal(map[string]string{"error": "invalid_exchanged_token", "reason": verifyErr.Error()})
+	return &v3.ImmediateResponse{
+		Status: &typev3.HttpStatus{Code: typev3.StatusCode_BadGateway},
+		Headers: &v3.HeaderMutation{
+			SetHeaders: []*core.HeaderValueOption{
+				{Header: &core.HeaderValue{Key: "content-type", RawValue: []byte("application/json")}},
+			},
+		},
+		Body:    body,
+		Details: "invalid_exchanged_token",
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+const verificationIssuer = "https://keycloak.example.com/realms/demo"
+
+// newTestVerifier returns a verifier of tokens from verificationIssuer signed by the
+// returned key, whose public key an httptest JWKS endpoint serves
+func newTestVerifier(t *testing.T, maxLifetime time.Duration) (*exchangedTokenVerifier, jwk.Key) {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = key.Set(jwk.KeyIDKey, "key-1")
+	_ = key.Set(jwk.AlgorithmKey, jwa.RS256)
+	public, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(public); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	validator, err := tokenval.New(ctx, tokenval.Options{
+		JWKSURL:        server.URL,
+		Issuers:        []string{verificationIssuer},
+		RequiredClaims: []string{"exp"},
+		HTTPClient:     server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &exchangedTokenVerifier{validator: validator, maxLifetime: maxLifetime}, key
+}
+
+// signExchanged issues a token for audience billing that expires in an hour, with the
+// claims in edit applied on top
+func signExchanged(t *testing.T, key jwk.Key, edit func(jwt.Token)) string {
+	t.Helper()
+	token := jwt.New()
+	_ = token.Set(jwt.IssuerKey, verificationIssuer)
+	_ = token.Set(jwt.SubjectKey, "alice")
+	_ = token.Set(jwt.AudienceKey, []string{"billing"})
+	_ = token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour))
+	if edit != nil {
+		edit(token)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestExchangedTokenVerifierVerify(t *testing.T) {
+	discardLogs(t)
+	verifier, key := newTestVerifier(t, time.Hour)
+	unlimited, unlimitedKey := newTestVerifier(t, 0)
+	expiresIn := func(d time.Duration) func(jwt.Token) {
+		return func(tok jwt.Token) { _ = tok.Set(jwt.ExpirationKey, time.Now().Add(d)) }
+	}
+
+	tests := []struct {
+		name     string
+		verifier *exchangedTokenVerifier
+		token    string
+		audience string
+		// err is a substring of the expected error, empty for a token that is forwarded
+		err string
+	}{
+		{name: "valid token", verifier: verifier, token: signExchanged(t, key, nil), audience: "billing"},
+		{
+			name:     "one of several audiences",
+			verifier: verifier,
+			token:    signExchanged(t, key, func(tok jwt.Token) { _ = tok.Set(jwt.AudienceKey, []string{"account", "billing"}) }),
+			audience: "billing",
+		},
+		{name: "audience mismatch", verifier: verifier, token: signExchanged(t, key, nil), audience: "orders", err: "invalid audience: expected orders"},
+		{name: "exp within maxLifetime and CLOCK_SKEW", verifier: verifier, token: signExchanged(t, key, expiresIn(time.Hour+clockSkew/2)), audience: "billing"},
+		{name: "exp beyond maxLifetime", verifier: verifier, token: signExchanged(t, key, expiresIn(25*time.Hour)), audience: "billing", err: "more than 1h0m0s away"},
+		{name: "any exp without maxLifetime", verifier: unlimited, token: signExchanged(t, unlimitedKey, expiresIn(365*24*time.Hour)), audience: "billing"},
+		{name: "expired", verifier: verifier, token: signExchanged(t, key, expiresIn(-time.Hour)), audience: "billing", err: "exp"},
+		{name: "signed by another key", verifier: verifier, token: signExchanged(t, unlimitedKey, nil), audience: "billing", err: "failed to parse/validate"},
+		{name: "no verifier", token: "not-a-jwt", audience: "billing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := exchangedTokensRejected.value.Load()
+			err := tt.verifier.Verify(context.Background(), tt.token, tt.audience)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Verify() = %v", err)
+				}
+				if got := exchangedTokensRejected.value.Load(); got != rejected {
+					t.Errorf("rejected counter = %d, want %d", got, rejected)
+				}
+				return
+			}
+			var verifyErr *exchangedTokenError
+			if !errors.As(err, &verifyErr) || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Verify() = %v, want an exchangedTokenError containing %q", err, tt.err)
+			}
+			if verifyErr.Audience != tt.audience {
+				t.Errorf("error audience = %s, want %s", verifyErr.Audience, tt.audience)
+			}
+			if got := exchangedTokensRejected.value.Load(); got != rejected+1 {
+				t.Errorf("rejected counter = %d, want %d", got, rejected+1)
+			}
+		})
+	}
+}
+
+func TestExchangedTokenResponse(t *testing.T) {
+	verifyErr := &exchangedTokenError{Audience: "billing", Err: errors.New("invalid audience: expected billing, got [orders]")}
+	for _, err := range []error{verifyErr, fmt.Errorf("token exchange failed: %w", verifyErr)} {
+		resp := exchangedTokenResponse(err)
+		if resp == nil {
+			t.Fatalf("exchangedTokenResponse(%v) = nil", err)
+		}
+		if resp.Status.Code != typev3.StatusCode_BadGateway {
+			t.Errorf("status = %v, want %v", resp.Status.Code, typev3.StatusCode_BadGateway)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["error"] != "invalid_exchanged_token" || body["reason"] != verifyErr.Error() {
+			t.Errorf("body = %v", body)
+		}
+		if got := string(resp.Headers.SetHeaders[0].Header.RawValue); got != "application/json" {
+			t.Errorf("content-type = %s", got)
+		}
+	}
+
+	for _, err := range []error{nil, errors.New("token exchange failed: connection refused")} {
+		if resp := exchangedTokenResponse(err); resp != nil {
+			t.Errorf("exchangedTokenResponse(%v) = %v, want nil", err, resp)
+		}
+	}
+}
+
+// TestExchangeTokenVerifyDeadline fails the exchange, rather than holding up the stream,
+// when the JWKS endpoint of the verifier does not answer
+func TestExchangeTokenVerifyDeadline(t *testing.T) {
+	discardLogs(t)
+	idp := exchangetest.NewIdP()
+	defer idp.Close()
+	secret := exchangetest.RandomSecret()
+	idp.AddClient("agent", secret)
+	idp.AddAudience("billing")
+
+	release := make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer jwks.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validator, err := tokenval.New(ctx, tokenval.Options{JWKSURL: jwks.URL, Issuers: []string{idp.Issuer()}, HTTPClient: jwks.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(verifier *exchangedTokenVerifier, timeout time.Duration) {
+		exchangeVerifier, exchangedTokenVerifyTimeout = verifier, timeout
+	}(exchangeVerifier, exchangedTokenVerifyTimeout)
+	exchangeVerifier = &exchangedTokenVerifier{validator: validator}
+	exchangedTokenVerifyTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err = exchangeToken("agent", secret, idp.TokenURL(), idp.Issue("alice", "agent"), "billing", "openid", "", ActorToken{}, requestLog{})
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("exchangeToken() took %s with an unresponsive JWKS endpoint", elapsed)
+	}
+	if exchangedTokenResponse(err) == nil {
+		t.Errorf("exchangeToken() = %v, want a verification error", err)
+	}
+}
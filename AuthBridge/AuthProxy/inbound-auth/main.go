@@ -0,0 +1,143 @@
+// Command inbound-auth is a reverse proxy in front of an application that rejects requests
+// without a valid bearer JWT, so the application never sees unauthenticated traffic. It
+// validates tokens like the demo app, with the pkg/inbound library.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/huang195/auth-proxy/pkg/inbound"
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+const (
+	// healthPath answers without authentication, for the readiness probe
+	healthPath = "/inbound-auth/healthz"
+	// probePrefix starts the paths the webhook rewrites the application's probes to
+	probePrefix = "/inbound-auth/probe/"
+)
+
+func main() {
+	listenAddr := os.Getenv("LISTEN_ADDR")
+	if listenAddr == "" {
+		listenAddr = ":15130"
+	}
+
+	upstream := os.Getenv("UPSTREAM_URL")
+	if upstream == "" {
+		log.Fatal("UPSTREAM_URL environment variable is required")
+	}
+	upstreamURL, err := url.Parse(upstream)
+	if err != nil {
+		log.Fatalf("Invalid UPSTREAM_URL %q: %v", upstream, err)
+	}
+
+	// Without JWKS_URL and ISSUER, both are derived from the Keycloak realm
+	realmURL := ""
+	if keycloakURL, realm := os.Getenv("KEYCLOAK_URL"), os.Getenv("KEYCLOAK_REALM"); keycloakURL != "" && realm != "" {
+		realmURL = strings.TrimSuffix(keycloakURL, "/") + "/realms/" + realm
+	}
+	jwksURL := os.Getenv("JWKS_URL")
+	if jwksURL == "" && realmURL != "" {
+		jwksURL = realmURL + "/protocol/openid-connect/certs"
+	}
+	if jwksURL == "" {
+		log.Fatal("JWKS_URL, or KEYCLOAK_URL and KEYCLOAK_REALM, environment variables are required")
+	}
+	issuers := splitList(os.Getenv("ISSUER"))
+	if len(issuers) == 0 && realmURL != "" {
+		issuers = []string{realmURL}
+	}
+	if len(issuers) == 0 {
+		log.Fatal("ISSUER, or KEYCLOAK_URL and KEYCLOAK_REALM, environment variables are required")
+	}
+	// Without AUDIENCE, tokens must be issued for this workload's client ID, so that tokens
+	// the realm issued for other clients are not accepted
+	audiences := splitList(os.Getenv("AUDIENCE"))
+	if len(audiences) == 0 {
+		if file := os.Getenv("CLIENT_ID_FILE"); file != "" {
+			clientID, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("Failed to read CLIENT_ID_FILE for the default audience: %v", err)
+			}
+			audiences = splitList(string(clientID))
+		}
+	}
+	if len(audiences) == 0 {
+		log.Fatal("AUDIENCE, or CLIENT_ID_FILE naming this workload's client ID, environment variable is required")
+	}
+
+	leeway, err := tokenval.ParseLeeway(os.Getenv("LEEWAY"))
+	if err != nil {
+		log.Fatalf("Invalid LEEWAY: %v", err)
+	}
+	validator, err := tokenval.New(context.Background(), tokenval.Options{
+		JWKSURL:        jwksURL,
+		Issuers:        issuers,
+		Audiences:      audiences,
+		Leeway:         leeway,
+		RequiredClaims: splitList(os.Getenv("REQUIRED_CLAIMS")),
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up token validation: %v", err)
+	}
+	authenticator := &inbound.Authenticator{
+		Validator:          validator,
+		ExpectedActor:      os.Getenv("EXPECTED_ACTOR"),
+		PassCORSPreflights: os.Getenv("PASS_CORS_PREFLIGHTS") == "true",
+	}
+
+	// PROBE_PATHS maps the pass-through paths of the application's probes to their original
+	// paths, as JSON
+	probePaths := map[string]string{}
+	if value := os.Getenv("PROBE_PATHS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &probePaths); err != nil {
+			log.Fatalf("Invalid PROBE_PATHS: %v", err)
+		}
+	}
+	proxy := httputil.NewSingleHostReverseProxy(upstreamURL)
+	probes, err := inbound.ProbePassthrough(probePaths, proxy)
+	if err != nil {
+		log.Fatalf("Invalid PROBE_PATHS: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthPath, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle(probePrefix, probes)
+	mux.Handle("/", authenticator.Wrap(proxy))
+
+	log.Printf("Inbound auth starting on %s, forwarding to %s", listenAddr, upstreamURL)
+	log.Printf("JWKS URL: %s", jwksURL)
+	log.Printf("Expected issuers: %v", issuers)
+	log.Printf("Expected audiences: %v", audiences)
+	for path, original := range probePaths {
+		log.Printf("Probe %s passes through to %s", path, original)
+	}
+	if authenticator.ExpectedActor != "" {
+		log.Printf("Expected actor: %s", authenticator.ExpectedActor)
+	}
+	if authenticator.PassCORSPreflights {
+		log.Printf("CORS preflights pass through without a token")
+	}
+	log.Fatal(http.ListenAndServe(listenAddr, mux))
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -5,6 +5,31 @@ set -e
 PROXY_PORT="${PROXY_PORT:-15123}"
 PROXY_UID="${PROXY_UID:-1337}"
 OUTBOUND_PORTS_EXCLUDE="${OUTBOUND_PORTS_EXCLUDE:-}"
+OUTBOUND_UIDS_EXCLUDE="${OUTBOUND_UIDS_EXCLUDE:-}"
+OUTBOUND_IP_RANGES_EXCLUDE="${OUTBOUND_IP_RANGES_EXCLUDE:-}"
+
+# Inbound capture is disabled unless ports are listed ("*" captures all ports)
+INBOUND_PROXY_PORT="${INBOUND_PROXY_PORT:-15124}"
+INBOUND_PORTS_INCLUDE="${INBOUND_PORTS_INCLUDE:-}"
+# Inbound traffic to INBOUND_AUTH_PORT, the application port inbound-auth protects, goes to
+# inbound-auth on INBOUND_AUTH_PROXY_PORT instead, whatever INBOUND_PORTS_INCLUDE captures
+INBOUND_AUTH_PORT="${INBOUND_AUTH_PORT:-}"
+INBOUND_AUTH_PROXY_PORT="${INBOUND_AUTH_PROXY_PORT:-15130}"
+# REDIRECT (nat table) or TPROXY (mangle table, preserves the original destination and source)
+INTERCEPTION_MODE="${INTERCEPTION_MODE:-REDIRECT}"
+TPROXY_MARK="${TPROXY_MARK:-1337}"
+TPROXY_ROUTE_TABLE="${TPROXY_ROUTE_TABLE:-133}"
+
+# IP families to configure: auto (detect from the pod's addresses), ipv4, ipv6 or dual
+IP_FAMILIES="${IP_FAMILIES:-auto}"
+
+case "${INTERCEPTION_MODE}" in
+  REDIRECT|TPROXY) ;;
+  *)
+    echo "Unsupported INTERCEPTION_MODE ${INTERCEPTION_MODE}, expected REDIRECT or TPROXY" >&2
+    exit 1
+    ;;
+esac
 
 # Istio ztunnel defaults
 ZTUNNEL_UID="${ZTUNNEL_UID:-1337}"
@@ -12,55 +37,196 @@ ZTUNNEL_INBOUND_PORT="${ZTUNNEL_INBOUND_PORT:-15008}"
 ZTUNNEL_OUTBOUND_PORT="${ZTUNNEL_OUTBOUND_PORT:-15001}"
 ZTUNNEL_TUNNEL_PORT="${ZTUNNEL_TUNNEL_PORT:-15006}"
 
-echo "Setting up iptables rules for outbound traffic interception..."
-
-# Create custom chains (ignore errors if they already exist)
-iptables -t nat -N PROXY_OUTPUT 2>/dev/null || true
-iptables -t nat -N PROXY_REDIRECT 2>/dev/null || true
-
-# Flush any existing rules in our chains to ensure idempotency
-iptables -t nat -F PROXY_OUTPUT 2>/dev/null || true
-iptables -t nat -F PROXY_REDIRECT 2>/dev/null || true
-
-# Redirect to proxy port
-iptables -t nat -A PROXY_REDIRECT -p tcp -j REDIRECT --to-port "${PROXY_PORT}"
-
-# Exclude traffic from proxy's own UID to prevent infinite loops
-iptables -t nat -A PROXY_OUTPUT -m owner --uid-owner "${PROXY_UID}" -j RETURN
-
-# Exclude traffic from ztunnel UID to prevent conflicts with Istio ambient mesh
-iptables -t nat -A PROXY_OUTPUT -m owner --uid-owner "${ZTUNNEL_UID}" -j RETURN
-
-# Exclude SSH traffic
-iptables -t nat -A PROXY_OUTPUT -p tcp --dport 22 -j RETURN
-
-# Exclude localhost traffic
-iptables -t nat -A PROXY_OUTPUT -p tcp -d 127.0.0.1/32 -j RETURN
-
-# Exclude Istio ztunnel ports to avoid interference
-echo "Excluding Istio ztunnel ports: ${ZTUNNEL_INBOUND_PORT}, ${ZTUNNEL_OUTBOUND_PORT}, ${ZTUNNEL_TUNNEL_PORT}"
-iptables -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_INBOUND_PORT}" -j RETURN
-iptables -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_OUTBOUND_PORT}" -j RETURN
-iptables -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_TUNNEL_PORT}" -j RETURN
-
-# Exclude specified outbound ports
-if [ -n "${OUTBOUND_PORTS_EXCLUDE}" ]; then
-  for port in $(echo "${OUTBOUND_PORTS_EXCLUDE}" | tr ',' ' '); do
-    echo "Excluding outbound port ${port} from redirection"
-    iptables -t nat -A PROXY_OUTPUT -p tcp --dport "${port}" -j RETURN
-  done
+# has_global_ipv6 reports whether the pod has a non-link-local IPv6 address
+has_global_ipv6() {
+  [ -r /proc/net/if_inet6 ] || return 1
+  # Column 4 is the scope: 00 is global; skip loopback (lo)
+  awk '$4 == "00" && $6 != "lo" { found = 1 } END { exit !found }' /proc/net/if_inet6
+}
+
+# has_ipv4 reports whether the pod has a non-loopback IPv4 address
+has_ipv4() {
+  [ -r /proc/net/route ] || return 1
+  awk 'NR > 1 && $1 != "lo" { found = 1 } END { exit !found }' /proc/net/route
+}
+
+# configure_family installs the rules for one IP family.
+#   $1: iptables or ip6tables
+#   $2: loopback CIDR of the family
+#   $3: ip command for the family ("ip" or "ip -6")
+configure_family() {
+  IPT="$1"
+  LOOPBACK="$2"
+  IPCMD="$3"
+
+  echo "Setting up ${IPT} rules for outbound traffic interception..."
+
+  # Create custom chains (ignore errors if they already exist)
+  ${IPT} -t nat -N PROXY_OUTPUT 2>/dev/null || true
+  ${IPT} -t nat -N PROXY_REDIRECT 2>/dev/null || true
+
+  # Flush any existing rules in our chains to ensure idempotency
+  ${IPT} -t nat -F PROXY_OUTPUT 2>/dev/null || true
+  ${IPT} -t nat -F PROXY_REDIRECT 2>/dev/null || true
+
+  # Redirect to proxy port
+  ${IPT} -t nat -A PROXY_REDIRECT -p tcp -j REDIRECT --to-port "${PROXY_PORT}"
+
+  # Exclude traffic from proxy's own UID to prevent infinite loops
+  ${IPT} -t nat -A PROXY_OUTPUT -m owner --uid-owner "${PROXY_UID}" -j RETURN
+
+  # Exclude traffic from ztunnel UID to prevent conflicts with Istio ambient mesh
+  ${IPT} -t nat -A PROXY_OUTPUT -m owner --uid-owner "${ZTUNNEL_UID}" -j RETURN
+
+  # Exclude SSH traffic
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp --dport 22 -j RETURN
+
+  # Exclude localhost traffic
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp -d "${LOOPBACK}" -j RETURN
+
+  # Exclude Istio ztunnel ports to avoid interference
+  echo "Excluding Istio ztunnel ports: ${ZTUNNEL_INBOUND_PORT}, ${ZTUNNEL_OUTBOUND_PORT}, ${ZTUNNEL_TUNNEL_PORT}"
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_INBOUND_PORT}" -j RETURN
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_OUTBOUND_PORT}" -j RETURN
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp --dport "${ZTUNNEL_TUNNEL_PORT}" -j RETURN
+
+  # Exclude specified outbound ports
+  if [ -n "${OUTBOUND_PORTS_EXCLUDE}" ]; then
+    for port in $(echo "${OUTBOUND_PORTS_EXCLUDE}" | tr ',' ' '); do
+      echo "Excluding outbound port ${port} from redirection"
+      ${IPT} -t nat -A PROXY_OUTPUT -p tcp --dport "${port}" -j RETURN
+    done
+  fi
+
+  # Exclude traffic from specified UIDs (containers opted out of redirection)
+  if [ -n "${OUTBOUND_UIDS_EXCLUDE}" ]; then
+    for uid in $(echo "${OUTBOUND_UIDS_EXCLUDE}" | tr ',' ' '); do
+      echo "Excluding outbound traffic from UID ${uid} from redirection"
+      ${IPT} -t nat -A PROXY_OUTPUT -m owner --uid-owner "${uid}" -j RETURN
+    done
+  fi
+
+  # Exclude specified destination CIDRs of this family
+  if [ -n "${OUTBOUND_IP_RANGES_EXCLUDE}" ]; then
+    for cidr in $(echo "${OUTBOUND_IP_RANGES_EXCLUDE}" | tr ',' ' '); do
+      case "${cidr}" in
+        *:*) [ "${IPT}" = "ip6tables" ] || continue ;;
+        *) [ "${IPT}" = "iptables" ] || continue ;;
+      esac
+      echo "Excluding outbound destination ${cidr} from redirection"
+      ${IPT} -t nat -A PROXY_OUTPUT -p tcp -d "${cidr}" -j RETURN
+    done
+  fi
+
+  # Redirect all other TCP traffic
+  ${IPT} -t nat -A PROXY_OUTPUT -p tcp -j PROXY_REDIRECT
+
+  # Insert rule at the beginning of OUTPUT chain with higher priority than Istio rules
+  # Check if rule already exists to avoid duplicates
+  if ! ${IPT} -t nat -C OUTPUT -p tcp -j PROXY_OUTPUT 2>/dev/null; then
+    ${IPT} -t nat -I OUTPUT 1 -p tcp -j PROXY_OUTPUT
+  fi
+
+  # Requests to the pod IP must not reach the application port around inbound-auth, which
+  # forwards to the application on loopback and so is not redirected again
+  if [ -n "${INBOUND_AUTH_PORT}" ]; then
+    ${IPT} -t nat -N PROXY_INBOUND_AUTH 2>/dev/null || true
+    ${IPT} -t nat -F PROXY_INBOUND_AUTH 2>/dev/null || true
+    ${IPT} -t nat -A PROXY_INBOUND_AUTH -p tcp --dport "${INBOUND_AUTH_PORT}" -j REDIRECT --to-port "${INBOUND_AUTH_PROXY_PORT}"
+    if ! ${IPT} -t nat -C PREROUTING -p tcp -j PROXY_INBOUND_AUTH 2>/dev/null; then
+      ${IPT} -t nat -I PREROUTING 1 -p tcp -j PROXY_INBOUND_AUTH
+    fi
+  fi
+
+  # Inbound capture for the listed ports
+  if [ -n "${INBOUND_PORTS_INCLUDE}" ]; then
+    if [ "${INBOUND_PORTS_INCLUDE}" = "*" ]; then
+      INBOUND_MATCHES="all"
+    else
+      INBOUND_MATCHES=$(echo "${INBOUND_PORTS_INCLUDE}" | tr ',' ' ')
+    fi
+
+    if [ "${INTERCEPTION_MODE}" = "TPROXY" ]; then
+      ${IPT} -t mangle -N PROXY_INBOUND 2>/dev/null || true
+      ${IPT} -t mangle -F PROXY_INBOUND 2>/dev/null || true
+      # TPROXY runs before nat, so leave the inbound-auth port to the rule above
+      if [ -n "${INBOUND_AUTH_PORT}" ]; then
+        ${IPT} -t mangle -A PROXY_INBOUND -p tcp --dport "${INBOUND_AUTH_PORT}" -j RETURN
+      fi
+      for port in ${INBOUND_MATCHES}; do
+        if [ "${port}" = "all" ]; then
+          ${IPT} -t mangle -A PROXY_INBOUND -p tcp ! --dport "${INBOUND_PROXY_PORT}" \
+            -j TPROXY --tproxy-mark "${TPROXY_MARK}/0xffffffff" --on-port "${INBOUND_PROXY_PORT}"
+        else
+          ${IPT} -t mangle -A PROXY_INBOUND -p tcp --dport "${port}" \
+            -j TPROXY --tproxy-mark "${TPROXY_MARK}/0xffffffff" --on-port "${INBOUND_PROXY_PORT}"
+        fi
+      done
+      if ! ${IPT} -t mangle -C PREROUTING -p tcp -j PROXY_INBOUND 2>/dev/null; then
+        ${IPT} -t mangle -A PREROUTING -p tcp -j PROXY_INBOUND
+      fi
+      # Deliver marked packets locally so Envoy's transparent listener can accept them
+      ${IPCMD} rule add fwmark "${TPROXY_MARK}" lookup "${TPROXY_ROUTE_TABLE}" 2>/dev/null || true
+      if [ "${IPT}" = "ip6tables" ]; then
+        ${IPCMD} route add local ::/0 dev lo table "${TPROXY_ROUTE_TABLE}" 2>/dev/null || true
+      else
+        ${IPCMD} route add local default dev lo table "${TPROXY_ROUTE_TABLE}" 2>/dev/null || true
+      fi
+    else
+      ${IPT} -t nat -N PROXY_INBOUND 2>/dev/null || true
+      ${IPT} -t nat -F PROXY_INBOUND 2>/dev/null || true
+      for port in ${INBOUND_MATCHES}; do
+        if [ "${port}" = "all" ]; then
+          ${IPT} -t nat -A PROXY_INBOUND -p tcp ! --dport "${INBOUND_PROXY_PORT}" -j REDIRECT --to-port "${INBOUND_PROXY_PORT}"
+        else
+          ${IPT} -t nat -A PROXY_INBOUND -p tcp --dport "${port}" -j REDIRECT --to-port "${INBOUND_PROXY_PORT}"
+        fi
+      done
+      if ! ${IPT} -t nat -C PREROUTING -p tcp -j PROXY_INBOUND 2>/dev/null; then
+        ${IPT} -t nat -A PREROUTING -p tcp -j PROXY_INBOUND
+      fi
+    fi
+  fi
+
+  echo "${IPT} rules configured successfully"
+}
+
+case "${IP_FAMILIES}" in
+  auto)
+    CONFIGURE_IPV4=false
+    CONFIGURE_IPV6=false
+    has_ipv4 && CONFIGURE_IPV4=true
+    has_global_ipv6 && CONFIGURE_IPV6=true
+    # Never leave the pod unprotected if detection finds nothing
+    if [ "${CONFIGURE_IPV4}" = "false" ] && [ "${CONFIGURE_IPV6}" = "false" ]; then
+      CONFIGURE_IPV4=true
+    fi
+    ;;
+  ipv4) CONFIGURE_IPV4=true; CONFIGURE_IPV6=false ;;
+  ipv6) CONFIGURE_IPV4=false; CONFIGURE_IPV6=true ;;
+  dual) CONFIGURE_IPV4=true; CONFIGURE_IPV6=true ;;
+  *)
+    echo "Unsupported IP_FAMILIES ${IP_FAMILIES}, expected auto, ipv4, ipv6 or dual" >&2
+    exit 1
+    ;;
+esac
+
+echo "Configuring IP families: ipv4=${CONFIGURE_IPV4} ipv6=${CONFIGURE_IPV6} (IP_FAMILIES=${IP_FAMILIES})"
+
+if [ "${CONFIGURE_IPV4}" = "true" ]; then
+  configure_family iptables 127.0.0.1/32 "ip"
 fi
-
-# Redirect all other TCP traffic
-iptables -t nat -A PROXY_OUTPUT -p tcp -j PROXY_REDIRECT
-
-# Insert rule at the beginning of OUTPUT chain with higher priority than Istio rules
-# Check if rule already exists to avoid duplicates
-if ! iptables -t nat -C OUTPUT -p tcp -j PROXY_OUTPUT 2>/dev/null; then
-  iptables -t nat -I OUTPUT 1 -p tcp -j PROXY_OUTPUT
+if [ "${CONFIGURE_IPV6}" = "true" ]; then
+  configure_family ip6tables ::1/128 "ip -6"
 fi
 
-echo "iptables rules configured successfully"
 echo "Outbound traffic will be redirected to port ${PROXY_PORT}"
-echo "Inbound traffic will NOT be redirected"
+if [ -n "${INBOUND_PORTS_INCLUDE}" ]; then
+  echo "Inbound traffic to ports ${INBOUND_PORTS_INCLUDE} will be captured on port ${INBOUND_PROXY_PORT} (${INTERCEPTION_MODE})"
+else
+  echo "Inbound traffic will NOT be redirected"
+fi
+if [ -n "${INBOUND_AUTH_PORT}" ]; then
+  echo "Inbound traffic to port ${INBOUND_AUTH_PORT} will be redirected to inbound-auth on port ${INBOUND_AUTH_PROXY_PORT}"
+fi
 echo "Istio ztunnel compatibility enabled"
@@ -9,10 +9,9 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
 
-	"github.com/lestrrat-go/jwx/v2/jwk"
-	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/huang195/auth-proxy/pkg/inbound"
+	"github.com/huang195/auth-proxy/pkg/tokenval"
 )
 
 const (
@@ -20,7 +19,7 @@ const (
 	proxyPort               = "0.0.0.0:8080"
 )
 
-var jwksCache *jwk.Cache
+var validator *tokenval.Validator
 
 func main() {
 	targetServiceURL := os.Getenv("TARGET_SERVICE_URL")
@@ -46,15 +45,22 @@ func main() {
 		log.Printf("AUDIENCE not configured - accepting any valid token (transparent mode)")
 	}
 
-	// Initialize JWKS cache
-	ctx := context.Background()
-	jwksCache = jwk.NewCache(ctx)
-	if err := jwksCache.Register(jwksURL); err != nil {
-		log.Fatalf("Failed to register JWKS URL: %v", err)
+	// LEEWAY is the accepted clock skew on exp, nbf and iat
+	leeway, err := tokenval.ParseLeeway(os.Getenv("LEEWAY"))
+	if err != nil {
+		log.Fatalf("Invalid LEEWAY: %v", err)
+	}
+	opts := tokenval.Options{JWKSURL: jwksURL, Issuers: []string{issuer}, Leeway: leeway}
+	if audience != "" {
+		opts.Audiences = []string{audience}
+	}
+	validator, err = tokenval.New(context.Background(), opts)
+	if err != nil {
+		log.Fatalf("Failed to set up token validation: %v", err)
 	}
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		proxyHandler(w, r, targetServiceURL, jwksURL, issuer, audience)
+		proxyHandler(w, r, targetServiceURL, audience)
 	})
 	log.Printf("Auth proxy starting on port %s", proxyPort)
 	log.Printf("JWKS URL: %s", jwksURL)
@@ -68,39 +74,14 @@ func main() {
 	log.Fatal(http.ListenAndServe(proxyPort, nil))
 }
 
-func validateJWT(tokenString, jwksURL, expectedIssuer, expectedAudience string) error {
-	ctx := context.Background()
-
-	// Fetch JWKS from cache
-	keySet, err := jwksCache.Get(ctx, jwksURL)
-	if err != nil {
-		return fmt.Errorf("failed to fetch JWKS: %w", err)
-	}
-
-	// Parse and validate the token
-	token, err := jwt.Parse([]byte(tokenString), jwt.WithKeySet(keySet), jwt.WithValidate(true))
+func validateJWT(tokenString, expectedAudience string) error {
+	token, err := validator.Validate(context.Background(), tokenString)
 	if err != nil {
-		return fmt.Errorf("failed to parse/validate token: %w", err)
+		return err
 	}
 
-	// Validate issuer claim
-	if token.Issuer() != expectedIssuer {
-		return fmt.Errorf("invalid issuer: expected %s, got %s", expectedIssuer, token.Issuer())
-	}
-
-	// Validate audience claim (only if expectedAudience is configured)
 	audiences := token.Audience()
 	if expectedAudience != "" {
-		validAudience := false
-		for _, aud := range audiences {
-			if aud == expectedAudience {
-				validAudience = true
-				break
-			}
-		}
-		if !validAudience {
-			return fmt.Errorf("invalid audience: expected %s, got %v", expectedAudience, audiences)
-		}
 		log.Printf("[JWT Debug] Audience validated: %s", expectedAudience)
 	} else {
 		log.Printf("[JWT Debug] Audience validation skipped (transparent mode)")
@@ -121,27 +102,10 @@ func validateJWT(tokenString, jwksURL, expectedIssuer, expectedAudience string)
 	return nil
 }
 
-func proxyHandler(w http.ResponseWriter, r *http.Request, targetServiceURL, jwksURL, issuer, audience string) {
-	// Extract and validate JWT token
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
-		log.Printf("Unauthorized request (missing auth header): %s %s", r.Method, r.URL.Path)
-		return
-	}
-
-	// Extract token from "Bearer <token>" format
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
-		http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
-		log.Printf("Unauthorized request (invalid auth format): %s %s", r.Method, r.URL.Path)
-		return
-	}
-
-	// Validate JWT
-	if err := validateJWT(tokenString, jwksURL, issuer, audience); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
-		log.Printf("Unauthorized request (invalid token): %s %s - %v", r.Method, r.URL.Path, err)
+func proxyHandler(w http.ResponseWriter, r *http.Request, targetServiceURL, audience string) {
+	// Browsers send CORS preflight requests without credentials; the target service
+	// answers them with its CORS policy
+	if !inbound.IsCORSPreflight(r) && !authorized(w, r, audience) {
 		return
 	}
 
@@ -195,3 +159,23 @@ func proxyHandler(w http.ResponseWriter, r *http.Request, targetServiceURL, jwks
 
 	log.Printf("Forwarded %s %s - Status: %d", r.Method, r.URL.Path, resp.StatusCode)
 }
+
+// authorized validates the request's bearer token and answers 401 when it is missing or
+// invalid
+func authorized(w http.ResponseWriter, r *http.Request, audience string) bool {
+	// Extract token from "Bearer <token>" format
+	tokenString, err := inbound.BearerToken(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		log.Printf("Unauthorized request (%v): %s %s", err, r.Method, r.URL.Path)
+		return false
+	}
+
+	// Validate JWT
+	if err := validateJWT(tokenString, audience); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+		log.Printf("Unauthorized request (invalid token): %s %s - %v", r.Method, r.URL.Path, err)
+		return false
+	}
+	return true
+}
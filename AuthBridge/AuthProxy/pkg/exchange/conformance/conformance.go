@@ -0,0 +1,267 @@
+// Package conformance runs the same RFC 8693 scenarios against any TokenExchanger and the
+// identity provider behind it: exchanges by audience and by resource, delegation with an
+// actor token, and the error responses of section 2.2.2.
+package conformance
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+// Scenario names, the keys of Target.ErrorCodes
+const (
+	InvalidSubjectToken   = "invalid subject token"
+	MissingSubjectToken   = "missing subject token"
+	UnsupportedTokenType  = "unsupported subject token type"
+	UnknownAudience       = "unknown audience"
+	UnauthenticatedClient = "unauthenticated client"
+)
+
+// rfcErrorCodes are the error codes RFC 8693 and RFC 6749 prescribe for each scenario
+var rfcErrorCodes = map[string][]string{
+	InvalidSubjectToken:   {"invalid_request"},
+	MissingSubjectToken:   {"invalid_request"},
+	UnsupportedTokenType:  {"invalid_request"},
+	UnknownAudience:       {"invalid_target"},
+	UnauthenticatedClient: {"invalid_client"},
+}
+
+// Target describes the provider under test. Scenarios whose inputs are missing are skipped.
+type Target struct {
+	// Exchanger is authenticated as a client allowed to exchange the subject tokens
+	Exchanger exchange.TokenExchanger
+	// Unauthenticated is the same client with wrong credentials
+	Unauthenticated exchange.TokenExchanger
+	// SubjectToken returns a fresh token the client may exchange
+	SubjectToken func(t *testing.T) string
+	// Audience is a target the client may exchange for
+	Audience string
+	// Scope is requested with the audience exchange, if set
+	Scope string
+	// Resource is a target URI the client may exchange for
+	Resource string
+	// ActorToken returns a token identifying the client as the actor
+	ActorToken func(t *testing.T) string
+	// UnknownAudience is a target the provider does not know
+	UnknownAudience string
+	// ErrorCodes adds error codes accepted for a scenario, for known provider deviations
+	ErrorCodes map[string][]string
+}
+
+// Run runs every scenario as a subtest
+func Run(t *testing.T, target Target) {
+	t.Run("audience", func(t *testing.T) {
+		subjectToken := target.SubjectToken(t)
+		resp := exchangeOK(t, target.Exchanger, exchange.Request{
+			SubjectToken: subjectToken,
+			Audience:     []string{target.Audience},
+			Scope:        target.Scope,
+		})
+		claims := decode(t, resp.AccessToken)
+		if !slices.Contains(audiences(claims), target.Audience) {
+			t.Errorf("aud = %v, want it to contain %q", claims["aud"], target.Audience)
+		}
+		if got, want := claims["sub"], decode(t, subjectToken)["sub"]; got != want {
+			t.Errorf("sub = %v, want the subject token's %v", got, want)
+		}
+		if exp, ok := claims["exp"].(float64); !ok || time.Unix(int64(exp), 0).Before(time.Now()) {
+			t.Errorf("exp = %v, want a time in the future", claims["exp"])
+		}
+		if target.Scope != "" {
+			for _, scope := range strings.Fields(target.Scope) {
+				if !slices.Contains(strings.Fields(resp.Scope+" "+stringClaim(claims, "scope")), scope) {
+					t.Errorf("scope %q was not granted, got %q", scope, resp.Scope)
+				}
+			}
+		}
+	})
+
+	t.Run("resource", func(t *testing.T) {
+		if target.Resource == "" {
+			t.Skip("the target has no resource URI")
+		}
+		resp := exchangeOK(t, target.Exchanger, exchange.Request{
+			SubjectToken: target.SubjectToken(t),
+			Resource:     []string{target.Resource},
+		})
+		if len(audiences(decode(t, resp.AccessToken))) == 0 {
+			t.Error("the issued token names no audience")
+		}
+	})
+
+	t.Run("delegation", func(t *testing.T) {
+		if target.ActorToken == nil {
+			t.Skip("the target has no actor token")
+		}
+		actorToken := target.ActorToken(t)
+		resp := exchangeOK(t, target.Exchanger, exchange.Request{
+			SubjectToken: target.SubjectToken(t),
+			ActorToken:   actorToken,
+			Audience:     []string{target.Audience},
+		})
+		act, ok := decode(t, resp.AccessToken)["act"].(map[string]any)
+		if !ok {
+			t.Fatal("the issued token has no act claim")
+		}
+		if got, want := act["sub"], decode(t, actorToken)["sub"]; got != want {
+			t.Errorf("act.sub = %v, want the actor token's %v", got, want)
+		}
+
+		// exchanging the delegated token again nests the previous actor
+		resp = exchangeOK(t, target.Exchanger, exchange.Request{
+			SubjectToken: resp.AccessToken,
+			ActorToken:   actorToken,
+			Audience:     []string{target.Audience},
+		})
+		act, _ = decode(t, resp.AccessToken)["act"].(map[string]any)
+		if _, ok := act["act"].(map[string]any); !ok {
+			t.Errorf("act = %v, want the previous actor nested in act.act", act)
+		}
+	})
+
+	errorCases := []struct {
+		name      string
+		exchanger exchange.TokenExchanger
+		request   func(t *testing.T) exchange.Request
+		skip      string
+	}{
+		{
+			name:      InvalidSubjectToken,
+			exchanger: target.Exchanger,
+			request: func(t *testing.T) exchange.Request {
+				return exchange.Request{SubjectToken: "not-a-token", Audience: []string{target.Audience}}
+			},
+		},
+		{
+			name:      MissingSubjectToken,
+			exchanger: target.Exchanger,
+			request: func(t *testing.T) exchange.Request {
+				return exchange.Request{Audience: []string{target.Audience}}
+			},
+		},
+		{
+			name:      UnsupportedTokenType,
+			exchanger: target.Exchanger,
+			request: func(t *testing.T) exchange.Request {
+				return exchange.Request{
+					SubjectToken:     target.SubjectToken(t),
+					SubjectTokenType: "urn:example:token-type:unknown",
+					Audience:         []string{target.Audience},
+				}
+			},
+		},
+		{
+			name:      UnknownAudience,
+			exchanger: target.Exchanger,
+			request: func(t *testing.T) exchange.Request {
+				return exchange.Request{SubjectToken: target.SubjectToken(t), Audience: []string{target.UnknownAudience}}
+			},
+			skip: skipIf(target.UnknownAudience == "", "the target has no unknown audience"),
+		},
+		{
+			name:      UnauthenticatedClient,
+			exchanger: target.Unauthenticated,
+			request: func(t *testing.T) exchange.Request {
+				return exchange.Request{SubjectToken: target.SubjectToken(t), Audience: []string{target.Audience}}
+			},
+			skip: skipIf(target.Unauthenticated == nil, "the target has no unauthenticated client"),
+		},
+	}
+	for _, tc := range errorCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.skip != "" {
+				t.Skip(tc.skip)
+			}
+			accepted := append(slices.Clone(rfcErrorCodes[tc.name]), target.ErrorCodes[tc.name]...)
+			exchangeError(t, tc.exchanger, tc.request(t), accepted)
+		})
+	}
+}
+
+func exchangeOK(t *testing.T, exchanger exchange.TokenExchanger, req exchange.Request) *exchange.Response {
+	t.Helper()
+	resp, err := exchanger.Exchange(context.Background(), req)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if resp.IssuedTokenType != exchange.AccessTokenType {
+		t.Errorf("issued_token_type = %q, want %q", resp.IssuedTokenType, exchange.AccessTokenType)
+	}
+	if !strings.EqualFold(resp.TokenType, "Bearer") {
+		t.Errorf("token_type = %q, want Bearer", resp.TokenType)
+	}
+	return resp
+}
+
+func exchangeError(t *testing.T, exchanger exchange.TokenExchanger, req exchange.Request, codes []string) {
+	t.Helper()
+	resp, err := exchanger.Exchange(context.Background(), req)
+	if err == nil {
+		t.Fatalf("exchange succeeded with issued_token_type %q, want an error %v", resp.IssuedTokenType, codes)
+	}
+	var exchangeErr *exchange.Error
+	if !errors.As(err, &exchangeErr) {
+		t.Fatalf("exchange failed with %v, want an error response", err)
+	}
+	if exchangeErr.Status != 400 && exchangeErr.Status != 401 {
+		t.Errorf("status = %d, want 400 or 401", exchangeErr.Status)
+	}
+	if !slices.Contains(codes, exchangeErr.Code) {
+		t.Errorf("error = %q, want one of %v", exchangeErr.Code, codes)
+	}
+}
+
+// decode returns the claims of a JWT without verifying it
+func decode(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("failed to decode token payload: %v", err)
+	}
+	claims := map[string]any{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatalf("failed to parse token payload: %v", err)
+	}
+	return claims
+}
+
+// audiences returns the aud claim, a string or a list
+func audiences(claims map[string]any) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var values []string
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func stringClaim(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func skipIf(condition bool, reason string) string {
+	if condition {
+		return reason
+	}
+	return ""
+}
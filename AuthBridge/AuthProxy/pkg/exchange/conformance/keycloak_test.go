@@ -0,0 +1,66 @@
+package conformance_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+	"github.com/huang195/auth-proxy/pkg/exchange/conformance"
+)
+
+// TestKeycloak runs the suite against a Keycloak realm with standard token exchange
+// enabled for the client. It needs KEYCLOAK_TOKEN_URL, KEYCLOAK_CLIENT_ID,
+// KEYCLOAK_CLIENT_SECRET, KEYCLOAK_AUDIENCE, KEYCLOAK_USERNAME and KEYCLOAK_PASSWORD;
+// the user's tokens must name the client in their audience.
+func TestKeycloak(t *testing.T) {
+	tokenURL := os.Getenv("KEYCLOAK_TOKEN_URL")
+	if tokenURL == "" {
+		t.Skip("KEYCLOAK_TOKEN_URL is not set")
+	}
+	clientID, secret := os.Getenv("KEYCLOAK_CLIENT_ID"), os.Getenv("KEYCLOAK_CLIENT_SECRET")
+
+	conformance.Run(t, conformance.Target{
+		Exchanger:       &exchange.Client{TokenURL: tokenURL, ClientID: clientID, ClientSecret: secret},
+		Unauthenticated: &exchange.Client{TokenURL: tokenURL, ClientID: clientID, ClientSecret: "wrong"},
+		SubjectToken: func(t *testing.T) string {
+			return passwordToken(t, tokenURL, clientID, secret, os.Getenv("KEYCLOAK_USERNAME"), os.Getenv("KEYCLOAK_PASSWORD"))
+		},
+		Audience:        os.Getenv("KEYCLOAK_AUDIENCE"),
+		UnknownAudience: "conformance-unknown-audience",
+		// Keycloak reports an invalid subject token as invalid_token and an unknown
+		// audience as a client error
+		ErrorCodes: map[string][]string{
+			conformance.InvalidSubjectToken: {"invalid_token"},
+			conformance.UnknownAudience:     {"invalid_client", "invalid_request"},
+		},
+	})
+}
+
+func passwordToken(t *testing.T, tokenURL, clientID, secret, username, password string) string {
+	t.Helper()
+	resp, err := http.PostForm(tokenURL, url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"username":      {username},
+		"password":      {password},
+		"scope":         {"openid"},
+	})
+	if err != nil {
+		t.Fatalf("failed to request a subject token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("password grant failed with status %d", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatalf("failed to parse the token response: %v", err)
+	}
+	return token.AccessToken
+}
@@ -0,0 +1,77 @@
+package conformance_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+	"github.com/huang195/auth-proxy/pkg/exchange/conformance"
+	"github.com/huang195/auth-proxy/pkg/exchange/exchangetest"
+)
+
+func TestMockIdP(t *testing.T) {
+	idp := exchangetest.NewIdP()
+	defer idp.Close()
+
+	secret := exchangetest.RandomSecret()
+	idp.AddClient("agent", secret)
+	idp.AddAudience("auth-target")
+	idp.AddResource("https://auth-target.example.com", "auth-target")
+
+	conformance.Run(t, conformance.Target{
+		Exchanger:       &exchange.Client{TokenURL: idp.TokenURL(), ClientID: "agent", ClientSecret: secret},
+		Unauthenticated: &exchange.Client{TokenURL: idp.TokenURL(), ClientID: "agent", ClientSecret: "wrong"},
+		SubjectToken: func(t *testing.T) string {
+			return idp.Issue("alice", "agent")
+		},
+		Audience:        "auth-target",
+		Scope:           "auth-target-aud",
+		Resource:        "https://auth-target.example.com",
+		ActorToken:      func(t *testing.T) string { return idp.Issue("agent", "agent") },
+		UnknownAudience: "unknown-service",
+	})
+}
+
+func TestMockIdPMutualTLS(t *testing.T) {
+	idp := exchangetest.NewMutualTLSIdP()
+	defer idp.Close()
+
+	cert, err := exchangetest.NewCertificate("agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := exchangetest.NewCertificate("agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.AddCertificateClient("agent", cert.Leaf)
+	idp.AddAudience("auth-target")
+
+	exchanger := &exchange.Client{TokenURL: idp.TokenURL(), ClientID: "agent", AuthMethod: exchange.TLSClientAuth, HTTPClient: idp.HTTPClient(&cert)}
+	conformance.Run(t, conformance.Target{
+		Exchanger:       exchanger,
+		Unauthenticated: &exchange.Client{TokenURL: idp.TokenURL(), ClientID: "agent", AuthMethod: exchange.TLSClientAuth, HTTPClient: idp.HTTPClient(&other)},
+		SubjectToken: func(t *testing.T) string {
+			return idp.Issue("alice", "agent")
+		},
+		Audience:        "auth-target",
+		UnknownAudience: "unknown-service",
+	})
+
+	t.Run("certificate-bound token", func(t *testing.T) {
+		resp, err := exchanger.Exchange(context.Background(), exchange.Request{SubjectToken: idp.Issue("alice", "agent"), Audience: []string{"auth-target"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := jwt.ParseInsecure([]byte(resp.AccessToken))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cnf, _ := token.Get("cnf")
+		if bound, _ := cnf.(map[string]any)[exchange.ThumbprintClaim].(string); bound != exchange.Thumbprint(cert.Leaf) {
+			t.Errorf("cnf = %v, want the thumbprint of the client certificate", cnf)
+		}
+	})
+}
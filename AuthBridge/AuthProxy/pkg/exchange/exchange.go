@@ -0,0 +1,191 @@
+// Package exchange performs OAuth 2.0 Token Exchange (RFC 8693). TokenExchanger is the
+// seam between AuthBridge and an identity provider; the conformance package verifies
+// implementations against the same scenarios.
+package exchange
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Grant and token type identifiers of RFC 8693
+const (
+	GrantType       = "urn:ietf:params:oauth:grant-type:token-exchange"
+	AccessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+	JWTTokenType    = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Client authentication methods at the token endpoint
+const (
+	// ClientSecretPost sends client_id and client_secret in the form
+	ClientSecretPost = "client_secret_post"
+	// TLSClientAuth authenticates with a CA-issued TLS client certificate, e.g. an X.509
+	// SVID, and sends only client_id (RFC 8705 section 2.1)
+	TLSClientAuth = "tls_client_auth"
+	// SelfSignedTLSClientAuth authenticates with a self-signed TLS client certificate
+	// registered with the client (RFC 8705 section 2.2)
+	SelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+)
+
+// ThumbprintClaim is the member of the cnf claim that binds a token to a certificate
+const ThumbprintClaim = "x5t#S256"
+
+// RequestIDHeader carries the request ID to the token endpoint, for correlating its logs
+const RequestIDHeader = "X-Request-Id"
+
+// Request is a token exchange request; empty fields are not sent
+type Request struct {
+	SubjectToken string
+	// SubjectTokenType defaults to AccessTokenType
+	SubjectTokenType string
+	ActorToken       string
+	ActorTokenType   string
+	// Audience names the logical target services, Resource their URIs
+	Audience []string
+	Resource []string
+	Scope    string
+	// RequestedTokenType defaults to AccessTokenType
+	RequestedTokenType string
+	RequestID          string
+	// Params are additional form parameters, e.g. IdP-specific claim requests; they never
+	// replace a parameter the request already sets
+	Params map[string]string
+}
+
+// Response is a successful token exchange response
+type Response struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	Scope           string `json:"scope"`
+}
+
+// Error is an error response of the token endpoint (RFC 6749 section 5.2)
+type Error struct {
+	Status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("token exchange failed with status %d: %s", e.Status, e.Code)
+	}
+	return fmt.Sprintf("token exchange failed with status %d: %s: %s", e.Status, e.Code, e.Description)
+}
+
+// TokenExchanger exchanges a subject token for a token for another audience
+type TokenExchanger interface {
+	Exchange(ctx context.Context, req Request) (*Response, error)
+}
+
+// Client is a TokenExchanger for token endpoints that follow RFC 8693
+type Client struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// AuthMethod defaults to ClientSecretPost. With the TLS methods, HTTPClient presents
+	// the client certificate and ClientSecret is not sent; the IdP may then bind the
+	// issued token to the certificate.
+	AuthMethod string
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+var _ TokenExchanger = &Client{}
+
+// Exchange sends the request; token endpoint errors are returned as *Error
+func (c *Client) Exchange(ctx context.Context, req Request) (*Response, error) {
+	data := url.Values{}
+	data.Set("client_id", c.ClientID)
+	if !MutualTLS(c.AuthMethod) {
+		data.Set("client_secret", c.ClientSecret)
+	}
+	data.Set("grant_type", GrantType)
+	data.Set("requested_token_type", valueOr(req.RequestedTokenType, AccessTokenType))
+	data.Set("subject_token", req.SubjectToken)
+	data.Set("subject_token_type", valueOr(req.SubjectTokenType, AccessTokenType))
+	for _, audience := range req.Audience {
+		data.Add("audience", audience)
+	}
+	for _, resource := range req.Resource {
+		data.Add("resource", resource)
+	}
+	if req.Scope != "" {
+		data.Set("scope", req.Scope)
+	}
+	if req.ActorToken != "" {
+		data.Set("actor_token", req.ActorToken)
+		data.Set("actor_token_type", valueOr(req.ActorTokenType, AccessTokenType))
+	}
+	for name, value := range req.Params {
+		if !data.Has(name) {
+			data.Set(name, value)
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if req.RequestID != "" {
+		httpReq.Header.Set(RequestIDHeader, req.RequestID)
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		exchangeErr := &Error{Status: resp.StatusCode}
+		if err := json.Unmarshal(body, exchangeErr); err != nil || exchangeErr.Code == "" {
+			exchangeErr.Description = string(body)
+		}
+		return nil, exchangeErr
+	}
+	var result Response
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("response has no access_token")
+	}
+	return &result, nil
+}
+
+// MutualTLS reports whether the authentication method uses the TLS client certificate
+func MutualTLS(authMethod string) bool {
+	return authMethod == TLSClientAuth || authMethod == SelfSignedTLSClientAuth
+}
+
+// Thumbprint is the x5t#S256 confirmation of a certificate-bound token (RFC 8705 section 3.1)
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
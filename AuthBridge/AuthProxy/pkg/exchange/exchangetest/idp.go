@@ -0,0 +1,333 @@
+// Package exchangetest provides an in-memory identity provider whose token endpoint
+// implements RFC 8693, for testing TokenExchanger clients and the conformance suite.
+package exchangetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/exchange"
+)
+
+// TokenLifetime is the lifetime of every token the IdP issues
+const TokenLifetime = 5 * time.Minute
+
+// IdP is a token endpoint that signs tokens with an HMAC key. It accepts the audiences
+// and resource URIs registered with it and nests act claims for delegation.
+type IdP struct {
+	server *httptest.Server
+	key    []byte
+
+	mu        sync.Mutex
+	clients   map[string]string
+	audiences map[string]bool
+	resources map[string]string
+	latency   time.Duration
+	// certificateClients maps the clients authenticating with tls_client_auth to the
+	// thumbprint of their certificate
+	certificateClients map[string]string
+}
+
+// NewIdP starts the IdP; Close stops it
+func NewIdP() *IdP {
+	idp := newIdP()
+	idp.server = httptest.NewServer(http.HandlerFunc(idp.serveToken))
+	return idp
+}
+
+// NewMutualTLSIdP starts the IdP on HTTPS, requesting a client certificate on every
+// connection for the clients added with AddCertificateClient; Close stops it
+func NewMutualTLSIdP() *IdP {
+	idp := newIdP()
+	idp.server = httptest.NewUnstartedServer(http.HandlerFunc(idp.serveToken))
+	idp.server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	idp.server.StartTLS()
+	return idp
+}
+
+func newIdP() *IdP {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return &IdP{
+		key:                key,
+		clients:            map[string]string{},
+		audiences:          map[string]bool{},
+		resources:          map[string]string{},
+		certificateClients: map[string]string{},
+	}
+}
+
+// Close stops the token endpoint
+func (i *IdP) Close() {
+	i.server.Close()
+}
+
+// Issuer is the iss claim of the issued tokens
+func (i *IdP) Issuer() string {
+	return i.server.URL
+}
+
+// TokenURL is the token endpoint
+func (i *IdP) TokenURL() string {
+	return i.server.URL + "/token"
+}
+
+// AddClient registers a confidential client
+func (i *IdP) AddClient(id, secret string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.clients[id] = secret
+}
+
+// AddCertificateClient registers a client that authenticates with the certificate
+// (tls_client_auth); the tokens it obtains are bound to the certificate
+func (i *IdP) AddCertificateClient(id string, cert *x509.Certificate) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.certificateClients[id] = exchange.Thumbprint(cert)
+}
+
+// HTTPClient trusts the IdP's server certificate and presents cert, if not nil
+func (i *IdP) HTTPClient(cert *tls.Certificate) *http.Client {
+	client := i.server.Client()
+	if cert != nil {
+		transport := client.Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		client = &http.Client{Transport: transport}
+	}
+	return client
+}
+
+// AddAudience registers a target audience
+func (i *IdP) AddAudience(audience string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.audiences[audience] = true
+}
+
+// AddResource registers a resource URI that exchanges to audience
+func (i *IdP) AddResource(uri, audience string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.resources[uri] = audience
+}
+
+// SetLatency delays every token endpoint response, to model a remote IdP
+func (i *IdP) SetLatency(latency time.Duration) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.latency = latency
+}
+
+// Issue signs a token for subject, as if obtained by a regular grant
+func (i *IdP) Issue(subject string, audience ...string) string {
+	token, err := i.sign(subject, audience, "", nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+func (i *IdP) sign(subject string, audience []string, scope string, act, cnf map[string]any) (string, error) {
+	builder := jwt.NewBuilder().
+		Issuer(i.Issuer()).
+		Subject(subject).
+		Audience(audience).
+		IssuedAt(time.Now()).
+		Expiration(time.Now().Add(TokenLifetime))
+	if scope != "" {
+		builder = builder.Claim("scope", scope)
+	}
+	if act != nil {
+		builder = builder.Claim("act", act)
+	}
+	if cnf != nil {
+		builder = builder.Claim("cnf", cnf)
+	}
+	token, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, i.key))
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+func (i *IdP) parse(token string) (jwt.Token, error) {
+	return jwt.Parse([]byte(token), jwt.WithKey(jwa.HS256, i.key), jwt.WithValidate(true), jwt.WithIssuer(i.Issuer()))
+}
+
+func (i *IdP) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/token" {
+		http.NotFound(w, r)
+		return
+	}
+	i.mu.Lock()
+	latency := i.latency
+	i.mu.Unlock()
+	time.Sleep(latency)
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed form")
+		return
+	}
+	if r.PostForm.Get("grant_type") != exchange.GrantType {
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	i.mu.Lock()
+	expected, known := i.clients[clientID]
+	thumbprint, certificateClient := i.certificateClients[clientID]
+	i.mu.Unlock()
+	var cnf map[string]any
+	if certificateClient {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || exchange.Thumbprint(r.TLS.PeerCertificates[0]) != thumbprint {
+			writeError(w, http.StatusUnauthorized, "invalid_client", "client certificate authentication failed")
+			return
+		}
+		// certificate-bound access token (RFC 8705 section 3)
+		cnf = map[string]any{exchange.ThumbprintClaim: thumbprint}
+	} else if !known || expected != secret {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	if r.PostForm.Get("subject_token") == "" || r.PostForm.Get("subject_token_type") == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "subject_token and subject_token_type are required")
+		return
+	}
+	if !supportedTokenType(r.PostForm.Get("subject_token_type")) {
+		writeError(w, http.StatusBadRequest, "invalid_request", "unsupported subject_token_type")
+		return
+	}
+	subject, err := i.parse(r.PostForm.Get("subject_token"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "invalid subject_token")
+		return
+	}
+
+	audiences, ok := i.targets(r.PostForm["audience"], r.PostForm["resource"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_target", "unknown audience or resource")
+		return
+	}
+	if len(audiences) == 0 {
+		audiences = []string{clientID}
+	}
+
+	var act map[string]any
+	if actorToken := r.PostForm.Get("actor_token"); actorToken != "" {
+		if !supportedTokenType(r.PostForm.Get("actor_token_type")) {
+			writeError(w, http.StatusBadRequest, "invalid_request", "actor_token_type is missing or unsupported")
+			return
+		}
+		actor, err := i.parse(actorToken)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_request", "invalid actor_token")
+			return
+		}
+		act = map[string]any{"sub": actor.Subject()}
+		if previous, ok := subject.Get("act"); ok {
+			act["act"] = previous
+		}
+	}
+
+	issued, err := i.sign(subject.Subject(), audiences, r.PostForm.Get("scope"), act, cnf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(exchange.Response{
+		AccessToken:     issued,
+		IssuedTokenType: exchange.AccessTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int(TokenLifetime.Seconds()),
+		Scope:           r.PostForm.Get("scope"),
+	})
+}
+
+// targets resolves the requested audiences and resources to audiences
+func (i *IdP) targets(audiences, resources []string) ([]string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var resolved []string
+	for _, audience := range audiences {
+		if !i.audiences[audience] {
+			return nil, false
+		}
+		resolved = append(resolved, audience)
+	}
+	for _, resource := range resources {
+		audience, ok := i.resources[resource]
+		if !ok {
+			return nil, false
+		}
+		resolved = append(resolved, audience)
+	}
+	return resolved, true
+}
+
+func supportedTokenType(tokenType string) bool {
+	return tokenType == exchange.AccessTokenType || tokenType == exchange.JWTTokenType
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+// NewCertificate returns a self-signed client certificate with its key
+func NewCertificate(commonName string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// RandomSecret returns a client secret
+func RandomSecret() string {
+	secret := make([]byte, 18)
+	_, _ = rand.Read(secret)
+	return base64.RawURLEncoding.EncodeToString(secret)
+}
@@ -0,0 +1,202 @@
+// Package extprocload drives an ext_proc server the way Envoy does: one stream per HTTP
+// request, carrying a realistic request header set, from many concurrent workers. It
+// measures the latency each request spends in the processor.
+package extprocload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	v3 "github.com/envoyproxy/go-control-plane/envoy/service/ext_proc/v3"
+)
+
+// Config describes a load run
+type Config struct {
+	Client v3.ExternalProcessorClient
+	// Streams is the number of concurrent workers, each with one stream open at a time
+	Streams int
+	// Requests is the total number of requests
+	Requests int
+	// Token returns the bearer token of a request; nil sends requests without one
+	Token func() string
+}
+
+// Result summarizes a load run. Latencies cover opening the stream, sending the request
+// headers and receiving the processor's response.
+type Result struct {
+	Requests int
+	Errors   int
+	// Exchanged counts responses that replaced the Authorization header
+	Exchanged int
+	// Denied counts immediate responses
+	Denied   int
+	Duration time.Duration
+	P50      time.Duration
+	P90      time.Duration
+	P99      time.Duration
+	Max      time.Duration
+}
+
+// Throughput is the number of requests per second
+func (r Result) Throughput() float64 {
+	if r.Duration == 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("requests=%d errors=%d exchanged=%d denied=%d duration=%s throughput=%.0f/s p50=%s p90=%s p99=%s max=%s",
+		r.Requests, r.Errors, r.Exchanged, r.Denied, r.Duration.Round(time.Millisecond), r.Throughput(), r.P50, r.P90, r.P99, r.Max)
+}
+
+// Run sends cfg.Requests requests from cfg.Streams workers and waits for all of them
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	if cfg.Client == nil {
+		return Result{}, fmt.Errorf("a client is required")
+	}
+	if cfg.Streams <= 0 {
+		cfg.Streams = 1
+	}
+
+	var next atomic.Int64
+	var failures, exchanged, denied atomic.Int64
+	latencies := make([]time.Duration, cfg.Requests)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range cfg.Streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= cfg.Requests || ctx.Err() != nil {
+					return
+				}
+				token := ""
+				if cfg.Token != nil {
+					token = cfg.Token()
+				}
+				began := time.Now()
+				resp, err := send(ctx, cfg.Client, Headers(i, token))
+				latencies[i] = time.Since(began)
+				switch {
+				case err != nil:
+					failures.Add(1)
+				case resp.GetImmediateResponse() != nil:
+					denied.Add(1)
+				case replacesAuthorization(resp):
+					exchanged.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := Result{
+		Requests:  cfg.Requests,
+		Errors:    int(failures.Load()),
+		Exchanged: int(exchanged.Load()),
+		Denied:    int(denied.Load()),
+		Duration:  time.Since(start),
+	}
+	slices.Sort(latencies)
+	result.P50 = percentile(latencies, 0.50)
+	result.P90 = percentile(latencies, 0.90)
+	result.P99 = percentile(latencies, 0.99)
+	if len(latencies) > 0 {
+		result.Max = latencies[len(latencies)-1]
+	}
+	return result, ctx.Err()
+}
+
+// send processes the request headers of one HTTP request on a new stream
+func send(ctx context.Context, client v3.ExternalProcessorClient, headers *core.HeaderMap) (*v3.ProcessingResponse, error) {
+	stream, err := client.Process(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stream.CloseSend() }()
+	err = stream.Send(&v3.ProcessingRequest{
+		Request: &v3.ProcessingRequest_RequestHeaders{
+			RequestHeaders: &v3.HttpHeaders{Headers: headers, EndOfStream: true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stream.Recv()
+}
+
+// requestShapes are the request lines the header sets rotate through: agent API calls,
+// MCP messages and health checks
+var requestShapes = []struct {
+	method, path, contentType string
+}{
+	{"GET", "/api/v1/items?limit=50", ""},
+	{"POST", "/api/v1/items", "application/json"},
+	{"POST", "/mcp", "application/json"},
+	{"GET", "/api/v1/items/42", ""},
+	{"GET", "/healthz", ""},
+}
+
+// Headers returns the header set of request i: pseudo-headers, the headers Envoy adds
+// and the caller's usual headers, with a unique request ID and trace context
+func Headers(i int, token string) *core.HeaderMap {
+	shape := requestShapes[i%len(requestShapes)]
+	headers := []*core.HeaderValue{
+		header(":method", shape.method),
+		header(":scheme", "http"),
+		header(":authority", "auth-target-service.team1.svc.cluster.local:8081"),
+		header(":path", shape.path),
+		header("user-agent", "python-httpx/0.27.0"),
+		header("accept", "application/json, text/event-stream"),
+		header("accept-encoding", "gzip, deflate"),
+		header("x-forwarded-proto", "http"),
+		header("x-request-id", randomHex(16)),
+		header("traceparent", "00-"+randomHex(16)+"-"+randomHex(8)+"-01"),
+		header("x-envoy-expected-rq-timeout-ms", "15000"),
+	}
+	if shape.contentType != "" {
+		headers = append(headers, header("content-type", shape.contentType), header("content-length", "187"))
+	}
+	if token != "" {
+		headers = append(headers, header("authorization", "Bearer "+token))
+	}
+	return &core.HeaderMap{Headers: headers}
+}
+
+func header(key, value string) *core.HeaderValue {
+	return &core.HeaderValue{Key: key, RawValue: []byte(value)}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func replacesAuthorization(resp *v3.ProcessingResponse) bool {
+	for _, option := range resp.GetRequestHeaders().GetResponse().GetHeaderMutation().GetSetHeaders() {
+		if option.GetHeader().GetKey() == "authorization" {
+			return true
+		}
+	}
+	return false
+}
+
+// percentile returns the p-th quantile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(float64(len(sorted))*p+0.5) - 1
+	return sorted[max(0, min(index, len(sorted)-1))]
+}
@@ -0,0 +1,182 @@
+// Package inbound authenticates incoming HTTP requests with bearer JWTs before they reach
+// an application, for applications that cannot validate tokens themselves. It is the
+// validation of the demo app as a library: the token must pass tokenval and, when
+// configured, name the expected actor in its act claim (RFC 8693).
+package inbound
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+// Identity headers set on authenticated requests. Incoming values are removed first, so the
+// application can trust them.
+const (
+	UserHeader              = "X-Auth-Request-User"
+	PreferredUsernameHeader = "X-Auth-Request-Preferred-Username"
+	EmailHeader             = "X-Auth-Request-Email"
+)
+
+var (
+	// ErrMissingAuthorization is returned for requests without an Authorization header
+	ErrMissingAuthorization = errors.New("missing Authorization header")
+	// ErrInvalidAuthorization is returned for an Authorization header that is not a bearer token
+	ErrInvalidAuthorization = errors.New("invalid Authorization header format")
+)
+
+// BearerToken returns the token of the request's "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", ErrMissingAuthorization
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	if token == header || token == "" {
+		return "", ErrInvalidAuthorization
+	}
+	return token, nil
+}
+
+// ActorChain lists the actors of the token's nested act claims (RFC 8693), the current
+// actor first
+func ActorChain(token jwt.Token) []string {
+	actors := []string{}
+	claim, _ := token.Get("act")
+	act, _ := claim.(map[string]any)
+	for act != nil {
+		actor, _ := act["sub"].(string)
+		if actor == "" {
+			actor, _ = act["client_id"].(string)
+		}
+		actors = append(actors, actor)
+		act, _ = act["act"].(map[string]any)
+	}
+	return actors
+}
+
+// CheckActor verifies that the current actor of the token is expected; an empty expected
+// actor accepts any token
+func CheckActor(token jwt.Token, expected string) error {
+	if expected == "" {
+		return nil
+	}
+	actors := ActorChain(token)
+	if len(actors) == 0 {
+		return fmt.Errorf("token has no act claim, expected actor %s", expected)
+	}
+	if actors[0] != expected {
+		return fmt.Errorf("token names actor %s, expected %s", actors[0], expected)
+	}
+	return nil
+}
+
+// IsCORSPreflight reports whether r is a browser's CORS preflight request, which carries
+// no credentials
+func IsCORSPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Authenticator rejects requests without a valid bearer token
+type Authenticator struct {
+	Validator *tokenval.Validator
+	// ExpectedActor, if set, must be the current actor of every token
+	ExpectedActor string
+	// PassCORSPreflights forwards CORS preflights, which carry no credentials, to the
+	// application unauthenticated, for applications that answer them; without it they get
+	// 401 like other requests without a token
+	PassCORSPreflights bool
+}
+
+// Authenticate validates the request's token and returns it, or the status to answer with
+func (a *Authenticator) Authenticate(r *http.Request) (jwt.Token, int, error) {
+	raw, err := BearerToken(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	token, err := a.Validator.Validate(r.Context(), raw)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	if err := CheckActor(token, a.ExpectedActor); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	return token, http.StatusOK, nil
+}
+
+// Wrap passes authenticated requests, and CORS preflights with PassCORSPreflights, to next
+// with the identity headers set; other requests are answered with 401 or 403 and never
+// reach next
+func (a *Authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, header := range []string{UserHeader, PreferredUsernameHeader, EmailHeader} {
+			r.Header.Del(header)
+		}
+		if a.PassCORSPreflights && IsCORSPreflight(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, status, err := a.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected request %s %s with %d: %v", r.Method, r.URL.Path, status, err)
+			if status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "unauthorized", status)
+			} else {
+				http.Error(w, "forbidden", status)
+			}
+			return
+		}
+		r.Header.Set(UserHeader, token.Subject())
+		if username, ok := token.Get("preferred_username"); ok {
+			r.Header.Set(PreferredUsernameHeader, fmt.Sprint(username))
+		}
+		if email, ok := token.Get("email"); ok {
+			r.Header.Set(EmailHeader, fmt.Sprint(email))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProbePassthrough forwards kubelet probes to next without authentication. The webhook
+// rewrites the application's HTTP probes to pass-through paths; paths maps each of them to
+// the original probe path, which may carry a query. Other requests get 404, so nothing but
+// the probes bypasses Wrap.
+func ProbePassthrough(paths map[string]string, next http.Handler) (http.Handler, error) {
+	originals := make(map[string]*url.URL, len(paths))
+	for path, original := range paths {
+		if original == "" {
+			original = "/"
+		}
+		u, err := url.Parse(original)
+		if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/") {
+			return nil, fmt.Errorf("invalid probe path %q for %s", original, path)
+		}
+		originals[path] = u
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		original, ok := originals[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		probe := r.Clone(r.Context())
+		for _, header := range []string{UserHeader, PreferredUsernameHeader, EmailHeader} {
+			probe.Header.Del(header)
+		}
+		probe.URL.Path, probe.URL.RawPath, probe.URL.RawQuery = original.Path, original.RawPath, original.RawQuery
+		next.ServeHTTP(w, probe)
+	}), nil
+}
@@ -0,0 +1,381 @@
+package inbound_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/inbound"
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+const issuer = "https://keycloak.example.com/realms/demo"
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+		err    error
+	}{
+		{header: "Bearer abc.def.ghi", want: "abc.def.ghi"},
+		{header: "", err: inbound.ErrMissingAuthorization},
+		{header: "Bearer ", err: inbound.ErrInvalidAuthorization},
+		{header: "Basic YWxpY2U6c2VjcmV0", err: inbound.ErrInvalidAuthorization},
+		{header: "bearer abc.def.ghi", err: inbound.ErrInvalidAuthorization},
+		{header: "abc.def.ghi", err: inbound.ErrInvalidAuthorization},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		got, err := inbound.BearerToken(r)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("BearerToken(%q) = %q, %v, want %q, %v", tt.header, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// actorToken returns a token whose act claim is act, or without one for nil
+func actorToken(t *testing.T, act map[string]any) jwt.Token {
+	t.Helper()
+	token := jwt.New()
+	if act != nil {
+		if err := token.Set("act", act); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return token
+}
+
+func TestActorChainAndCheckActor(t *testing.T) {
+	tests := []struct {
+		name     string
+		act      map[string]any
+		expected string
+		chain    []string
+		// err is a substring of the CheckActor error, empty to accept the token
+		err string
+	}{
+		{name: "no act claim", chain: []string{}},
+		{name: "no act claim with an expected actor", expected: "agent", chain: []string{}, err: "no act claim"},
+		{name: "single actor", act: map[string]any{"sub": "agent"}, expected: "agent", chain: []string{"agent"}},
+		{name: "client_id without sub", act: map[string]any{"client_id": "agent"}, expected: "agent", chain: []string{"agent"}},
+		{name: "sub preferred over client_id", act: map[string]any{"sub": "agent", "client_id": "other"}, expected: "agent", chain: []string{"agent"}},
+		{
+			name:     "nested actors",
+			act:      map[string]any{"sub": "gateway", "act": map[string]any{"sub": "agent", "act": map[string]any{"client_id": "ui"}}},
+			expected: "gateway",
+			chain:    []string{"gateway", "agent", "ui"},
+		},
+		{
+			name:     "expected actor earlier in the chain",
+			act:      map[string]any{"sub": "gateway", "act": map[string]any{"sub": "agent"}},
+			expected: "agent",
+			chain:    []string{"gateway", "agent"},
+			err:      "names actor gateway, expected agent",
+		},
+		{name: "other actor", act: map[string]any{"sub": "intruder"}, expected: "agent", chain: []string{"intruder"}, err: "names actor intruder"},
+		{name: "any actor without an expected one", act: map[string]any{"sub": "intruder"}, chain: []string{"intruder"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := actorToken(t, tt.act)
+			if got := inbound.ActorChain(token); fmt.Sprint(got) != fmt.Sprint(tt.chain) {
+				t.Errorf("ActorChain() = %v, want %v", got, tt.chain)
+			}
+			err := inbound.CheckActor(token, tt.expected)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("CheckActor(%q) = %v", tt.expected, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CheckActor(%q) = %v, want an error containing %q", tt.expected, err, tt.err)
+			}
+		})
+	}
+}
+
+func discardLogs(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+// newAuthenticator returns an Authenticator that trusts tokens signed by the returned key
+func newAuthenticator(t *testing.T, expectedActor string) (*inbound.Authenticator, jwk.Key) {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = key.Set(jwk.KeyIDKey, "key-1")
+	_ = key.Set(jwk.AlgorithmKey, jwa.RS256)
+	public, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(public); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	validator, err := tokenval.New(ctx, tokenval.Options{
+		JWKSURL:    server.URL,
+		Issuers:    []string{issuer},
+		Audiences:  []string{"billing"},
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &inbound.Authenticator{Validator: validator, ExpectedActor: expectedActor}, key
+}
+
+// sign issues a token for alice with audience billing, with the claims in edit applied on top
+func sign(t *testing.T, key jwk.Key, edit func(jwt.Token)) string {
+	t.Helper()
+	token := jwt.New()
+	_ = token.Set(jwt.IssuerKey, issuer)
+	_ = token.Set(jwt.SubjectKey, "alice")
+	_ = token.Set(jwt.AudienceKey, []string{"billing"})
+	_ = token.Set(jwt.ExpirationKey, time.Now().Add(time.Hour))
+	if edit != nil {
+		edit(token)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestAuthenticatorWrap(t *testing.T) {
+	discardLogs(t)
+	authenticator, key := newAuthenticator(t, "agent")
+	withActor := func(tok jwt.Token) { _ = tok.Set("act", map[string]any{"sub": "agent"}) }
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		// identity is the value of each identity header the application receives
+		identity map[string]string
+	}{
+		{
+			name:          "valid token",
+			authorization: "Bearer " + sign(t, key, withActor),
+			status:        http.StatusOK,
+			identity:      map[string]string{inbound.UserHeader: "alice", inbound.PreferredUsernameHeader: "", inbound.EmailHeader: ""},
+		},
+		{
+			name: "valid token with username and email",
+			authorization: "Bearer " + sign(t, key, func(tok jwt.Token) {
+				withActor(tok)
+				_ = tok.Set("preferred_username", "alice.smith")
+				_ = tok.Set("email", "alice@example.com")
+			}),
+			status: http.StatusOK,
+			identity: map[string]string{
+				inbound.UserHeader:              "alice",
+				inbound.PreferredUsernameHeader: "alice.smith",
+				inbound.EmailHeader:             "alice@example.com",
+			},
+		},
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "not a bearer token", authorization: "Basic YWxpY2U6c2VjcmV0", status: http.StatusUnauthorized},
+		{
+			name: "other audience",
+			authorization: "Bearer " + sign(t, key, func(tok jwt.Token) {
+				withActor(tok)
+				_ = tok.Set(jwt.AudienceKey, []string{"orders"})
+			}),
+			status: http.StatusUnauthorized,
+		},
+		{name: "no actor", authorization: "Bearer " + sign(t, key, nil), status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received http.Header
+			handler := authenticator.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received = r.Header.Clone()
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			// spoofed identity headers must never reach the application
+			r.Header.Set(inbound.UserHeader, "admin")
+			r.Header.Set(inbound.PreferredUsernameHeader, "admin")
+			r.Header.Set(inbound.EmailHeader, "admin@example.com")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				if received != nil {
+					t.Error("rejected request reached the application")
+				}
+				if tt.status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+					t.Error("401 without a WWW-Authenticate header")
+				}
+				return
+			}
+			for header, want := range tt.identity {
+				if got := received.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticatorWrapCORSPreflight(t *testing.T) {
+	discardLogs(t)
+	authenticator, _ := newAuthenticator(t, "")
+
+	preflight := map[string]string{"Origin": "https://ui.example.com", "Access-Control-Request-Method": "POST"}
+	tests := []struct {
+		name    string
+		pass    bool
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{
+			name:    "preflight",
+			pass:    true,
+			method:  http.MethodOptions,
+			headers: preflight,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "preflight without PassCORSPreflights",
+			method:  http.MethodOptions,
+			headers: preflight,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "OPTIONS without Access-Control-Request-Method",
+			pass:    true,
+			method:  http.MethodOptions,
+			headers: map[string]string{"Origin": "https://ui.example.com"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "OPTIONS without Origin",
+			pass:    true,
+			method:  http.MethodOptions,
+			headers: map[string]string{"Access-Control-Request-Method": "POST"},
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "GET with CORS headers",
+			pass:    true,
+			method:  http.MethodGet,
+			headers: preflight,
+			status:  http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator.PassCORSPreflights = tt.pass
+			handler := authenticator.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if user := r.Header.Get(inbound.UserHeader); user != "" {
+					t.Errorf("preflight reached the application as %q", user)
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for header, value := range tt.headers {
+				r.Header.Set(header, value)
+			}
+			r.Header.Set(inbound.UserHeader, "admin")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestProbePassthrough(t *testing.T) {
+	var got *http.Request
+	handler, err := inbound.ProbePassthrough(map[string]string{
+		"/inbound-auth/probe/app/readiness": "/healthz?full=1",
+		"/inbound-auth/probe/app/liveness":  "",
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		upstream string
+	}{
+		{method: http.MethodGet, path: "/inbound-auth/probe/app/readiness", status: http.StatusOK, upstream: "/healthz?full=1"},
+		{method: http.MethodGet, path: "/inbound-auth/probe/app/liveness", status: http.StatusOK, upstream: "/"},
+		{method: http.MethodGet, path: "/inbound-auth/probe/app/startup", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/inbound-auth/probe/app/readiness", status: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		got = nil
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set(inbound.UserHeader, "admin")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.path, w.Code, tt.status)
+		}
+		if tt.upstream == "" {
+			if got != nil {
+				t.Errorf("%s %s reached the application", tt.method, tt.path)
+			}
+			continue
+		}
+		if got == nil || got.URL.RequestURI() != tt.upstream {
+			t.Errorf("%s %s: forwarded to %v, want %s", tt.method, tt.path, got, tt.upstream)
+		} else if user := got.Header.Get(inbound.UserHeader); user != "" {
+			t.Errorf("%s %s reached the application as %q", tt.method, tt.path, user)
+		}
+	}
+
+	if _, err := inbound.ProbePassthrough(map[string]string{"/inbound-auth/probe/app/readiness": "http://evil/"}, http.NotFoundHandler()); err == nil {
+		t.Error("ProbePassthrough accepted an absolute probe path")
+	}
+}
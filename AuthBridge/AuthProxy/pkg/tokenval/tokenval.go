@@ -0,0 +1,126 @@
+// Package tokenval validates JWTs against a JWKS endpoint, the way every AuthBridge
+// component that accepts bearer tokens needs to: signature, expiry with a leeway, issuer,
+// audience and required claims.
+package tokenval
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// DefaultLeeway is the clock skew accepted on exp, nbf and iat
+const DefaultLeeway = 30 * time.Second
+
+// NoLeeway as Options.Leeway accepts no clock skew at all
+const NoLeeway time.Duration = -1
+
+// Options configure a Validator
+type Options struct {
+	// JWKSURL is the endpoint of the signing keys; they are cached and refreshed in the background
+	JWKSURL string
+	// Issuers lists the accepted iss values; at least one is required
+	Issuers []string
+	// Audiences lists the accepted aud values; the token must name one of them. Empty
+	// accepts any audience.
+	Audiences []string
+	// Leeway is the accepted clock skew, DefaultLeeway when zero and none when negative
+	Leeway time.Duration
+	// RequiredClaims must be present in the token
+	RequiredClaims []string
+	// HTTPClient fetches the signing keys; it defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Validator checks tokens against Options
+type Validator struct {
+	opts  Options
+	cache *jwk.Cache
+}
+
+// New registers the JWKS endpoint; ctx bounds the background refresh of the keys
+func New(ctx context.Context, opts Options) (*Validator, error) {
+	if opts.JWKSURL == "" {
+		return nil, fmt.Errorf("a JWKS URL is required")
+	}
+	if len(opts.Issuers) == 0 {
+		return nil, fmt.Errorf("at least one issuer is required")
+	}
+	switch {
+	case opts.Leeway == 0:
+		opts.Leeway = DefaultLeeway
+	case opts.Leeway < 0:
+		opts.Leeway = 0
+	}
+	var registerOpts []jwk.RegisterOption
+	if opts.HTTPClient != nil {
+		registerOpts = append(registerOpts, jwk.WithHTTPClient(opts.HTTPClient))
+	}
+	cache := jwk.NewCache(ctx)
+	if err := cache.Register(opts.JWKSURL, registerOpts...); err != nil {
+		return nil, fmt.Errorf("failed to register JWKS URL: %w", err)
+	}
+	return &Validator{opts: opts, cache: cache}, nil
+}
+
+// Refresh fetches the signing keys again, e.g. after the issuer rotated them
+func (v *Validator) Refresh(ctx context.Context) error {
+	if _, err := v.cache.Refresh(ctx, v.opts.JWKSURL); err != nil {
+		return fmt.Errorf("failed to refresh JWKS: %w", err)
+	}
+	return nil
+}
+
+// ParseLeeway parses a leeway setting such as "5s" for Options.Leeway: empty is
+// DefaultLeeway and zero is NoLeeway
+func ParseLeeway(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return DefaultLeeway, nil
+	}
+	leeway, err := time.ParseDuration(value)
+	if err != nil || leeway < 0 {
+		return 0, fmt.Errorf("invalid leeway %q: must be a non-negative duration", value)
+	}
+	if leeway == 0 {
+		return NoLeeway, nil
+	}
+	return leeway, nil
+}
+
+// Validate parses the token and returns it if it passes every check
+func (v *Validator) Validate(ctx context.Context, token string) (jwt.Token, error) {
+	keySet, err := v.cache.Get(ctx, v.opts.JWKSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	options := []jwt.ParseOption{
+		jwt.WithKeySet(keySet),
+		jwt.WithValidate(true),
+		jwt.WithAcceptableSkew(v.opts.Leeway),
+	}
+	for _, claim := range v.opts.RequiredClaims {
+		options = append(options, jwt.WithRequiredClaim(claim))
+	}
+	parsed, err := jwt.Parse([]byte(token), options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse/validate token: %w", err)
+	}
+
+	if !slices.Contains(v.opts.Issuers, parsed.Issuer()) {
+		return nil, fmt.Errorf("invalid issuer: expected one of %v, got %s", v.opts.Issuers, parsed.Issuer())
+	}
+	if len(v.opts.Audiences) > 0 && !slices.ContainsFunc(parsed.Audience(), func(aud string) bool {
+		return slices.Contains(v.opts.Audiences, aud)
+	}) {
+		return nil, fmt.Errorf("invalid audience: expected one of %v, got %v", v.opts.Audiences, parsed.Audience())
+	}
+	return parsed, nil
+}
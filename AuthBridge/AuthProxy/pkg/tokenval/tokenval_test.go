@@ -0,0 +1,263 @@
+package tokenval_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/huang195/auth-proxy/pkg/tokenval"
+)
+
+const issuer = "https://keycloak.example.com/realms/demo"
+
+// signer is a key pair whose public key an httptest JWKS endpoint serves
+type signer struct {
+	key    jwk.Key
+	server *httptest.Server
+}
+
+func newSigner(t *testing.T, kid string) *signer {
+	t.Helper()
+	key := newKey(t, kid)
+	public, err := key.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(public); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(server.Close)
+	return &signer{key: key, server: server}
+}
+
+func newKey(t *testing.T, kid string) jwk.Key {
+	t.Helper()
+	raw, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = key.Set(jwk.KeyIDKey, kid)
+	_ = key.Set(jwk.AlgorithmKey, jwa.RS256)
+	return key
+}
+
+// sign issues a token from issuer for audience billing, valid for an hour, with the
+// claims in edit applied on top
+func sign(t *testing.T, key jwk.Key, edit func(jwt.Token)) string {
+	t.Helper()
+	token := jwt.New()
+	now := time.Now()
+	_ = token.Set(jwt.IssuerKey, issuer)
+	_ = token.Set(jwt.SubjectKey, "alice")
+	_ = token.Set(jwt.AudienceKey, []string{"billing"})
+	_ = token.Set(jwt.IssuedAtKey, now)
+	_ = token.Set(jwt.ExpirationKey, now.Add(time.Hour))
+	if edit != nil {
+		edit(token)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestValidate(t *testing.T) {
+	s := newSigner(t, "key-1")
+	other := newKey(t, "key-1")
+
+	tests := []struct {
+		name  string
+		opts  func(*tokenval.Options)
+		token func(t *testing.T) string
+		// err is a substring of the expected error, empty for a valid token
+		err string
+	}{
+		{name: "valid token", token: func(t *testing.T) string { return sign(t, s.key, nil) }},
+		{name: "signed by another key", token: func(t *testing.T) string { return sign(t, other, nil) }, err: "failed to parse/validate"},
+		{name: "not a JWT", token: func(t *testing.T) string { return "not-a-jwt" }, err: "failed to parse/validate"},
+		{
+			name: "tampered payload",
+			token: func(t *testing.T) string {
+				parts := strings.Split(sign(t, s.key, nil), ".")
+				forged := strings.Split(sign(t, other, func(tok jwt.Token) { _ = tok.Set(jwt.SubjectKey, "admin") }), ".")
+				return parts[0] + "." + forged[1] + "." + parts[2]
+			},
+			err: "failed to parse/validate",
+		},
+		{
+			name: "other issuer",
+			token: func(t *testing.T) string {
+				return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set(jwt.IssuerKey, "https://evil.example.com") })
+			},
+			err: "invalid issuer",
+		},
+		{
+			name: "second accepted issuer",
+			opts: func(o *tokenval.Options) { o.Issuers = append(o.Issuers, "https://other.example.com") },
+			token: func(t *testing.T) string {
+				return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set(jwt.IssuerKey, "https://other.example.com") })
+			},
+		},
+		{
+			name:  "audience not accepted",
+			opts:  func(o *tokenval.Options) { o.Audiences = []string{"orders"} },
+			token: func(t *testing.T) string { return sign(t, s.key, nil) },
+			err:   "invalid audience",
+		},
+		{
+			name: "one of several audiences accepted",
+			opts: func(o *tokenval.Options) { o.Audiences = []string{"orders", "billing"} },
+			token: func(t *testing.T) string {
+				return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set(jwt.AudienceKey, []string{"account", "billing"}) })
+			},
+		},
+		{
+			name: "any audience without Audiences",
+			token: func(t *testing.T) string {
+				return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set(jwt.AudienceKey, []string{"account"}) })
+			},
+		},
+		{
+			name:  "expired within the default leeway",
+			token: func(t *testing.T) string { return expiredToken(t, s.key, 10*time.Second) },
+		},
+		{
+			name:  "expired beyond the default leeway",
+			token: func(t *testing.T) string { return expiredToken(t, s.key, time.Minute) },
+			err:   "exp",
+		},
+		{
+			name:  "expired within a custom leeway",
+			opts:  func(o *tokenval.Options) { o.Leeway = 2 * time.Minute },
+			token: func(t *testing.T) string { return expiredToken(t, s.key, time.Minute) },
+		},
+		{
+			name:  "expired with NoLeeway",
+			opts:  func(o *tokenval.Options) { o.Leeway = tokenval.NoLeeway },
+			token: func(t *testing.T) string { return expiredToken(t, s.key, 10*time.Second) },
+			err:   "exp",
+		},
+		{
+			name: "not yet valid",
+			opts: func(o *tokenval.Options) { o.Leeway = tokenval.NoLeeway },
+			token: func(t *testing.T) string {
+				return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set(jwt.NotBeforeKey, time.Now().Add(time.Minute)) })
+			},
+			err: "nbf",
+		},
+		{
+			name:  "required claims present",
+			opts:  func(o *tokenval.Options) { o.RequiredClaims = []string{"exp", "azp"} },
+			token: func(t *testing.T) string { return sign(t, s.key, func(tok jwt.Token) { _ = tok.Set("azp", "agent") }) },
+		},
+		{
+			name:  "required claim missing",
+			opts:  func(o *tokenval.Options) { o.RequiredClaims = []string{"exp", "azp"} },
+			token: func(t *testing.T) string { return sign(t, s.key, nil) },
+			err:   "azp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			opts := tokenval.Options{JWKSURL: s.server.URL, Issuers: []string{issuer}, HTTPClient: s.server.Client()}
+			if tt.opts != nil {
+				tt.opts(&opts)
+			}
+			validator, err := tokenval.New(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := validator.Validate(ctx, tt.token(t))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v", err)
+				}
+				if parsed.Subject() == "" {
+					t.Error("Validate() returned a token without its claims")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// expiredToken returns a token whose exp lies ago in the past
+func expiredToken(t *testing.T, key jwk.Key, ago time.Duration) string {
+	return sign(t, key, func(tok jwt.Token) {
+		_ = tok.Set(jwt.IssuedAtKey, time.Now().Add(-time.Hour))
+		_ = tok.Set(jwt.ExpirationKey, time.Now().Add(-ago))
+	})
+}
+
+func TestValidateUnreachableJWKS(t *testing.T) {
+	s := newSigner(t, "key-1")
+	token := sign(t, s.key, nil)
+	url := s.server.URL
+	s.server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	validator, err := tokenval.New(ctx, tokenval.Options{JWKSURL: url, Issuers: []string{issuer}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := validator.Validate(ctx, token); err == nil || !strings.Contains(err.Error(), "failed to fetch JWKS") {
+		t.Errorf("Validate() = %v, want a JWKS fetch error", err)
+	}
+}
+
+func TestNewRequiresJWKSURLAndIssuer(t *testing.T) {
+	ctx := context.Background()
+	if _, err := tokenval.New(ctx, tokenval.Options{Issuers: []string{issuer}}); err == nil {
+		t.Error("New() without a JWKS URL succeeded")
+	}
+	if _, err := tokenval.New(ctx, tokenval.Options{JWKSURL: "http://127.0.0.1/jwks"}); err == nil {
+		t.Error("New() without an issuer succeeded")
+	}
+}
+
+func TestParseLeeway(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: tokenval.DefaultLeeway},
+		{value: " 5s ", want: 5 * time.Second},
+		{value: "0", want: tokenval.NoLeeway},
+		{value: "0s", want: tokenval.NoLeeway},
+		{value: "-1s", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tokenval.ParseLeeway(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLeeway(%q) = %v, %v, want %v (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
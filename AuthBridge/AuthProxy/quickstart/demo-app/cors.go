@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultCORSAllowedHeaders = "Authorization, Content-Type"
+	defaultCORSAllowedMethods = "GET, POST, OPTIONS"
+)
+
+// corsPolicy lets browser-based UIs on the allowed origins call the demo app: it answers
+// their preflight requests and adds the CORS headers to the responses
+type corsPolicy struct {
+	// origins are the allowed origins; "*" allows any
+	origins []string
+	headers string
+	methods string
+}
+
+// loadCORS reads CORS_ALLOWED_ORIGINS, CORS_ALLOWED_HEADERS and CORS_ALLOWED_METHODS; CORS
+// is off without allowed origins
+func loadCORS() *corsPolicy {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	if len(origins) == 0 {
+		return nil
+	}
+	policy := &corsPolicy{
+		origins: origins,
+		headers: valueOr(os.Getenv("CORS_ALLOWED_HEADERS"), defaultCORSAllowedHeaders),
+		methods: valueOr(os.Getenv("CORS_ALLOWED_METHODS"), defaultCORSAllowedMethods),
+	}
+	log.Printf("CORS allowed origins: %v, headers: %s, methods: %s", policy.origins, policy.headers, policy.methods)
+	return policy
+}
+
+// allowed reports whether the policy allows requests from origin
+func (c *corsPolicy) allowed(origin string) bool {
+	return slices.Contains(c.origins, "*") || slices.Contains(c.origins, origin)
+}
+
+// wrap answers preflight requests and adds the CORS headers for allowed origins before
+// calling next; without a policy it returns next
+func (c *corsPolicy) wrap(next http.HandlerFunc) http.HandlerFunc {
+	if c == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if !c.allowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte("forbidden: origin not allowed"))
+				log.Printf("Rejected CORS preflight from origin %s", origin)
+				return
+			}
+			next(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", c.methods)
+			w.Header().Set("Access-Control-Allow-Headers", c.headers)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id")
+		next(w, r)
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
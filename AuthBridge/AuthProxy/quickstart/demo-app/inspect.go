@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// expected holds what the demo app checks tokens against, for explaining each check on
+// the inspection page
+var expected struct {
+	issuer, audience string
+	leeway           time.Duration
+}
+
+// inspection is what the /inspect page shows about a token
+type inspection struct {
+	Token  string
+	Header string
+	Claims string
+	Checks []inspectionCheck
+	Valid  bool
+}
+
+type inspectionCheck struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+var inspectPage = template.Must(template.New("inspect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Demo App - Token Inspection</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 70em; }
+textarea { width: 100%; height: 6em; font-family: monospace; }
+pre { background: #f4f4f4; padding: 1em; overflow-x: auto; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+td { padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Token Inspection</h1>
+<form method="post" action="/inspect">
+<textarea name="token" placeholder="Paste an access token">{{.Token}}</textarea>
+<p><button type="submit">Inspect</button></p>
+</form>
+{{if .Token}}
+<h2 class="{{if .Valid}}passed{{else}}failed{{end}}">{{if .Valid}}Accepted{{else}}Rejected{{end}}</h2>
+<table>
+{{range .Checks}}<tr><td class="{{if .Passed}}passed{{else}}failed{{end}}">{{if .Passed}}&#10004;{{else}}&#10008;{{end}} {{.Name}}</td><td>{{.Detail}}</td></tr>
+{{end}}</table>
+{{if .Header}}<h2>Header</h2>
+<pre>{{.Header}}</pre>{{end}}
+{{if .Claims}}<h2>Claims</h2>
+<pre>{{.Claims}}</pre>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// inspectHandler serves the token inspection page: the decoded header and claims of the
+// token, from the Authorization header or the form, and the result of each check the demo
+// app applies to it
+func inspectHandler(w http.ResponseWriter, r *http.Request) {
+	if failures.lockedOut(w, r) {
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if token == "" {
+		token = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	page := inspection{Token: strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))}
+	if page.Token != "" {
+		page = inspect(page.Token)
+		if page.Valid {
+			failures.succeed(r)
+		} else {
+			failures.fail(r)
+		}
+		log.Printf("Inspected token: valid=%v", page.Valid)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := inspectPage.Execute(w, page); err != nil {
+		log.Printf("Failed to render the inspection page: %v", err)
+	}
+}
+
+// inspect decodes the token without verifying it, then runs the checks
+func inspect(token string) inspection {
+	page := inspection{Token: token}
+	check := func(name string, passed bool, detail string) {
+		page.Checks = append(page.Checks, inspectionCheck{Name: name, Passed: passed, Detail: detail})
+	}
+
+	parts := strings.Split(token, ".")
+	var header, claims map[string]any
+	if len(parts) == 3 {
+		header, page.Header = decodeSegment(parts[0])
+		claims, page.Claims = decodeSegment(parts[1])
+	}
+	if header == nil || claims == nil {
+		check("Well-formed JWT", false, "expected three base64url segments with a JSON header and claims")
+		return page
+	}
+	check("Well-formed JWT", true, fmt.Sprintf("alg %v, kid %v", header["alg"], header["kid"]))
+
+	issuer, _ := claims["iss"].(string)
+	check("Issuer", issuer == expected.issuer, fmt.Sprintf("%q, expected %q", issuer, expected.issuer))
+
+	audiences := claimStrings(claims["aud"])
+	check("Audience", slices.Contains(audiences, expected.audience),
+		fmt.Sprintf("%v, expected %q", audiences, expected.audience))
+
+	leeway := max(expected.leeway, 0)
+	if exp, ok := claims["exp"].(float64); ok {
+		expiry := time.Unix(int64(exp), 0)
+		check("Not expired", time.Now().Before(expiry.Add(leeway)),
+			fmt.Sprintf("expires %s, leeway %s", expiry.Format(time.RFC3339), leeway))
+	} else {
+		check("Not expired", false, "no exp claim")
+	}
+
+	validated, err := validator.Validate(context.Background(), token)
+	if err != nil {
+		check("Signature and claims", false, err.Error())
+	} else {
+		check("Signature and claims", true, "verified against the JWKS")
+	}
+
+	if validated != nil && (expectedActor != "" || len(actorChain(validated)) > 0) {
+		actors := actorChain(validated)
+		switch {
+		case expectedActor == "":
+			check("Delegation", true, "actors: "+strings.Join(actors, " <- "))
+		case len(actors) > 0 && actors[0] == expectedActor:
+			check("Delegation", true, "actors: "+strings.Join(actors, " <- ")+", expected actor "+expectedActor)
+		default:
+			check("Delegation", false, fmt.Sprintf("actors: %v, expected actor %s", actors, expectedActor))
+		}
+	}
+
+	page.Valid = !slices.ContainsFunc(page.Checks, func(c inspectionCheck) bool { return !c.Passed })
+	return page
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT, returning it as a map and
+// indented for display
+func decodeSegment(segment string) (map[string]any, string) {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, ""
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, ""
+	}
+	indented, _ := json.MarshalIndent(decoded, "", "  ")
+	return decoded, string(indented)
+}
+
+// claimStrings reads a claim that is a string or a list of strings, such as aud
+func claimStrings(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
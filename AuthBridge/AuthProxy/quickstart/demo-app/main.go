@@ -4,19 +4,37 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/huang195/auth-proxy/pkg/inbound"
+	"github.com/huang195/auth-proxy/pkg/tokenval"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 const targetPort = "0.0.0.0:8081"
 
-var jwksCache *jwk.Cache
+var validator *tokenval.Validator
+
+// failures locks out client IPs after repeated failed authentications, nil when off
+var failures *failureLimiter
+
+// Delegation checks, for verifying the identity chaining of the token exchange
+var (
+	// expectedActor is the current actor the token must name in its act claim
+	expectedActor string
+	// printDelegationChain logs the subject and the actors of every token
+	printDelegationChain bool
+)
 
 func main() {
+	if err := setupLogging("demo-app"); err != nil {
+		log.Fatal(err)
+	}
+
 	jwksURL := os.Getenv("JWKS_URL")
 	if jwksURL == "" {
 		log.Fatal("JWKS_URL environment variable is required")
@@ -32,55 +50,56 @@ func main() {
 		log.Fatal("AUDIENCE environment variable is required")
 	}
 
-	// Initialize JWKS cache
-	ctx := context.Background()
-	jwksCache = jwk.NewCache(ctx)
-	if err := jwksCache.Register(jwksURL); err != nil {
-		log.Fatalf("Failed to register JWKS URL: %v", err)
+	leeway, err := tokenval.ParseLeeway(os.Getenv("LEEWAY"))
+	if err != nil {
+		log.Fatalf("Invalid LEEWAY: %v", err)
 	}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		authHandler(w, r, jwksURL, issuer, audience)
+	validator, err = tokenval.New(context.Background(), tokenval.Options{
+		JWKSURL:   jwksURL,
+		Issuers:   []string{issuer},
+		Audiences: []string{audience},
+		Leeway:    leeway,
 	})
-	log.Printf("Demo app starting on port %s", targetPort)
-	log.Printf("JWKS URL: %s", jwksURL)
-	log.Printf("Expected issuer: %s", issuer)
-	log.Printf("Expected audience: %s", audience)
-	log.Fatal(http.ListenAndServe(targetPort, nil))
-}
-
-func validateJWT(tokenString, jwksURL, expectedIssuer, expectedAudience string) error {
-	ctx := context.Background()
-
-	// Fetch JWKS from cache
-	keySet, err := jwksCache.Get(ctx, jwksURL)
 	if err != nil {
-		return fmt.Errorf("failed to fetch JWKS: %w", err)
+		log.Fatalf("Failed to set up token validation: %v", err)
+	}
+	expected.issuer, expected.audience, expected.leeway = issuer, audience, leeway
+
+	// EXPECTED_ACTOR denies tokens whose act claim does not name this actor
+	expectedActor = os.Getenv("EXPECTED_ACTOR")
+	if value := os.Getenv("PRINT_DELEGATION_CHAIN"); value != "" {
+		printDelegationChain, err = strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("Invalid PRINT_DELEGATION_CHAIN %q: %v", value, err)
+		}
 	}
 
-	// Parse and validate the token
-	token, err := jwt.Parse([]byte(tokenString), jwt.WithKeySet(keySet), jwt.WithValidate(true))
+	failures, err = loadFailureLimiter()
 	if err != nil {
-		return fmt.Errorf("failed to parse/validate token: %w", err)
+		log.Fatalf("Invalid failed authentication limit: %v", err)
 	}
 
-	// Validate issuer claim
-	if token.Issuer() != expectedIssuer {
-		return fmt.Errorf("invalid issuer: expected %s, got %s", expectedIssuer, token.Issuer())
+	// CORS_ALLOWED_ORIGINS lets browser-based UIs on those origins call the demo app
+	cors := loadCORS()
+	http.HandleFunc("/", cors.wrap(authHandler))
+	// /inspect shows the decoded token and the result of each check, for live demos
+	http.HandleFunc("/inspect", cors.wrap(inspectHandler))
+	log.Printf("Demo app starting on port %s", targetPort)
+	log.Printf("JWKS URL: %s", jwksURL)
+	log.Printf("Expected issuer: %s", issuer)
+	log.Printf("Expected audience: %s", audience)
+	if expectedActor != "" {
+		log.Printf("Expected actor: %s", expectedActor)
 	}
+	log.Fatal(listenAndServe(targetPort))
+}
 
-	// Validate audience claim
-	audiences := token.Audience()
-	validAudience := false
-	for _, aud := range audiences {
-		if aud == expectedAudience {
-			validAudience = true
-			break
-		}
-	}
-	if !validAudience {
-		return fmt.Errorf("invalid audience: expected %s, got %v", expectedAudience, audiences)
+func validateJWT(tokenString string) (jwt.Token, error) {
+	token, err := validator.Validate(context.Background(), tokenString)
+	if err != nil {
+		return nil, err
 	}
+	audiences := token.Audience()
 
 	// Log JWT claims for debugging
 	log.Printf("[JWT Debug] Successfully validated token")
@@ -105,37 +124,99 @@ func validateJWT(tokenString, jwksURL, expectedIssuer, expectedAudience string)
 		log.Printf("[JWT Debug] Scope: <not present>")
 	}
 
+	return token, nil
+}
+
+// actorChain lists the actors of the token's nested act claims (RFC 8693), the current
+// actor first
+func actorChain(token jwt.Token) []string {
+	return inbound.ActorChain(token)
+}
+
+// checkDelegation logs the delegation chain and verifies the current actor, when configured
+func checkDelegation(token jwt.Token) error {
+	if printDelegationChain {
+		if actors := actorChain(token); len(actors) == 0 {
+			log.Printf("[Delegation] Subject %s, no act claim", token.Subject())
+		} else {
+			log.Printf("[Delegation] Subject %s, actors: %s", token.Subject(), strings.Join(actors, " <- "))
+		}
+	}
+	if err := inbound.CheckActor(token, expectedActor); err != nil {
+		return err
+	}
+	if expectedActor != "" {
+		log.Printf("[Delegation] Actor verified: %s", expectedActor)
+	}
 	return nil
 }
 
-func authHandler(w http.ResponseWriter, r *http.Request, jwksURL, issuer, audience string) {
-	authHeader := r.Header.Get("Authorization")
+func authHandler(w http.ResponseWriter, r *http.Request) {
+	// Envoy's request ID correlates these lines with the caller's go-processor logs
+	if requestID := r.Header.Get("X-Request-Id"); requestID != "" {
+		w.Header().Set("X-Request-Id", requestID)
+		log.Printf("Request ID: %s", requestID)
+	}
 
-	if authHeader == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized: missing Authorization header"))
-		log.Printf("Unauthorized request (missing auth header): %s %s", r.Method, r.URL.Path)
+	// Locked out clients are refused before their token is validated
+	if failures.lockedOut(w, r) {
 		return
 	}
 
 	// Extract token from "Bearer <token>" format
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	if tokenString == authHeader {
+	tokenString, err := inbound.BearerToken(r)
+	if err != nil {
+		failures.fail(r)
 		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte("unauthorized: invalid Authorization header format"))
-		log.Printf("Unauthorized request (invalid auth format): %s %s", r.Method, r.URL.Path)
+		w.Write([]byte("unauthorized: " + err.Error()))
+		log.Printf("Unauthorized request (%v): %s %s", err, r.Method, r.URL.Path)
 		return
 	}
 
 	// Validate JWT
-	if err := validateJWT(tokenString, jwksURL, issuer, audience); err != nil {
+	token, err := validateJWT(tokenString)
+	if err != nil {
+		failures.fail(r)
 		w.WriteHeader(http.StatusUnauthorized)
 		w.Write([]byte("unauthorized"))
 		log.Printf("Unauthorized request (invalid token): %s %s - %v", r.Method, r.URL.Path, err)
 		return
 	}
 
+	// The token must have been exchanged on behalf of the expected actor
+	if err := checkDelegation(token); err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("forbidden: " + err.Error()))
+		log.Printf("Forbidden request (delegation): %s %s - %v", r.Method, r.URL.Path, err)
+		return
+	}
+
+	failures.succeed(r)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("authorized"))
 	log.Printf("Authorized request: %s %s", r.Method, r.URL.Path)
 }
+
+// setupLogging routes the log package through slog with the service attribute, as text or
+// JSON (LOG_FORMAT) at LOG_LEVEL, the settings of the other AuthBridge components
+func setupLogging(service string) error {
+	level := slog.LevelInfo
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", value)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("LOG_FORMAT")); format {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid LOG_FORMAT %q: must be text or json", format)
+	}
+	slog.SetDefault(slog.New(handler).With("service", service))
+	log.SetFlags(0)
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuthFailureWindow = time.Minute
+	defaultAuthLockout       = 5 * time.Minute
+	maxTrackedAuthFailureIPs = 10000
+)
+
+// failureLimiter locks out client IPs after too many failed authentication attempts, so
+// brute force and misconfigured load tests are answered with 429 before their tokens are
+// validated, and cannot make the validator fetch the JWKS from Keycloak again and again
+type failureLimiter struct {
+	// limit is the number of failures within window that locks a client IP out
+	limit   int
+	window  time.Duration
+	lockout time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*authFailures
+}
+
+type authFailures struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+// loadFailureLimiter reads AUTH_FAILURE_LIMIT, AUTH_FAILURE_WINDOW and AUTH_LOCKOUT; the
+// limiter is off without a limit
+func loadFailureLimiter() (*failureLimiter, error) {
+	value := os.Getenv("AUTH_FAILURE_LIMIT")
+	if value == "" {
+		return nil, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("invalid AUTH_FAILURE_LIMIT %q: must be a non-negative integer", value)
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	limiter := &failureLimiter{
+		limit:   limit,
+		window:  defaultAuthFailureWindow,
+		lockout: defaultAuthLockout,
+		clients: map[string]*authFailures{},
+	}
+	for name, target := range map[string]*time.Duration{"AUTH_FAILURE_WINDOW": &limiter.window, "AUTH_LOCKOUT": &limiter.lockout} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				return nil, fmt.Errorf("invalid %s %q: must be a positive duration", name, value)
+			}
+			*target = parsed
+		}
+	}
+	log.Printf("Locking out client IPs for %s after %d failed authentications within %s", limiter.lockout, limiter.limit, limiter.window)
+	return limiter, nil
+}
+
+// clientIP is the host of the request's remote address
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// lockedOut answers 429 with Retry-After when the request's client IP is locked out
+func (l *failureLimiter) lockedOut(w http.ResponseWriter, r *http.Request) bool {
+	if l == nil {
+		return false
+	}
+	ip := clientIP(r)
+	l.mu.Lock()
+	client, ok := l.clients[ip]
+	var remaining time.Duration
+	if ok {
+		remaining = time.Until(client.lockedUntil)
+	}
+	l.mu.Unlock()
+	if remaining <= 0 {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(remaining.Round(time.Second).Seconds())))
+	w.WriteHeader(http.StatusTooManyRequests)
+	w.Write([]byte("too many failed authentication attempts"))
+	log.Printf("Rate limited request (locked out): %s %s from %s", r.Method, r.URL.Path, ip)
+	return true
+}
+
+// fail counts a failed authentication of the request's client IP
+func (l *failureLimiter) fail(r *http.Request) {
+	if l == nil {
+		return
+	}
+	ip := clientIP(r)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	client, ok := l.clients[ip]
+	if !ok {
+		if len(l.clients) >= maxTrackedAuthFailureIPs {
+			l.sweep(now)
+		}
+		client = &authFailures{windowStart: now}
+		l.clients[ip] = client
+	}
+	if now.Sub(client.windowStart) > l.window {
+		client.count, client.windowStart = 0, now
+	}
+	client.count++
+	if client.count >= l.limit {
+		client.lockedUntil = now.Add(l.lockout)
+		client.count, client.windowStart = 0, now
+		log.Printf("Locked out %s for %s after %d failed authentications", ip, l.lockout, l.limit)
+	}
+}
+
+// succeed forgets the failures of the request's client IP
+func (l *failureLimiter) succeed(r *http.Request) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	delete(l.clients, clientIP(r))
+	l.mu.Unlock()
+}
+
+// sweep drops the clients whose window and lockout passed; the caller holds the lock
+func (l *failureLimiter) sweep(now time.Time) {
+	for ip, client := range l.clients {
+		if now.Sub(client.windowStart) > l.window && now.After(client.lockedUntil) {
+			delete(l.clients, ip)
+		}
+	}
+}
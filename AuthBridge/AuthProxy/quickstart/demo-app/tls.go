@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certificateFiles loads the serving certificate and key from PEM files and reloads them
+// when the certificate file changes, e.g. when cert-manager or spiffe-helper renews it
+type certificateFiles struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// GetCertificate serves tls.Config.GetCertificate
+func (f *certificateFiles) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f.get()
+}
+
+// get returns the certificate, reloading it when the file changed. A failed reload keeps
+// serving the previous certificate, since the files may be mid-rotation.
+func (f *certificateFiles) get() (*tls.Certificate, error) {
+	info, err := os.Stat(f.certFile)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err != nil {
+		if f.cert != nil {
+			return f.cert, nil
+		}
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	if f.cert != nil && info.ModTime().Equal(f.modified) {
+		return f.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		if f.cert != nil {
+			log.Printf("Keeping the previous certificate: %v", err)
+			return f.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	log.Printf("Loaded serving certificate %s, expires %s", f.certFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	f.cert, f.modified = &cert, info.ModTime()
+	return f.cert, nil
+}
+
+// listenAndServe serves HTTPS when TLS_CERT_FILE and TLS_KEY_FILE are set, plain HTTP
+// otherwise
+func listenAndServe(addr string) error {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return http.ListenAndServe(addr, nil)
+	}
+	if certFile == "" || keyFile == "" {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	files := &certificateFiles{certFile: certFile, keyFile: keyFile}
+	if _, err := files.get(); err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:      addr,
+		TLSConfig: &tls.Config{GetCertificate: files.GetCertificate, MinVersion: tls.VersionTLS12},
+	}
+	log.Printf("Serving HTTPS with certificate %s", certFile)
+	return server.ListenAndServeTLS("", "")
+}
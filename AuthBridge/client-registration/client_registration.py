@@ -6,13 +6,29 @@ Idempotent:
 - Creates the client if it does not exist.
 - If the client already exists, reuses it.
 - Always retrieves and stores the client secret.
+
+Optional CLIENT_DESCRIPTION, CLIENT_REDIRECT_URIS, CLIENT_AUDIENCES (comma-separated) and
+CLIENT_ATTRIBUTES (a JSON object) describe the client; they are set on new clients and
+applied to existing ones, so the client follows the workload it belongs to.
+
+When CLIENT_CREDENTIALS_SECRET is set, the client ID and secret are stored in that
+Kubernetes Secret (owned by the OWNER_* workload) instead of a file, and a Secret
+that already holds credentials for the same client ID is reused without calling Keycloak.
+
+ROTATE_CLIENT_SECRET=true regenerates the client secret before storing it; the
+credential-hygiene sidecar sets it when it rotates the credentials.
 """
 
+import base64
+import json
 import os
 from typing import Any
 import jwt
+import requests
 from keycloak import KeycloakAdmin, KeycloakPostError
 
+SERVICE_ACCOUNT_DIR = "/var/run/secrets/kubernetes.io/serviceaccount"
+
 
 def get_env_var(name: str, default: str | None = None) -> str:
     """
@@ -43,7 +59,7 @@ def write_client_secret(
         print(f'Successfully retrieved secret for client "{client_name}".')
     except KeycloakPostError as e:
         print(f"Could not retrieve secret for client '{client_name}': {e}")
-        return
+        raise
 
     try:
         with open(secret_file_path, "w") as f:
@@ -51,6 +67,175 @@ def write_client_secret(
         print(f'Secret written to file: "{secret_file_path}"')
     except OSError as ose:
         print(f"Error writing secret to file: {ose}")
+        raise
+
+
+class KubernetesSecretStore:
+    """
+    Minimal in-cluster client for the per-workload client credentials Secret.
+    """
+
+    def __init__(self, namespace: str, name: str):
+        host = get_env_var("KUBERNETES_SERVICE_HOST")
+        port = get_env_var("KUBERNETES_SERVICE_PORT", "443")
+        if ":" in host:
+            host = f"[{host}]"
+        self.base_url = f"https://{host}:{port}"
+        self.namespace = namespace
+        self.name = name
+        with open(os.path.join(SERVICE_ACCOUNT_DIR, "token"), "r") as f:
+            token = f.read().strip()
+        self.session = requests.Session()
+        self.session.headers["Authorization"] = f"Bearer {token}"
+        self.session.verify = os.path.join(SERVICE_ACCOUNT_DIR, "ca.crt")
+
+    def _secret_url(self, name: str = "") -> str:
+        url = f"{self.base_url}/api/v1/namespaces/{self.namespace}/secrets"
+        return f"{url}/{name}" if name else url
+
+    def read(self) -> dict[str, str] | None:
+        """
+        Return the decoded Secret data, or None if the Secret does not exist.
+        """
+        response = self.session.get(self._secret_url(self.name), timeout=10)
+        if response.status_code == 404:
+            return None
+        response.raise_for_status()
+        data = response.json().get("data") or {}
+        return {k: base64.b64decode(v).decode() for k, v in data.items()}
+
+    def owner_reference(self) -> dict[str, Any] | None:
+        """
+        Look up the workload named by OWNER_* so the Secret is deleted with it.
+        """
+        api_version = os.environ.get("OWNER_API_VERSION", "")
+        resource = os.environ.get("OWNER_RESOURCE", "")
+        name = os.environ.get("OWNER_NAME", "")
+        if not (api_version and resource and name):
+            return None
+        prefix = "api" if "/" not in api_version else "apis"
+        url = f"{self.base_url}/{prefix}/{api_version}/namespaces/{self.namespace}/{resource}/{name}"
+        response = self.session.get(url, timeout=10)
+        if not response.ok:
+            print(f'Could not look up owner {resource}/{name} ({response.status_code}), the Secret will not be garbage collected.')
+            return None
+        return {
+            "apiVersion": api_version,
+            "kind": os.environ.get("OWNER_KIND", ""),
+            "name": name,
+            "uid": response.json()["metadata"]["uid"],
+        }
+
+    def write(self, client_id: str, client_secret: str) -> None:
+        """
+        Create or replace the Secret with the registered client.
+        """
+        body: dict[str, Any] = {
+            "apiVersion": "v1",
+            "kind": "Secret",
+            "metadata": {
+                "name": self.name,
+                "namespace": self.namespace,
+                "labels": {"kagenti.io/client-credentials": "true"},
+            },
+            "type": "Opaque",
+            "stringData": {"client-id": client_id, "client-secret": client_secret},
+        }
+        owner = self.owner_reference()
+        if owner:
+            body["metadata"]["ownerReferences"] = [owner]
+        # Keeps the Secret until the webhook manager has deleted the Keycloak client
+        finalizer = os.environ.get("CLIENT_CREDENTIALS_FINALIZER", "")
+        if finalizer:
+            body["metadata"]["finalizers"] = [finalizer]
+
+        response = self.session.post(self._secret_url(), json=body, timeout=10)
+        if response.status_code == 409:
+            # Strategic merge keeps finalizers and owner references added by others
+            response = self.session.patch(
+                self._secret_url(self.name),
+                json=body,
+                headers={"Content-Type": "application/strategic-merge-patch+json"},
+                timeout=10,
+            )
+        response.raise_for_status()
+        print(f'Client credentials written to Secret "{self.namespace}/{self.name}"')
+
+
+def store_client_secret_in_kubernetes(
+    keycloak_admin: KeycloakAdmin,
+    internal_client_id: str,
+    client_id: str,
+    store: "KubernetesSecretStore",
+) -> None:
+    """
+    Retrieve the secret for a Keycloak client and write it to the workload Secret.
+    """
+    try:
+        secret = keycloak_admin.get_client_secrets(internal_client_id)["value"]
+    except KeycloakPostError as e:
+        print(f"Could not retrieve secret for client '{client_id}': {e}")
+        raise
+    store.write(client_id, secret)
+
+
+def split_list(value: str) -> list[str]:
+    """
+    Split a comma-separated variable, dropping empty items.
+    """
+    return [item.strip() for item in value.split(",") if item.strip()]
+
+
+def audience_mapper(audience: str) -> dict[str, Any]:
+    """
+    Build a protocol mapper that adds audience to the client's access tokens.
+    """
+    return {
+        "name": f"audience {audience}"[:255],
+        "protocol": "openid-connect",
+        "protocolMapper": "oidc-audience-mapper",
+        "config": {
+            "included.custom.audience": audience,
+            "access.token.claim": "true",
+            "id.token.claim": "false",
+        },
+    }
+
+
+def client_metadata() -> dict[str, Any]:
+    """
+    Read the descriptive client fields from the CLIENT_* metadata variables.
+    """
+    metadata: dict[str, Any] = {}
+    description = os.environ.get("CLIENT_DESCRIPTION", "")
+    if description:
+        metadata["description"] = description
+    redirect_uris = split_list(os.environ.get("CLIENT_REDIRECT_URIS", ""))
+    if redirect_uris:
+        metadata["redirectUris"] = redirect_uris
+    attributes = json.loads(os.environ.get("CLIENT_ATTRIBUTES") or "{}")
+    if attributes:
+        metadata["attributes"] = attributes
+    audiences = split_list(os.environ.get("CLIENT_AUDIENCES", ""))
+    if audiences:
+        metadata["protocolMappers"] = [audience_mapper(a) for a in audiences]
+    return metadata
+
+
+def update_client_metadata(keycloak_admin: KeycloakAdmin, internal_client_id: str, metadata: dict[str, Any]) -> None:
+    """
+    Apply the metadata to an existing client. Attributes are merged by Keycloak and
+    audience mappers are only added when missing.
+    """
+    mappers = metadata.get("protocolMappers", [])
+    fields = {k: v for k, v in metadata.items() if k != "protocolMappers"}
+    if fields:
+        keycloak_admin.update_client(internal_client_id, fields)
+    existing = {m["name"] for m in keycloak_admin.get_mappers_from_client(internal_client_id)}
+    for mapper in mappers:
+        if mapper["name"] not in existing:
+            keycloak_admin.add_mapper_to_client(internal_client_id, mapper)
+    print("Updated client metadata.")
 
 
 # TODO: refactor this function so kagenti-client-registration image can use it
@@ -98,6 +283,10 @@ def get_client_id() -> str:
     decoded = jwt.decode(content, options={"verify_signature": False})
     if "sub" not in decoded:
         raise Exception('SVID JWT does not contain a "sub" claim.')
+    # SPIFFE_ID (the kagenti.io/spiffe-id annotation) must name the SVID, never another identity
+    spiffe_id = os.environ.get("SPIFFE_ID", "")
+    if spiffe_id and spiffe_id != decoded["sub"]:
+        raise Exception(f'The SVID names "{decoded["sub"]}", not the annotated SPIFFE ID "{spiffe_id}".')
     return decoded["sub"]
 
 client_name = get_env_var("CLIENT_NAME")
@@ -117,6 +306,7 @@ try:
     KEYCLOAK_CLIENT_REGISTRATION_ENABLED = (
         get_env_var("KEYCLOAK_CLIENT_REGISTRATION_ENABLED", "true").lower() == "true"
     )
+    ROTATE_CLIENT_SECRET = get_env_var("ROTATE_CLIENT_SECRET", "false").lower() == "true"
 except ValueError as e:
     print(
         f"Expected environment variable missing. Skipping client registration of {client_id}."
@@ -130,6 +320,15 @@ if not KEYCLOAK_CLIENT_REGISTRATION_ENABLED:
     )
     exit(0)
 
+secret_store = None
+credentials_secret = os.environ.get("CLIENT_CREDENTIALS_SECRET", "")
+if credentials_secret:
+    secret_store = KubernetesSecretStore(get_env_var("POD_NAMESPACE"), credentials_secret)
+    existing = secret_store.read()
+    if not ROTATE_CLIENT_SECRET and existing and existing.get("client-id") == client_id and existing.get("client-secret"):
+        print(f'Reusing credentials of client "{client_id}" from Secret "{credentials_secret}".')
+        exit(0)
+
 keycloak_admin = KeycloakAdmin(
     server_url=KEYCLOAK_URL,
     username=get_env_var("KEYCLOAK_ADMIN_USERNAME"),
@@ -138,29 +337,41 @@ keycloak_admin = KeycloakAdmin(
     user_realm_name="master",
 )
 
-internal_client_id = register_client(
-    keycloak_admin,
-    client_id,
-    {
-        "name": client_name,
-        "clientId": client_id,
-        "standardFlowEnabled": True,
-        "directAccessGrantsEnabled": True,
-        "serviceAccountsEnabled": True,  # Required for client_credentials grant
-        "fullScopeAllowed": False,
-        "publicClient": False,  # Enable client authentication
-        # Enable token exchange for this client.
-        # Token exchange allows this client to exchange tokens for other tokens, potentially across different clients.
-        # Use case: [EXPLAIN THE SPECIFIC USE CASE HERE, e.g., "Required for service-to-service authentication in microservices architecture."]
-        # Security considerations: Ensure only trusted clients have this capability, restrict scopes and permissions as needed,
-        # and audit usage to prevent privilege escalation or unauthorized access.
-        "attributes": {
-            "standard.token.exchange.enabled": str(
-                KEYCLOAK_TOKEN_EXCHANGE_ENABLED
-            ).lower(),  # Enable token exchange
-        },
+metadata = client_metadata()
+client_payload: dict[str, Any] = {
+    "name": client_name,
+    "clientId": client_id,
+    "standardFlowEnabled": True,
+    "directAccessGrantsEnabled": True,
+    "serviceAccountsEnabled": True,  # Required for client_credentials grant
+    "fullScopeAllowed": False,
+    "publicClient": False,  # Enable client authentication
+    # Enable token exchange for this client.
+    # Token exchange allows this client to exchange tokens for other tokens, potentially across different clients.
+    # Use case: [EXPLAIN THE SPECIFIC USE CASE HERE, e.g., "Required for service-to-service authentication in microservices architecture."]
+    # Security considerations: Ensure only trusted clients have this capability, restrict scopes and permissions as needed,
+    # and audit usage to prevent privilege escalation or unauthorized access.
+    "attributes": {
+        "standard.token.exchange.enabled": str(
+            KEYCLOAK_TOKEN_EXCHANGE_ENABLED
+        ).lower(),  # Enable token exchange
     },
-)
+}
+client_payload.update({k: v for k, v in metadata.items() if k != "attributes"})
+client_payload["attributes"].update(metadata.get("attributes", {}))
+
+existed = bool(keycloak_admin.get_client_id(client_id))
+internal_client_id = register_client(keycloak_admin, client_id, client_payload)
+if existed and metadata:
+    update_client_metadata(keycloak_admin, internal_client_id, metadata)
+if existed and ROTATE_CLIENT_SECRET:
+    keycloak_admin.generate_client_secrets(internal_client_id)
+    print(f'Regenerated the secret of client "{client_id}".')
+
+if secret_store is not None:
+    store_client_secret_in_kubernetes(keycloak_admin, internal_client_id, client_id, secret_store)
+    print("Client registration complete.")
+    exit(0)
 
 try:
     secret_file_path = get_env_var("SECRET_FILE_PATH")
@@ -0,0 +1,104 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// authbridge-cni is both the chained CNI plugin (when invoked by the container runtime
+// with CNI_COMMAND set) and the node DaemonSet installer that puts it in place.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/cni"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+var setupLog = ctrl.Log.WithName("setup")
+
+func main() {
+	if os.Getenv("CNI_COMMAND") != "" {
+		os.Exit(runPlugin())
+	}
+
+	var opts cni.InstallOptions
+	var excludeNamespaces string
+	flag.StringVar(&opts.CNIBinDir, "cni-bin-dir", "/host/opt/cni/bin",
+		"Host CNI binary directory as mounted into the installer")
+	flag.StringVar(&opts.CNINetDir, "cni-net-dir", "/host/etc/cni/net.d",
+		"Host CNI network configuration directory as mounted into the installer")
+	flag.StringVar(&opts.HostCNIBinDir, "host-cni-bin-dir", "/opt/cni/bin",
+		"CNI binary directory on the node")
+	flag.StringVar(&opts.HostCNINetDir, "host-cni-net-dir", "/etc/cni/net.d",
+		"CNI network configuration directory on the node")
+	flag.StringVar(&opts.PluginBinary, "plugin-binary", "/authbridge-cni",
+		"Path of the plugin binary to install")
+	flag.StringVar(&opts.RedirectScript, "redirect-script", "/init-iptables.sh",
+		"Path of the iptables redirect script to install")
+	flag.StringVar(&excludeNamespaces, "exclude-namespaces", "kube-system",
+		"Comma-separated namespaces whose pods are never looked up by the plugin")
+	flag.DurationVar(&opts.CheckInterval, "check-interval", cni.DefaultCheckInterval,
+		"How often the installation is re-checked")
+	obsOpts := obs.Options{Service: "authbridge-cni"}
+	obsOpts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	if _, err := obs.SetupLogging(os.Stderr, obsOpts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, ns := range strings.Split(excludeNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			opts.ExcludeNamespaces = append(opts.ExcludeNamespaces, ns)
+		}
+	}
+
+	if err := cni.NewInstaller(opts).Run(ctrl.SetupSignalHandler()); err != nil {
+		setupLog.Error(err, "CNI installer failed")
+		os.Exit(1)
+	}
+}
+
+// runPlugin handles one runtime invocation; stdout is reserved for the CNI result
+func runPlugin() int {
+	stdin, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return pluginError("", err)
+	}
+	if err := cni.NewPlugin().Run(context.Background(), cni.ArgsFromEnv(stdin), os.Stdout); err != nil {
+		conf := &cni.PluginConf{}
+		_ = json.Unmarshal(stdin, conf)
+		return pluginError(conf.CNIVersion, err)
+	}
+	return 0
+}
+
+func pluginError(version string, err error) int {
+	if version == "" {
+		version = "1.0.0"
+	}
+	// 999 is the first code reserved for plugin-specific errors
+	out, _ := json.Marshal(cni.Error{CNIVersion: version, Code: 999, Msg: err.Error()})
+	fmt.Println(string(out))
+	return 1
+}
@@ -0,0 +1,29 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kagenti-authctl helps debugging AuthBridge: it runs the ext_proc token exchange, decodes
+// tokens and explains the webhook's injection decision for a workload.
+package main
+
+import (
+	"os"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/authctl"
+)
+
+func main() {
+	os.Exit(authctl.Run("kagenti-authctl", os.Args[1:]))
+}
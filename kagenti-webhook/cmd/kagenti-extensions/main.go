@@ -0,0 +1,73 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kagenti-extensions runs the kagenti components of this module from one binary, one
+// subcommand each. The subcommands keep the flags of the binaries they replace.
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/authctl"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/manager"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/version"
+)
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "kagenti-extensions",
+		Short:        "kagenti webhooks and tools",
+		Version:      version.Get().Version,
+		SilenceUsage: true,
+	}
+	root.AddCommand(
+		passthrough("webhook", "Run the webhook manager with the MCPServer, Agent and AuthBridge webhooks",
+			func(args []string) {
+				manager.Run("kagenti-webhook", args, manager.AllWebhooks)
+			}),
+		passthrough("toolhive-webhook", "Run the webhook manager with only the MCPServer webhook",
+			func(args []string) {
+				manager.Run("kagenti-toolhive-webhook", args, manager.ToolHiveWebhooks)
+			}),
+		passthrough("authctl", "Debug AuthBridge: exchange and decode tokens, explain injection decisions",
+			func(args []string) {
+				os.Exit(authctl.Run("kagenti-extensions authctl", args))
+			}),
+		newGenerateManifestsCommand(),
+	)
+	return root
+}
+
+// passthrough returns a subcommand that hands its arguments to run unparsed, so the
+// subcommand parses the flags of the binary it replaces
+func passthrough(name, short string, run func(args []string)) *cobra.Command {
+	return &cobra.Command{
+		Use:                name + " [flags]",
+		Short:              short,
+		DisableFlagParsing: true,
+		Run: func(_ *cobra.Command, args []string) {
+			run(args)
+		},
+	}
+}
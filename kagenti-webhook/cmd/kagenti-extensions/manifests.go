@@ -0,0 +1,102 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
+)
+
+// newGenerateManifestsCommand prints the webhook configurations, Service and RBAC built by
+// the registration package, so static deployment manifests cannot drift from the handlers.
+// The defaults match the Helm chart with its default release names.
+func newGenerateManifestsCommand() *cobra.Command {
+	var (
+		prefix             string
+		namespace          string
+		failurePolicy      string
+		operations         string
+		excludedNamespaces []string
+		caInjectFrom       string
+		targetPort         int32
+		rbac               bool
+		namespaceWebhook   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "generate-manifests",
+		Short: "Print the webhook configurations, Service and RBAC as YAML",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ops, err := registration.ParseOperations(operations)
+			if err != nil {
+				return err
+			}
+			policy := admissionregistrationv1.FailurePolicyType(failurePolicy)
+			if policy != admissionregistrationv1.Fail && policy != admissionregistrationv1.Ignore {
+				return fmt.Errorf("--failure-policy must be Fail or Ignore, got %q", failurePolicy)
+			}
+			opts := registration.ManifestOptions{
+				Options: registration.Options{
+					Name:               prefix + "-mutating-webhook-configuration",
+					ServiceName:        prefix + "-webhook-service",
+					ServiceNamespace:   namespace,
+					FailurePolicy:      policy,
+					Operations:         ops,
+					ExcludedNamespaces: excludedNamespaces,
+					CAInjectFrom:       caInjectFrom,
+					NamespaceWebhook:   namespaceWebhook,
+				},
+				ValidatingName: prefix + "-validating-webhook-configuration",
+				TargetPort:     targetPort,
+				Selector: map[string]string{
+					"app.kubernetes.io/name": prefix,
+					"control-plane":          "controller-manager",
+				},
+				Labels: map[string]string{"app.kubernetes.io/name": prefix},
+			}
+			if rbac {
+				opts.ServiceAccountName = prefix
+			}
+			return registration.WriteManifests(cmd.OutOrStdout(), registration.Manifests(opts))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&prefix, "name", "kagenti-webhook",
+		"Prefix of the object names, also the app.kubernetes.io/name label and the ServiceAccount")
+	flags.StringVar(&namespace, "namespace", "kagenti-webhook-system", "Namespace of the webhook Service")
+	flags.StringVar(&failurePolicy, "failure-policy", string(admissionregistrationv1.Fail), "Webhook failurePolicy: Fail or Ignore")
+	flags.StringVar(&operations, "operations", "CREATE,UPDATE", "Operations the webhook rules match: CREATE or CREATE,UPDATE")
+	flags.StringSliceVar(&excludedNamespaces, "excluded-namespaces", registration.DefaultExcludedNamespaces,
+		"Namespaces never sent to the webhooks, in addition to --namespace")
+	flags.StringVar(&caInjectFrom, "ca-inject-from", "",
+		"<namespace>/<certificate> for cert-manager's cainjector, e.g. "+
+			"kagenti-webhook-system/kagenti-webhook-serving-cert; without it, fill in the caBundle yourself")
+	flags.Int32Var(&targetPort, "target-port", registration.DefaultTargetPort, "Webhook server port of the manager pods")
+	flags.BoolVar(&namespaceWebhook, "namespace-webhook", false,
+		"Include the Namespace webhook of the manager's --enable-namespace-webhook")
+	flags.BoolVar(&rbac, "rbac", true, "Include the ClusterRole and ClusterRoleBinding for the ServiceAccount")
+	cmd.Example = strings.Join([]string{
+		"  kagenti-extensions generate-manifests > webhook.yaml",
+		"  kagenti-extensions generate-manifests --operations=CREATE --failure-policy=Ignore",
+	}, "\n")
+	return cmd
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+func fakeToken(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256","kid":"k1"}`)) + "." + encode([]byte(claims)) + ".signature"
+}
+
+func newFakeClient(objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+var _ = Describe("DecodeToken", func() {
+	It("decodes Authorization header values", func() {
+		header, claims, err := DecodeToken("Bearer " + fakeToken(`{"sub":"alice","aud":["a","b"]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header).To(HaveKeyWithValue("kid", "k1"))
+		Expect(claims).To(HaveKeyWithValue("sub", "alice"))
+	})
+
+	It("rejects values that are not JWTs", func() {
+		_, _, err := DecodeToken("opaque-token")
+		Expect(err).To(MatchError(ContainSubstring("not a JWT")))
+	})
+
+	It("prints the time claims and the expiry", func() {
+		var out bytes.Buffer
+		Expect(WriteToken(&out, fakeToken(`{"exp":1700000000}`), time.Unix(1700000060, 0))).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("exp:      2023-11-14T22:13:20Z"))
+		Expect(out.String()).To(ContainSubstring("expired 1m0s ago"))
+	})
+})
+
+var _ = Describe("Exchange", func() {
+	params := ExchangeParams{ClientID: "team1/agent", ClientSecret: "secret", Audience: "tool", Scopes: "openid tool-aud"}
+
+	It("sends the ext_proc's token exchange request", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			Expect(r.PostForm.Get("grant_type")).To(Equal("urn:ietf:params:oauth:grant-type:token-exchange"))
+			Expect(r.PostForm.Get("subject_token")).To(Equal("subject"))
+			Expect(r.PostForm.Get("audience")).To(Equal("tool"))
+			Expect(r.PostForm.Get("scope")).To(Equal("openid tool-aud"))
+			_, _ = w.Write([]byte(`{"access_token":"exchanged","expires_in":300}`))
+		}))
+		defer server.Close()
+
+		withURL := params
+		withURL.TokenURL = server.URL
+		token, err := Exchange(context.Background(), server.Client(), withURL, "subject")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("exchanged"))
+		Expect(token.ExpiresIn).To(Equal(300))
+	})
+
+	It("returns the token endpoint's error", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		withURL := params
+		withURL.TokenURL = server.URL
+		_, err := Exchange(context.Background(), server.Client(), withURL, "subject")
+		Expect(err).To(MatchError(ContainSubstring("invalid_client")))
+	})
+
+	It("lists missing parameters", func() {
+		Expect(params.Validate()).To(MatchError("missing exchange parameters: TOKEN_URL"))
+	})
+
+	It("fills missing parameters from the cluster", func() {
+		c := newFakeClient(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: AuthBridgeConfigMap, Namespace: "team1"},
+				Data:       map[string]string{"TOKEN_URL": "http://keycloak/token", "TARGET_AUDIENCE": "other"},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: injector.ClientCredentialsSecretName("agent"), Namespace: "team1"},
+				Data:       map[string][]byte{injector.ClientIDSecretKey: []byte("id"), injector.ClientSecretSecretKey: []byte("pw")},
+			},
+		)
+		filled := ExchangeParams{Audience: "tool"}
+		Expect(filled.FillFromCluster(context.Background(), c, "team1", "agent")).To(Succeed())
+		Expect(filled).To(Equal(ExchangeParams{TokenURL: "http://keycloak/token", ClientID: "id", ClientSecret: "pw", Audience: "tool"}))
+	})
+})
+
+var _ = Describe("Explain", func() {
+	deployment := func(podLabels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			}},
+		}
+	}
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}}
+
+	It("explains a workload that is not opted in", func() {
+		c := newFakeClient(namespace, deployment(nil))
+		explanation, err := Explain(context.Background(), c, injector.NewPodMutator(c, true), "deploy", "team1", "agent")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explanation.Kind).To(Equal("Deployment"))
+		Expect(explanation.Decision.Inject).To(BeFalse())
+		Expect(explanation.EgressMode).To(Equal("iptables"))
+
+		var out bytes.Buffer
+		explanation.Write(&out)
+		Expect(out.String()).To(ContainSubstring("decision:      not injected (no kagenti.io/inject key"))
+	})
+
+	It("reports missing ConfigMaps of an opted-in workload", func() {
+		c := newFakeClient(namespace, deployment(map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}))
+		explanation, err := Explain(context.Background(), c, injector.NewPodMutator(c, true), "deployment", "team1", "agent")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(explanation.Decision.Inject).To(BeTrue())
+		Expect(explanation.Injected).To(BeFalse())
+		Expect(explanation.Warnings).To(ContainElement(ContainSubstring(injector.EnvoyConfigMap)))
+	})
+
+	It("rejects unsupported kinds", func() {
+		c := newFakeClient(namespace)
+		_, err := Explain(context.Background(), c, injector.NewPodMutator(c, true), "replicaset", "team1", "agent")
+		Expect(err).To(MatchError(ContainSubstring("unsupported kind")))
+	})
+})
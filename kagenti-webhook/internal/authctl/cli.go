@@ -0,0 +1,222 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authctl
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+const usage = `Usage: %[1]s <command> [flags]
+
+Commands:
+  exchange   exchange a token with the parameters of the AuthBridge ext_proc
+  decode     print the header and claims of a token
+  explain    explain why a workload is or is not injected
+
+Run %[1]s <command> -h for the flags of a command. Commands that read the
+cluster use the current kubeconfig context ($KUBECONFIG or ~/.kube/config).
+`
+
+// Run runs the command in args and returns the exit code; prog is the command line that
+// invoked it, used in the usage messages
+func Run(prog string, args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, usage, prog)
+		return 2
+	}
+	var err error
+	switch command, args := args[0], args[1:]; command {
+	case "exchange":
+		err = runExchange(prog, args)
+	case "decode":
+		err = runDecode(prog, args)
+	case "explain":
+		err = runExplain(prog, args)
+	case "help", "-h", "--help":
+		fmt.Fprintf(os.Stdout, usage, prog)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		fmt.Fprintf(os.Stderr, usage, prog)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// newFlagSet returns the flags of a command with -debug, which shows the webhook logs
+func newFlagSet(prog, name, arguments string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n", prog, name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs, fs.Bool("debug", false, "Print the log output of the injection logic")
+}
+
+func setupLogger(debug bool) {
+	if debug {
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true), zap.WriteTo(os.Stderr)))
+		return
+	}
+	ctrl.SetLogger(zap.New(zap.WriteTo(io.Discard)))
+}
+
+func newClient() (client.Client, error) {
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	return client.New(config, client.Options{Scheme: scheme})
+}
+
+func runExchange(prog string, args []string) error {
+	fs, debug := newFlagSet(prog, "exchange", "<subject token | ->")
+	params := ExchangeParamsFromEnv()
+	fs.StringVar(&params.TokenURL, "token-url", params.TokenURL, "Token endpoint (default $TOKEN_URL)")
+	fs.StringVar(&params.ClientID, "client-id", params.ClientID, "Client ID of the workload (default $CLIENT_ID)")
+	fs.StringVar(&params.ClientSecret, "client-secret", params.ClientSecret, "Client secret of the workload (default $CLIENT_SECRET)")
+	fs.StringVar(&params.Audience, "audience", params.Audience, "Target audience (default $TARGET_AUDIENCE)")
+	fs.StringVar(&params.Scopes, "scopes", params.Scopes, "Target scopes (default $TARGET_SCOPES)")
+	namespace := fs.String("namespace", "", "Fill missing parameters from the authbridge-config ConfigMap of this namespace")
+	workload := fs.String("workload", "", "With -namespace, read the client credentials from this workload's credentials Secret")
+	decode := fs.Bool("decode", false, "Print the claims of the exchanged token instead of the token")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of the token request")
+	_ = fs.Parse(args)
+	setupLogger(*debug)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	subjectToken, err := tokenArgument(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if *namespace != "" {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		if err := params.FillFromCluster(ctx, c, *namespace, *workload); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Exchanging at %s as %s for audience %q and scopes %q\n",
+		params.TokenURL, params.ClientID, params.Audience, params.Scopes)
+	token, err := Exchange(ctx, &http.Client{Timeout: *timeout}, params, subjectToken)
+	if err != nil {
+		return err
+	}
+	if *decode {
+		return WriteToken(os.Stdout, token.AccessToken, time.Now())
+	}
+	fmt.Println(token.AccessToken)
+	return nil
+}
+
+func runDecode(prog string, args []string) error {
+	fs, debug := newFlagSet(prog, "decode", "<token | ->")
+	_ = fs.Parse(args)
+	setupLogger(*debug)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	token, err := tokenArgument(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return WriteToken(os.Stdout, token, time.Now())
+}
+
+func runExplain(prog string, args []string) error {
+	fs, debug := newFlagSet(prog, "explain", "<kind>/<name>")
+	namespace := fs.String("namespace", "default", "Namespace of the workload")
+	excludedNamespaces := fs.String("excluded-namespaces", strings.Join(injector.DefaultExcludedNamespaces, ","),
+		"The webhook's --excluded-namespaces")
+	excludedNames := fs.String("excluded-names", "", "The webhook's --excluded-names")
+	namespaceLabel := fs.String("namespace-label", injector.DefaultNamespaceLabel, "Namespace label that enables injection")
+	egressMode := fs.String("egress-mode", string(injector.EgressModeIPTables), "The webhook's --egress-mode")
+	_ = fs.Parse(args)
+	setupLogger(*debug)
+	kind, name, ok := strings.Cut(fs.Arg(0), "/")
+	if fs.NArg() != 1 || !ok || name == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	mutator := injector.NewPodMutator(c, true)
+	mutator.NamespaceLabel = *namespaceLabel
+	mutator.ExcludedNamespaces = nil
+	for _, ns := range strings.Split(*excludedNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			mutator.ExcludedNamespaces = append(mutator.ExcludedNamespaces, ns)
+		}
+	}
+	if mutator.ExcludedNames, err = injector.ParseNamePatterns(strings.Split(*excludedNames, ",")); err != nil {
+		return err
+	}
+	if mutator.EgressMode, err = injector.ParseEgressMode(*egressMode); err != nil {
+		return err
+	}
+
+	explanation, err := Explain(context.Background(), c, mutator, kind, *namespace, name)
+	if err != nil {
+		return err
+	}
+	explanation.Write(os.Stdout)
+	return nil
+}
+
+// tokenArgument returns the token argument, read from stdin for "-"
+func tokenArgument(arg string) (string, error) {
+	if arg != "-" {
+		return arg, nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token from stdin: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authctl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// timeClaims are the JWT claims holding a Unix time
+var timeClaims = []string{"exp", "iat", "nbf", "auth_time"}
+
+// DecodeToken splits a JWT into its header and claims without verifying the signature.
+// A "Bearer " prefix is accepted, so Authorization header values can be pasted as they are.
+func DecodeToken(token string) (header, claims map[string]any, err error) {
+	token = strings.TrimSpace(token)
+	token = strings.TrimPrefix(strings.TrimPrefix(token, "Bearer "), "bearer ")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("not a JWT: expected 3 parts, got %d", len(parts))
+	}
+	if header, err = decodeSegment(parts[0]); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	if claims, err = decodeSegment(parts[1]); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+	return header, claims, nil
+}
+
+// WriteToken prints the header and claims of a JWT as indented JSON, followed by the time
+// claims in UTC and whether the token has expired at now
+func WriteToken(w io.Writer, token string, now time.Time) error {
+	header, claims, err := DecodeToken(token)
+	if err != nil {
+		return err
+	}
+	for _, section := range []struct {
+		title string
+		value map[string]any
+	}{{"Header", header}, {"Claims", claims}} {
+		formatted, err := json.MarshalIndent(section.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s:\n%s\n", section.title, formatted)
+	}
+	for _, name := range timeClaims {
+		seconds, ok := claims[name].(float64)
+		if !ok {
+			continue
+		}
+		at := time.Unix(int64(seconds), 0).UTC()
+		fmt.Fprintf(w, "%-9s %s\n", name+":", at.Format(time.RFC3339))
+		if name == "exp" && !now.Before(at) {
+			fmt.Fprintf(w, "expired %s ago\n", now.Sub(at).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string) (map[string]any, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]any{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
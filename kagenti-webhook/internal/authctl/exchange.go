@@ -0,0 +1,160 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package authctl implements the kagenti-authctl debugging commands: token exchanges with
+// the parameters of the AuthBridge ext_proc, token decoding and injection explanations.
+package authctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+// AuthBridgeConfigMap holds the exchange parameters the webhook hands to envoy-proxy
+const AuthBridgeConfigMap = "authbridge-config"
+
+// ExchangeParams are the inputs of the ext_proc token exchange, named after the
+// go-processor environment variables they correspond to
+type ExchangeParams struct {
+	TokenURL     string // TOKEN_URL
+	ClientID     string // CLIENT_ID
+	ClientSecret string // CLIENT_SECRET
+	Audience     string // TARGET_AUDIENCE
+	Scopes       string // TARGET_SCOPES
+}
+
+// TokenResponse is the token endpoint's answer to an exchange
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type,omitempty"`
+	ExpiresIn       int    `json:"expires_in,omitempty"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// ExchangeParamsFromEnv reads the variables the go-processor reads, so the command can run
+// with the environment of an envoy-proxy container
+func ExchangeParamsFromEnv() ExchangeParams {
+	return ExchangeParams{
+		TokenURL:     os.Getenv("TOKEN_URL"),
+		ClientID:     os.Getenv("CLIENT_ID"),
+		ClientSecret: os.Getenv("CLIENT_SECRET"),
+		Audience:     os.Getenv("TARGET_AUDIENCE"),
+		Scopes:       os.Getenv("TARGET_SCOPES"),
+	}
+}
+
+// FillFromCluster sets the parameters still empty from the namespace's authbridge-config
+// ConfigMap and, if workload is set, its client credentials Secret
+func (p *ExchangeParams) FillFromCluster(ctx context.Context, c client.Client, namespace, workload string) error {
+	config := &corev1.ConfigMap{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: AuthBridgeConfigMap}, config)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, AuthBridgeConfigMap, err)
+	}
+	setIfEmpty(&p.TokenURL, config.Data["TOKEN_URL"])
+	setIfEmpty(&p.Audience, config.Data["TARGET_AUDIENCE"])
+	setIfEmpty(&p.Scopes, config.Data["TARGET_SCOPES"])
+
+	if workload == "" {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	name := injector.ClientCredentialsSecretName(workload)
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, secret); err != nil {
+		return fmt.Errorf("failed to get client credentials Secret %s/%s: %w", namespace, name, err)
+	}
+	setIfEmpty(&p.ClientID, string(secret.Data[injector.ClientIDSecretKey]))
+	setIfEmpty(&p.ClientSecret, string(secret.Data[injector.ClientSecretSecretKey]))
+	return nil
+}
+
+// Validate reports the parameters the ext_proc would be missing; it skips the exchange then
+func (p ExchangeParams) Validate() error {
+	var missing []string
+	for _, param := range []struct{ name, value string }{
+		{"TOKEN_URL", p.TokenURL},
+		{"CLIENT_ID", p.ClientID},
+		{"CLIENT_SECRET", p.ClientSecret},
+		{"TARGET_AUDIENCE", p.Audience},
+		{"TARGET_SCOPES", p.Scopes},
+	} {
+		if param.value == "" {
+			missing = append(missing, param.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing exchange parameters: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Exchange sends the RFC 8693 request the go-processor sends for subjectToken
+func Exchange(ctx context.Context, httpClient *http.Client, params ExchangeParams, subjectToken string) (*TokenResponse, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	data := url.Values{}
+	data.Set("client_id", params.ClientID)
+	data.Set("client_secret", params.ClientSecret)
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:token-exchange")
+	data.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	data.Set("subject_token", subjectToken)
+	data.Set("subject_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	data.Set("audience", params.Audience)
+	data.Set("scope", params.Scopes)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, params.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token exchange request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token endpoint response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	token := &TokenResponse{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("failed to decode token endpoint response: %w", err)
+	}
+	return token, nil
+}
+
+func setIfEmpty(target *string, value string) {
+	if *target == "" {
+		*target = strings.TrimSpace(value)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authctl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+// Explanation is what the webhook would decide for a workload and what it did
+type Explanation struct {
+	Kind, Namespace, Name string
+	Decision              injector.InjectionDecision
+	SpireEnabled          bool
+	EgressMode            string
+	// EgressModeError is the admission error of an invalid egress mode annotation
+	EgressModeError string
+	// Injected, InjectionHash and InjectorVersion are read from the pod template
+	Injected        bool
+	InjectionHash   string
+	InjectorVersion string
+	// Warnings are the admission warnings for missing ConfigMaps and sidecar conflicts
+	Warnings []string
+}
+
+// workloadTemplate fetches a workload of a kind the webhook mutates and returns its object
+// metadata and pod template
+func workloadTemplate(ctx context.Context, c client.Client, kind, namespace, name string) (string, client.Object, *corev1.PodTemplateSpec, error) {
+	key := client.ObjectKey{Namespace: namespace, Name: name}
+	switch strings.ToLower(kind) {
+	case "deployment", "deployments", "deploy":
+		obj := &appsv1.Deployment{}
+		return "Deployment", obj, &obj.Spec.Template, c.Get(ctx, key, obj)
+	case "statefulset", "statefulsets", "sts":
+		obj := &appsv1.StatefulSet{}
+		return "StatefulSet", obj, &obj.Spec.Template, c.Get(ctx, key, obj)
+	case "daemonset", "daemonsets", "ds":
+		obj := &appsv1.DaemonSet{}
+		return "DaemonSet", obj, &obj.Spec.Template, c.Get(ctx, key, obj)
+	case "job", "jobs":
+		obj := &batchv1.Job{}
+		return "Job", obj, &obj.Spec.Template, c.Get(ctx, key, obj)
+	case "cronjob", "cronjobs", "cj":
+		obj := &batchv1.CronJob{}
+		return "CronJob", obj, &obj.Spec.JobTemplate.Spec.Template, c.Get(ctx, key, obj)
+	default:
+		return "", nil, nil, fmt.Errorf("unsupported kind %q: use deployment, statefulset, daemonset, job or cronjob", kind)
+	}
+}
+
+// Explain applies the mutator's injection rules to a workload in the cluster. The mutator
+// should be configured like the webhook (excluded namespaces, namespace label, egress mode).
+func Explain(ctx context.Context, c client.Client, mutator *injector.PodMutator, kind, namespace, name string) (*Explanation, error) {
+	kind, obj, template, err := workloadTemplate(ctx, c, kind, namespace, name)
+	if obj == nil {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+	}
+	decision, err := mutator.DecideInjection(ctx, namespace, name, obj.GetLabels(), &template.ObjectMeta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide injection: %w", err)
+	}
+	explanation := &Explanation{
+		Kind:            kind,
+		Namespace:       namespace,
+		Name:            name,
+		Decision:        decision,
+		SpireEnabled:    injector.IsSpireEnabled(obj.GetLabels()),
+		Injected:        injector.IsInjected(&template.ObjectMeta),
+		InjectionHash:   template.Annotations[injector.InjectionHashAnnotation],
+		InjectorVersion: template.Annotations[injector.InjectorVersionAnnotation],
+	}
+	if mode, err := injector.EgressModeFor(template.Annotations, mutator.EgressMode); err != nil {
+		explanation.EgressModeError = err.Error()
+	} else {
+		explanation.EgressMode = string(mode)
+	}
+	if !decision.Inject {
+		return explanation, nil
+	}
+
+	var podSpec *corev1.PodSpec
+	if explanation.Injected {
+		podSpec = &template.Spec
+	}
+	warnings, err := mutator.CheckRequiredConfigMaps(ctx, namespace, explanation.SpireEnabled, podSpec)
+	if err != nil {
+		// deny mode returns the missing ConfigMaps as an error
+		warnings = append(warnings, err.Error())
+	}
+	explanation.Warnings = append(warnings,
+		mutator.SidecarConflicts(&template.Spec, namespace, name, explanation.SpireEnabled)...)
+	return explanation, nil
+}
+
+// Write prints the explanation for people
+func (e *Explanation) Write(w io.Writer) {
+	fmt.Fprintf(w, "%s %s/%s\n", e.Kind, e.Namespace, e.Name)
+	verdict := "not injected"
+	if e.Decision.Inject {
+		verdict = "injected"
+	}
+	fmt.Fprintf(w, "  decision:      %s (%s)\n", verdict, e.Decision.Reason)
+	fmt.Fprintf(w, "  spire:         %t\n", e.SpireEnabled)
+	if e.EgressModeError != "" {
+		fmt.Fprintf(w, "  egress mode:   invalid, admission is rejected: %s\n", e.EgressModeError)
+	} else {
+		fmt.Fprintf(w, "  egress mode:   %s\n", e.EgressMode)
+	}
+	switch {
+	case e.Injected:
+		fmt.Fprintf(w, "  pod template:  injected by %s (hash %s)\n", valueOr(e.InjectorVersion, "an unknown version"), e.InjectionHash)
+	case e.Decision.Inject:
+		fmt.Fprintf(w, "  pod template:  not injected yet; the webhook only mutates on create and update, so roll out the workload\n")
+	default:
+		fmt.Fprintf(w, "  pod template:  not injected\n")
+	}
+	for _, warning := range e.Warnings {
+		fmt.Fprintf(w, "  warning:       %s\n", warning)
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
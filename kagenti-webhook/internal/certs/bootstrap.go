@@ -0,0 +1,402 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var certLog = logf.Log.WithName("cert-bootstrap")
+
+const (
+	// CACertKey and CAKeyKey hold the CA pair in the Secret next to the standard tls.crt/tls.key
+	CACertKey = "ca.crt"
+	CAKeyKey  = "ca.key"
+	// NextCACertKey and NextCAKeyKey hold the CA that replaces the current one; it is published
+	// in caBundle for CAOverlap before it signs the serving certificate
+	NextCACertKey = "next-ca.crt"
+	NextCAKeyKey  = "next-ca.key"
+	// PreviousCACertKey keeps the replaced CA in caBundle until it expires, for replicas still
+	// serving a certificate it signed
+	PreviousCACertKey = "previous-ca.crt"
+	// NextCAPublishedAnnotation records when the next CA was added to the Secret (RFC 3339)
+	NextCAPublishedAnnotation = "kagenti.io/next-ca-published"
+
+	DefaultCAValidity      = 10 * 365 * 24 * time.Hour
+	DefaultServingValidity = 365 * 24 * time.Hour
+	DefaultRotateBefore    = 30 * 24 * time.Hour
+	DefaultCAOverlap       = 24 * time.Hour
+	DefaultCheckInterval   = time.Hour
+)
+
+// Options configures the self-managed certificate bootstrap
+type Options struct {
+	// Namespace and SecretName locate the Secret that stores the CA and serving pair
+	Namespace  string
+	SecretName string
+	// ServiceName is the webhook Service; it determines the serving certificate DNS names
+	ServiceName string
+	// CertDir, CertName and KeyName are where the serving pair is written for the webhook server
+	CertDir  string
+	CertName string
+	KeyName  string
+	// Names of the webhook configurations whose caBundle is kept in sync
+	MutatingWebhookConfigurations   []string
+	ValidatingWebhookConfigurations []string
+
+	CAValidity      time.Duration
+	ServingValidity time.Duration
+	// RotateBefore is how long before expiry a certificate is regenerated
+	RotateBefore time.Duration
+	// CAOverlap is how long a new CA is published next to the old one before it signs the
+	// serving certificate, so that the API server trusts it by then; keep it below RotateBefore
+	CAOverlap     time.Duration
+	CheckInterval time.Duration
+}
+
+// Bootstrapper generates, stores, rotates and publishes the webhook serving certificates.
+// Every replica runs it: the Secret is the source of truth and optimistic concurrency
+// on it ensures only one replica wins a rotation, the others pick up the result.
+type Bootstrapper struct {
+	Client  client.Client
+	Options Options
+	now     func() time.Time
+}
+
+// NewBootstrapper returns a Bootstrapper with unset durations replaced by defaults
+func NewBootstrapper(c client.Client, opts Options) *Bootstrapper {
+	if opts.CAValidity == 0 {
+		opts.CAValidity = DefaultCAValidity
+	}
+	if opts.ServingValidity == 0 {
+		opts.ServingValidity = DefaultServingValidity
+	}
+	if opts.RotateBefore == 0 {
+		opts.RotateBefore = DefaultRotateBefore
+	}
+	if opts.CAOverlap == 0 {
+		opts.CAOverlap = DefaultCAOverlap
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = DefaultCheckInterval
+	}
+	if opts.CertName == "" {
+		opts.CertName = corev1.TLSCertKey
+	}
+	if opts.KeyName == "" {
+		opts.KeyName = corev1.TLSPrivateKeyKey
+	}
+	return &Bootstrapper{Client: c, Options: opts, now: time.Now}
+}
+
+// DNSNames returns the names the serving certificate is issued for
+func (b *Bootstrapper) DNSNames() []string {
+	svc := b.Options.ServiceName
+	ns := b.Options.Namespace
+	return []string{
+		fmt.Sprintf("%s.%s.svc", svc, ns),
+		fmt.Sprintf("%s.%s.svc.cluster.local", svc, ns),
+		fmt.Sprintf("%s.%s", svc, ns),
+		svc,
+	}
+}
+
+// Ensure makes sure a valid certificate Secret exists, writes the serving pair to
+// CertDir and patches the caBundle of the configured webhook configurations with every
+// CA of the Secret: the current one, and the next or previous one during a CA rotation.
+func (b *Bootstrapper) Ensure(ctx context.Context) error {
+	secret, err := b.ensureSecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := b.writeFiles(secret); err != nil {
+		return fmt.Errorf("failed to write serving certificate: %w", err)
+	}
+
+	return b.patchCABundles(ctx, CABundle(secret))
+}
+
+// CABundle returns the PEM CAs of the Secret that webhook clients must trust
+func CABundle(secret *corev1.Secret) []byte {
+	var bundle []byte
+	for _, key := range []string{CACertKey, NextCACertKey, PreviousCACertKey} {
+		bundle = append(bundle, secret.Data[key]...)
+	}
+	return bundle
+}
+
+// Start implements manager.Runnable and periodically re-runs Ensure to rotate certificates
+func (b *Bootstrapper) Start(ctx context.Context) error {
+	ticker := time.NewTicker(b.Options.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := b.Ensure(ctx); err != nil {
+				certLog.Error(err, "Failed to reconcile webhook certificates, will retry",
+					"interval", b.Options.CheckInterval)
+			}
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; every replica needs the
+// serving pair on local disk, so this must run regardless of leadership.
+func (b *Bootstrapper) NeedLeaderElection() bool {
+	return false
+}
+
+func (b *Bootstrapper) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	key := client.ObjectKey{Namespace: b.Options.Namespace, Name: b.Options.SecretName}
+	secret := &corev1.Secret{}
+	err := b.Client.Get(ctx, key, secret)
+	if apierrors.IsNotFound(err) {
+		certLog.Info("Certificate secret not found, generating a new CA and serving certificate", "secret", key)
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+			Type:       corev1.SecretTypeTLS,
+		}
+		if _, err := b.rotate(secret); err != nil {
+			return nil, err
+		}
+		if err := b.Client.Create(ctx, secret); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return nil, fmt.Errorf("failed to create certificate secret: %w", err)
+			}
+			// Another replica won the race; use its certificates
+			certLog.Info("Certificate secret created concurrently, reusing it", "secret", key)
+			if err := b.Client.Get(ctx, key, secret); err != nil {
+				return nil, fmt.Errorf("failed to get certificate secret: %w", err)
+			}
+		}
+		return secret, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate secret: %w", err)
+	}
+
+	changed, err := b.rotate(secret)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return secret, nil
+	}
+	if err := b.Client.Update(ctx, secret); err != nil {
+		if !apierrors.IsConflict(err) {
+			return nil, fmt.Errorf("failed to update certificate secret: %w", err)
+		}
+		// Another replica rotated first; pick up its result
+		certLog.Info("Certificate secret updated concurrently, reusing it", "secret", key)
+		if err := b.Client.Get(ctx, key, secret); err != nil {
+			return nil, fmt.Errorf("failed to get certificate secret: %w", err)
+		}
+	}
+	return secret, nil
+}
+
+// rotate brings the certificates of the Secret up to date and reports whether it changed.
+// A CA close to expiry is replaced in two steps so that webhook calls never fail: a new CA
+// is first stored as the next CA, which Ensure publishes in caBundle next to the current
+// one, and only after CAOverlap does it become the current CA and sign a new serving
+// certificate. The replaced CA stays in caBundle as the previous CA until it expires. A
+// CA that is missing, invalid or already expired is replaced at once, since nothing can
+// be served with it anyway.
+func (b *Bootstrapper) rotate(secret *corev1.Secret) (bool, error) {
+	now := b.now()
+	deadline := now.Add(b.Options.RotateBefore)
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	changed := false
+
+	ca := &KeyPair{CertPEM: secret.Data[CACertKey], KeyPEM: secret.Data[CAKeyKey]}
+	next := &KeyPair{CertPEM: secret.Data[NextCACertKey], KeyPEM: secret.Data[NextCAKeyKey]}
+	if !ca.usable(now) {
+		certLog.Info("Webhook CA is missing, invalid or expired, replacing it", "secret", client.ObjectKeyFromObject(secret))
+		if next.usable(now) {
+			ca = next
+		} else {
+			newCA, err := b.generateCA(now)
+			if err != nil {
+				return false, err
+			}
+			ca = newCA
+		}
+		next = &KeyPair{}
+		b.setNextCA(secret, nil, now)
+		delete(secret.Data, PreviousCACertKey)
+		changed = true
+	} else if len(next.CertPEM) > 0 && !next.usable(now) {
+		b.setNextCA(secret, nil, now)
+		next = &KeyPair{}
+		changed = true
+	}
+
+	if ca.expiresBefore(deadline) && len(next.CertPEM) == 0 {
+		certLog.Info("Webhook CA is close to expiry, publishing its successor", "secret", client.ObjectKeyFromObject(secret),
+			"overlap", b.Options.CAOverlap)
+		newCA, err := b.generateCA(now)
+		if err != nil {
+			return false, err
+		}
+		b.setNextCA(secret, newCA, now)
+		changed = true
+	} else if len(next.CertPEM) > 0 {
+		published, err := time.Parse(time.RFC3339, secret.Annotations[NextCAPublishedAnnotation])
+		if err != nil {
+			// Without a valid timestamp the overlap starts over
+			b.setNextCA(secret, next, now)
+			changed = true
+		} else if !now.Before(published.Add(b.Options.CAOverlap)) {
+			certLog.Info("Switching to the new webhook CA", "secret", client.ObjectKeyFromObject(secret))
+			secret.Data[PreviousCACertKey] = ca.CertPEM
+			ca = next
+			b.setNextCA(secret, nil, now)
+			changed = true
+		}
+	}
+	secret.Data[CACertKey], secret.Data[CAKeyKey] = ca.CertPEM, ca.KeyPEM
+
+	if previous := secret.Data[PreviousCACertKey]; previous != nil {
+		if notAfter, err := (&KeyPair{CertPEM: previous}).NotAfter(); err != nil || notAfter.Before(now) {
+			delete(secret.Data, PreviousCACertKey)
+			changed = true
+		}
+	}
+
+	serving := &KeyPair{CertPEM: secret.Data[corev1.TLSCertKey], KeyPEM: secret.Data[corev1.TLSPrivateKeyKey]}
+	if !serving.usable(now) || serving.expiresBefore(deadline) || !serving.SignedBy(ca.CertPEM) {
+		certLog.Info("Webhook serving certificate is missing, invalid or close to expiry, rotating",
+			"secret", client.ObjectKeyFromObject(secret))
+		newServing, err := GenerateServingCert(ca, b.DNSNames(), now, b.Options.ServingValidity)
+		if err != nil {
+			return false, err
+		}
+		secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey] = newServing.CertPEM, newServing.KeyPEM
+		changed = true
+	}
+	return changed, nil
+}
+
+func (b *Bootstrapper) generateCA(now time.Time) (*KeyPair, error) {
+	return GenerateCA(fmt.Sprintf("%s-ca", b.Options.ServiceName), now, b.Options.CAValidity)
+}
+
+// setNextCA stores the next CA and when it was published, or removes both for a nil CA
+func (b *Bootstrapper) setNextCA(secret *corev1.Secret, next *KeyPair, now time.Time) {
+	if next == nil {
+		delete(secret.Data, NextCACertKey)
+		delete(secret.Data, NextCAKeyKey)
+		delete(secret.Annotations, NextCAPublishedAnnotation)
+		return
+	}
+	secret.Data[NextCACertKey], secret.Data[NextCAKeyKey] = next.CertPEM, next.KeyPEM
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[NextCAPublishedAnnotation] = now.UTC().Format(time.RFC3339)
+}
+
+func (b *Bootstrapper) writeFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(b.Options.CertDir, 0o700); err != nil {
+		return err
+	}
+	// Write the key before the certificate: the cert watcher reloads on certificate changes
+	if err := writeFileIfChanged(filepath.Join(b.Options.CertDir, b.Options.KeyName), secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+		return err
+	}
+	return writeFileIfChanged(filepath.Join(b.Options.CertDir, b.Options.CertName), secret.Data[corev1.TLSCertKey])
+}
+
+func writeFileIfChanged(path string, data []byte) error {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (b *Bootstrapper) patchCABundles(ctx context.Context, caBundle []byte) error {
+	for _, name := range b.Options.MutatingWebhookConfigurations {
+		cfg := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		if err := b.Client.Get(ctx, client.ObjectKey{Name: name}, cfg); err != nil {
+			if apierrors.IsNotFound(err) {
+				certLog.Info("MutatingWebhookConfiguration not found, skipping caBundle injection", "name", name)
+				continue
+			}
+			return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %w", name, err)
+		}
+		changed := false
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if changed {
+			if err := b.Client.Update(ctx, cfg); err != nil {
+				return fmt.Errorf("failed to update caBundle of MutatingWebhookConfiguration %s: %w", name, err)
+			}
+			certLog.Info("Updated caBundle", "mutatingWebhookConfiguration", name)
+		}
+	}
+
+	for _, name := range b.Options.ValidatingWebhookConfigurations {
+		cfg := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		if err := b.Client.Get(ctx, client.ObjectKey{Name: name}, cfg); err != nil {
+			if apierrors.IsNotFound(err) {
+				certLog.Info("ValidatingWebhookConfiguration not found, skipping caBundle injection", "name", name)
+				continue
+			}
+			return fmt.Errorf("failed to get ValidatingWebhookConfiguration %s: %w", name, err)
+		}
+		changed := false
+		for i := range cfg.Webhooks {
+			if !bytes.Equal(cfg.Webhooks[i].ClientConfig.CABundle, caBundle) {
+				cfg.Webhooks[i].ClientConfig.CABundle = caBundle
+				changed = true
+			}
+		}
+		if changed {
+			if err := b.Client.Update(ctx, cfg); err != nil {
+				return fmt.Errorf("failed to update caBundle of ValidatingWebhookConfiguration %s: %w", name, err)
+			}
+			certLog.Info("Updated caBundle", "validatingWebhookConfiguration", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Bootstrapper", func() {
+	var (
+		ctx          context.Context
+		k8sClient    client.Client
+		bootstrapper *Bootstrapper
+		certDir      string
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+
+		mwc := &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "kagenti-webhook"},
+			Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "inject.kagenti.io"}},
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(mwc).Build()
+		certDir = GinkgoT().TempDir()
+
+		bootstrapper = NewBootstrapper(k8sClient, Options{
+			Namespace:                     "kagenti-webhook-system",
+			SecretName:                    "webhook-cert",
+			ServiceName:                   "kagenti-webhook-webhook-service",
+			CertDir:                       certDir,
+			MutatingWebhookConfigurations: []string{"kagenti-webhook", "not-installed"},
+		})
+	})
+
+	getSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "kagenti-webhook-system", Name: "webhook-cert"}, secret)).To(Succeed())
+		return secret
+	}
+
+	It("creates the secret, writes the serving pair and injects the caBundle", func() {
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+
+		secret := getSecret()
+		serving := &KeyPair{CertPEM: secret.Data[corev1.TLSCertKey], KeyPEM: secret.Data[corev1.TLSPrivateKeyKey]}
+		Expect(serving.SignedBy(secret.Data[CACertKey])).To(BeTrue())
+
+		onDisk, err := os.ReadFile(filepath.Join(certDir, corev1.TLSCertKey))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(onDisk).To(Equal(secret.Data[corev1.TLSCertKey]))
+
+		mwc := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "kagenti-webhook"}, mwc)).To(Succeed())
+		Expect(mwc.Webhooks[0].ClientConfig.CABundle).To(Equal(secret.Data[CACertKey]))
+	})
+
+	It("reuses valid certificates on subsequent runs", func() {
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		first := getSecret()
+
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		Expect(getSecret().Data).To(Equal(first.Data))
+	})
+
+	It("rotates the serving certificate before expiry but keeps the CA", func() {
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		first := getSecret()
+
+		bootstrapper.now = func() time.Time { return time.Now().Add(DefaultServingValidity - 24*time.Hour) }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+
+		rotated := getSecret()
+		Expect(rotated.Data[corev1.TLSCertKey]).NotTo(Equal(first.Data[corev1.TLSCertKey]))
+		Expect(rotated.Data[CACertKey]).To(Equal(first.Data[CACertKey]))
+	})
+
+	It("publishes a new CA next to the old one before it signs the serving certificate", func() {
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		oldCA := getSecret().Data[CACertKey]
+		caBundle := func() []byte {
+			mwc := &admissionregistrationv1.MutatingWebhookConfiguration{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "kagenti-webhook"}, mwc)).To(Succeed())
+			return mwc.Webhooks[0].ClientConfig.CABundle
+		}
+		signedBy := func(secret *corev1.Secret, caPEM []byte) bool {
+			serving := &KeyPair{CertPEM: secret.Data[corev1.TLSCertKey]}
+			return serving.SignedBy(caPEM)
+		}
+
+		// The CA is within the rotation window: its successor is only published
+		start := time.Now().Add(DefaultCAValidity - 10*24*time.Hour)
+		bootstrapper.now = func() time.Time { return start }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		published := getSecret()
+		newCA := published.Data[NextCACertKey]
+		Expect(newCA).NotTo(BeEmpty())
+		Expect(published.Data[CACertKey]).To(Equal(oldCA))
+		Expect(published.Annotations).To(HaveKey(NextCAPublishedAnnotation))
+		Expect(signedBy(published, oldCA)).To(BeTrue())
+		Expect(caBundle()).To(Equal(append(append([]byte{}, oldCA...), newCA...)))
+
+		// Nothing changes during the overlap
+		bootstrapper.now = func() time.Time { return start.Add(DefaultCAOverlap - time.Hour) }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		Expect(getSecret().Data).To(Equal(published.Data))
+
+		// After it the new CA signs the serving certificate, the old one stays trusted
+		bootstrapper.now = func() time.Time { return start.Add(DefaultCAOverlap) }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		switched := getSecret()
+		Expect(switched.Data[CACertKey]).To(Equal(newCA))
+		Expect(switched.Data).NotTo(HaveKey(NextCACertKey))
+		Expect(switched.Data[PreviousCACertKey]).To(Equal(oldCA))
+		Expect(switched.Annotations).NotTo(HaveKey(NextCAPublishedAnnotation))
+		Expect(signedBy(switched, newCA)).To(BeTrue())
+		Expect(caBundle()).To(Equal(append(append([]byte{}, newCA...), oldCA...)))
+
+		// The old CA leaves caBundle once it has expired
+		bootstrapper.now = func() time.Time { return start.Add(11 * 24 * time.Hour) }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		Expect(getSecret().Data).NotTo(HaveKey(PreviousCACertKey))
+		Expect(caBundle()).To(Equal(newCA))
+	})
+
+	It("replaces an expired CA at once", func() {
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		oldCA := getSecret().Data[CACertKey]
+
+		bootstrapper.now = func() time.Time { return time.Now().Add(DefaultCAValidity + time.Hour) }
+		Expect(bootstrapper.Ensure(ctx)).To(Succeed())
+		replaced := getSecret()
+		Expect(replaced.Data[CACertKey]).NotTo(Equal(oldCA))
+		Expect(replaced.Data).NotTo(HaveKey(NextCACertKey))
+		Expect(replaced.Data).NotTo(HaveKey(PreviousCACertKey))
+		serving := &KeyPair{CertPEM: replaced.Data[corev1.TLSCertKey]}
+		Expect(serving.SignedBy(replaced.Data[CACertKey])).To(BeTrue())
+	})
+})
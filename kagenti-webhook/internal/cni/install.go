@@ -0,0 +1,313 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cni
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var installLog = logf.Log.WithName("cni-installer")
+
+const (
+	DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	DefaultCheckInterval     = 30 * time.Second
+
+	// KubeconfigName is the file written next to the CNI network configuration
+	KubeconfigName = "authbridge-cni.kubeconfig"
+	// ScriptName is the redirect script copied next to the plugin binary
+	ScriptName = "authbridge-iptables.sh"
+)
+
+// InstallOptions configures the node installer
+type InstallOptions struct {
+	// CNIBinDir and CNINetDir are the host CNI directories as mounted into the installer
+	CNIBinDir string
+	CNINetDir string
+	// HostCNIBinDir and HostCNINetDir are the same directories as seen by the container runtime
+	HostCNIBinDir string
+	HostCNINetDir string
+	// PluginBinary and RedirectScript are the sources copied from the installer image
+	PluginBinary   string
+	RedirectScript string
+
+	ExcludeNamespaces []string
+	ServiceAccountDir string
+	// APIServerHost and APIServerPort default to the in-cluster service environment
+	APIServerHost string
+	APIServerPort string
+	CheckInterval time.Duration
+}
+
+// Installer keeps the plugin, its kubeconfig and its network configuration entry on the node
+type Installer struct {
+	Options InstallOptions
+}
+
+// NewInstaller returns an Installer with unset options replaced by defaults
+func NewInstaller(opts InstallOptions) *Installer {
+	if opts.HostCNIBinDir == "" {
+		opts.HostCNIBinDir = opts.CNIBinDir
+	}
+	if opts.HostCNINetDir == "" {
+		opts.HostCNINetDir = opts.CNINetDir
+	}
+	if opts.ServiceAccountDir == "" {
+		opts.ServiceAccountDir = DefaultServiceAccountDir
+	}
+	if opts.APIServerHost == "" {
+		opts.APIServerHost = os.Getenv("KUBERNETES_SERVICE_HOST")
+	}
+	if opts.APIServerPort == "" {
+		opts.APIServerPort = os.Getenv("KUBERNETES_SERVICE_PORT")
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = DefaultCheckInterval
+	}
+	return &Installer{Options: opts}
+}
+
+// Run installs the plugin, re-checks it periodically (the primary CNI may rewrite its
+// configuration and service account tokens rotate) and uninstalls it when ctx ends.
+func (i *Installer) Run(ctx context.Context) error {
+	if err := i.Install(); err != nil {
+		return err
+	}
+	installLog.Info("AuthBridge CNI plugin installed", "netDir", i.Options.CNINetDir)
+
+	ticker := time.NewTicker(i.Options.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			installLog.Info("Removing AuthBridge CNI plugin from the network configuration")
+			return i.Uninstall()
+		case <-ticker.C:
+			if err := i.Install(); err != nil {
+				installLog.Error(err, "Failed to reconcile CNI installation, will retry",
+					"interval", i.Options.CheckInterval)
+			}
+		}
+	}
+}
+
+// Install copies the binary and script, writes the kubeconfig and chains the plugin
+// into the primary network configuration. It is idempotent.
+func (i *Installer) Install() error {
+	if err := copyFile(i.Options.PluginBinary, filepath.Join(i.Options.CNIBinDir, PluginType), 0o755); err != nil {
+		return fmt.Errorf("failed to install plugin binary: %w", err)
+	}
+	if err := copyFile(i.Options.RedirectScript, filepath.Join(i.Options.CNIBinDir, ScriptName), 0o755); err != nil {
+		return fmt.Errorf("failed to install redirect script: %w", err)
+	}
+
+	kubeconfig, err := i.kubeconfig()
+	if err != nil {
+		return err
+	}
+	if err := writeFileIfChanged(filepath.Join(i.Options.CNINetDir, KubeconfigName), kubeconfig, 0o600); err != nil {
+		return fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	path, err := PrimaryConfig(i.Options.CNINetDir)
+	if err != nil {
+		return err
+	}
+	return i.patchConfig(path, true)
+}
+
+// Uninstall removes the plugin entry so new pods are no longer intercepted by it
+func (i *Installer) Uninstall() error {
+	path, err := PrimaryConfig(i.Options.CNINetDir)
+	if err != nil {
+		return err
+	}
+	if err := i.patchConfig(path, false); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(i.Options.CNINetDir, KubeconfigName))
+}
+
+// PluginEntry returns the entry appended to the plugin chain
+func (i *Installer) PluginEntry() map[string]any {
+	exclude := make([]any, 0, len(i.Options.ExcludeNamespaces))
+	for _, ns := range i.Options.ExcludeNamespaces {
+		exclude = append(exclude, ns)
+	}
+	return map[string]any{
+		"type":              PluginType,
+		"kubeconfig":        filepath.Join(i.Options.HostCNINetDir, KubeconfigName),
+		"redirectScript":    filepath.Join(i.Options.HostCNIBinDir, ScriptName),
+		"excludeNamespaces": exclude,
+	}
+}
+
+// PrimaryConfig returns the network configuration the runtime uses: the
+// lexicographically first .conflist, .conf or .json file in dir
+func PrimaryConfig(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CNI configuration directory: %w", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		switch filepath.Ext(e.Name()) {
+		case ".conflist", ".conf", ".json":
+			if !e.IsDir() {
+				names = append(names, e.Name())
+			}
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("no CNI network configuration found in %s", dir)
+	}
+	sort.Strings(names)
+	return filepath.Join(dir, names[0]), nil
+}
+
+// patchConfig adds (or refreshes) or removes the plugin entry of the configuration at path.
+// A single-plugin .conf is converted to a .conflist since chaining requires one.
+func (i *Installer) patchConfig(path string, add bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	conf := map[string]any{}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	target := path
+	if _, ok := conf["plugins"]; !ok {
+		if !add {
+			return nil
+		}
+		plugin := map[string]any{}
+		for k, v := range conf {
+			if k != "cniVersion" && k != "name" {
+				plugin[k] = v
+			}
+		}
+		conf = map[string]any{"cniVersion": conf["cniVersion"], "name": conf["name"], "plugins": []any{plugin}}
+		target = strings.TrimSuffix(path, filepath.Ext(path)) + ".conflist"
+	}
+
+	plugins, ok := conf["plugins"].([]any)
+	if !ok {
+		return fmt.Errorf("%s: plugins is not a list", path)
+	}
+	chain := make([]any, 0, len(plugins)+1)
+	for _, p := range plugins {
+		if entry, ok := p.(map[string]any); ok && entry["type"] == PluginType {
+			continue
+		}
+		chain = append(chain, p)
+	}
+	if add {
+		chain = append(chain, i.PluginEntry())
+	}
+	conf["plugins"] = chain
+
+	out, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileIfChanged(target, append(out, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	if target != path {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// kubeconfig builds a kubeconfig from the installer's own service account
+func (i *Installer) kubeconfig() ([]byte, error) {
+	if i.Options.APIServerHost == "" || i.Options.APIServerPort == "" {
+		return nil, errors.New("API server address is unknown, KUBERNETES_SERVICE_HOST/PORT are not set")
+	}
+	token, err := os.ReadFile(filepath.Join(i.Options.ServiceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	ca, err := os.ReadFile(filepath.Join(i.Options.ServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+
+	server := "https://" + net.JoinHostPort(i.Options.APIServerHost, i.Options.APIServerPort)
+	return []byte(fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: local
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: %s
+  user:
+    token: %s
+contexts:
+- name: %s
+  context:
+    cluster: local
+    user: %s
+current-context: %s
+`, server, base64.StdEncoding.EncodeToString(ca), PluginType, strings.TrimSpace(string(token)),
+		PluginType, PluginType, PluginType)), nil
+}
+
+// copyFile atomically replaces dst so a running runtime never executes a partial binary
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	return writeFileIfChanged(dst, data, mode)
+}
+
+func writeFileIfChanged(path string, data []byte, mode os.FileMode) error {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cni
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Installer", func() {
+	var (
+		installer *Installer
+		netDir    string
+		binDir    string
+	)
+
+	readPlugins := func(path string) []map[string]any {
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		conf := struct {
+			Plugins []map[string]any `json:"plugins"`
+		}{}
+		Expect(json.Unmarshal(data, &conf)).To(Succeed())
+		return conf.Plugins
+	}
+
+	BeforeEach(func() {
+		root := GinkgoT().TempDir()
+		netDir = filepath.Join(root, "net.d")
+		binDir = filepath.Join(root, "bin")
+		saDir := filepath.Join(root, "sa")
+		for _, dir := range []string{netDir, binDir, saDir} {
+			Expect(os.MkdirAll(dir, 0o755)).To(Succeed())
+		}
+		Expect(os.WriteFile(filepath.Join(saDir, "token"), []byte("token\n"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(saDir, "ca.crt"), []byte("ca"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "plugin"), []byte("binary"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(root, "script.sh"), []byte("#!/bin/sh"), 0o755)).To(Succeed())
+
+		installer = NewInstaller(InstallOptions{
+			CNIBinDir:         binDir,
+			CNINetDir:         netDir,
+			HostCNIBinDir:     "/opt/cni/bin",
+			HostCNINetDir:     "/etc/cni/net.d",
+			PluginBinary:      filepath.Join(root, "plugin"),
+			RedirectScript:    filepath.Join(root, "script.sh"),
+			ExcludeNamespaces: []string{"kube-system"},
+			ServiceAccountDir: saDir,
+			APIServerHost:     "fd00::1",
+			APIServerPort:     "443",
+		})
+	})
+
+	It("chains the plugin into the primary conflist exactly once", func() {
+		conflist := filepath.Join(netDir, "10-kindnet.conflist")
+		Expect(os.WriteFile(conflist, []byte(`{"cniVersion":"1.0.0","name":"kindnet","plugins":[{"type":"ptp"},{"type":"portmap"}]}`), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(netDir, "20-other.conflist"), []byte(`{"plugins":[]}`), 0o644)).To(Succeed())
+
+		Expect(installer.Install()).To(Succeed())
+		Expect(installer.Install()).To(Succeed())
+
+		plugins := readPlugins(conflist)
+		Expect(plugins).To(HaveLen(3))
+		Expect(plugins[2]).To(HaveKeyWithValue("type", PluginType))
+		Expect(plugins[2]).To(HaveKeyWithValue("kubeconfig", "/etc/cni/net.d/"+KubeconfigName))
+		Expect(plugins[2]).To(HaveKeyWithValue("redirectScript", "/opt/cni/bin/"+ScriptName))
+		Expect(readPlugins(filepath.Join(netDir, "20-other.conflist"))).To(BeEmpty())
+
+		Expect(filepath.Join(binDir, PluginType)).To(BeAnExistingFile())
+		kubeconfig, err := os.ReadFile(filepath.Join(netDir, KubeconfigName))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(kubeconfig)).To(ContainSubstring("server: https://[fd00::1]:443"))
+		Expect(string(kubeconfig)).To(ContainSubstring("token: token\n"))
+	})
+
+	It("converts a single-plugin conf into a conflist", func() {
+		conf := filepath.Join(netDir, "10-bridge.conf")
+		Expect(os.WriteFile(conf, []byte(`{"cniVersion":"0.4.0","name":"bridge","type":"bridge","bridge":"cni0"}`), 0o644)).To(Succeed())
+
+		Expect(installer.Install()).To(Succeed())
+		Expect(conf).NotTo(BeAnExistingFile())
+
+		plugins := readPlugins(filepath.Join(netDir, "10-bridge.conflist"))
+		Expect(plugins).To(HaveLen(2))
+		Expect(plugins[0]).To(HaveKeyWithValue("bridge", "cni0"))
+		Expect(plugins[0]).NotTo(HaveKey("name"))
+		Expect(plugins[1]).To(HaveKeyWithValue("type", PluginType))
+	})
+
+	It("removes its entry and kubeconfig on uninstall", func() {
+		conflist := filepath.Join(netDir, "10-kindnet.conflist")
+		Expect(os.WriteFile(conflist, []byte(`{"cniVersion":"1.0.0","name":"kindnet","plugins":[{"type":"ptp"}]}`), 0o644)).To(Succeed())
+
+		Expect(installer.Install()).To(Succeed())
+		Expect(installer.Uninstall()).To(Succeed())
+
+		Expect(readPlugins(conflist)).To(ConsistOf(HaveKeyWithValue("type", "ptp")))
+		Expect(filepath.Join(netDir, KubeconfigName)).NotTo(BeAnExistingFile())
+	})
+
+	It("fails when there is no network configuration yet", func() {
+		Expect(installer.Install()).To(MatchError(ContainSubstring("no CNI network configuration")))
+	})
+})
@@ -0,0 +1,314 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cni implements the AuthBridge CNI plugin, a chained plugin that sets up the
+// outbound traffic redirection of annotated pods from the node, and its installer.
+// It replaces the privileged proxy-init container for PSS-restricted namespaces.
+package cni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+const (
+	// PluginType is the "type" of the plugin entry in the CNI network configuration
+	PluginType = "authbridge-cni"
+
+	// supportedVersions are the CNI spec versions the plugin accepts
+	supportedVersions = `["0.3.0","0.3.1","0.4.0","1.0.0","1.1.0"]`
+
+	podLookupTimeout = 10 * time.Second
+)
+
+// PluginConf is the network configuration the runtime passes on stdin
+type PluginConf struct {
+	CNIVersion string          `json:"cniVersion"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	PrevResult json.RawMessage `json:"prevResult,omitempty"`
+
+	// Kubeconfig is the host path of the kubeconfig written by the installer
+	Kubeconfig string `json:"kubeconfig"`
+	// RedirectScript is the host path of the iptables script shared with proxy-init
+	RedirectScript string `json:"redirectScript"`
+	// ExcludeNamespaces are passed through without looking the pod up
+	ExcludeNamespaces []string `json:"excludeNamespaces,omitempty"`
+}
+
+// Args are the CNI_* parameters of one invocation
+type Args struct {
+	Command     string
+	ContainerID string
+	Netns       string
+	Args        string
+	StdinData   []byte
+}
+
+// ArgsFromEnv reads the invocation parameters from the environment
+func ArgsFromEnv(stdin []byte) Args {
+	return Args{
+		Command:     os.Getenv("CNI_COMMAND"),
+		ContainerID: os.Getenv("CNI_CONTAINERID"),
+		Netns:       os.Getenv("CNI_NETNS"),
+		Args:        os.Getenv("CNI_ARGS"),
+		StdinData:   stdin,
+	}
+}
+
+// Plugin handles CNI invocations; the hooks are replaceable for tests
+type Plugin struct {
+	GetPod     func(ctx context.Context, conf *PluginConf, namespace, name string) (*corev1.Pod, error)
+	RunInNetNS func(netns string, fn func() error) error
+	RunScript  func(script string, env []string) ([]byte, error)
+	Log        io.Writer
+}
+
+// NewPlugin returns a Plugin that talks to the API server and runs the script in the pod netns
+func NewPlugin() *Plugin {
+	return &Plugin{
+		GetPod:     getPod,
+		RunInNetNS: RunInNetNS,
+		RunScript:  runScript,
+		Log:        os.Stderr,
+	}
+}
+
+// Error is the error result defined by the CNI spec
+type Error struct {
+	CNIVersion string `json:"cniVersion"`
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+}
+
+// Run executes one CNI command and writes its result to stdout
+func (p *Plugin) Run(ctx context.Context, args Args, stdout io.Writer) error {
+	switch args.Command {
+	case "VERSION":
+		_, err := fmt.Fprintf(stdout, `{"cniVersion":"1.0.0","supportedVersions":%s}`, supportedVersions)
+		return err
+	case "ADD":
+		conf := &PluginConf{}
+		if err := json.Unmarshal(args.StdinData, conf); err != nil {
+			return fmt.Errorf("failed to parse network configuration: %w", err)
+		}
+		if err := p.add(ctx, conf, args); err != nil {
+			return err
+		}
+		return writeResult(conf, stdout)
+	case "DEL", "CHECK", "GC", "STATUS":
+		// The rules live in the pod network namespace and disappear with it
+		return nil
+	default:
+		return fmt.Errorf("unsupported CNI_COMMAND %q", args.Command)
+	}
+}
+
+func (p *Plugin) add(ctx context.Context, conf *PluginConf, args Args) error {
+	k8sArgs := parseCNIArgs(args.Args)
+	namespace, name := k8sArgs["K8S_POD_NAMESPACE"], k8sArgs["K8S_POD_NAME"]
+	if namespace == "" || name == "" {
+		return nil
+	}
+	for _, excluded := range conf.ExcludeNamespaces {
+		if namespace == excluded {
+			return nil
+		}
+	}
+
+	// Fail closed: a pod that asked for redirection must not start without it
+	pod, err := p.GetPod(ctx, conf, namespace, name)
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s/%s: %w", namespace, name, err)
+	}
+	if pod.Annotations[injector.RedirectAnnotation] != injector.RedirectCNI {
+		return nil
+	}
+
+	env, err := redirectEnv(pod.Annotations[injector.RedirectEnvAnnotation])
+	if err != nil {
+		return fmt.Errorf("pod %s/%s: %w", namespace, name, err)
+	}
+
+	fmt.Fprintf(p.Log, "authbridge-cni: configuring redirection for pod %s/%s in %s\n", namespace, name, args.Netns)
+	return p.RunInNetNS(args.Netns, func() error {
+		out, err := p.RunScript(conf.RedirectScript, env)
+		if err != nil {
+			return fmt.Errorf("redirect script failed for pod %s/%s: %w: %s", namespace, name, err, out)
+		}
+		return nil
+	})
+}
+
+// redirectEnvVars are the init-iptables.sh variables the annotation may set, with their
+// validation. Anyone who can create pods can write the annotation, and the script runs as
+// root on the node, so nothing else, such as PATH or LD_PRELOAD, is passed through.
+var redirectEnvVars = map[string]func(string) error{
+	"PROXY_PORT":                 validPort,
+	"PROXY_UID":                  validUID,
+	"INBOUND_PROXY_PORT":         validPort,
+	"INBOUND_PORTS_INCLUDE":      validInboundPorts,
+	"INBOUND_AUTH_PORT":          validPort,
+	"INBOUND_AUTH_PROXY_PORT":    validPort,
+	"INTERCEPTION_MODE":          oneOf(string(injector.InterceptionModeRedirect), string(injector.InterceptionModeTProxy)),
+	"IP_FAMILIES":                oneOf(string(injector.IPFamiliesAuto), string(injector.IPFamiliesIPv4), string(injector.IPFamiliesIPv6), string(injector.IPFamiliesDual)),
+	"OUTBOUND_PORTS_EXCLUDE":     listOf(validPort),
+	"OUTBOUND_IP_RANGES_EXCLUDE": listOf(validCIDR),
+	"OUTBOUND_UIDS_EXCLUDE":      listOf(validUID),
+	"TPROXY_MARK":                validUint32,
+	"TPROXY_ROUTE_TABLE":         validUint32,
+}
+
+// redirectEnv turns the annotation written by the webhook into a sorted environment
+func redirectEnv(annotation string) ([]string, error) {
+	values := map[string]string{}
+	if annotation != "" {
+		if err := json.Unmarshal([]byte(annotation), &values); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", injector.RedirectEnvAnnotation, err)
+		}
+	}
+	env := make([]string, 0, len(values)+1)
+	for name, value := range values {
+		validate, ok := redirectEnvVars[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s annotation: %s is not a redirection setting", injector.RedirectEnvAnnotation, name)
+		}
+		if err := validate(value); err != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %s: %w", injector.RedirectEnvAnnotation, name, err)
+		}
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return append(env, "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"), nil
+}
+
+func validPort(value string) error {
+	if port, err := strconv.ParseUint(value, 10, 16); err != nil || port == 0 {
+		return fmt.Errorf("%q is not a valid port", value)
+	}
+	return nil
+}
+
+func validUID(value string) error {
+	if _, err := strconv.ParseUint(value, 10, 32); err != nil {
+		return fmt.Errorf("%q is not a valid UID", value)
+	}
+	return nil
+}
+
+func validUint32(value string) error {
+	if _, err := strconv.ParseUint(value, 0, 32); err != nil {
+		return fmt.Errorf("%q is not a valid number", value)
+	}
+	return nil
+}
+
+func validCIDR(value string) error {
+	if _, _, err := net.ParseCIDR(value); err != nil {
+		return fmt.Errorf("%q is not a valid CIDR", value)
+	}
+	return nil
+}
+
+// validInboundPorts accepts a list of ports, or "*" alone to capture every port
+func validInboundPorts(value string) error {
+	if value == "*" {
+		return nil
+	}
+	return listOf(validPort)(value)
+}
+
+// listOf validates each item of a comma-separated list
+func listOf(validate func(string) error) func(string) error {
+	return func(value string) error {
+		if value == "" {
+			return nil
+		}
+		for _, item := range strings.Split(value, ",") {
+			if err := validate(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, a := range allowed {
+			if value == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q must be one of %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+// parseCNIArgs parses "K1=V1;K2=V2"
+func parseCNIArgs(value string) map[string]string {
+	args := map[string]string{}
+	for _, pair := range strings.Split(value, ";") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			args[k] = v
+		}
+	}
+	return args
+}
+
+// writeResult passes the previous plugin's result through unchanged
+func writeResult(conf *PluginConf, stdout io.Writer) error {
+	if len(conf.PrevResult) > 0 {
+		_, err := stdout.Write(conf.PrevResult)
+		return err
+	}
+	return json.NewEncoder(stdout).Encode(map[string]string{"cniVersion": conf.CNIVersion})
+}
+
+func getPod(ctx context.Context, conf *PluginConf, namespace, name string) (*corev1.Pod, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags("", conf.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %w", conf.Kubeconfig, err)
+	}
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, podLookupTimeout)
+	defer cancel()
+	return clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func runScript(script string, env []string) ([]byte, error) {
+	cmd := exec.Command("/bin/sh", script)
+	cmd.Env = env
+	return cmd.CombinedOutput()
+}
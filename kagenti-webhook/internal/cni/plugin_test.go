@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cni
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("Plugin", func() {
+	var (
+		plugin    *Plugin
+		pod       *corev1.Pod
+		getErr    error
+		scriptEnv []string
+		netns     string
+		stdout    *bytes.Buffer
+	)
+
+	conf := `{"cniVersion":"1.0.0","name":"k8s","type":"authbridge-cni",` +
+		`"redirectScript":"/opt/cni/bin/authbridge-iptables.sh","excludeNamespaces":["kube-system"],` +
+		`"prevResult":{"cniVersion":"1.0.0","ips":[{"address":"10.0.0.5/24"}]}}`
+
+	add := func(cniArgs string) error {
+		return plugin.Run(context.Background(), Args{
+			Command:   "ADD",
+			Netns:     "/var/run/netns/test",
+			Args:      cniArgs,
+			StdinData: []byte(conf),
+		}, stdout)
+	}
+
+	BeforeEach(func() {
+		pod = &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1"}}
+		getErr = nil
+		scriptEnv = nil
+		netns = ""
+		stdout = &bytes.Buffer{}
+		plugin = &Plugin{
+			GetPod: func(_ context.Context, _ *PluginConf, namespace, name string) (*corev1.Pod, error) {
+				return pod, getErr
+			},
+			RunInNetNS: func(path string, fn func() error) error {
+				netns = path
+				return fn()
+			},
+			RunScript: func(script string, env []string) ([]byte, error) {
+				scriptEnv = env
+				return nil, nil
+			},
+			Log: GinkgoWriter,
+		}
+	})
+
+	It("runs the redirect script in the pod netns with the annotated environment", func() {
+		pod.Annotations = map[string]string{
+			injector.RedirectAnnotation:    injector.RedirectCNI,
+			injector.RedirectEnvAnnotation: `{"PROXY_PORT":"15123","PROXY_UID":"1337"}`,
+		}
+		Expect(add("IgnoreUnknown=1;K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(Succeed())
+		Expect(netns).To(Equal("/var/run/netns/test"))
+		Expect(scriptEnv).To(ContainElements("PROXY_PORT=15123", "PROXY_UID=1337"))
+		Expect(stdout.String()).To(ContainSubstring("10.0.0.5/24"))
+	})
+
+	It("only passes validated redirection settings to the script", func() {
+		pod.Annotations = map[string]string{
+			injector.RedirectAnnotation: injector.RedirectCNI,
+			injector.RedirectEnvAnnotation: `{"PROXY_PORT":"15123","INBOUND_PORTS_INCLUDE":"*","INTERCEPTION_MODE":"TPROXY",` +
+				`"IP_FAMILIES":"dual","OUTBOUND_PORTS_EXCLUDE":"8080,9090","OUTBOUND_IP_RANGES_EXCLUDE":"10.96.0.0/12,fd00::/8",` +
+				`"OUTBOUND_UIDS_EXCLUDE":"0,1000","TPROXY_MARK":"0x539"}`,
+		}
+		Expect(add("K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(Succeed())
+		Expect(scriptEnv).To(ContainElements("INBOUND_PORTS_INCLUDE=*", "OUTBOUND_IP_RANGES_EXCLUDE=10.96.0.0/12,fd00::/8"))
+
+		for _, env := range []string{
+			`{"LD_PRELOAD":"/tmp/evil.so"}`,
+			`{"PATH":"/tmp"}`,
+			`{"PROXY_PORT":"15123; rm -rf /"}`,
+			`{"PROXY_PORT":"70000"}`,
+			`{"INBOUND_PORTS_INCLUDE":"*,8080"}`,
+			`{"OUTBOUND_IP_RANGES_EXCLUDE":"10.0.0.1"}`,
+			`{"OUTBOUND_UIDS_EXCLUDE":"-1"}`,
+			`{"INTERCEPTION_MODE":"redirect"}`,
+			`{"IP_FAMILIES":"ipv5"}`,
+		} {
+			scriptEnv = nil
+			pod.Annotations[injector.RedirectEnvAnnotation] = env
+			Expect(add("K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(MatchError(ContainSubstring(injector.RedirectEnvAnnotation)), env)
+			Expect(scriptEnv).To(BeNil(), env)
+		}
+	})
+
+	It("passes pods without the redirect annotation through", func() {
+		Expect(add("K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(Succeed())
+		Expect(scriptEnv).To(BeNil())
+		Expect(stdout.String()).To(ContainSubstring("10.0.0.5/24"))
+	})
+
+	It("does not look up pods in excluded namespaces", func() {
+		getErr = errors.New("must not be called")
+		Expect(add("K8S_POD_NAMESPACE=kube-system;K8S_POD_NAME=coredns")).To(Succeed())
+	})
+
+	It("fails closed when the pod cannot be looked up", func() {
+		getErr = errors.New("connection refused")
+		Expect(add("K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(MatchError(ContainSubstring("connection refused")))
+	})
+
+	It("fails when the redirect script fails", func() {
+		pod.Annotations = map[string]string{injector.RedirectAnnotation: injector.RedirectCNI}
+		plugin.RunScript = func(string, []string) ([]byte, error) {
+			return []byte("iptables: not found"), errors.New("exit status 1")
+		}
+		Expect(add("K8S_POD_NAMESPACE=team1;K8S_POD_NAME=agent")).To(MatchError(ContainSubstring("iptables: not found")))
+	})
+
+	It("treats DEL as a no-op and reports supported versions", func() {
+		Expect(plugin.Run(context.Background(), Args{Command: "DEL"}, stdout)).To(Succeed())
+		Expect(stdout.Len()).To(BeZero())
+		Expect(plugin.Run(context.Background(), Args{Command: "VERSION"}, stdout)).To(Succeed())
+		Expect(stdout.String()).To(ContainSubstring(`"1.0.0"`))
+	})
+})
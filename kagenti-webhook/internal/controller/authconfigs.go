@@ -0,0 +1,278 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var authConfigLog = logf.Log.WithName("authconfigs")
+
+const (
+	// AuthConfigHostsAnnotation lists the hosts of a workload's AuthConfig, comma separated.
+	// The default is the DNS names of a Service named like the workload.
+	AuthConfigHostsAnnotation = "kagenti.io/authconfig-hosts"
+	// AuthConfigIssuerAnnotation overrides the issuer, e.g. when Keycloak's frontend URL
+	// differs from the KEYCLOAK_URL client-registration uses
+	AuthConfigIssuerAnnotation = "kagenti.io/authconfig-issuer"
+)
+
+// AuthConfigGVK is the Authorino resource protecting a workload's API
+var AuthConfigGVK = schema.GroupVersionKind{Group: "authorino.kuadrant.io", Version: "v1beta3", Kind: "AuthConfig"}
+
+// AuthConfigReconciler keeps one Authorino AuthConfig per injected workload, so API-level
+// auth accepts the tokens AuthBridge exchanges for the workload: JWTs of the workload's
+// realm whose audience is the workload's Keycloak client ID. The AuthConfig is owned by
+// the workload and garbage collected with it.
+type AuthConfigReconciler struct {
+	Client client.Client
+	// APIReader reads the environments ConfigMap, which the manager's cache does not hold
+	APIReader client.Reader
+	Mutator   *injector.PodMutator
+}
+
+// NewAuthConfigReconciler returns a reconciler deciding injection like the AuthBridge webhook
+func NewAuthConfigReconciler(c client.Client, apiReader client.Reader, mutator *injector.PodMutator) *AuthConfigReconciler {
+	return &AuthConfigReconciler{Client: c, APIReader: apiReader, Mutator: mutator}
+}
+
+// SetupWithManager watches every workload kind the AuthBridge webhook mutates and the
+// AuthConfigs they own
+func (r *AuthConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for _, kind := range workloadKinds {
+		authConfig := &unstructured.Unstructured{}
+		authConfig.SetGroupVersionKind(AuthConfigGVK)
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("authconfigs-" + kind.resource).
+			For(kind.newObject()).
+			Owns(authConfig).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileWorkload(ctx, kind, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", kind.resource, err)
+		}
+	}
+	return nil
+}
+
+func (r *AuthConfigReconciler) reconcileWorkload(ctx context.Context, kind workloadKind, req ctrl.Request) error {
+	obj := kind.newObject()
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		// the AuthConfig of a deleted workload is garbage collected
+		return client.IgnoreNotFound(err)
+	}
+	name := AuthConfigName(kind.gvk.Kind, req.Name)
+
+	template := kind.template(obj)
+	needed := obj.GetDeletionTimestamp().IsZero()
+	if needed {
+		var err error
+		if needed, err = r.Mutator.NeedsMutation(ctx, obj.GetNamespace(), obj.GetName(), obj.GetLabels(), &template.ObjectMeta); err != nil {
+			return err
+		}
+	}
+	var issuer, audience string
+	if needed {
+		var err error
+		if issuer, err = r.issuer(ctx, obj, template); err != nil {
+			return err
+		}
+		audience = r.audience(obj, template)
+		if issuer == "" || audience == "" {
+			authConfigLog.Info("Skipping workload with unknown issuer or audience", "kind", kind.gvk.Kind,
+				"namespace", req.Namespace, "name", req.Name, "issuer", issuer, "audience", audience)
+			needed = false
+		}
+	}
+	if !needed {
+		return r.deleteAuthConfig(ctx, obj, name)
+	}
+
+	desired := authConfig(name, obj, issuer, audience)
+	if err := controllerutil.SetControllerReference(obj, desired, r.Client.Scheme()); err != nil {
+		return err
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(AuthConfigGVK)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create AuthConfig %s/%s: %w", req.Namespace, name, err)
+		}
+		authConfigLog.Info("Created AuthConfig", "namespace", req.Namespace, "name", name,
+			"issuer", issuer, "audience", audience)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get AuthConfig %s/%s: %w", req.Namespace, name, err)
+	}
+
+	if !metav1.IsControlledBy(current, obj) {
+		authConfigLog.Info("Leaving AuthConfig created by someone else alone", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update AuthConfig %s/%s: %w", req.Namespace, name, err)
+	}
+	authConfigLog.Info("Updated AuthConfig", "namespace", req.Namespace, "name", name)
+	return nil
+}
+
+// issuer is the realm client-registration registers the workload in: the annotation, the
+// workload's IdP profile, or the namespace's environments ConfigMap
+func (r *AuthConfigReconciler) issuer(ctx context.Context, obj client.Object, template *corev1.PodTemplateSpec) (string, error) {
+	if issuer := obj.GetAnnotations()[AuthConfigIssuerAnnotation]; issuer != "" {
+		return issuer, nil
+	}
+	keycloakURL, realm, err := workloadKeycloak(ctx, r.APIReader, r.Mutator, obj, template)
+	if err != nil || keycloakURL == "" || realm == "" {
+		return "", err
+	}
+	return strings.TrimSuffix(keycloakURL, "/") + "/realms/" + realm, nil
+}
+
+// workloadKeycloak is the Keycloak URL and realm client-registration uses for the workload:
+// those of its IdP profile, of the namespace's Keycloak annotations, or of the namespace's
+// environments ConfigMap. Both are empty when the ConfigMap does not exist. c must read
+// ConfigMaps uncached: the manager's cache holds only the config templates.
+func workloadKeycloak(ctx context.Context, c client.Reader, mutator *injector.PodMutator, obj client.Object,
+	template *corev1.PodTemplateSpec) (keycloakURL, realm string, err error) {
+	if profile := injector.IDPProfileFor(&template.ObjectMeta, obj.GetLabels()); profile != "" {
+		keycloakURL, realm = mutator.IDPProfiles[profile].KeycloakURL, mutator.IDPProfiles[profile].KeycloakRealm
+	}
+	if keycloakURL == "" || realm == "" {
+		profile, err := injector.NamespaceIDPProfile(ctx, c, obj.GetNamespace())
+		if err != nil {
+			return "", "", err
+		}
+		if profile != nil {
+			return profile.KeycloakURL, profile.KeycloakRealm, nil
+		}
+	}
+	if keycloakURL == "" || realm == "" {
+		environments := &corev1.ConfigMap{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: injector.EnvironmentsConfigMap}, environments)
+		if err != nil {
+			return "", "", client.IgnoreNotFound(err)
+		}
+		keycloakURL, realm = environments.Data["KEYCLOAK_URL"], environments.Data["KEYCLOAK_REALM"]
+	}
+	return keycloakURL, realm, nil
+}
+
+// audience is the client ID client-registration registers: the kagenti.io/spiffe-id
+// annotation if set, the SPIFFE ID with SPIRE, which is unknown unless the trust domain is
+// configured, otherwise namespace/name
+func (r *AuthConfigReconciler) audience(obj client.Object, template *corev1.PodTemplateSpec) string {
+	if id, err := injector.SpiffeIDOverride(template.Annotations); id != "" || err != nil {
+		// the webhook rejects workloads with an invalid override
+		return id
+	}
+	if !injector.IsSpireEnabled(obj.GetLabels()) {
+		return obj.GetNamespace() + "/" + obj.GetName()
+	}
+	if r.Mutator.SpiffeTrustDomain == "" {
+		return ""
+	}
+	return "spiffe://" + r.Mutator.SpiffeTrustDomain + injector.SpiffeIDPath(obj.GetNamespace(), injector.PodServiceAccount(&template.Spec))
+}
+
+// authConfig accepts JWTs from the issuer whose aud claim is, or contains, the audience
+func authConfig(name string, obj client.Object, issuer, audience string) *unstructured.Unstructured {
+	hosts := []interface{}{}
+	if annotation := obj.GetAnnotations()[AuthConfigHostsAnnotation]; annotation != "" {
+		for _, host := range strings.Split(annotation, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, host)
+			}
+		}
+	} else {
+		service := obj.GetName() + "." + obj.GetNamespace()
+		hosts = append(hosts, service, service+".svc", service+".svc.cluster.local")
+	}
+	audiencePattern := func(operator string) interface{} {
+		return map[string]interface{}{"selector": "auth.identity.aud", "operator": operator, "value": audience}
+	}
+	spec := map[string]interface{}{
+		"hosts": hosts,
+		"authentication": map[string]interface{}{
+			"keycloak": map[string]interface{}{
+				"jwt": map[string]interface{}{"issuerUrl": issuer},
+			},
+		},
+		"authorization": map[string]interface{}{
+			"audience": map[string]interface{}{
+				"patternMatching": map[string]interface{}{
+					"patterns": []interface{}{
+						// aud is a string for a single audience and an array otherwise
+						map[string]interface{}{"any": []interface{}{audiencePattern("eq"), audiencePattern("incl")}},
+					},
+				},
+			},
+		},
+	}
+
+	config := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	config.SetGroupVersionKind(AuthConfigGVK)
+	config.SetNamespace(obj.GetNamespace())
+	config.SetName(name)
+	// the same managed-by label as the ClusterSPIFFEIDs; ownership is decided by the owner reference
+	config.SetLabels(map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue})
+	return config
+}
+
+func (r *AuthConfigReconciler) deleteAuthConfig(ctx context.Context, obj client.Object, name string) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(AuthConfigGVK)
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(current, obj) {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete AuthConfig %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	authConfigLog.Info("Deleted AuthConfig", "namespace", obj.GetNamespace(), "name", name)
+	return nil
+}
+
+// AuthConfigName is kagenti-<kind>-<name>, shortened with a hash when it does not fit in
+// a resource name
+func AuthConfigName(kind, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti-" + kind + "-" + name))
+}
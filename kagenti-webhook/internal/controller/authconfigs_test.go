@@ -0,0 +1,202 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	gomegatypes "github.com/onsi/gomega/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("AuthConfigReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *AuthConfigReconciler
+	)
+
+	injectLabels := map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}
+	environments := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: injector.EnvironmentsConfigMap, Namespace: "team1"},
+		Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak.keycloak:8080/", "KEYCLOAK_REALM": "kagenti"},
+	}
+	deployment := func(labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", Labels: labels},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "agent"}},
+				Spec:       corev1.PodSpec{ServiceAccountName: "agent-sa", Containers: []corev1.Container{{Name: "app"}}},
+			}},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		scheme.AddKnownTypeWithName(AuthConfigGVK, &unstructured.Unstructured{})
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}})
+		// The manager's cache holds no environments ConfigMaps, so only the API reader has them
+		var cached []client.Object
+		for _, obj := range objects {
+			if _, ok := obj.(*corev1.ConfigMap); !ok {
+				cached = append(cached, obj)
+			}
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cached...).Build()
+		apiReader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewAuthConfigReconciler(k8sClient, apiReader, injector.NewPodMutator(k8sClient, true))
+	}
+
+	reconcile := func() error {
+		return reconciler.reconcileWorkload(ctx, workloadKinds[0], ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "agent"},
+		})
+	}
+
+	get := func() (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(AuthConfigGVK)
+		return obj, k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "kagenti-deployment-agent"}, obj)
+	}
+
+	audiencePatterns := func(audience string) gomegatypes.GomegaMatcher {
+		pattern := func(operator string) interface{} {
+			return map[string]interface{}{"selector": "auth.identity.aud", "operator": operator, "value": audience}
+		}
+		return Equal(map[string]interface{}{"audience": map[string]interface{}{"patternMatching": map[string]interface{}{
+			"patterns": []interface{}{map[string]interface{}{"any": []interface{}{pattern("eq"), pattern("incl")}}},
+		}}})
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("accepts the workload's realm and client ID", func() {
+		build(deployment(injectLabels), environments)
+		Expect(reconcile()).To(Succeed())
+
+		obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetOwnerReferences()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Kind":       Equal("Deployment"),
+			"Name":       Equal("agent"),
+			"Controller": PointTo(BeTrue()),
+		})))
+		Expect(obj.Object["spec"]).To(MatchAllKeys(Keys{
+			"hosts": ConsistOf("agent.team1", "agent.team1.svc", "agent.team1.svc.cluster.local"),
+			"authentication": HaveKeyWithValue("keycloak", HaveKeyWithValue("jwt",
+				HaveKeyWithValue("issuerUrl", "http://keycloak.keycloak:8080/realms/kagenti"))),
+			"authorization": audiencePatterns("team1/agent"),
+		}))
+	})
+
+	It("uses the SPIFFE ID, IdP profile and hosts annotation", func() {
+		spire := deployment(map[string]string{
+			injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+			injector.SpireEnableLabel:      injector.SpireEnabledValue,
+			injector.IDPProfileLabel:       "corp",
+		})
+		spire.Annotations = map[string]string{AuthConfigHostsAnnotation: "agent.example.com, agent.team1.svc"}
+		build(spire, environments)
+		reconciler.Mutator.SpiffeTrustDomain = "example.org"
+		reconciler.Mutator.IDPProfiles = injector.IDPProfiles{
+			"corp": {KeycloakURL: "https://sso.example.com", KeycloakRealm: "corp"},
+		}
+		Expect(reconcile()).To(Succeed())
+
+		obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object["spec"]).To(MatchAllKeys(Keys{
+			"hosts": ConsistOf("agent.example.com", "agent.team1.svc"),
+			"authentication": HaveKeyWithValue("keycloak", HaveKeyWithValue("jwt",
+				HaveKeyWithValue("issuerUrl", "https://sso.example.com/realms/corp"))),
+			"authorization": audiencePatterns("spiffe://example.org/ns/team1/sa/agent-sa"),
+		}))
+	})
+
+	It("uses the SPIFFE ID of the kagenti.io/spiffe-id annotation", func() {
+		overridden := deployment(map[string]string{
+			injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+			injector.SpireEnableLabel:      injector.SpireEnabledValue,
+		})
+		overridden.Spec.Template.Annotations = map[string]string{injector.SpiffeIDAnnotation: "spiffe://example.org/agents/team1/agent"}
+		build(overridden, environments)
+		Expect(reconcile()).To(Succeed())
+
+		obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object["spec"]).To(HaveKeyWithValue("authorization", audiencePatterns("spiffe://example.org/agents/team1/agent")))
+	})
+
+	It("skips workloads whose issuer or audience is unknown", func() {
+		build(deployment(injectLabels))
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		build(deployment(map[string]string{
+			injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+			injector.SpireEnableLabel:      injector.SpireEnabledValue,
+		}), environments)
+		Expect(reconcile()).To(Succeed())
+		_, err = get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the AuthConfig when injection is turned off but keeps foreign ones", func() {
+		build(deployment(injectLabels), environments)
+		Expect(reconcile()).To(Succeed())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil)), current)).To(Succeed())
+		current.Labels[injector.AuthBridgeInjectLabel] = "false"
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		foreign := &unstructured.Unstructured{}
+		foreign.SetGroupVersionKind(AuthConfigGVK)
+		foreign.SetNamespace("team1")
+		foreign.SetName("kagenti-deployment-agent")
+		Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+		current.Labels[injector.AuthBridgeInjectLabel] = injector.AuthBridgeInjectValue
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object).NotTo(HaveKey("spec"))
+	})
+})
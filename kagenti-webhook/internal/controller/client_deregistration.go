@@ -0,0 +1,164 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/keycloak"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var deregistrationLog = logf.Log.WithName("client-deregistration")
+
+// KeycloakEnvironmentConfigMap is the per-namespace ConfigMap client-registration reads
+// its Keycloak settings from; de-registration uses the same one
+const KeycloakEnvironmentConfigMap = "environments"
+
+// ClientDeleter deletes a Keycloak client by its clientId
+type ClientDeleter interface {
+	DeleteClient(ctx context.Context, clientID string) error
+}
+
+// ClientDeregistrationReconciler deletes the Keycloak client of a workload once its
+// client credentials Secret is deleted, which the garbage collector does when the
+// owning Deployment, Agent or MCPServer goes away. A finalizer on the Secret holds
+// the deletion until Keycloak has been cleaned up.
+type ClientDeregistrationReconciler struct {
+	Client client.Client
+	// APIReader reads the Keycloak ConfigMap without caching every ConfigMap in the cluster
+	APIReader client.Reader
+	// AdminSecret names the Secret of the workload's namespace that holds the Keycloak admin
+	// credentials, as in the injected client-registration; empty reads them from the ConfigMap
+	AdminSecret string
+	// NewKeycloakClient builds a client from the namespace's Keycloak settings
+	NewKeycloakClient func(url, realm, username, password string) ClientDeleter
+}
+
+// NewClientDeregistrationReconciler returns a reconciler that talks to Keycloak directly
+func NewClientDeregistrationReconciler(c client.Client, apiReader client.Reader) *ClientDeregistrationReconciler {
+	return &ClientDeregistrationReconciler{
+		Client:    c,
+		APIReader: apiReader,
+		NewKeycloakClient: func(url, realm, username, password string) ClientDeleter {
+			return keycloak.NewClient(url, realm, username, password)
+		},
+	}
+}
+
+// SetupWithManager watches the labelled client credentials Secrets
+func (r *ClientDeregistrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	labelled := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[injector.ClientCredentialsLabel] == "true"
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("client-deregistration").
+		For(&corev1.Secret{}, builder.WithPredicates(labelled)).
+		Complete(r)
+}
+
+// Reconcile adds the finalizer to live Secrets and de-registers the client of deleted ones
+func (r *ClientDeregistrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, req.NamespacedName, secret); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if secret.DeletionTimestamp.IsZero() {
+		// Covers Secrets written before the finalizer was requested at creation
+		if controllerutil.AddFinalizer(secret, injector.ClientDeregistrationFinalizer) {
+			if err := r.Client.Update(ctx, secret); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to add finalizer: %w", err)
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(secret, injector.ClientDeregistrationFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.deregister(ctx, secret); err != nil {
+		// Requeued with backoff; the Secret stays until Keycloak is reachable
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(secret, injector.ClientDeregistrationFinalizer)
+	if err := r.Client.Update(ctx, secret); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to remove finalizer: %w", err)
+	}
+	return ctrl.Result{}, nil
+}
+
+func (r *ClientDeregistrationReconciler) deregister(ctx context.Context, secret *corev1.Secret) error {
+	clientID := string(secret.Data[injector.ClientIDSecretKey])
+	if clientID == "" {
+		deregistrationLog.Info("Secret has no client ID, nothing to de-register",
+			"namespace", secret.Namespace, "secret", secret.Name)
+		return nil
+	}
+
+	cm := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: secret.Namespace, Name: KeycloakEnvironmentConfigMap}
+	if err := r.APIReader.Get(ctx, key, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Typically the whole namespace is being deleted; never block that
+			deregistrationLog.Info("Keycloak settings not found, the client must be deleted manually",
+				"namespace", secret.Namespace, "clientID", clientID)
+			return nil
+		}
+		return fmt.Errorf("failed to get ConfigMap %s: %w", key, err)
+	}
+
+	keycloakURL, realm := cm.Data["KEYCLOAK_URL"], cm.Data["KEYCLOAK_REALM"]
+	username, password := cm.Data["KEYCLOAK_ADMIN_USERNAME"], cm.Data["KEYCLOAK_ADMIN_PASSWORD"]
+	if r.AdminSecret != "" {
+		admin := &corev1.Secret{}
+		adminKey := client.ObjectKey{Namespace: secret.Namespace, Name: r.AdminSecret}
+		if err := r.APIReader.Get(ctx, adminKey, admin); err != nil {
+			if apierrors.IsNotFound(err) {
+				deregistrationLog.Info("Keycloak admin Secret not found, the client must be deleted manually",
+					"namespace", secret.Namespace, "clientID", clientID)
+				return nil
+			}
+			return fmt.Errorf("failed to get Secret %s: %w", adminKey, err)
+		}
+		username, password = string(admin.Data["KEYCLOAK_ADMIN_USERNAME"]), string(admin.Data["KEYCLOAK_ADMIN_PASSWORD"])
+	}
+	// the admin credentials never come from the IdP profile
+	if profile, err := injector.NamespaceIDPProfile(ctx, r.APIReader, secret.Namespace); err != nil {
+		return err
+	} else if profile != nil {
+		keycloakURL, realm = profile.KeycloakURL, profile.KeycloakRealm
+	}
+	kc := r.NewKeycloakClient(keycloakURL, realm, username, password)
+	if err := kc.DeleteClient(ctx, clientID); err != nil {
+		return fmt.Errorf("failed to delete Keycloak client %q: %w", clientID, err)
+	}
+	deregistrationLog.Info("Deleted Keycloak client", "namespace", secret.Namespace, "clientID", clientID)
+	return nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+type fakeKeycloak struct {
+	realm    string
+	username string
+	password string
+	deleted  []string
+	err      error
+}
+
+func (f *fakeKeycloak) DeleteClient(_ context.Context, clientID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.deleted = append(f.deleted, clientID)
+	return nil
+}
+
+var _ = Describe("ClientDeregistrationReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		keycloak   *fakeKeycloak
+		reconciler *ClientDeregistrationReconciler
+		key        types.NamespacedName
+	)
+
+	newSecret := func(finalizers ...string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       key.Name,
+				Namespace:  key.Namespace,
+				Labels:     map[string]string{injector.ClientCredentialsLabel: "true"},
+				Finalizers: finalizers,
+			},
+			Data: map[string][]byte{injector.ClientIDSecretKey: []byte("spiffe://example.org/ns/team1/sa/agent")},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = &ClientDeregistrationReconciler{
+			Client:    k8sClient,
+			APIReader: k8sClient,
+			NewKeycloakClient: func(url, realm, username, password string) ClientDeleter {
+				keycloak.realm, keycloak.username, keycloak.password = realm, username, password
+				return keycloak
+			},
+		}
+	}
+
+	reconcile := func() error {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+		return err
+	}
+
+	environments := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: KeycloakEnvironmentConfigMap, Namespace: "team1"},
+		Data: map[string]string{"KEYCLOAK_URL": "http://keycloak:8080", "KEYCLOAK_REALM": "demo",
+			"KEYCLOAK_ADMIN_USERNAME": "cm-admin", "KEYCLOAK_ADMIN_PASSWORD": "cm-password"},
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		keycloak = &fakeKeycloak{}
+		key = types.NamespacedName{Namespace: "team1", Name: "agent" + injector.ClientCredentialsSecretSuffix}
+	})
+
+	It("adds the finalizer to live Secrets", func() {
+		build(newSecret(), environments)
+		Expect(reconcile()).To(Succeed())
+
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Finalizers).To(ConsistOf(injector.ClientDeregistrationFinalizer))
+		Expect(keycloak.deleted).To(BeEmpty())
+	})
+
+	It("deletes the Keycloak client and releases the Secret once it is deleted", func() {
+		build(newSecret(injector.ClientDeregistrationFinalizer), environments)
+		Expect(k8sClient.Delete(ctx, newSecret())).To(Succeed())
+
+		Expect(reconcile()).To(Succeed())
+		Expect(keycloak.deleted).To(ConsistOf("spiffe://example.org/ns/team1/sa/agent"))
+		Expect(keycloak.realm).To(Equal("demo"))
+		Expect(keycloak.username).To(Equal("cm-admin"))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, &corev1.Secret{}))).To(BeTrue())
+	})
+
+	It("keeps the finalizer while Keycloak fails", func() {
+		keycloak.err = errors.New("connection refused")
+		build(newSecret(injector.ClientDeregistrationFinalizer), environments)
+		Expect(k8sClient.Delete(ctx, newSecret())).To(Succeed())
+
+		Expect(reconcile()).To(MatchError(ContainSubstring("connection refused")))
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Finalizers).To(ConsistOf(injector.ClientDeregistrationFinalizer))
+	})
+
+	It("does not block deletion when the Keycloak settings are gone", func() {
+		build(newSecret(injector.ClientDeregistrationFinalizer))
+		Expect(k8sClient.Delete(ctx, newSecret())).To(Succeed())
+
+		Expect(reconcile()).To(Succeed())
+		Expect(keycloak.deleted).To(BeEmpty())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, &corev1.Secret{}))).To(BeTrue())
+	})
+
+	It("reads the admin credentials from the admin Secret when one is configured", func() {
+		admin := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "keycloak-admin", Namespace: "team1"},
+			Data: map[string][]byte{
+				"KEYCLOAK_ADMIN_USERNAME": []byte("secret-admin"),
+				"KEYCLOAK_ADMIN_PASSWORD": []byte("secret-password"),
+			},
+		}
+		build(newSecret(injector.ClientDeregistrationFinalizer), environments, admin)
+		reconciler.AdminSecret = "keycloak-admin"
+		Expect(k8sClient.Delete(ctx, newSecret())).To(Succeed())
+
+		Expect(reconcile()).To(Succeed())
+		Expect(keycloak.deleted).To(ConsistOf("spiffe://example.org/ns/team1/sa/agent"))
+		Expect(keycloak.username).To(Equal("secret-admin"))
+		Expect(keycloak.password).To(Equal("secret-password"))
+	})
+
+	It("does not block deletion when the admin Secret is gone", func() {
+		build(newSecret(injector.ClientDeregistrationFinalizer), environments)
+		reconciler.AdminSecret = "keycloak-admin"
+		Expect(k8sClient.Delete(ctx, newSecret())).To(Succeed())
+
+		Expect(reconcile()).To(Succeed())
+		Expect(keycloak.deleted).To(BeEmpty())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, key, &corev1.Secret{}))).To(BeTrue())
+	})
+})
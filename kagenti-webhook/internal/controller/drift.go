@@ -0,0 +1,300 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var driftLog = logf.Log.WithName("injection-drift")
+
+const (
+	// DriftMissing is a workload that should be injected but is not, e.g. because it was
+	// admitted while the webhook was unavailable with failurePolicy=Ignore
+	DriftMissing = "missing"
+	// DriftStale is an injected workload whose sidecars were removed or changed, or were
+	// injected with a different configuration than the webhook would use today
+	DriftStale = "stale"
+
+	DefaultDriftCheckInterval = 10 * time.Minute
+
+	// SidecarAutoUpgradeAnnotation set to "true" on a workload lets the drift check re-inject
+	// it when its injection is stale, e.g. after the sidecar images changed, with
+	// DriftOptions.AutoUpgrade and without repairing the whole fleet
+	SidecarAutoUpgradeAnnotation = "kagenti.io/sidecar-auto-upgrade"
+)
+
+var (
+	driftedWorkloads = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kagenti_webhook_drifted_workloads",
+		Help: "Workloads whose AuthBridge injection is missing or stale, as of the last drift check",
+	}, []string{"kind", "reason"})
+	driftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kagenti_webhook_drift_repairs_total",
+		Help: "Drifted workloads patched by the drift check",
+	}, []string{"kind", "result"})
+)
+
+func init() {
+	obs.Registry.MustRegister(driftedWorkloads, driftRepairs)
+}
+
+// DriftOptions configures the drift check
+type DriftOptions struct {
+	Interval time.Duration
+	// Repair re-injects drifted workloads instead of only reporting them
+	Repair bool
+	// AutoUpgrade re-injects stale workloads annotated with SidecarAutoUpgradeAnnotation
+	AutoUpgrade bool
+}
+
+// Drift describes one drifted workload
+type Drift struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Reason    string
+}
+
+// DriftDetector periodically lists the workloads the AuthBridge webhook handles and
+// compares them with what the webhook would inject today. Webhook-only injection misses
+// objects created while the webhook was down.
+type DriftDetector struct {
+	Client  client.Client
+	Mutator *injector.PodMutator
+	Options DriftOptions
+}
+
+// NewDriftDetector returns a DriftDetector with unset options replaced by defaults
+func NewDriftDetector(c client.Client, mutator *injector.PodMutator, opts DriftOptions) *DriftDetector {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultDriftCheckInterval
+	}
+	return &DriftDetector{Client: c, Mutator: mutator, Options: opts}
+}
+
+// Start implements manager.Runnable and runs a check right away and then every interval
+func (d *DriftDetector) Start(ctx context.Context) error {
+	ticker := time.NewTicker(d.Options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Check(ctx); err != nil {
+			driftLog.Error(err, "Drift check failed, will retry", "interval", d.Options.Interval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; one replica checking is enough
+func (d *DriftDetector) NeedLeaderElection() bool {
+	return true
+}
+
+// workloadKind adapts one of the workload types the AuthBridge webhook mutates
+type workloadKind struct {
+	gvk      metav1.GroupVersionKind
+	resource string
+	// immutable templates (Jobs) are reported but never repaired
+	immutable bool
+	newObject func() client.Object
+	list      func(ctx context.Context, c client.Client) ([]client.Object, error)
+	template  func(obj client.Object) *corev1.PodTemplateSpec
+}
+
+var workloadKinds = []workloadKind{
+	{
+		gvk:       metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		resource:  "deployments",
+		newObject: func() client.Object { return &appsv1.Deployment{} },
+		list: func(ctx context.Context, c client.Client) ([]client.Object, error) {
+			list := &appsv1.DeploymentList{}
+			err := c.List(ctx, list)
+			return objects(list.Items, func(o *appsv1.Deployment) client.Object { return o }), err
+		},
+		template: func(obj client.Object) *corev1.PodTemplateSpec { return &obj.(*appsv1.Deployment).Spec.Template },
+	},
+	{
+		gvk:       metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+		resource:  "statefulsets",
+		newObject: func() client.Object { return &appsv1.StatefulSet{} },
+		list: func(ctx context.Context, c client.Client) ([]client.Object, error) {
+			list := &appsv1.StatefulSetList{}
+			err := c.List(ctx, list)
+			return objects(list.Items, func(o *appsv1.StatefulSet) client.Object { return o }), err
+		},
+		template: func(obj client.Object) *corev1.PodTemplateSpec { return &obj.(*appsv1.StatefulSet).Spec.Template },
+	},
+	{
+		gvk:       metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+		resource:  "daemonsets",
+		newObject: func() client.Object { return &appsv1.DaemonSet{} },
+		list: func(ctx context.Context, c client.Client) ([]client.Object, error) {
+			list := &appsv1.DaemonSetList{}
+			err := c.List(ctx, list)
+			return objects(list.Items, func(o *appsv1.DaemonSet) client.Object { return o }), err
+		},
+		template: func(obj client.Object) *corev1.PodTemplateSpec { return &obj.(*appsv1.DaemonSet).Spec.Template },
+	},
+	{
+		gvk:       metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"},
+		resource:  "jobs",
+		immutable: true,
+		newObject: func() client.Object { return &batchv1.Job{} },
+		list: func(ctx context.Context, c client.Client) ([]client.Object, error) {
+			list := &batchv1.JobList{}
+			err := c.List(ctx, list)
+			return objects(list.Items, func(o *batchv1.Job) client.Object { return o }), err
+		},
+		template: func(obj client.Object) *corev1.PodTemplateSpec { return &obj.(*batchv1.Job).Spec.Template },
+	},
+	{
+		gvk:       metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"},
+		resource:  "cronjobs",
+		newObject: func() client.Object { return &batchv1.CronJob{} },
+		list: func(ctx context.Context, c client.Client) ([]client.Object, error) {
+			list := &batchv1.CronJobList{}
+			err := c.List(ctx, list)
+			return objects(list.Items, func(o *batchv1.CronJob) client.Object { return o }), err
+		},
+		template: func(obj client.Object) *corev1.PodTemplateSpec {
+			return &obj.(*batchv1.CronJob).Spec.JobTemplate.Spec.Template
+		},
+	},
+}
+
+func objects[T any](items []T, toObject func(*T) client.Object) []client.Object {
+	out := make([]client.Object, 0, len(items))
+	for i := range items {
+		out = append(out, toObject(&items[i]))
+	}
+	return out
+}
+
+// Check inspects every workload once, updates the metrics and repairs drift if enabled
+func (d *DriftDetector) Check(ctx context.Context) ([]Drift, error) {
+	drifts := []Drift{}
+	for _, kind := range workloadKinds {
+		items, err := kind.list(ctx, d.Client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", kind.resource, err)
+		}
+
+		counts := map[string]float64{DriftMissing: 0, DriftStale: 0}
+		for _, obj := range items {
+			if !obj.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+			reason, desired, err := d.inspect(ctx, kind, obj)
+			if err != nil {
+				driftLog.Error(err, "Failed to inspect workload", "kind", kind.gvk.Kind,
+					"namespace", obj.GetNamespace(), "name", obj.GetName())
+				continue
+			}
+			if reason == "" {
+				continue
+			}
+			counts[reason]++
+			drifts = append(drifts, Drift{Kind: kind.gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Reason: reason})
+			driftLog.Info("Workload injection drifted", "kind", kind.gvk.Kind,
+				"namespace", obj.GetNamespace(), "name", obj.GetName(), "reason", reason)
+
+			if !kind.immutable && d.shouldRepair(obj, reason) {
+				d.repair(ctx, kind, obj, desired)
+			}
+		}
+		for reason, count := range counts {
+			driftedWorkloads.WithLabelValues(kind.gvk.Kind, reason).Set(count)
+		}
+	}
+	return drifts, nil
+}
+
+// inspect returns the drift reason (empty if in sync) and the template the webhook would produce
+func (d *DriftDetector) inspect(ctx context.Context, kind workloadKind, obj client.Object) (string, *corev1.PodTemplateSpec, error) {
+	current := kind.template(obj)
+	needed, err := d.Mutator.NeedsMutation(ctx, obj.GetNamespace(), obj.GetName(), obj.GetLabels(), &current.ObjectMeta)
+	if err != nil || !needed {
+		return "", nil, err
+	}
+
+	desired := current.DeepCopy()
+	injector.RemoveInjection(desired)
+	// Inject as if the webhook admitted the object, so request-derived settings match
+	admissionCtx := admission.NewContextWithRequest(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Kind:      kind.gvk,
+		Resource:  metav1.GroupVersionResource{Group: kind.gvk.Group, Version: kind.gvk.Version, Resource: kind.resource},
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+	}})
+	if _, err := d.Mutator.InjectAuthBridge(admissionCtx, desired, obj.GetNamespace(), obj.GetName(), obj.GetLabels()); err != nil {
+		return "", nil, err
+	}
+
+	if !injector.IsInjected(&current.ObjectMeta) {
+		return DriftMissing, desired, nil
+	}
+	recorded := current.Annotations[injector.InjectionHashAnnotation]
+	spireEnabled := injector.IsSpireEnabled(obj.GetLabels())
+	if recorded != injector.ComputeInjectionHash(&current.Spec, spireEnabled) ||
+		recorded != desired.Annotations[injector.InjectionHashAnnotation] {
+		return DriftStale, desired, nil
+	}
+	return "", nil, nil
+}
+
+// shouldRepair reports whether a drifted workload is re-injected. The new pod template rolls
+// its pods like a "kubectl rollout restart", picking up the current sidecars.
+func (d *DriftDetector) shouldRepair(obj client.Object, reason string) bool {
+	if d.Options.Repair {
+		return true
+	}
+	return d.Options.AutoUpgrade && reason == DriftStale && obj.GetAnnotations()[SidecarAutoUpgradeAnnotation] == "true"
+}
+
+func (d *DriftDetector) repair(ctx context.Context, kind workloadKind, obj client.Object, desired *corev1.PodTemplateSpec) {
+	*kind.template(obj) = *desired
+	// The webhook lets the update through unchanged since the template is marked injected
+	if err := d.Client.Update(ctx, obj); err != nil {
+		driftRepairs.WithLabelValues(kind.gvk.Kind, "failed").Inc()
+		driftLog.Error(err, "Failed to repair workload, will retry on the next check", "kind", kind.gvk.Kind,
+			"namespace", obj.GetNamespace(), "name", obj.GetName())
+		return
+	}
+	driftRepairs.WithLabelValues(kind.gvk.Kind, "repaired").Inc()
+	driftLog.Info("Repaired workload injection", "kind", kind.gvk.Kind,
+		"namespace", obj.GetNamespace(), "name", obj.GetName())
+}
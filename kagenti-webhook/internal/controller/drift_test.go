@@ -0,0 +1,184 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("DriftDetector", func() {
+	var (
+		ctx       context.Context
+		k8sClient client.Client
+		detector  *DriftDetector
+	)
+
+	optedIn := map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}
+	template := corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+	}}
+
+	build := func(opts DriftOptions, objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}})
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		detector = NewDriftDetector(k8sClient, injector.NewPodMutator(k8sClient, true), opts)
+	}
+
+	deployment := func(labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", Labels: labels},
+			Spec:       appsv1.DeploymentSpec{Template: *template.DeepCopy()},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("reports opted-in workloads that were never injected and ignores the rest", func() {
+		other := deployment(nil)
+		other.Name = "plain"
+		build(DriftOptions{}, deployment(optedIn), other)
+
+		drifts, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(ConsistOf(Drift{Kind: "Deployment", Namespace: "team1", Name: "agent", Reason: DriftMissing}))
+
+		// Report-only mode leaves the workload alone
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil)), current)).To(Succeed())
+		Expect(injector.IsInjected(&current.Spec.Template.ObjectMeta)).To(BeFalse())
+	})
+
+	It("repairs missing injection so the next check is clean", func() {
+		build(DriftOptions{Repair: true}, deployment(optedIn))
+
+		drifts, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(HaveLen(1))
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil)), current)).To(Succeed())
+		Expect(injector.IsInjected(&current.Spec.Template.ObjectMeta)).To(BeTrue())
+
+		drifts, err = detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(BeEmpty())
+	})
+
+	staleDeployment := func(annotations map[string]string) *appsv1.Deployment {
+		injected := deployment(optedIn)
+		injected.Annotations = annotations
+		_, err := injector.NewPodMutator(nil, true).InjectAuthBridge(ctx, &injected.Spec.Template, "team1", "agent", optedIn)
+		Expect(err).NotTo(HaveOccurred())
+		for i := range injected.Spec.Template.Spec.InitContainers {
+			if injected.Spec.Template.Spec.InitContainers[i].Name == injector.EnvoyProxyContainerName {
+				injected.Spec.Template.Spec.InitContainers[i].Image = "envoy:old"
+			}
+		}
+		return injected
+	}
+
+	envoyImage := func(obj client.Object) string {
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), current)).To(Succeed())
+		for _, c := range current.Spec.Template.Spec.InitContainers {
+			if c.Name == injector.EnvoyProxyContainerName {
+				return c.Image
+			}
+		}
+		return ""
+	}
+
+	It("reports injected workloads whose sidecars were changed as stale", func() {
+		injected := staleDeployment(nil)
+		build(DriftOptions{Repair: true}, injected)
+
+		drifts, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(ConsistOf(HaveField("Reason", DriftStale)))
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(injected), current)).To(Succeed())
+		images := []string{}
+		for _, c := range current.Spec.Template.Spec.InitContainers {
+			images = append(images, c.Image)
+		}
+		Expect(images).To(ContainElement(injector.DefaultEnvoyImage))
+		Expect(images).NotTo(ContainElement("envoy:old"))
+	})
+
+	It("upgrades stale workloads that opted in to sidecar upgrades", func() {
+		upgraded := staleDeployment(map[string]string{SidecarAutoUpgradeAnnotation: "true"})
+		pinned := staleDeployment(nil)
+		pinned.Name = "pinned"
+		missing := deployment(optedIn)
+		missing.Name = "missing"
+		missing.Annotations = map[string]string{SidecarAutoUpgradeAnnotation: "true"}
+		build(DriftOptions{AutoUpgrade: true}, upgraded, pinned, missing)
+
+		drifts, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(HaveLen(3))
+
+		Expect(envoyImage(upgraded)).To(Equal(injector.DefaultEnvoyImage))
+		Expect(envoyImage(pinned)).To(Equal("envoy:old"))
+		// Upgrades only replace sidecars; missing injection still needs --drift-repair
+		Expect(envoyImage(missing)).To(BeEmpty())
+	})
+
+	It("ignores the upgrade annotation unless upgrades are enabled", func() {
+		upgraded := staleDeployment(map[string]string{SidecarAutoUpgradeAnnotation: "true"})
+		build(DriftOptions{}, upgraded)
+
+		_, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envoyImage(upgraded)).To(Equal("envoy:old"))
+	})
+
+	It("never patches Jobs, whose pod template is immutable", func() {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "team1", Labels: optedIn},
+			Spec:       batchv1.JobSpec{Template: *template.DeepCopy()},
+		}
+		build(DriftOptions{Repair: true}, job)
+
+		drifts, err := detector.Check(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drifts).To(ConsistOf(HaveField("Kind", "Job")))
+
+		current := &batchv1.Job{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(job), current)).To(Succeed())
+		Expect(injector.IsInjected(&current.Spec.Template.ObjectMeta)).To(BeFalse())
+	})
+})
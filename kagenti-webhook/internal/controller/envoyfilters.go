@@ -0,0 +1,254 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var envoyFilterLog = logf.Log.WithName("envoyfilters")
+
+// EnvoyFilterGVK is the Istio resource patching the ext_proc filter into a workload's sidecar
+var EnvoyFilterGVK = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1alpha3", Kind: "EnvoyFilter"}
+
+// extProcClusterName is the Envoy cluster pointing at the injected ext_proc server
+const extProcClusterName = "kagenti-ext-proc"
+
+// EnvoyFilterReconciler keeps one Istio EnvoyFilter per injected workload in the istio
+// egress mode. The filter adds the AuthBridge ext_proc to the outbound HTTP chain of the
+// workload's Istio sidecar, which reaches the ext_proc server on 127.0.0.1 in the same
+// pod. Waypoints are not supported: the ext_proc server runs in the workload pod, out of
+// a waypoint's reach. The EnvoyFilter is owned by the workload and garbage collected with it.
+type EnvoyFilterReconciler struct {
+	Client  client.Client
+	Mutator *injector.PodMutator
+}
+
+// NewEnvoyFilterReconciler returns a reconciler deciding injection like the AuthBridge webhook
+func NewEnvoyFilterReconciler(c client.Client, mutator *injector.PodMutator) *EnvoyFilterReconciler {
+	return &EnvoyFilterReconciler{Client: c, Mutator: mutator}
+}
+
+// SetupWithManager watches every workload kind the AuthBridge webhook mutates and the
+// EnvoyFilters they own
+func (r *EnvoyFilterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for _, kind := range workloadKinds {
+		envoyFilter := &unstructured.Unstructured{}
+		envoyFilter.SetGroupVersionKind(EnvoyFilterGVK)
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("envoyfilters-" + kind.resource).
+			For(kind.newObject()).
+			Owns(envoyFilter).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileWorkload(ctx, kind, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", kind.resource, err)
+		}
+	}
+	return nil
+}
+
+func (r *EnvoyFilterReconciler) reconcileWorkload(ctx context.Context, kind workloadKind, req ctrl.Request) error {
+	obj := kind.newObject()
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		// the EnvoyFilter of a deleted workload is garbage collected
+		return client.IgnoreNotFound(err)
+	}
+	name := EnvoyFilterName(kind.gvk.Kind, req.Name)
+
+	template := kind.template(obj)
+	needed := obj.GetDeletionTimestamp().IsZero()
+	if needed {
+		var err error
+		if needed, err = r.Mutator.NeedsMutation(ctx, obj.GetNamespace(), obj.GetName(), obj.GetLabels(), &template.ObjectMeta); err != nil {
+			return err
+		}
+	}
+	if needed {
+		mode, err := injector.EgressModeFor(template.Annotations, r.Mutator.EgressMode)
+		if err != nil {
+			// the webhook rejects the workload with the same error
+			envoyFilterLog.Info("Skipping workload with an invalid egress mode", "kind", kind.gvk.Kind,
+				"namespace", req.Namespace, "name", req.Name, "error", err.Error())
+		}
+		needed = mode == injector.EgressModeIstio
+	}
+	if needed && len(template.Labels) == 0 {
+		envoyFilterLog.Info("Skipping workload without pod template labels to select", "kind", kind.gvk.Kind,
+			"namespace", req.Namespace, "name", req.Name)
+		needed = false
+	}
+	if !needed {
+		return r.deleteEnvoyFilter(ctx, obj, name)
+	}
+
+	desired := envoyFilter(name, obj, template.Labels)
+	if err := controllerutil.SetControllerReference(obj, desired, r.Client.Scheme()); err != nil {
+		return err
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(EnvoyFilterGVK)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create EnvoyFilter %s/%s: %w", req.Namespace, name, err)
+		}
+		envoyFilterLog.Info("Created EnvoyFilter", "namespace", req.Namespace, "name", name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get EnvoyFilter %s/%s: %w", req.Namespace, name, err)
+	}
+
+	if !metav1.IsControlledBy(current, obj) {
+		envoyFilterLog.Info("Leaving EnvoyFilter created by someone else alone", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update EnvoyFilter %s/%s: %w", req.Namespace, name, err)
+	}
+	envoyFilterLog.Info("Updated EnvoyFilter", "namespace", req.Namespace, "name", name)
+	return nil
+}
+
+// envoyFilter adds the ext_proc cluster and inserts the ext_proc filter before the router
+// of the sidecar's outbound listeners, with the processing mode of the AuthBridge Envoy
+func envoyFilter(name string, obj client.Object, podLabels map[string]string) *unstructured.Unstructured {
+	selector := map[string]interface{}{}
+	for key, value := range podLabels {
+		selector[key] = value
+	}
+	cluster := map[string]interface{}{
+		"name":            extProcClusterName,
+		"type":            "STATIC",
+		"connect_timeout": "1s",
+		"typed_extension_protocol_options": map[string]interface{}{
+			"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": map[string]interface{}{
+				"@type":                "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions",
+				"explicit_http_config": map[string]interface{}{"http2_protocol_options": map[string]interface{}{}},
+			},
+		},
+		"load_assignment": map[string]interface{}{
+			"cluster_name": extProcClusterName,
+			"endpoints": []interface{}{map[string]interface{}{
+				"lb_endpoints": []interface{}{map[string]interface{}{
+					"endpoint": map[string]interface{}{
+						"address": map[string]interface{}{
+							"socket_address": map[string]interface{}{
+								"address":    "127.0.0.1",
+								"port_value": int64(injector.ExtProcPort),
+							},
+						},
+					},
+				}},
+			}},
+		},
+	}
+	filter := map[string]interface{}{
+		"name": "envoy.filters.http.ext_proc",
+		"typed_config": map[string]interface{}{
+			"@type": "type.googleapis.com/envoy.extensions.filters.http.ext_proc.v3.ExternalProcessor",
+			"grpc_service": map[string]interface{}{
+				"envoy_grpc": map[string]interface{}{"cluster_name": extProcClusterName},
+				"timeout":    "30s",
+			},
+			"processing_mode": map[string]interface{}{
+				"request_header_mode":  "SEND",
+				"response_header_mode": "SKIP",
+				"request_body_mode":    "NONE",
+				"response_body_mode":   "NONE",
+			},
+			// the caller's address for the audit events of the token exchange
+			"request_attributes": []interface{}{"source.address"},
+			// tool authorization asks for the request body
+			"allow_mode_override": true,
+		},
+	}
+	spec := map[string]interface{}{
+		"workloadSelector": map[string]interface{}{"labels": selector},
+		"configPatches": []interface{}{
+			map[string]interface{}{
+				"applyTo": "CLUSTER",
+				"match":   map[string]interface{}{"context": "SIDECAR_OUTBOUND"},
+				"patch":   map[string]interface{}{"operation": "ADD", "value": cluster},
+			},
+			map[string]interface{}{
+				"applyTo": "HTTP_FILTER",
+				"match": map[string]interface{}{
+					"context": "SIDECAR_OUTBOUND",
+					"listener": map[string]interface{}{
+						"filterChain": map[string]interface{}{
+							"filter": map[string]interface{}{
+								"name":      "envoy.filters.network.http_connection_manager",
+								"subFilter": map[string]interface{}{"name": "envoy.filters.http.router"},
+							},
+						},
+					},
+				},
+				"patch": map[string]interface{}{"operation": "INSERT_BEFORE", "value": filter},
+			},
+		},
+	}
+
+	envoyFilter := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	envoyFilter.SetGroupVersionKind(EnvoyFilterGVK)
+	envoyFilter.SetNamespace(obj.GetNamespace())
+	envoyFilter.SetName(name)
+	envoyFilter.SetLabels(map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue})
+	return envoyFilter
+}
+
+func (r *EnvoyFilterReconciler) deleteEnvoyFilter(ctx context.Context, obj client.Object, name string) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(EnvoyFilterGVK)
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(current, obj) {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete EnvoyFilter %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	envoyFilterLog.Info("Deleted EnvoyFilter", "namespace", obj.GetNamespace(), "name", name)
+	return nil
+}
+
+// EnvoyFilterName is kagenti-<kind>-<name>, shortened with a hash when it does not fit in
+// a resource name
+func EnvoyFilterName(kind, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti-" + kind + "-" + name))
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("EnvoyFilterReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *EnvoyFilterReconciler
+	)
+
+	injectLabels := map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}
+	deployment := func(egressMode injector.EgressMode) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", Labels: injectLabels},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      map[string]string{"app": "agent"},
+					Annotations: map[string]string{injector.EgressModeAnnotation: string(egressMode)},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			}},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		scheme.AddKnownTypeWithName(EnvoyFilterGVK, &unstructured.Unstructured{})
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}})
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewEnvoyFilterReconciler(k8sClient, injector.NewPodMutator(k8sClient, true))
+	}
+
+	reconcile := func() error {
+		return reconciler.reconcileWorkload(ctx, workloadKinds[0], ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "agent"},
+		})
+	}
+
+	get := func() (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(EnvoyFilterGVK)
+		return obj, k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "kagenti-deployment-agent"}, obj)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("attaches the ext_proc filter to the workload's Istio sidecar", func() {
+		build(deployment(injector.EgressModeIstio))
+		Expect(reconcile()).To(Succeed())
+
+		obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetOwnerReferences()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Kind":       Equal("Deployment"),
+			"Name":       Equal("agent"),
+			"Controller": PointTo(BeTrue()),
+		})))
+		spec := obj.Object["spec"].(map[string]interface{})
+		Expect(spec["workloadSelector"]).To(Equal(map[string]interface{}{
+			"labels": map[string]interface{}{"app": "agent"},
+		}))
+		patches := spec["configPatches"].([]interface{})
+		Expect(patches).To(HaveLen(2))
+		Expect(patches[0]).To(HaveKeyWithValue("applyTo", "CLUSTER"))
+		Expect(patches[1]).To(MatchKeys(IgnoreExtras, Keys{
+			"applyTo": Equal("HTTP_FILTER"),
+			"patch": MatchAllKeys(Keys{
+				"operation": Equal("INSERT_BEFORE"),
+				"value":     HaveKeyWithValue("name", "envoy.filters.http.ext_proc"),
+			}),
+		}))
+	})
+
+	It("skips workloads in other egress modes", func() {
+		build(deployment(injector.EgressModeIPTables))
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("follows the manager-level default egress mode", func() {
+		workload := deployment(injector.EgressModeIstio)
+		workload.Spec.Template.Annotations = nil
+		build(workload)
+		reconciler.Mutator.EgressMode = injector.EgressModeIstio
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("removes the EnvoyFilter when the workload leaves istio mode", func() {
+		build(deployment(injector.EgressModeIstio))
+		Expect(reconcile()).To(Succeed())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "agent"}, current)).To(Succeed())
+		current.Spec.Template.Annotations[injector.EgressModeAnnotation] = string(injector.EgressModeProxyEnv)
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,226 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var gatewayPolicyLog = logf.Log.WithName("gateway-policies")
+
+const (
+	// GatewayExtProcAnnotation on a Gateway or HTTPRoute runs the AuthBridge ext_proc for
+	// its traffic. The value is the ext_proc Service as name[.namespace][:port], or "true"
+	// for the --gateway-ext-proc-service default.
+	GatewayExtProcAnnotation = "kagenti.io/ext-proc"
+
+	// defaultExtProcServicePort is the port the go-processor listens on
+	defaultExtProcServicePort = 9090
+)
+
+// EnvoyExtensionPolicyGVK is the Envoy Gateway resource attaching ext_proc servers to
+// Gateway API resources
+var EnvoyExtensionPolicyGVK = schema.GroupVersionKind{Group: "gateway.envoyproxy.io", Version: "v1alpha1", Kind: "EnvoyExtensionPolicy"}
+
+// gatewayTargetKinds are the Gateway API resources an EnvoyExtensionPolicy can target
+var gatewayTargetKinds = []schema.GroupVersionKind{
+	{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "Gateway"},
+	{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"},
+}
+
+// GatewayPolicyReconciler keeps one Envoy Gateway EnvoyExtensionPolicy per annotated
+// Gateway or HTTPRoute, so the token exchange runs at the gateway tier with a shared
+// ext_proc Deployment instead of a sidecar per workload. The policy is owned by the
+// annotated resource and garbage collected with it.
+type GatewayPolicyReconciler struct {
+	Client client.Client
+	// DefaultService is the ext_proc Service used for the annotation value "true"
+	DefaultService string
+}
+
+// NewGatewayPolicyReconciler returns a reconciler using defaultService for annotations set to "true"
+func NewGatewayPolicyReconciler(c client.Client, defaultService string) *GatewayPolicyReconciler {
+	return &GatewayPolicyReconciler{Client: c, DefaultService: defaultService}
+}
+
+// SetupWithManager watches Gateways, HTTPRoutes and the EnvoyExtensionPolicies they own
+func (r *GatewayPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for _, gvk := range gatewayTargetKinds {
+		target := &unstructured.Unstructured{}
+		target.SetGroupVersionKind(gvk)
+		policy := &unstructured.Unstructured{}
+		policy.SetGroupVersionKind(EnvoyExtensionPolicyGVK)
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("gateway-policies-" + strings.ToLower(gvk.Kind)).
+			For(target).
+			Owns(policy).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileTarget(ctx, gvk, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", gvk.Kind, err)
+		}
+	}
+	return nil
+}
+
+func (r *GatewayPolicyReconciler) reconcileTarget(ctx context.Context, gvk schema.GroupVersionKind, req ctrl.Request) error {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		// the policy of a deleted resource is garbage collected
+		return client.IgnoreNotFound(err)
+	}
+	name := GatewayPolicyName(gvk.Kind, req.Name)
+
+	var backend map[string]interface{}
+	if value, ok := obj.GetAnnotations()[GatewayExtProcAnnotation]; ok && obj.GetDeletionTimestamp().IsZero() {
+		var err error
+		if backend, err = r.backendRef(value, obj.GetNamespace()); err != nil {
+			gatewayPolicyLog.Info("Skipping resource with an invalid ext_proc annotation", "kind", gvk.Kind,
+				"namespace", req.Namespace, "name", req.Name, "error", err.Error())
+		}
+	}
+	if backend == nil {
+		return r.deletePolicy(ctx, obj, name)
+	}
+
+	desired := extensionPolicy(name, obj, backend)
+	if err := controllerutil.SetControllerReference(obj, desired, r.Client.Scheme()); err != nil {
+		return err
+	}
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(EnvoyExtensionPolicyGVK)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create EnvoyExtensionPolicy %s/%s: %w", req.Namespace, name, err)
+		}
+		gatewayPolicyLog.Info("Created EnvoyExtensionPolicy", "namespace", req.Namespace, "name", name, "target", gvk.Kind)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get EnvoyExtensionPolicy %s/%s: %w", req.Namespace, name, err)
+	}
+
+	if !metav1.IsControlledBy(current, obj) {
+		gatewayPolicyLog.Info("Leaving EnvoyExtensionPolicy created by someone else alone", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update EnvoyExtensionPolicy %s/%s: %w", req.Namespace, name, err)
+	}
+	gatewayPolicyLog.Info("Updated EnvoyExtensionPolicy", "namespace", req.Namespace, "name", name)
+	return nil
+}
+
+// backendRef parses name[.namespace][:port]; a Service in another namespace needs a
+// ReferenceGrant there
+func (r *GatewayPolicyReconciler) backendRef(value, namespace string) (map[string]interface{}, error) {
+	value = strings.TrimSpace(value)
+	if value == "true" {
+		if r.DefaultService == "" {
+			return nil, fmt.Errorf("%s is true but no default ext_proc service is configured", GatewayExtProcAnnotation)
+		}
+		value = r.DefaultService
+	}
+	service, port := value, int64(defaultExtProcServicePort)
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		parsed, err := strconv.ParseInt(value[i+1:], 10, 32)
+		if err != nil || parsed < 1 || parsed > 65535 {
+			return nil, fmt.Errorf("invalid port in ext_proc service %q", value)
+		}
+		service, port = value[:i], parsed
+	}
+	name, serviceNamespace, _ := strings.Cut(service, ".")
+	if name == "" {
+		return nil, fmt.Errorf("invalid ext_proc service %q", value)
+	}
+	ref := map[string]interface{}{"name": name, "port": port}
+	if serviceNamespace != "" && serviceNamespace != namespace {
+		ref["namespace"] = serviceNamespace
+	}
+	return ref, nil
+}
+
+// extensionPolicy sends the request headers of the target's traffic to the ext_proc
+// server; like the sidecar Envoy, the processor may ask for the body
+func extensionPolicy(name string, obj *unstructured.Unstructured, backend map[string]interface{}) *unstructured.Unstructured {
+	gvk := obj.GroupVersionKind()
+	spec := map[string]interface{}{
+		"targetRefs": []interface{}{map[string]interface{}{
+			"group": gvk.Group,
+			"kind":  gvk.Kind,
+			"name":  obj.GetName(),
+		}},
+		"extProc": []interface{}{map[string]interface{}{
+			"backendRefs": []interface{}{backend},
+			"processingMode": map[string]interface{}{
+				"request":           map[string]interface{}{},
+				"allowModeOverride": true,
+			},
+		}},
+	}
+
+	policy := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	policy.SetGroupVersionKind(EnvoyExtensionPolicyGVK)
+	policy.SetNamespace(obj.GetNamespace())
+	policy.SetName(name)
+	policy.SetLabels(map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue})
+	return policy
+}
+
+func (r *GatewayPolicyReconciler) deletePolicy(ctx context.Context, obj client.Object, name string) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(EnvoyExtensionPolicyGVK)
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(current, obj) {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete EnvoyExtensionPolicy %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	gatewayPolicyLog.Info("Deleted EnvoyExtensionPolicy", "namespace", obj.GetNamespace(), "name", name)
+	return nil
+}
+
+// GatewayPolicyName is kagenti-<kind>-<name>, shortened with a hash when it does not fit in
+// a resource name
+func GatewayPolicyName(kind, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti-" + kind + "-" + name))
+}
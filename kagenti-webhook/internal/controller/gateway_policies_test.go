@@ -0,0 +1,141 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("GatewayPolicyReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *GatewayPolicyReconciler
+	)
+
+	gatewayGVK, routeGVK := gatewayTargetKinds[0], gatewayTargetKinds[1]
+	target := func(gvk schema.GroupVersionKind, annotation string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace("team1")
+		obj.SetName("web")
+		if annotation != "" {
+			obj.SetAnnotations(map[string]string{GatewayExtProcAnnotation: annotation})
+		}
+		return obj
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		for _, gvk := range []schema.GroupVersionKind{gatewayGVK, routeGVK, EnvoyExtensionPolicyGVK} {
+			scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewGatewayPolicyReconciler(k8sClient, "authbridge-ext-proc.kagenti-system")
+	}
+
+	reconcile := func(gvk schema.GroupVersionKind) error {
+		return reconciler.reconcileTarget(ctx, gvk, ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "web"},
+		})
+	}
+
+	get := func(kind string) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(EnvoyExtensionPolicyGVK)
+		return obj, k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "kagenti-" + kind + "-web"}, obj)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("attaches the default ext_proc service to an annotated Gateway", func() {
+		build(target(gatewayGVK, "true"))
+		Expect(reconcile(gatewayGVK)).To(Succeed())
+
+		obj, err := get("gateway")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetOwnerReferences()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Kind":       Equal("Gateway"),
+			"Name":       Equal("web"),
+			"Controller": PointTo(BeTrue()),
+		})))
+		Expect(obj.Object["spec"]).To(MatchAllKeys(Keys{
+			"targetRefs": ConsistOf(map[string]interface{}{
+				"group": "gateway.networking.k8s.io", "kind": "Gateway", "name": "web",
+			}),
+			"extProc": ConsistOf(MatchAllKeys(Keys{
+				"backendRefs": ConsistOf(map[string]interface{}{
+					"name": "authbridge-ext-proc", "namespace": "kagenti-system", "port": int64(9090),
+				}),
+				"processingMode": HaveKeyWithValue("allowModeOverride", true),
+			})),
+		}))
+	})
+
+	It("uses the service named on an HTTPRoute", func() {
+		build(target(routeGVK, "ext-proc:9191"))
+		Expect(reconcile(routeGVK)).To(Succeed())
+
+		obj, err := get("httproute")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object["spec"]).To(HaveKeyWithValue("extProc", ConsistOf(HaveKeyWithValue("backendRefs",
+			ConsistOf(map[string]interface{}{"name": "ext-proc", "port": int64(9191)})))))
+	})
+
+	It("skips invalid annotations", func() {
+		build(target(routeGVK, "ext-proc:http"))
+		Expect(reconcile(routeGVK)).To(Succeed())
+		_, err := get("httproute")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		build(target(routeGVK, "true"))
+		reconciler.DefaultService = ""
+		Expect(reconcile(routeGVK)).To(Succeed())
+		_, err = get("httproute")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the policy when the annotation is removed", func() {
+		build(target(gatewayGVK, "true"))
+		Expect(reconcile(gatewayGVK)).To(Succeed())
+
+		current := target(gatewayGVK, "")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(current), current)).To(Succeed())
+		current.SetAnnotations(nil)
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile(gatewayGVK)).To(Succeed())
+		_, err := get("gateway")
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,325 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/keycloak"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var namespaceConfigLog = logf.Log.WithName("namespace-config")
+
+const (
+	// ConfigTemplateLabel marks the template ConfigMaps in the template namespace, with the
+	// name of the ConfigMap to create as its value, and the copies made from them
+	ConfigTemplateLabel = "kagenti.io/config-template"
+	// ConfigTemplateModeAnnotation set to create-only on a template creates the copy once
+	// and leaves later edits to the namespace owner, e.g. for per-namespace credentials
+	ConfigTemplateModeAnnotation = "kagenti.io/config-template-mode"
+	ConfigTemplateCreateOnly     = "create-only"
+
+	// realmRecheckInterval is how often a namespace whose realm is unavailable is checked again
+	realmRecheckInterval = time.Minute
+)
+
+// NamespaceConfigReconciler copies the template ConfigMaps, and the default NetworkPolicies
+// if any, into every namespace that has injection enabled, so enabling a namespace is a
+// single label. Copies are kept in sync with their template; ConfigMaps and NetworkPolicies
+// that already existed without the template label are never touched. The outcome, with a
+// check that the namespace's Keycloak realm exists, is recorded as the namespace's
+// Onboarded condition.
+type NamespaceConfigReconciler struct {
+	Client client.Client
+	// Reader reads what the cache does not hold: the namespace's own environments
+	// ConfigMap and existing NetworkPolicies
+	Reader client.Reader
+	// TemplateNamespace holds the template ConfigMaps; it is never provisioned itself
+	TemplateNamespace string
+	// NamespaceLabel is the label (set to "true") that enables injection for a namespace
+	NamespaceLabel string
+	// NetworkPolicies are created in every enabled namespace, named as in their metadata
+	NetworkPolicies []networkingv1.NetworkPolicy
+	// HTTPClient reads the realm's public OpenID configuration
+	HTTPClient *http.Client
+}
+
+// NewNamespaceConfigReconciler returns a reconciler reading templates from templateNamespace
+func NewNamespaceConfigReconciler(c client.Client, reader client.Reader, templateNamespace string) *NamespaceConfigReconciler {
+	return &NamespaceConfigReconciler{
+		Client:            c,
+		Reader:            reader,
+		TemplateNamespace: templateNamespace,
+		NamespaceLabel:    injector.DefaultNamespaceLabel,
+		HTTPClient:        &http.Client{Timeout: 10 * time.Second, Transport: obs.Transport(nil)},
+	}
+}
+
+// LoadNamespaceNetworkPolicies reads the default NetworkPolicies of enabled namespaces from
+// a file with a networkPolicies list
+func LoadNamespaceNetworkPolicies(path string) ([]networkingv1.NetworkPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace NetworkPolicies: %w", err)
+	}
+	var file struct {
+		NetworkPolicies []networkingv1.NetworkPolicy `json:"networkPolicies"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse namespace NetworkPolicies %s: %w", path, err)
+	}
+	for _, policy := range file.NetworkPolicies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("namespace NetworkPolicies in %s need a metadata.name", path)
+		}
+	}
+	return file.NetworkPolicies, nil
+}
+
+// SetupWithManager watches enabled namespaces, the templates and the copies. The manager
+// cache must be limited to ConfigMaps with ConfigTemplateLabel.
+func (r *NamespaceConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	enabled := predicate.NewPredicateFuncs(r.enabled)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("namespace-config").
+		For(&corev1.Namespace{}, builder.WithPredicates(enabled)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.namespacesFor)).
+		Complete(r)
+}
+
+func (r *NamespaceConfigReconciler) enabled(obj client.Object) bool {
+	return obj.GetLabels()[r.NamespaceLabel] == "true" && obj.GetName() != r.TemplateNamespace
+}
+
+// namespacesFor maps a template to every enabled namespace and a copy to its own namespace
+func (r *NamespaceConfigReconciler) namespacesFor(ctx context.Context, obj client.Object) []reconcile.Request {
+	if obj.GetNamespace() != r.TemplateNamespace {
+		return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: obj.GetNamespace()}}}
+	}
+
+	namespaces := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces, client.MatchingLabels{r.NamespaceLabel: "true"}); err != nil {
+		namespaceConfigLog.Error(err, "Failed to list enabled namespaces", "template", obj.GetName())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range namespaces.Items {
+		if r.enabled(&namespaces.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Name: namespaces.Items[i].Name}})
+		}
+	}
+	return requests
+}
+
+// Reconcile creates or updates the copies of all templates in one namespace and records
+// the outcome
+func (r *NamespaceConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespace := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, req.NamespacedName, namespace); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	// Copies stay when the label is removed; deleting them could break running pods
+	if !r.enabled(namespace) || !namespace.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	templates := &corev1.ConfigMapList{}
+	if err := r.Client.List(ctx, templates, client.InNamespace(r.TemplateNamespace),
+		client.HasLabels{ConfigTemplateLabel}); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list ConfigMap templates: %w", err)
+	}
+
+	var errs []error
+	for i := range templates.Items {
+		if err := r.provision(ctx, namespace.Name, &templates.Items[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i := range r.NetworkPolicies {
+		if err := r.provisionNetworkPolicy(ctx, namespace.Name, &r.NetworkPolicies[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return ctrl.Result{}, errors.Join(err, r.recordCondition(ctx, namespace, metav1.ConditionFalse,
+			injector.OnboardingReasonProvisioningFailed, err.Error()))
+	}
+
+	message := fmt.Sprintf("Provisioned %d ConfigMaps and %d NetworkPolicies", len(templates.Items), len(r.NetworkPolicies))
+	realm, err := r.checkRealm(ctx, namespace.Name)
+	if err != nil {
+		namespaceConfigLog.Info("Keycloak realm unavailable", "namespace", namespace.Name, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: realmRecheckInterval}, r.recordCondition(ctx, namespace, metav1.ConditionFalse,
+			injector.OnboardingReasonRealmUnavailable, message+"; "+err.Error())
+	}
+	if realm != "" {
+		message += "; realm " + realm + " found"
+	}
+	return ctrl.Result{}, r.recordCondition(ctx, namespace, metav1.ConditionTrue, injector.OnboardingReasonProvisioned, message)
+}
+
+// checkRealm checks that the Keycloak realm of the namespace's IdP annotations or
+// environments ConfigMap exists, and returns its name. Without both a Keycloak URL and
+// a realm there is nothing to check.
+func (r *NamespaceConfigReconciler) checkRealm(ctx context.Context, namespace string) (string, error) {
+	var keycloakURL, realm string
+	profile, err := injector.NamespaceIDPProfile(ctx, r.Reader, namespace)
+	if err != nil {
+		return "", err
+	}
+	if profile != nil {
+		keycloakURL, realm = profile.KeycloakURL, profile.KeycloakRealm
+	} else {
+		environments := &corev1.ConfigMap{}
+		err := r.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: injector.EnvironmentsConfigMap}, environments)
+		if client.IgnoreNotFound(err) != nil {
+			return "", fmt.Errorf("failed to read ConfigMap %s/%s: %w", namespace, injector.EnvironmentsConfigMap, err)
+		}
+		keycloakURL, realm = environments.Data["KEYCLOAK_URL"], environments.Data["KEYCLOAK_REALM"]
+	}
+	if keycloakURL == "" || realm == "" {
+		return "", nil
+	}
+	if err := keycloak.CheckRealm(ctx, r.HTTPClient, keycloakURL, realm); err != nil {
+		if keycloak.IsNotFound(err) {
+			return "", fmt.Errorf("realm %s does not exist at %s", realm, keycloakURL)
+		}
+		return "", err
+	}
+	return realm, nil
+}
+
+// recordCondition patches the namespace's Onboarded condition if it changed
+func (r *NamespaceConfigReconciler) recordCondition(ctx context.Context, namespace *corev1.Namespace,
+	status metav1.ConditionStatus, reason, message string) error {
+	original := namespace.DeepCopy()
+	if !injector.SetOnboardingCondition(&namespace.ObjectMeta, status, reason, message) {
+		return nil
+	}
+	if err := r.Client.Patch(ctx, namespace, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("failed to record the onboarding condition of namespace %s: %w", namespace.Name, err)
+	}
+	namespaceConfigLog.Info("Recorded onboarding condition", "namespace", namespace.Name, "status", status, "reason", reason)
+	return nil
+}
+
+// provisionNetworkPolicy creates or updates one default NetworkPolicy in the namespace
+func (r *NamespaceConfigReconciler) provisionNetworkPolicy(ctx context.Context, namespace string, policy *networkingv1.NetworkPolicy) error {
+	current := &networkingv1.NetworkPolicy{}
+	err := r.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: policy.Name}, current)
+	if apierrors.IsNotFound(err) {
+		labels := maps.Clone(policy.Labels)
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[ConfigTemplateLabel] = policy.Name
+		desired := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        policy.Name,
+				Namespace:   namespace,
+				Labels:      labels,
+				Annotations: policy.Annotations,
+			},
+			Spec: policy.Spec,
+		}
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create NetworkPolicy %s/%s: %w", namespace, policy.Name, err)
+		}
+		namespaceConfigLog.Info("Created default NetworkPolicy", "namespace", namespace, "networkPolicy", policy.Name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get NetworkPolicy %s/%s: %w", namespace, policy.Name, err)
+	}
+
+	if current.Labels[ConfigTemplateLabel] != policy.Name || equality.Semantic.DeepEqual(current.Spec, policy.Spec) {
+		return nil
+	}
+	current.Spec = policy.Spec
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update NetworkPolicy %s/%s: %w", namespace, policy.Name, err)
+	}
+	namespaceConfigLog.Info("Updated default NetworkPolicy", "namespace", namespace, "networkPolicy", policy.Name)
+	return nil
+}
+
+func (r *NamespaceConfigReconciler) provision(ctx context.Context, namespace string, template *corev1.ConfigMap) error {
+	name := template.Labels[ConfigTemplateLabel]
+	createOnly := template.Annotations[ConfigTemplateModeAnnotation] == ConfigTemplateCreateOnly
+
+	current := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		desired := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{ConfigTemplateLabel: name},
+			},
+			Data:       template.Data,
+			BinaryData: template.BinaryData,
+		}
+		if err := r.Client.Create(ctx, desired); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				// Not in the cache because it lacks the label: created by the namespace owner
+				namespaceConfigLog.Info("Leaving existing ConfigMap alone", "namespace", namespace, "configMap", name)
+				return nil
+			}
+			return fmt.Errorf("failed to create ConfigMap %s/%s: %w", namespace, name, err)
+		}
+		namespaceConfigLog.Info("Created ConfigMap from template", "namespace", namespace, "configMap", name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s/%s: %w", namespace, name, err)
+	}
+
+	if createOnly || current.Labels[ConfigTemplateLabel] != name {
+		return nil
+	}
+	if maps.Equal(current.Data, template.Data) && maps.EqualFunc(current.BinaryData, template.BinaryData,
+		func(a, b []byte) bool { return string(a) == string(b) }) {
+		return nil
+	}
+	current.Data = template.Data
+	current.BinaryData = template.BinaryData
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	namespaceConfigLog.Info("Updated ConfigMap from template", "namespace", namespace, "configMap", name)
+	return nil
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("NamespaceConfigReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *NamespaceConfigReconciler
+	)
+
+	template := func(name, target string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "kagenti-webhook-system",
+				Labels:    map[string]string{ConfigTemplateLabel: target},
+			},
+			Data: data,
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		environments := template("template-environments", "environments", map[string]string{"KEYCLOAK_REALM": "demo"})
+		environments.Annotations = map[string]string{ConfigTemplateModeAnnotation: ConfigTemplateCreateOnly}
+		objects = append(objects,
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Labels: map[string]string{"kagenti-enabled": "true"}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+			template("template-envoy-config", "envoy-config", map[string]string{"envoy.yaml": "v1"}),
+			environments,
+		)
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewNamespaceConfigReconciler(k8sClient, k8sClient, "kagenti-webhook-system")
+	}
+
+	reconcileNamespace := func(name string) {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: name}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	configMap := func(namespace, name string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm)).To(Succeed())
+		return cm
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("copies every template into an enabled namespace", func() {
+		build()
+		reconcileNamespace("team1")
+
+		Expect(configMap("team1", "envoy-config").Data).To(HaveKeyWithValue("envoy.yaml", "v1"))
+		Expect(configMap("team1", "envoy-config").Labels).To(HaveKeyWithValue(ConfigTemplateLabel, "envoy-config"))
+		Expect(configMap("team1", "environments").Data).To(HaveKeyWithValue("KEYCLOAK_REALM", "demo"))
+	})
+
+	It("ignores namespaces without the label", func() {
+		build()
+		reconcileNamespace("plain")
+
+		err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "plain", Name: "envoy-config"}, &corev1.ConfigMap{})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps copies in sync unless the template is create-only", func() {
+		build()
+		reconcileNamespace("team1")
+
+		environments := configMap("team1", "environments")
+		environments.Data["KEYCLOAK_REALM"] = "team1"
+		Expect(k8sClient.Update(ctx, environments)).To(Succeed())
+		envoy := configMap("kagenti-webhook-system", "template-envoy-config")
+		envoy.Data["envoy.yaml"] = "v2"
+		Expect(k8sClient.Update(ctx, envoy)).To(Succeed())
+		reconcileNamespace("team1")
+
+		Expect(configMap("team1", "envoy-config").Data).To(HaveKeyWithValue("envoy.yaml", "v2"))
+		Expect(configMap("team1", "environments").Data).To(HaveKeyWithValue("KEYCLOAK_REALM", "team1"))
+	})
+
+	It("never overwrites ConfigMaps created by the namespace owner", func() {
+		build(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "envoy-config", Namespace: "team1"},
+			Data:       map[string]string{"envoy.yaml": "custom"},
+		})
+		reconcileNamespace("team1")
+
+		Expect(configMap("team1", "envoy-config").Data).To(HaveKeyWithValue("envoy.yaml", "custom"))
+	})
+
+	It("creates the default NetworkPolicies and leaves existing ones alone", func() {
+		build(&networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "custom", Namespace: "team1"}})
+		reconciler.NetworkPolicies = []networkingv1.NetworkPolicy{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "default-deny-ingress"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "custom"},
+				Spec:       networkingv1.NetworkPolicySpec{PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}},
+			},
+		}
+		reconcileNamespace("team1")
+
+		policy := &networkingv1.NetworkPolicy{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "default-deny-ingress"}, policy)).To(Succeed())
+		Expect(policy.Labels).To(HaveKeyWithValue(ConfigTemplateLabel, "default-deny-ingress"))
+		Expect(policy.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeIngress))
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "custom"}, policy)).To(Succeed())
+		Expect(policy.Spec.PolicyTypes).To(BeEmpty())
+	})
+
+	It("records the Onboarded condition with the realm check", func() {
+		keycloak := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/realms/demo/.well-known/openid-configuration" {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		DeferCleanup(keycloak.Close)
+		namespaceWithRealm := func(name, realm string) *corev1.Namespace {
+			return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"kagenti-enabled": "true"},
+				Annotations: map[string]string{
+					injector.NamespaceKeycloakURLAnnotation:   keycloak.URL,
+					injector.NamespaceKeycloakRealmAnnotation: realm,
+				},
+			}}
+		}
+		build(namespaceWithRealm("team2", "demo"), namespaceWithRealm("team3", "missing"))
+		condition := func(name string) *metav1.Condition {
+			namespace := &corev1.Namespace{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Name: name}, namespace)).To(Succeed())
+			return injector.OnboardingCondition(&namespace.ObjectMeta)
+		}
+
+		reconcileNamespace("team1")
+		Expect(condition("team1").Status).To(Equal(metav1.ConditionTrue))
+
+		reconcileNamespace("team2")
+		Expect(*condition("team2")).To(And(
+			HaveField("Status", metav1.ConditionTrue),
+			HaveField("Reason", injector.OnboardingReasonProvisioned),
+			HaveField("Message", ContainSubstring("realm demo found")),
+		))
+
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKey{Name: "team3"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(realmRecheckInterval))
+		Expect(*condition("team3")).To(And(
+			HaveField("Status", metav1.ConditionFalse),
+			HaveField("Reason", injector.OnboardingReasonRealmUnavailable),
+			HaveField("Message", ContainSubstring("realm missing does not exist")),
+		))
+	})
+
+	It("maps a template change to every enabled namespace", func() {
+		build()
+		requests := reconciler.namespacesFor(ctx, template("template-envoy-config", "envoy-config", nil))
+		Expect(requests).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKey{Name: "team1"}}))
+	})
+})
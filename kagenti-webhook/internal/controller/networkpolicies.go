@@ -0,0 +1,325 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var networkPolicyLog = logf.Log.WithName("network-policies")
+
+// EgressUpstreamsAnnotation lists the destinations an injected workload may reach besides
+// Keycloak, comma separated: in-cluster services as <service>.<namespace>[:port], IP
+// addresses or CIDRs, optionally with :port ([addr]:port for IPv6)
+const EgressUpstreamsAnnotation = "kagenti.io/egress-upstreams"
+
+// errUnresolvable marks destinations a NetworkPolicy cannot express, such as external host names
+var errUnresolvable = errors.New("not expressible in a NetworkPolicy")
+
+// NetworkPolicyReconciler keeps one egress NetworkPolicy per injected workload that only
+// lets its pods reach DNS, the Keycloak service client-registration and Envoy talk to, and
+// the upstreams the workload declares, so the sidecars do not widen the pods' network
+// reach. The SPIRE agent is reached through its Unix socket and needs no rule. The
+// NetworkPolicy is owned by the workload and garbage collected with it.
+type NetworkPolicyReconciler struct {
+	Client client.Client
+	// APIReader reads the environments ConfigMap, which the manager's cache does not hold
+	APIReader client.Reader
+	Mutator   *injector.PodMutator
+}
+
+// NewNetworkPolicyReconciler returns a reconciler deciding injection like the AuthBridge webhook
+func NewNetworkPolicyReconciler(c client.Client, apiReader client.Reader, mutator *injector.PodMutator) *NetworkPolicyReconciler {
+	return &NetworkPolicyReconciler{Client: c, APIReader: apiReader, Mutator: mutator}
+}
+
+// SetupWithManager watches every workload kind the AuthBridge webhook mutates and the
+// NetworkPolicies they own
+func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for _, kind := range workloadKinds {
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("network-policies-" + kind.resource).
+			For(kind.newObject()).
+			Owns(&networkingv1.NetworkPolicy{}).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileWorkload(ctx, kind, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", kind.resource, err)
+		}
+	}
+	return nil
+}
+
+func (r *NetworkPolicyReconciler) reconcileWorkload(ctx context.Context, kind workloadKind, req ctrl.Request) error {
+	obj := kind.newObject()
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		// the NetworkPolicy of a deleted workload is garbage collected
+		return client.IgnoreNotFound(err)
+	}
+	name := NetworkPolicyName(kind.gvk.Kind, req.Name)
+
+	template := kind.template(obj)
+	needed := obj.GetDeletionTimestamp().IsZero()
+	if needed {
+		var err error
+		if needed, err = r.Mutator.NeedsMutation(ctx, obj.GetNamespace(), obj.GetName(), obj.GetLabels(), &template.ObjectMeta); err != nil {
+			return err
+		}
+	}
+	if needed && !hasOwnPodLabels(template) {
+		// a selector of only the shared labels would restrict other workloads' pods as well
+		networkPolicyLog.Info("Skipping workload without pod template labels", "kind", kind.gvk.Kind,
+			"namespace", req.Namespace, "name", req.Name)
+		needed = false
+	}
+	if needed {
+		if mode, err := injector.EgressModeFor(template.Annotations, r.Mutator.EgressMode); err != nil || mode == injector.EgressModeIstio {
+			// the Istio sidecar needs istiod and its own upstreams
+			needed = false
+		}
+	}
+	var egress []networkingv1.NetworkPolicyEgressRule
+	if needed {
+		var err error
+		egress, err = r.egressRules(ctx, obj, template)
+		if errors.Is(err, errUnresolvable) {
+			networkPolicyLog.Info("Skipping workload with destinations a NetworkPolicy cannot express", "kind", kind.gvk.Kind,
+				"namespace", req.Namespace, "name", req.Name, "reason", err.Error())
+			needed = false
+		} else if err != nil {
+			return err
+		}
+	}
+	if !needed {
+		return r.deleteNetworkPolicy(ctx, obj, name)
+	}
+
+	desired := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: obj.GetNamespace(),
+			// the same managed-by label as the ClusterSPIFFEIDs; ownership is decided by the owner reference
+			Labels: map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: template.Labels},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+	if err := controllerutil.SetControllerReference(obj, desired, r.Client.Scheme()); err != nil {
+		return err
+	}
+	current := &networkingv1.NetworkPolicy{}
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create NetworkPolicy %s/%s: %w", req.Namespace, name, err)
+		}
+		networkPolicyLog.Info("Created NetworkPolicy", "namespace", req.Namespace, "name", name, "egressRules", len(egress))
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get NetworkPolicy %s/%s: %w", req.Namespace, name, err)
+	}
+
+	if !metav1.IsControlledBy(current, obj) {
+		networkPolicyLog.Info("Leaving NetworkPolicy created by someone else alone", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(current.Spec, desired.Spec) {
+		return nil
+	}
+	current.Spec = desired.Spec
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update NetworkPolicy %s/%s: %w", req.Namespace, name, err)
+	}
+	networkPolicyLog.Info("Updated NetworkPolicy", "namespace", req.Namespace, "name", name)
+	return nil
+}
+
+// hasOwnPodLabels reports whether the pod template has labels besides the one every
+// injected pod template carries
+func hasOwnPodLabels(template *corev1.PodTemplateSpec) bool {
+	for key := range template.Labels {
+		if key != injector.AuthBridgeLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// egressRules allows DNS, Keycloak and the declared upstreams. A Keycloak URL or upstream
+// that is not an in-cluster service with a selector or an IP address is errUnresolvable.
+func (r *NetworkPolicyReconciler) egressRules(ctx context.Context, obj client.Object, template *corev1.PodTemplateSpec) ([]networkingv1.NetworkPolicyEgressRule, error) {
+	dnsPort := intstr.FromInt32(53)
+	rules := []networkingv1.NetworkPolicyEgressRule{{
+		Ports: []networkingv1.NetworkPolicyPort{
+			{Protocol: ptr.To(corev1.ProtocolUDP), Port: &dnsPort},
+			{Protocol: ptr.To(corev1.ProtocolTCP), Port: &dnsPort},
+		},
+	}}
+
+	keycloakURL, _, err := workloadKeycloak(ctx, r.APIReader, r.Mutator, obj, template)
+	if err != nil {
+		return nil, err
+	}
+	if keycloakURL == "" {
+		return nil, fmt.Errorf("unknown Keycloak URL: %w", errUnresolvable)
+	}
+	parsed, err := url.Parse(keycloakURL)
+	if err != nil || parsed.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Keycloak URL %q: %w", keycloakURL, errUnresolvable)
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[parsed.Scheme]
+	}
+	destinations := []string{net.JoinHostPort(parsed.Hostname(), port)}
+	for _, upstream := range strings.Split(obj.GetAnnotations()[EgressUpstreamsAnnotation], ",") {
+		if upstream = strings.TrimSpace(upstream); upstream != "" {
+			destinations = append(destinations, upstream)
+		}
+	}
+
+	for _, destination := range destinations {
+		rule, err := r.egressRule(ctx, obj.GetNamespace(), destination)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// egressRule allows the pods selected by an in-cluster service, or an IP block, optionally
+// on one port
+func (r *NetworkPolicyReconciler) egressRule(ctx context.Context, namespace, destination string) (networkingv1.NetworkPolicyEgressRule, error) {
+	var rule networkingv1.NetworkPolicyEgressRule
+	if prefix, err := netip.ParsePrefix(destination); err == nil {
+		rule.To = []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: prefix.Masked().String()}}}
+		return rule, nil
+	}
+	host, portValue, err := net.SplitHostPort(destination)
+	if err != nil {
+		host, portValue = destination, ""
+	}
+	var port int32
+	if portValue != "" {
+		parsed, err := strconv.ParseInt(portValue, 10, 32)
+		if err != nil || parsed < 1 || parsed > 65535 {
+			return rule, fmt.Errorf("invalid port in %q: %w", destination, errUnresolvable)
+		}
+		port = int32(parsed)
+	}
+
+	if block, ok := ipBlock(host); ok {
+		rule.To = []networkingv1.NetworkPolicyPeer{{IPBlock: block}}
+		if port != 0 {
+			target := intstr.FromInt32(port)
+			rule.Ports = []networkingv1.NetworkPolicyPort{{Port: &target}}
+		}
+		return rule, nil
+	}
+
+	// <service>.<namespace>[.svc[.cluster.local]], or <service> in the workload namespace
+	labels := strings.Split(strings.TrimSuffix(strings.TrimSuffix(host, ".cluster.local"), ".svc"), ".")
+	if len(labels) > 2 {
+		return rule, fmt.Errorf("%q is not an in-cluster service: %w", host, errUnresolvable)
+	}
+	if len(labels) == 2 {
+		namespace = labels[1]
+	}
+	service := &corev1.Service{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: labels[0]}, service); err != nil {
+		return rule, fmt.Errorf("failed to get Service %s/%s for %q: %w", namespace, labels[0], destination, err)
+	}
+	if len(service.Spec.Selector) == 0 {
+		return rule, fmt.Errorf("service %s/%s has no selector: %w", namespace, labels[0], errUnresolvable)
+	}
+	rule.To = []networkingv1.NetworkPolicyPeer{{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: namespace}},
+		PodSelector:       &metav1.LabelSelector{MatchLabels: service.Spec.Selector},
+	}}
+	// NetworkPolicies match the pods' ports, so service ports are translated to target ports
+	for _, servicePort := range service.Spec.Ports {
+		if port != 0 && servicePort.Port != port {
+			continue
+		}
+		target := servicePort.TargetPort
+		if target.IntValue() == 0 && target.Type == intstr.Int {
+			target = intstr.FromInt32(servicePort.Port)
+		}
+		rule.Ports = append(rule.Ports, networkingv1.NetworkPolicyPort{Protocol: ptr.To(servicePort.Protocol), Port: &target})
+	}
+	if port != 0 && len(rule.Ports) == 0 {
+		return rule, fmt.Errorf("service %s/%s has no port %d: %w", namespace, labels[0], port, errUnresolvable)
+	}
+	return rule, nil
+}
+
+// ipBlock is the single-address IP block of an IP address literal
+func ipBlock(host string) (*networkingv1.IPBlock, bool) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil, false
+	}
+	return &networkingv1.IPBlock{CIDR: netip.PrefixFrom(addr, addr.BitLen()).String()}, true
+}
+
+func (r *NetworkPolicyReconciler) deleteNetworkPolicy(ctx context.Context, obj client.Object, name string) error {
+	current := &networkingv1.NetworkPolicy{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(current, obj) {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete NetworkPolicy %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	networkPolicyLog.Info("Deleted NetworkPolicy", "namespace", obj.GetNamespace(), "name", name)
+	return nil
+}
+
+// NetworkPolicyName is kagenti-<kind>-<name>, shortened with a hash when it does not fit
+// in a resource name
+func NetworkPolicyName(kind, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti-" + kind + "-" + name))
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	gomegatypes "github.com/onsi/gomega/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("NetworkPolicyReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *NetworkPolicyReconciler
+	)
+
+	injectLabels := map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}
+	environments := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: injector.EnvironmentsConfigMap, Namespace: "team1"},
+		Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak-service.keycloak.svc:8080", "KEYCLOAK_REALM": "kagenti"},
+	}
+	service := func(namespace, name string, selector map[string]string, port, targetPort int32) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: corev1.ServiceSpec{Selector: selector, Ports: []corev1.ServicePort{{
+				Protocol: corev1.ProtocolTCP, Port: port, TargetPort: intstr.FromInt32(targetPort),
+			}}},
+		}
+	}
+	keycloak := service("keycloak", "keycloak-service", map[string]string{"app": "keycloak"}, 8080, 8080)
+	deployment := func(labels, annotations map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", Labels: labels, Annotations: annotations},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "agent"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			}},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}})
+		// The manager's cache holds no environments ConfigMaps, so only the API reader has them
+		var cached []client.Object
+		for _, obj := range objects {
+			if _, ok := obj.(*corev1.ConfigMap); !ok {
+				cached = append(cached, obj)
+			}
+		}
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(cached...).Build()
+		apiReader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewNetworkPolicyReconciler(k8sClient, apiReader, injector.NewPodMutator(k8sClient, true))
+	}
+
+	reconcile := func() error {
+		return reconciler.reconcileWorkload(ctx, workloadKinds[0], ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "agent"},
+		})
+	}
+
+	get := func() (*networkingv1.NetworkPolicy, error) {
+		policy := &networkingv1.NetworkPolicy{}
+		return policy, k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: NetworkPolicyName("Deployment", "agent")}, policy)
+	}
+
+	servicePeer := func(namespace, app string, port int32) gomegatypes.GomegaMatcher {
+		return MatchFields(IgnoreExtras, Fields{
+			"To": ConsistOf(networkingv1.NetworkPolicyPeer{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{corev1.LabelMetadataName: namespace}},
+				PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			}),
+			"Ports": ConsistOf(MatchFields(IgnoreExtras, Fields{"Port": PointTo(Equal(intstr.FromInt32(port)))})),
+		})
+	}
+	ipBlockPeer := func(cidr string) gomegatypes.GomegaMatcher {
+		return MatchFields(IgnoreExtras, Fields{
+			"To": ConsistOf(networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}}),
+		})
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("allows DNS, Keycloak and the declared upstreams", func() {
+		build(deployment(injectLabels, map[string]string{
+			EgressUpstreamsAnnotation: "backend:80, 10.0.0.0/8, 192.168.1.10:6443, [fd00::1]:443",
+		}), environments, keycloak, service("team1", "backend", map[string]string{"app": "backend"}, 80, 8000))
+		Expect(reconcile()).To(Succeed())
+
+		policy, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.OwnerReferences).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Kind":       Equal("Deployment"),
+			"Name":       Equal("agent"),
+			"Controller": PointTo(BeTrue()),
+		})))
+		Expect(policy.Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": "agent"}))
+		Expect(policy.Spec.PolicyTypes).To(ConsistOf(networkingv1.PolicyTypeEgress))
+		Expect(policy.Spec.Egress).To(HaveLen(6))
+		Expect(policy.Spec.Egress[0].To).To(BeEmpty())
+		Expect(policy.Spec.Egress[0].Ports).To(HaveLen(2))
+		Expect(policy.Spec.Egress[1:]).To(ConsistOf(
+			servicePeer("keycloak", "keycloak", 8080),
+			// NetworkPolicies see the target port of the service
+			servicePeer("team1", "backend", 8000),
+			ipBlockPeer("10.0.0.0/8"),
+			ipBlockPeer("192.168.1.10/32"),
+			ipBlockPeer("fd00::1/128"),
+		))
+	})
+
+	It("retries until the Keycloak service exists and skips external destinations", func() {
+		build(deployment(injectLabels, nil), environments)
+		Expect(reconcile()).To(MatchError(ContainSubstring("keycloak/keycloak-service")))
+
+		build(deployment(injectLabels, map[string]string{EgressUpstreamsAnnotation: "api.example.com:443"}), environments, keycloak)
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("skips workloads without their own pod labels", func() {
+		unlabelled := deployment(injectLabels, nil)
+		unlabelled.Spec.Template.Labels = map[string]string{injector.AuthBridgeLabel: injector.AuthBridgeLabelInjected}
+		build(unlabelled, environments, keycloak)
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the NetworkPolicy when injection is turned off but keeps foreign ones", func() {
+		build(deployment(injectLabels, nil), environments, keycloak)
+		Expect(reconcile()).To(Succeed())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil, nil)), current)).To(Succeed())
+		current.Labels[injector.AuthBridgeInjectLabel] = "false"
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err := get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		foreign := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "team1", Name: NetworkPolicyName("Deployment", "agent"),
+		}}
+		Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+		current.Labels[injector.AuthBridgeInjectLabel] = injector.AuthBridgeInjectValue
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		policy, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy.Spec.Egress).To(BeEmpty())
+	})
+})
@@ -0,0 +1,216 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var spireEntriesLog = logf.Log.WithName("spire-entries")
+
+const (
+	// SpireEntryManagedByLabel marks the ClusterSPIFFEIDs the controller owns; others are never touched
+	SpireEntryManagedByLabel = "app.kubernetes.io/managed-by"
+	SpireEntryManagedByValue = "kagenti-webhook"
+	// SpireEntryWorkloadAnnotation records the kind, namespace and name of the workload
+	SpireEntryWorkloadAnnotation = "kagenti.io/workload"
+
+	// SpiffeIDTemplate matches the SPIFFE IDs the injected sidecars expect, see injector.SpiffeIDPath
+	SpiffeIDTemplate = "spiffe://{{ .TrustDomain }}/ns/{{ .PodMeta.Namespace }}/sa/{{ .PodSpec.ServiceAccountName }}"
+)
+
+// ClusterSPIFFEIDGVK is the SPIRE Controller Manager resource that registers workloads with the SPIRE server
+var ClusterSPIFFEIDGVK = schema.GroupVersionKind{Group: "spire.spiffe.io", Version: "v1alpha1", Kind: "ClusterSPIFFEID"}
+
+// SpireEntryReconciler keeps one ClusterSPIFFEID per workload with injection and SPIRE
+// enabled, so the SPIRE Controller Manager creates its registration entry: pods matching
+// the workload's pod template labels in its namespace get the ID of their service account.
+// ClusterSPIFFEIDs are cluster-scoped and cannot be owned by the workload, so the entry is
+// deleted by the controller when the workload is deleted or opts out.
+type SpireEntryReconciler struct {
+	Client  client.Client
+	Mutator *injector.PodMutator
+	// ClassName, if set, selects the SPIRE Controller Manager that serves the entries
+	ClassName string
+}
+
+// NewSpireEntryReconciler returns a reconciler deciding injection like the AuthBridge webhook
+func NewSpireEntryReconciler(c client.Client, mutator *injector.PodMutator) *SpireEntryReconciler {
+	return &SpireEntryReconciler{Client: c, Mutator: mutator}
+}
+
+// SetupWithManager watches every workload kind the AuthBridge webhook mutates. Only workloads
+// that carry the kagenti.io/spire label, or just lost it, are reconciled.
+func (r *SpireEntryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	hasSpireLabel := func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[injector.SpireEnableLabel]
+		return ok
+	}
+	spireLabelled := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return hasSpireLabel(e.Object) },
+		UpdateFunc:  func(e event.UpdateEvent) bool { return hasSpireLabel(e.ObjectOld) || hasSpireLabel(e.ObjectNew) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return hasSpireLabel(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return hasSpireLabel(e.Object) },
+	}
+	for _, kind := range workloadKinds {
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("spire-entries-"+kind.resource).
+			For(kind.newObject(), builder.WithPredicates(spireLabelled)).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileWorkload(ctx, kind, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", kind.resource, err)
+		}
+	}
+	return nil
+}
+
+func (r *SpireEntryReconciler) reconcileWorkload(ctx context.Context, kind workloadKind, req ctrl.Request) error {
+	name := ClusterSPIFFEIDName(kind.gvk.Kind, req.Namespace, req.Name)
+	obj := kind.newObject()
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); apierrors.IsNotFound(err) {
+		return r.deleteEntry(ctx, name)
+	} else if err != nil {
+		return err
+	}
+
+	template := kind.template(obj)
+	needed := obj.GetDeletionTimestamp().IsZero() && injector.IsSpireEnabled(obj.GetLabels())
+	if needed {
+		var err error
+		if needed, err = r.Mutator.NeedsMutation(ctx, obj.GetNamespace(), obj.GetName(), obj.GetLabels(), &template.ObjectMeta); err != nil {
+			return err
+		}
+	}
+	if needed && template.Annotations[injector.SpiffeIDAnnotation] != "" {
+		// The workload's SPIRE entry was created with another ID, which it names
+		spireEntriesLog.Info("Skipping workload with a SPIFFE ID override", "kind", kind.gvk.Kind,
+			"namespace", req.Namespace, "name", req.Name)
+		needed = false
+	}
+	if needed && len(template.Labels) == 0 {
+		// An empty pod selector would hand the ID to every pod in the namespace
+		spireEntriesLog.Info("Skipping workload without pod template labels", "kind", kind.gvk.Kind,
+			"namespace", req.Namespace, "name", req.Name)
+		needed = false
+	}
+	if !needed {
+		return r.deleteEntry(ctx, name)
+	}
+
+	desired := r.clusterSPIFFEID(name, kind, obj, template)
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(ClusterSPIFFEIDGVK)
+	err := r.Client.Get(ctx, client.ObjectKey{Name: name}, current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create ClusterSPIFFEID %s: %w", name, err)
+		}
+		spireEntriesLog.Info("Created ClusterSPIFFEID", "name", name, "kind", kind.gvk.Kind,
+			"namespace", req.Namespace, "workload", req.Name)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get ClusterSPIFFEID %s: %w", name, err)
+	}
+
+	if current.GetLabels()[SpireEntryManagedByLabel] != SpireEntryManagedByValue {
+		spireEntriesLog.Info("Leaving ClusterSPIFFEID created by someone else alone", "name", name)
+		return nil
+	}
+	if equality.Semantic.DeepEqual(current.Object["spec"], desired.Object["spec"]) {
+		return nil
+	}
+	current.Object["spec"] = desired.Object["spec"]
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update ClusterSPIFFEID %s: %w", name, err)
+	}
+	spireEntriesLog.Info("Updated ClusterSPIFFEID", "name", name)
+	return nil
+}
+
+// clusterSPIFFEID selects the workload's pods by namespace and pod template labels; the
+// service account is part of the ID and of the workload selectors
+func (r *SpireEntryReconciler) clusterSPIFFEID(name string, kind workloadKind, obj client.Object,
+	template *corev1.PodTemplateSpec) *unstructured.Unstructured {
+	podLabels := map[string]interface{}{}
+	for k, v := range template.Labels {
+		podLabels[k] = v
+	}
+	spec := map[string]interface{}{
+		"spiffeIDTemplate": SpiffeIDTemplate,
+		"namespaceSelector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{corev1.LabelMetadataName: obj.GetNamespace()},
+		},
+		"podSelector": map[string]interface{}{"matchLabels": podLabels},
+		"workloadSelectorTemplates": []interface{}{
+			"k8s:ns:{{ .PodMeta.Namespace }}",
+			"k8s:sa:{{ .PodSpec.ServiceAccountName }}",
+		},
+	}
+	if r.ClassName != "" {
+		spec["className"] = r.ClassName
+	}
+
+	entry := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	entry.SetGroupVersionKind(ClusterSPIFFEIDGVK)
+	entry.SetName(name)
+	entry.SetLabels(map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue})
+	entry.SetAnnotations(map[string]string{
+		SpireEntryWorkloadAnnotation: kind.gvk.Kind + "/" + obj.GetNamespace() + "/" + obj.GetName(),
+	})
+	return entry
+}
+
+func (r *SpireEntryReconciler) deleteEntry(ctx context.Context, name string) error {
+	entry := &unstructured.Unstructured{}
+	entry.SetGroupVersionKind(ClusterSPIFFEIDGVK)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name}, entry); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if entry.GetLabels()[SpireEntryManagedByLabel] != SpireEntryManagedByValue {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, entry); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete ClusterSPIFFEID %s: %w", name, err)
+	}
+	spireEntriesLog.Info("Deleted ClusterSPIFFEID", "name", name)
+	return nil
+}
+
+// ClusterSPIFFEIDName is kagenti.<kind>.<namespace>.<name>, shortened with a hash when it
+// does not fit in a resource name
+func ClusterSPIFFEIDName(kind, namespace, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti." + kind + "." + namespace + "." + name))
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("SpireEntryReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *SpireEntryReconciler
+	)
+
+	spireLabels := map[string]string{
+		injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+		injector.SpireEnableLabel:      injector.SpireEnabledValue,
+	}
+	deployment := func(labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", Labels: labels},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "agent"}},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+			}},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		scheme.AddKnownTypeWithName(ClusterSPIFFEIDGVK, &unstructured.Unstructured{})
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}})
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewSpireEntryReconciler(k8sClient, injector.NewPodMutator(k8sClient, true))
+	}
+
+	reconcile := func() error {
+		return reconciler.reconcileWorkload(ctx, workloadKinds[0], ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "agent"},
+		})
+	}
+
+	entry := func() (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(ClusterSPIFFEIDGVK)
+		return obj, k8sClient.Get(ctx, client.ObjectKey{Name: "kagenti.deployment.team1.agent"}, obj)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("registers the pods of an injected SPIRE workload", func() {
+		build(deployment(spireLabels))
+		reconciler.ClassName = "spire-system-spire"
+		Expect(reconcile()).To(Succeed())
+
+		obj, err := entry()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetLabels()).To(HaveKeyWithValue(SpireEntryManagedByLabel, SpireEntryManagedByValue))
+		Expect(obj.GetAnnotations()).To(HaveKeyWithValue(SpireEntryWorkloadAnnotation, "Deployment/team1/agent"))
+		Expect(obj.Object["spec"]).To(MatchAllKeys(Keys{
+			"spiffeIDTemplate":  Equal(SpiffeIDTemplate),
+			"className":         Equal("spire-system-spire"),
+			"namespaceSelector": HaveKeyWithValue("matchLabels", HaveKeyWithValue(corev1.LabelMetadataName, "team1")),
+			"podSelector":       HaveKeyWithValue("matchLabels", HaveKeyWithValue("app", "agent")),
+			"workloadSelectorTemplates": ConsistOf(
+				"k8s:ns:{{ .PodMeta.Namespace }}", "k8s:sa:{{ .PodSpec.ServiceAccountName }}"),
+		}))
+	})
+
+	It("follows pod label changes and removes the entry when SPIRE is turned off", func() {
+		build(deployment(spireLabels))
+		Expect(reconcile()).To(Succeed())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil)), current)).To(Succeed())
+		current.Spec.Template.Labels["version"] = "v2"
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		obj, err := entry()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.Object["spec"]).To(HaveKeyWithValue("podSelector",
+			HaveKeyWithValue("matchLabels", HaveKeyWithValue("version", "v2"))))
+
+		current.Labels[injector.SpireEnableLabel] = injector.SpireDisabledValue
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err = entry()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes the entry of a deleted workload but not entries it does not manage", func() {
+		build(deployment(spireLabels))
+		Expect(reconcile()).To(Succeed())
+		Expect(k8sClient.Delete(ctx, deployment(nil))).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err := entry()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		foreign := &unstructured.Unstructured{}
+		foreign.SetGroupVersionKind(ClusterSPIFFEIDGVK)
+		foreign.SetName("kagenti.deployment.team1.agent")
+		Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err = entry()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("skips workloads without SPIRE or pod template labels", func() {
+		unlabelled := deployment(spireLabels)
+		unlabelled.Spec.Template.Labels = nil
+		build(unlabelled)
+		Expect(reconcile()).To(Succeed())
+		_, err := entry()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+		build(deployment(map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}))
+		Expect(reconcile()).To(Succeed())
+		_, err = entry()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("removes its entry when the workload names a pre-created SPIFFE ID", func() {
+		build(deployment(spireLabels))
+		Expect(reconcile()).To(Succeed())
+		_, err := entry()
+		Expect(err).NotTo(HaveOccurred())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment(nil)), current)).To(Succeed())
+		current.Spec.Template.Annotations = map[string]string{injector.SpiffeIDAnnotation: "spiffe://example.org/agents/agent"}
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcile()).To(Succeed())
+		_, err = entry()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("shortens names that do not fit in a resource name", func() {
+		name := ClusterSPIFFEIDName("Deployment", "team1", strings.Repeat("a", 253))
+		Expect(len(name)).To(BeNumerically("<=", 253))
+		Expect(name).To(HavePrefix("kagenti.deployment.team1.aaa"))
+		Expect(name).NotTo(Equal(ClusterSPIFFEIDName("Deployment", "team2", strings.Repeat("a", 253))))
+	})
+})
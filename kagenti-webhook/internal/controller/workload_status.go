@@ -0,0 +1,377 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var workloadStatusLog = logf.Log.WithName("workload-status")
+
+// AuthBridgeStatusGVK is the per-workload summary of the AuthBridge sidecars, defined by
+// the chart's authbridgestatus-crd.yaml
+var AuthBridgeStatusGVK = schema.GroupVersionKind{Group: "kagenti.io", Version: "v1alpha1", Kind: "AuthBridgeStatus"}
+
+// Condition types of an AuthBridgeStatus
+const (
+	// SVIDIssuedCondition is spiffe-helper being ready in every pod; it is left out for
+	// workloads without SPIRE
+	SVIDIssuedCondition = "SVIDIssued"
+	// ClientRegisteredCondition is client-registration having completed in every pod
+	ClientRegisteredCondition = "ClientRegistered"
+	// ProxyReadyCondition is envoy-proxy being ready in every pod
+	ProxyReadyCondition = "ProxyReady"
+	// AuthBridgeReadyCondition is all of them
+	AuthBridgeReadyCondition = "Ready"
+)
+
+// cronJobSuffix is the scheduled time the CronJob controller appends to its Job names
+var cronJobSuffix = regexp.MustCompile(`-[0-9]+$`)
+
+// authBridgeStatus is the status of an AuthBridgeStatus
+type authBridgeStatus struct {
+	Workload  authBridgeStatusWorkload `json:"workload"`
+	Pods      int64                    `json:"pods"`
+	ReadyPods int64                    `json:"readyPods"`
+	// Conditions are True when they hold in every pod and name the first pod failing otherwise
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+type authBridgeStatusWorkload struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// WorkloadStatusReconciler keeps one AuthBridgeStatus per injected workload, so that
+// "kubectl get authbridgestatuses -A" shows whether the SVIDs, the client registrations
+// and the proxies of every workload are healthy. The status is computed from the container
+// statuses of the workload's non-terminated pods and is owned by the workload.
+type WorkloadStatusReconciler struct {
+	Client client.Client
+}
+
+// NewWorkloadStatusReconciler returns a reconciler writing AuthBridgeStatuses with c
+func NewWorkloadStatusReconciler(c client.Client) *WorkloadStatusReconciler {
+	return &WorkloadStatusReconciler{Client: c}
+}
+
+// SetupWithManager watches every workload kind the AuthBridge webhook mutates, the
+// AuthBridgeStatuses they own and their injected pods
+func (r *WorkloadStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	for _, kind := range workloadKinds {
+		status := &unstructured.Unstructured{}
+		status.SetGroupVersionKind(AuthBridgeStatusGVK)
+		err := ctrl.NewControllerManagedBy(mgr).
+			Named("workload-status-"+kind.resource).
+			For(kind.newObject()).
+			Owns(status).
+			Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+				return podWorkloads(kind, obj)
+			})).
+			Complete(reconcile.Func(func(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+				return ctrl.Result{}, r.reconcileWorkload(ctx, kind, req)
+			}))
+		if err != nil {
+			return fmt.Errorf("failed to watch %s: %w", kind.resource, err)
+		}
+	}
+	return nil
+}
+
+// podWorkloads maps an injected pod to the workload of the kind that controls it, going
+// through the ReplicaSet of a Deployment and the Job of a CronJob by their naming rules
+func podWorkloads(kind workloadKind, obj client.Object) []reconcile.Request {
+	if obj.GetLabels()[injector.AuthBridgeLabel] != injector.AuthBridgeLabelInjected {
+		return nil
+	}
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return nil
+	}
+	name := ""
+	switch {
+	case owner.Kind == kind.gvk.Kind:
+		name = owner.Name
+	case owner.Kind == "ReplicaSet" && kind.gvk.Kind == "Deployment":
+		if hash := obj.GetLabels()["pod-template-hash"]; hash != "" && strings.HasSuffix(owner.Name, "-"+hash) {
+			name = strings.TrimSuffix(owner.Name, "-"+hash)
+		}
+	case owner.Kind == "Job" && kind.gvk.Kind == "CronJob":
+		if cronJobSuffix.MatchString(owner.Name) {
+			name = cronJobSuffix.ReplaceAllString(owner.Name, "")
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}}}
+}
+
+func (r *WorkloadStatusReconciler) reconcileWorkload(ctx context.Context, kind workloadKind, req ctrl.Request) error {
+	obj := kind.newObject()
+	if err := r.Client.Get(ctx, req.NamespacedName, obj); err != nil {
+		// A deleted workload's status is garbage collected with it
+		return client.IgnoreNotFound(err)
+	}
+	name := AuthBridgeStatusName(kind.gvk.Kind, req.Name)
+	template := kind.template(obj)
+	if !obj.GetDeletionTimestamp().IsZero() || !injector.IsInjected(&template.ObjectMeta) {
+		return r.deleteStatus(ctx, obj, name)
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.Client.List(ctx, pods, client.InNamespace(req.Namespace), client.MatchingLabels(template.Labels)); err != nil {
+		return fmt.Errorf("failed to list the pods of %s %s/%s: %w", kind.gvk.Kind, req.Namespace, req.Name, err)
+	}
+
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(AuthBridgeStatusGVK)
+	err := r.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, current)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get AuthBridgeStatus %s/%s: %w", req.Namespace, name, err)
+	}
+	exists := err == nil
+	if exists && !metav1.IsControlledBy(current, obj) {
+		workloadStatusLog.Info("Leaving AuthBridgeStatus created by someone else alone", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	previous := authBridgeStatus{}
+	if raw, ok := current.Object["status"].(map[string]interface{}); exists && ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, &previous); err != nil {
+			workloadStatusLog.Error(err, "Replacing unreadable AuthBridgeStatus", "namespace", req.Namespace, "name", name)
+			previous = authBridgeStatus{}
+		}
+	}
+
+	status := workloadHealth(pods.Items, hasContainer(&template.Spec, injector.SpiffeHelperContainerName), previous.Conditions)
+	status.Workload = authBridgeStatusWorkload{
+		APIVersion: schema.GroupVersion{Group: kind.gvk.Group, Version: kind.gvk.Version}.String(),
+		Kind:       kind.gvk.Kind,
+		Name:       req.Name,
+	}
+	if exists && equality.Semantic.DeepEqual(previous, status) {
+		return nil
+	}
+	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		desired := &unstructured.Unstructured{Object: map[string]interface{}{"status": raw}}
+		desired.SetGroupVersionKind(AuthBridgeStatusGVK)
+		desired.SetNamespace(req.Namespace)
+		desired.SetName(name)
+		desired.SetLabels(map[string]string{SpireEntryManagedByLabel: SpireEntryManagedByValue})
+		if err := controllerutil.SetControllerReference(obj, desired, r.Client.Scheme()); err != nil {
+			return err
+		}
+		if err := r.Client.Create(ctx, desired); err != nil {
+			return fmt.Errorf("failed to create AuthBridgeStatus %s/%s: %w", req.Namespace, name, err)
+		}
+		workloadStatusLog.Info("Created AuthBridgeStatus", "namespace", req.Namespace, "name", name)
+		return nil
+	}
+	current.Object["status"] = raw
+	if err := r.Client.Update(ctx, current); err != nil {
+		return fmt.Errorf("failed to update AuthBridgeStatus %s/%s: %w", req.Namespace, name, err)
+	}
+	workloadStatusLog.V(1).Info("Updated AuthBridgeStatus", "namespace", req.Namespace, "name", name,
+		"pods", status.Pods, "readyPods", status.ReadyPods)
+	return nil
+}
+
+// sidecarCheck is one condition of an AuthBridgeStatus, checked on one injected container
+type sidecarCheck struct {
+	condition string
+	container string
+	// failedReason is the condition reason when a pod fails the check
+	failedReason string
+	healthy      func(status *corev1.ContainerStatus) bool
+}
+
+func sidecarReady(status *corev1.ContainerStatus) bool {
+	return status.Ready
+}
+
+func completed(status *corev1.ContainerStatus) bool {
+	return status.State.Terminated != nil && status.State.Terminated.ExitCode == 0
+}
+
+// workloadHealth checks the injected containers of the pods that have not succeeded or
+// are not being deleted. The transition times of previous are kept while a condition holds.
+func workloadHealth(pods []corev1.Pod, spireEnabled bool, previous []metav1.Condition) authBridgeStatus {
+	checks := []sidecarCheck{}
+	if spireEnabled {
+		checks = append(checks, sidecarCheck{SVIDIssuedCondition, injector.SpiffeHelperContainerName, "SVIDNotReady", sidecarReady})
+	}
+	checks = append(checks,
+		sidecarCheck{ClientRegisteredCondition, injector.ClientRegistrationContainerName, "RegistrationIncomplete", completed},
+		sidecarCheck{ProxyReadyCondition, injector.EnvoyProxyContainerName, "ProxyNotReady", sidecarReady},
+	)
+
+	status := authBridgeStatus{}
+	failures := make([]string, len(checks))
+	failing := make([]int, len(checks))
+	for i := range pods {
+		pod := &pods[i]
+		if !pod.DeletionTimestamp.IsZero() || pod.Status.Phase == corev1.PodSucceeded {
+			continue
+		}
+		status.Pods++
+		healthy := true
+		for c, check := range checks {
+			container := containerStatus(pod, check.container)
+			if container != nil && check.healthy(container) {
+				continue
+			}
+			healthy = false
+			if failing[c]++; failures[c] == "" {
+				failures[c] = fmt.Sprintf("%s in pod %s: %s", check.container, pod.Name, containerProblem(container))
+			}
+		}
+		if healthy {
+			status.ReadyPods++
+		}
+	}
+
+	conditions := append([]metav1.Condition{}, previous...)
+	set := func(condition string, state metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&conditions, metav1.Condition{Type: condition, Status: state, Reason: reason, Message: message})
+	}
+	if !spireEnabled {
+		meta.RemoveStatusCondition(&conditions, SVIDIssuedCondition)
+	}
+	if status.Pods == 0 {
+		for _, check := range checks {
+			set(check.condition, metav1.ConditionUnknown, "NoPods", "The workload has no running pods")
+		}
+		set(AuthBridgeReadyCondition, metav1.ConditionUnknown, "NoPods", "The workload has no running pods")
+	} else {
+		notReady := []string{}
+		for c, check := range checks {
+			if failing[c] == 0 {
+				set(check.condition, metav1.ConditionTrue, "AllPods", fmt.Sprintf("%d of %d pods", status.Pods, status.Pods))
+				continue
+			}
+			notReady = append(notReady, check.condition)
+			set(check.condition, metav1.ConditionFalse, check.failedReason,
+				fmt.Sprintf("%d of %d pods failing, %s", failing[c], status.Pods, failures[c]))
+		}
+		if len(notReady) == 0 {
+			set(AuthBridgeReadyCondition, metav1.ConditionTrue, "AllSidecarsHealthy",
+				fmt.Sprintf("%d of %d pods", status.ReadyPods, status.Pods))
+		} else {
+			set(AuthBridgeReadyCondition, metav1.ConditionFalse, "SidecarsUnhealthy",
+				fmt.Sprintf("%d of %d pods ready, not %s", status.ReadyPods, status.Pods, strings.Join(notReady, ", ")))
+		}
+	}
+	// Keep a stable order whatever the conditions of previous were
+	status.Conditions = make([]metav1.Condition, 0, len(conditions))
+	for _, check := range append(checks, sidecarCheck{condition: AuthBridgeReadyCondition}) {
+		if condition := meta.FindStatusCondition(conditions, check.condition); condition != nil {
+			status.Conditions = append(status.Conditions, *condition)
+		}
+	}
+	return status
+}
+
+// containerStatus also looks at regular containers, where older webhook versions put the sidecars
+func containerStatus(pod *corev1.Pod, name string) *corev1.ContainerStatus {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for i := range statuses {
+			if statuses[i].Name == name {
+				return &statuses[i]
+			}
+		}
+	}
+	return nil
+}
+
+// containerProblem describes why a container fails its check
+func containerProblem(status *corev1.ContainerStatus) string {
+	switch {
+	case status == nil:
+		return "not started"
+	case status.State.Waiting != nil:
+		problem := status.State.Waiting.Reason
+		if last := status.LastTerminationState.Terminated; last != nil {
+			problem += fmt.Sprintf(", last exit code %d", last.ExitCode)
+		}
+		return problem
+	case status.State.Terminated != nil:
+		return fmt.Sprintf("exited with code %d", status.State.Terminated.ExitCode)
+	case status.State.Running != nil && !status.Ready:
+		return fmt.Sprintf("running, not ready, %d restarts", status.RestartCount)
+	}
+	return "running"
+}
+
+func hasContainer(podSpec *corev1.PodSpec, name string) bool {
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for _, container := range containers {
+			if container.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *WorkloadStatusReconciler) deleteStatus(ctx context.Context, obj client.Object, name string) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(AuthBridgeStatusGVK)
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(current, obj) {
+		return nil
+	}
+	if err := r.Client.Delete(ctx, current); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("failed to delete AuthBridgeStatus %s/%s: %w", obj.GetNamespace(), name, err)
+	}
+	workloadStatusLog.Info("Deleted AuthBridgeStatus", "namespace", obj.GetNamespace(), "name", name)
+	return nil
+}
+
+// AuthBridgeStatusName is kagenti-<kind>-<name>, shortened with a hash when it does not
+// fit in a resource name
+func AuthBridgeStatusName(kind, name string) string {
+	return injector.ShortenName(strings.ToLower("kagenti-" + kind + "-" + name))
+}
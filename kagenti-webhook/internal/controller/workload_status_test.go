@@ -0,0 +1,230 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+var _ = Describe("WorkloadStatusReconciler", func() {
+	var (
+		ctx        context.Context
+		k8sClient  client.Client
+		reconciler *WorkloadStatusReconciler
+	)
+
+	podLabels := map[string]string{"app": "agent", injector.AuthBridgeLabel: injector.AuthBridgeLabelInjected}
+	deployment := func(injected, spire bool) *appsv1.Deployment {
+		initContainers := []corev1.Container{{Name: injector.ClientRegistrationContainerName}, {Name: injector.EnvoyProxyContainerName}}
+		if spire {
+			initContainers = append([]corev1.Container{{Name: injector.SpiffeHelperContainerName}}, initContainers...)
+		}
+		template := corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+			Spec:       corev1.PodSpec{InitContainers: initContainers, Containers: []corev1.Container{{Name: "app"}}},
+		}
+		if injected {
+			template.Annotations = map[string]string{injector.InjectionStatusAnnotation: injector.InjectionStatusInjected}
+		}
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "team1", UID: "agent-uid"},
+			Spec:       appsv1.DeploymentSpec{Template: template},
+		}
+	}
+	ready := func(name string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Name: name, Ready: true, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+	}
+	registered := corev1.ContainerStatus{
+		Name:  injector.ClientRegistrationContainerName,
+		State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+	}
+	pod := func(name string, statuses ...corev1.ContainerStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team1", Labels: podLabels},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, InitContainerStatuses: statuses},
+		}
+	}
+
+	build := func(objects ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		scheme.AddKnownTypeWithName(AuthBridgeStatusGVK, &unstructured.Unstructured{})
+		k8sClient = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+		reconciler = NewWorkloadStatusReconciler(k8sClient)
+	}
+
+	reconcileDeployment := func() error {
+		return reconciler.reconcileWorkload(ctx, workloadKinds[0], ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "team1", Name: "agent"},
+		})
+	}
+
+	get := func() (authBridgeStatus, *unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(AuthBridgeStatusGVK)
+		status := authBridgeStatus{}
+		if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "kagenti-deployment-agent"}, obj); err != nil {
+			return status, obj, err
+		}
+		err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object["status"].(map[string]interface{}), &status)
+		return status, obj, err
+	}
+
+	condition := func(conditionType string, status metav1.ConditionStatus) OmegaMatcher {
+		return MatchFields(IgnoreExtras, Fields{"Type": Equal(conditionType), "Status": Equal(status)})
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("reports healthy sidecars in every pod", func() {
+		healthy := []corev1.ContainerStatus{ready(injector.SpiffeHelperContainerName), registered, ready(injector.EnvoyProxyContainerName)}
+		build(deployment(true, true), pod("agent-1", healthy...), pod("agent-2", healthy...))
+		Expect(reconcileDeployment()).To(Succeed())
+
+		status, obj, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetOwnerReferences()).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Kind":       Equal("Deployment"),
+			"Name":       Equal("agent"),
+			"Controller": PointTo(BeTrue()),
+		})))
+		Expect(status.Workload).To(Equal(authBridgeStatusWorkload{APIVersion: "apps/v1", Kind: "Deployment", Name: "agent"}))
+		Expect(status.Pods).To(BeEquivalentTo(2))
+		Expect(status.ReadyPods).To(BeEquivalentTo(2))
+		Expect(status.Conditions).To(HaveExactElements(
+			condition(SVIDIssuedCondition, metav1.ConditionTrue),
+			condition(ClientRegisteredCondition, metav1.ConditionTrue),
+			condition(ProxyReadyCondition, metav1.ConditionTrue),
+			condition(AuthBridgeReadyCondition, metav1.ConditionTrue),
+		))
+
+		By("leaving an unchanged status alone")
+		resourceVersion := obj.GetResourceVersion()
+		Expect(reconcileDeployment()).To(Succeed())
+		_, obj, err = get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(obj.GetResourceVersion()).To(Equal(resourceVersion))
+	})
+
+	It("names the pod whose registration fails", func() {
+		failing := corev1.ContainerStatus{
+			Name:                 injector.ClientRegistrationContainerName,
+			State:                corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+		}
+		build(deployment(true, false),
+			pod("agent-1", registered, ready(injector.EnvoyProxyContainerName)),
+			pod("agent-2", failing))
+		Expect(reconcileDeployment()).To(Succeed())
+
+		status, _, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.ReadyPods).To(BeEquivalentTo(1))
+		Expect(status.Conditions).To(HaveExactElements(
+			MatchFields(IgnoreExtras, Fields{
+				"Type":    Equal(ClientRegisteredCondition),
+				"Status":  Equal(metav1.ConditionFalse),
+				"Message": Equal("1 of 2 pods failing, kagenti-client-registration in pod agent-2: CrashLoopBackOff, last exit code 1"),
+			}),
+			MatchFields(IgnoreExtras, Fields{
+				"Type":    Equal(ProxyReadyCondition),
+				"Status":  Equal(metav1.ConditionFalse),
+				"Message": ContainSubstring("envoy-proxy in pod agent-2: not started"),
+			}),
+			condition(AuthBridgeReadyCondition, metav1.ConditionFalse),
+		))
+	})
+
+	It("is unknown without running pods", func() {
+		succeeded := pod("agent-1")
+		succeeded.Status.Phase = corev1.PodSucceeded
+		build(deployment(true, false), succeeded)
+		Expect(reconcileDeployment()).To(Succeed())
+
+		status, _, err := get()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Pods).To(BeZero())
+		Expect(status.Conditions).To(ContainElement(condition(AuthBridgeReadyCondition, metav1.ConditionUnknown)))
+	})
+
+	It("deletes the status of a workload that is no longer injected", func() {
+		build(deployment(true, false))
+		Expect(reconcileDeployment()).To(Succeed())
+		_, _, err := get()
+		Expect(err).NotTo(HaveOccurred())
+
+		current := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "team1", Name: "agent"}, current)).To(Succeed())
+		current.Spec.Template.Annotations = nil
+		Expect(k8sClient.Update(ctx, current)).To(Succeed())
+		Expect(reconcileDeployment()).To(Succeed())
+		_, _, err = get()
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("maps pods to the workloads that control them", func() {
+		owned := func(kind, name string, labels map[string]string) *corev1.Pod {
+			merged := map[string]string{}
+			for k, v := range podLabels {
+				merged[k] = v
+			}
+			for k, v := range labels {
+				merged[k] = v
+			}
+			return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name: "pod", Namespace: "team1", Labels: merged,
+				OwnerReferences: []metav1.OwnerReference{{Kind: kind, Name: name, Controller: ptr.To(true)}},
+			}}
+		}
+		request := func(name string) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "team1", Name: name}}}
+		}
+		deployments, statefulSets, cronJobs := workloadKinds[0], workloadKinds[1], workloadKinds[4]
+
+		Expect(podWorkloads(deployments, owned("ReplicaSet", "agent-5d8f7", map[string]string{"pod-template-hash": "5d8f7"}))).
+			To(Equal(request("agent")))
+		Expect(podWorkloads(statefulSets, owned("StatefulSet", "db", nil))).To(Equal(request("db")))
+		Expect(podWorkloads(cronJobs, owned("Job", "report-29012345", nil))).To(Equal(request("report")))
+		Expect(podWorkloads(deployments, owned("StatefulSet", "db", nil))).To(BeEmpty())
+
+		notInjected := owned("StatefulSet", "db", nil)
+		delete(notInjected.Labels, injector.AuthBridgeLabel)
+		Expect(podWorkloads(statefulSets, notInjected)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,265 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keycloak is a Keycloak admin REST client shared by the webhook manager, its
+// controllers and tests. Requests are rate limited and retried on transient failures.
+package keycloak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+// AdminRealm is the realm the admin user authenticates against, as in client-registration
+const AdminRealm = "master"
+
+const (
+	// DefaultMaxRetries is how often a request is retried after a transient failure
+	DefaultMaxRetries = 3
+	// DefaultRetryBackoff is the delay before the first retry; it doubles with each attempt
+	DefaultRetryBackoff = 500 * time.Millisecond
+	// DefaultMaxRetryDelay caps the delay before a retry, including one asked for by Retry-After
+	DefaultMaxRetryDelay = 30 * time.Second
+	// DefaultRateLimit bounds the admin requests per second of one Client
+	DefaultRateLimit = 10
+	// DefaultRateBurst is the number of requests allowed above DefaultRateLimit at once
+	DefaultRateBurst = 20
+
+	// tokenExpiryLeeway renews the admin token this long before it expires
+	tokenExpiryLeeway = 10 * time.Second
+)
+
+// Client calls the admin API of one realm with an admin user's password grant
+type Client struct {
+	BaseURL    string
+	Realm      string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+	// Limiter paces all requests, including token requests; nil disables rate limiting
+	Limiter *rate.Limiter
+	// MaxRetries is the number of retries after a transport error, 429 or 5xx response.
+	// Requests that are not idempotent, such as creates, are only retried after a 429.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, unless the server sends Retry-After
+	RetryBackoff time.Duration
+	// MaxRetryDelay caps the delay before a retry, 0 for no cap
+	MaxRetryDelay time.Duration
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+// NewClient returns a Client for the realm with a bounded request timeout, traced
+// requests and the default retry and rate limit settings
+func NewClient(baseURL, realm, username, password string) *Client {
+	return &Client{
+		BaseURL:       strings.TrimSuffix(baseURL, "/"),
+		Realm:         realm,
+		Username:      username,
+		Password:      password,
+		HTTPClient:    &http.Client{Timeout: 30 * time.Second, Transport: obs.Transport(nil)},
+		Limiter:       rate.NewLimiter(DefaultRateLimit, DefaultRateBurst),
+		MaxRetries:    DefaultMaxRetries,
+		RetryBackoff:  DefaultRetryBackoff,
+		MaxRetryDelay: DefaultMaxRetryDelay,
+	}
+}
+
+// StatusError is returned for admin API responses with an unexpected status
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("failed to %s: unexpected status %s", e.Op, e.Status)
+	}
+	return fmt.Sprintf("failed to %s: unexpected status %s: %s", e.Op, e.Status, e.Body)
+}
+
+// IsNotFound reports whether err is a 404 from the admin API or ErrClientNotFound
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusNotFound
+	}
+	return errors.Is(err, ErrClientNotFound)
+}
+
+// IsConflict reports whether err is a 409 from the admin API, e.g. for an existing clientId
+func IsConflict(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict
+}
+
+func (c *Client) realmURL(format string, args ...any) string {
+	return fmt.Sprintf("%s/admin/realms/%s", c.BaseURL, url.PathEscape(c.Realm)) + fmt.Sprintf(format, args...)
+}
+
+// token returns the cached admin token, requesting a new one when it is about to expire
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.accessToken != "" && time.Now().Before(c.expiresAt) {
+		return c.accessToken, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {"admin-cli"},
+		"username":   {c.Username},
+		"password":   {c.Password},
+	}
+	endpoint := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", c.BaseURL, AdminRealm)
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	// a token request changes nothing, so it is retried like a GET
+	resp, err := c.send(ctx, http.MethodPost, endpoint, header, []byte(form.Encode()), true)
+	if err != nil {
+		return "", fmt.Errorf("failed to get admin token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError("get admin token", resp)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode admin token: %w", err)
+	}
+	c.accessToken = token.AccessToken
+	c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - tokenExpiryLeeway)
+	return c.accessToken, nil
+}
+
+func (c *Client) resetToken() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = ""
+}
+
+// do sends an authenticated admin request with body encoded as JSON. A 401 drops the
+// cached token and repeats the request once with a new one.
+func (c *Client) do(ctx context.Context, method, endpoint string, body any) (*http.Response, error) {
+	var payload []byte
+	header := http.Header{}
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+		header.Set("Content-Type", "application/json")
+	}
+
+	for renewed := false; ; renewed = true {
+		token, err := c.token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		header.Set("Authorization", "Bearer "+token)
+		resp, err := c.send(ctx, method, endpoint, header, payload, idempotent(method))
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || renewed {
+			return resp, err
+		}
+		_ = resp.Body.Close()
+		c.resetToken()
+	}
+}
+
+// send paces and retries one request; the payload is replayed on every attempt. A request
+// that is not idempotent is only retried when the server refused it with 429, since after
+// a transport error or 5xx it may have taken effect and a second create would fail with 409.
+func (c *Client) send(ctx context.Context, method, endpoint string, header http.Header, payload []byte, idempotent bool) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if c.Limiter != nil {
+			if err := c.Limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header.Clone()
+		resp, err := c.HTTPClient.Do(req)
+		if attempt >= c.MaxRetries || !retryable(resp, err, idempotent) {
+			return resp, err
+		}
+
+		delay := c.RetryBackoff << attempt
+		if resp != nil {
+			if after, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil {
+				delay = time.Duration(after) * time.Second
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		if c.MaxRetryDelay > 0 {
+			delay = min(delay, c.MaxRetryDelay)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func retryable(resp *http.Response, err error, idempotent bool) bool {
+	if !idempotent {
+		return err == nil && resp.StatusCode == http.StatusTooManyRequests
+	}
+	if err != nil {
+		// a cancelled or expired context is final
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// idempotent reports whether repeating a request with method has the same effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch:
+		return false
+	}
+	return true
+}
+
+func statusError(op string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return &StatusError{Op: op, StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+}
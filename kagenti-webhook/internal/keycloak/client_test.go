@@ -0,0 +1,278 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/utils/ptr"
+)
+
+// fakeRealm is an in-memory "demo" realm serving the admin endpoints the Client uses
+type fakeRealm struct {
+	mu       sync.Mutex
+	clients  map[string]*ClientRepresentation
+	nextID   int
+	tokens   int
+	deleted  []string
+	failures int
+	token    string
+	// throttled requests are refused with 429 and Retry-After before anything else
+	throttled  int
+	retryAfter string
+	// lostCreates are client creates that take effect but are answered with 502
+	lostCreates int
+}
+
+func (f *fakeRealm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.throttled > 0 {
+		f.throttled--
+		w.Header().Set("Retry-After", f.retryAfter)
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	if f.failures > 0 {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	const clientsPath = "/admin/realms/demo/clients"
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/realms/master/protocol/openid-connect/token":
+		if err := r.ParseForm(); err != nil || r.Form.Get("username") != "admin" || r.Form.Get("password") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.tokens++
+		_, _ = w.Write([]byte(`{"access_token":"` + f.token + `","expires_in":300}`))
+	case r.Header.Get("Authorization") != "Bearer "+f.token:
+		w.WriteHeader(http.StatusUnauthorized)
+	case r.Method == http.MethodGet && r.URL.Path == clientsPath:
+		// Keycloak's clientId filter is a search, so it may return more than the exact match
+		found := []*ClientRepresentation{}
+		for _, cl := range f.clients {
+			if strings.Contains(cl.ClientID, r.URL.Query().Get("clientId")) {
+				found = append(found, cl)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(found)
+	case r.Method == http.MethodPost && r.URL.Path == clientsPath:
+		var cl ClientRepresentation
+		Expect(json.NewDecoder(r.Body).Decode(&cl)).To(Succeed())
+		for _, existing := range f.clients {
+			if existing.ClientID == cl.ClientID {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+		}
+		f.nextID++
+		cl.ID = strconv.Itoa(f.nextID)
+		f.clients[cl.ID] = &cl
+		if f.lostCreates > 0 {
+			f.lostCreates--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Location", "http://"+r.Host+clientsPath+"/"+cl.ID)
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(r.URL.Path, clientsPath+"/"):
+		id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, clientsPath+"/"), "/")
+		cl, ok := f.clients[id]
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodDelete && sub == "":
+			delete(f.clients, id)
+			f.deleted = append(f.deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut && sub == "":
+			var update ClientRepresentation
+			Expect(json.NewDecoder(r.Body).Decode(&update)).To(Succeed())
+			// like Keycloak, only the fields present in the request change
+			if update.Description != "" {
+				cl.Description = update.Description
+			}
+			if update.RedirectURIs != nil {
+				cl.RedirectURIs = update.RedirectURIs
+			}
+			for k, v := range update.Attributes {
+				if cl.Attributes == nil {
+					cl.Attributes = map[string]string{}
+				}
+				cl.Attributes[k] = v
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && sub == "protocol-mappers/models":
+			var mapper ProtocolMapperRepresentation
+			Expect(json.NewDecoder(r.Body).Decode(&mapper)).To(Succeed())
+			cl.ProtocolMappers = append(cl.ProtocolMappers, mapper)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+var _ = Describe("Client", func() {
+	var (
+		realm  *fakeRealm
+		server *httptest.Server
+		kc     *Client
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		realm = &fakeRealm{
+			clients: map[string]*ClientRepresentation{
+				"1": {ID: "1", ClientID: "team1/agent"},
+				"2": {ID: "2", ClientID: "team1/agent-2"},
+			},
+			nextID: 2,
+			token:  "token",
+		}
+		server = httptest.NewServer(realm)
+		DeferCleanup(server.Close)
+		kc = NewClient(server.URL+"/", "demo", "admin", "secret")
+		kc.RetryBackoff = 0
+	})
+
+	It("deletes only the exact clientId match", func() {
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(Succeed())
+		Expect(realm.deleted).To(Equal([]string{"/admin/realms/demo/clients/1"}))
+	})
+
+	It("treats an unknown client as already deleted", func() {
+		Expect(kc.DeleteClient(ctx, "team2/other")).To(Succeed())
+		Expect(realm.deleted).To(BeEmpty())
+	})
+
+	It("fails with invalid admin credentials", func() {
+		kc.Password = "wrong"
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(MatchError(ContainSubstring("admin token")))
+	})
+
+	It("creates a client and reports an existing clientId as a conflict", func() {
+		id, err := kc.CreateClient(ctx, ClientRepresentation{
+			ClientID:               "team1/tool",
+			ServiceAccountsEnabled: ptr.To(true),
+			PublicClient:           ptr.To(false),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("3"))
+		Expect(*realm.clients["3"].PublicClient).To(BeFalse())
+
+		_, err = kc.CreateClient(ctx, ClientRepresentation{ClientID: "team1/tool"})
+		Expect(IsConflict(err)).To(BeTrue())
+	})
+
+	It("updates an existing client through EnsureClient", func() {
+		id, err := kc.EnsureClient(ctx, ClientRepresentation{ClientID: "team1/agent", Description: "Agent"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("1"))
+		Expect(realm.clients["1"].Description).To(Equal("Agent"))
+		Expect(realm.clients).To(HaveLen(2))
+	})
+
+	It("reports a missing client on update", func() {
+		err := kc.UpdateClient(ctx, ClientRepresentation{ClientID: "team2/other"})
+		Expect(err).To(MatchError(ErrClientNotFound))
+		Expect(IsNotFound(err)).To(BeTrue())
+	})
+
+	It("adds an audience mapper once", func() {
+		Expect(kc.AddAudienceMapper(ctx, "team1/agent", "auth-target")).To(Succeed())
+		Expect(kc.AddAudienceMapper(ctx, "team1/agent", "auth-target")).To(Succeed())
+
+		Expect(realm.clients["1"].ProtocolMappers).To(HaveLen(1))
+		mapper := realm.clients["1"].ProtocolMappers[0]
+		Expect(mapper.ProtocolMapper).To(Equal(AudienceMapperType))
+		Expect(mapper.Config).To(HaveKeyWithValue("included.custom.audience", "auth-target"))
+	})
+
+	It("enables token exchange without dropping other attributes", func() {
+		realm.clients["1"].Attributes = map[string]string{"kagenti.io/mcp-transport": "sse"}
+		Expect(kc.EnableTokenExchange(ctx, "team1/agent")).To(Succeed())
+		Expect(realm.clients["1"].Attributes).To(Equal(map[string]string{
+			"kagenti.io/mcp-transport": "sse",
+			TokenExchangeAttribute:     "true",
+		}))
+	})
+
+	It("retries transient failures", func() {
+		realm.failures = 2
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(Succeed())
+		Expect(realm.deleted).To(HaveLen(1))
+	})
+
+	It("gives up after MaxRetries", func() {
+		realm.failures = kc.MaxRetries + 1
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(MatchError(ContainSubstring("503")))
+	})
+
+	It("does not repeat a create that may have taken effect", func() {
+		realm.lostCreates = 1
+		_, err := kc.CreateClient(ctx, ClientRepresentation{ClientID: "team1/new"})
+		Expect(err).To(MatchError(ContainSubstring("502")))
+		Expect(err).NotTo(MatchError(ContainSubstring("409")))
+		Expect(realm.clients).To(HaveLen(3))
+	})
+
+	It("repeats a create the server refused with 429", func() {
+		// fetch the admin token first, so that the 429 answers the create
+		_, err := kc.GetClient(ctx, "team1/agent")
+		Expect(err).NotTo(HaveOccurred())
+		realm.throttled, realm.retryAfter = 1, "0"
+		id, err := kc.CreateClient(ctx, ClientRepresentation{ClientID: "team1/new"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(realm.clients).To(HaveKey(id))
+		Expect(realm.clients).To(HaveLen(3))
+	})
+
+	It("caps the delay asked for by Retry-After", func() {
+		kc.MaxRetryDelay = 10 * time.Millisecond
+		realm.throttled, realm.retryAfter = 2, "3600"
+		start := time.Now()
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	It("reuses the admin token and renews it when it is rejected", func() {
+		Expect(kc.DeleteClient(ctx, "team1/agent")).To(Succeed())
+		Expect(realm.tokens).To(Equal(1))
+
+		realm.token = "rotated"
+		Expect(kc.DeleteClient(ctx, "team1/agent-2")).To(Succeed())
+		Expect(realm.tokens).To(Equal(2))
+		Expect(realm.deleted).To(HaveLen(2))
+	})
+})
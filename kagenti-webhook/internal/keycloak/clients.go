@@ -0,0 +1,241 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+const (
+	// TokenExchangeAttribute enables standard token exchange (Keycloak 26+) for a client
+	TokenExchangeAttribute = "standard.token.exchange.enabled"
+
+	// AudienceMapperType is the protocol mapper that adds a custom audience to access tokens
+	AudienceMapperType = "oidc-audience-mapper"
+)
+
+// ErrClientNotFound is returned when no client has the requested clientId
+var ErrClientNotFound = errors.New("client not found")
+
+// ClientRepresentation is the subset of Keycloak's client representation kagenti manages.
+// Unset pointer fields are left unchanged by UpdateClient.
+type ClientRepresentation struct {
+	ID                        string                         `json:"id,omitempty"`
+	ClientID                  string                         `json:"clientId"`
+	Name                      string                         `json:"name,omitempty"`
+	Description               string                         `json:"description,omitempty"`
+	Enabled                   *bool                          `json:"enabled,omitempty"`
+	PublicClient              *bool                          `json:"publicClient,omitempty"`
+	ServiceAccountsEnabled    *bool                          `json:"serviceAccountsEnabled,omitempty"`
+	StandardFlowEnabled       *bool                          `json:"standardFlowEnabled,omitempty"`
+	DirectAccessGrantsEnabled *bool                          `json:"directAccessGrantsEnabled,omitempty"`
+	FullScopeAllowed          *bool                          `json:"fullScopeAllowed,omitempty"`
+	ClientAuthenticatorType   string                         `json:"clientAuthenticatorType,omitempty"`
+	Secret                    string                         `json:"secret,omitempty"`
+	RedirectURIs              []string                       `json:"redirectUris,omitempty"`
+	Attributes                map[string]string              `json:"attributes,omitempty"`
+	ProtocolMappers           []ProtocolMapperRepresentation `json:"protocolMappers,omitempty"`
+}
+
+// ProtocolMapperRepresentation is a protocol mapper of a client
+type ProtocolMapperRepresentation struct {
+	ID             string            `json:"id,omitempty"`
+	Name           string            `json:"name"`
+	Protocol       string            `json:"protocol"`
+	ProtocolMapper string            `json:"protocolMapper"`
+	Config         map[string]string `json:"config,omitempty"`
+}
+
+// AudienceMapper returns a mapper adding audience to access tokens, named as in client-registration
+func AudienceMapper(audience string) ProtocolMapperRepresentation {
+	name := "audience " + audience
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return ProtocolMapperRepresentation{
+		Name:           name,
+		Protocol:       "openid-connect",
+		ProtocolMapper: AudienceMapperType,
+		Config: map[string]string{
+			"included.custom.audience": audience,
+			"access.token.claim":       "true",
+			"id.token.claim":           "false",
+		},
+	}
+}
+
+// GetClient returns the client with the given clientId, or ErrClientNotFound
+func (c *Client) GetClient(ctx context.Context, clientID string) (*ClientRepresentation, error) {
+	clients, err := c.findClients(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("failed to get client %q: %w", clientID, ErrClientNotFound)
+	}
+	return &clients[0], nil
+}
+
+// CreateClient creates the client and returns its internal id. An existing clientId is
+// reported as a conflict (see IsConflict).
+func (c *Client) CreateClient(ctx context.Context, client ClientRepresentation) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, c.realmURL("/clients"), client)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client %q: %w", client.ClientID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated {
+		return "", statusError(fmt.Sprintf("create client %q", client.ClientID), resp)
+	}
+	// the new id is the last segment of the Location header
+	if location := resp.Header.Get("Location"); location != "" {
+		return path.Base(location), nil
+	}
+	created, err := c.GetClient(ctx, client.ClientID)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// UpdateClient updates the client; the internal id is looked up by clientId when unset
+func (c *Client) UpdateClient(ctx context.Context, client ClientRepresentation) error {
+	if client.ID == "" {
+		existing, err := c.GetClient(ctx, client.ClientID)
+		if err != nil {
+			return err
+		}
+		client.ID = existing.ID
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.realmURL("/clients/%s", url.PathEscape(client.ID)), client)
+	if err != nil {
+		return fmt.Errorf("failed to update client %q: %w", client.ClientID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(fmt.Sprintf("update client %q", client.ClientID), resp)
+	}
+	return nil
+}
+
+// EnsureClient creates the client, or updates it when the clientId already exists, and
+// returns its internal id
+func (c *Client) EnsureClient(ctx context.Context, client ClientRepresentation) (string, error) {
+	id, err := c.CreateClient(ctx, client)
+	if !IsConflict(err) {
+		return id, err
+	}
+	existing, err := c.GetClient(ctx, client.ClientID)
+	if err != nil {
+		return "", err
+	}
+	client.ID = existing.ID
+	return client.ID, c.UpdateClient(ctx, client)
+}
+
+// DeleteClient deletes the client with the given clientId; a missing client is not an error
+func (c *Client) DeleteClient(ctx context.Context, clientID string) error {
+	clients, err := c.findClients(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	for _, cl := range clients {
+		resp, err := c.do(ctx, http.MethodDelete, c.realmURL("/clients/%s", url.PathEscape(cl.ID)), nil)
+		if err != nil {
+			return fmt.Errorf("failed to delete client %q: %w", clientID, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("failed to delete client %q: unexpected status %s", clientID, resp.Status)
+		}
+	}
+	return nil
+}
+
+// AddAudienceMapper adds an audience mapper to the client unless one with the same name exists
+func (c *Client) AddAudienceMapper(ctx context.Context, clientID, audience string) error {
+	client, err := c.GetClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	mapper := AudienceMapper(audience)
+	for _, existing := range client.ProtocolMappers {
+		if existing.Name == mapper.Name {
+			return nil
+		}
+	}
+
+	endpoint := c.realmURL("/clients/%s/protocol-mappers/models", url.PathEscape(client.ID))
+	resp, err := c.do(ctx, http.MethodPost, endpoint, mapper)
+	if err != nil {
+		return fmt.Errorf("failed to add audience mapper to client %q: %w", clientID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// a concurrent writer may have added it in the meantime
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		return statusError(fmt.Sprintf("add audience mapper to client %q", clientID), resp)
+	}
+	return nil
+}
+
+// EnableTokenExchange permits the client to exchange tokens through standard token exchange
+func (c *Client) EnableTokenExchange(ctx context.Context, clientID string) error {
+	client, err := c.GetClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if client.Attributes[TokenExchangeAttribute] == "true" {
+		return nil
+	}
+	if client.Attributes == nil {
+		client.Attributes = map[string]string{}
+	}
+	client.Attributes[TokenExchangeAttribute] = "true"
+	// send the attributes only, so that fields this package does not model stay untouched
+	return c.UpdateClient(ctx, ClientRepresentation{ID: client.ID, ClientID: client.ClientID, Attributes: client.Attributes})
+}
+
+// findClients returns the clients whose clientId matches exactly
+func (c *Client) findClients(ctx context.Context, clientID string) ([]ClientRepresentation, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.realmURL("/clients?clientId=%s", url.QueryEscape(clientID)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up client %q: %w", clientID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(fmt.Sprintf("look up client %q", clientID), resp)
+	}
+
+	var clients []ClientRepresentation
+	if err := json.NewDecoder(resp.Body).Decode(&clients); err != nil {
+		return nil, fmt.Errorf("failed to decode clients: %w", err)
+	}
+	// clientId is a search parameter; keep exact matches only
+	matches := []ClientRepresentation{}
+	for _, cl := range clients {
+		if cl.ClientID == clientID {
+			matches = append(matches, cl)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ClientScopeRepresentation is a realm client scope
+type ClientScopeRepresentation struct {
+	ID              string                         `json:"id,omitempty"`
+	Name            string                         `json:"name"`
+	Protocol        string                         `json:"protocol,omitempty"`
+	Attributes      map[string]string              `json:"attributes,omitempty"`
+	ProtocolMappers []ProtocolMapperRepresentation `json:"protocolMappers,omitempty"`
+}
+
+// UserRepresentation is the subset of a Keycloak user needed to create demo and test users
+type UserRepresentation struct {
+	ID            string                     `json:"id,omitempty"`
+	Username      string                     `json:"username"`
+	Email         string                     `json:"email,omitempty"`
+	FirstName     string                     `json:"firstName,omitempty"`
+	LastName      string                     `json:"lastName,omitempty"`
+	Enabled       *bool                      `json:"enabled,omitempty"`
+	EmailVerified *bool                      `json:"emailVerified,omitempty"`
+	Credentials   []CredentialRepresentation `json:"credentials,omitempty"`
+}
+
+// CredentialRepresentation is a user credential
+type CredentialRepresentation struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+// AudienceScope returns an openid-connect client scope whose tokens carry audience, as
+// created by the AuthBridge setup scripts
+func AudienceScope(name, audience string) ClientScopeRepresentation {
+	mapper := AudienceMapper(audience)
+	mapper.Name = name
+	return ClientScopeRepresentation{
+		Name:     name,
+		Protocol: "openid-connect",
+		Attributes: map[string]string{
+			"include.in.token.scope":    "true",
+			"display.on.consent.screen": "true",
+		},
+		ProtocolMappers: []ProtocolMapperRepresentation{mapper},
+	}
+}
+
+// EnsureRealm creates the Client's realm unless it exists
+func (c *Client) EnsureRealm(ctx context.Context) error {
+	enabled := true
+	realm := struct {
+		Realm   string `json:"realm"`
+		Enabled *bool  `json:"enabled"`
+	}{Realm: c.Realm, Enabled: &enabled}
+	resp, err := c.do(ctx, http.MethodPost, c.BaseURL+"/admin/realms", realm)
+	if err != nil {
+		return fmt.Errorf("failed to create realm %q: %w", c.Realm, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		return statusError(fmt.Sprintf("create realm %q", c.Realm), resp)
+	}
+	return nil
+}
+
+// CheckRealm reads the public OpenID configuration of the realm at baseURL, which needs no
+// credentials. A realm that does not exist returns a StatusError IsNotFound reports.
+func CheckRealm(ctx context.Context, httpClient *http.Client, baseURL, realm string) error {
+	endpoint := fmt.Sprintf("%s/realms/%s/.well-known/openid-configuration",
+		strings.TrimSuffix(baseURL, "/"), url.PathEscape(realm))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to read realm %q: %w", realm, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(fmt.Sprintf("read realm %q", realm), resp)
+	}
+	return nil
+}
+
+// EnsureClientScope creates the client scope unless one with the same name exists, and
+// returns its id. Existing scopes are left unchanged.
+func (c *Client) EnsureClientScope(ctx context.Context, scope ClientScopeRepresentation) (string, error) {
+	if id, err := c.findClientScope(ctx, scope.Name); err != nil || id != "" {
+		return id, err
+	}
+	resp, err := c.do(ctx, http.MethodPost, c.realmURL("/client-scopes"), scope)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client scope %q: %w", scope.Name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated {
+		return "", statusError(fmt.Sprintf("create client scope %q", scope.Name), resp)
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return path.Base(location), nil
+	}
+	return c.findClientScope(ctx, scope.Name)
+}
+
+// AddRealmDefaultClientScope makes the scope a realm default, or a realm optional scope,
+// for clients created afterwards
+func (c *Client) AddRealmDefaultClientScope(ctx context.Context, scopeID string, optional bool) error {
+	kind := "default-default-client-scopes"
+	if optional {
+		kind = "default-optional-client-scopes"
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.realmURL("/%s/%s", kind, url.PathEscape(scopeID)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to add realm %s %q: %w", kind, scopeID, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(fmt.Sprintf("add realm %s %q", kind, scopeID), resp)
+	}
+	return nil
+}
+
+// EnsureUser creates the user unless the username is taken; existing users are left unchanged
+func (c *Client) EnsureUser(ctx context.Context, user UserRepresentation) error {
+	resp, err := c.do(ctx, http.MethodPost, c.realmURL("/users"), user)
+	if err != nil {
+		return fmt.Errorf("failed to create user %q: %w", user.Username, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusConflict {
+		return statusError(fmt.Sprintf("create user %q", user.Username), resp)
+	}
+	return nil
+}
+
+// findClientScope returns the id of the client scope with the given name, or ""
+func (c *Client) findClientScope(ctx context.Context, name string) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, c.realmURL("/client-scopes"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to list client scopes: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError("list client scopes", resp)
+	}
+	var scopes []ClientScopeRepresentation
+	if err := json.NewDecoder(resp.Body).Decode(&scopes); err != nil {
+		return "", fmt.Errorf("failed to decode client scopes: %w", err)
+	}
+	for _, scope := range scopes {
+		if scope.Name == name {
+			return scope.ID, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/utils/ptr"
+)
+
+// fakeAdmin records realm-level admin requests and serves the client scopes it was given
+type fakeAdmin struct {
+	mu       sync.Mutex
+	scopes   []ClientScopeRepresentation
+	requests []string
+	status   int
+}
+
+func (f *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.URL.Path == "/realms/master/protocol/openid-connect/token" {
+		_, _ = w.Write([]byte(`{"access_token":"token","expires_in":300}`))
+		return
+	}
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/admin/realms/demo/client-scopes":
+		_ = json.NewEncoder(w).Encode(f.scopes)
+	case r.Method == http.MethodPost && r.URL.Path == "/admin/realms/demo/client-scopes":
+		var scope ClientScopeRepresentation
+		Expect(json.NewDecoder(r.Body).Decode(&scope)).To(Succeed())
+		scope.ID = "scope-" + scope.Name
+		f.scopes = append(f.scopes, scope)
+		w.Header().Set("Location", "http://"+r.Host+r.URL.Path+"/"+scope.ID)
+		w.WriteHeader(http.StatusCreated)
+	case f.status != 0:
+		w.WriteHeader(f.status)
+	case r.Method == http.MethodPut:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+var _ = Describe("Realm setup", func() {
+	var (
+		admin *fakeAdmin
+		kc    *Client
+		ctx   context.Context
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		admin = &fakeAdmin{scopes: []ClientScopeRepresentation{{ID: "existing", Name: "auth-target-aud"}}}
+		server := httptest.NewServer(admin)
+		DeferCleanup(server.Close)
+		kc = NewClient(server.URL, "demo", "admin", "secret")
+		kc.RetryBackoff = 0
+	})
+
+	It("treats an existing realm or user as already created", func() {
+		admin.status = http.StatusConflict
+		Expect(kc.EnsureRealm(ctx)).To(Succeed())
+		Expect(kc.EnsureUser(ctx, UserRepresentation{Username: "alice", Enabled: ptr.To(true)})).To(Succeed())
+		Expect(admin.requests).To(Equal([]string{"POST /admin/realms", "POST /admin/realms/demo/users"}))
+	})
+
+	It("creates a missing client scope and reuses an existing one", func() {
+		id, err := kc.EnsureClientScope(ctx, AudienceScope("agent-team1-agent-aud", "team1/agent"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("scope-agent-team1-agent-aud"))
+		Expect(admin.scopes[1].ProtocolMappers).To(ConsistOf(HaveField("Config", HaveKeyWithValue("included.custom.audience", "team1/agent"))))
+
+		id, err = kc.EnsureClientScope(ctx, AudienceScope("auth-target-aud", "auth-target"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("existing"))
+		Expect(admin.scopes).To(HaveLen(2))
+	})
+
+	It("adds realm default and optional client scopes", func() {
+		Expect(kc.AddRealmDefaultClientScope(ctx, "a", false)).To(Succeed())
+		Expect(kc.AddRealmDefaultClientScope(ctx, "b", true)).To(Succeed())
+		Expect(admin.requests).To(Equal([]string{
+			"PUT /admin/realms/demo/default-default-client-scopes/a",
+			"PUT /admin/realms/demo/default-optional-client-scopes/b",
+		}))
+
+		admin.status = http.StatusNotFound
+		Expect(kc.AddRealmDefaultClientScope(ctx, "c", false)).To(MatchError(ContainSubstring("404")))
+	})
+})
@@ -0,0 +1,894 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package manager runs the webhook manager: the admission webhooks, the controllers and
+// the certificate management around them
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	// to ensure that exec-entrypoint and run can make use of them.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/certs"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/controller"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/version"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/audit"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/throttle"
+	webhooktoolhivestacklokdevv1alpha1 "github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/v1alpha1"
+	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	// +kubebuilder:scaffold:imports
+)
+
+var (
+	scheme   = runtime.NewScheme()
+	setupLog = ctrl.Log.WithName("setup")
+)
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+
+	utilruntime.Must(toolhivestacklokdevv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(agentsv1alpha1.AddToScheme(scheme))
+	// +kubebuilder:scaffold:scheme
+}
+
+// Webhooks selects the admission webhooks a manager serves
+type Webhooks string
+
+const (
+	// AllWebhooks serves the MCPServer, Agent and AuthBridge webhooks
+	AllWebhooks Webhooks = "all"
+	// ToolHiveWebhooks serves only the MCPServer webhook
+	ToolHiveWebhooks Webhooks = "toolhive"
+)
+
+// Run parses the manager flags from args and runs the manager until it receives a signal
+// nolint:gocyclo
+func Run(service string, args []string, webhooks Webhooks) {
+	var metricsAddr string
+	var metricsCertPath, metricsCertName, metricsCertKey string
+	var webhookCertPath, webhookCertName, webhookCertKey string
+	var enableLeaderElection bool
+	var leaderElectionNamespace string
+	var probeAddr string
+	var secureMetrics bool
+	var enableHTTP2 bool
+	var tlsOpts []func(*tls.Config)
+	var enableClientRegistration bool
+	var selfSignedCerts bool
+	var certNamespace, certSecretName, webhookServiceName string
+	var mutatingWebhookConfigs, validatingWebhookConfigs string
+	var manageWebhookConfig bool
+	var webhookConfigName, webhookFailurePolicy, webhookOperations, webhookCAInjectFrom string
+	proxyInitFlags := map[string]*string{}
+	var egressMode string
+	var envoyAdmin string
+	var configMapCheck string
+	var sidecarImagePullSecrets string
+	var excludedNamespaces string
+	var excludedNames string
+	var allowedSpiffeIDOverrides string
+	var istioExcludeOutboundPorts string
+	var idpProfilesFile string
+	var sidecarConfigFile string
+	var spireSocketCSIDriver, spireSocketHostPath string
+	var spiffeHelperHealthPort int
+	var spiffeTrustDomain string
+	var mcpServerSpireDefault bool
+	var mcpServerOIDCDefaults bool
+	var mcpServerAllowedRegistries, mcpServerPolicyAction string
+	var clientCredentialsSecret bool
+	var keycloakAdminSecret string
+	var credentialHygiene bool
+	var credentialRotation string
+	var enableClientDeregistration bool
+	var enableNamespaceConfig, enableNamespaceWebhook bool
+	var namespaceNetworkPoliciesFile string
+	var enableSpireEntries bool
+	var spireEntriesClassName string
+	var enableAuthConfigs bool
+	var enableWorkloadStatus bool
+	var enableNetworkPolicies bool
+	var enableEnvoyFilters bool
+	var enableGatewayPolicies bool
+	var gatewayExtProcService string
+	var configTemplateNamespace string
+	var driftCheckInterval time.Duration
+	var driftRepair bool
+	var sidecarAutoUpgrade bool
+	var enableAdmissionAudit bool
+	var admissionAuditFile string
+	var namespaceCache bool
+	var maxConcurrentAdmissions int
+	var admissionQueueTimeout time.Duration
+	fs := flag.NewFlagSet(service, flag.ExitOnError)
+	fs.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
+		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
+	fs.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	fs.BoolVar(&enableLeaderElection, "leader-elect", false,
+		"Enable leader election for controller manager. "+
+			"Enabling this will ensure there is only one active controller manager. "+
+			"Admission webhooks are served by every replica regardless of leadership.")
+	fs.StringVar(&leaderElectionNamespace, "leader-election-namespace", "",
+		"Namespace in which the leader election lease is created. Defaults to the namespace the manager runs in.")
+	fs.BoolVar(&secureMetrics, "metrics-secure", true,
+		"If set, the metrics endpoint is served securely via HTTPS. Use --metrics-secure=false to use HTTP instead.")
+	fs.StringVar(&webhookCertPath, "webhook-cert-path", "", "The directory that contains the webhook certificate.")
+	fs.StringVar(&webhookCertName, "webhook-cert-name", "tls.crt", "The name of the webhook certificate file.")
+	fs.StringVar(&webhookCertKey, "webhook-cert-key", "tls.key", "The name of the webhook key file.")
+	fs.StringVar(&metricsCertPath, "metrics-cert-path", "",
+		"The directory that contains the metrics server certificate.")
+	fs.StringVar(&metricsCertName, "metrics-cert-name", "tls.crt", "The name of the metrics server certificate file.")
+	fs.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
+	fs.BoolVar(&enableHTTP2, "enable-http2", false,
+		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	fs.BoolVar(&enableClientRegistration, "enable-client-registration", true,
+		"If set, Kagenti webhook will register tool clients in Keycloak")
+	fs.BoolVar(&selfSignedCerts, "self-signed-certs", false,
+		"If set, the webhook generates and rotates its own CA and serving certificate, stores them in a Secret "+
+			"and injects the caBundle into its webhook configurations. Removes the need for cert-manager.")
+	fs.StringVar(&certNamespace, "cert-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the webhook Service and certificate Secret. Defaults to $POD_NAMESPACE.")
+	fs.StringVar(&certSecretName, "cert-secret-name", "kagenti-webhook-self-signed-cert",
+		"Name of the Secret holding the self-managed CA and serving certificate.")
+	fs.StringVar(&webhookServiceName, "webhook-service-name", "kagenti-webhook-webhook-service",
+		"Name of the webhook Service; used for the serving certificate DNS names.")
+	fs.StringVar(&mutatingWebhookConfigs, "mutating-webhook-configurations", "",
+		"Comma-separated MutatingWebhookConfiguration names whose caBundle is managed with --self-signed-certs.")
+	fs.StringVar(&validatingWebhookConfigs, "validating-webhook-configurations", "",
+		"Comma-separated ValidatingWebhookConfiguration names whose caBundle is managed with --self-signed-certs.")
+	fs.BoolVar(&manageWebhookConfig, "manage-webhook-configuration", false,
+		"If set, the webhook creates or updates its MutatingWebhookConfiguration at startup so that rules, "+
+			"namespaceSelector and failurePolicy match the handlers.")
+	fs.StringVar(&webhookConfigName, "webhook-configuration-name", "kagenti-webhook-mutating-webhook-configuration",
+		"Name of the MutatingWebhookConfiguration managed with --manage-webhook-configuration.")
+	fs.StringVar(&webhookFailurePolicy, "webhook-failure-policy", string(admissionregistrationv1.Fail),
+		"failurePolicy (Fail or Ignore) of the webhooks managed with --manage-webhook-configuration.")
+	fs.StringVar(&webhookOperations, "webhook-operations", "CREATE,UPDATE",
+		"Operations (CREATE or CREATE,UPDATE) matched by the webhooks managed with --manage-webhook-configuration.")
+	fs.StringVar(&webhookCAInjectFrom, "webhook-ca-inject-from", "",
+		"cert-manager Certificate (namespace/name) whose CA is injected into the managed configuration.")
+	fs.StringVar(&configMapCheck, "configmap-check", string(injector.ConfigMapCheckWarn),
+		"What admission does when the environments, envoy-config or spiffe-helper-config ConfigMaps, or keys "+
+			"the sidecars need from them, are missing in the workload namespace: warn returns admission warnings, deny rejects the workload, "+
+			"off skips the lookup.")
+	fs.StringVar(&egressMode, "egress-mode", string(injector.EgressModeIPTables),
+		"Default egress mode: iptables injects proxy-init, proxy-env sets HTTP_PROXY/HTTPS_PROXY/NO_PROXY "+
+			"instead for clusters that forbid NET_ADMIN init containers, cni leaves redirection to the "+
+			"AuthBridge CNI plugin, istio leaves the traffic to the Istio sidecar (see --enable-envoyfilters). "+
+			"Workloads override it with the "+
+			injector.EgressModeAnnotation+" annotation.")
+	fs.StringVar(&envoyAdmin, "envoy-admin", string(injector.EnvoyAdminLocalhost),
+		"Where the injected Envoy serves its admin interface: localhost keeps 127.0.0.1, which the "+
+			"application containers can reach, uds moves it to a Unix socket inside the Envoy container, "+
+			"disabled removes it. Workloads override it with the "+injector.EnvoyAdminAnnotation+" annotation.")
+	fs.BoolVar(&clientCredentialsSecret, "client-credentials-secret", false,
+		"If set, client-registration stores the registered client in a Secret owned by the workload "+
+			"and envoy-proxy reads it from there. Workload service accounts need access to Secrets.")
+	fs.StringVar(&keycloakAdminSecret, "keycloak-admin-secret", "",
+		"Secret of each workload namespace that holds the Keycloak admin credentials under the "+
+			"KEYCLOAK_ADMIN_USERNAME and KEYCLOAK_ADMIN_PASSWORD keys. If empty, client-registration and "+
+			"client de-registration read them from the environments ConfigMap.")
+	fs.BoolVar(&credentialHygiene, "credential-hygiene", false,
+		"If set, a credential-hygiene sidecar keeps the credential files in the shared volumes at mode 0400, "+
+			"owned by the Envoy user, and scrubs them when the pod stops. Workloads override it with the "+
+			injector.CredentialHygieneAnnotation+" annotation.")
+	fs.StringVar(&credentialRotation, "credential-rotation", "0",
+		"How often the credential-hygiene sidecar re-registers the client with a new secret, e.g. 24h; 0 never "+
+			"rotates. Workloads override it with the "+injector.CredentialRotationAnnotation+" annotation.")
+	fs.BoolVar(&enableNamespaceConfig, "enable-namespace-config", false,
+		"If set, the leader copies the template ConfigMaps (labelled "+controller.ConfigTemplateLabel+
+			") into every namespace with injection enabled.")
+	fs.StringVar(&configTemplateNamespace, "config-template-namespace", os.Getenv("POD_NAMESPACE"),
+		"Namespace of the template ConfigMaps for --enable-namespace-config. Defaults to $POD_NAMESPACE.")
+	fs.BoolVar(&enableNamespaceWebhook, "enable-namespace-webhook", false,
+		"If set, a Namespace webhook marks namespaces labelled "+injector.DefaultNamespaceLabel+"=true as "+
+			"onboarding; --enable-namespace-config records the outcome in the "+
+			injector.NamespaceOnboardingAnnotation+" annotation. Requires --enable-namespace-config.")
+	fs.StringVar(&namespaceNetworkPoliciesFile, "namespace-network-policies-file", "",
+		"Path to a YAML file with a networkPolicies list that --enable-namespace-config creates in every "+
+			"namespace with injection enabled.")
+	fs.BoolVar(&enableSpireEntries, "enable-spire-entries", false,
+		"If set, the leader keeps a SPIRE Controller Manager ClusterSPIFFEID for every injected workload "+
+			"labelled "+injector.SpireEnableLabel+"="+injector.SpireEnabledValue+", so SPIRE registration entries "+
+			"need not be created by hand.")
+	fs.StringVar(&spireEntriesClassName, "spire-entries-class-name", "",
+		"className of the ClusterSPIFFEIDs created with --enable-spire-entries, for SPIRE Controller Managers "+
+			"that only serve their own class.")
+	fs.BoolVar(&enableAuthConfigs, "enable-authconfigs", false,
+		"If set, the leader keeps an Authorino AuthConfig for every injected workload that accepts JWTs of the "+
+			"workload's Keycloak realm with its client ID as audience. Requires the Authorino CRDs.")
+	fs.BoolVar(&enableWorkloadStatus, "enable-workload-status", false,
+		"If set, the leader keeps an AuthBridgeStatus for every injected workload that reports whether the SVIDs, "+
+			"client registrations and proxies of its pods are healthy. Requires the AuthBridgeStatus CRD.")
+	fs.BoolVar(&enableNetworkPolicies, "enable-networkpolicies", false,
+		"If set, the leader keeps a NetworkPolicy for every injected workload that limits its egress to DNS, "+
+			"the Keycloak service and the destinations of its "+controller.EgressUpstreamsAnnotation+" annotation.")
+	fs.BoolVar(&enableEnvoyFilters, "enable-envoyfilters", false,
+		"If set, the leader keeps an Istio EnvoyFilter for every injected workload in the "+
+			string(injector.EgressModeIstio)+" egress mode that adds the AuthBridge ext_proc to its Istio sidecar. "+
+			"Requires the Istio CRDs.")
+	fs.BoolVar(&enableGatewayPolicies, "enable-gateway-policies", false,
+		"If set, the leader keeps an Envoy Gateway EnvoyExtensionPolicy for every Gateway and HTTPRoute annotated "+
+			controller.GatewayExtProcAnnotation+", running the AuthBridge ext_proc at the gateway. "+
+			"Requires the Gateway API and Envoy Gateway CRDs.")
+	fs.StringVar(&gatewayExtProcService, "gateway-ext-proc-service", "",
+		"ext_proc Service (name[.namespace][:port]) for Gateways and HTTPRoutes annotated "+
+			controller.GatewayExtProcAnnotation+"=true.")
+	fs.BoolVar(&enableClientDeregistration, "enable-client-deregistration", false,
+		"If set, the Keycloak client of a workload is deleted when its client credentials Secret is "+
+			"garbage collected with the workload. Requires --client-credentials-secret.")
+	fs.DurationVar(&driftCheckInterval, "drift-check-interval", 0,
+		"If set, how often the leader lists AuthBridge workloads and reports (and with --drift-repair, "+
+			"re-injects) those whose injection is missing or stale. 0 disables the drift check.")
+	fs.BoolVar(&driftRepair, "drift-repair", false,
+		"If set, the drift check patches drifted workloads instead of only reporting them.")
+	fs.BoolVar(&sidecarAutoUpgrade, "sidecar-auto-upgrade", false,
+		"If set, the drift check re-injects stale workloads annotated with "+
+			controller.SidecarAutoUpgradeAnnotation+"=true, rolling their pods onto the current sidecars.")
+	fs.BoolVar(&enableAdmissionAudit, "enable-admission-audit", false,
+		"If set, every admission request is recorded with its UID, kind, namespace, decision, "+
+			"patch summary and duration.")
+	fs.StringVar(&admissionAuditFile, "admission-audit-file", "",
+		"File the admission audit records are appended to as JSON lines, including the full patches. "+
+			"Defaults to the admission-audit logger.")
+	fs.BoolVar(&namespaceCache, "namespace-cache", true,
+		"If set, admission reads namespaces from an informer cache instead of getting them from the API server "+
+			"for every request. The cache may lag a few hundred milliseconds behind namespace label changes.")
+	fs.IntVar(&maxConcurrentAdmissions, "max-concurrent-admissions", 0,
+		"Maximum number of admission requests handled at once across all webhooks; further requests wait "+
+			"up to --admission-queue-timeout and are then rejected with 429. 0 means no limit.")
+	fs.DurationVar(&admissionQueueTimeout, "admission-queue-timeout", 5*time.Second,
+		"How long an admission request waits for a slot under --max-concurrent-admissions. Keep it below "+
+			"the webhook timeoutSeconds (10s), so that the API server gets an answer instead of a timeout.")
+	fs.StringVar(&excludedNamespaces, "excluded-namespaces", strings.Join(injector.DefaultExcludedNamespaces, ","),
+		"Comma-separated namespaces that are never injected, whatever their labels say. "+
+			"The namespace in --cert-namespace (the webhook's own) is always excluded as well.")
+	fs.StringVar(&excludedNames, "excluded-names", "",
+		"Comma-separated regular expressions of workload names that are never injected, whatever their "+
+			"labels say, e.g. ^kagenti-,^istio- to protect platform components.")
+	fs.StringVar(&allowedSpiffeIDOverrides, "allowed-spiffe-id-overrides", "",
+		"Comma-separated regular expressions of the "+injector.SpiffeIDAnnotation+" values workloads may set "+
+			"outside their own namespace and service account, e.g. ^spiffe://example\\.org/agents/. "+
+			"Other overrides are rejected at admission.")
+	fs.StringVar(&istioExcludeOutboundPorts, "istio-exclude-outbound-ports", "",
+		"Comma-separated ports added to "+injector.IstioExcludeOutboundPortsAnnotation+" of workloads with an "+
+			"Istio sidecar, in addition to the Keycloak port, e.g. a SPIRE server reached over TCP.")
+	fs.StringVar(&idpProfilesFile, "idp-profiles-file", "",
+		"YAML file with the identity provider profiles workloads select with the "+injector.IDPProfileLabel+
+			" label. Each profile sets the Keycloak URL and realm and optionally the token URL, audience and scopes.")
+	fs.StringVar(&sidecarConfigFile, "sidecar-config-file", "",
+		"YAML file overriding the images, pull policy and resources of the injected containers, with "+
+			"optional resource profiles workloads select with the "+injector.SidecarResourcesAnnotation+" annotation.")
+	fs.StringVar(&spireSocketCSIDriver, "spire-socket-csi-driver", injector.DefaultSpireCSIDriver,
+		"CSI driver that provides the SPIRE Workload API socket volume to SPIRE-enabled workloads.")
+	fs.StringVar(&spireSocketHostPath, "spire-socket-host-path", "",
+		"If set, the SPIRE Workload API socket directory is mounted from this node path instead of the CSI driver.")
+	fs.IntVar(&spiffeHelperHealthPort, "spiffe-helper-health-port", 0,
+		"If set, spiffe-helper gets startup, readiness and liveness probes against its health_checks "+
+			"listener on this port. helper.conf must enable the listener on the same port.")
+	fs.StringVar(&spiffeTrustDomain, "spiffe-trust-domain", "",
+		"SPIRE trust domain. If set, the MCPServer validator checks the full SPIFFE ID against the Keycloak client ID length.")
+	fs.BoolVar(&mcpServerSpireDefault, "mcpserver-spire-default", true,
+		"Inject spiffe-helper into MCPServers without the "+injector.SpireEnableLabel+" label. Disable on clusters "+
+			"without SPIRE; client registration then uses the static <namespace>/<name> client ID.")
+	fs.BoolVar(&mcpServerOIDCDefaults, "mcpserver-oidc-defaults", true,
+		"Give injected MCPServers without spec.oidcConfig an inline OIDC configuration for the Keycloak realm "+
+			"in the namespace's environments ConfigMap, with the registered client ID as audience.")
+	fs.StringVar(&mcpServerAllowedRegistries, "mcpserver-allowed-registries", "",
+		"Comma-separated registries, optionally with a path (ghcr.io/kagenti), MCPServer images must come from. "+
+			"Empty allows every registry.")
+	fs.StringVar(&mcpServerPolicyAction, "mcpserver-policy-action", string(webhooktoolhivestacklokdevv1alpha1.PolicyActionWarn),
+		"What admission does with MCPServers outside the allowed registries or the namespace resource ceilings "+
+			"("+webhooktoolhivestacklokdevv1alpha1.MCPServerMaxCPUAnnotation+", "+
+			webhooktoolhivestacklokdevv1alpha1.MCPServerMaxMemoryAnnotation+"): warn or deny.")
+	fs.StringVar(&sidecarImagePullSecrets, "sidecar-image-pull-secrets", "",
+		"Comma-separated imagePullSecrets added to mutated pods that do not reference them yet, "+
+			"for sidecar images in a private registry. The secrets must exist in the workload namespace.")
+	for _, f := range []struct{ name, annotation, usage string }{
+		{"proxy-init-outbound-capture-port", injector.OutboundCapturePortAnnotation,
+			"Default Envoy port outbound traffic is redirected to."},
+		{"proxy-init-inbound-capture-port", injector.InboundCapturePortAnnotation,
+			"Default Envoy port captured inbound traffic is redirected to."},
+		{"proxy-init-include-inbound-ports", injector.IncludeInboundPortsAnnotation,
+			"Default comma-separated inbound ports to capture (\"*\" for all). Empty disables inbound capture."},
+		{"proxy-init-exclude-outbound-ports", injector.ExcludeOutboundPortsAnnotation,
+			"Comma-separated destination ports that are never redirected, in addition to Keycloak's 8080."},
+		{"proxy-init-exclude-outbound-cidrs", injector.ExcludeOutboundCIDRsAnnotation,
+			"Comma-separated destination CIDRs that are never redirected."},
+		{"proxy-init-exclude-uids", injector.ExcludeUIDsAnnotation,
+			"Comma-separated process UIDs whose outbound traffic is never redirected."},
+		{"proxy-init-interception-mode", injector.InterceptionModeAnnotation,
+			"Default inbound interception mode, REDIRECT or TPROXY."},
+		{"proxy-init-ip-families", injector.IPFamiliesAnnotation,
+			"Default IP families proxy-init configures: auto (detect in the pod), ipv4, ipv6 or dual."},
+	} {
+		proxyInitFlags[f.annotation] = fs.String(f.name, "", f.usage+" Workloads override it with the "+f.annotation+" annotation.")
+	}
+
+	buildInfo := version.Get()
+	obsOpts := obs.Options{Service: service, Version: buildInfo.Version}
+	obsOpts.BindFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx := ctrl.SetupSignalHandler()
+	shutdownTracing, err := obs.Setup(ctx, obsOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up telemetry")
+		os.Exit(1)
+	}
+
+	setupLog.Info("Starting "+service, "webhooks", webhooks, "version", buildInfo.Version, "commit", buildInfo.Commit,
+		"buildDate", buildInfo.BuildDate, "goVersion", buildInfo.GoVersion)
+
+	// if the enable-http2 flag is false (the default), http/2 should be disabled
+	// due to its vulnerabilities. More specifically, disabling http/2 will
+	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
+	// Rapid Reset CVEs. For more information see:
+	// - https://github.com/advisories/GHSA-qppj-fm5r-hxr3
+	// - https://github.com/advisories/GHSA-4374-p667-p6c8
+	disableHTTP2 := func(c *tls.Config) {
+		setupLog.Info("disabling http/2")
+		c.NextProtos = []string{"http/1.1"}
+	}
+
+	if !enableHTTP2 {
+		tlsOpts = append(tlsOpts, disableHTTP2)
+	}
+
+	// Create watchers for metrics and webhooks certificates
+	var metricsCertWatcher, webhookCertWatcher *certwatcher.CertWatcher
+
+	// Initial webhook TLS options
+	webhookTLSOpts := tlsOpts
+
+	// Register the webhooks before bootstrapping certificates, so the caBundle lands on the managed configuration
+	if manageWebhookConfig {
+		if certNamespace == "" {
+			setupLog.Error(nil, "--cert-namespace (or $POD_NAMESPACE) is required with --manage-webhook-configuration")
+			os.Exit(1)
+		}
+		failurePolicy := admissionregistrationv1.FailurePolicyType(webhookFailurePolicy)
+		if failurePolicy != admissionregistrationv1.Fail && failurePolicy != admissionregistrationv1.Ignore {
+			setupLog.Error(nil, "--webhook-failure-policy must be Fail or Ignore", "value", webhookFailurePolicy)
+			os.Exit(1)
+		}
+		operations, err := registration.ParseOperations(webhookOperations)
+		if err != nil {
+			setupLog.Error(err, "invalid --webhook-operations")
+			os.Exit(1)
+		}
+
+		registrationClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client for webhook registration")
+			os.Exit(1)
+		}
+		registrar := registration.NewRegistrar(registrationClient, registration.Options{
+			Name:             webhookConfigName,
+			ServiceName:      webhookServiceName,
+			ServiceNamespace: certNamespace,
+			FailurePolicy:    failurePolicy,
+			Operations:       operations,
+			CAInjectFrom:     webhookCAInjectFrom,
+			NamespaceWebhook: enableNamespaceWebhook,
+		})
+		setupLog.Info("Registering webhook configuration", "name", webhookConfigName,
+			"failurePolicy", failurePolicy, "operations", operations)
+		if err := registrar.Ensure(context.Background()); err != nil {
+			setupLog.Error(err, "Failed to register webhook configuration")
+			os.Exit(1)
+		}
+	}
+
+	// Generate (or load) the self-managed serving certificate before the cert watcher reads it
+	var certBootstrapper *certs.Bootstrapper
+	if selfSignedCerts {
+		if certNamespace == "" {
+			setupLog.Error(nil, "--cert-namespace (or $POD_NAMESPACE) is required with --self-signed-certs")
+			os.Exit(1)
+		}
+		if len(webhookCertPath) == 0 {
+			webhookCertPath = filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs")
+		}
+
+		bootstrapClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client for certificate bootstrap")
+			os.Exit(1)
+		}
+		certBootstrapper = certs.NewBootstrapper(bootstrapClient, certs.Options{
+			Namespace:                       certNamespace,
+			SecretName:                      certSecretName,
+			ServiceName:                     webhookServiceName,
+			CertDir:                         webhookCertPath,
+			CertName:                        webhookCertName,
+			KeyName:                         webhookCertKey,
+			MutatingWebhookConfigurations:   splitList(mutatingWebhookConfigs),
+			ValidatingWebhookConfigurations: splitList(validatingWebhookConfigs),
+		})
+		setupLog.Info("Bootstrapping self-managed webhook certificates",
+			"namespace", certNamespace, "secret", certSecretName, "dnsNames", certBootstrapper.DNSNames())
+		if err := certBootstrapper.Ensure(context.Background()); err != nil {
+			setupLog.Error(err, "Failed to bootstrap webhook certificates")
+			os.Exit(1)
+		}
+	}
+
+	if len(webhookCertPath) > 0 {
+		setupLog.Info("Initializing webhook certificate watcher using provided certificates",
+			"webhook-cert-path", webhookCertPath, "webhook-cert-name", webhookCertName, "webhook-cert-key", webhookCertKey)
+
+		var err error
+		webhookCertWatcher, err = certwatcher.New(
+			filepath.Join(webhookCertPath, webhookCertName),
+			filepath.Join(webhookCertPath, webhookCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize webhook certificate watcher")
+			os.Exit(1)
+		}
+
+		webhookTLSOpts = append(webhookTLSOpts, func(config *tls.Config) {
+			config.GetCertificate = webhookCertWatcher.GetCertificate
+		})
+	}
+
+	// Every handler runs in a server span, which includes the auditing below
+	webhookServer := obs.TraceServer(webhook.NewServer(webhook.Options{
+		TLSOpts: webhookTLSOpts,
+	}))
+	webhookServer.Register(version.Path, obs.RequestIDMiddleware(version.Handler()))
+	var auditor *audit.Auditor
+	if enableAdmissionAudit {
+		var err error
+		if auditor, err = audit.NewAuditor(admissionAuditFile); err != nil {
+			setupLog.Error(err, "invalid --admission-audit-file")
+			os.Exit(1)
+		}
+		setupLog.Info("Auditing admission requests", "file", admissionAuditFile)
+		webhookServer = auditor.Server(webhookServer)
+	}
+	// Registered after the auditor, so that rejected requests are audited as well
+	if maxConcurrentAdmissions > 0 {
+		setupLog.Info("Limiting concurrent admission requests", "limit", maxConcurrentAdmissions,
+			"queueTimeout", admissionQueueTimeout)
+		webhookServer = throttle.NewLimiter(maxConcurrentAdmissions, admissionQueueTimeout).Server(webhookServer)
+	}
+
+	// Metrics endpoint is enabled in 'config/default/kustomization.yaml'. The Metrics options configure the server.
+	// More info:
+	// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.0/pkg/metrics/server
+	// - https://book.kubebuilder.io/reference/metrics.html
+	metricsServerOptions := metricsserver.Options{
+		BindAddress:   metricsAddr,
+		SecureServing: secureMetrics,
+		TLSOpts:       tlsOpts,
+	}
+
+	if secureMetrics {
+		// FilterProvider is used to protect the metrics endpoint with authn/authz.
+		// These configurations ensure that only authorized users and service accounts
+		// can access the metrics endpoint. The RBAC are configured in 'config/rbac/kustomization.yaml'. More info:
+		// https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.20.0/pkg/metrics/filters#WithAuthenticationAndAuthorization
+		metricsServerOptions.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
+	// If the certificate is not specified, controller-runtime will automatically
+	// generate self-signed certificates for the metrics server. While convenient for development and testing,
+	// this setup is not recommended for production.
+	//
+	// TODO(user): If you enable certManager, uncomment the following lines:
+	// - [METRICS-WITH-CERTS] at config/default/kustomization.yaml to generate and use certificates
+	// managed by cert-manager for the metrics server.
+	// - [PROMETHEUS-WITH-CERTS] at config/prometheus/kustomization.yaml for TLS certification.
+	if len(metricsCertPath) > 0 {
+		setupLog.Info("Initializing metrics certificate watcher using provided certificates",
+			"metrics-cert-path", metricsCertPath, "metrics-cert-name", metricsCertName, "metrics-cert-key", metricsCertKey)
+
+		var err error
+		metricsCertWatcher, err = certwatcher.New(
+			filepath.Join(metricsCertPath, metricsCertName),
+			filepath.Join(metricsCertPath, metricsCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "to initialize metrics certificate watcher", "error", err)
+			os.Exit(1)
+		}
+
+		metricsServerOptions.TLSOpts = append(metricsServerOptions.TLSOpts, func(config *tls.Config) {
+			config.GetCertificate = metricsCertWatcher.GetCertificate
+		})
+	}
+
+	// Only the client credentials Secrets and the ConfigMap templates and their copies are
+	// watched, so keep other Secrets and ConfigMaps out of the cache
+	configTemplateSelector, err := labels.Parse(controller.ConfigTemplateLabel)
+	if err != nil {
+		setupLog.Error(err, "invalid ConfigMap template selector")
+		os.Exit(1)
+	}
+	cacheOptions := cache.Options{ByObject: map[client.Object]cache.ByObject{
+		&corev1.Secret{}:    {Label: labels.SelectorFromSet(labels.Set{injector.ClientCredentialsLabel: "true"})},
+		&corev1.ConfigMap{}: {Label: configTemplateSelector},
+		// only the workload status controller reads pods from the cache
+		&corev1.Pod{}: {Label: labels.SelectorFromSet(labels.Set{injector.AuthBridgeLabel: injector.AuthBridgeLabelInjected})},
+	}}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		Scheme:                  scheme,
+		Cache:                   cacheOptions,
+		Metrics:                 metricsServerOptions,
+		WebhookServer:           webhookServer,
+		HealthProbeBindAddress:  probeAddr,
+		LeaderElection:          enableLeaderElection,
+		LeaderElectionID:        "217dbcff.kagenti.ai",
+		LeaderElectionNamespace: leaderElectionNamespace,
+		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
+		// when the Manager ends. This requires the binary to immediately end when the
+		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
+		// speeds up voluntary leader transitions as the new leader don't have to wait
+		// LeaseDuration time first.
+		//
+		// main() exits as soon as the manager stops and performs no cleanup afterwards,
+		// so releasing the lease on cancel is safe and shortens failover during rollouts.
+		LeaderElectionReleaseOnCancel: true,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
+	// Create Kubernetes client for namespace checking
+	k8sClient, err := client.New(mgr.GetConfig(), client.Options{
+		Scheme: mgr.GetScheme(),
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes client")
+		os.Exit(1)
+	}
+
+	// Create shared pod mutator for both webhooks
+	podMutator := injector.NewPodMutator(k8sClient, enableClientRegistration)
+	if namespaceCache {
+		// Registering the informer now lets it sync with the cache, before the first admission
+		if _, err := mgr.GetCache().GetInformer(context.Background(), &corev1.Namespace{}); err != nil {
+			setupLog.Error(err, "unable to create the namespace informer")
+			os.Exit(1)
+		}
+		podMutator.NamespaceReader = mgr.GetCache()
+	}
+
+	// Manager-level proxy-init defaults use the same syntax as the workload annotations
+	proxyInitDefaults := map[string]string{}
+	for annotation, value := range proxyInitFlags {
+		if *value != "" {
+			proxyInitDefaults[annotation] = *value
+		}
+	}
+	podMutator.ProxyInitDefaults, err = injector.ProxyInitConfigFromAnnotations(
+		injector.DefaultProxyInitConfig(), proxyInitDefaults, &corev1.PodSpec{})
+	if err != nil {
+		setupLog.Error(err, "invalid proxy-init defaults")
+		os.Exit(1)
+	}
+	if podMutator.EgressMode, err = injector.ParseEgressMode(egressMode); err != nil {
+		setupLog.Error(err, "invalid --egress-mode")
+		os.Exit(1)
+	}
+	if podMutator.EnvoyAdmin, err = injector.ParseEnvoyAdminMode(envoyAdmin); err != nil {
+		setupLog.Error(err, "invalid --envoy-admin")
+		os.Exit(1)
+	}
+	if podMutator.ConfigMapCheck, err = injector.ParseConfigMapCheckMode(configMapCheck); err != nil {
+		setupLog.Error(err, "invalid --configmap-check")
+		os.Exit(1)
+	}
+	podMutator.ExcludedNamespaces = splitList(excludedNamespaces)
+	if certNamespace != "" && !podMutator.IsNamespaceExcluded(certNamespace) {
+		podMutator.ExcludedNamespaces = append(podMutator.ExcludedNamespaces, certNamespace)
+	}
+	setupLog.Info("Namespaces excluded from injection", "namespaces", podMutator.ExcludedNamespaces)
+	if podMutator.ExcludedNames, err = injector.ParseNamePatterns(splitList(excludedNames)); err != nil {
+		setupLog.Error(err, "invalid --excluded-names")
+		os.Exit(1)
+	}
+	if len(podMutator.ExcludedNames) > 0 {
+		setupLog.Info("Workload names excluded from injection", "patterns", excludedNames)
+	}
+	if podMutator.AllowedSpiffeIDOverrides, err = injector.ParseNamePatterns(splitList(allowedSpiffeIDOverrides)); err != nil {
+		setupLog.Error(err, "invalid --allowed-spiffe-id-overrides")
+		os.Exit(1)
+	}
+	if podMutator.IstioExcludeOutboundPorts, err = injector.ParsePorts(splitList(istioExcludeOutboundPorts)); err != nil {
+		setupLog.Error(err, "invalid --istio-exclude-outbound-ports")
+		os.Exit(1)
+	}
+	if idpProfilesFile != "" {
+		if podMutator.IDPProfiles, err = injector.LoadIDPProfiles(idpProfilesFile); err != nil {
+			setupLog.Error(err, "invalid --idp-profiles-file")
+			os.Exit(1)
+		}
+		setupLog.Info("Loaded IdP profiles", "count", len(podMutator.IDPProfiles))
+	}
+	if sidecarConfigFile != "" {
+		if podMutator.SidecarConfig, err = injector.LoadSidecarConfig(sidecarConfigFile); err != nil {
+			setupLog.Error(err, "invalid --sidecar-config-file")
+			os.Exit(1)
+		}
+		setupLog.Info("Loaded sidecar configuration", "images", podMutator.SidecarConfig.Images,
+			"resourceProfiles", len(podMutator.SidecarConfig.ResourceProfiles))
+	}
+	podMutator.SpireSocket = injector.SpireSocketSource{CSIDriver: spireSocketCSIDriver, HostPath: spireSocketHostPath}
+	if err := podMutator.SpireSocket.Validate(); err != nil {
+		setupLog.Error(err, "invalid SPIRE socket volume flags")
+		os.Exit(1)
+	}
+	if spiffeHelperHealthPort < 0 || spiffeHelperHealthPort > 65535 {
+		setupLog.Error(nil, "--spiffe-helper-health-port must be a port number", "value", spiffeHelperHealthPort)
+		os.Exit(1)
+	}
+	podMutator.SpiffeHelperHealthPort = int32(spiffeHelperHealthPort)
+	if err := injector.ValidateTrustDomain(spiffeTrustDomain); err != nil {
+		setupLog.Error(err, "invalid --spiffe-trust-domain")
+		os.Exit(1)
+	}
+	podMutator.SpiffeTrustDomain = spiffeTrustDomain
+	podMutator.MCPServerSpireDefault = mcpServerSpireDefault
+	podMutator.MCPServerOIDCDefaults = mcpServerOIDCDefaults
+	mcpServerPolicy := webhooktoolhivestacklokdevv1alpha1.MCPServerPolicy{
+		AllowedRegistries: splitList(mcpServerAllowedRegistries),
+	}
+	if mcpServerPolicy.Action, err = webhooktoolhivestacklokdevv1alpha1.ParsePolicyAction(mcpServerPolicyAction); err != nil {
+		setupLog.Error(err, "invalid --mcpserver-policy-action")
+		os.Exit(1)
+	}
+	podMutator.ImagePullSecrets = splitList(sidecarImagePullSecrets)
+	podMutator.ClientCredentialsSecret = clientCredentialsSecret
+	podMutator.KeycloakAdminSecret = keycloakAdminSecret
+	podMutator.CredentialHygiene.Enabled = credentialHygiene
+	if podMutator.CredentialHygiene.Rotation, err = injector.ParseCredentialRotation(credentialRotation); err != nil {
+		setupLog.Error(err, "invalid --credential-rotation")
+		os.Exit(1)
+	}
+	if podMutator.CredentialHygiene.Rotation > 0 && !credentialHygiene {
+		setupLog.Error(nil, "--credential-rotation requires --credential-hygiene")
+		os.Exit(1)
+	}
+	if enableClientDeregistration {
+		if !clientCredentialsSecret {
+			setupLog.Error(nil, "--enable-client-deregistration requires --client-credentials-secret")
+			os.Exit(1)
+		}
+		podMutator.ClientDeregistration = true
+		deregistration := controller.NewClientDeregistrationReconciler(mgr.GetClient(), mgr.GetAPIReader())
+		deregistration.AdminSecret = keycloakAdminSecret
+		if err = deregistration.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "client-deregistration")
+			os.Exit(1)
+		}
+	}
+
+	if enableNamespaceConfig {
+		if configTemplateNamespace == "" {
+			setupLog.Error(nil, "--config-template-namespace (or $POD_NAMESPACE) is required with --enable-namespace-config")
+			os.Exit(1)
+		}
+		namespaceConfig := controller.NewNamespaceConfigReconciler(mgr.GetClient(), mgr.GetAPIReader(), configTemplateNamespace)
+		if namespaceNetworkPoliciesFile != "" {
+			if namespaceConfig.NetworkPolicies, err = controller.LoadNamespaceNetworkPolicies(namespaceNetworkPoliciesFile); err != nil {
+				setupLog.Error(err, "invalid --namespace-network-policies-file")
+				os.Exit(1)
+			}
+		}
+		if err = namespaceConfig.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "namespace-config")
+			os.Exit(1)
+		}
+	} else if enableNamespaceWebhook || namespaceNetworkPoliciesFile != "" {
+		setupLog.Error(nil, "--enable-namespace-webhook and --namespace-network-policies-file require --enable-namespace-config")
+		os.Exit(1)
+	}
+
+	if enableSpireEntries {
+		spireEntries := controller.NewSpireEntryReconciler(mgr.GetClient(), podMutator)
+		spireEntries.ClassName = spireEntriesClassName
+		if err = spireEntries.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "spire-entries")
+			os.Exit(1)
+		}
+	}
+
+	if enableAuthConfigs {
+		if err = controller.NewAuthConfigReconciler(mgr.GetClient(), mgr.GetAPIReader(), podMutator).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "authconfigs")
+			os.Exit(1)
+		}
+	}
+
+	if enableWorkloadStatus {
+		if err = controller.NewWorkloadStatusReconciler(mgr.GetClient()).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "workload-status")
+			os.Exit(1)
+		}
+	}
+
+	if enableNetworkPolicies {
+		if err = controller.NewNetworkPolicyReconciler(mgr.GetClient(), mgr.GetAPIReader(), podMutator).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "networkpolicies")
+			os.Exit(1)
+		}
+	}
+
+	if enableEnvoyFilters {
+		if err = controller.NewEnvoyFilterReconciler(mgr.GetClient(), podMutator).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "envoyfilters")
+			os.Exit(1)
+		}
+	} else if podMutator.EgressMode == injector.EgressModeIstio {
+		setupLog.Error(nil, "--egress-mode="+string(injector.EgressModeIstio)+" requires --enable-envoyfilters")
+		os.Exit(1)
+	}
+
+	if enableGatewayPolicies {
+		gatewayPolicies := controller.NewGatewayPolicyReconciler(mgr.GetClient(), gatewayExtProcService)
+		if err = gatewayPolicies.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "gateway-policies")
+			os.Exit(1)
+		}
+	}
+
+	if sidecarAutoUpgrade && driftCheckInterval == 0 {
+		setupLog.Error(nil, "--sidecar-auto-upgrade requires --drift-check-interval")
+		os.Exit(1)
+	}
+	if driftCheckInterval > 0 {
+		setupLog.Info("Enabling injection drift check", "interval", driftCheckInterval, "repair", driftRepair,
+			"sidecarAutoUpgrade", sidecarAutoUpgrade)
+		driftDetector := controller.NewDriftDetector(k8sClient, podMutator, controller.DriftOptions{
+			Interval:    driftCheckInterval,
+			Repair:      driftRepair,
+			AutoUpgrade: sidecarAutoUpgrade,
+		})
+		if err := mgr.Add(driftDetector); err != nil {
+			setupLog.Error(err, "unable to add injection drift check to manager")
+			os.Exit(1)
+		}
+	}
+
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		// Setup MCPServer webhook
+		if err = webhooktoolhivestacklokdevv1alpha1.SetupMCPServerWebhookWithManager(mgr, podMutator, mcpServerPolicy); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "MCPServer")
+			os.Exit(1)
+		}
+
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" && webhooks != ToolHiveWebhooks {
+		// Setup Agent webhook
+		if err = webhooktoolhivestacklokdevv1alpha1.SetupAgentWebhookWithManager(mgr, podMutator); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Agent")
+			os.Exit(1)
+		}
+
+		// Setup AuthBridge webhook
+		if err = webhooktoolhivestacklokdevv1alpha1.SetupAuthBridgeWebhookWithManager(mgr, podMutator); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "AuthBridge")
+			os.Exit(1)
+		}
+
+		if enableNamespaceWebhook {
+			if err = webhooktoolhivestacklokdevv1alpha1.SetupNamespaceWebhookWithManager(mgr, podMutator); err != nil {
+				setupLog.Error(err, "unable to create webhook", "webhook", "Namespace")
+				os.Exit(1)
+			}
+		}
+	}
+	// +kubebuilder:scaffold:builder
+
+	if metricsCertWatcher != nil {
+		setupLog.Info("Adding metrics certificate watcher to manager")
+		if err := mgr.Add(metricsCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add metrics certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	if webhookCertWatcher != nil {
+		setupLog.Info("Adding webhook certificate watcher to manager")
+		if err := mgr.Add(webhookCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add webhook certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	if certBootstrapper != nil {
+		setupLog.Info("Adding webhook certificate rotation to manager")
+		if err := mgr.Add(certBootstrapper); err != nil {
+			setupLog.Error(err, "unable to add webhook certificate rotation to manager")
+			os.Exit(1)
+		}
+	}
+
+	if auditor != nil {
+		// Flushes and closes the audit file when the manager stops
+		if err := mgr.Add(auditor); err != nil {
+			setupLog.Error(err, "unable to add admission audit to manager")
+			os.Exit(1)
+		}
+	}
+
+	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check")
+		os.Exit(1)
+	}
+	// Only report ready once the webhook server is accepting connections, so the
+	// Service never routes admission requests to a replica that cannot serve them.
+	if err := mgr.AddReadyzCheck("readyz", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		setupLog.Error(err, "unable to set up ready check")
+		os.Exit(1)
+	}
+
+	setupLog.Info("starting manager")
+	err = mgr.Start(ctx)
+	// flush pending spans; the signal context is already done at this point
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		setupLog.Error(shutdownErr, "unable to flush traces")
+	}
+	if err != nil {
+		setupLog.Error(err, "problem running manager")
+		os.Exit(1)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
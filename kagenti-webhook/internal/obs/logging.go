@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package obs
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/go-logr/logr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// NewLogger returns a logger writing opts.LogFormat at opts.LogLevel to w, with the
+// service attribute on every record
+func NewLogger(w io.Writer, opts Options) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.LogLevel)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", opts.LogLevel)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.LogFormat) {
+	case "", LogFormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case LogFormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: must be %s or %s", opts.LogFormat, LogFormatText, LogFormatJSON)
+	}
+	logger := slog.New(handler)
+	if opts.Service != "" {
+		logger = logger.With("service", opts.Service)
+	}
+	return logger, nil
+}
+
+// SetupLogging makes the logger from NewLogger the default of slog, the log package and
+// controller-runtime. logr verbosity V(n) maps to slog level -n, so V(1) shows at debug.
+func SetupLogging(w io.Writer, opts Options) (*slog.Logger, error) {
+	logger, err := NewLogger(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	ctrl.SetLogger(logr.FromSlogHandler(logger.Handler()))
+	return logger, nil
+}
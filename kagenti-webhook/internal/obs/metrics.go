@@ -0,0 +1,24 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package obs
+
+import "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+// Registry is the Prometheus registry of every binary in this module. It is
+// controller-runtime's, so collectors registered here are served on the manager's
+// metrics endpoint next to the controller and webhook metrics.
+var Registry metrics.RegistererGatherer = metrics.Registry
@@ -0,0 +1,73 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package obs sets up the telemetry shared by the binaries of this module: slog logging
+// (also behind controller-runtime's logr logger), the Prometheus registry, OpenTelemetry
+// tracing and request IDs, so that every component emits the same log format, metric
+// registry and trace resource.
+package obs
+
+import (
+	"context"
+	"flag"
+	"os"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Options configure the telemetry of one binary
+type Options struct {
+	// Service names the binary in logs and traces, e.g. kagenti-webhook
+	Service string
+	// Version is reported as service.version
+	Version string
+	// LogFormat is text or json
+	LogFormat string
+	// LogLevel is debug, info, warn or error
+	LogLevel string
+}
+
+// BindFlags registers --log-format and --log-level, defaulting to LOG_FORMAT and LOG_LEVEL
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.LogFormat, "log-format", envOr("LOG_FORMAT", LogFormatText),
+		"Log format: text or json. Defaults to the LOG_FORMAT environment variable.")
+	fs.StringVar(&o.LogLevel, "log-level", envOr("LOG_LEVEL", "info"),
+		"Log level: debug, info, warn or error. Defaults to the LOG_LEVEL environment variable.")
+}
+
+// Setup installs the process-wide logger and tracer provider. The returned function
+// flushes pending spans and must be called before the process exits.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if _, err := SetupLogging(os.Stderr, opts); err != nil {
+		return nil, err
+	}
+	shutdown, err := SetupTracing(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return shutdown, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
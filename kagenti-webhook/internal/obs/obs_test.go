@@ -0,0 +1,160 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package obs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+var _ = Describe("NewLogger", func() {
+	It("writes JSON records with the service attribute", func() {
+		var out bytes.Buffer
+		logger, err := NewLogger(&out, Options{Service: "kagenti-webhook", LogFormat: "JSON", LogLevel: "info"})
+		Expect(err).NotTo(HaveOccurred())
+		logger.Debug("hidden")
+		logger.Info("started", "port", 9443)
+
+		var record map[string]any
+		Expect(json.Unmarshal(out.Bytes(), &record)).To(Succeed())
+		Expect(record).To(HaveKeyWithValue("msg", "started"))
+		Expect(record).To(HaveKeyWithValue("service", "kagenti-webhook"))
+		Expect(record).To(HaveKeyWithValue("port", BeNumerically("==", 9443)))
+	})
+
+	It("rejects unknown formats and levels", func() {
+		_, err := NewLogger(&bytes.Buffer{}, Options{LogFormat: "xml", LogLevel: "info"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid log format "xml"`)))
+		_, err = NewLogger(&bytes.Buffer{}, Options{LogFormat: LogFormatText, LogLevel: "verbose"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid log level "verbose"`)))
+	})
+})
+
+var _ = Describe("SetupTracing", func() {
+	It("stays disabled without an OTLP endpoint", func() {
+		GinkgoT().Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		GinkgoT().Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		shutdown, err := SetupTracing(context.Background(), Options{Service: "test"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shutdown(context.Background())).To(Succeed())
+	})
+})
+
+// recordingServer keeps the handlers registered on it
+type recordingServer struct {
+	webhook.Server
+	handlers map[string]http.Handler
+}
+
+func (s *recordingServer) Register(path string, hook http.Handler) {
+	s.handlers[path] = hook
+}
+
+var _ = Describe("Spans", func() {
+	var recorder *tracetest.SpanRecorder
+
+	BeforeEach(func() {
+		previous := otel.GetTracerProvider()
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(otel.SetTracerProvider, previous)
+		DeferCleanup(otel.SetTextMapPropagator, otel.GetTextMapPropagator())
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	It("runs registered handlers in a server span continuing the caller's trace", func() {
+		server := &recordingServer{handlers: map[string]http.Handler{}}
+		TraceServer(server).Register("/mutate", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, span := StartSpan(r.Context(), "decode")
+			EndSpan(span, errors.New("bad object"))
+		}))
+
+		req := httptest.NewRequest(http.MethodPost, "/mutate", nil)
+		req.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		server.handlers["/mutate"].ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		Expect(spans).To(HaveLen(2))
+		decode, handler := spans[0], spans[1]
+		Expect(decode.Name()).To(Equal("decode"))
+		Expect(decode.Status().Code).To(Equal(codes.Error))
+		Expect(decode.Parent().SpanID()).To(Equal(handler.SpanContext().SpanID()))
+		Expect(handler.Name()).To(Equal("/mutate"))
+		Expect(handler.SpanContext().TraceID().String()).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+	})
+})
+
+var _ = Describe("Request IDs", func() {
+	var (
+		seen    string
+		handler http.Handler
+	)
+
+	BeforeEach(func() {
+		seen = ""
+		handler = RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestID(r.Context())
+		}))
+	})
+
+	It("keeps the caller's request ID", func() {
+		req := httptest.NewRequest(http.MethodGet, "/version", nil)
+		req.Header.Set(RequestIDHeader, "abc")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		Expect(seen).To(Equal("abc"))
+		Expect(rec.Header().Get(RequestIDHeader)).To(Equal("abc"))
+	})
+
+	It("generates a request ID when there is none", func() {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+		Expect(seen).To(MatchRegexp("^[0-9a-f]{32}$"))
+		Expect(rec.Header().Get(RequestIDHeader)).To(Equal(seen))
+	})
+
+	It("forwards the context's request ID on outgoing requests", func() {
+		var forwarded string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded = r.Header.Get(RequestIDHeader)
+		}))
+		DeferCleanup(server.Close)
+
+		client := &http.Client{Transport: Transport(nil)}
+		req, err := http.NewRequestWithContext(WithRequestID(context.Background(), "abc"), http.MethodGet, server.URL, nil)
+		Expect(err).NotTo(HaveOccurred())
+		resp, err := client.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(forwarded).To(Equal("abc"))
+		Expect(req.Header.Get(RequestIDHeader)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,104 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version reports the build of the running webhook
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+// Set at build time, e.g.
+// -ldflags "-X github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/version.version=v0.3.0"
+// with commit and buildDate set the same way
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Path of the version endpoint on the webhook server
+const Path = "/version"
+
+// Info describes the build of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "kagenti_webhook_build_info",
+	Help: "Build of the running webhook; always 1",
+}, []string{"version", "commit", "build_date", "go_version"})
+
+func init() {
+	info := Get()
+	buildInfo.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+	obs.Registry.MustRegister(buildInfo)
+}
+
+// Get returns the build information. When they are not set through -ldflags, the commit and
+// build date fall back to the VCS revision and commit time that go build embeds.
+func Get() Info {
+	info := Info{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// Short identifies the build in annotations: the version, plus the abbreviated commit when known
+func (i Info) Short() string {
+	if i.Commit == "unknown" {
+		return i.Version
+	}
+	c := i.Commit
+	if len(c) > 12 {
+		c = c[:12]
+	}
+	return i.Version + "+" + c
+}
+
+// Handler serves the build information as JSON
+func Handler() http.Handler {
+	body, _ := json.Marshal(Get())
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+}
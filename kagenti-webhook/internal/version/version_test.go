@@ -0,0 +1,43 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package version
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Version", func() {
+	It("shortens the commit for annotations", func() {
+		Expect(Info{Version: "v0.3.0", Commit: "0123456789abcdef0123"}.Short()).To(Equal("v0.3.0+0123456789ab"))
+		Expect(Info{Version: "dev", Commit: "unknown"}.Short()).To(Equal("dev"))
+	})
+
+	It("serves the build information", func() {
+		recorder := httptest.NewRecorder()
+		Handler().ServeHTTP(recorder, httptest.NewRequest("GET", Path, nil))
+
+		var info Info
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &info)).To(Succeed())
+		Expect(info).To(Equal(Get()))
+		Expect(info.Version).To(Equal("dev"))
+		Expect(info.GoVersion).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,224 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records every admission decision of the webhook server
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gomodules.xyz/jsonpatch/v2"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var auditLog = logf.Log.WithName("admission-audit")
+
+// Decisions recorded for an admission request
+const (
+	DecisionPatched = "patched"
+	DecisionAllowed = "allowed"
+	DecisionDenied  = "denied"
+	DecisionErrored = "errored"
+)
+
+// Record is one audited admission request
+type Record struct {
+	Time      time.Time `json:"time"`
+	UID       types.UID `json:"uid"`
+	Webhook   string    `json:"webhook"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Operation string    `json:"operation"`
+	User      string    `json:"user"`
+	DryRun    bool      `json:"dryRun"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason,omitempty"`
+	Warnings  []string  `json:"warnings,omitempty"`
+	// Patch summarizes the patch as "op path" entries
+	Patch []string `json:"patch,omitempty"`
+	// PatchOperations is the full patch; only written to the audit file
+	PatchOperations []jsonpatch.JsonPatchOperation `json:"patchOperations,omitempty"`
+	DurationSeconds float64                        `json:"durationSeconds"`
+}
+
+// Auditor writes a Record per admission request, as JSON lines to a file or to the
+// admission-audit logger
+type Auditor struct {
+	mu  sync.Mutex
+	out io.Writer
+	// file is the audit file, flushed and closed when the manager stops
+	file *os.File
+}
+
+// NewAuditor appends records to path, or logs them through the admission-audit logger
+// when path is empty
+func NewAuditor(path string) (*Auditor, error) {
+	if path == "" {
+		return &Auditor{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open admission audit file: %w", err)
+	}
+	return &Auditor{out: file, file: file}, nil
+}
+
+// Start implements manager.Runnable: it closes the audit file once ctx is done
+func (a *Auditor) Start(ctx context.Context) error {
+	<-ctx.Done()
+	return a.Close()
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; every replica writes
+// its own audit file
+func (a *Auditor) NeedLeaderElection() bool {
+	return false
+}
+
+// Close flushes the audit file to disk and closes it. Records written afterwards, by
+// requests still in flight during shutdown, go to the admission-audit logger.
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	file := a.file
+	a.file, a.out = nil, nil
+	syncErr := file.Sync()
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close admission audit file: %w", err)
+	}
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync admission audit file: %w", syncErr)
+	}
+	return nil
+}
+
+// NewWriterAuditor writes records to out
+func NewWriterAuditor(out io.Writer) *Auditor {
+	return &Auditor{out: out}
+}
+
+// Server wraps a webhook server so that every admission webhook registered on it is audited
+func (a *Auditor) Server(server webhook.Server) webhook.Server {
+	return &auditedServer{Server: server, auditor: a}
+}
+
+type auditedServer struct {
+	webhook.Server
+	auditor *Auditor
+}
+
+// Register audits admission webhooks and passes other handlers through unchanged
+func (s *auditedServer) Register(path string, hook http.Handler) {
+	if wh, ok := hook.(*admission.Webhook); ok {
+		wh.Handler = s.auditor.Handler(path, wh.Handler)
+	}
+	s.Server.Register(path, hook)
+}
+
+// Handler records the decision of next for every request to the webhook at path
+func (a *Auditor) Handler(path string, next admission.Handler) admission.Handler {
+	return admission.HandlerFunc(func(ctx context.Context, req admission.Request) admission.Response {
+		start := time.Now()
+		resp := next.Handle(ctx, req)
+		a.Write(NewRecord(path, req, resp, time.Since(start)))
+		return resp
+	})
+}
+
+// NewRecord builds the audit record of an admission request
+func NewRecord(path string, req admission.Request, resp admission.Response, duration time.Duration) Record {
+	record := Record{
+		Time:            time.Now().UTC(),
+		UID:             req.UID,
+		Webhook:         path,
+		Kind:            req.Kind.Kind,
+		Namespace:       req.Namespace,
+		Name:            req.Name,
+		Operation:       string(req.Operation),
+		User:            req.UserInfo.Username,
+		DryRun:          req.DryRun != nil && *req.DryRun,
+		Decision:        decision(resp),
+		Warnings:        resp.Warnings,
+		PatchOperations: resp.Patches,
+		DurationSeconds: duration.Seconds(),
+	}
+	if resp.Result != nil {
+		record.Reason = resp.Result.Message
+	}
+	for _, op := range resp.Patches {
+		record.Patch = append(record.Patch, op.Operation+" "+op.Path)
+	}
+	return record
+}
+
+func decision(resp admission.Response) string {
+	switch {
+	case resp.Allowed && len(resp.Patches) > 0:
+		return DecisionPatched
+	case resp.Allowed:
+		return DecisionAllowed
+	case resp.Result != nil && resp.Result.Code == http.StatusForbidden:
+		return DecisionDenied
+	default:
+		return DecisionErrored
+	}
+}
+
+// Write emits record; failures to write the audit file are logged and do not affect admission
+func (a *Auditor) Write(record Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.out == nil {
+		auditLog.Info("Admission",
+			"uid", record.UID,
+			"webhook", record.Webhook,
+			"kind", record.Kind,
+			"namespace", record.Namespace,
+			"name", record.Name,
+			"operation", record.Operation,
+			"user", record.User,
+			"dryRun", record.DryRun,
+			"decision", record.Decision,
+			"reason", record.Reason,
+			"warnings", record.Warnings,
+			"patch", record.Patch,
+			"durationSeconds", record.DurationSeconds)
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		auditLog.Error(err, "Failed to encode admission audit record", "uid", record.UID)
+		return
+	}
+	if _, err := a.out.Write(append(line, '\n')); err != nil {
+		auditLog.Error(err, "Failed to write admission audit record", "uid", record.UID)
+	}
+}
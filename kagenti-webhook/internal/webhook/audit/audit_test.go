@@ -0,0 +1,143 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Auditor", func() {
+	var (
+		out     *bytes.Buffer
+		auditor *Auditor
+		req     admission.Request
+	)
+
+	BeforeEach(func() {
+		out = &bytes.Buffer{}
+		auditor = NewWriterAuditor(out)
+		req = admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "uid-1",
+			Kind:      metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Namespace: "team1",
+			Name:      "weather",
+			Operation: admissionv1.Create,
+			UserInfo:  authenticationv1.UserInfo{Username: "alice"},
+			Object:    runtime.RawExtension{Raw: []byte(`{"metadata":{"name":"weather"}}`)},
+		}}
+	})
+
+	records := func() []Record {
+		var result []Record
+		decoder := json.NewDecoder(out)
+		for decoder.More() {
+			var record Record
+			Expect(decoder.Decode(&record)).To(Succeed())
+			result = append(result, record)
+		}
+		return result
+	}
+
+	handle := func(resp admission.Response) admission.Response {
+		handler := auditor.Handler("/mutate", admission.HandlerFunc(func(context.Context, admission.Request) admission.Response {
+			return resp
+		}))
+		return handler.Handle(context.Background(), req)
+	}
+
+	It("records patches with a summary and the full operations", func() {
+		resp := handle(admission.PatchResponseFromRaw(req.Object.Raw,
+			[]byte(`{"metadata":{"name":"weather","annotations":{"kagenti.io/status":"injected"}}}`)).
+			WithWarnings("ConfigMap envoy-config not found"))
+		Expect(resp.Allowed).To(BeTrue())
+
+		Expect(records()).To(ConsistOf(SatisfyAll(
+			HaveField("UID", BeEquivalentTo("uid-1")),
+			HaveField("Webhook", "/mutate"),
+			HaveField("Kind", "Deployment"),
+			HaveField("Namespace", "team1"),
+			HaveField("Name", "weather"),
+			HaveField("Operation", "CREATE"),
+			HaveField("User", "alice"),
+			HaveField("Decision", DecisionPatched),
+			HaveField("Warnings", ConsistOf("ConfigMap envoy-config not found")),
+			HaveField("Patch", ConsistOf("add /metadata/annotations")),
+			HaveField("PatchOperations", HaveLen(1)),
+		)))
+	})
+
+	DescribeTable("records the decision",
+		func(resp admission.Response, decision, reason string) {
+			handle(resp)
+			Expect(records()).To(ConsistOf(SatisfyAll(
+				HaveField("Decision", decision),
+				HaveField("Reason", reason),
+				HaveField("Patch", BeEmpty()),
+			)))
+		},
+		Entry("allowed", admission.Allowed("injection not enabled"), DecisionAllowed, "injection not enabled"),
+		Entry("denied", admission.Denied("missing ConfigMaps"), DecisionDenied, "missing ConfigMaps"),
+		Entry("errored", admission.Errored(http.StatusInternalServerError, errors.New("boom")), DecisionErrored, "boom"),
+	)
+
+	It("audits admission webhooks registered on a wrapped server", func() {
+		hook := &admission.Webhook{Handler: admission.HandlerFunc(func(context.Context, admission.Request) admission.Response {
+			return admission.Allowed("")
+		})}
+		auditor.Server(webhook.NewServer(webhook.Options{})).Register("/validate", hook)
+
+		hook.Handle(context.Background(), req)
+		Expect(records()).To(ConsistOf(HaveField("Webhook", "/validate")))
+	})
+
+	It("closes the audit file when the manager stops", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "audit.log")
+		auditor, err := NewAuditor(path)
+		Expect(err).NotTo(HaveOccurred())
+		auditor.Write(NewRecord("/mutate", req, admission.Allowed(""), 0))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(auditor.Start(ctx)).To(Succeed())
+		Expect(auditor.file).To(BeNil())
+		Expect(auditor.NeedLeaderElection()).To(BeFalse())
+
+		// Records of requests still in flight go to the logger instead
+		auditor.Write(NewRecord("/mutate", req, admission.Allowed(""), 0))
+		Expect(auditor.Close()).To(Succeed())
+		content, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		out.Write(content)
+		Expect(records()).To(ConsistOf(HaveField("UID", BeEquivalentTo("uid-1"))))
+	})
+})
@@ -0,0 +1,85 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// AppEnvAnnotation set to "true" on the pod template exposes the AuthBridge files and
+	// proxy to the application containers through AUTHBRIDGE_* environment variables
+	AppEnvAnnotation = "kagenti.io/inject-app-env"
+
+	// AppEnvMountPath is where the shared credentials and SVIDs appear in application containers,
+	// away from paths like /opt that applications may use themselves
+	AppEnvMountPath = "/var/run/authbridge"
+)
+
+// InjectAppEnv mounts the shared credentials (and, with SPIRE, the SVIDs) read-only into
+// every application container and tells it where they are. The client secret of
+// credentials kept in a Secret, which client-registration does not write to the shared
+// volume, comes from the Secret as AUTHBRIDGE_CLIENT_SECRET. Variables and mounts the
+// application already defines are left alone.
+func (m *PodMutator) InjectAppEnv(podSpec *corev1.PodSpec, spireEnabled bool, egressMode EgressMode) {
+	env := []corev1.EnvVar{
+		{Name: "AUTHBRIDGE_CLIENT_ID_FILE", Value: AppEnvMountPath + "/shared/client-id.txt"},
+		{Name: "AUTHBRIDGE_CLIENT_SECRET_FILE", Value: AppEnvMountPath + "/shared/client-secret.txt"},
+		{Name: "AUTHBRIDGE_PROXY_URL", Value: fmt.Sprintf("http://127.0.0.1:%d", EgressProxyPort)},
+		{Name: "AUTHBRIDGE_EGRESS_MODE", Value: string(egressMode)},
+	}
+	for _, c := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+		if c.Name != EnvoyProxyContainerName {
+			continue
+		}
+		for _, e := range c.Env {
+			if e.Name == "CLIENT_SECRET" && e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				env[1] = corev1.EnvVar{Name: "AUTHBRIDGE_CLIENT_SECRET", ValueFrom: e.ValueFrom.DeepCopy()}
+			}
+		}
+	}
+	mounts := []corev1.VolumeMount{
+		{Name: "shared-data", MountPath: AppEnvMountPath + "/shared", ReadOnly: true},
+	}
+	if spireEnabled {
+		env = append(env, corev1.EnvVar{Name: "AUTHBRIDGE_JWT_SVID_FILE", Value: AppEnvMountPath + "/svid/jwt_svid.token"})
+		mounts = append(mounts, corev1.VolumeMount{Name: "svid-output", MountPath: AppEnvMountPath + "/svid", ReadOnly: true})
+	}
+
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		appendMissingEnv(container, env)
+		for _, mount := range mounts {
+			if !volumeMountExists(container.VolumeMounts, mount.Name) {
+				container.VolumeMounts = append(container.VolumeMounts, mount)
+			}
+		}
+	}
+	mutatorLog.Info("Injected AuthBridge environment into application containers",
+		"containers", len(podSpec.Containers), "spireEnabled", spireEnabled)
+}
+
+func volumeMountExists(mounts []corev1.VolumeMount, name string) bool {
+	for _, mount := range mounts {
+		if mount.Name == name {
+			return true
+		}
+	}
+	return false
+}
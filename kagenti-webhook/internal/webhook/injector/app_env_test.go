@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("InjectAppEnv", func() {
+	injectWith := func(mutator *PodMutator, annotations map[string]string, labels map[string]string) *corev1.PodTemplateSpec {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Env:  []corev1.EnvVar{{Name: "AUTHBRIDGE_PROXY_URL", Value: "http://custom:8080"}},
+		}}}}
+		podTemplate.Annotations = annotations
+		labels[AuthBridgeInjectLabel] = AuthBridgeInjectValue
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		return podTemplate
+	}
+	inject := func(annotations map[string]string, labels map[string]string) *corev1.PodTemplateSpec {
+		return injectWith(NewPodMutator(nil, true), annotations, labels)
+	}
+
+	It("leaves the application alone unless the pod template opts in", func() {
+		app := inject(nil, map[string]string{}).Spec.Containers[0]
+		Expect(app.Env).To(HaveLen(1))
+		Expect(app.VolumeMounts).To(BeEmpty())
+	})
+
+	It("exposes the credentials and proxy without overriding application settings", func() {
+		app := inject(map[string]string{AppEnvAnnotation: "true"}, map[string]string{}).Spec.Containers[0]
+		Expect(app.Env).To(ContainElements(
+			corev1.EnvVar{Name: "AUTHBRIDGE_PROXY_URL", Value: "http://custom:8080"},
+			corev1.EnvVar{Name: "AUTHBRIDGE_CLIENT_ID_FILE", Value: "/var/run/authbridge/shared/client-id.txt"},
+			corev1.EnvVar{Name: "AUTHBRIDGE_EGRESS_MODE", Value: "iptables"},
+		))
+		Expect(app.Env).NotTo(ContainElement(HaveField("Name", "AUTHBRIDGE_JWT_SVID_FILE")))
+		Expect(app.VolumeMounts).To(ConsistOf(
+			corev1.VolumeMount{Name: "shared-data", MountPath: "/var/run/authbridge/shared", ReadOnly: true}))
+	})
+
+	It("adds the JWT-SVID when SPIRE is enabled", func() {
+		app := inject(map[string]string{AppEnvAnnotation: "true"},
+			map[string]string{SpireEnableLabel: SpireEnabledValue}).Spec.Containers[0]
+		Expect(app.Env).To(ContainElement(
+			corev1.EnvVar{Name: "AUTHBRIDGE_JWT_SVID_FILE", Value: "/var/run/authbridge/svid/jwt_svid.token"}))
+		Expect(app.VolumeMounts).To(ContainElement(HaveField("Name", "svid-output")))
+	})
+
+	It("takes the client secret from the Secret that keeps the credentials", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.ClientCredentialsSecret = true
+		app := injectWith(mutator, map[string]string{AppEnvAnnotation: "true"}, map[string]string{}).Spec.Containers[0]
+		env := map[string]corev1.EnvVar{}
+		for _, e := range app.Env {
+			env[e.Name] = e
+		}
+		Expect(env).NotTo(HaveKey("AUTHBRIDGE_CLIENT_SECRET_FILE"))
+		Expect(env["AUTHBRIDGE_CLIENT_SECRET"].ValueFrom.SecretKeyRef.Name).To(Equal("app-authbridge-client"))
+		Expect(env["AUTHBRIDGE_CLIENT_SECRET"].ValueFrom.SecretKeyRef.Key).To(Equal(ClientSecretSecretKey))
+		Expect(env).To(HaveKey("AUTHBRIDGE_CLIENT_ID_FILE"))
+	})
+})
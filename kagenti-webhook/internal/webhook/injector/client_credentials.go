@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// ClientCredentialsSecretSuffix is appended to the workload name to form the Secret name
+	ClientCredentialsSecretSuffix = "-authbridge-client"
+	// Keys of the per-workload client credentials Secret
+	ClientIDSecretKey     = "client-id"
+	ClientSecretSecretKey = "client-secret"
+
+	// ClientCredentialsLabel marks the Secrets written by client-registration
+	ClientCredentialsLabel = "kagenti.io/client-credentials"
+	// ClientDeregistrationFinalizer keeps a credentials Secret until its Keycloak client is deleted
+	ClientDeregistrationFinalizer = "kagenti.io/keycloak-client"
+)
+
+// ClientCredentialsSecretName returns the Secret that holds the registered client of a
+// workload, shortened with a hash when it does not fit in a resource name
+func ClientCredentialsSecretName(workload string) string {
+	return ShortenName(workload + ClientCredentialsSecretSuffix)
+}
+
+// ShortenName replaces the end of a name longer than a resource name allows with a hash,
+// so that long names neither collide nor fail validation
+func ShortenName(full string) string {
+	if len(full) <= validation.DNS1123SubdomainMaxLength {
+		return full
+	}
+	sum := sha256.Sum256([]byte(full))
+	suffix := "." + hex.EncodeToString(sum[:8])
+	return strings.TrimRight(full[:validation.DNS1123SubdomainMaxLength-len(suffix)], ".-") + suffix
+}
+
+// InjectClientCredentialsSecret makes client-registration store the registered client in a
+// per-workload Secret, owned by the workload, and hands it to envoy-proxy via secretKeyRef.
+// The credentials then survive pod restarts and are reused by every replica. A Secret
+// volume is not used because the kubelet mounts volumes before client-registration runs.
+func (m *PodMutator) InjectClientCredentialsSecret(ctx context.Context, podSpec *corev1.PodSpec, workload string) {
+	secretName := ClientCredentialsSecretName(workload)
+
+	registrationEnv := []corev1.EnvVar{
+		{Name: "CLIENT_CREDENTIALS_SECRET", Value: secretName},
+		{
+			Name: "POD_NAMESPACE",
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+			},
+		},
+	}
+	// Only ask for the finalizer when a controller is there to remove it
+	if m.ClientDeregistration {
+		registrationEnv = append(registrationEnv,
+			corev1.EnvVar{Name: "CLIENT_CREDENTIALS_FINALIZER", Value: ClientDeregistrationFinalizer})
+	}
+	// The admission request names the workload; its UID is looked up at runtime since it
+	// does not exist yet when a workload is created
+	if req, err := admission.RequestFromContext(ctx); err == nil {
+		apiVersion := req.Kind.Version
+		if req.Kind.Group != "" {
+			apiVersion = req.Kind.Group + "/" + req.Kind.Version
+		}
+		registrationEnv = append(registrationEnv,
+			corev1.EnvVar{Name: "OWNER_API_VERSION", Value: apiVersion},
+			corev1.EnvVar{Name: "OWNER_KIND", Value: req.Kind.Kind},
+			corev1.EnvVar{Name: "OWNER_RESOURCE", Value: req.Resource.Resource},
+			corev1.EnvVar{Name: "OWNER_NAME", Value: workload},
+		)
+	}
+
+	secretRef := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+					Key:                  key,
+				},
+			},
+		}
+	}
+	envoyEnv := []corev1.EnvVar{
+		secretRef("CLIENT_ID", ClientIDSecretKey),
+		secretRef("CLIENT_SECRET", ClientSecretSecretKey),
+	}
+
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			switch containers[i].Name {
+			case ClientRegistrationContainerName:
+				appendMissingEnv(&containers[i], registrationEnv)
+			case EnvoyProxyContainerName:
+				appendMissingEnv(&containers[i], envoyEnv)
+			}
+		}
+	}
+	mutatorLog.Info("Client credentials are stored in a Secret", "secret", secretName)
+}
+
+func appendMissingEnv(container *corev1.Container, env []corev1.EnvVar) {
+	for _, e := range env {
+		if !envExists(container.Env, e.Name) {
+			container.Env = append(container.Env, e)
+		}
+	}
+}
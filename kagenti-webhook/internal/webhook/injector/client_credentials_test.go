@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Client credentials Secret", func() {
+	var (
+		mutator     *PodMutator
+		podTemplate *corev1.PodTemplateSpec
+		ctx         context.Context
+	)
+
+	labels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+
+	findContainer := func(name string) corev1.Container {
+		for _, c := range append(podTemplate.Spec.InitContainers, podTemplate.Spec.Containers...) {
+			if c.Name == name {
+				return c
+			}
+		}
+		Fail("container " + name + " not found")
+		return corev1.Container{}
+	}
+
+	envByName := func(c corev1.Container) map[string]corev1.EnvVar {
+		env := map[string]corev1.EnvVar{}
+		for _, e := range c.Env {
+			env[e.Name] = e
+		}
+		return env
+	}
+
+	BeforeEach(func() {
+		mutator = NewPodMutator(nil, true)
+		podTemplate = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+		}}
+		ctx = admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:     metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Resource: metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+			},
+		})
+	})
+
+	It("is not used by default", func() {
+		_, err := mutator.InjectAuthBridge(ctx, podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envByName(findContainer(ClientRegistrationContainerName))).NotTo(HaveKey("CLIENT_CREDENTIALS_SECRET"))
+		Expect(envByName(findContainer(EnvoyProxyContainerName))).NotTo(HaveKey("CLIENT_SECRET"))
+	})
+
+	It("points client-registration and envoy-proxy at the per-workload Secret", func() {
+		mutator.ClientCredentialsSecret = true
+		_, err := mutator.InjectAuthBridge(ctx, podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+
+		registration := envByName(findContainer(ClientRegistrationContainerName))
+		Expect(registration["CLIENT_CREDENTIALS_SECRET"].Value).To(Equal("agent-authbridge-client"))
+		Expect(registration["POD_NAMESPACE"].ValueFrom.FieldRef.FieldPath).To(Equal("metadata.namespace"))
+		Expect(registration["OWNER_API_VERSION"].Value).To(Equal("apps/v1"))
+		Expect(registration["OWNER_KIND"].Value).To(Equal("Deployment"))
+		Expect(registration["OWNER_RESOURCE"].Value).To(Equal("deployments"))
+		Expect(registration["OWNER_NAME"].Value).To(Equal("agent"))
+
+		envoy := envByName(findContainer(EnvoyProxyContainerName))
+		Expect(envoy["CLIENT_ID"].ValueFrom.SecretKeyRef.Name).To(Equal("agent-authbridge-client"))
+		Expect(envoy["CLIENT_ID"].ValueFrom.SecretKeyRef.Key).To(Equal(ClientIDSecretKey))
+		Expect(envoy["CLIENT_SECRET"].ValueFrom.SecretKeyRef.Key).To(Equal(ClientSecretSecretKey))
+	})
+
+	It("reads the Keycloak admin credentials from the admin Secret when one is configured", func() {
+		mutator.KeycloakAdminSecret = "keycloak-admin"
+		_, err := mutator.InjectAuthBridge(ctx, podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+
+		registration := envByName(findContainer(ClientRegistrationContainerName))
+		for _, key := range []string{"KEYCLOAK_ADMIN_USERNAME", "KEYCLOAK_ADMIN_PASSWORD"} {
+			Expect(registration[key].ValueFrom.ConfigMapKeyRef).To(BeNil())
+			Expect(registration[key].ValueFrom.SecretKeyRef.Name).To(Equal("keycloak-admin"))
+			Expect(registration[key].ValueFrom.SecretKeyRef.Key).To(Equal(key))
+		}
+		Expect(registration["KEYCLOAK_REALM"].ValueFrom.ConfigMapKeyRef.Name).To(Equal("environments"))
+	})
+
+	It("requests the de-registration finalizer only when the controller runs", func() {
+		mutator.ClientCredentialsSecret = true
+		_, err := mutator.InjectAuthBridge(ctx, podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envByName(findContainer(ClientRegistrationContainerName))).NotTo(HaveKey("CLIENT_CREDENTIALS_FINALIZER"))
+
+		mutator.ClientDeregistration = true
+		podTemplate.Spec = corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "app:latest"}}}
+		_, err = mutator.InjectAuthBridge(ctx, podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envByName(findContainer(ClientRegistrationContainerName))["CLIENT_CREDENTIALS_FINALIZER"].Value).
+			To(Equal(ClientDeregistrationFinalizer))
+	})
+
+	It("shortens long Secret names with a hash", func() {
+		Expect(ClientCredentialsSecretName("agent")).To(Equal("agent-authbridge-client"))
+
+		long := ClientCredentialsSecretName(strings.Repeat("a", 250))
+		other := ClientCredentialsSecretName(strings.Repeat("a", 251))
+		Expect(long).To(HaveLen(253))
+		Expect(long).To(MatchRegexp(`^a+\.[0-9a-f]{16}$`))
+		Expect(other).NotTo(Equal(long))
+	})
+
+	It("omits the owner without an admission request", func() {
+		mutator.ClientCredentialsSecret = true
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "agent", labels)
+		Expect(err).NotTo(HaveOccurred())
+		registration := envByName(findContainer(ClientRegistrationContainerName))
+		Expect(registration).To(HaveKey("CLIENT_CREDENTIALS_SECRET"))
+		Expect(registration).NotTo(HaveKey("OWNER_NAME"))
+	})
+})
@@ -0,0 +1,59 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Variables of client-registration that describe the client it registers
+const (
+	ClientDescriptionEnv  = "CLIENT_DESCRIPTION"
+	ClientRedirectURIsEnv = "CLIENT_REDIRECT_URIS"
+	ClientAudiencesEnv    = "CLIENT_AUDIENCES"
+	ClientAttributesEnv   = "CLIENT_ATTRIBUTES"
+)
+
+// ClientMetadata describes a workload's Keycloak client beyond its client ID
+type ClientMetadata struct {
+	Description  string
+	RedirectURIs []string
+	// Audiences get an audience mapper each, so they end up in the client's access tokens
+	Audiences []string
+	// Attributes are stored as Keycloak client attributes
+	Attributes map[string]string
+}
+
+// InjectClientMetadata passes metadata to client-registration, which sets it on the client
+// when creating or updating it; empty fields leave the container unchanged
+func InjectClientMetadata(podSpec *corev1.PodSpec, metadata ClientMetadata) {
+	container := findContainer(podSpec, ClientRegistrationContainerName)
+	if container == nil {
+		return
+	}
+	setEnv(container, ClientDescriptionEnv, metadata.Description)
+	setEnv(container, ClientRedirectURIsEnv, strings.Join(metadata.RedirectURIs, ","))
+	setEnv(container, ClientAudiencesEnv, strings.Join(metadata.Audiences, ","))
+	if len(metadata.Attributes) > 0 {
+		// Maps are marshalled with sorted keys, keeping the pod template stable
+		attributes, _ := json.Marshal(metadata.Attributes)
+		setEnv(container, ClientAttributesEnv, string(attributes))
+	}
+}
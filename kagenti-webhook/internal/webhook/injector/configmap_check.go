@@ -0,0 +1,171 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+// ConfigMapCheckMode is what admission does when ConfigMaps mounted by the sidecars are missing
+type ConfigMapCheckMode string
+
+const (
+	// ConfigMapCheckWarn admits the workload and returns one admission warning per missing ConfigMap
+	ConfigMapCheckWarn ConfigMapCheckMode = "warn"
+	// ConfigMapCheckDeny rejects the workload until the ConfigMaps exist
+	ConfigMapCheckDeny ConfigMapCheckMode = "deny"
+	// ConfigMapCheckOff skips the lookup
+	ConfigMapCheckOff ConfigMapCheckMode = "off"
+
+	EnvironmentsConfigMap = "environments"
+	EnvoyConfigMap        = "envoy-config"
+	SpiffeHelperConfigMap = "spiffe-helper-config"
+)
+
+// ParseConfigMapCheckMode validates a ConfigMap check mode value
+func ParseConfigMapCheckMode(value string) (ConfigMapCheckMode, error) {
+	switch mode := ConfigMapCheckMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case ConfigMapCheckWarn, ConfigMapCheckDeny, ConfigMapCheckOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("ConfigMap check mode must be %s, %s or %s, got %q",
+			ConfigMapCheckWarn, ConfigMapCheckDeny, ConfigMapCheckOff, value)
+	}
+}
+
+// requiredConfigMap is a namespace ConfigMap and the injected container that cannot start without it
+type requiredConfigMap struct {
+	name      string
+	container string
+}
+
+// RequiredConfigMaps lists the ConfigMaps the injected sidecars read from the workload namespace
+func RequiredConfigMaps(spireEnabled bool) []string {
+	names := []string{}
+	for _, cm := range requiredConfigMaps(spireEnabled) {
+		names = append(names, cm.name)
+	}
+	return names
+}
+
+func requiredConfigMaps(spireEnabled bool) []requiredConfigMap {
+	required := []requiredConfigMap{
+		{name: EnvironmentsConfigMap, container: ClientRegistrationContainerName},
+		{name: EnvoyConfigMap, container: EnvoyProxyContainerName},
+	}
+	if spireEnabled {
+		required = append(required, requiredConfigMap{name: SpiffeHelperConfigMap, container: SpiffeHelperContainerName})
+	}
+	return required
+}
+
+// CheckRequiredConfigMaps looks up the ConfigMaps the sidecars need and returns an admission
+// warning for each missing one, and for each injected container of podSpec that references
+// keys a ConfigMap lacks without optional: true. A nil podSpec stands for the default
+// sidecars. In deny mode the problems are returned as an error instead. Lookup errors other
+// than NotFound are logged and do not block admission.
+func (m *PodMutator) CheckRequiredConfigMaps(ctx context.Context, namespace string, spireEnabled bool, podSpec *corev1.PodSpec) ([]string, error) {
+	if m.Client == nil || m.ConfigMapCheck == ConfigMapCheckOff {
+		return nil, nil
+	}
+	ctx, span := obs.StartSpan(ctx, "check ConfigMaps", attribute.String("k8s.namespace.name", namespace))
+	defer span.End()
+	if podSpec == nil {
+		podSpec = &corev1.PodSpec{InitContainers: []corev1.Container{
+			keycloakAdminFromSecret(
+				BuildClientRegistrationContainerWithSpireOption("", "", namespace, spireEnabled), m.KeycloakAdminSecret),
+		}}
+	}
+
+	var warnings []string
+	for _, required := range requiredConfigMaps(spireEnabled) {
+		cm := &corev1.ConfigMap{}
+		err := m.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: required.name}, cm)
+		if apierrors.IsNotFound(err) {
+			warnings = append(warnings, fmt.Sprintf(
+				"ConfigMap %q not found in namespace %q: the %s container will not start until it is created",
+				required.name, namespace, required.container))
+			continue
+		} else if err != nil {
+			mutatorLog.Error(err, "Failed to look up required ConfigMap", "namespace", namespace, "configMap", required.name)
+			continue
+		}
+		for _, refs := range requiredKeys(podSpec, required.name) {
+			var missing []string
+			for _, key := range refs.keys {
+				if _, ok := cm.Data[key]; !ok {
+					if _, ok := cm.BinaryData[key]; !ok {
+						missing = append(missing, key)
+					}
+				}
+			}
+			if len(missing) > 0 {
+				warnings = append(warnings, fmt.Sprintf(
+					"ConfigMap %q in namespace %q has no %s key(s): the %s container will not start until they are added",
+					required.name, namespace, strings.Join(missing, ", "), refs.container))
+			}
+		}
+	}
+
+	if len(warnings) > 0 && m.ConfigMapCheck == ConfigMapCheckDeny {
+		return nil, fmt.Errorf("missing AuthBridge ConfigMaps: %s", strings.Join(warnings, "; "))
+	}
+	return warnings, nil
+}
+
+// containerKeys are the keys of a ConfigMap that a container cannot start without
+type containerKeys struct {
+	container string
+	keys      []string
+}
+
+// requiredKeys lists, per injected container, the keys of the named ConfigMap that its
+// environment references without optional: true. IdP profiles replace some references
+// with literal values, so the keys depend on the mutated pod spec.
+func requiredKeys(podSpec *corev1.PodSpec, configMap string) []containerKeys {
+	var required []containerKeys
+	for _, c := range slices.Concat(podSpec.InitContainers, podSpec.Containers) {
+		if !isInjectedContainer(c) {
+			continue
+		}
+		refs := containerKeys{container: c.Name}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil || env.ValueFrom.ConfigMapKeyRef == nil {
+				continue
+			}
+			ref := env.ValueFrom.ConfigMapKeyRef
+			if ref.Name == configMap && !ptr.Deref(ref.Optional, false) {
+				refs.keys = append(refs.keys, ref.Key)
+			}
+		}
+		if len(refs.keys) > 0 {
+			required = append(required, refs)
+		}
+	}
+	return required
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CheckRequiredConfigMaps", func() {
+	var mutator *PodMutator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		envoyConfig := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: EnvoyConfigMap, Namespace: "team1"}}
+		mutator = NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(envoyConfig).Build(), true)
+	})
+
+	It("warns about each missing ConfigMap by default", func() {
+		warnings, err := mutator.CheckRequiredConfigMaps(context.Background(), "team1", false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring(`"environments"`)))
+
+		warnings, err = mutator.CheckRequiredConfigMaps(context.Background(), "team1", true, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring(`"environments"`), ContainSubstring(SpiffeHelperContainerName)))
+	})
+
+	It("rejects the workload in deny mode", func() {
+		mutator.ConfigMapCheck = ConfigMapCheckDeny
+		_, err := mutator.CheckRequiredConfigMaps(context.Background(), "team1", false, nil)
+		Expect(err).To(MatchError(ContainSubstring(ClientRegistrationContainerName)))
+
+		_, err = mutator.CheckRequiredConfigMaps(context.Background(), "other", false, nil)
+		Expect(err).To(MatchError(ContainSubstring(EnvoyProxyContainerName)))
+	})
+
+	It("reports the keys the injected containers need", func() {
+		environments := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: EnvironmentsConfigMap, Namespace: "team1"},
+			Data:       map[string]string{"KEYCLOAK_ADMIN_USERNAME": "admin"},
+		}
+		Expect(mutator.Client.Create(context.Background(), environments)).To(Succeed())
+		warnings, err := mutator.CheckRequiredConfigMaps(context.Background(), "team1", false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(And(
+			ContainSubstring(`"environments"`),
+			ContainSubstring("no KEYCLOAK_REALM, KEYCLOAK_ADMIN_PASSWORD key(s)"),
+			ContainSubstring(ClientRegistrationContainerName),
+		)))
+
+		// an IdP profile sets the realm, so only the admin password is missing
+		mutator.IDPProfiles = IDPProfiles{"corp": {KeycloakURL: "https://sso.example.com", KeycloakRealm: "corp"}}
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		_, err = mutator.InjectAuthBridge(context.Background(), podTemplate, "team1", "agent", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+			IDPProfileLabel:       "corp",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		warnings, err = mutator.CheckRequiredConfigMaps(context.Background(), "team1", false, &podTemplate.Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("no KEYCLOAK_ADMIN_PASSWORD key(s)")))
+	})
+
+	It("does not require the admin keys when they come from a Secret", func() {
+		environments := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: EnvironmentsConfigMap, Namespace: "team1"},
+			Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak:8080", "KEYCLOAK_REALM": "demo"},
+		}
+		Expect(mutator.Client.Create(context.Background(), environments)).To(Succeed())
+		mutator.KeycloakAdminSecret = "keycloak-admin"
+		warnings, err := mutator.CheckRequiredConfigMaps(context.Background(), "team1", false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("skips the lookup when turned off", func() {
+		mutator.ConfigMapCheck = ConfigMapCheckOff
+		warnings, err := mutator.CheckRequiredConfigMaps(context.Background(), "team1", true, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("parses the mode flag", func() {
+		Expect(ParseConfigMapCheckMode(" Deny")).To(Equal(ConfigMapCheckDeny))
+		_, err := ParseConfigMapCheckMode("fail")
+		Expect(err).To(HaveOccurred())
+	})
+})
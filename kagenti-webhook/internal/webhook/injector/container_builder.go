@@ -40,6 +40,8 @@ const (
 	// Envoy proxy configuration
 	EnvoyProxyUID  = 1337
 	EnvoyProxyPort = 15123
+	EnvoyAdminPort = 9901
+	ExtProcPort    = 9090
 )
 
 func BuildSpiffeHelperContainer() corev1.Container {
@@ -49,6 +51,8 @@ func BuildSpiffeHelperContainer() corev1.Container {
 		Name:            SpiffeHelperContainerName,
 		Image:           "ghcr.io/spiffe/spiffe-helper:nightly",
 		ImagePullPolicy: corev1.PullIfNotPresent,
+		// Native sidecar: keeps refreshing the SVID while the init containers after it run
+		RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
 		Resources: corev1.ResourceRequirements{
 			Limits: corev1.ResourceList{
 				corev1.ResourceCPU:    resource.MustParse("100m"),
@@ -85,6 +89,32 @@ func BuildSpiffeHelperContainer() corev1.Container {
 	}
 }
 
+// registrationDeadlineScript defines past_deadline and register for the client-registration
+// script. With REGISTRATION_TIMEOUT_SECONDS set, register fails once the deadline, counted
+// from the container start, passes; the restart policy decides whether the pod retries.
+const registrationDeadlineScript = `# REGISTRATION_TIMEOUT_SECONDS bounds the registration, e.g. for Jobs
+DEADLINE=""
+if [ -n "$REGISTRATION_TIMEOUT_SECONDS" ]; then
+  DEADLINE=$(( $(date +%s) + REGISTRATION_TIMEOUT_SECONDS ))
+fi
+past_deadline() {
+  [ -n "$DEADLINE" ] && [ "$(date +%s)" -ge "$DEADLINE" ]
+}
+register() {
+  if [ -z "$DEADLINE" ]; then
+    python client_registration.py
+    return
+  fi
+  remaining=$(( DEADLINE - $(date +%s) ))
+  [ "$remaining" -gt 0 ] || remaining=1
+  status=0
+  timeout "$remaining" python client_registration.py || status=$?
+  if [ "$status" -eq 124 ]; then
+    echo "Error: client registration did not complete within ${REGISTRATION_TIMEOUT_SECONDS}s" >&2
+  fi
+  return "$status"
+}`
+
 func BuildClientRegistrationContainer(clientID, name, namespace string) corev1.Container {
 	// Default to SPIRE enabled for backward compatibility
 	return BuildClientRegistrationContainerWithSpireOption(clientID, name, namespace, true)
@@ -95,7 +125,7 @@ func BuildClientRegistrationContainer(clientID, name, namespace string) corev1.C
 func BuildClientRegistrationContainerWithSpireOption(clientID, name, namespace string, spireEnabled bool) corev1.Container {
 	builderLog.Info("building ClientRegistration Container", "spireEnabled", spireEnabled)
 
-	if clientID =="" {
+	if clientID == "" {
 		clientID = namespace + "/" + name
 	}
 
@@ -188,8 +218,14 @@ func BuildClientRegistrationContainerWithSpireOption(clientID, name, namespace s
 	var command string
 	if spireEnabled {
 		command = `
+set -e
+` + registrationDeadlineScript + `
 echo "Waiting for SPIFFE credentials..."
 while [ ! -f /opt/jwt_svid.token ]; do
+  if past_deadline; then
+    echo "Error: no SVID after ${REGISTRATION_TIMEOUT_SECONDS}s" >&2
+    exit 1
+  fi
   echo "waiting for SVID"
   sleep 1
 done
@@ -205,16 +241,22 @@ if [ -z "$CLIENT_ID" ]; then
   echo "Error: Extracted client ID is empty" >&2
   exit 1
 fi
+# The kagenti.io/spiffe-id annotation must name the SVID, never another identity
+if [ -n "$SPIFFE_ID" ] && [ "$SPIFFE_ID" != "$CLIENT_ID" ]; then
+  echo "Error: the SVID names $CLIENT_ID, not the annotated SPIFFE ID $SPIFFE_ID" >&2
+  exit 1
+fi
 echo "$CLIENT_ID" > /shared/client-id.txt
 echo "Client ID (SPIFFE ID): $CLIENT_ID"
 
 echo "Starting client registration..."
-python client_registration.py
+register
 echo "Client registration complete!"
-tail -f /dev/null
 `
 	} else {
 		command = `
+set -e
+` + registrationDeadlineScript + `
 echo "SPIRE disabled - using static client ID"
 
 # Use CLIENT_NAME as the client ID
@@ -222,9 +264,8 @@ echo "$CLIENT_NAME" > /shared/client-id.txt
 echo "Client ID: $CLIENT_NAME"
 
 echo "Starting client registration..."
-python client_registration.py
+register
 echo "Client registration complete!"
-tail -f /dev/null
 `
 	}
 
@@ -254,6 +295,27 @@ tail -f /dev/null
 	}
 }
 
+// keycloakAdminFromSecret makes the client registration container read the Keycloak admin
+// credentials from the named Secret of the workload's namespace, under the same keys,
+// instead of the environments ConfigMap. An empty name leaves the container as it is.
+func keycloakAdminFromSecret(container corev1.Container, secret string) corev1.Container {
+	if secret == "" {
+		return container
+	}
+	for i := range container.Env {
+		switch container.Env[i].Name {
+		case "KEYCLOAK_ADMIN_USERNAME", "KEYCLOAK_ADMIN_PASSWORD":
+			container.Env[i].ValueFrom = &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  container.Env[i].Name,
+				},
+			}
+		}
+	}
+	return container
+}
+
 // BuildEnvoyProxyContainer creates the envoy-proxy sidecar container
 // This container intercepts outbound traffic and performs token exchange via ext-proc
 func BuildEnvoyProxyContainer() corev1.Container {
@@ -263,6 +325,8 @@ func BuildEnvoyProxyContainer() corev1.Container {
 		Name:            EnvoyProxyContainerName,
 		Image:           DefaultEnvoyImage,
 		ImagePullPolicy: corev1.PullIfNotPresent,
+		// Native sidecar: ready before the application starts and does not block Job completion
+		RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
 		Resources: corev1.ResourceRequirements{
 			Limits: corev1.ResourceList{
 				corev1.ResourceCPU:    resource.MustParse("200m"),
@@ -279,14 +343,19 @@ func BuildEnvoyProxyContainer() corev1.Container {
 				ContainerPort: EnvoyProxyPort,
 				Protocol:      corev1.ProtocolTCP,
 			},
+			{
+				Name:          "envoy-egress",
+				ContainerPort: EgressProxyPort,
+				Protocol:      corev1.ProtocolTCP,
+			},
 			{
 				Name:          "envoy-admin",
-				ContainerPort: 9901,
+				ContainerPort: EnvoyAdminPort,
 				Protocol:      corev1.ProtocolTCP,
 			},
 			{
 				Name:          "ext-proc",
-				ContainerPort: 9090,
+				ContainerPort: ExtProcPort,
 				Protocol:      corev1.ProtocolTCP,
 			},
 		},
@@ -328,87 +397,779 @@ func BuildEnvoyProxyContainer() corev1.Container {
 				},
 			},
 			{
-				Name:  "CLIENT_ID_FILE",
-				Value: "/shared/client-id.txt",
+				Name: "TOOL_AUTHZ_MODE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "TOOL_AUTHZ_MODE",
+						Optional: ptr.To(true),
+					},
+				},
 			},
 			{
-				Name:  "CLIENT_SECRET_FILE",
-				Value: "/shared/client-secret.txt",
+				Name: "TOOL_POLICY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "TOOL_POLICY",
+						Optional: ptr.To(true),
+					},
+				},
 			},
-		},
-		SecurityContext: &corev1.SecurityContext{
-			RunAsUser:  ptr.To(int64(EnvoyProxyUID)),
-			RunAsGroup: ptr.To(int64(EnvoyProxyUID)),
-		},
-		VolumeMounts: []corev1.VolumeMount{
 			{
-				Name:      "envoy-config",
-				MountPath: "/etc/envoy",
-				ReadOnly:  true,
+				Name: "TOOL_SCOPE_PREFIX",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "TOOL_SCOPE_PREFIX",
+						Optional: ptr.To(true),
+					},
+				},
 			},
 			{
-				Name:      "shared-data",
-				MountPath: "/shared",
-				ReadOnly:  true,
+				Name: "OPA_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "OPA_URL",
+						Optional: ptr.To(true),
+					},
+				},
 			},
-		},
-	}
-}
-
-// BuildProxyInitContainer creates the init container that sets up iptables
-// to redirect outbound traffic to the Envoy proxy.
-//
-// SECURITY NOTE: This init container requires elevated privileges:
-//   - RunAsUser: 0 (root) - Required to modify network namespace iptables rules
-//   - RunAsNonRoot: false - Explicitly allows root execution
-//   - NET_ADMIN capability - Required to configure iptables rules for traffic redirection
-//   - NET_RAW capability - Required to create raw sockets for network operations
-//
-// These privileges are necessary because iptables manipulation is a kernel-level
-// operation that requires root access. This is a common pattern used by service
-// meshes (Istio, Linkerd) for transparent traffic interception.
-//
-// Risk mitigations:
-//   - This runs as an init container (not a long-running sidecar), limiting exposure window
-//   - The container exits immediately after configuring iptables rules
-//   - Minimal resource limits are applied (10m CPU, 10Mi memory)
-//   - The container image should be regularly updated and scanned for vulnerabilities
-//   - Consider using a distroless or minimal base image for the proxy-init container
-//
-// Alternative approaches (not currently implemented):
-//   - CNI plugin: Configure iptables at pod network setup time (requires cluster-level changes)
-//   - Istio CNI: Similar approach used by Istio to avoid privileged init containers
-func BuildProxyInitContainer() corev1.Container {
-	builderLog.Info("building ProxyInit Container")
-
-	return corev1.Container{
-		Name:            ProxyInitContainerName,
-		Image:           DefaultProxyInitImage,
-		ImagePullPolicy: corev1.PullIfNotPresent,
-		Resources: corev1.ResourceRequirements{
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("10m"),
-				corev1.ResourceMemory: resource.MustParse("10Mi"),
+			{
+				Name: "OPA_TIMEOUT",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "OPA_TIMEOUT",
+						Optional: ptr.To(true),
+					},
+				},
 			},
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse("10m"),
-				corev1.ResourceMemory: resource.MustParse("10Mi"),
+			{
+				Name: "OPA_FAIL_OPEN",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "OPA_FAIL_OPEN",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CEDAR_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CEDAR_URL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CEDAR_TIMEOUT",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CEDAR_TIMEOUT",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CEDAR_FAIL_OPEN",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CEDAR_FAIL_OPEN",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CEDAR_POLICY_FILE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CEDAR_POLICY_FILE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CEDAR_POLICY_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CEDAR_POLICY_URL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "ACTOR_TOKEN_SOURCE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "ACTOR_TOKEN_SOURCE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "ACTOR_TOKEN_FILE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "ACTOR_TOKEN_FILE",
+						Optional: ptr.To(true),
+					},
+				},
 			},
-		},
-		Env: []corev1.EnvVar{
 			{
-				Name:  "PROXY_PORT",
-				Value: fmt.Sprintf("%d", EnvoyProxyPort),
+				Name: "MAX_CHAIN_DEPTH",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "MAX_CHAIN_DEPTH",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "MCP_SESSION_BINDING",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "MCP_SESSION_BINDING",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "MCP_SESSION_TTL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "MCP_SESSION_TTL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "MCP_SESSION_MAX_ENTRIES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "MCP_SESSION_MAX_ENTRIES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "MCP_SESSION_MAX_BYTES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "MCP_SESSION_MAX_BYTES",
+						Optional: ptr.To(true),
+					},
+				},
 			},
 			{
-				Name:  "PROXY_UID",
-				Value: fmt.Sprintf("%d", EnvoyProxyUID),
+				Name: "SUBJECT_JWKS_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "SUBJECT_JWKS_URL",
+						Optional: ptr.To(true),
+					},
+				},
 			},
 			{
-				Name:  "OUTBOUND_PORTS_EXCLUDE",
-				Value: "8080", // Exclude Keycloak port from redirect
+				Name: "SUBJECT_ISSUERS",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "SUBJECT_ISSUERS",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "SUBJECT_AUDIENCES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "SUBJECT_AUDIENCES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "SUBJECT_REQUIRED_CLAIMS",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "SUBJECT_REQUIRED_CLAIMS",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "SUBJECT_LEEWAY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "SUBJECT_LEEWAY",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "EXCHANGED_TOKEN_JWKS_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "EXCHANGED_TOKEN_JWKS_URL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "EXCHANGED_TOKEN_ISSUERS",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "EXCHANGED_TOKEN_ISSUERS",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "EXCHANGED_TOKEN_MAX_LIFETIME",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "EXCHANGED_TOKEN_MAX_LIFETIME",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "ROTATION_POLL_INTERVAL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "ROTATION_POLL_INTERVAL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "FORWARD_ORIGINAL_TOKEN",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "FORWARD_ORIGINAL_TOKEN",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "FORWARD_ORIGINAL_TOKEN_HEADER",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "FORWARD_ORIGINAL_TOKEN_HEADER",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "TOKEN_PLACEMENT",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "TOKEN_PLACEMENT",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "EXCHANGE_RULES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "EXCHANGE_RULES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CLOCK_SKEW",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CLOCK_SKEW",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "METRICS_ADDR",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "METRICS_ADDR",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "FANOUT_EXCHANGES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "FANOUT_EXCHANGES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "FANOUT_CACHE_MAX_ENTRIES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "FANOUT_CACHE_MAX_ENTRIES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "AUDIT_PATH_SEGMENTS",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "AUDIT_PATH_SEGMENTS",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "METRICS_MAX_SERIES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "METRICS_MAX_SERIES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CREDENTIALS_WAIT",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CREDENTIALS_WAIT",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CREDENTIALS_POLL_INTERVAL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CREDENTIALS_POLL_INTERVAL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CREDENTIALS_FAILURE_POLICY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CREDENTIALS_FAILURE_POLICY",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "STALE_IF_ERROR",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "STALE_IF_ERROR",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "STALE_IF_ERROR_GRACE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "STALE_IF_ERROR_GRACE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "STALE_IF_ERROR_MAX_ENTRIES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "STALE_IF_ERROR_MAX_ENTRIES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "HTTPS_PROXY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "HTTPS_PROXY",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "HTTP_PROXY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "HTTP_PROXY",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "NO_PROXY",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "NO_PROXY",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "IDP_HTTP2",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "IDP_HTTP2",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CLIENT_AUTH_METHOD",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CLIENT_AUTH_METHOD",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CLIENT_CERT_FILE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CLIENT_CERT_FILE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CLIENT_KEY_FILE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CLIENT_KEY_FILE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "REPLAY_DETECTION",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "REPLAY_DETECTION",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "REPLAY_CACHE_MAX_ENTRIES",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "REPLAY_CACHE_MAX_ENTRIES",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "EXCHANGE_PARAMS",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "EXCHANGE_PARAMS",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "CLUSTER_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "CLUSTER_NAME",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			// The workload's identity, for ${VAR} references in EXCHANGE_PARAMS
+			{
+				Name: "POD_NAMESPACE",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+				},
+			},
+			{
+				Name: "POD_NAME",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+				},
+			},
+			{
+				Name: "POD_SERVICE_ACCOUNT",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.serviceAccountName"},
+				},
+			},
+			{
+				Name: "LOG_LEVEL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "LOG_LEVEL",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "LOG_SAMPLE_RATE",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "authbridge-config",
+						},
+						Key:      "LOG_SAMPLE_RATE",
+						Optional: ptr.To(true),
+					},
+				},
+			},
+			{
+				Name:  "CLIENT_ID_FILE",
+				Value: "/shared/client-id.txt",
+			},
+			{
+				Name:  "CLIENT_SECRET_FILE",
+				Value: "/shared/client-secret.txt",
+			},
+		},
+		StartupProbe:   BuildEnvoyStartupProbe(EnvoyAdminPort),
+		ReadinessProbe: BuildEnvoyReadinessProbe(),
+		LivenessProbe:  BuildEnvoyLivenessProbe(),
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  ptr.To(int64(EnvoyProxyUID)),
+			RunAsGroup: ptr.To(int64(EnvoyProxyUID)),
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      "envoy-config",
+				MountPath: "/etc/envoy",
+				ReadOnly:  true,
+			},
+			{
+				Name:      "shared-data",
+				MountPath: "/shared",
+				ReadOnly:  true,
+			},
+		},
+	}
+}
+
+// BuildProxyInitContainer creates the init container that sets up iptables
+// to redirect outbound traffic to the Envoy proxy.
+//
+// SECURITY NOTE: This init container requires elevated privileges:
+//   - RunAsUser: 0 (root) - Required to modify network namespace iptables rules
+//   - RunAsNonRoot: false - Explicitly allows root execution
+//   - NET_ADMIN capability - Required to configure iptables rules for traffic redirection
+//   - NET_RAW capability - Required to create raw sockets for network operations
+//
+// These privileges are necessary because iptables manipulation is a kernel-level
+// operation that requires root access. This is a common pattern used by service
+// meshes (Istio, Linkerd) for transparent traffic interception.
+//
+// Risk mitigations:
+//   - This runs as an init container (not a long-running sidecar), limiting exposure window
+//   - The container exits immediately after configuring iptables rules
+//   - Minimal resource limits are applied (10m CPU, 10Mi memory)
+//   - The container image should be regularly updated and scanned for vulnerabilities
+//   - Consider using a distroless or minimal base image for the proxy-init container
+//
+// Alternative approaches (not currently implemented):
+//   - CNI plugin: Configure iptables at pod network setup time (requires cluster-level changes)
+//   - Istio CNI: Similar approach used by Istio to avoid privileged init containers
+func BuildProxyInitContainer() corev1.Container {
+	return BuildProxyInitContainerWithConfig(DefaultProxyInitConfig())
+}
+
+// BuildProxyInitContainerWithConfig creates the proxy-init container with the given iptables parameters
+func BuildProxyInitContainerWithConfig(cfg ProxyInitConfig) corev1.Container {
+	builderLog.Info("building ProxyInit Container",
+		"outboundCapturePort", cfg.OutboundCapturePort,
+		"includeInboundPorts", cfg.IncludeInboundPorts,
+		"interceptionMode", cfg.InterceptionMode,
+		"excludeOutboundPorts", cfg.ExcludeOutboundPorts,
+		"excludeOutboundCIDRs", cfg.ExcludeOutboundCIDRs,
+		"excludeUIDs", cfg.ExcludeUIDs)
+
+	return corev1.Container{
+		Name:            ProxyInitContainerName,
+		Image:           DefaultProxyInitImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("10Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("10Mi"),
 			},
 		},
+		Env: cfg.Env(),
 		SecurityContext: &corev1.SecurityContext{
 			RunAsUser:    ptr.To(int64(0)),
 			RunAsNonRoot: ptr.To(false),
@@ -0,0 +1,263 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// CredentialHygieneAnnotation set to "true" or "false" on the pod template overrides
+	// the --credential-hygiene default
+	CredentialHygieneAnnotation = "kagenti.io/credential-hygiene"
+	// CredentialRotationAnnotation re-registers the client, with a new client secret, every
+	// duration, such as "24h". It turns credential hygiene on; "0" never rotates.
+	CredentialRotationAnnotation = "kagenti.io/credential-rotation"
+
+	CredentialHygieneContainerName = "credential-hygiene"
+
+	// MinCredentialRotation keeps rotations from hammering Keycloak
+	MinCredentialRotation = time.Minute
+
+	// credentialHygieneReadyFile is written once the files have been locked down, so that
+	// envoy-proxy only starts afterwards
+	credentialHygieneReadyFile = "/tmp/credential-hygiene-ready"
+)
+
+// CredentialHygiene is what the credential-hygiene sidecar does for a pod
+type CredentialHygiene struct {
+	Enabled bool
+	// Rotation is the re-registration period, 0 for none
+	Rotation time.Duration
+}
+
+// CredentialHygieneFor returns the credential hygiene of the pod template: the annotations
+// if set, the webhook defaults otherwise
+func CredentialHygieneFor(annotations map[string]string, defaults CredentialHygiene) (CredentialHygiene, error) {
+	hygiene := defaults
+	if value, ok := annotations[CredentialHygieneAnnotation]; ok {
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return CredentialHygiene{}, fmt.Errorf("invalid %s annotation %q: must be true or false", CredentialHygieneAnnotation, value)
+		}
+		hygiene.Enabled = enabled
+	}
+	if value, ok := annotations[CredentialRotationAnnotation]; ok {
+		rotation, err := ParseCredentialRotation(value)
+		if err != nil {
+			return CredentialHygiene{}, fmt.Errorf("invalid %s annotation: %w", CredentialRotationAnnotation, err)
+		}
+		hygiene.Rotation = rotation
+		if rotation > 0 {
+			hygiene.Enabled = true
+		}
+	}
+	if !hygiene.Enabled {
+		hygiene.Rotation = 0
+	}
+	return hygiene, nil
+}
+
+// ParseCredentialRotation parses a rotation period of at least MinCredentialRotation, or 0
+func ParseCredentialRotation(value string) (time.Duration, error) {
+	rotation, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || rotation != 0 && rotation < MinCredentialRotation {
+		return 0, fmt.Errorf("rotation %q must be a duration of at least %s, or 0", value, MinCredentialRotation)
+	}
+	return rotation, nil
+}
+
+// credentialHygieneScript locks the credential files down every CREDENTIAL_CHECK_SECONDS:
+// those in CREDENTIAL_DIRS to CREDENTIAL_FILE_MODE, owned by CREDENTIAL_FILE_OWNER, and the
+// SVIDs in SVID_DIRS to SVID_FILE_MODE with CREDENTIAL_FILE_OWNER as group. spiffe-helper
+// keeps owning the SVIDs, since it rewrites them in place as they renew, whatever user it
+// runs as; the check repeats for the files it creates. With CREDENTIAL_ROTATION_SECONDS set
+// it runs client_registration.py again with ROTATE_CLIENT_SECRET=true; envoy-proxy picks
+// the new files up. On SIGTERM, which native sidecars get after envoy-proxy has stopped,
+// the files are overwritten and removed.
+const credentialHygieneScript = `
+set -u
+lock_down() {
+  for dir in $CREDENTIAL_DIRS; do
+    for file in "$dir"/*; do
+      [ -f "$file" ] || continue
+      chown "$CREDENTIAL_FILE_OWNER:$CREDENTIAL_FILE_OWNER" "$file" && chmod "$CREDENTIAL_FILE_MODE" "$file" ||
+        echo "Warning: failed to lock down $file" >&2
+    done
+  done
+  for dir in $SVID_DIRS; do
+    for file in "$dir"/*; do
+      [ -f "$file" ] || continue
+      chgrp "$CREDENTIAL_FILE_OWNER" "$file" && chmod "$SVID_FILE_MODE" "$file" ||
+        echo "Warning: failed to lock down $file" >&2
+    done
+  done
+}
+scrub() {
+  echo "Scrubbing credential files"
+  for dir in $CREDENTIAL_DIRS $SVID_DIRS; do
+    for file in "$dir"/*; do
+      [ -f "$file" ] && shred -u -z "$file"
+    done
+  done
+  exit 0
+}
+trap scrub TERM INT
+
+lock_down
+touch ` + credentialHygieneReadyFile + `
+ROTATION="${CREDENTIAL_ROTATION_SECONDS:-0}"
+NEXT_ROTATION=$(( $(date +%s) + ROTATION ))
+while true; do
+  if [ "$ROTATION" -gt 0 ] && [ "$(date +%s)" -ge "$NEXT_ROTATION" ]; then
+    echo "Rotating client credentials..."
+    if ROTATE_CLIENT_SECRET=true python client_registration.py; then
+      NEXT_ROTATION=$(( $(date +%s) + ROTATION ))
+    else
+      echo "Error: credential rotation failed, retrying in 60s" >&2
+      NEXT_ROTATION=$(( $(date +%s) + 60 ))
+    fi
+  fi
+  lock_down
+  sleep "$CREDENTIAL_CHECK_SECONDS" &
+  wait $!
+done
+`
+
+// BuildCredentialHygieneContainer creates the credential-hygiene sidecar from the
+// client-registration container, so that a rotation registers the client exactly as the
+// first registration did. It runs as root with only the capabilities it needs to hand the
+// files to the Envoy user, the only reader of the credentials besides itself.
+func BuildCredentialHygieneContainer(registration corev1.Container, rotation time.Duration) corev1.Container {
+	builderLog.Info("building CredentialHygiene Container", "rotation", rotation)
+
+	container := *registration.DeepCopy()
+	container.Name = CredentialHygieneContainerName
+	// Native sidecar: started before envoy-proxy and, in reverse order, stopped after it
+	container.RestartPolicy = ptr.To(corev1.ContainerRestartPolicyAlways)
+	container.Command = []string{"/bin/sh", "-c", credentialHygieneScript}
+	container.Args = nil
+	container.ReadinessProbe, container.LivenessProbe = nil, nil
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{
+			Command: []string{"test", "-f", credentialHygieneReadyFile},
+		}},
+		PeriodSeconds:    1,
+		FailureThreshold: 30,
+	}
+	dirs, svidDirs := []string{}, []string{}
+	for _, mount := range container.VolumeMounts {
+		switch mount.Name {
+		case "shared-data":
+			dirs = append(dirs, mount.MountPath)
+		case "svid-output":
+			svidDirs = append(svidDirs, mount.MountPath)
+		}
+	}
+	slices.Sort(dirs)
+	slices.Sort(svidDirs)
+	container.Env = slices.DeleteFunc(container.Env, func(e corev1.EnvVar) bool {
+		return e.Name == RegistrationTimeoutEnv
+	})
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "CREDENTIAL_DIRS", Value: strings.Join(dirs, " ")},
+		corev1.EnvVar{Name: "CREDENTIAL_FILE_OWNER", Value: strconv.Itoa(EnvoyProxyUID)},
+		corev1.EnvVar{Name: "CREDENTIAL_FILE_MODE", Value: "0400"},
+		// Read by envoy-proxy through its group, rewritten by spiffe-helper as the owner
+		corev1.EnvVar{Name: "SVID_DIRS", Value: strings.Join(svidDirs, " ")},
+		corev1.EnvVar{Name: "SVID_FILE_MODE", Value: "0640"},
+		corev1.EnvVar{Name: "CREDENTIAL_CHECK_SECONDS", Value: "10"},
+		corev1.EnvVar{Name: "CREDENTIAL_ROTATION_SECONDS", Value: strconv.Itoa(int(rotation.Seconds()))},
+	)
+	container.SecurityContext = &corev1.SecurityContext{
+		RunAsUser:                ptr.To(int64(0)),
+		RunAsNonRoot:             ptr.To(false),
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+			// CHOWN and FOWNER hand the files over, DAC_OVERRIDE rewrites them on rotation
+			Add: []corev1.Capability{"CHOWN", "FOWNER", "DAC_OVERRIDE"},
+		},
+	}
+	return container
+}
+
+// RotatesCredentials reports whether the credential-hygiene sidecar of podSpec rotates the
+// client secret
+func RotatesCredentials(podSpec *corev1.PodSpec) bool {
+	container := findContainer(podSpec, CredentialHygieneContainerName)
+	if container == nil {
+		return false
+	}
+	for _, env := range container.Env {
+		if env.Name == "CREDENTIAL_ROTATION_SECONDS" {
+			return env.Value != "" && env.Value != "0"
+		}
+	}
+	return false
+}
+
+// CheckCredentialRotation rejects credential rotation for workloads of kind that run more
+// than one pod. Their pods share one Keycloak client, and a rotation in one pod replaces
+// the client secret the others still use, so their token exchanges fail until they rotate
+// too. DaemonSets run a pod per node.
+func CheckCredentialRotation(podSpec *corev1.PodSpec, kind string, replicas int32) error {
+	if !RotatesCredentials(podSpec) || kind != "DaemonSet" && replicas <= 1 {
+		return nil
+	}
+	return fmt.Errorf("%s requires a single pod: the pods of the %s share one Keycloak client, "+
+		"and a rotation in one pod invalidates the client secret of the others; set it to \"0\"",
+		CredentialRotationAnnotation, kind)
+}
+
+// InjectCredentialHygiene adds the credential-hygiene sidecar right after
+// client-registration. Pods whose application reads the credentials through
+// kagenti.io/inject-app-env keep them readable and get no sidecar, and credentials kept in
+// a Secret are not rotated, since envoy-proxy only reads the Secret at start.
+func (m *PodMutator) InjectCredentialHygiene(podSpec *corev1.PodSpec, hygiene CredentialHygiene, annotations map[string]string) {
+	if !hygiene.Enabled || findContainer(podSpec, CredentialHygieneContainerName) != nil {
+		return
+	}
+	if annotations[AppEnvAnnotation] == "true" {
+		mutatorLog.Info("Skipping credential hygiene: the application reads the credentials", "annotation", AppEnvAnnotation)
+		return
+	}
+	index := slices.IndexFunc(podSpec.InitContainers, func(c corev1.Container) bool {
+		return c.Name == ClientRegistrationContainerName
+	})
+	if index < 0 {
+		return
+	}
+	rotation := hygiene.Rotation
+	if rotation > 0 && m.ClientCredentialsSecret {
+		mutatorLog.Info("Not rotating credentials kept in a Secret", "rotation", rotation)
+		rotation = 0
+	}
+	container := m.SidecarConfig.apply(BuildCredentialHygieneContainer(podSpec.InitContainers[index], rotation))
+	if annotations[SidecarProbesAnnotation] == "false" {
+		container.StartupProbe = nil
+	}
+	podSpec.InitContainers = slices.Insert(podSpec.InitContainers, index+1, container)
+	mutatorLog.Info("Injected credential-hygiene sidecar", "rotation", rotation)
+}
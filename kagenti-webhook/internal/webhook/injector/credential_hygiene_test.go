@@ -0,0 +1,145 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Credential hygiene sidecar", func() {
+	inject := func(mutator *PodMutator, annotations map[string]string) (*corev1.PodSpec, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Annotations = annotations
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+			SpireEnableLabel:      SpireEnabledValue,
+		})
+		return &podTemplate.Spec, err
+	}
+	initContainerNames := func(podSpec *corev1.PodSpec) []string {
+		names := []string{}
+		for _, c := range podSpec.InitContainers {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	It("is not injected by default", func() {
+		podSpec, err := inject(NewPodMutator(nil, true), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, CredentialHygieneContainerName)).To(BeNil())
+	})
+
+	It("runs between client-registration and envoy-proxy with its configuration", func() {
+		podSpec, err := inject(NewPodMutator(nil, true), map[string]string{
+			CredentialHygieneAnnotation:   "true",
+			RegistrationTimeoutAnnotation: "2m",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(initContainerNames(podSpec)).To(Equal([]string{ProxyInitContainerName, SpiffeHelperContainerName,
+			ClientRegistrationContainerName, CredentialHygieneContainerName, EnvoyProxyContainerName}))
+
+		sidecar := findContainer(podSpec, CredentialHygieneContainerName)
+		registration := findContainer(podSpec, ClientRegistrationContainerName)
+		Expect(*sidecar.RestartPolicy).To(Equal(corev1.ContainerRestartPolicyAlways))
+		Expect(sidecar.Image).To(Equal(registration.Image))
+		Expect(sidecar.VolumeMounts).To(Equal(registration.VolumeMounts))
+		Expect(sidecar.Env).To(ContainElements(
+			corev1.EnvVar{Name: "CLIENT_NAME", Value: "ns/app"},
+			corev1.EnvVar{Name: "CREDENTIAL_DIRS", Value: "/shared"},
+			corev1.EnvVar{Name: "CREDENTIAL_FILE_OWNER", Value: "1337"},
+			corev1.EnvVar{Name: "CREDENTIAL_FILE_MODE", Value: "0400"},
+			// spiffe-helper keeps write access to the SVIDs it renews
+			corev1.EnvVar{Name: "SVID_DIRS", Value: "/opt"},
+			corev1.EnvVar{Name: "SVID_FILE_MODE", Value: "0640"},
+			corev1.EnvVar{Name: "CREDENTIAL_ROTATION_SECONDS", Value: "0"},
+		))
+		Expect(sidecar.Env).NotTo(ContainElement(HaveField("Name", RegistrationTimeoutEnv)))
+		Expect(sidecar.StartupProbe).NotTo(BeNil())
+		Expect(sidecar.SecurityContext.Capabilities.Drop).To(ConsistOf(corev1.Capability("ALL")))
+	})
+
+	It("rotates on the annotated schedule, which turns it on", func() {
+		podSpec, err := inject(NewPodMutator(nil, true), map[string]string{CredentialRotationAnnotation: "24h"})
+		Expect(err).NotTo(HaveOccurred())
+		sidecar := findContainer(podSpec, CredentialHygieneContainerName)
+		Expect(sidecar).NotTo(BeNil())
+		Expect(sidecar.Env).To(ContainElement(corev1.EnvVar{Name: "CREDENTIAL_ROTATION_SECONDS", Value: "86400"}))
+	})
+
+	It("follows the webhook default unless the workload opts out", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.CredentialHygiene = CredentialHygiene{Enabled: true, Rotation: time.Hour}
+		podSpec, err := inject(mutator, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, CredentialHygieneContainerName).Env).To(
+			ContainElement(corev1.EnvVar{Name: "CREDENTIAL_ROTATION_SECONDS", Value: "3600"}))
+
+		podSpec, err = inject(mutator, map[string]string{CredentialHygieneAnnotation: "false"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, CredentialHygieneContainerName)).To(BeNil())
+	})
+
+	It("leaves the credentials of applications that read them alone", func() {
+		podSpec, err := inject(NewPodMutator(nil, true), map[string]string{
+			CredentialHygieneAnnotation: "true",
+			AppEnvAnnotation:            "true",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, CredentialHygieneContainerName)).To(BeNil())
+	})
+
+	It("does not rotate credentials kept in a Secret", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.ClientCredentialsSecret = true
+		podSpec, err := inject(mutator, map[string]string{CredentialRotationAnnotation: "24h"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, CredentialHygieneContainerName).Env).To(
+			ContainElement(corev1.EnvVar{Name: "CREDENTIAL_ROTATION_SECONDS", Value: "0"}))
+	})
+
+	It("rejects rotation for workloads that run more than one pod", func() {
+		podSpec, err := inject(NewPodMutator(nil, true), map[string]string{CredentialRotationAnnotation: "24h"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(RotatesCredentials(podSpec)).To(BeTrue())
+		Expect(CheckCredentialRotation(podSpec, "Deployment", 1)).To(Succeed())
+		Expect(CheckCredentialRotation(podSpec, "Deployment", 0)).To(Succeed())
+		Expect(CheckCredentialRotation(podSpec, "Deployment", 3)).To(MatchError(ContainSubstring(CredentialRotationAnnotation)))
+		Expect(CheckCredentialRotation(podSpec, "DaemonSet", 1)).To(MatchError(ContainSubstring(CredentialRotationAnnotation)))
+
+		podSpec, err = inject(NewPodMutator(nil, true), map[string]string{CredentialHygieneAnnotation: "true"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(RotatesCredentials(podSpec)).To(BeFalse())
+		Expect(CheckCredentialRotation(podSpec, "DaemonSet", 3)).To(Succeed())
+	})
+
+	It("rejects invalid annotations", func() {
+		for annotation, value := range map[string]string{
+			CredentialHygieneAnnotation:  "yes please",
+			CredentialRotationAnnotation: "30s",
+		} {
+			_, err := inject(NewPodMutator(nil, true), map[string]string{annotation: value})
+			Expect(err).To(MatchError(ContainSubstring(annotation)), value)
+		}
+	})
+})
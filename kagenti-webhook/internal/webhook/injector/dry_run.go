@@ -0,0 +1,40 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// IsDryRun reports whether the admission request carried in ctx was sent with dryRun=true
+// (e.g. `kubectl apply --dry-run=server`).
+//
+// controller-runtime stores the request in the context for both raw handlers and
+// CustomDefaulters, so this works for every webhook sharing the PodMutator. The mutation
+// itself must still run so the API server can return the full patch; anything that
+// persists state or is visible outside the response (events, creating ConfigMaps or
+// Secrets, external API calls) must be skipped when this returns true. Webhooks that
+// perform such side effects must be registered with sideEffects=NoneOnDryRun.
+func IsDryRun(ctx context.Context) bool {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return req.DryRun != nil && *req.DryRun
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Dry-run admission", func() {
+	requestContext := func(dryRun *bool) context.Context {
+		return admission.NewContextWithRequest(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{DryRun: dryRun},
+		})
+	}
+
+	newTemplate := func() *corev1.PodTemplateSpec {
+		return &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+			},
+		}
+	}
+
+	It("detects dry-run requests", func() {
+		Expect(IsDryRun(requestContext(ptr.To(true)))).To(BeTrue())
+		Expect(IsDryRun(requestContext(ptr.To(false)))).To(BeFalse())
+		Expect(IsDryRun(requestContext(nil))).To(BeFalse())
+		Expect(IsDryRun(context.Background())).To(BeFalse())
+	})
+
+	It("returns exactly the same mutation for dry-run and real requests", func() {
+		mutator := NewPodMutator(nil, true)
+		labels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+
+		dryRunTemplate := newTemplate()
+		mutated, err := mutator.InjectAuthBridge(requestContext(ptr.To(true)), dryRunTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutated).To(BeTrue())
+
+		realTemplate := newTemplate()
+		mutated, err = mutator.InjectAuthBridge(requestContext(ptr.To(false)), realTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutated).To(BeTrue())
+
+		Expect(dryRunTemplate).To(Equal(realTemplate))
+	})
+})
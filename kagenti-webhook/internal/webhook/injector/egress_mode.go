@@ -0,0 +1,152 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// EgressModeAnnotation selects how outbound traffic reaches Envoy
+	EgressModeAnnotation = "kagenti.io/egress-mode"
+	// NoProxyAnnotation lists extra hosts or domains (comma-separated) that bypass Envoy in proxy-env mode
+	NoProxyAnnotation = "kagenti.io/no-proxy"
+	// RedirectAnnotation marks pods whose redirection is set up by the AuthBridge CNI plugin
+	RedirectAnnotation = "kagenti.io/redirect"
+	RedirectCNI        = "cni"
+	// RedirectEnvAnnotation carries the proxy-init environment (JSON object) for the CNI plugin
+	RedirectEnvAnnotation = "kagenti.io/redirect-env"
+
+	// EgressProxyPort is the Envoy forward-proxy listener used in proxy-env mode
+	EgressProxyPort = 15125
+)
+
+// EgressMode is how outbound application traffic is steered to Envoy
+type EgressMode string
+
+const (
+	// EgressModeIPTables injects proxy-init to redirect all outbound TCP traffic transparently
+	EgressModeIPTables EgressMode = "iptables"
+	// EgressModeProxyEnv skips proxy-init (no NET_ADMIN) and points the application at
+	// Envoy's forward-proxy listener through HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	EgressModeProxyEnv EgressMode = "proxy-env"
+	// EgressModeCNI skips proxy-init and leaves the iptables setup to the node-level
+	// AuthBridge CNI plugin, which reads the redirect annotations from the pod
+	EgressModeCNI EgressMode = "cni"
+	// EgressModeIstio leaves the traffic to the Istio sidecar: the injected sidecar only
+	// runs the ext_proc server, which an EnvoyFilter attaches to the Istio proxy
+	EgressModeIstio EgressMode = "istio"
+)
+
+// defaultNoProxy keeps loopback traffic (including the sidecars) away from the proxy
+var defaultNoProxy = []string{"localhost", "127.0.0.1", "::1"}
+
+// ParseEgressMode validates an egress mode value
+func ParseEgressMode(value string) (EgressMode, error) {
+	switch mode := EgressMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case EgressModeIPTables, EgressModeProxyEnv, EgressModeCNI, EgressModeIstio:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("egress mode must be %s, %s, %s or %s, got %q",
+			EgressModeIPTables, EgressModeProxyEnv, EgressModeCNI, EgressModeIstio, value)
+	}
+}
+
+// EgressModeFor returns the egress mode requested on the pod template, or the default
+func EgressModeFor(annotations map[string]string, defaultMode EgressMode) (EgressMode, error) {
+	value, ok := annotations[EgressModeAnnotation]
+	if !ok {
+		return defaultMode, nil
+	}
+	mode, err := ParseEgressMode(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s annotation: %w", EgressModeAnnotation, err)
+	}
+	return mode, nil
+}
+
+// BuildProxyEnv returns the proxy environment variables for proxy-env mode, in both the
+// upper- and lower-case spellings since HTTP clients disagree on which one they read.
+func BuildProxyEnv(annotations map[string]string) []corev1.EnvVar {
+	proxyURL := fmt.Sprintf("http://127.0.0.1:%d", EgressProxyPort)
+	noProxy := slices.Clone(defaultNoProxy)
+	noProxy = append(noProxy, splitAnnotationList(annotations[NoProxyAnnotation])...)
+
+	var env []corev1.EnvVar
+	for _, pair := range [][2]string{
+		{"HTTP_PROXY", proxyURL},
+		{"HTTPS_PROXY", proxyURL},
+		{"NO_PROXY", strings.Join(noProxy, ",")},
+	} {
+		env = append(env,
+			corev1.EnvVar{Name: pair[0], Value: pair[1]},
+			corev1.EnvVar{Name: strings.ToLower(pair[0]), Value: pair[1]})
+	}
+	return env
+}
+
+// InjectProxyEnv adds the proxy environment to every application container. Injected
+// sidecars are skipped and variables the application already sets are left alone.
+func (m *PodMutator) InjectProxyEnv(podSpec *corev1.PodSpec, annotations map[string]string) {
+	proxyEnv := BuildProxyEnv(annotations)
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		if slices.Contains(injectedContainerNames, container.Name) {
+			continue
+		}
+		for _, env := range proxyEnv {
+			if !envExists(container.Env, env.Name) {
+				container.Env = append(container.Env, env)
+			}
+		}
+		mutatorLog.Info("Injected proxy environment", "container", container.Name)
+	}
+}
+
+func envExists(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// StampRedirectAnnotations hands the proxy-init configuration to the CNI plugin through
+// pod template annotations, replacing the privileged init container.
+func StampRedirectAnnotations(meta *metav1.ObjectMeta, cfg ProxyInitConfig) error {
+	env := map[string]string{}
+	for _, e := range cfg.Env() {
+		env[e.Name] = e.Value
+	}
+	encoded, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode redirect configuration: %w", err)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[RedirectAnnotation] = RedirectCNI
+	meta.Annotations[RedirectEnvAnnotation] = string(encoded)
+	return nil
+}
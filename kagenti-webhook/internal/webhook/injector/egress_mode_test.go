@@ -0,0 +1,147 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Egress mode", func() {
+	var (
+		mutator     *PodMutator
+		podTemplate *corev1.PodTemplateSpec
+		labels      map[string]string
+	)
+
+	BeforeEach(func() {
+		mutator = NewPodMutator(nil, true)
+		podTemplate = &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:  "app",
+					Image: "app:latest",
+					Env:   []corev1.EnvVar{{Name: "NO_PROXY", Value: "custom"}},
+				}},
+			},
+		}
+		labels = map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+	})
+
+	envOf := func(container corev1.Container) map[string]string {
+		env := map[string]string{}
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+		}
+		return env
+	}
+
+	It("injects proxy-init by default", func() {
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeTrue())
+		Expect(envOf(podTemplate.Spec.Containers[0])).NotTo(HaveKey("HTTP_PROXY"))
+	})
+
+	It("sets proxy environment variables instead of proxy-init in proxy-env mode", func() {
+		podTemplate.Annotations = map[string]string{
+			EgressModeAnnotation: string(EgressModeProxyEnv),
+			NoProxyAnnotation:    "keycloak.keycloak.svc",
+		}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeFalse())
+
+		for _, c := range podTemplate.Spec.Containers {
+			env := envOf(c)
+			if c.Name != "app" {
+				Expect(env).NotTo(HaveKey("HTTP_PROXY"), "sidecar %s must not use the proxy", c.Name)
+				continue
+			}
+			Expect(env).To(HaveKeyWithValue("HTTP_PROXY", "http://127.0.0.1:15125"))
+			Expect(env).To(HaveKeyWithValue("https_proxy", "http://127.0.0.1:15125"))
+			Expect(env).To(HaveKeyWithValue("no_proxy", "localhost,127.0.0.1,::1,keycloak.keycloak.svc"))
+			// Values set by the application win
+			Expect(env).To(HaveKeyWithValue("NO_PROXY", "custom"))
+		}
+	})
+
+	It("stamps redirect annotations instead of proxy-init in cni mode", func() {
+		podTemplate.Annotations = map[string]string{
+			EgressModeAnnotation:                string(EgressModeCNI),
+			"kagenti.io/exclude-outbound-ports": "5432",
+		}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeFalse())
+		Expect(podTemplate.Annotations).To(HaveKeyWithValue(RedirectAnnotation, RedirectCNI))
+
+		redirectEnv := map[string]string{}
+		Expect(json.Unmarshal([]byte(podTemplate.Annotations[RedirectEnvAnnotation]), &redirectEnv)).To(Succeed())
+		Expect(redirectEnv).To(HaveKeyWithValue("OUTBOUND_PORTS_EXCLUDE", "8080,5432"))
+		Expect(envOf(podTemplate.Spec.Containers[0])).NotTo(HaveKey("HTTP_PROXY"))
+	})
+
+	It("runs only the ext_proc server next to the Istio sidecar in istio mode", func() {
+		podTemplate.Annotations = map[string]string{EgressModeAnnotation: string(EgressModeIstio)}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeFalse())
+		Expect(podTemplate.Annotations).NotTo(HaveKey(RedirectAnnotation))
+		Expect(envOf(podTemplate.Spec.Containers[0])).NotTo(HaveKey("HTTP_PROXY"))
+
+		envoy := findContainer(&podTemplate.Spec, EnvoyProxyContainerName)
+		Expect(envoy).NotTo(BeNil())
+		Expect(envoy.Command).To(Equal(ExtProcCommand))
+		Expect(envoy.Ports).To(HaveLen(1))
+		Expect(envoy.Ports[0].ContainerPort).To(Equal(int32(ExtProcPort)))
+		Expect(envoy.StartupProbe).To(Equal(BuildExtProcStartupProbe()))
+		Expect(envoy.ReadinessProbe).To(Equal(BuildEnvoyReadinessProbe()))
+		Expect(envoy.LivenessProbe).To(BeNil())
+	})
+
+	It("keeps the probes removed in istio mode", func() {
+		podTemplate.Annotations = map[string]string{
+			EgressModeAnnotation:    string(EgressModeIstio),
+			SidecarProbesAnnotation: "false",
+		}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		envoy := findContainer(&podTemplate.Spec, EnvoyProxyContainerName)
+		Expect(envoy.StartupProbe).To(BeNil())
+		Expect(envoy.ReadinessProbe).To(BeNil())
+	})
+
+	It("uses the manager-level default and lets workloads override it", func() {
+		mutator.EgressMode = EgressModeProxyEnv
+		podTemplate.Annotations = map[string]string{EgressModeAnnotation: "iptables"}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeTrue())
+	})
+
+	It("rejects unknown egress modes", func() {
+		podTemplate.Annotations = map[string]string{EgressModeAnnotation: "ebpf"}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).To(MatchError(ContainSubstring(EgressModeAnnotation)))
+	})
+})
@@ -0,0 +1,94 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EnvoyAdminAnnotation selects how the injected Envoy serves its admin interface
+	EnvoyAdminAnnotation = "kagenti.io/envoy-admin"
+
+	// EnvoyAdminEnv is read by the Envoy entrypoint, which rewrites the admin address of envoy.yaml
+	EnvoyAdminEnv = "ENVOY_ADMIN"
+)
+
+// EnvoyAdminMode is where the injected Envoy serves its admin interface
+type EnvoyAdminMode string
+
+const (
+	// EnvoyAdminLocalhost keeps the admin address of envoy.yaml, 127.0.0.1:9901. The
+	// application containers share the pod's loopback interface and can reach it.
+	EnvoyAdminLocalhost EnvoyAdminMode = "localhost"
+	// EnvoyAdminUDS serves the admin interface on a Unix socket only the Envoy user can open,
+	// inside the Envoy container
+	EnvoyAdminUDS EnvoyAdminMode = "uds"
+	// EnvoyAdminDisabled removes the admin interface
+	EnvoyAdminDisabled EnvoyAdminMode = "disabled"
+)
+
+// ParseEnvoyAdminMode validates an Envoy admin mode value
+func ParseEnvoyAdminMode(value string) (EnvoyAdminMode, error) {
+	switch mode := EnvoyAdminMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case EnvoyAdminLocalhost, EnvoyAdminUDS, EnvoyAdminDisabled:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("envoy admin mode must be %s, %s or %s, got %q",
+			EnvoyAdminLocalhost, EnvoyAdminUDS, EnvoyAdminDisabled, value)
+	}
+}
+
+// EnvoyAdminModeFor returns the Envoy admin mode requested on the pod template, or the default
+func EnvoyAdminModeFor(annotations map[string]string, defaultMode EnvoyAdminMode) (EnvoyAdminMode, error) {
+	value, ok := annotations[EnvoyAdminAnnotation]
+	if !ok {
+		return defaultMode, nil
+	}
+	mode, err := ParseEnvoyAdminMode(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s annotation: %w", EnvoyAdminAnnotation, err)
+	}
+	return mode, nil
+}
+
+// envoyListenerStartupCheck is envoyStartupCheck for an Envoy without a TCP admin
+// interface: its outbound listener accepting connections stands in for the LIVE state
+func envoyListenerStartupCheck(outboundPort int32) string {
+	return fmt.Sprintf(credentialsCheck+` && exec 3<>/dev/tcp/127.0.0.1/%d && exec 4<>/dev/tcp/127.0.0.1/%d`,
+		ExtProcPort, outboundPort)
+}
+
+// InjectEnvoyAdmin moves the Envoy admin interface to a Unix socket or removes it. The
+// envoy-admin port goes away and the startup probe, if any, checks the outbound listener.
+// It runs after InjectEnvoyPorts, which rebuilds the startup probe for another admin port.
+func (m *PodMutator) InjectEnvoyAdmin(podSpec *corev1.PodSpec, mode EnvoyAdminMode, ports EnvoyPorts) {
+	envoy := findContainer(podSpec, EnvoyProxyContainerName)
+	if envoy == nil || mode == "" || mode == EnvoyAdminLocalhost {
+		return
+	}
+	setEnv(envoy, EnvoyAdminEnv, string(mode))
+	envoy.Ports = slices.DeleteFunc(envoy.Ports, func(p corev1.ContainerPort) bool { return p.Name == "envoy-admin" })
+	if envoy.StartupProbe != nil {
+		envoy.StartupProbe.Exec = &corev1.ExecAction{Command: []string{"bash", "-c", envoyListenerStartupCheck(ports.Outbound)}}
+	}
+	mutatorLog.Info("Restricted the Envoy admin interface", "mode", mode)
+}
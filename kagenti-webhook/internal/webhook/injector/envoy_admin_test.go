@@ -0,0 +1,80 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Envoy admin interface", func() {
+	inject := func(mutator *PodMutator, annotations map[string]string) (corev1.Container, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Annotations = annotations
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+		})
+		envoy := findContainer(&podTemplate.Spec, EnvoyProxyContainerName)
+		if envoy == nil {
+			return corev1.Container{}, err
+		}
+		return *envoy, err
+	}
+	hasAdminPort := func(envoy corev1.Container) bool {
+		for _, p := range envoy.Ports {
+			if p.Name == "envoy-admin" {
+				return true
+			}
+		}
+		return false
+	}
+
+	It("keeps the admin interface on localhost by default", func() {
+		envoy, err := inject(NewPodMutator(nil, true), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envExists(envoy.Env, EnvoyAdminEnv)).To(BeFalse())
+		Expect(hasAdminPort(envoy)).To(BeTrue())
+		Expect(envoy.StartupProbe.Exec.Command[2]).To(ContainSubstring("GET /ready"))
+	})
+
+	It("moves the admin interface off the loopback interface", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.EnvoyAdmin = EnvoyAdminDisabled
+		for mode, annotations := range map[EnvoyAdminMode]map[string]string{
+			EnvoyAdminDisabled: nil,
+			EnvoyAdminUDS:      {EnvoyAdminAnnotation: "uds", OutboundCapturePortAnnotation: "16123"},
+		} {
+			envoy, err := inject(mutator, annotations)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(envoy.Env).To(ContainElement(corev1.EnvVar{Name: EnvoyAdminEnv, Value: string(mode)}))
+			Expect(hasAdminPort(envoy)).To(BeFalse(), string(mode))
+			Expect(envoy.StartupProbe.Exec.Command[2]).NotTo(ContainSubstring("GET /ready"))
+		}
+		envoy, err := inject(mutator, map[string]string{EnvoyAdminAnnotation: "uds", OutboundCapturePortAnnotation: "16123"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envoy.StartupProbe.Exec.Command[2]).To(ContainSubstring("/dev/tcp/127.0.0.1/16123"))
+	})
+
+	It("rejects unknown modes", func() {
+		_, err := inject(NewPodMutator(nil, true), map[string]string{EnvoyAdminAnnotation: "public"})
+		Expect(err).To(MatchError(ContainSubstring(EnvoyAdminAnnotation)))
+	})
+})
@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// EnvoyAdminPortAnnotation moves Envoy's admin interface, bound to 127.0.0.1, off its
+	// default port for applications that already listen on it
+	EnvoyAdminPortAnnotation = "kagenti.io/envoy-admin-port"
+
+	// Environment variables the Envoy entrypoint renders into envoy.yaml when set
+	EnvoyOutboundPortEnv = "ENVOY_OUTBOUND_PORT"
+	EnvoyInboundPortEnv  = "ENVOY_INBOUND_PORT"
+	EnvoyAdminPortEnv    = "ENVOY_ADMIN_PORT"
+)
+
+// EnvoyPorts are the ports the injected Envoy listens on. The capture ports are the
+// proxy-init redirect targets, so both sidecars follow the same annotations.
+type EnvoyPorts struct {
+	Outbound int32
+	Inbound  int32
+	Admin    int32
+}
+
+// EnvoyPortsFromAnnotations applies the capture and admin port annotations on top of the
+// mutator's proxy-init defaults and rejects ports that collide with another Envoy listener
+func EnvoyPortsFromAnnotations(defaults ProxyInitConfig, annotations map[string]string) (EnvoyPorts, error) {
+	ports := EnvoyPorts{
+		Outbound: defaults.OutboundCapturePort,
+		Inbound:  defaults.InboundCapturePort,
+		Admin:    EnvoyAdminPort,
+	}
+	for _, override := range []struct {
+		annotation string
+		port       *int32
+	}{
+		{OutboundCapturePortAnnotation, &ports.Outbound},
+		{InboundCapturePortAnnotation, &ports.Inbound},
+		{EnvoyAdminPortAnnotation, &ports.Admin},
+	} {
+		value, ok := annotations[override.annotation]
+		if !ok {
+			continue
+		}
+		port, err := parsePort(strings.TrimSpace(value))
+		if err != nil {
+			return ports, fmt.Errorf("invalid %s annotation: %w", override.annotation, err)
+		}
+		*override.port = port
+	}
+
+	used := map[int32]string{EgressProxyPort: "egress proxy", ExtProcPort: "ext_proc"}
+	for _, listener := range []struct {
+		name string
+		port int32
+	}{
+		{"outbound capture", ports.Outbound},
+		{"inbound capture", ports.Inbound},
+		{"admin", ports.Admin},
+	} {
+		if other, ok := used[listener.port]; ok {
+			return ports, fmt.Errorf("envoy %s port %d collides with the %s port", listener.name, listener.port, other)
+		}
+		used[listener.port] = listener.name
+	}
+	return ports, nil
+}
+
+// InjectEnvoyPorts points the Envoy sidecar at ports, leaving it untouched when they are
+// the ones baked into the Envoy configuration
+func (m *PodMutator) InjectEnvoyPorts(podSpec *corev1.PodSpec, ports EnvoyPorts) {
+	envoy := findContainer(podSpec, EnvoyProxyContainerName)
+	if envoy == nil {
+		return
+	}
+	for _, override := range []struct {
+		env, portName string
+		port, baked   int32
+	}{
+		{EnvoyOutboundPortEnv, "envoy-outbound", ports.Outbound, EnvoyProxyPort},
+		{EnvoyInboundPortEnv, "", ports.Inbound, DefaultInboundCapturePort},
+		{EnvoyAdminPortEnv, "envoy-admin", ports.Admin, EnvoyAdminPort},
+	} {
+		if override.port == override.baked {
+			continue
+		}
+		setEnv(envoy, override.env, strconv.Itoa(int(override.port)))
+		for i := range envoy.Ports {
+			if envoy.Ports[i].Name == override.portName {
+				envoy.Ports[i].ContainerPort = override.port
+			}
+		}
+	}
+	if ports.Admin != EnvoyAdminPort && envoy.StartupProbe != nil {
+		envoy.StartupProbe = BuildEnvoyStartupProbe(ports.Admin)
+	}
+}
+
+func findContainer(podSpec *corev1.PodSpec, name string) *corev1.Container {
+	for i := range podSpec.InitContainers {
+		if podSpec.InitContainers[i].Name == name {
+			return &podSpec.InitContainers[i]
+		}
+	}
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == name {
+			return &podSpec.Containers[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Envoy ports", func() {
+	inject := func(annotations map[string]string) (*corev1.PodTemplateSpec, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Annotations = annotations
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+		})
+		return podTemplate, err
+	}
+
+	containerNamed := func(containers []corev1.Container, name string) corev1.Container {
+		for _, c := range containers {
+			if c.Name == name {
+				return c
+			}
+		}
+		Fail("container " + name + " not injected")
+		return corev1.Container{}
+	}
+
+	portNamed := func(container corev1.Container, name string) int32 {
+		for _, p := range container.Ports {
+			if p.Name == name {
+				return p.ContainerPort
+			}
+		}
+		return 0
+	}
+
+	It("keeps the baked-in Envoy configuration by default", func() {
+		podTemplate, err := inject(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		envoy := containerNamed(podTemplate.Spec.InitContainers, EnvoyProxyContainerName)
+		Expect(envExists(envoy.Env, EnvoyOutboundPortEnv)).To(BeFalse())
+		Expect(envExists(envoy.Env, EnvoyAdminPortEnv)).To(BeFalse())
+		Expect(portNamed(envoy, "envoy-outbound")).To(Equal(int32(EnvoyProxyPort)))
+	})
+
+	It("moves Envoy and proxy-init to the annotated ports", func() {
+		podTemplate, err := inject(map[string]string{
+			OutboundCapturePortAnnotation: "16123",
+			InboundCapturePortAnnotation:  "16124",
+			EnvoyAdminPortAnnotation:      "19901",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		envoy := containerNamed(podTemplate.Spec.InitContainers, EnvoyProxyContainerName)
+		Expect(envoy.Env).To(ContainElements(
+			corev1.EnvVar{Name: EnvoyOutboundPortEnv, Value: "16123"},
+			corev1.EnvVar{Name: EnvoyInboundPortEnv, Value: "16124"},
+			corev1.EnvVar{Name: EnvoyAdminPortEnv, Value: "19901"}))
+		Expect(portNamed(envoy, "envoy-outbound")).To(Equal(int32(16123)))
+		Expect(portNamed(envoy, "envoy-admin")).To(Equal(int32(19901)))
+		Expect(envoy.StartupProbe.Exec.Command[2]).To(ContainSubstring("/dev/tcp/127.0.0.1/19901"))
+
+		proxyInit := containerNamed(podTemplate.Spec.InitContainers, ProxyInitContainerName)
+		Expect(proxyInit.Env).To(ContainElements(
+			corev1.EnvVar{Name: "PROXY_PORT", Value: "16123"},
+			corev1.EnvVar{Name: "INBOUND_PROXY_PORT", Value: "16124"}))
+	})
+
+	It("follows the mutator's proxy-init defaults", func() {
+		defaults := DefaultProxyInitConfig()
+		defaults.OutboundCapturePort = 17123
+		ports, err := EnvoyPortsFromAnnotations(defaults, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ports).To(Equal(EnvoyPorts{Outbound: 17123, Inbound: DefaultInboundCapturePort, Admin: EnvoyAdminPort}))
+	})
+
+	It("rejects invalid and colliding ports", func() {
+		_, err := inject(map[string]string{EnvoyAdminPortAnnotation: "99999"})
+		Expect(err).To(MatchError(ContainSubstring(EnvoyAdminPortAnnotation)))
+
+		_, err = inject(map[string]string{EnvoyAdminPortAnnotation: "9090"})
+		Expect(err).To(MatchError(ContainSubstring("collides with the ext_proc port")))
+
+		_, err = inject(map[string]string{OutboundCapturePortAnnotation: "15124"})
+		Expect(err).To(MatchError(ContainSubstring("collides")))
+	})
+})
@@ -0,0 +1,181 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// IDPProfileLabel selects one of the manager's identity provider profiles for a workload
+const IDPProfileLabel = "kagenti.io/idp"
+
+const (
+	// NamespaceKeycloakURLAnnotation and NamespaceKeycloakRealmAnnotation on a namespace
+	// point its workloads at another Keycloak than its environments ConfigMap, so one
+	// webhook can serve namespaces bound to different realms. Both must be set.
+	NamespaceKeycloakURLAnnotation   = "kagenti.io/keycloak-url"
+	NamespaceKeycloakRealmAnnotation = "kagenti.io/keycloak-realm"
+)
+
+// IDPProfile is the identity provider a workload registers with and exchanges tokens at.
+// Unset fields keep the values from the namespace's environments and authbridge-config
+// ConfigMaps; the Keycloak admin credentials always come from environments.
+type IDPProfile struct {
+	KeycloakURL   string `json:"keycloakURL"`
+	KeycloakRealm string `json:"keycloakRealm"`
+	// TokenURL defaults to the realm's OpenID Connect token endpoint
+	TokenURL string `json:"tokenURL,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	Scopes   string `json:"scopes,omitempty"`
+}
+
+// IDPProfiles maps profile names, the values of the kagenti.io/idp label, to profiles
+type IDPProfiles map[string]IDPProfile
+
+// LoadIDPProfiles reads profiles from a YAML (or JSON) file with a top-level profiles map
+func LoadIDPProfiles(path string) (IDPProfiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IdP profiles: %w", err)
+	}
+	var file struct {
+		Profiles IDPProfiles `json:"profiles"`
+	}
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse IdP profiles %s: %w", path, err)
+	}
+	for name, profile := range file.Profiles {
+		if profile.KeycloakURL == "" || profile.KeycloakRealm == "" {
+			return nil, fmt.Errorf("IdP profile %q needs keycloakURL and keycloakRealm", name)
+		}
+		if profile.TokenURL == "" {
+			profile.TokenURL = realmTokenURL(profile.KeycloakURL, profile.KeycloakRealm)
+			file.Profiles[name] = profile
+		}
+	}
+	return file.Profiles, nil
+}
+
+func realmTokenURL(keycloakURL, realm string) string {
+	return strings.TrimSuffix(keycloakURL, "/") + "/realms/" + realm + "/protocol/openid-connect/token"
+}
+
+// NamespaceIDPProfile returns the profile set by the Keycloak annotations of a namespace,
+// or nil when the namespace has none or does not exist. Audience and scopes keep coming
+// from the authbridge-config ConfigMap.
+func NamespaceIDPProfile(ctx context.Context, c client.Reader, namespace string) (*IDPProfile, error) {
+	ns, err := getNamespace(ctx, c, namespace)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	keycloakURL := strings.TrimSpace(ns.Annotations[NamespaceKeycloakURLAnnotation])
+	realm := strings.TrimSpace(ns.Annotations[NamespaceKeycloakRealmAnnotation])
+	if keycloakURL == "" && realm == "" {
+		return nil, nil
+	}
+	if keycloakURL == "" || realm == "" {
+		return nil, fmt.Errorf("namespace %s needs both %s and %s annotations", namespace,
+			NamespaceKeycloakURLAnnotation, NamespaceKeycloakRealmAnnotation)
+	}
+	if parsed, err := url.Parse(keycloakURL); err != nil || parsed.Host == "" ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid %s annotation on namespace %s: %q is not an http(s) URL",
+			NamespaceKeycloakURLAnnotation, namespace, keycloakURL)
+	}
+	return &IDPProfile{
+		KeycloakURL:   keycloakURL,
+		KeycloakRealm: realm,
+		TokenURL:      realmTokenURL(keycloakURL, realm),
+	}, nil
+}
+
+// IDPProfileFor returns the profile requested by the pod template label or, failing that,
+// the workload label; empty means the namespace ConfigMaps apply unchanged
+func IDPProfileFor(podMeta *metav1.ObjectMeta, labels map[string]string) string {
+	if podMeta != nil {
+		if name, ok := podMeta.Labels[IDPProfileLabel]; ok {
+			return name
+		}
+	}
+	return labels[IDPProfileLabel]
+}
+
+// InjectIDPProfile points client-registration and the envoy-proxy token exchange at the
+// named profile, replacing the ConfigMap references for the fields the profile sets
+func (m *PodMutator) InjectIDPProfile(podSpec *corev1.PodSpec, name string) error {
+	profile, ok := m.IDPProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown IdP profile %q in %s label", name, IDPProfileLabel)
+	}
+	applyIDPProfile(podSpec, profile)
+	mutatorLog.Info("Applied IdP profile", "profile", name, "realm", profile.KeycloakRealm)
+	return nil
+}
+
+// InjectNamespaceIDPProfile applies the Keycloak annotations of the namespace, if any.
+// It runs before InjectIDPProfile, so a workload's kagenti.io/idp label still wins.
+func (m *PodMutator) InjectNamespaceIDPProfile(ctx context.Context, podSpec *corev1.PodSpec, namespace string) error {
+	if m.Client == nil {
+		return nil
+	}
+	profile, err := NamespaceIDPProfile(ctx, m.namespaceReader(), namespace)
+	if err != nil || profile == nil {
+		return err
+	}
+	applyIDPProfile(podSpec, *profile)
+	mutatorLog.Info("Applied namespace Keycloak annotations", "namespace", namespace, "realm", profile.KeycloakRealm)
+	return nil
+}
+
+func applyIDPProfile(podSpec *corev1.PodSpec, profile IDPProfile) {
+	for i := range podSpec.InitContainers {
+		container := &podSpec.InitContainers[i]
+		switch container.Name {
+		case ClientRegistrationContainerName, InboundAuthContainerName:
+			setEnv(container, "KEYCLOAK_URL", profile.KeycloakURL)
+			setEnv(container, "KEYCLOAK_REALM", profile.KeycloakRealm)
+		case EnvoyProxyContainerName:
+			setEnv(container, "TOKEN_URL", profile.TokenURL)
+			setEnv(container, "TARGET_AUDIENCE", profile.Audience)
+			setEnv(container, "TARGET_SCOPES", profile.Scopes)
+		}
+	}
+}
+
+// setEnv replaces a variable (including one taken from a ConfigMap) with a literal value;
+// an empty value leaves the container unchanged
+func setEnv(container *corev1.Container, name, value string) {
+	if value == "" {
+		return
+	}
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i] = corev1.EnvVar{Name: name, Value: value}
+			return
+		}
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: value})
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("IdP profiles", func() {
+	writeProfiles := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "idp-profiles.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	envOf := func(containers []corev1.Container, container, name string) *corev1.EnvVar {
+		for _, c := range containers {
+			if c.Name != container {
+				continue
+			}
+			for i := range c.Env {
+				if c.Env[i].Name == name {
+					return &c.Env[i]
+				}
+			}
+		}
+		return nil
+	}
+
+	It("loads profiles and derives the token URL", func() {
+		profiles, err := LoadIDPProfiles(writeProfiles(`
+profiles:
+  corp:
+    keycloakURL: https://sso.example.com/
+    keycloakRealm: corp
+    audience: corp-api
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profiles).To(HaveKeyWithValue("corp", IDPProfile{
+			KeycloakURL:   "https://sso.example.com/",
+			KeycloakRealm: "corp",
+			TokenURL:      "https://sso.example.com/realms/corp/protocol/openid-connect/token",
+			Audience:      "corp-api",
+		}))
+	})
+
+	It("rejects incomplete profiles and unknown fields", func() {
+		_, err := LoadIDPProfiles(writeProfiles("profiles:\n  corp:\n    keycloakRealm: corp\n"))
+		Expect(err).To(MatchError(ContainSubstring("keycloakURL")))
+		_, err = LoadIDPProfiles(writeProfiles("profiles:\n  corp:\n    realm: corp\n"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("wires the selected profile into client-registration and envoy-proxy", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.IDPProfiles = IDPProfiles{"corp": {
+			KeycloakURL:   "https://sso.example.com",
+			KeycloakRealm: "corp",
+			TokenURL:      "https://sso.example.com/realms/corp/protocol/openid-connect/token",
+			Audience:      "corp-api",
+		}}
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Labels = map[string]string{IDPProfileLabel: "corp"}
+
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue, IDPProfileLabel: "other"})
+		Expect(err).NotTo(HaveOccurred())
+
+		initContainers := podTemplate.Spec.InitContainers
+		Expect(envOf(initContainers, ClientRegistrationContainerName, "KEYCLOAK_REALM")).To(Equal(&corev1.EnvVar{Name: "KEYCLOAK_REALM", Value: "corp"}))
+		Expect(envOf(initContainers, EnvoyProxyContainerName, "TARGET_AUDIENCE")).To(Equal(&corev1.EnvVar{Name: "TARGET_AUDIENCE", Value: "corp-api"}))
+		// Fields the profile leaves unset still come from the ConfigMaps
+		Expect(envOf(initContainers, EnvoyProxyContainerName, "TARGET_SCOPES").ValueFrom).NotTo(BeNil())
+		Expect(envOf(initContainers, ClientRegistrationContainerName, "KEYCLOAK_ADMIN_PASSWORD").ValueFrom).NotTo(BeNil())
+	})
+
+	It("applies the Keycloak annotations of the namespace below the workload's profile", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1", Annotations: map[string]string{
+			NamespaceKeycloakURLAnnotation:   "https://sso.team1.example.com/",
+			NamespaceKeycloakRealmAnnotation: "team1",
+		}}}
+		mutator := NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace).Build(), true)
+		mutator.IDPProfiles = IDPProfiles{"corp": {KeycloakURL: "https://sso.example.com", KeycloakRealm: "corp"}}
+		inject := func(labels map[string]string) []corev1.Container {
+			podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+			_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "team1", "app", labels)
+			Expect(err).NotTo(HaveOccurred())
+			return podTemplate.Spec.InitContainers
+		}
+
+		initContainers := inject(map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue})
+		Expect(envOf(initContainers, ClientRegistrationContainerName, "KEYCLOAK_URL").Value).To(Equal("https://sso.team1.example.com/"))
+		Expect(envOf(initContainers, ClientRegistrationContainerName, "KEYCLOAK_REALM").Value).To(Equal("team1"))
+		Expect(envOf(initContainers, EnvoyProxyContainerName, "TOKEN_URL").Value).To(
+			Equal("https://sso.team1.example.com/realms/team1/protocol/openid-connect/token"))
+		Expect(envOf(initContainers, EnvoyProxyContainerName, "TARGET_AUDIENCE").ValueFrom).NotTo(BeNil())
+
+		initContainers = inject(map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue, IDPProfileLabel: "corp"})
+		Expect(envOf(initContainers, ClientRegistrationContainerName, "KEYCLOAK_REALM").Value).To(Equal("corp"))
+	})
+
+	It("rejects incomplete namespace Keycloak annotations", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "realm-only", Annotations: map[string]string{
+				NamespaceKeycloakRealmAnnotation: "team1",
+			}}},
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "bad-url", Annotations: map[string]string{
+				NamespaceKeycloakURLAnnotation: "sso.example.com", NamespaceKeycloakRealmAnnotation: "team1",
+			}}},
+		).Build()
+
+		_, err := NamespaceIDPProfile(context.Background(), c, "realm-only")
+		Expect(err).To(MatchError(ContainSubstring(NamespaceKeycloakURLAnnotation)))
+		_, err = NamespaceIDPProfile(context.Background(), c, "bad-url")
+		Expect(err).To(MatchError(ContainSubstring("not an http(s) URL")))
+		Expect(NamespaceIDPProfile(context.Background(), c, "missing")).To(BeNil())
+	})
+
+	It("fails the mutation for unknown profiles", func() {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "ns", "app",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue, IDPProfileLabel: "missing"})
+		Expect(err).To(MatchError(ContainSubstring(`"missing"`)))
+	})
+})
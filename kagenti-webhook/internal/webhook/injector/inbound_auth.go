@@ -0,0 +1,229 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// InboundAuthAnnotation names the application port, by number or container port name,
+	// that the inbound-auth sidecar protects. Without it no inbound-auth sidecar is injected.
+	InboundAuthAnnotation = "kagenti.io/inbound-auth"
+
+	InboundAuthContainerName = "inbound-auth"
+	DefaultInboundAuthImage  = "localhost/inbound-auth:latest"
+
+	// InboundAuthPort is where inbound-auth listens; Services send traffic to its
+	// "inbound-auth" port instead of the application port
+	InboundAuthPort     = int32(15130)
+	InboundAuthPortName = "inbound-auth"
+
+	// inboundAuthHealthPath answers without a token, for the readiness probe
+	inboundAuthHealthPath = "/inbound-auth/healthz"
+	// inboundAuthProbePrefix starts the paths that application probes are rewritten to;
+	// inbound-auth forwards them to the application without a token
+	inboundAuthProbePrefix = "/inbound-auth/probe/"
+)
+
+// InboundAuthTargetFor returns the application port named by the kagenti.io/inbound-auth
+// annotation, 0 without the annotation. A name is looked up in the ports of the
+// application containers.
+func InboundAuthTargetFor(podSpec *corev1.PodSpec, annotations map[string]string) (int32, error) {
+	value, ok := annotations[InboundAuthAnnotation]
+	if !ok {
+		return 0, nil
+	}
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		port = int64(namedContainerPort(podSpec, value))
+		if port == 0 {
+			return 0, fmt.Errorf("invalid %s annotation: no application container port named %q", InboundAuthAnnotation, value)
+		}
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s annotation: port %d is out of range", InboundAuthAnnotation, port)
+	}
+	if int32(port) == InboundAuthPort {
+		return 0, fmt.Errorf("invalid %s annotation: port %d is the inbound-auth listener", InboundAuthAnnotation, port)
+	}
+	return int32(port), nil
+}
+
+func namedContainerPort(podSpec *corev1.PodSpec, name string) int32 {
+	for _, container := range podSpec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return port.ContainerPort
+			}
+		}
+	}
+	return 0
+}
+
+// BuildInboundAuthContainer creates the inbound-auth sidecar, which validates the bearer
+// JWT of every request against the realm's signing keys and forwards only authenticated
+// requests to the application on target. Tokens must name the workload's client ID as
+// audience unless INBOUND_AUDIENCE says otherwise. It runs as the Envoy user, so fetching
+// the keys is not redirected through Envoy.
+func BuildInboundAuthContainer(target int32) corev1.Container {
+	builderLog.Info("building InboundAuth Container", "target", target)
+
+	optionalConfig := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "authbridge-config"},
+					Key:                  key,
+					Optional:             ptr.To(true),
+				},
+			},
+		}
+	}
+	return corev1.Container{
+		Name:            InboundAuthContainerName,
+		Image:           DefaultInboundAuthImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		// Native sidecar: ready before the application starts and does not block Job completion
+		RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("32Mi"),
+			},
+		},
+		Ports: []corev1.ContainerPort{{
+			Name:          InboundAuthPortName,
+			ContainerPort: InboundAuthPort,
+			Protocol:      corev1.ProtocolTCP,
+		}},
+		Env: []corev1.EnvVar{
+			{Name: "LISTEN_ADDR", Value: fmt.Sprintf(":%d", InboundAuthPort)},
+			{Name: "UPSTREAM_URL", Value: fmt.Sprintf("http://127.0.0.1:%d", target)},
+			{
+				Name: "KEYCLOAK_URL",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "environments"},
+						Key:                  "KEYCLOAK_URL",
+						Optional:             ptr.To(true),
+					},
+				},
+			},
+			{
+				Name: "KEYCLOAK_REALM",
+				ValueFrom: &corev1.EnvVarSource{
+					ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "environments"},
+						Key:                  "KEYCLOAK_REALM",
+						Optional:             ptr.To(true),
+					},
+				},
+			},
+			// Override the keys and issuer derived from the realm, and restrict the audience
+			optionalConfig("JWKS_URL", "INBOUND_JWKS_URL"),
+			optionalConfig("ISSUER", "INBOUND_ISSUER"),
+			optionalConfig("AUDIENCE", "INBOUND_AUDIENCE"),
+			// "true" forwards CORS preflights to an application that answers them
+			optionalConfig("PASS_CORS_PREFLIGHTS", "INBOUND_PASS_CORS_PREFLIGHTS"),
+			// The default audience, written by client-registration before the sidecar starts
+			{Name: "CLIENT_ID_FILE", Value: "/shared/client-id.txt"},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "shared-data", MountPath: "/shared", ReadOnly: true},
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: inboundAuthHealthPath,
+				Port: intstr.FromString(InboundAuthPortName),
+			}},
+			PeriodSeconds:  10,
+			TimeoutSeconds: 2,
+		},
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  ptr.To(int64(EnvoyProxyUID)),
+			RunAsGroup: ptr.To(int64(EnvoyProxyUID)),
+		},
+	}
+}
+
+// InjectInboundAuth adds the inbound-auth sidecar in front of the application port target;
+// 0 or an existing inbound-auth container leaves the pod spec unchanged
+func (m *PodMutator) InjectInboundAuth(podSpec *corev1.PodSpec, target int32) {
+	if target == 0 || findContainer(podSpec, InboundAuthContainerName) != nil {
+		return
+	}
+	sidecar := BuildInboundAuthContainer(target)
+	if probePaths := rewriteAppProbes(podSpec, target); len(probePaths) > 0 {
+		value, _ := json.Marshal(probePaths)
+		sidecar.Env = append(sidecar.Env, corev1.EnvVar{Name: "PROBE_PATHS", Value: string(value)})
+	}
+	podSpec.InitContainers = append(podSpec.InitContainers, m.SidecarConfig.apply(sidecar))
+	mutatorLog.Info("Injected inbound-auth sidecar", "target", target)
+}
+
+// rewriteAppProbes points the HTTP probes of the application containers on target at
+// inbound-auth, since kubelet sends no token and the redirected probes would fail with 401.
+// Each probe gets its own pass-through path; the returned map, the sidecar's PROBE_PATHS,
+// leads from it to the original path. Only these paths reach the application without a
+// token, so the rest of the application stays protected.
+func rewriteAppProbes(podSpec *corev1.PodSpec, target int32) map[string]string {
+	probePaths := map[string]string{}
+	for i := range podSpec.Containers {
+		container := &podSpec.Containers[i]
+		for kind, probe := range map[string]*corev1.Probe{
+			"startup":   container.StartupProbe,
+			"readiness": container.ReadinessProbe,
+			"liveness":  container.LivenessProbe,
+		} {
+			if probe == nil || probe.HTTPGet == nil || probe.HTTPGet.Scheme == corev1.URISchemeHTTPS ||
+				probePort(container, probe.HTTPGet.Port) != target {
+				continue
+			}
+			path := inboundAuthProbePrefix + container.Name + "/" + kind
+			probePaths[path] = probe.HTTPGet.Path
+			probe.HTTPGet.Path = path
+			probe.HTTPGet.Port = intstr.FromInt32(InboundAuthPort)
+		}
+	}
+	return probePaths
+}
+
+// probePort resolves the port of a container's probe, which may name a container port
+func probePort(container *corev1.Container, port intstr.IntOrString) int32 {
+	if port.Type == intstr.Int {
+		return port.IntVal
+	}
+	for _, containerPort := range container.Ports {
+		if containerPort.Name == port.StrVal {
+			return containerPort.ContainerPort
+		}
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+var _ = Describe("Inbound auth sidecar", func() {
+	injectTemplate := func(annotations map[string]string) (*corev1.PodTemplateSpec, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8000}},
+		}}}}
+		podTemplate.Annotations = annotations
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+		})
+		return podTemplate, err
+	}
+	inject := func(annotations map[string]string) (*corev1.PodSpec, error) {
+		podTemplate, err := injectTemplate(annotations)
+		return &podTemplate.Spec, err
+	}
+
+	It("is not injected without the annotation", func() {
+		podSpec, err := inject(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, InboundAuthContainerName)).To(BeNil())
+	})
+
+	It("forwards to the application port named by the annotation", func() {
+		for _, value := range []string{"8000", "http"} {
+			podSpec, err := inject(map[string]string{InboundAuthAnnotation: value})
+			Expect(err).NotTo(HaveOccurred())
+			sidecar := findContainer(podSpec, InboundAuthContainerName)
+			Expect(sidecar).NotTo(BeNil(), value)
+			Expect(*sidecar.RestartPolicy).To(Equal(corev1.ContainerRestartPolicyAlways))
+			Expect(sidecar.Env).To(ContainElement(corev1.EnvVar{Name: "UPSTREAM_URL", Value: "http://127.0.0.1:8000"}))
+			Expect(sidecar.Ports).To(ConsistOf(HaveField("ContainerPort", InboundAuthPort)))
+			Expect(*sidecar.SecurityContext.RunAsUser).To(Equal(int64(EnvoyProxyUID)))
+		}
+	})
+
+	It("requires the workload's client ID as audience unless INBOUND_AUDIENCE is set", func() {
+		podSpec, err := inject(map[string]string{InboundAuthAnnotation: "http"})
+		Expect(err).NotTo(HaveOccurred())
+		sidecar := findContainer(podSpec, InboundAuthContainerName)
+		Expect(sidecar.Env).To(ContainElements(
+			HaveField("Name", "AUDIENCE"),
+			corev1.EnvVar{Name: "CLIENT_ID_FILE", Value: "/shared/client-id.txt"},
+		))
+		Expect(sidecar.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "shared-data", MountPath: "/shared", ReadOnly: true}))
+		Expect(podSpec.Volumes).To(ContainElement(HaveField("Name", "shared-data")))
+	})
+
+	It("redirects inbound traffic for the application port to the sidecar", func() {
+		podSpec, err := inject(map[string]string{InboundAuthAnnotation: "http"})
+		Expect(err).NotTo(HaveOccurred())
+		proxyInit := findContainer(podSpec, ProxyInitContainerName)
+		Expect(proxyInit).NotTo(BeNil())
+		Expect(proxyInit.Env).To(ContainElements(
+			corev1.EnvVar{Name: "INBOUND_AUTH_PORT", Value: "8000"},
+			corev1.EnvVar{Name: "INBOUND_AUTH_PROXY_PORT", Value: "15130"},
+		))
+
+		podTemplate, err := injectTemplate(map[string]string{InboundAuthAnnotation: "http", EgressModeAnnotation: string(EgressModeCNI)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(podTemplate.Annotations[RedirectEnvAnnotation]).To(ContainSubstring(`"INBOUND_AUTH_PORT":"8000"`))
+
+		podSpec, err = inject(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, ProxyInitContainerName).Env).NotTo(ContainElement(HaveField("Name", "INBOUND_AUTH_PORT")))
+	})
+
+	It("is rejected in egress modes without iptables", func() {
+		for _, mode := range []EgressMode{EgressModeProxyEnv, EgressModeIstio} {
+			_, err := inject(map[string]string{InboundAuthAnnotation: "http", EgressModeAnnotation: string(mode)})
+			Expect(err).To(MatchError(ContainSubstring(InboundAuthAnnotation)), string(mode))
+		}
+	})
+
+	It("drops its probe with the other sidecar probes", func() {
+		podSpec, err := inject(map[string]string{InboundAuthAnnotation: "http", SidecarProbesAnnotation: "false"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, InboundAuthContainerName).ReadinessProbe).To(BeNil())
+	})
+
+	It("rewrites the application's HTTP probes on the protected port to pass through the sidecar", func() {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Ports: []corev1.ContainerPort{
+				{Name: "http", ContainerPort: 8000},
+				{Name: "metrics", ContainerPort: 9090},
+			},
+			ReadinessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/healthz?full=1", Port: intstr.FromString("http"),
+			}}},
+			LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/livez", Port: intstr.FromInt32(8000),
+			}}},
+			StartupProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{
+				Path: "/started", Port: intstr.FromString("metrics"),
+			}}},
+		}}}}
+		podTemplate.Annotations = map[string]string{InboundAuthAnnotation: "http"}
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		app := podTemplate.Spec.Containers[0]
+		Expect(app.ReadinessProbe.HTTPGet.Path).To(Equal("/inbound-auth/probe/app/readiness"))
+		Expect(app.ReadinessProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(InboundAuthPort)))
+		Expect(app.LivenessProbe.HTTPGet.Path).To(Equal("/inbound-auth/probe/app/liveness"))
+		Expect(app.LivenessProbe.HTTPGet.Port).To(Equal(intstr.FromInt32(InboundAuthPort)))
+		// Probes on other ports are not redirected and keep going to the application
+		Expect(app.StartupProbe.HTTPGet.Path).To(Equal("/started"))
+		Expect(app.StartupProbe.HTTPGet.Port).To(Equal(intstr.FromString("metrics")))
+
+		sidecar := findContainer(&podTemplate.Spec, InboundAuthContainerName)
+		Expect(sidecar.Env).To(ContainElement(corev1.EnvVar{
+			Name:  "PROBE_PATHS",
+			Value: `{"/inbound-auth/probe/app/liveness":"/livez","/inbound-auth/probe/app/readiness":"/healthz?full=1"}`,
+		}))
+	})
+
+	It("passes no probe paths when the application has no HTTP probes on the protected port", func() {
+		podSpec, err := inject(map[string]string{InboundAuthAnnotation: "http"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(findContainer(podSpec, InboundAuthContainerName).Env).NotTo(ContainElement(HaveField("Name", "PROBE_PATHS")))
+	})
+
+	It("rejects unknown and reserved ports", func() {
+		for _, value := range []string{"grpc", "0", "70000", "15130"} {
+			_, err := inject(map[string]string{InboundAuthAnnotation: value})
+			Expect(err).To(MatchError(ContainSubstring(InboundAuthAnnotation)), value)
+		}
+	})
+})
@@ -0,0 +1,144 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/version"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InjectionStatusAnnotation is stamped on the pod template of mutated workloads
+	InjectionStatusAnnotation = "kagenti.io/status"
+	InjectionStatusInjected   = "injected"
+
+	// InjectionHashAnnotation carries a hash of the injected configuration so that
+	// stale injections (e.g. older sidecar images) can be detected later on
+	InjectionHashAnnotation = "kagenti.io/injection-hash"
+
+	// InjectorVersionAnnotation records the webhook build that injected the pod template
+	InjectorVersionAnnotation = "kagenti.io/injector-version"
+
+	// AuthBridgeLabel marks injected pod templates, so NetworkPolicies can select the pods
+	// that run the sidecars, e.g. to allow egress to Keycloak and SPIRE from them only
+	AuthBridgeLabel         = "kagenti.io/authbridge"
+	AuthBridgeLabelInjected = "injected"
+
+	// InjectionTemplateVersion must be bumped whenever the shape of the injected
+	// containers or volumes changes in a way that existing workloads should pick up
+	InjectionTemplateVersion = "3"
+)
+
+var injectorVersion = version.Get().Short()
+
+// injectedContainerNames lists every container (regular or init) the AuthBridge injection may add
+var injectedContainerNames = []string{
+	ProxyInitContainerName,
+	SpiffeHelperContainerName,
+	ClientRegistrationContainerName,
+	CredentialHygieneContainerName,
+	EnvoyProxyContainerName,
+	InboundAuthContainerName,
+}
+
+// IsInjected reports whether the pod template metadata carries the injected status annotation
+func IsInjected(meta *metav1.ObjectMeta) bool {
+	if meta == nil || meta.Annotations == nil {
+		return false
+	}
+	return meta.Annotations[InjectionStatusAnnotation] == InjectionStatusInjected
+}
+
+// ComputeInjectionHash returns a short, stable hash over the template version, the SPIRE
+// setting and the images of the injected containers found in the pod spec.
+func ComputeInjectionHash(podSpec *corev1.PodSpec, spireEnabled bool) string {
+	images := map[string]string{}
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for _, c := range containers {
+			for _, name := range injectedContainerNames {
+				if c.Name == name {
+					images[c.Name] = c.Image
+				}
+			}
+		}
+	}
+
+	parts := []string{
+		"template=" + InjectionTemplateVersion,
+		fmt.Sprintf("spire=%t", spireEnabled),
+	}
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+images[name])
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, ";")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StampInjectionStatus marks the pod template as injected and records the configuration hash
+// and the webhook version
+func StampInjectionStatus(meta *metav1.ObjectMeta, podSpec *corev1.PodSpec, spireEnabled bool) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[InjectionStatusAnnotation] = InjectionStatusInjected
+	meta.Annotations[InjectionHashAnnotation] = ComputeInjectionHash(podSpec, spireEnabled)
+	meta.Annotations[InjectorVersionAnnotation] = injectorVersion
+	LabelInjected(meta)
+}
+
+// LabelInjected adds the kagenti.io/authbridge=injected label to the pod template
+func LabelInjected(meta *metav1.ObjectMeta) {
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[AuthBridgeLabel] = AuthBridgeLabelInjected
+}
+
+// RemoveInjection strips the injected containers and the status annotations so that the
+// template can be injected again with the current configuration. Injected volumes, env
+// and pull secrets are kept; injection does not duplicate them.
+func RemoveInjection(podTemplate *corev1.PodTemplateSpec) {
+	keep := func(containers []corev1.Container) []corev1.Container {
+		out := containers[:0]
+		for _, c := range containers {
+			if !slices.Contains(injectedContainerNames, c.Name) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	podTemplate.Spec.InitContainers = keep(podTemplate.Spec.InitContainers)
+	podTemplate.Spec.Containers = keep(podTemplate.Spec.Containers)
+	delete(podTemplate.Annotations, InjectionStatusAnnotation)
+	delete(podTemplate.Annotations, InjectionHashAnnotation)
+	delete(podTemplate.Annotations, InjectorVersionAnnotation)
+	delete(podTemplate.Labels, AuthBridgeLabel)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/version"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Injection status", func() {
+	var (
+		mutator     *PodMutator
+		podTemplate *corev1.PodTemplateSpec
+		labels      map[string]string
+	)
+
+	BeforeEach(func() {
+		mutator = NewPodMutator(nil, true)
+		podTemplate = &corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+			},
+		}
+		labels = map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+	})
+
+	It("stamps the status and hash annotations on the pod template", func() {
+		mutated, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutated).To(BeTrue())
+
+		Expect(IsInjected(&podTemplate.ObjectMeta)).To(BeTrue())
+		Expect(podTemplate.Annotations[InjectionHashAnnotation]).To(
+			Equal(ComputeInjectionHash(&podTemplate.Spec, false)))
+		Expect(podTemplate.Annotations[InjectorVersionAnnotation]).To(Equal(version.Get().Short()))
+		Expect(podTemplate.Labels).To(HaveKeyWithValue(AuthBridgeLabel, AuthBridgeLabelInjected))
+	})
+
+	It("does not report un-annotated templates as injected", func() {
+		Expect(IsInjected(&podTemplate.ObjectMeta)).To(BeFalse())
+	})
+
+	It("produces a different hash when an injected image changes", func() {
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		before := ComputeInjectionHash(&podTemplate.Spec, false)
+
+		for i := range podTemplate.Spec.InitContainers {
+			if podTemplate.Spec.InitContainers[i].Name == EnvoyProxyContainerName {
+				podTemplate.Spec.InitContainers[i].Image = "localhost/envoy-with-processor:v2"
+			}
+		}
+		Expect(ComputeInjectionHash(&podTemplate.Spec, false)).NotTo(Equal(before))
+	})
+
+	It("ignores application containers when hashing", func() {
+		before := ComputeInjectionHash(&podTemplate.Spec, true)
+		podTemplate.Spec.Containers[0].Image = "app:v2"
+		Expect(ComputeInjectionHash(&podTemplate.Spec, true)).To(Equal(before))
+	})
+})
+
+var _ = Describe("RemoveInjection", func() {
+	It("restores a template that can be injected again without duplicates", func() {
+		mutator := NewPodMutator(nil, true)
+		labels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+		}}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		injected := podTemplate.DeepCopy()
+
+		RemoveInjection(podTemplate)
+		Expect(IsInjected(&podTemplate.ObjectMeta)).To(BeFalse())
+		Expect(podTemplate.Annotations).NotTo(HaveKey(InjectorVersionAnnotation))
+		Expect(podTemplate.Labels).NotTo(HaveKey(AuthBridgeLabel))
+		Expect(podTemplate.Spec.InitContainers).To(BeEmpty())
+		Expect(podTemplate.Spec.Containers).To(HaveLen(1))
+
+		_, err = mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(podTemplate).To(Equal(injected))
+	})
+})
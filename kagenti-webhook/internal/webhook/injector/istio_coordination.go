@@ -0,0 +1,216 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Istio sidecar exclusion annotations, merged with the ports a workload already lists
+	IstioExcludeOutboundPortsAnnotation = "traffic.sidecar.istio.io/excludeOutboundPorts"
+	IstioExcludeInboundPortsAnnotation  = "traffic.sidecar.istio.io/excludeInboundPorts"
+	// AmbientBypassInboundCaptureAnnotation leaves inbound traffic to proxy-init's rules in
+	// ambient mode; ztunnel still captures outbound traffic
+	AmbientBypassInboundCaptureAnnotation = "ambient.istio.io/bypass-inbound-capture"
+
+	// Namespace and pod labels that put a workload in the mesh
+	IstioInjectionLabel     = "istio-injection"
+	IstioRevisionLabel      = "istio.io/rev"
+	IstioDataplaneModeLabel = "istio.io/dataplane-mode"
+)
+
+// IstioMesh is how Istio handles the traffic of a pod
+type IstioMesh string
+
+const (
+	// IstioMeshNone: the pod is not in the mesh
+	IstioMeshNone IstioMesh = ""
+	// IstioMeshSidecar: istio-init and the istio-proxy sidecar capture the traffic
+	IstioMeshSidecar IstioMesh = "sidecar"
+	// IstioMeshAmbient: the node's ztunnel captures the traffic
+	IstioMeshAmbient IstioMesh = "ambient"
+)
+
+// IstioMeshFor follows Istio's own rules: the sidecar.istio.io/inject label or annotation
+// of the pod template wins over the namespace's istio-injection and istio.io/rev labels,
+// and a sidecar takes the pod out of ambient mode. A pod template istio.io/dataplane-mode
+// label wins over the namespace's. namespace may be nil.
+func IstioMeshFor(namespace *corev1.Namespace, podMeta *metav1.ObjectMeta) IstioMesh {
+	var nsLabels map[string]string
+	if namespace != nil {
+		nsLabels = namespace.Labels
+	}
+
+	sidecar := nsLabels[IstioInjectionLabel] == "enabled"
+	if _, ok := nsLabels[IstioRevisionLabel]; ok && nsLabels[IstioInjectionLabel] != "disabled" {
+		sidecar = true
+	}
+	for _, values := range []map[string]string{podMeta.Annotations, podMeta.Labels} {
+		if value, ok := values[IstioSidecarInjectAnnotation]; ok {
+			sidecar = value == "true"
+		}
+	}
+	if sidecar {
+		return IstioMeshSidecar
+	}
+
+	mode := nsLabels[IstioDataplaneModeLabel]
+	if value, ok := podMeta.Labels[IstioDataplaneModeLabel]; ok {
+		mode = value
+	}
+	if mode == "ambient" && podMeta.Annotations[AmbientRedirectionAnnotation] != "disabled" {
+		return IstioMeshAmbient
+	}
+	return IstioMeshNone
+}
+
+// ParsePorts validates a list of ports, e.g. IstioExcludeOutboundPorts
+func ParsePorts(values []string) ([]int32, error) {
+	var ports []int32
+	for _, value := range values {
+		port, err := parsePort(value)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+// InjectIstioExclusions keeps Istio from capturing the traffic the AuthBridge sidecars
+// handle themselves. With an Istio sidecar, the Keycloak port client-registration talks to
+// and IstioExcludeOutboundPorts are excluded from outbound capture, and the inbound ports
+// proxy-init captures from inbound capture. In ambient mode, which has no port exclusions,
+// ztunnel skips inbound capture when proxy-init captures inbound traffic. Lookup errors are
+// logged and leave the pod template unchanged.
+func (m *PodMutator) InjectIstioExclusions(ctx context.Context, podTemplate *corev1.PodTemplateSpec, namespace string, egressMode EgressMode) {
+	var ns *corev1.Namespace
+	if m.Client != nil {
+		var err error
+		if ns, err = getNamespace(ctx, m.namespaceReader(), namespace); client.IgnoreNotFound(err) != nil {
+			mutatorLog.Error(err, "Failed to look up the namespace for Istio exclusions", "namespace", namespace)
+			return
+		}
+	}
+	mesh := IstioMeshFor(ns, &podTemplate.ObjectMeta)
+	if mesh == IstioMeshNone {
+		return
+	}
+
+	var inboundPorts []string
+	if egressMode == EgressModeIPTables || egressMode == EgressModeCNI {
+		// already validated by injectRedirection
+		if cfg, err := ProxyInitConfigFromAnnotations(m.ProxyInitDefaults, podTemplate.Annotations, &podTemplate.Spec); err == nil {
+			inboundPorts = cfg.IncludeInboundPorts
+		}
+	}
+
+	meta := &podTemplate.ObjectMeta
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	switch mesh {
+	case IstioMeshSidecar:
+		var outbound []string
+		if port := m.keycloakPort(ctx, &podTemplate.Spec, namespace); port != "" {
+			outbound = append(outbound, port)
+		}
+		for _, port := range m.IstioExcludeOutboundPorts {
+			outbound = append(outbound, strconv.Itoa(int(port)))
+		}
+		mergePortAnnotation(meta, IstioExcludeOutboundPortsAnnotation, outbound)
+		if !slices.Contains(inboundPorts, "*") {
+			mergePortAnnotation(meta, IstioExcludeInboundPortsAnnotation, inboundPorts)
+		}
+	case IstioMeshAmbient:
+		if len(inboundPorts) > 0 {
+			meta.Annotations[AmbientBypassInboundCaptureAnnotation] = "true"
+		}
+	}
+	mutatorLog.Info("Coordinated with Istio", "namespace", namespace, "mesh", mesh,
+		"excludeOutboundPorts", meta.Annotations[IstioExcludeOutboundPortsAnnotation],
+		"excludeInboundPorts", meta.Annotations[IstioExcludeInboundPortsAnnotation])
+}
+
+// keycloakPort is the port of the KEYCLOAK_URL client-registration uses, read from the
+// environments ConfigMap unless an IdP profile set it; empty if unknown
+func (m *PodMutator) keycloakPort(ctx context.Context, podSpec *corev1.PodSpec, namespace string) string {
+	container := findContainer(podSpec, ClientRegistrationContainerName)
+	if container == nil {
+		return ""
+	}
+	for _, env := range container.Env {
+		if env.Name != "KEYCLOAK_URL" {
+			continue
+		}
+		keycloakURL := env.Value
+		if ref := env.ValueFrom; ref != nil && ref.ConfigMapKeyRef != nil && m.Client != nil {
+			cm := &corev1.ConfigMap{}
+			key := client.ObjectKey{Namespace: namespace, Name: ref.ConfigMapKeyRef.Name}
+			// a missing ConfigMap is reported by CheckRequiredConfigMaps
+			if err := m.Client.Get(ctx, key, cm); client.IgnoreNotFound(err) != nil {
+				mutatorLog.Error(err, "Failed to read KEYCLOAK_URL for Istio exclusions",
+					"namespace", namespace, "configMap", key.Name)
+				return ""
+			}
+			keycloakURL = cm.Data[ref.ConfigMapKeyRef.Key]
+		}
+		return urlPort(keycloakURL)
+	}
+	return ""
+}
+
+// urlPort returns the explicit port of rawURL or the default port of its scheme
+func urlPort(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	if port := parsed.Port(); port != "" {
+		return port
+	}
+	switch parsed.Scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// mergePortAnnotation adds ports to the comma-separated list of the annotation, keeping
+// the ports already listed
+func mergePortAnnotation(meta *metav1.ObjectMeta, annotation string, ports []string) {
+	merged := splitAnnotationList(meta.Annotations[annotation])
+	for _, port := range ports {
+		if !slices.Contains(merged, port) {
+			merged = append(merged, port)
+		}
+	}
+	if len(merged) > 0 {
+		meta.Annotations[annotation] = strings.Join(merged, ",")
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Istio exclusions", func() {
+	inject := func(nsLabels, podLabels, annotations map[string]string) map[string]string {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Labels: nsLabels}}
+		environments := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: EnvironmentsConfigMap, Namespace: "ns"},
+			Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak-service.keycloak.svc:8080"},
+		}
+		mutator := NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace, environments).Build(), true)
+		mutator.IstioExcludeOutboundPorts = []int32{8081}
+
+		labels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+		for k, v := range podLabels {
+			labels[k] = v
+		}
+		podTemplate := &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: annotations},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		}
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+		return podTemplate.Annotations
+	}
+
+	It("leaves workloads outside the mesh alone", func() {
+		annotations := inject(nil, nil, nil)
+		Expect(annotations).NotTo(HaveKey(IstioExcludeOutboundPortsAnnotation))
+		Expect(annotations).NotTo(HaveKey(AmbientBypassInboundCaptureAnnotation))
+	})
+
+	It("excludes the Keycloak and configured ports from the Istio sidecar", func() {
+		annotations := inject(map[string]string{IstioInjectionLabel: "enabled"}, nil, map[string]string{
+			IstioExcludeOutboundPortsAnnotation: "5432",
+			IncludeInboundPortsAnnotation:       "8000",
+		})
+		Expect(annotations).To(HaveKeyWithValue(IstioExcludeOutboundPortsAnnotation, "5432,8080,8081"))
+		Expect(annotations).To(HaveKeyWithValue(IstioExcludeInboundPortsAnnotation, "8000"))
+	})
+
+	It("follows the sidecar.istio.io/inject annotation of the pod template", func() {
+		annotations := inject(map[string]string{IstioRevisionLabel: "canary"}, nil,
+			map[string]string{IstioSidecarInjectAnnotation: "false"})
+		Expect(annotations).NotTo(HaveKey(IstioExcludeOutboundPortsAnnotation))
+
+		annotations = inject(nil, nil, map[string]string{IstioSidecarInjectAnnotation: "true"})
+		Expect(annotations).To(HaveKeyWithValue(IstioExcludeOutboundPortsAnnotation, "8080,8081"))
+	})
+
+	It("bypasses ztunnel's inbound capture when proxy-init captures inbound traffic", func() {
+		ambient := map[string]string{IstioDataplaneModeLabel: "ambient"}
+		Expect(inject(ambient, nil, nil)).NotTo(HaveKey(AmbientBypassInboundCaptureAnnotation))
+
+		annotations := inject(ambient, nil, map[string]string{IncludeInboundPortsAnnotation: "*"})
+		Expect(annotations).To(HaveKeyWithValue(AmbientBypassInboundCaptureAnnotation, "true"))
+		Expect(annotations).NotTo(HaveKey(IstioExcludeOutboundPortsAnnotation))
+
+		annotations = inject(nil, ambient, map[string]string{IncludeInboundPortsAnnotation: "*"})
+		Expect(annotations).To(HaveKeyWithValue(AmbientBypassInboundCaptureAnnotation, "true"))
+		Expect(inject(ambient, map[string]string{IstioDataplaneModeLabel: "none"},
+			map[string]string{IncludeInboundPortsAnnotation: "*"})).NotTo(HaveKey(AmbientBypassInboundCaptureAnnotation))
+	})
+})
@@ -0,0 +1,64 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ExtProcCommand runs the go-processor without Envoy; the image entrypoint starts both
+var ExtProcCommand = []string{"/usr/local/bin/go-processor"}
+
+// extProcStartupCheck is envoyStartupCheck without the Envoy admin interface
+func extProcStartupCheck() string {
+	return fmt.Sprintf(credentialsCheck+` && exec 3<>/dev/tcp/127.0.0.1/%d`, ExtProcPort)
+}
+
+// BuildExtProcStartupProbe holds back the application until the ext_proc server the Istio
+// proxy calls is serving
+func BuildExtProcStartupProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler:     corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"bash", "-c", extProcStartupCheck()}}},
+		PeriodSeconds:    1,
+		TimeoutSeconds:   2,
+		FailureThreshold: 180,
+	}
+}
+
+// InjectMeshExtProc turns the envoy-proxy sidecar into a bare ext_proc server for the
+// istio egress mode, so meshed pods do not run a second proxy. The container keeps its
+// name, configuration and credentials; only the ext-proc port is left and the probes no
+// longer look at Envoy. Probes removed by the sidecar-probes annotation stay removed.
+func (m *PodMutator) InjectMeshExtProc(podSpec *corev1.PodSpec) {
+	container := findContainer(podSpec, EnvoyProxyContainerName)
+	if container == nil {
+		return
+	}
+	container.Command = ExtProcCommand
+	container.Args = nil
+	container.Ports = []corev1.ContainerPort{
+		{Name: "ext-proc", ContainerPort: ExtProcPort, Protocol: corev1.ProtocolTCP},
+	}
+	if container.StartupProbe != nil {
+		container.StartupProbe = BuildExtProcStartupProbe()
+	}
+	// the Envoy liveness probe checks the outbound listener, which is gone
+	container.LivenessProbe = nil
+	mutatorLog.Info("Reduced envoy-proxy to the ext_proc server for the Istio sidecar")
+}
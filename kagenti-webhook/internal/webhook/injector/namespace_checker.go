@@ -19,9 +19,12 @@ package injector
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
 )
 
 var nsLog = logf.Log.WithName("namespace-checker")
@@ -29,11 +32,11 @@ var nsLog = logf.Log.WithName("namespace-checker")
 // DEPRECATED, used by Agent and MCPServer CRs. Remove CheckNamespaceInjectionEnabled after both CRs are deleted and use IsNamespaceInjectionEnabled instead.
 
 // checks if a namespace has injection enabled via labels or annotations
-func CheckNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, namespaceName, labelKey, annotationKey string) (bool, error) {
+func CheckNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Reader, namespaceName, labelKey, annotationKey string) (bool, error) {
 	nsLog.Info("Checking namespace injection settings", "namespace", namespaceName, "labelKey", labelKey, "annotationKey", annotationKey)
 
-	namespace := &corev1.Namespace{}
-	if err := k8sClient.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace); err != nil {
+	namespace, err := getNamespace(ctx, k8sClient, namespaceName)
+	if err != nil {
 		nsLog.Error(err, "Failed to fetch namespace", "namespace", namespaceName)
 		return false, err
 	}
@@ -61,11 +64,11 @@ func CheckNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client
 }
 
 // checks if a namespace has injection enabled via labels or annotations
-func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, namespaceName, labelKey string) (bool, error) {
+func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Reader, namespaceName, labelKey string) (bool, error) {
 	nsLog.Info("Checking namespace injection settings", "namespace", namespaceName, "labelKey", labelKey)
 
-	namespace := &corev1.Namespace{}
-	if err := k8sClient.Get(ctx, client.ObjectKey{Name: namespaceName}, namespace); err != nil {
+	namespace, err := getNamespace(ctx, k8sClient, namespaceName)
+	if err != nil {
 		nsLog.Error(err, "Failed to fetch namespace", "namespace", namespaceName)
 		return false, err
 	}
@@ -83,3 +86,13 @@ func IsNamespaceInjectionEnabled(ctx context.Context, k8sClient client.Client, n
 	nsLog.Info("Namespace injection not enabled", "namespace", namespaceName)
 	return false, nil
 }
+
+// getNamespace reads a namespace in its own span, since without a NamespaceReader the
+// lookup of every admitted workload's namespace is an API call
+func getNamespace(ctx context.Context, k8sClient client.Reader, name string) (*corev1.Namespace, error) {
+	ctx, span := obs.StartSpan(ctx, "namespace lookup", attribute.String("k8s.namespace.name", name))
+	namespace := &corev1.Namespace{}
+	err := k8sClient.Get(ctx, client.ObjectKey{Name: name}, namespace)
+	obs.EndSpan(span, err)
+	return namespace, err
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// NamespaceOnboardingAnnotation holds the Onboarded condition of a namespace labelled
+	// kagenti-enabled=true, as a JSON metav1.Condition
+	NamespaceOnboardingAnnotation = "kagenti.io/onboarding"
+	// OnboardedCondition is the type of the condition
+	OnboardedCondition = "Onboarded"
+
+	// Reasons of the condition
+	OnboardingReasonPending            = "Pending"
+	OnboardingReasonProvisioned        = "Provisioned"
+	OnboardingReasonProvisioningFailed = "ProvisioningFailed"
+	OnboardingReasonRealmUnavailable   = "RealmUnavailable"
+)
+
+// OnboardingCondition returns the condition recorded on the namespace, nil if there is
+// none or it cannot be parsed
+func OnboardingCondition(meta *metav1.ObjectMeta) *metav1.Condition {
+	value := meta.Annotations[NamespaceOnboardingAnnotation]
+	if value == "" {
+		return nil
+	}
+	condition := &metav1.Condition{}
+	if err := json.Unmarshal([]byte(value), condition); err != nil {
+		return nil
+	}
+	return condition
+}
+
+// SetOnboardingCondition records the condition on the namespace and reports whether the
+// annotation changed. The transition time is kept while the status stays the same.
+func SetOnboardingCondition(meta *metav1.ObjectMeta, status metav1.ConditionStatus, reason, message string) bool {
+	condition := metav1.Condition{
+		Type:               OnboardedCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+	if current := OnboardingCondition(meta); current != nil && current.Status == status {
+		if current.Reason == reason && current.Message == message {
+			return false
+		}
+		condition.LastTransitionTime = current.LastTransitionTime
+	}
+	value, err := json.Marshal(condition)
+	if err != nil {
+		return false
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[NamespaceOnboardingAnnotation] = string(value)
+	return true
+}
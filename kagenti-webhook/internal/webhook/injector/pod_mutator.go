@@ -19,10 +19,17 @@ package injector
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
 )
 
 var mutatorLog = logf.Log.WithName("pod-mutator")
@@ -46,16 +53,70 @@ const (
 	SpireEnabledValue  = "enabled"
 	SpireDisabledValue = "disabled"
 
-	// Istio exclusion annotations
+	// Istio annotations that take a pod out of the sidecar or ambient mesh (see IstioMeshFor)
 	IstioSidecarInjectAnnotation = "sidecar.istio.io/inject"
 	AmbientRedirectionAnnotation = "ambient.istio.io/redirection"
 )
 
+// DefaultExcludedNamespaces are never injected; the manager also excludes its own namespace
+var DefaultExcludedNamespaces = []string{"kube-system", "kube-node-lease"}
+
+// PodMutator holds only read-only configuration and keeps no per-request state, so a
+// single instance is safe for concurrent admissions and every webhook replica can
+// serve requests independently of leader election.
 type PodMutator struct {
 	Client                   client.Client
 	EnableClientRegistration bool
 	NamespaceLabel           string
 	NamespaceAnnotation      string
+	// NamespaceReader, if set, serves the namespace lookups of every admission instead of
+	// Client, typically the manager's informer cache
+	NamespaceReader client.Reader
+	// ProxyInitDefaults are the iptables parameters used unless a workload overrides them
+	ProxyInitDefaults ProxyInitConfig
+	// EgressMode is used unless a workload sets the kagenti.io/egress-mode annotation
+	EgressMode EgressMode
+	// EnvoyAdmin is used unless a workload sets the kagenti.io/envoy-admin annotation
+	EnvoyAdmin EnvoyAdminMode
+	// ImagePullSecrets are added to mutated pods so sidecar images can come from a private registry
+	ImagePullSecrets []string
+	// ClientCredentialsSecret stores registered clients in a per-workload Secret instead of only the shared emptyDir
+	ClientCredentialsSecret bool
+	// ClientDeregistration is set when the manager deletes Keycloak clients of deleted workloads
+	ClientDeregistration bool
+	// KeycloakAdminSecret names the Secret of each workload namespace that holds
+	// KEYCLOAK_ADMIN_USERNAME and KEYCLOAK_ADMIN_PASSWORD; empty reads them from environments
+	KeycloakAdminSecret string
+	// CredentialHygiene is used unless a workload sets the kagenti.io/credential-hygiene or
+	// kagenti.io/credential-rotation annotation
+	CredentialHygiene CredentialHygiene
+	// ConfigMapCheck is what admission does when the sidecar ConfigMaps are missing in the namespace
+	ConfigMapCheck ConfigMapCheckMode
+	// ExcludedNamespaces are never injected, whatever their labels or the workload say
+	ExcludedNamespaces []string
+	// ExcludedNames are patterns of workload names that are never injected, whatever their labels say
+	ExcludedNames []*regexp.Regexp
+	// AllowedSpiffeIDOverrides are patterns of the kagenti.io/spiffe-id values workloads may set
+	// outside their own namespace and service account
+	AllowedSpiffeIDOverrides []*regexp.Regexp
+	// IDPProfiles are the identity providers workloads select with the kagenti.io/idp label
+	IDPProfiles IDPProfiles
+	// SpireSocket is the source of the SPIRE Workload API socket volume for both webhooks
+	SpireSocket SpireSocketSource
+	// SpiffeHelperHealthPort, if set, is spiffe-helper's health_checks port and enables its probes
+	SpiffeHelperHealthPort int32
+	// SpiffeTrustDomain, if set, is the SPIRE trust domain used to check the length of SPIFFE IDs
+	SpiffeTrustDomain string
+	// SidecarConfig overrides the images, pull policy and resources of the injected containers
+	SidecarConfig SidecarConfig
+	// MCPServerSpireDefault is used for MCPServers without the kagenti.io/spire label; turn it
+	// off on clusters without SPIRE so client registration falls back to static client IDs
+	MCPServerSpireDefault bool
+	// MCPServerOIDCDefaults sets the OIDC configuration of injected MCPServers that have none
+	MCPServerOIDCDefaults bool
+	// IstioExcludeOutboundPorts are excluded from the outbound capture of Istio sidecars in
+	// addition to the Keycloak port, e.g. for a SPIRE server reached over TCP
+	IstioExcludeOutboundPorts []int32
 }
 
 func NewPodMutator(client client.Client, enableClientRegistration bool) *PodMutator {
@@ -64,6 +125,14 @@ func NewPodMutator(client client.Client, enableClientRegistration bool) *PodMuta
 		EnableClientRegistration: enableClientRegistration,
 		NamespaceLabel:           DefaultNamespaceLabel,
 		NamespaceAnnotation:      DefaultNamespaceAnnotation,
+		ProxyInitDefaults:        DefaultProxyInitConfig(),
+		EgressMode:               EgressModeIPTables,
+		EnvoyAdmin:               EnvoyAdminLocalhost,
+		ConfigMapCheck:           ConfigMapCheckWarn,
+		ExcludedNamespaces:       slices.Clone(DefaultExcludedNamespaces),
+		SpireSocket:              DefaultSpireSocketSource(),
+		MCPServerSpireDefault:    true,
+		MCPServerOIDCDefaults:    true,
 	}
 }
 
@@ -74,7 +143,7 @@ func NewPodMutator(client client.Client, enableClientRegistration bool) *PodMuta
 func (m *PodMutator) MutatePodSpec(ctx context.Context, podSpec *corev1.PodSpec, namespace, crName string, crAnnotations map[string]string) error {
 	mutatorLog.Info("MutatePodSpec called", "namespace", namespace, "crName", crName, "annotations", crAnnotations)
 
-	shouldMutate, err := m.ShouldMutate(ctx, namespace, crAnnotations)
+	shouldMutate, err := m.ShouldMutate(ctx, namespace, crName, crAnnotations)
 	if err != nil {
 		mutatorLog.Error(err, "Failed to determine if mutation should occur", "namespace", namespace, "crName", crName)
 		return fmt.Errorf("failed to determine if mutation should occur: %w", err)
@@ -85,18 +154,147 @@ func (m *PodMutator) MutatePodSpec(ctx context.Context, podSpec *corev1.PodSpec,
 		return nil // Skip mutation
 	}
 
+	// MCPServers run as their own service account, which their validating webhook checks
+	if spiffeID, err := SpiffeIDOverride(crAnnotations); err == nil {
+		if err := m.CheckSpiffeIDOverride(spiffeID, namespace, PodServiceAccount(podSpec)); err != nil {
+			mutatorLog.Error(err, "Invalid SPIFFE ID override", "namespace", namespace, "crName", crName)
+			return err
+		}
+	}
+
 	mutatorLog.Info("Mutation enabled - injecting sidecars and volumes", "namespace", namespace, "crName", crName)
+	return m.mutateCRPodSpec(ctx, podSpec, namespace, crName, crAnnotations, true)
+}
+
+// MutateMCPServerPodTemplate injects into the pod template of a toolhive MCPServer. A
+// kagenti.io/inject label on the MCPServer or its pod template decides like for workloads
+// (see NeedsMutation); without one, the deprecated ShouldMutate rules apply. SPIRE stays
+// enabled unless the MCPServer sets kagenti.io/spire to another value than "enabled" or
+// MCPServerSpireDefault is off; without SPIRE the client ID is <namespace>/<name>. Traffic
+// is redirected through Envoy like for workloads, following the egress mode and redirect
+// annotations of the pod template.
+func (m *PodMutator) MutateMCPServerPodTemplate(ctx context.Context, podTemplate *corev1.PodTemplateSpec, namespace, crName string, labels, crAnnotations map[string]string) (err error) {
+	ctx, span := obs.StartSpan(ctx, "MutateMCPServerPodTemplate",
+		attribute.String("k8s.namespace.name", namespace), attribute.String("k8s.object.name", crName))
+	defer func() { obs.EndSpan(span, err) }()
+	mutatorLog.Info("MutateMCPServerPodTemplate called", "namespace", namespace, "crName", crName,
+		"labels", labels, "annotations", crAnnotations)
+
+	shouldMutate, err := m.MCPServerNeedsMutation(ctx, podTemplate, namespace, crName, labels, crAnnotations)
+	if err != nil {
+		mutatorLog.Error(err, "Failed to determine if mutation should occur", "namespace", namespace, "crName", crName)
+		return fmt.Errorf("failed to determine if mutation should occur: %w", err)
+	}
+
+	if !shouldMutate {
+		mutatorLog.Info("Skipping mutation (injection not enabled)", "namespace", namespace, "crName", crName)
+		return nil
+	}
+
+	spireEnabled := m.IsMCPServerSpireEnabled(labels)
+	mutatorLog.Info("Mutation enabled - injecting sidecars, init containers, and volumes", "namespace", namespace,
+		"crName", crName, "spireEnabled", spireEnabled)
+
+	egressMode, err := EgressModeFor(podTemplate.Annotations, m.EgressMode)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid egress mode", "namespace", namespace, "crName", crName)
+		return err
+	}
+	envoyPorts, err := EnvoyPortsFromAnnotations(m.ProxyInitDefaults, podTemplate.Annotations)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid Envoy port annotations", "namespace", namespace, "crName", crName)
+		return err
+	}
+	envoyAdmin, err := EnvoyAdminModeFor(podTemplate.Annotations, m.EnvoyAdmin)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid Envoy admin mode", "namespace", namespace, "crName", crName)
+		return err
+	}
+	if err := m.injectRedirection(podTemplate, egressMode, 0, namespace, crName); err != nil {
+		return err
+	}
+
+	if err := m.mutateCRPodSpec(ctx, &podTemplate.Spec, namespace, crName, crAnnotations, spireEnabled); err != nil {
+		return err
+	}
+	m.InjectEnvoyPorts(&podTemplate.Spec, envoyPorts)
+	m.InjectEnvoyAdmin(&podTemplate.Spec, envoyAdmin, envoyPorts)
+	if egressMode == EgressModeIstio {
+		m.InjectMeshExtProc(&podTemplate.Spec)
+	}
+	m.InjectIstioExclusions(ctx, podTemplate, namespace, egressMode)
+	LabelInjected(&podTemplate.ObjectMeta)
+	return nil
+}
+
+// MCPServerNeedsMutation is the injection decision of MutateMCPServerPodTemplate; podTemplate may be nil
+func (m *PodMutator) MCPServerNeedsMutation(ctx context.Context, podTemplate *corev1.PodTemplateSpec, namespace, name string, labels, crAnnotations map[string]string) (bool, error) {
+	var podMeta *metav1.ObjectMeta
+	if podTemplate != nil {
+		podMeta = &podTemplate.ObjectMeta
+	}
+	if hasInjectLabel(labels, podMeta) {
+		return m.NeedsMutation(ctx, namespace, name, labels, podMeta)
+	}
+	return m.ShouldMutate(ctx, namespace, name, crAnnotations)
+}
+
+// IsMCPServerSpireEnabled follows the kagenti.io/spire label of an MCPServer and falls back
+// to MCPServerSpireDefault when it is not set
+func (m *PodMutator) IsMCPServerSpireEnabled(labels map[string]string) bool {
+	if _, exists := labels[SpireEnableLabel]; exists {
+		return IsSpireEnabled(labels)
+	}
+	return m.MCPServerSpireDefault
+}
+
+func hasInjectLabel(labels map[string]string, podMeta *metav1.ObjectMeta) bool {
+	sources := []map[string]string{labels}
+	if podMeta != nil {
+		sources = append(sources, podMeta.Labels, podMeta.Annotations)
+	}
+	for _, values := range sources {
+		if _, exists := values[AuthBridgeInjectLabel]; exists {
+			return true
+		}
+	}
+	return false
+}
 
-	if err := m.InjectSidecars(podSpec, namespace, crName); err != nil {
+// mutateCRPodSpec adds the sidecars and volumes to the pod spec of an Agent or MCPServer
+func (m *PodMutator) mutateCRPodSpec(ctx context.Context, podSpec *corev1.PodSpec, namespace, crName string, crAnnotations map[string]string, spireEnabled bool) error {
+	spiffeID, err := SpiffeIDOverride(crAnnotations)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid SPIFFE ID override", "namespace", namespace, "crName", crName)
+		return err
+	}
+	if err := m.InjectSidecarsWithSpireOption(podSpec, namespace, crName, spireEnabled); err != nil {
 		mutatorLog.Error(err, "Failed to inject sidecars", "namespace", namespace, "crName", crName)
 		return fmt.Errorf("failed to inject sidecars: %w", err)
 	}
+	m.InjectSpiffeIDOverride(podSpec, spiffeID)
+	m.InjectSidecarProbes(podSpec, crAnnotations)
+	if profile := SidecarResourceProfileFor(crAnnotations); profile != "" {
+		if err := m.InjectSidecarResourceProfile(podSpec, profile); err != nil {
+			mutatorLog.Error(err, "Failed to apply sidecar resource profile", "namespace", namespace, "crName", crName)
+			return err
+		}
+	}
+	if err := m.InjectNamespaceIDPProfile(ctx, podSpec, namespace); err != nil {
+		mutatorLog.Error(err, "Failed to apply namespace Keycloak annotations", "namespace", namespace, "crName", crName)
+		return err
+	}
+	if m.ClientCredentialsSecret {
+		m.InjectClientCredentialsSecret(ctx, podSpec, crName)
+	}
 
-	if err := m.InjectVolumes(podSpec); err != nil {
+	if err := m.InjectVolumesWithSpireOption(podSpec, spireEnabled); err != nil {
 		mutatorLog.Error(err, "Failed to inject volumes", "namespace", namespace, "crName", crName)
 		return fmt.Errorf("failed to inject volumes: %w", err)
 	}
 
+	m.InjectImagePullSecrets(podSpec)
+
 	mutatorLog.Info("Successfully mutated pod spec", "namespace", namespace, "crName", crName, "containers", len(podSpec.Containers), "volumes", len(podSpec.Volumes))
 	return nil
 }
@@ -112,10 +310,20 @@ func IsSpireEnabled(labels map[string]string) bool {
 }
 
 // It checks if injection should occur and performs all necessary mutations
-func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSpec, namespace, crName string, labels map[string]string) (bool, error) {
-	mutatorLog.Info("InjectAuthBridge called", "namespace", namespace, "crName", crName, "labels", labels)
-
-	shouldMutate, err := m.NeedsMutation(ctx, namespace, labels)
+// on the pod template, stamping it with the injection status and config hash
+func (m *PodMutator) InjectAuthBridge(ctx context.Context, podTemplate *corev1.PodTemplateSpec, namespace, crName string, labels map[string]string) (mutated bool, err error) {
+	ctx, span := obs.StartSpan(ctx, "InjectAuthBridge",
+		attribute.String("k8s.namespace.name", namespace), attribute.String("k8s.object.name", crName))
+	defer func() {
+		span.SetAttributes(attribute.Bool("authbridge.mutated", mutated))
+		obs.EndSpan(span, err)
+	}()
+	mutatorLog.Info("InjectAuthBridge called", "namespace", namespace, "crName", crName, "labels", labels,
+		"dryRun", IsDryRun(ctx))
+
+	podSpec := &podTemplate.Spec
+
+	shouldMutate, err := m.NeedsMutation(ctx, namespace, crName, labels, &podTemplate.ObjectMeta)
 	if err != nil {
 		mutatorLog.Error(err, "Failed to determine if mutation should occur", "namespace", namespace, "crName", crName)
 		return false, fmt.Errorf("failed to determine if mutation should occur: %w", err)
@@ -131,30 +339,156 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 	mutatorLog.Info("Mutation enabled - injecting sidecars, init containers, and volumes",
 		"namespace", namespace, "crName", crName, "spireEnabled", spireEnabled)
 
-	// Inject init containers (proxy-init for iptables setup)
-	if err := m.InjectInitContainers(podSpec); err != nil {
-		mutatorLog.Error(err, "Failed to inject init containers", "namespace", namespace, "crName", crName)
-		return false, fmt.Errorf("failed to inject init containers: %w", err)
+	egressMode, err := EgressModeFor(podTemplate.Annotations, m.EgressMode)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid egress mode", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	envoyPorts, err := EnvoyPortsFromAnnotations(m.ProxyInitDefaults, podTemplate.Annotations)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid Envoy port annotations", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	envoyAdmin, err := EnvoyAdminModeFor(podTemplate.Annotations, m.EnvoyAdmin)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid Envoy admin mode", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+
+	spiffeID, err := SpiffeIDOverride(podTemplate.Annotations)
+	if err == nil {
+		err = m.CheckSpiffeIDOverride(spiffeID, namespace, PodServiceAccount(podSpec))
+	}
+	if err != nil {
+		mutatorLog.Error(err, "Invalid SPIFFE ID override", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	registrationTimeout, err := RegistrationTimeoutFor(podSpec, podTemplate.Annotations)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid registration timeout", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	inboundAuthTarget, err := InboundAuthTargetFor(podSpec, podTemplate.Annotations)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid inbound-auth port", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	credentialHygiene, err := CredentialHygieneFor(podTemplate.Annotations, m.CredentialHygiene)
+	if err != nil {
+		mutatorLog.Error(err, "Invalid credential hygiene", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+
+	if err := m.injectRedirection(podTemplate, egressMode, inboundAuthTarget, namespace, crName); err != nil {
+		return false, err
 	}
 
 	if err := m.InjectSidecarsWithSpireOption(podSpec, namespace, crName, spireEnabled); err != nil {
 		mutatorLog.Error(err, "Failed to inject sidecars", "namespace", namespace, "crName", crName)
 		return false, fmt.Errorf("failed to inject sidecars: %w", err)
 	}
+	m.InjectSpiffeIDOverride(podSpec, spiffeID)
+	m.InjectRegistrationTimeout(podSpec, registrationTimeout)
+	m.InjectEnvoyPorts(podSpec, envoyPorts)
+	m.InjectEnvoyAdmin(podSpec, envoyAdmin, envoyPorts)
+	m.InjectInboundAuth(podSpec, inboundAuthTarget)
+	m.InjectSidecarProbes(podSpec, podTemplate.Annotations)
+	if egressMode == EgressModeIstio {
+		m.InjectMeshExtProc(podSpec)
+	}
+	if err := m.InjectNamespaceIDPProfile(ctx, podSpec, namespace); err != nil {
+		mutatorLog.Error(err, "Failed to apply namespace Keycloak annotations", "namespace", namespace, "crName", crName)
+		return false, err
+	}
+	if profile := IDPProfileFor(&podTemplate.ObjectMeta, labels); profile != "" {
+		if err := m.InjectIDPProfile(podSpec, profile); err != nil {
+			mutatorLog.Error(err, "Failed to apply IdP profile", "namespace", namespace, "crName", crName)
+			return false, err
+		}
+	}
+	if m.ClientCredentialsSecret {
+		m.InjectClientCredentialsSecret(ctx, podSpec, crName)
+	}
+	// After everything that configures client-registration, which the sidecar copies
+	m.InjectCredentialHygiene(podSpec, credentialHygiene, podTemplate.Annotations)
+	if profile := SidecarResourceProfileFor(podTemplate.Annotations); profile != "" {
+		if err := m.InjectSidecarResourceProfile(podSpec, profile); err != nil {
+			mutatorLog.Error(err, "Failed to apply sidecar resource profile", "namespace", namespace, "crName", crName)
+			return false, err
+		}
+	}
 
 	if err := m.InjectVolumesWithSpireOption(podSpec, spireEnabled); err != nil {
 		mutatorLog.Error(err, "Failed to inject volumes", "namespace", namespace, "crName", crName)
 		return false, fmt.Errorf("failed to inject volumes: %w", err)
 	}
 
+	if podTemplate.Annotations[AppEnvAnnotation] == "true" {
+		m.InjectAppEnv(podSpec, spireEnabled, egressMode)
+	}
+
+	m.InjectImagePullSecrets(podSpec)
+	m.InjectIstioExclusions(ctx, podTemplate, namespace, egressMode)
+
+	StampInjectionStatus(&podTemplate.ObjectMeta, podSpec, spireEnabled)
+
 	mutatorLog.Info("Successfully mutated pod spec", "namespace", namespace, "crName", crName,
+		"injectionHash", podTemplate.Annotations[InjectionHashAnnotation],
 		"containers", len(podSpec.Containers),
 		"initContainers", len(podSpec.InitContainers),
 		"volumes", len(podSpec.Volumes),
-		"spireEnabled", spireEnabled)
+		"spireEnabled", spireEnabled,
+		"egressMode", egressMode)
 	return true, nil
 }
 
+// injectRedirection routes the application traffic through Envoy as the egress mode asks:
+// proxy-init for iptables, the proxy variables for proxy-env and the redirect annotations
+// read by the node plugin for cni; istio needs nothing. Inbound traffic to the
+// inbound-auth target port is redirected to the sidecar, which proxy-env and istio cannot do.
+func (m *PodMutator) injectRedirection(podTemplate *corev1.PodTemplateSpec, egressMode EgressMode, inboundAuthTarget int32, namespace, crName string) error {
+	if inboundAuthTarget != 0 && (egressMode == EgressModeProxyEnv || egressMode == EgressModeIstio) {
+		err := fmt.Errorf("invalid %s annotation: the %s egress mode does not redirect inbound traffic to inbound-auth", InboundAuthAnnotation, egressMode)
+		mutatorLog.Error(err, "Inbound auth needs traffic redirection", "namespace", namespace, "crName", crName)
+		return err
+	}
+	switch egressMode {
+	case EgressModeProxyEnv:
+		// No proxy-init: the application reaches Envoy through the proxy environment
+		mutatorLog.Info("Using proxy-env egress mode, skipping proxy-init", "namespace", namespace, "crName", crName)
+		m.InjectProxyEnv(&podTemplate.Spec, podTemplate.Annotations)
+	case EgressModeIstio:
+		// The Istio sidecar already captures the traffic and runs the ext_proc filter
+		mutatorLog.Info("Using istio egress mode, skipping proxy-init", "namespace", namespace, "crName", crName)
+	case EgressModeCNI:
+		// No privileged init container: the node-level CNI plugin applies the same rules
+		proxyInitConfig, err := ProxyInitConfigFromAnnotations(m.ProxyInitDefaults, podTemplate.Annotations, &podTemplate.Spec)
+		if err != nil {
+			mutatorLog.Error(err, "Invalid traffic redirection annotations", "namespace", namespace, "crName", crName)
+			return err
+		}
+		proxyInitConfig.InboundAuthPort = inboundAuthTarget
+		mutatorLog.Info("Using cni egress mode, skipping proxy-init", "namespace", namespace, "crName", crName)
+		if err := StampRedirectAnnotations(&podTemplate.ObjectMeta, proxyInitConfig); err != nil {
+			return err
+		}
+	default:
+		proxyInitConfig, err := ProxyInitConfigFromAnnotations(m.ProxyInitDefaults, podTemplate.Annotations, &podTemplate.Spec)
+		if err != nil {
+			mutatorLog.Error(err, "Invalid traffic redirection annotations", "namespace", namespace, "crName", crName)
+			return err
+		}
+		proxyInitConfig.InboundAuthPort = inboundAuthTarget
+
+		// Inject init containers (proxy-init for iptables setup)
+		if err := m.InjectInitContainersWithConfig(&podTemplate.Spec, proxyInitConfig); err != nil {
+			mutatorLog.Error(err, "Failed to inject init containers", "namespace", namespace, "crName", crName)
+			return fmt.Errorf("failed to inject init containers: %w", err)
+		}
+	}
+	return nil
+}
+
 // DEPRECATED, used by Agent and MCPServer CRs. Remove ShouldMutate after both CRs are deleted and use NeedsMutation instead.
 
 // determines if pod mutation should occur based on annotations and namespace labels
@@ -164,8 +498,18 @@ func (m *PodMutator) InjectAuthBridge(ctx context.Context, podSpec *corev1.PodSp
 // 3. Namespace label: kagenti-enabled=true
 // 4. Namespace annotation: kagenti.dev/inject=true
 
-func (m *PodMutator) ShouldMutate(ctx context.Context, namespace string, crAnnotations map[string]string) (bool, error) {
-	mutatorLog.Info("Checking if mutation should occur", "namespace", namespace, "crAnnotations", crAnnotations)
+func (m *PodMutator) ShouldMutate(ctx context.Context, namespace, name string, crAnnotations map[string]string) (bool, error) {
+	mutatorLog.Info("Checking if mutation should occur", "namespace", namespace, "name", name, "crAnnotations", crAnnotations)
+
+	// Priority 0: excluded namespaces and names are never mutated
+	if m.IsNamespaceExcluded(namespace) {
+		mutatorLog.Info("Namespace excluded from injection", "namespace", namespace)
+		return false, nil
+	}
+	if pattern := m.excludedNamePattern(name); pattern != nil {
+		mutatorLog.Info("Name excluded from injection", "namespace", namespace, "name", name, "pattern", pattern.String())
+		return false, nil
+	}
 
 	// Priority 1: CR-level opt-out (explicit disable)
 	if crAnnotations[DefaultCRAnnotation] == "false" {
@@ -181,7 +525,7 @@ func (m *PodMutator) ShouldMutate(ctx context.Context, namespace string, crAnnot
 
 	// Priority 3 & 4: Check namespace-level settings
 	mutatorLog.Info("Checking namespace-level injection settings", "namespace", namespace, "label", m.NamespaceLabel, "annotation", m.NamespaceAnnotation)
-	nsInjectionEnabled, err := CheckNamespaceInjectionEnabled(ctx, m.Client, namespace, m.NamespaceLabel, m.NamespaceAnnotation)
+	nsInjectionEnabled, err := CheckNamespaceInjectionEnabled(ctx, m.namespaceReader(), namespace, m.NamespaceLabel, m.NamespaceAnnotation)
 	if err != nil {
 		mutatorLog.Error(err, "Failed to check namespace injection settings", "namespace", namespace)
 		return false, fmt.Errorf("failed to check namespace injection settings: %w", err)
@@ -193,62 +537,200 @@ func (m *PodMutator) ShouldMutate(ctx context.Context, namespace string, crAnnot
 	}
 	return false, nil
 }
-func (m *PodMutator) NeedsMutation(ctx context.Context, namespace string, labels map[string]string) (bool, error) {
-	mutatorLog.Info("Checking if mutation should occur", "namespace", namespace, "labels", labels)
 
-	value, exists := labels[AuthBridgeInjectLabel]
+// NeedsMutation determines if AuthBridge injection should occur. The kagenti.io/inject
+// key is looked up in the following order and the first match wins:
+// 1. Pod template label
+// 2. Pod template annotation
+// 3. Workload label
+// 4. Namespace label: kagenti-enabled=true (only when none of the above is set)
+// A value of "enabled" opts in; any other value opts out. Workloads in ExcludedNamespaces
+// or named after one of the ExcludedNames are never mutated, so a stray label cannot
+// break system components.
+func (m *PodMutator) NeedsMutation(ctx context.Context, namespace, name string, labels map[string]string, podMeta *metav1.ObjectMeta) (bool, error) {
+	mutatorLog.Info("Checking if mutation should occur", "namespace", namespace, "name", name, "labels", labels)
+	decision, err := m.DecideInjection(ctx, namespace, name, labels, podMeta)
+	if err != nil {
+		return false, err
+	}
+	mutatorLog.Info("Injection decided", "namespace", namespace, "inject", decision.Inject, "reason", decision.Reason)
+	return decision.Inject, nil
+}
+
+// InjectionDecision is the outcome of NeedsMutation and the rule that produced it
+type InjectionDecision struct {
+	Inject bool
+	Reason string
+}
+
+// DecideInjection applies the NeedsMutation rules and explains the result
+func (m *PodMutator) DecideInjection(ctx context.Context, namespace, name string, labels map[string]string, podMeta *metav1.ObjectMeta) (InjectionDecision, error) {
+	if m.IsNamespaceExcluded(namespace) {
+		return InjectionDecision{Reason: fmt.Sprintf("namespace %s is excluded from injection", namespace)}, nil
+	}
+	if pattern := m.excludedNamePattern(name); pattern != nil {
+		return InjectionDecision{Reason: fmt.Sprintf("name %s matches the excluded name pattern %s", name, pattern)}, nil
+	}
+
+	sources := []struct {
+		name   string
+		values map[string]string
+	}{
+		{"pod template label", nil},
+		{"pod template annotation", nil},
+		{"workload label", labels},
+	}
+	if podMeta != nil {
+		sources[0].values = podMeta.Labels
+		sources[1].values = podMeta.Annotations
+	}
 
-	// If label exists, respect its value (opt-in or opt-out)
-	if exists {
+	for _, source := range sources {
+		value, exists := source.values[AuthBridgeInjectLabel]
+		if !exists {
+			continue
+		}
+		// If the key exists, respect its value (opt-in or opt-out)
 		if value == AuthBridgeInjectValue {
-			mutatorLog.Info("Workload label opt-in detected ")
-			return true, nil
+			return InjectionDecision{Inject: true, Reason: fmt.Sprintf("opt-in through the %s %s=%s", source.name, AuthBridgeInjectLabel, value)}, nil
 		}
 		// Any other value (including "disabled", "false", etc.) is opt-out
-		mutatorLog.Info("Workload label opt-out detected ")
-		return false, nil
+		return InjectionDecision{Reason: fmt.Sprintf("opt-out through the %s %s=%s", source.name, AuthBridgeInjectLabel, value)}, nil
 	}
 
 	// No label - fall back to namespace-level settings
-	mutatorLog.Info("Checking namespace-level injection settings", "namespace", namespace, "label", m.NamespaceLabel)
-	return IsNamespaceInjectionEnabled(ctx, m.Client, namespace, m.NamespaceLabel)
+	enabled, err := IsNamespaceInjectionEnabled(ctx, m.namespaceReader(), namespace, m.NamespaceLabel)
+	if err != nil {
+		return InjectionDecision{}, err
+	}
+	if enabled {
+		return InjectionDecision{Inject: true, Reason: fmt.Sprintf("namespace label %s=true", m.NamespaceLabel)}, nil
+	}
+	return InjectionDecision{Reason: fmt.Sprintf("no %s key on the workload or pod template and no namespace label %s=true",
+		AuthBridgeInjectLabel, m.NamespaceLabel)}, nil
+}
+
+// namespaceReader is NamespaceReader or, without one, Client
+func (m *PodMutator) namespaceReader() client.Reader {
+	if m.NamespaceReader != nil {
+		return m.NamespaceReader
+	}
+	return m.Client
+}
+
+// IsNamespaceExcluded reports whether namespace is on the injection deny-list
+func (m *PodMutator) IsNamespaceExcluded(namespace string) bool {
+	return slices.Contains(m.ExcludedNamespaces, namespace)
+}
+
+// excludedNamePattern returns the first of the ExcludedNames that matches name, or nil
+func (m *PodMutator) excludedNamePattern(name string) *regexp.Regexp {
+	for _, pattern := range m.ExcludedNames {
+		if pattern.MatchString(name) {
+			return pattern
+		}
+	}
+	return nil
 }
+
+// ParseNamePatterns compiles the regular expressions of ExcludedNames. Empty patterns are
+// skipped since they would match every name.
+func ParseNamePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
 func (m *PodMutator) InjectSidecars(podSpec *corev1.PodSpec, namespace, crName string) error {
 	// Default to SPIRE enabled for backward compatibility
 	return m.InjectSidecarsWithSpireOption(podSpec, namespace, crName, true)
 }
 
-// InjectSidecarsWithSpireOption injects sidecars with optional SPIRE support
+// InjectSidecarsWithSpireOption injects sidecars with optional SPIRE support.
+// All of them are init containers, appended after proxy-init in start order:
+// spiffe-helper (native sidecar), client-registration (runs to completion, so the
+// application only starts once its client secret exists) and envoy-proxy (native sidecar).
+// Native sidecars need Kubernetes 1.29 or later.
 func (m *PodMutator) InjectSidecarsWithSpireOption(podSpec *corev1.PodSpec, namespace, crName string, spireEnabled bool) error {
-	if podSpec.Containers == nil {
-		podSpec.Containers = []corev1.Container{}
+	if podSpec.InitContainers == nil {
+		podSpec.InitContainers = []corev1.Container{}
 	}
 
 	// Only inject spiffe-helper if SPIRE is enabled
 	if spireEnabled {
-		if !containerExists(podSpec.Containers, SpiffeHelperContainerName) {
+		if !injectedContainerExists(podSpec, SpiffeHelperContainerName) {
 			mutatorLog.Info("Injecting spiffe-helper (SPIRE enabled)")
-			podSpec.Containers = append(podSpec.Containers, BuildSpiffeHelperContainer())
+			podSpec.InitContainers = append(podSpec.InitContainers, m.SidecarConfig.apply(BuildSpiffeHelperContainer()))
 		}
 	} else {
 		mutatorLog.Info("Skipping spiffe-helper injection (SPIRE disabled)")
 	}
 
-	// Check and inject client-registration sidecar (with SPIRE option)
-	if !containerExists(podSpec.Containers, ClientRegistrationContainerName) {
+	// Check and inject client-registration init container (with SPIRE option)
+	if !injectedContainerExists(podSpec, ClientRegistrationContainerName) {
 		clientID := fmt.Sprintf("%s/%s", namespace, crName)
-		podSpec.Containers = append(podSpec.Containers, BuildClientRegistrationContainerWithSpireOption(clientID, crName, namespace, spireEnabled))
+		podSpec.InitContainers = append(podSpec.InitContainers,
+			m.SidecarConfig.apply(keycloakAdminFromSecret(
+				BuildClientRegistrationContainerWithSpireOption(clientID, crName, namespace, spireEnabled), m.KeycloakAdminSecret)))
 	}
 
 	// Check and inject envoy-proxy sidecar
-	if !containerExists(podSpec.Containers, EnvoyProxyContainerName) {
-		podSpec.Containers = append(podSpec.Containers, BuildEnvoyProxyContainer())
+	if !injectedContainerExists(podSpec, EnvoyProxyContainerName) {
+		envoy := BuildEnvoyProxyContainer()
+		if spireEnabled {
+			// The SVIDs from spiffe-helper, for mTLS client authentication and actor tokens
+			envoy.VolumeMounts = append(envoy.VolumeMounts, corev1.VolumeMount{Name: "svid-output", MountPath: "/opt", ReadOnly: true})
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, m.SidecarConfig.apply(envoy))
 	}
 
 	return nil
 }
 
+// ClientRegistrationInjected reports whether podSpec runs client-registration
+func ClientRegistrationInjected(podSpec *corev1.PodSpec) bool {
+	return injectedContainerExists(podSpec, ClientRegistrationContainerName)
+}
+
+// injectedContainerExists also looks at regular containers, where older webhook versions put the sidecars
+func injectedContainerExists(podSpec *corev1.PodSpec, name string) bool {
+	return containerExists(podSpec.InitContainers, name) || containerExists(podSpec.Containers, name)
+}
+
+// InjectImagePullSecrets appends the configured pull secrets that the pod does not reference yet.
+// The secrets must exist in the workload namespace.
+func (m *PodMutator) InjectImagePullSecrets(podSpec *corev1.PodSpec) {
+	for _, name := range m.ImagePullSecrets {
+		if !imagePullSecretExists(podSpec.ImagePullSecrets, name) {
+			podSpec.ImagePullSecrets = append(podSpec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+		}
+	}
+}
+
+func imagePullSecretExists(secrets []corev1.LocalObjectReference, name string) bool {
+	for _, s := range secrets {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (m *PodMutator) InjectInitContainers(podSpec *corev1.PodSpec) error {
+	return m.InjectInitContainersWithConfig(podSpec, m.ProxyInitDefaults)
+}
+
+// InjectInitContainersWithConfig injects proxy-init configured with the given iptables parameters
+func (m *PodMutator) InjectInitContainersWithConfig(podSpec *corev1.PodSpec, cfg ProxyInitConfig) error {
 	mutatorLog.Info("Injecting init containers", "existingInitContainers", len(podSpec.InitContainers))
 
 	if podSpec.InitContainers == nil {
@@ -258,7 +740,7 @@ func (m *PodMutator) InjectInitContainers(podSpec *corev1.PodSpec) error {
 	// Check and inject proxy-init init container
 	if !containerExists(podSpec.InitContainers, ProxyInitContainerName) {
 		mutatorLog.Info("Injecting proxy-init init container")
-		podSpec.InitContainers = append(podSpec.InitContainers, BuildProxyInitContainer())
+		podSpec.InitContainers = append(podSpec.InitContainers, m.SidecarConfig.apply(BuildProxyInitContainerWithConfig(cfg)))
 	}
 
 	return nil
@@ -280,7 +762,7 @@ func (m *PodMutator) InjectVolumesWithSpireOption(podSpec *corev1.PodSpec, spire
 	// Add all required volumes if they don't exist
 	var requiredVolumes []corev1.Volume
 	if spireEnabled {
-		requiredVolumes = BuildRequiredVolumes()
+		requiredVolumes = BuildRequiredVolumesWithSpireSocket(m.SpireSocket)
 	} else {
 		requiredVolumes = BuildRequiredVolumesNoSpire()
 	}
@@ -0,0 +1,344 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("NeedsMutation", func() {
+	var mutator *PodMutator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		enabledNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "enabled",
+			Labels: map[string]string{DefaultNamespaceLabel: "true"},
+		}}
+		plainNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}}
+		systemNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "kube-system",
+			Labels: map[string]string{DefaultNamespaceLabel: "true"},
+		}}
+		mutator = NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(enabledNS, plainNS, systemNS).Build(), true)
+	})
+
+	inject := func(value string) map[string]string {
+		return map[string]string{AuthBridgeInjectLabel: value}
+	}
+
+	DescribeTable("precedence of the opt-in sources",
+		func(namespace string, workloadLabels map[string]string, podMeta *metav1.ObjectMeta, expected bool) {
+			mutate, err := mutator.NeedsMutation(context.Background(), namespace, "app", workloadLabels, podMeta)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mutate).To(Equal(expected))
+		},
+		Entry("pod template label opts in", "plain", nil,
+			&metav1.ObjectMeta{Labels: inject(AuthBridgeInjectValue)}, true),
+		Entry("pod template annotation opts in", "plain", nil,
+			&metav1.ObjectMeta{Annotations: inject(AuthBridgeInjectValue)}, true),
+		Entry("pod template label overrides pod template annotation", "plain", nil,
+			&metav1.ObjectMeta{Labels: inject(AuthBridgeDisabledValue), Annotations: inject(AuthBridgeInjectValue)}, false),
+		Entry("pod template annotation overrides workload label", "plain", inject(AuthBridgeInjectValue),
+			&metav1.ObjectMeta{Annotations: inject(AuthBridgeDisabledValue)}, false),
+		Entry("pod template opt-out overrides namespace opt-in", "enabled", nil,
+			&metav1.ObjectMeta{Labels: inject(AuthBridgeDisabledValue)}, false),
+		Entry("workload label is used when the pod template is silent", "plain", inject(AuthBridgeInjectValue),
+			&metav1.ObjectMeta{}, true),
+		Entry("namespace label is the fallback", "enabled", nil, nil, true),
+		Entry("nothing set means no injection", "plain", nil, &metav1.ObjectMeta{}, false),
+		Entry("excluded namespace overrides every opt-in", "kube-system", inject(AuthBridgeInjectValue),
+			&metav1.ObjectMeta{Labels: inject(AuthBridgeInjectValue)}, false),
+	)
+
+	It("applies the deny-list to the Agent and MCPServer path", func() {
+		mutate, err := mutator.ShouldMutate(context.Background(), "kube-system", "app", map[string]string{DefaultCRAnnotation: "true"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutate).To(BeFalse())
+
+		mutator.ExcludedNamespaces = []string{"enabled"}
+		mutate, err = mutator.NeedsMutation(context.Background(), "enabled", "app", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutate).To(BeFalse())
+	})
+
+	It("never injects workloads with an excluded name", func() {
+		var err error
+		mutator.ExcludedNames, err = ParseNamePatterns([]string{"^kagenti-", "", "-webhook$"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutator.ExcludedNames).To(HaveLen(2))
+
+		decision, err := mutator.DecideInjection(context.Background(), "enabled", "kagenti-operator", inject(AuthBridgeInjectValue),
+			&metav1.ObjectMeta{Labels: inject(AuthBridgeInjectValue)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decision).To(Equal(InjectionDecision{Reason: "name kagenti-operator matches the excluded name pattern ^kagenti-"}))
+		mutate, err := mutator.ShouldMutate(context.Background(), "enabled", "istio-webhook", map[string]string{DefaultCRAnnotation: "true"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutate).To(BeFalse())
+		mutate, err = mutator.NeedsMutation(context.Background(), "enabled", "my-kagenti-agent", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutate).To(BeTrue())
+
+		_, err = ParseNamePatterns([]string{"^(kagenti"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid name pattern "^(kagenti"`)))
+	})
+
+	It("reads namespaces through the NamespaceReader when set", func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		// the reader is the only one that knows the namespace is enabled
+		mutator.NamespaceReader = mutator.Client
+		mutator.Client = fake.NewClientBuilder().WithScheme(scheme).Build()
+		mutate, err := mutator.NeedsMutation(context.Background(), "enabled", "app", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutate).To(BeTrue())
+	})
+
+	It("explains which rule decided", func() {
+		decision, err := mutator.DecideInjection(context.Background(), "enabled", "app", inject(AuthBridgeInjectValue),
+			&metav1.ObjectMeta{Annotations: inject(AuthBridgeDisabledValue)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decision.Inject).To(BeFalse())
+		Expect(decision.Reason).To(ContainSubstring("pod template annotation"))
+
+		decision, err = mutator.DecideInjection(context.Background(), "enabled", "app", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decision).To(Equal(InjectionDecision{Inject: true, Reason: "namespace label kagenti-enabled=true"}))
+
+		decision, err = mutator.DecideInjection(context.Background(), "kube-system", "app", inject(AuthBridgeInjectValue), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decision.Reason).To(ContainSubstring("excluded"))
+	})
+})
+
+var _ = Describe("Mutation spans", func() {
+	It("traces the namespace lookup inside the mutation", func() {
+		previous := otel.GetTracerProvider()
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		DeferCleanup(otel.SetTracerProvider, previous)
+
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		enabledNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "enabled",
+			Labels: map[string]string{DefaultNamespaceLabel: "true"},
+		}}
+		mutator := NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(enabledNS).Build(), true)
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		Expect(mutator.InjectAuthBridge(context.Background(), podTemplate, "enabled", "agent", nil)).To(BeTrue())
+
+		spans := recorder.Ended()
+		Expect(spans).NotTo(BeEmpty())
+		mutation := spans[len(spans)-1]
+		Expect(mutation.Name()).To(Equal("InjectAuthBridge"))
+		Expect(mutation.Attributes()).To(ContainElement(attribute.Bool("authbridge.mutated", true)))
+		Expect(spans[0].Name()).To(Equal("namespace lookup"))
+		Expect(spans[0].Parent().SpanID()).To(Equal(mutation.SpanContext().SpanID()))
+	})
+})
+
+var _ = Describe("MutateMCPServerPodTemplate", func() {
+	var mutator *PodMutator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		enabledNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "enabled",
+			Labels: map[string]string{DefaultNamespaceLabel: "true"},
+		}}
+		plainNS := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}}
+		mutator = NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(enabledNS, plainNS).Build(), true)
+	})
+
+	mutate := func(namespace string, labels, podLabels, annotations map[string]string) []string {
+		podTemplate := &corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: podLabels}}
+		Expect(mutator.MutateMCPServerPodTemplate(context.Background(), podTemplate, namespace, "fetch", labels, annotations)).To(Succeed())
+		var names []string
+		for _, c := range podTemplate.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	DescribeTable("opt-in and SPIRE selection",
+		func(namespace string, labels, podLabels, annotations map[string]string, expected []string) {
+			Expect(mutate(namespace, labels, podLabels, annotations)).To(Equal(expected))
+		},
+		Entry("label opts out of an enabled namespace", "enabled",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeDisabledValue}, nil, nil, nil),
+		Entry("label opt-out overrides the deprecated annotation", "plain",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeDisabledValue}, nil, map[string]string{DefaultCRAnnotation: "true"}, nil),
+		Entry("pod template label opts in", "plain",
+			nil, map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}, nil,
+			[]string{ProxyInitContainerName, SpiffeHelperContainerName, ClientRegistrationContainerName, EnvoyProxyContainerName}),
+		Entry("SPIRE label disables spiffe-helper", "plain",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue, SpireEnableLabel: SpireDisabledValue}, nil, nil,
+			[]string{ProxyInitContainerName, ClientRegistrationContainerName, EnvoyProxyContainerName}),
+		Entry("namespace label applies without labels", "enabled", nil, nil, nil,
+			[]string{ProxyInitContainerName, SpiffeHelperContainerName, ClientRegistrationContainerName, EnvoyProxyContainerName}),
+		Entry("nothing set means no injection", "plain", nil, nil, nil, nil),
+	)
+
+	It("mounts the SPIRE socket from the CSI driver unless a hostPath is configured", func() {
+		socketVolume := func() corev1.Volume {
+			podTemplate := &corev1.PodTemplateSpec{}
+			Expect(mutator.MutateMCPServerPodTemplate(context.Background(), podTemplate, "enabled", "fetch", nil, nil)).To(Succeed())
+			for _, v := range podTemplate.Spec.Volumes {
+				if v.Name == "spire-agent-socket" {
+					return v
+				}
+			}
+			Fail("spire-agent-socket volume not injected")
+			return corev1.Volume{}
+		}
+
+		volume := socketVolume()
+		Expect(volume.HostPath).To(BeNil())
+		Expect(volume.CSI.Driver).To(Equal(DefaultSpireCSIDriver))
+
+		mutator.SpireSocket = SpireSocketSource{HostPath: "/run/spire/agent-sockets"}
+		volume = socketVolume()
+		Expect(volume.CSI).To(BeNil())
+		Expect(volume.HostPath.Path).To(Equal("/run/spire/agent-sockets"))
+	})
+
+	It("registers a static client ID without SPIRE when the SPIRE default is off", func() {
+		mutator.MCPServerSpireDefault = false
+		podTemplate := &corev1.PodTemplateSpec{}
+		Expect(mutator.MutateMCPServerPodTemplate(context.Background(), podTemplate, "enabled", "fetch", nil, nil)).To(Succeed())
+
+		Expect(podTemplate.Spec.InitContainers).To(HaveLen(3))
+		registration := podTemplate.Spec.InitContainers[1]
+		Expect(registration.Name).To(Equal(ClientRegistrationContainerName))
+		Expect(registration.Env).To(ContainElements(
+			corev1.EnvVar{Name: "SPIRE_ENABLED", Value: "false"},
+			corev1.EnvVar{Name: "CLIENT_NAME", Value: "enabled/fetch"}))
+		volumes := []string{}
+		for _, v := range podTemplate.Spec.Volumes {
+			volumes = append(volumes, v.Name)
+		}
+		Expect(volumes).NotTo(ContainElement("spire-agent-socket"))
+
+		Expect(mutate("enabled", map[string]string{SpireEnableLabel: SpireEnabledValue}, nil, nil)).
+			To(ContainElement(SpiffeHelperContainerName))
+	})
+
+	It("redirects traffic through Envoy as the pod template egress mode asks", func() {
+		podTemplate := &corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				EgressModeAnnotation:     string(EgressModeProxyEnv),
+				EnvoyAdminPortAnnotation: "9911",
+			}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "mcp"}}},
+		}
+		Expect(mutator.MutateMCPServerPodTemplate(context.Background(), podTemplate, "enabled", "fetch", nil, nil)).To(Succeed())
+
+		Expect(containerExists(podTemplate.Spec.InitContainers, ProxyInitContainerName)).To(BeFalse())
+		Expect(podTemplate.Spec.Containers[0].Env).To(ContainElement(HaveField("Name", "HTTP_PROXY")))
+		envoy := findContainer(&podTemplate.Spec, EnvoyProxyContainerName)
+		Expect(envoy.Env).To(ContainElement(corev1.EnvVar{Name: EnvoyAdminPortEnv, Value: "9911"}))
+	})
+
+	It("rejects invalid redirect annotations on the pod template", func() {
+		podTemplate := &corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			EgressModeAnnotation: "sidecar",
+		}}}
+		Expect(mutator.MutateMCPServerPodTemplate(context.Background(), podTemplate, "enabled", "fetch", nil, nil)).
+			NotTo(Succeed())
+	})
+})
+
+var _ = Describe("InjectImagePullSecrets", func() {
+	It("appends configured secrets the pod does not reference yet", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.ImagePullSecrets = []string{"sidecar-registry", "shared"}
+		podSpec := &corev1.PodSpec{ImagePullSecrets: []corev1.LocalObjectReference{{Name: "shared"}}}
+
+		mutator.InjectImagePullSecrets(podSpec)
+		mutator.InjectImagePullSecrets(podSpec)
+
+		Expect(podSpec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{
+			{Name: "shared"}, {Name: "sidecar-registry"},
+		}))
+	})
+
+	It("leaves the pod alone when no secrets are configured", func() {
+		podSpec := &corev1.PodSpec{}
+		NewPodMutator(nil, true).InjectImagePullSecrets(podSpec)
+		Expect(podSpec.ImagePullSecrets).To(BeNil())
+	})
+})
+
+var _ = Describe("Sidecar placement", func() {
+	names := func(containers []corev1.Container) []string {
+		out := []string{}
+		for _, c := range containers {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+
+	It("runs client-registration to completion between the native sidecars", func() {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app", Image: "app:latest"}},
+		}}
+		labels := map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+			SpireEnableLabel:      SpireEnabledValue,
+		}
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "ns", "app", labels)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(names(podTemplate.Spec.Containers)).To(Equal([]string{"app"}))
+		Expect(names(podTemplate.Spec.InitContainers)).To(Equal([]string{
+			ProxyInitContainerName, SpiffeHelperContainerName, ClientRegistrationContainerName, EnvoyProxyContainerName,
+		}))
+		for _, c := range podTemplate.Spec.InitContainers {
+			switch c.Name {
+			case SpiffeHelperContainerName, EnvoyProxyContainerName:
+				Expect(c.RestartPolicy).To(HaveValue(Equal(corev1.ContainerRestartPolicyAlways)), c.Name)
+			default:
+				Expect(c.RestartPolicy).To(BeNil(), c.Name)
+			}
+		}
+		Expect(podTemplate.Spec.InitContainers[2].Command[2]).NotTo(ContainSubstring("tail -f /dev/null"))
+	})
+
+	It("does not duplicate sidecars injected as regular containers by older versions", func() {
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app"}, {Name: ClientRegistrationContainerName}, {Name: EnvoyProxyContainerName},
+		}}
+		Expect(NewPodMutator(nil, true).InjectSidecarsWithSpireOption(podSpec, "ns", "app", false)).To(Succeed())
+		Expect(podSpec.InitContainers).To(BeEmpty())
+	})
+})
@@ -0,0 +1,116 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// SidecarProbesAnnotation set to "false" on the pod template removes the probes from the
+	// injected sidecars, e.g. for custom sidecar images without a shell
+	SidecarProbesAnnotation = "kagenti.io/sidecar-probes"
+
+	// SpiffeHelperLivenessPath and SpiffeHelperReadinessPath are served by spiffe-helper's
+	// health_checks listener
+	SpiffeHelperLivenessPath  = "/live"
+	SpiffeHelperReadinessPath = "/ready"
+)
+
+// credentialsCheck passes once envoy-proxy has the client credentials, read the way the
+// go-processor reads them: the files client-registration writes to the shared volume or,
+// with --client-credentials-secret, CLIENT_ID and CLIENT_SECRET from the per-workload
+// Secret. client-registration writes no client-secret.txt in that mode.
+const credentialsCheck = `{ test -s /shared/client-id.txt || test -n "$CLIENT_ID"; } && ` +
+	`{ test -s /shared/client-secret.txt || test -n "$CLIENT_SECRET"; }`
+
+// envoyStartupCheck passes once envoy-proxy has the client credentials, the go-processor
+// serves ext_proc and the Envoy admin interface reports LIVE. The go-processor listens
+// before the credentials arrive, so they are checked separately. Both ports are bound to
+// 127.0.0.1, out of reach of kubelet probes, so bash's /dev/tcp talks to them from inside
+// the container.
+func envoyStartupCheck(adminPort int32) string {
+	return fmt.Sprintf(credentialsCheck+` && `+
+		`exec 3<>/dev/tcp/127.0.0.1/%d && `+
+		`exec 4<>/dev/tcp/127.0.0.1/%d && printf 'GET /ready HTTP/1.0\r\n\r\n' >&4 && grep -q LIVE <&4`,
+		ExtProcPort, adminPort)
+}
+
+// BuildEnvoyStartupProbe holds back the application, which starts after the native
+// sidecars, until Envoy can exchange tokens, so its first requests do not fail with 401
+func BuildEnvoyStartupProbe(adminPort int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler:     corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"bash", "-c", envoyStartupCheck(adminPort)}}},
+		PeriodSeconds:    1,
+		TimeoutSeconds:   2,
+		FailureThreshold: 180,
+	}
+}
+
+// BuildEnvoyReadinessProbe reports the pod unready while the registered client credentials,
+// which the ext_proc token exchange needs, are missing
+func BuildEnvoyReadinessProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{
+			"sh", "-c", credentialsCheck,
+		}}},
+		PeriodSeconds:  10,
+		TimeoutSeconds: 2,
+	}
+}
+
+// BuildEnvoyLivenessProbe restarts Envoy once its outbound listener stops accepting connections
+func BuildEnvoyLivenessProbe() *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler:     corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString("envoy-outbound")}},
+		PeriodSeconds:    10,
+		FailureThreshold: 3,
+	}
+}
+
+// BuildSpiffeHelperProbes returns the startup, readiness and liveness probes against
+// spiffe-helper's health_checks listener on port; helper.conf must enable the listener
+func BuildSpiffeHelperProbes(port int32) (startup, readiness, liveness *corev1.Probe) {
+	httpGet := func(path string) corev1.ProbeHandler {
+		return corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: path, Port: intstr.FromInt32(port)}}
+	}
+	startup = &corev1.Probe{ProbeHandler: httpGet(SpiffeHelperReadinessPath), PeriodSeconds: 1, FailureThreshold: 120}
+	readiness = &corev1.Probe{ProbeHandler: httpGet(SpiffeHelperReadinessPath), PeriodSeconds: 10}
+	liveness = &corev1.Probe{ProbeHandler: httpGet(SpiffeHelperLivenessPath), PeriodSeconds: 10, FailureThreshold: 3}
+	return startup, readiness, liveness
+}
+
+// InjectSidecarProbes adds the spiffe-helper probes when its health port is configured,
+// or strips the probes from all injected sidecars when the pod template opts out
+func (m *PodMutator) InjectSidecarProbes(podSpec *corev1.PodSpec, annotations map[string]string) {
+	disabled := annotations[SidecarProbesAnnotation] == "false"
+	for i := range podSpec.InitContainers {
+		container := &podSpec.InitContainers[i]
+		switch {
+		case container.Name != EnvoyProxyContainerName && container.Name != SpiffeHelperContainerName &&
+			container.Name != InboundAuthContainerName:
+			continue
+		case disabled:
+			container.StartupProbe, container.ReadinessProbe, container.LivenessProbe = nil, nil, nil
+		case container.Name == SpiffeHelperContainerName && m.SpiffeHelperHealthPort != 0 && container.StartupProbe == nil:
+			container.StartupProbe, container.ReadinessProbe, container.LivenessProbe = BuildSpiffeHelperProbes(m.SpiffeHelperHealthPort)
+		}
+	}
+}
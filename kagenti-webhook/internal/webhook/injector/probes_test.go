@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"os/exec"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Sidecar probes", func() {
+	inject := func(mutator *PodMutator, annotations map[string]string) map[string]corev1.Container {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Annotations = annotations
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+			SpireEnableLabel:      SpireEnabledValue,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		containers := map[string]corev1.Container{}
+		for _, c := range podTemplate.Spec.InitContainers {
+			containers[c.Name] = c
+		}
+		return containers
+	}
+
+	It("probes Envoy by default and leaves spiffe-helper alone", func() {
+		containers := inject(NewPodMutator(nil, true), nil)
+
+		envoy := containers[EnvoyProxyContainerName]
+		Expect(envoy.StartupProbe.Exec.Command).To(HaveLen(3))
+		Expect(envoy.StartupProbe.Exec.Command[2]).To(And(
+			ContainSubstring("test -s /shared/client-secret.txt || test -n \"$CLIENT_SECRET\""),
+			ContainSubstring("/dev/tcp/127.0.0.1/9090"),
+			ContainSubstring("/dev/tcp/127.0.0.1/9901"),
+			ContainSubstring("GET /ready")))
+		Expect(envoy.ReadinessProbe.Exec.Command).To(ContainElement(ContainSubstring("/shared/client-secret.txt")))
+		Expect(envoy.LivenessProbe).NotTo(BeNil())
+		Expect(containers[SpiffeHelperContainerName].StartupProbe).To(BeNil())
+		// client-registration runs to completion, where probes are not allowed
+		Expect(containers[ClientRegistrationContainerName].ReadinessProbe).To(BeNil())
+	})
+
+	It("passes the Envoy credential checks with credentials from the Secret", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.ClientCredentialsSecret = true
+		envoy := inject(mutator, nil)[EnvoyProxyContainerName]
+		Expect(envoy.Env).To(ContainElement(HaveField("Name", "CLIENT_SECRET")))
+		Expect(envoy.StartupProbe.Exec.Command[2]).To(HavePrefix(credentialsCheck + " && "))
+
+		// Without client-secret.txt, which client-registration does not write in Secret mode
+		check := func(env ...string) error {
+			cmd := exec.Command(envoy.ReadinessProbe.Exec.Command[0], envoy.ReadinessProbe.Exec.Command[1:]...)
+			cmd.Env = env
+			return cmd.Run()
+		}
+		Expect(check("CLIENT_ID=ns/app", "CLIENT_SECRET=secret")).To(Succeed())
+		Expect(check("CLIENT_ID=ns/app")).NotTo(Succeed())
+	})
+
+	It("checks the credentials before the ports in every Envoy startup probe", func() {
+		for _, annotations := range []map[string]string{
+			nil,
+			{EnvoyAdminAnnotation: string(EnvoyAdminDisabled)},
+			{EgressModeAnnotation: string(EgressModeIstio)},
+		} {
+			mutator := NewPodMutator(nil, true)
+			mutator.ClientCredentialsSecret = true
+			envoy := inject(mutator, annotations)[EnvoyProxyContainerName]
+			Expect(envoy.StartupProbe.Exec.Command[2]).To(HavePrefix(credentialsCheck+" && exec 3<>"), "%v", annotations)
+		}
+	})
+
+	It("probes spiffe-helper through its health_checks listener when configured", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.SpiffeHelperHealthPort = 8081
+		spiffeHelper := inject(mutator, nil)[SpiffeHelperContainerName]
+
+		Expect(spiffeHelper.StartupProbe.HTTPGet.Port.IntVal).To(Equal(int32(8081)))
+		Expect(spiffeHelper.ReadinessProbe.HTTPGet.Path).To(Equal(SpiffeHelperReadinessPath))
+		Expect(spiffeHelper.LivenessProbe.HTTPGet.Path).To(Equal(SpiffeHelperLivenessPath))
+	})
+
+	It("drops all sidecar probes when the pod template opts out", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.SpiffeHelperHealthPort = 8081
+		for _, c := range inject(mutator, map[string]string{SidecarProbesAnnotation: "false"}) {
+			Expect(c.StartupProbe).To(BeNil(), c.Name)
+			Expect(c.ReadinessProbe).To(BeNil(), c.Name)
+			Expect(c.LivenessProbe).To(BeNil(), c.Name)
+		}
+	})
+})
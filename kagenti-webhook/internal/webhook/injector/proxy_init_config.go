@@ -0,0 +1,322 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// ExcludeOutboundPortsAnnotation lists destination ports (comma-separated) that bypass Envoy
+	ExcludeOutboundPortsAnnotation = "kagenti.io/exclude-outbound-ports"
+	// ExcludeContainersAnnotation lists containers (comma-separated) whose outbound traffic bypasses Envoy
+	ExcludeContainersAnnotation = "kagenti.io/exclude-containers"
+	// ExcludeOutboundCIDRsAnnotation lists destination CIDRs (comma-separated) that bypass Envoy
+	ExcludeOutboundCIDRsAnnotation = "kagenti.io/exclude-outbound-cidrs"
+	// ExcludeUIDsAnnotation lists process UIDs (comma-separated) whose outbound traffic bypasses Envoy
+	ExcludeUIDsAnnotation = "kagenti.io/exclude-uids"
+	// OutboundCapturePortAnnotation is the Envoy port outbound traffic is redirected to
+	OutboundCapturePortAnnotation = "kagenti.io/outbound-capture-port"
+	// InboundCapturePortAnnotation is the Envoy port captured inbound traffic is redirected to
+	InboundCapturePortAnnotation = "kagenti.io/inbound-capture-port"
+	// IncludeInboundPortsAnnotation lists inbound ports (comma-separated, or "*") to capture
+	IncludeInboundPortsAnnotation = "kagenti.io/include-inbound-ports"
+	// InterceptionModeAnnotation selects REDIRECT or TPROXY for inbound capture
+	InterceptionModeAnnotation = "kagenti.io/interception-mode"
+	// IPFamiliesAnnotation selects the IP families proxy-init configures: auto, ipv4, ipv6 or dual
+	IPFamiliesAnnotation = "kagenti.io/ip-families"
+
+	// KeycloakPort is always excluded so client registration can reach Keycloak directly
+	KeycloakPort = 8080
+	// DefaultInboundCapturePort is where captured inbound traffic is sent unless overridden
+	DefaultInboundCapturePort = 15124
+)
+
+// InterceptionMode is how proxy-init steers captured inbound traffic to Envoy
+type InterceptionMode string
+
+const (
+	InterceptionModeRedirect InterceptionMode = "REDIRECT"
+	InterceptionModeTProxy   InterceptionMode = "TPROXY"
+)
+
+// IPFamilies selects whether proxy-init installs iptables rules, ip6tables rules or both
+type IPFamilies string
+
+const (
+	// IPFamiliesAuto configures every family the pod has a non-loopback address in
+	IPFamiliesAuto IPFamilies = "auto"
+	IPFamiliesIPv4 IPFamilies = "ipv4"
+	IPFamiliesIPv6 IPFamilies = "ipv6"
+	IPFamiliesDual IPFamilies = "dual"
+)
+
+// ProxyInitConfig holds the iptables parameters handed to the proxy-init container.
+// Manager-level defaults are set on PodMutator.ProxyInitDefaults and can be
+// overridden per workload with pod template annotations.
+type ProxyInitConfig struct {
+	// OutboundCapturePort is the Envoy listener outbound traffic is redirected to
+	OutboundCapturePort int32
+	// InboundCapturePort is the Envoy listener captured inbound traffic is redirected to
+	InboundCapturePort int32
+	// IncludeInboundPorts are the inbound ports to capture; "*" captures all, empty disables capture
+	IncludeInboundPorts []string
+	// ExcludeOutboundPorts are destination ports that are not redirected
+	ExcludeOutboundPorts []int32
+	// ExcludeOutboundCIDRs are destination ranges that are not redirected
+	ExcludeOutboundCIDRs []string
+	// ExcludeUIDs are process UIDs whose outbound traffic is not redirected
+	ExcludeUIDs []int64
+	// InterceptionMode applies to inbound capture; outbound traffic always uses REDIRECT
+	InterceptionMode InterceptionMode
+	// IPFamilies selects iptables, ip6tables or both; auto detects from the pod addresses
+	IPFamilies IPFamilies
+	// InboundAuthPort is the application port whose inbound traffic is redirected to the
+	// inbound-auth sidecar, 0 for none; it follows the kagenti.io/inbound-auth annotation
+	InboundAuthPort int32
+}
+
+// DefaultProxyInitConfig returns the configuration used when neither the manager nor the
+// workload overrides anything
+func DefaultProxyInitConfig() ProxyInitConfig {
+	return ProxyInitConfig{
+		OutboundCapturePort:  EnvoyProxyPort,
+		InboundCapturePort:   DefaultInboundCapturePort,
+		ExcludeOutboundPorts: []int32{KeycloakPort},
+		InterceptionMode:     InterceptionModeRedirect,
+		IPFamilies:           IPFamiliesAuto,
+	}
+}
+
+// Validate checks that ports, CIDRs and the interception mode are well formed
+func (c ProxyInitConfig) Validate() error {
+	for _, port := range append([]int32{c.OutboundCapturePort, c.InboundCapturePort}, c.ExcludeOutboundPorts...) {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("%d is not a valid port", port)
+		}
+	}
+	for _, port := range c.IncludeInboundPorts {
+		if port == "*" {
+			if len(c.IncludeInboundPorts) > 1 {
+				return fmt.Errorf(`"*" cannot be combined with other inbound ports`)
+			}
+			continue
+		}
+		if _, err := parsePort(port); err != nil {
+			return err
+		}
+	}
+	for _, cidr := range c.ExcludeOutboundCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("%q is not a valid CIDR", cidr)
+		}
+	}
+	for _, uid := range c.ExcludeUIDs {
+		if uid < 0 {
+			return fmt.Errorf("%d is not a valid UID", uid)
+		}
+	}
+	if c.InterceptionMode != InterceptionModeRedirect && c.InterceptionMode != InterceptionModeTProxy {
+		return fmt.Errorf("interception mode must be %s or %s, got %q",
+			InterceptionModeRedirect, InterceptionModeTProxy, c.InterceptionMode)
+	}
+	switch c.IPFamilies {
+	case IPFamiliesAuto, IPFamiliesIPv4, IPFamiliesIPv6, IPFamiliesDual:
+	default:
+		return fmt.Errorf("IP families must be %s, %s, %s or %s, got %q",
+			IPFamiliesAuto, IPFamiliesIPv4, IPFamiliesIPv6, IPFamiliesDual, c.IPFamilies)
+	}
+	return nil
+}
+
+// ProxyInitConfigFromAnnotations applies the pod template annotations on top of the
+// defaults. Port and CIDR exclusions are added to the defaults, the capture ports,
+// inbound ports and interception mode replace them.
+//
+// All containers share the pod network namespace, so iptables can only tell them apart
+// by UID: an excluded container must run with a runAsUser, and every container sharing
+// that UID is excluded as well.
+func ProxyInitConfigFromAnnotations(defaults ProxyInitConfig, annotations map[string]string, podSpec *corev1.PodSpec) (ProxyInitConfig, error) {
+	cfg := defaults
+	cfg.IncludeInboundPorts = slices.Clone(defaults.IncludeInboundPorts)
+	cfg.ExcludeOutboundPorts = slices.Clone(defaults.ExcludeOutboundPorts)
+	cfg.ExcludeOutboundCIDRs = slices.Clone(defaults.ExcludeOutboundCIDRs)
+	cfg.ExcludeUIDs = slices.Clone(defaults.ExcludeUIDs)
+
+	for _, item := range splitAnnotationList(annotations[ExcludeOutboundPortsAnnotation]) {
+		port, err := parsePort(item)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s annotation: %w", ExcludeOutboundPortsAnnotation, err)
+		}
+		if !slices.Contains(cfg.ExcludeOutboundPorts, port) {
+			cfg.ExcludeOutboundPorts = append(cfg.ExcludeOutboundPorts, port)
+		}
+	}
+
+	for _, cidr := range splitAnnotationList(annotations[ExcludeOutboundCIDRsAnnotation]) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return cfg, fmt.Errorf("invalid %s annotation: %q is not a valid CIDR", ExcludeOutboundCIDRsAnnotation, cidr)
+		}
+		if !slices.Contains(cfg.ExcludeOutboundCIDRs, cidr) {
+			cfg.ExcludeOutboundCIDRs = append(cfg.ExcludeOutboundCIDRs, cidr)
+		}
+	}
+
+	for _, item := range splitAnnotationList(annotations[ExcludeUIDsAnnotation]) {
+		uid, err := strconv.ParseInt(item, 10, 64)
+		if err != nil || uid < 0 {
+			return cfg, fmt.Errorf("invalid %s annotation: %q is not a valid UID", ExcludeUIDsAnnotation, item)
+		}
+		if !slices.Contains(cfg.ExcludeUIDs, uid) {
+			cfg.ExcludeUIDs = append(cfg.ExcludeUIDs, uid)
+		}
+	}
+
+	for _, name := range splitAnnotationList(annotations[ExcludeContainersAnnotation]) {
+		uid, err := containerUID(podSpec, name)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s annotation: %w", ExcludeContainersAnnotation, err)
+		}
+		if !slices.Contains(cfg.ExcludeUIDs, uid) {
+			cfg.ExcludeUIDs = append(cfg.ExcludeUIDs, uid)
+		}
+	}
+
+	for annotation, target := range map[string]*int32{
+		OutboundCapturePortAnnotation: &cfg.OutboundCapturePort,
+		InboundCapturePortAnnotation:  &cfg.InboundCapturePort,
+	} {
+		value, ok := annotations[annotation]
+		if !ok {
+			continue
+		}
+		port, err := parsePort(strings.TrimSpace(value))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s annotation: %w", annotation, err)
+		}
+		*target = port
+	}
+
+	if value, ok := annotations[IncludeInboundPortsAnnotation]; ok {
+		cfg.IncludeInboundPorts = splitAnnotationList(value)
+	}
+	if value, ok := annotations[InterceptionModeAnnotation]; ok {
+		cfg.InterceptionMode = InterceptionMode(strings.ToUpper(strings.TrimSpace(value)))
+	}
+	if value, ok := annotations[IPFamiliesAnnotation]; ok {
+		cfg.IPFamilies = IPFamilies(strings.ToLower(strings.TrimSpace(value)))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid traffic redirection settings: %w", err)
+	}
+	return cfg, nil
+}
+
+// Env renders the configuration as the environment consumed by init-iptables.sh
+func (c ProxyInitConfig) Env() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{
+			Name:  "PROXY_PORT",
+			Value: fmt.Sprintf("%d", c.OutboundCapturePort),
+		},
+		{
+			Name:  "PROXY_UID",
+			Value: fmt.Sprintf("%d", EnvoyProxyUID),
+		},
+		{
+			Name:  "INBOUND_PROXY_PORT",
+			Value: fmt.Sprintf("%d", c.InboundCapturePort),
+		},
+		{
+			Name:  "INTERCEPTION_MODE",
+			Value: string(c.InterceptionMode),
+		},
+		{
+			Name:  "IP_FAMILIES",
+			Value: string(c.IPFamilies),
+		},
+	}
+	if len(c.IncludeInboundPorts) > 0 {
+		env = append(env, corev1.EnvVar{Name: "INBOUND_PORTS_INCLUDE", Value: strings.Join(c.IncludeInboundPorts, ",")})
+	}
+	if c.InboundAuthPort != 0 {
+		env = append(env,
+			corev1.EnvVar{Name: "INBOUND_AUTH_PORT", Value: strconv.Itoa(int(c.InboundAuthPort))},
+			corev1.EnvVar{Name: "INBOUND_AUTH_PROXY_PORT", Value: strconv.Itoa(int(InboundAuthPort))},
+		)
+	}
+	if len(c.ExcludeOutboundPorts) > 0 {
+		ports := make([]string, 0, len(c.ExcludeOutboundPorts))
+		for _, port := range c.ExcludeOutboundPorts {
+			ports = append(ports, strconv.Itoa(int(port)))
+		}
+		env = append(env, corev1.EnvVar{Name: "OUTBOUND_PORTS_EXCLUDE", Value: strings.Join(ports, ",")})
+	}
+	if len(c.ExcludeOutboundCIDRs) > 0 {
+		env = append(env, corev1.EnvVar{Name: "OUTBOUND_IP_RANGES_EXCLUDE", Value: strings.Join(c.ExcludeOutboundCIDRs, ",")})
+	}
+	if len(c.ExcludeUIDs) > 0 {
+		uids := make([]string, 0, len(c.ExcludeUIDs))
+		for _, uid := range c.ExcludeUIDs {
+			uids = append(uids, strconv.FormatInt(uid, 10))
+		}
+		env = append(env, corev1.EnvVar{Name: "OUTBOUND_UIDS_EXCLUDE", Value: strings.Join(uids, ",")})
+	}
+	return env
+}
+
+// containerUID returns the effective runAsUser of the named application container
+func containerUID(podSpec *corev1.PodSpec, name string) (int64, error) {
+	for _, c := range podSpec.Containers {
+		if c.Name != name {
+			continue
+		}
+		if c.SecurityContext != nil && c.SecurityContext.RunAsUser != nil {
+			return *c.SecurityContext.RunAsUser, nil
+		}
+		if podSpec.SecurityContext != nil && podSpec.SecurityContext.RunAsUser != nil {
+			return *podSpec.SecurityContext.RunAsUser, nil
+		}
+		return 0, fmt.Errorf("container %q has no runAsUser, which is required to exclude it by UID", name)
+	}
+	return 0, fmt.Errorf("container %q not found", name)
+}
+
+func parsePort(value string) (int32, error) {
+	port, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("%q is not a valid port", value)
+	}
+	return int32(port), nil
+}
+
+func splitAnnotationList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
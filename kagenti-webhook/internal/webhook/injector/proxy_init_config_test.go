@@ -0,0 +1,145 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("ProxyInitConfig", func() {
+	var podSpec *corev1.PodSpec
+
+	BeforeEach(func() {
+		podSpec = &corev1.PodSpec{
+			SecurityContext: &corev1.PodSecurityContext{RunAsUser: ptr.To(int64(1000))},
+			Containers: []corev1.Container{
+				{Name: "app"},
+				{Name: "db-client", SecurityContext: &corev1.SecurityContext{RunAsUser: ptr.To(int64(2000))}},
+			},
+		}
+	})
+
+	envValue := func(cfg ProxyInitConfig, name string) string {
+		for _, env := range cfg.Env() {
+			if env.Name == name {
+				return env.Value
+			}
+		}
+		return ""
+	}
+
+	It("always excludes the Keycloak port", func() {
+		cfg, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), nil, podSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envValue(cfg, "OUTBOUND_PORTS_EXCLUDE")).To(Equal("8080"))
+		Expect(envValue(cfg, "OUTBOUND_UIDS_EXCLUDE")).To(BeEmpty())
+	})
+
+	It("converts port and container annotations into proxy-init arguments", func() {
+		cfg, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{
+			ExcludeOutboundPortsAnnotation: "5432, 9090,8080",
+			ExcludeContainersAnnotation:    "db-client,app",
+		}, podSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envValue(cfg, "OUTBOUND_PORTS_EXCLUDE")).To(Equal("8080,5432,9090"))
+		Expect(envValue(cfg, "OUTBOUND_UIDS_EXCLUDE")).To(Equal("2000,1000"))
+	})
+
+	It("rejects invalid ports", func() {
+		_, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{ExcludeOutboundPortsAnnotation: "70000"}, podSpec)
+		Expect(err).To(MatchError(ContainSubstring(ExcludeOutboundPortsAnnotation)))
+	})
+
+	It("rejects containers that do not exist or have no UID", func() {
+		_, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{ExcludeContainersAnnotation: "missing"}, podSpec)
+		Expect(err).To(MatchError(ContainSubstring("not found")))
+
+		podSpec.SecurityContext = nil
+		_, err = ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{ExcludeContainersAnnotation: "app"}, podSpec)
+		Expect(err).To(MatchError(ContainSubstring("runAsUser")))
+	})
+
+	It("layers annotations over manager-level defaults", func() {
+		defaults := DefaultProxyInitConfig()
+		defaults.ExcludeOutboundCIDRs = []string{"10.96.0.0/12"}
+		defaults.IncludeInboundPorts = []string{"8000"}
+
+		cfg, err := ProxyInitConfigFromAnnotations(defaults, map[string]string{
+			ExcludeOutboundCIDRsAnnotation: "169.254.169.254/32",
+			ExcludeUIDsAnnotation:          "3000",
+			IncludeInboundPortsAnnotation:  "*",
+			InboundCapturePortAnnotation:   "15006",
+			InterceptionModeAnnotation:     "tproxy",
+		}, podSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envValue(cfg, "OUTBOUND_IP_RANGES_EXCLUDE")).To(Equal("10.96.0.0/12,169.254.169.254/32"))
+		Expect(envValue(cfg, "OUTBOUND_UIDS_EXCLUDE")).To(Equal("3000"))
+		Expect(envValue(cfg, "INBOUND_PORTS_INCLUDE")).To(Equal("*"))
+		Expect(envValue(cfg, "INBOUND_PROXY_PORT")).To(Equal("15006"))
+		Expect(envValue(cfg, "INTERCEPTION_MODE")).To(Equal("TPROXY"))
+		Expect(envValue(cfg, "PROXY_PORT")).To(Equal("15123"))
+
+		// The defaults themselves are left untouched
+		Expect(defaults.ExcludeOutboundCIDRs).To(Equal([]string{"10.96.0.0/12"}))
+	})
+
+	DescribeTable("rejects invalid redirect parameters",
+		func(annotation, value string) {
+			_, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{annotation: value}, podSpec)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("CIDR", ExcludeOutboundCIDRsAnnotation, "10.0.0.0/33"),
+		Entry("UID", ExcludeUIDsAnnotation, "-1"),
+		Entry("capture port", OutboundCapturePortAnnotation, "0"),
+		Entry("inbound ports mixing *", IncludeInboundPortsAnnotation, "*,8080"),
+		Entry("interception mode", InterceptionModeAnnotation, "NFQUEUE"),
+		Entry("IP families", IPFamiliesAnnotation, "ipv5"),
+	)
+
+	It("configures IPv6 and dual-stack redirection", func() {
+		cfg, err := ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), nil, podSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envValue(cfg, "IP_FAMILIES")).To(Equal("auto"))
+
+		cfg, err = ProxyInitConfigFromAnnotations(DefaultProxyInitConfig(), map[string]string{
+			IPFamiliesAnnotation:           "Dual",
+			ExcludeOutboundCIDRsAnnotation: "10.96.0.0/12,fd00:10:96::/112",
+		}, podSpec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envValue(cfg, "IP_FAMILIES")).To(Equal("dual"))
+		Expect(envValue(cfg, "OUTBOUND_IP_RANGES_EXCLUDE")).To(Equal("10.96.0.0/12,fd00:10:96::/112"))
+	})
+
+	It("is applied to the injected proxy-init container", func() {
+		mutator := NewPodMutator(nil, true)
+		podTemplate := &corev1.PodTemplateSpec{Spec: *podSpec}
+		podTemplate.Annotations = map[string]string{ExcludeOutboundPortsAnnotation: "5432"}
+
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(podTemplate.Spec.InitContainers[0].Name).To(Equal(ProxyInitContainerName))
+		Expect(podTemplate.Spec.InitContainers[0].Env).To(ContainElement(
+			corev1.EnvVar{Name: "OUTBOUND_PORTS_EXCLUDE", Value: "8080,5432"}))
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+// quotaResource is the container resource a ResourceQuota key counts, and whether it
+// counts limits rather than requests
+type quotaResource struct {
+	name   corev1.ResourceName
+	limits bool
+}
+
+// quotaResources are the ResourceQuota keys the injected containers add to
+var quotaResources = map[corev1.ResourceName]quotaResource{
+	corev1.ResourceCPU:            {name: corev1.ResourceCPU},
+	corev1.ResourceRequestsCPU:    {name: corev1.ResourceCPU},
+	corev1.ResourceMemory:         {name: corev1.ResourceMemory},
+	corev1.ResourceRequestsMemory: {name: corev1.ResourceMemory},
+	corev1.ResourceLimitsCPU:      {name: corev1.ResourceCPU, limits: true},
+	corev1.ResourceLimitsMemory:   {name: corev1.ResourceMemory, limits: true},
+}
+
+// CheckResourceQuota returns an admission warning for each ResourceQuota of the namespace
+// that replicas pods of the mutated podSpec would exceed, with the share of the injected
+// sidecars, so that a ReplicaSet that cannot create its pods is reported at admission.
+// Quotas with scopes, which may not apply to the pods, are skipped. Lookup errors are
+// logged and do not block admission.
+func (m *PodMutator) CheckResourceQuota(ctx context.Context, namespace string, podSpec *corev1.PodSpec, replicas int32) []string {
+	if m.Client == nil || replicas <= 0 {
+		return nil
+	}
+	ctx, span := obs.StartSpan(ctx, "check ResourceQuotas", attribute.String("k8s.namespace.name", namespace))
+	defer span.End()
+	quotas := &corev1.ResourceQuotaList{}
+	if err := m.Client.List(ctx, quotas, client.InNamespace(namespace)); err != nil {
+		mutatorLog.Error(err, "Failed to list ResourceQuotas", "namespace", namespace)
+		return nil
+	}
+
+	application := podSpec.DeepCopy()
+	application.InitContainers = slices.DeleteFunc(application.InitContainers, isInjectedContainer)
+	application.Containers = slices.DeleteFunc(application.Containers, isInjectedContainer)
+
+	var warnings []string
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		keys := make([]corev1.ResourceName, 0, len(quota.Status.Hard))
+		for key := range quota.Status.Hard {
+			if _, ok := quotaResources[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			counted := quotaResources[key]
+			total := podResource(podSpec, counted)
+			without := podResource(application, counted)
+			total.Mul(int64(replicas))
+			without.Mul(int64(replicas))
+
+			available := quota.Status.Hard[key].DeepCopy()
+			available.Sub(quota.Status.Used[key])
+			if total.Cmp(available) <= 0 {
+				continue
+			}
+			sidecars := total.DeepCopy()
+			sidecars.Sub(without)
+			shortfall := total.DeepCopy()
+			shortfall.Sub(available)
+			warnings = append(warnings, fmt.Sprintf(
+				"ResourceQuota %q in namespace %q: %d pod(s) need %s of %s, %s of it for the AuthBridge sidecars, "+
+					"but only %s is available; raise the quota by %s or lower the sidecar resources",
+				quota.Name, namespace, replicas, total.String(), key, sidecars.String(), available.String(), shortfall.String()))
+		}
+	}
+	return warnings
+}
+
+func isInjectedContainer(c corev1.Container) bool {
+	return slices.Contains(injectedContainerNames, c.Name)
+}
+
+// podResource is the effective request or limit of a pod as the quota counts it: the
+// containers and native sidecars run together, and each run-to-completion init container
+// runs next to the sidecars started before it, whichever needs more
+func podResource(podSpec *corev1.PodSpec, counted quotaResource) resource.Quantity {
+	containerResource := func(c corev1.Container) resource.Quantity {
+		if !counted.limits {
+			if q, ok := c.Resources.Requests[counted.name]; ok {
+				return q.DeepCopy()
+			}
+		}
+		// requests default to the limits
+		return c.Resources.Limits[counted.name].DeepCopy()
+	}
+
+	var sidecars, peak resource.Quantity
+	for _, c := range podSpec.InitContainers {
+		q := containerResource(c)
+		if c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			sidecars.Add(q)
+			continue
+		}
+		q.Add(sidecars)
+		if q.Cmp(peak) > 0 {
+			peak = q
+		}
+	}
+	running := sidecars.DeepCopy()
+	for _, c := range podSpec.Containers {
+		running.Add(containerResource(c))
+	}
+	if running.Cmp(peak) > 0 {
+		return running
+	}
+	return peak
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("CheckResourceQuota", func() {
+	var podSpec *corev1.PodSpec
+
+	quota := func(name string, hard, used corev1.ResourceList) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team1"},
+			Spec:       corev1.ResourceQuotaSpec{Hard: hard},
+			Status:     corev1.ResourceQuotaStatus{Hard: hard, Used: used},
+		}
+	}
+	mutatorWith := func(quotas ...*corev1.ResourceQuota) *PodMutator {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		builder := fake.NewClientBuilder().WithScheme(scheme)
+		for _, q := range quotas {
+			builder = builder.WithObjects(q)
+		}
+		return NewPodMutator(builder.Build(), true)
+	}
+
+	BeforeEach(func() {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "app",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU: resource.MustParse("100m"),
+			}},
+		}}}}
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "team1", "agent",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue})
+		Expect(err).NotTo(HaveOccurred())
+		podSpec = &podTemplate.Spec
+	})
+
+	It("reports the shortfall of an exceeded quota", func() {
+		// the application and Envoy run together: 150m per pod, 50m of it for Envoy
+		mutator := mutatorWith(quota("compute",
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")},
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("800m")}))
+
+		warnings := mutator.CheckResourceQuota(context.Background(), "team1", podSpec, 2)
+		Expect(warnings).To(ConsistOf(And(
+			ContainSubstring(`ResourceQuota "compute"`),
+			ContainSubstring("2 pod(s) need 300m of requests.cpu, 100m of it for the AuthBridge sidecars"),
+			ContainSubstring("only 200m is available; raise the quota by 100m"),
+		)))
+
+		Expect(mutator.CheckResourceQuota(context.Background(), "team1", podSpec, 1)).To(BeEmpty())
+	})
+
+	It("skips quotas that do not constrain the pods", func() {
+		scoped := quota("best-effort",
+			corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("100m")}, nil)
+		scoped.Spec.Scopes = []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeNotBestEffort}
+		mutator := mutatorWith(scoped, quota("objects",
+			corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")},
+			corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}))
+
+		Expect(mutator.CheckResourceQuota(context.Background(), "team1", podSpec, 1)).To(BeEmpty())
+		Expect(NewPodMutator(nil, true).CheckResourceQuota(context.Background(), "team1", podSpec, 1)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,69 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// RegistrationTimeoutAnnotation bounds how long client-registration waits for the SVID
+	// and Keycloak, as a duration such as "2m". "0" waits forever.
+	RegistrationTimeoutAnnotation = "kagenti.io/registration-timeout"
+
+	// RegistrationTimeoutEnv is read by the client-registration script
+	RegistrationTimeoutEnv = "REGISTRATION_TIMEOUT_SECONDS"
+
+	// DefaultJobRegistrationTimeout applies to pods that run to completion, so that a Job
+	// whose registration cannot succeed fails instead of hanging in its init containers
+	DefaultJobRegistrationTimeout = 5 * time.Minute
+)
+
+// RegistrationTimeoutFor returns the registration deadline of the pod template: the
+// annotation if set, DefaultJobRegistrationTimeout for Job and CronJob pods, whose restart
+// policy is Never or OnFailure, and no deadline otherwise
+func RegistrationTimeoutFor(podSpec *corev1.PodSpec, annotations map[string]string) (time.Duration, error) {
+	if value, ok := annotations[RegistrationTimeoutAnnotation]; ok {
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout != 0 && timeout < time.Second {
+			return 0, fmt.Errorf("invalid %s annotation %q: must be a duration of at least 1s, or 0", RegistrationTimeoutAnnotation, value)
+		}
+		return timeout, nil
+	}
+	if podSpec.RestartPolicy == corev1.RestartPolicyNever || podSpec.RestartPolicy == corev1.RestartPolicyOnFailure {
+		return DefaultJobRegistrationTimeout, nil
+	}
+	return 0, nil
+}
+
+// InjectRegistrationTimeout makes client-registration fail once timeout passes without a
+// registered client; a zero timeout leaves it waiting
+func (m *PodMutator) InjectRegistrationTimeout(podSpec *corev1.PodSpec, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	for i := range podSpec.InitContainers {
+		if podSpec.InitContainers[i].Name == ClientRegistrationContainerName {
+			setEnv(&podSpec.InitContainers[i], RegistrationTimeoutEnv, strconv.Itoa(int(timeout.Seconds())))
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Registration timeout", func() {
+	inject := func(restartPolicy corev1.RestartPolicy, annotations map[string]string) (*corev1.PodTemplateSpec, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			RestartPolicy: restartPolicy,
+			Containers:    []corev1.Container{{Name: "app"}},
+		}}
+		podTemplate.Annotations = annotations
+		_, err := NewPodMutator(nil, true).InjectAuthBridge(context.Background(), podTemplate, "team1", "report",
+			map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue})
+		return podTemplate, err
+	}
+	registrationTimeout := func(podTemplate *corev1.PodTemplateSpec) (string, bool) {
+		for _, c := range podTemplate.Spec.InitContainers {
+			if c.Name != ClientRegistrationContainerName {
+				continue
+			}
+			for _, e := range c.Env {
+				if e.Name == RegistrationTimeoutEnv {
+					return e.Value, true
+				}
+			}
+		}
+		return "", false
+	}
+
+	It("bounds the registration of Job pods", func() {
+		for _, policy := range []corev1.RestartPolicy{corev1.RestartPolicyNever, corev1.RestartPolicyOnFailure} {
+			podTemplate, err := inject(policy, nil)
+			Expect(err).NotTo(HaveOccurred())
+			timeout, ok := registrationTimeout(podTemplate)
+			Expect(ok).To(BeTrue(), string(policy))
+			Expect(timeout).To(Equal("300"))
+		}
+	})
+
+	It("leaves long-running pods waiting unless annotated", func() {
+		podTemplate, err := inject("", nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := registrationTimeout(podTemplate)
+		Expect(ok).To(BeFalse())
+
+		podTemplate, err = inject(corev1.RestartPolicyAlways, map[string]string{RegistrationTimeoutAnnotation: "90s"})
+		Expect(err).NotTo(HaveOccurred())
+		timeout, _ := registrationTimeout(podTemplate)
+		Expect(timeout).To(Equal("90"))
+	})
+
+	It("lets Jobs opt out and rejects invalid durations", func() {
+		podTemplate, err := inject(corev1.RestartPolicyNever, map[string]string{RegistrationTimeoutAnnotation: "0"})
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := registrationTimeout(podTemplate)
+		Expect(ok).To(BeFalse())
+
+		for _, invalid := range []string{"soon", "-1m", "500ms"} {
+			_, err := inject(corev1.RestartPolicyNever, map[string]string{RegistrationTimeoutAnnotation: invalid})
+			Expect(err).To(MatchError(ContainSubstring(RegistrationTimeoutAnnotation)), invalid)
+		}
+	})
+})
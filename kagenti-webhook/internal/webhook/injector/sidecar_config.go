@@ -0,0 +1,119 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// SidecarResourcesAnnotation selects one of the resource profiles of the sidecar configuration
+const SidecarResourcesAnnotation = "kagenti.io/sidecar-resources"
+
+// SidecarConfig overrides the images, pull policy and resources of the injected containers,
+// keyed by container name. Unset fields keep the built-in defaults.
+type SidecarConfig struct {
+	Images          map[string]string                      `json:"images,omitempty"`
+	ImagePullPolicy corev1.PullPolicy                      `json:"imagePullPolicy,omitempty"`
+	Resources       map[string]corev1.ResourceRequirements `json:"resources,omitempty"`
+	// ResourceProfiles are named resources that workloads select with kagenti.io/sidecar-resources
+	ResourceProfiles map[string]map[string]corev1.ResourceRequirements `json:"resourceProfiles,omitempty"`
+}
+
+// LoadSidecarConfig reads a SidecarConfig from a YAML (or JSON) file
+func LoadSidecarConfig(path string) (SidecarConfig, error) {
+	var cfg SidecarConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read sidecar configuration: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse sidecar configuration %s: %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate rejects unknown container names and pull policies
+func (c SidecarConfig) Validate() error {
+	switch c.ImagePullPolicy {
+	case "", corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return fmt.Errorf("image pull policy must be %s, %s or %s, got %q",
+			corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever, c.ImagePullPolicy)
+	}
+	check := func(what string, names []string) error {
+		for _, name := range names {
+			if !slices.Contains(injectedContainerNames, name) {
+				return fmt.Errorf("%s for unknown container %q, expected one of %v", what, name, injectedContainerNames)
+			}
+		}
+		return nil
+	}
+	if err := check("image", slices.Sorted(maps.Keys(c.Images))); err != nil {
+		return err
+	}
+	if err := check("resources", slices.Sorted(maps.Keys(c.Resources))); err != nil {
+		return err
+	}
+	for profile, resources := range c.ResourceProfiles {
+		if err := check(fmt.Sprintf("resource profile %q has resources", profile), slices.Sorted(maps.Keys(resources))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply overrides the built-in image, pull policy and resources of a freshly built container
+func (c SidecarConfig) apply(container corev1.Container) corev1.Container {
+	if image, ok := c.Images[container.Name]; ok && image != "" {
+		container.Image = image
+	}
+	if c.ImagePullPolicy != "" {
+		container.ImagePullPolicy = c.ImagePullPolicy
+	}
+	if resources, ok := c.Resources[container.Name]; ok {
+		container.Resources = resources
+	}
+	return container
+}
+
+// SidecarResourceProfileFor returns the profile requested by the annotations; empty means the defaults apply
+func SidecarResourceProfileFor(annotations map[string]string) string {
+	return annotations[SidecarResourcesAnnotation]
+}
+
+// InjectSidecarResourceProfile replaces the resources of the injected containers the named profile lists
+func (m *PodMutator) InjectSidecarResourceProfile(podSpec *corev1.PodSpec, name string) error {
+	profile, ok := m.SidecarConfig.ResourceProfiles[name]
+	if !ok {
+		return fmt.Errorf("unknown sidecar resource profile %q in %s annotation", name, SidecarResourcesAnnotation)
+	}
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if resources, ok := profile[containers[i].Name]; ok {
+				containers[i].Resources = resources
+			}
+		}
+	}
+	mutatorLog.Info("Applied sidecar resource profile", "profile", name)
+	return nil
+}
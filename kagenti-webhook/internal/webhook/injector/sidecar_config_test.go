@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Sidecar configuration", func() {
+	writeConfig := func(content string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "sidecars.yaml")
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+		return path
+	}
+
+	inject := func(mutator *PodMutator, annotations map[string]string) (map[string]corev1.Container, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}
+		podTemplate.Annotations = annotations
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "ns", "app", map[string]string{
+			AuthBridgeInjectLabel: AuthBridgeInjectValue,
+			SpireEnableLabel:      SpireEnabledValue,
+		})
+		containers := map[string]corev1.Container{}
+		for _, c := range podTemplate.Spec.InitContainers {
+			containers[c.Name] = c
+		}
+		return containers, err
+	}
+
+	memoryLimit := func(c corev1.Container) string {
+		limit := c.Resources.Limits[corev1.ResourceMemory]
+		return limit.String()
+	}
+
+	It("overrides images, pull policy and resources of the injected containers", func() {
+		cfg, err := LoadSidecarConfig(writeConfig(`
+images:
+  envoy-proxy: registry.example.com/envoy:v1
+  spiffe-helper: ghcr.io/spiffe/spiffe-helper:0.10.0
+imagePullPolicy: Always
+resources:
+  envoy-proxy:
+    limits:
+      memory: 512Mi
+resourceProfiles:
+  large:
+    envoy-proxy:
+      limits:
+        memory: 1Gi
+`))
+		Expect(err).NotTo(HaveOccurred())
+		mutator := NewPodMutator(nil, true)
+		mutator.SidecarConfig = cfg
+
+		containers, err := inject(mutator, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers[EnvoyProxyContainerName].Image).To(Equal("registry.example.com/envoy:v1"))
+		Expect(containers[SpiffeHelperContainerName].Image).To(Equal("ghcr.io/spiffe/spiffe-helper:0.10.0"))
+		Expect(containers[ProxyInitContainerName].Image).To(Equal(DefaultProxyInitImage))
+		for _, c := range containers {
+			Expect(c.ImagePullPolicy).To(Equal(corev1.PullAlways), c.Name)
+		}
+		Expect(memoryLimit(containers[EnvoyProxyContainerName])).To(Equal("512Mi"))
+		Expect(containers[EnvoyProxyContainerName].Resources.Requests).To(BeEmpty())
+
+		containers, err = inject(mutator, map[string]string{SidecarResourcesAnnotation: "large"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(memoryLimit(containers[EnvoyProxyContainerName])).To(Equal("1Gi"))
+		Expect(memoryLimit(containers[SpiffeHelperContainerName])).To(Equal("128Mi"))
+	})
+
+	It("keeps the built-in defaults without a configuration", func() {
+		containers, err := inject(NewPodMutator(nil, true), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(containers[EnvoyProxyContainerName].Image).To(Equal(DefaultEnvoyImage))
+		Expect(containers[EnvoyProxyContainerName].ImagePullPolicy).To(Equal(corev1.PullIfNotPresent))
+	})
+
+	It("rejects unknown containers, pull policies and profiles", func() {
+		_, err := LoadSidecarConfig(writeConfig("images:\n  envoy: envoy:v1\n"))
+		Expect(err).To(MatchError(ContainSubstring(`unknown container "envoy"`)))
+		_, err = LoadSidecarConfig(writeConfig("imagePullPolicy: Sometimes\n"))
+		Expect(err).To(MatchError(ContainSubstring("image pull policy")))
+		_, err = LoadSidecarConfig(writeConfig("image: envoy:v1\n"))
+		Expect(err).To(HaveOccurred())
+
+		_, err = inject(NewPodMutator(nil, true), map[string]string{SidecarResourcesAnnotation: "huge"})
+		Expect(err).To(MatchError(ContainSubstring(`unknown sidecar resource profile "huge"`)))
+	})
+})
@@ -0,0 +1,84 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// InjectedPorts maps the ports the injected sidecars listen on, in the pod's shared network
+// namespace, to the container that owns them
+func (m *PodMutator) InjectedPorts(spireEnabled bool) map[int32]string {
+	podSpec := &corev1.PodSpec{}
+	// The names only feed the client-registration environment, which has no ports
+	_ = m.InjectSidecarsWithSpireOption(podSpec, "", "", spireEnabled)
+	ports := map[int32]string{}
+	for _, container := range podSpec.InitContainers {
+		for _, port := range container.Ports {
+			ports[port.ContainerPort] = container.Name
+		}
+	}
+	if spireEnabled && m.SpiffeHelperHealthPort != 0 {
+		ports[m.SpiffeHelperHealthPort] = SpiffeHelperContainerName
+	}
+	return ports
+}
+
+// SidecarConflicts returns one warning for each part of podSpec that would win over, or
+// clash with, what the webhook injects: containers and volumes named like the injected
+// ones but defined differently are kept as they are, and application containers must not
+// listen on the sidecar ports. Containers and volumes the webhook injected itself match
+// their definition and are not reported.
+func (m *PodMutator) SidecarConflicts(podSpec *corev1.PodSpec, namespace, crName string, spireEnabled bool) []string {
+	injected := &corev1.PodSpec{}
+	_ = m.InjectSidecarsWithSpireOption(injected, namespace, crName, spireEnabled)
+	_ = m.InjectVolumesWithSpireOption(injected, spireEnabled)
+
+	var warnings []string
+	sidecars := map[string]corev1.Container{}
+	for _, c := range injected.InitContainers {
+		sidecars[c.Name] = c
+	}
+	ports := m.InjectedPorts(spireEnabled)
+	for _, c := range append(append([]corev1.Container{}, podSpec.InitContainers...), podSpec.Containers...) {
+		if sidecar, ok := sidecars[c.Name]; ok {
+			if c.Image != sidecar.Image {
+				warnings = append(warnings, fmt.Sprintf(
+					"container %q overrides the injected sidecar: image %q is used instead of %q", c.Name, c.Image, sidecar.Image))
+			}
+			continue
+		}
+		for _, port := range c.Ports {
+			if owner, ok := ports[port.ContainerPort]; ok {
+				warnings = append(warnings, fmt.Sprintf(
+					"container %q port %d is also used by the injected %s container", c.Name, port.ContainerPort, owner))
+			}
+		}
+	}
+	for _, vol := range podSpec.Volumes {
+		for _, want := range injected.Volumes {
+			if vol.Name == want.Name && !equality.Semantic.DeepEqual(vol.VolumeSource, want.VolumeSource) {
+				warnings = append(warnings, fmt.Sprintf(
+					"volume %q overrides the volume the sidecars expect under that name", vol.Name))
+			}
+		}
+	}
+	return warnings
+}
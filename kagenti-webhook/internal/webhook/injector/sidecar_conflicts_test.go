@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("SidecarConflicts", func() {
+	var mutator *PodMutator
+
+	BeforeEach(func() {
+		mutator = NewPodMutator(nil, true)
+	})
+
+	It("does not report the sidecars and volumes the webhook injected", func() {
+		podSpec := &corev1.PodSpec{Containers: []corev1.Container{{Name: "fetch"}}}
+		Expect(mutator.InjectSidecarsWithSpireOption(podSpec, "ns", "fetch", true)).To(Succeed())
+		Expect(mutator.InjectVolumesWithSpireOption(podSpec, true)).To(Succeed())
+		Expect(mutator.SidecarConflicts(podSpec, "ns", "fetch", true)).To(BeEmpty())
+	})
+
+	It("reports overridden sidecars, volumes and clashing ports", func() {
+		podSpec := &corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: EnvoyProxyContainerName, Image: "envoyproxy/envoy:custom"}},
+			Containers: []corev1.Container{{
+				Name:  "fetch",
+				Ports: []corev1.ContainerPort{{ContainerPort: 8000}, {ContainerPort: EnvoyAdminPort}},
+			}},
+			Volumes: []corev1.Volume{{Name: "shared-data", VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: "/tmp"},
+			}}},
+		}
+		Expect(mutator.SidecarConflicts(podSpec, "ns", "fetch", false)).To(ConsistOf(
+			ContainSubstring(`container "envoy-proxy" overrides the injected sidecar`),
+			ContainSubstring(`container "fetch" port 9901 is also used by the injected envoy-proxy container`),
+			ContainSubstring(`volume "shared-data" overrides`),
+		))
+	})
+
+	It("counts the spiffe-helper health port only with SPIRE", func() {
+		mutator.SpiffeHelperHealthPort = 8081
+		Expect(mutator.InjectedPorts(true)).To(HaveKeyWithValue(int32(8081), SpiffeHelperContainerName))
+		Expect(mutator.InjectedPorts(false)).NotTo(HaveKey(int32(8081)))
+	})
+})
+
+var _ = Describe("ValidateSpiffeID", func() {
+	It("accepts the IDs SPIRE issues to service accounts", func() {
+		Expect(ValidateSpiffeID("example.org", SpiffeIDPath("team1", "fetch-sa"))).To(Succeed())
+		Expect(ValidateSpiffeID("", SpiffeIDPath("team1", "fetch-sa"))).To(Succeed())
+	})
+
+	It("rejects malformed trust domains and paths", func() {
+		Expect(ValidateSpiffeID("Example.org", "/ns/a/sa/b")).To(MatchError(ContainSubstring("trust domain")))
+		Expect(ValidateSpiffeID("example.org", "/ns//sa/b")).To(MatchError(ContainSubstring("empty")))
+		Expect(ValidateSpiffeID("example.org", "/ns/a/sa/b:c")).To(MatchError(ContainSubstring("may only contain")))
+	})
+
+	It("rejects IDs longer than a Keycloak client ID", func() {
+		err := ValidateSpiffeID("example.org", SpiffeIDPath("team1", strings.Repeat("a", 240)))
+		Expect(err).To(MatchError(ContainSubstring("limited to 255")))
+	})
+})
@@ -0,0 +1,156 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+var updateSnapshots = flag.Bool("update-snapshots", false, "rewrite the injection snapshots in testdata/snapshots/")
+
+// The snapshots are the complete mutated objects, so that an injection change shows up in
+// review as a diff of testdata/snapshots/*.yaml. Run the suite with -update-snapshots to
+// rewrite them after an intended change.
+var _ = Describe("Injection snapshots", func() {
+	var mutator *PodMutator
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team1"}}
+		mutator = NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespace).Build(), true)
+	})
+
+	customImages := func(m *PodMutator) {
+		m.SidecarConfig = SidecarConfig{
+			Images: map[string]string{
+				ProxyInitContainerName:          "registry.example.com/kagenti/proxy-init:v1",
+				ClientRegistrationContainerName: "registry.example.com/kagenti/client-registration:v1",
+				EnvoyProxyContainerName:         "registry.example.com/kagenti/envoy:v1",
+				SpiffeHelperContainerName:       "registry.example.com/kagenti/spiffe-helper:v1",
+			},
+			ImagePullPolicy: corev1.PullAlways,
+		}
+		m.ImagePullSecrets = []string{"registry-credentials"}
+	}
+
+	DescribeTable("Deployments",
+		func(snapshot string, configure func(*PodMutator), labels, annotations map[string]string) {
+			if configure != nil {
+				configure(mutator)
+			}
+			deployment := snapshotDeployment(labels, annotations)
+			Expect(mutator.InjectAuthBridge(context.Background(), &deployment.Spec.Template, deployment.Namespace,
+				deployment.Name, deployment.Labels)).To(BeTrue())
+			expectSnapshot(deployment, snapshot)
+		},
+		Entry("default configuration", "deployment-default", nil, nil, nil),
+		Entry("SPIRE adds spiffe-helper", "deployment-spire", nil,
+			map[string]string{SpireEnableLabel: SpireEnabledValue}, nil),
+		Entry("proxy-only egress through the proxy variables", "deployment-proxy-env", nil,
+			nil, map[string]string{EgressModeAnnotation: string(EgressModeProxyEnv)}),
+		Entry("custom sidecar images", "deployment-custom-images", customImages,
+			map[string]string{SpireEnableLabel: SpireEnabledValue}, nil),
+	)
+
+	DescribeTable("MCPServers",
+		func(snapshot string, configure func(*PodMutator), labels map[string]string) {
+			if configure != nil {
+				configure(mutator)
+			}
+			server := snapshotMCPServer(labels)
+			Expect(mutator.MutateMCPServerPodTemplate(context.Background(), server.Spec.PodTemplateSpec, server.Namespace,
+				server.Name, server.Labels, server.Annotations)).To(Succeed())
+			expectSnapshot(server, snapshot)
+		},
+		Entry("SPIRE by default", "mcpserver-spire", nil, nil),
+		Entry("without SPIRE", "mcpserver-no-spire", nil, map[string]string{SpireEnableLabel: SpireDisabledValue}),
+		Entry("custom sidecar images", "mcpserver-custom-images", customImages, nil),
+	)
+})
+
+func snapshotDeployment(labels, annotations map[string]string) *appsv1.Deployment {
+	workloadLabels := map[string]string{"app": "weather"}
+	for k, v := range labels {
+		workloadLabels[k] = v
+	}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "weather", Namespace: "team1", Labels: workloadLabels},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "weather"}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      map[string]string{"app": "weather", AuthBridgeInjectLabel: AuthBridgeInjectValue},
+					Annotations: annotations,
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:  "agent",
+					Image: "weather:latest",
+					Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8000}},
+				}}},
+			},
+		},
+	}
+}
+
+func snapshotMCPServer(labels map[string]string) *toolhivestacklokdevv1alpha1.MCPServer {
+	serverLabels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+	for k, v := range labels {
+		serverLabels[k] = v
+	}
+	return &toolhivestacklokdevv1alpha1.MCPServer{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "toolhive.stacklok.dev/v1alpha1", Kind: "MCPServer"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fetch", Namespace: "team1", Labels: serverLabels},
+		Spec: toolhivestacklokdevv1alpha1.MCPServerSpec{
+			Image:           "fetch:latest",
+			PodTemplateSpec: &corev1.PodTemplateSpec{},
+		},
+	}
+}
+
+// expectSnapshot compares obj rendered as YAML with testdata/snapshots/<snapshot>.yaml
+func expectSnapshot(obj client.Object, snapshot string) {
+	actual, err := yaml.Marshal(obj)
+	Expect(err).NotTo(HaveOccurred())
+
+	path := filepath.Join("testdata", "snapshots", snapshot+".yaml")
+	if *updateSnapshots {
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, actual, 0o644)).To(Succeed())
+		return
+	}
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred(), "missing snapshot; run the suite with -update-snapshots")
+	Expect(string(actual)).To(Equal(string(expected)), "%s differs from %s", obj.GetName(), path)
+}
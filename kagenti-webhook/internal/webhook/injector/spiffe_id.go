@@ -0,0 +1,137 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SpiffeIDAnnotation on the pod template replaces the SPIFFE ID the webhook derives from the
+// namespace and service account, for workloads whose SPIRE entry was created with another
+// ID. client-registration registers it as the client ID, with and without SPIRE. IDs outside
+// the workload's own namespace and service account need PodMutator.AllowedSpiffeIDOverrides.
+const SpiffeIDAnnotation = "kagenti.io/spiffe-id"
+
+// MaxClientIDLength is the length of Keycloak's client_id column. client-registration
+// registers the SPIFFE ID, or namespace/name without SPIRE, as the client ID.
+const MaxClientIDLength = 255
+
+// SpiffeIDPath is the path of the SPIFFE ID SPIRE issues to pods running as serviceAccount
+func SpiffeIDPath(namespace, serviceAccount string) string {
+	return "/ns/" + namespace + "/sa/" + serviceAccount
+}
+
+// ValidateSpiffeID checks a SPIFFE ID against the SPIFFE specification and the Keycloak
+// client ID length. An empty trust domain is not checked and does not count towards the length.
+func ValidateSpiffeID(trustDomain, path string) error {
+	if err := ValidateTrustDomain(trustDomain); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("SPIFFE ID path %q must start with '/'", path)
+	}
+	for _, segment := range strings.Split(path[1:], "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("SPIFFE ID path %q has an empty, '.' or '..' segment", path)
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return fmt.Errorf("SPIFFE ID path %q may only contain letters, digits, '.', '-' and '_'", path)
+			}
+		}
+	}
+	if id := "spiffe://" + trustDomain + path; len(id) > MaxClientIDLength {
+		return fmt.Errorf("SPIFFE ID %q is %d characters long, Keycloak client IDs are limited to %d", id, len(id), MaxClientIDLength)
+	}
+	return nil
+}
+
+// SpiffeIDOverride returns the SPIFFE ID of the kagenti.io/spiffe-id annotation, empty
+// when it is not set, or an error when it is not a valid SPIFFE ID
+func SpiffeIDOverride(annotations map[string]string) (string, error) {
+	id, ok := annotations[SpiffeIDAnnotation]
+	if !ok {
+		return "", nil
+	}
+	trustDomain, path, found := strings.Cut(strings.TrimPrefix(id, "spiffe://"), "/")
+	if !strings.HasPrefix(id, "spiffe://") || !found || trustDomain == "" {
+		return "", fmt.Errorf("invalid %s annotation %q: must be spiffe://<trust domain>/<path>", SpiffeIDAnnotation, id)
+	}
+	if err := ValidateSpiffeID(trustDomain, "/"+path); err != nil {
+		return "", fmt.Errorf("invalid %s annotation: %w", SpiffeIDAnnotation, err)
+	}
+	return id, nil
+}
+
+// CheckSpiffeIDOverride rejects an override that names another namespace or service account
+// than the workload's own, or another trust domain than SpiffeTrustDomain if set, unless it matches one of the AllowedSpiffeIDOverrides. Without
+// the check, any workload could register, and get tokens exchanged for, another identity.
+func (m *PodMutator) CheckSpiffeIDOverride(id, namespace, serviceAccount string) error {
+	if id == "" {
+		return nil
+	}
+	trustDomain, path, _ := strings.Cut(strings.TrimPrefix(id, "spiffe://"), "/")
+	if (m.SpiffeTrustDomain == "" || trustDomain == m.SpiffeTrustDomain) && "/"+path == SpiffeIDPath(namespace, serviceAccount) {
+		return nil
+	}
+	for _, pattern := range m.AllowedSpiffeIDOverrides {
+		if pattern.MatchString(id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s annotation %q is not the workload's own identity %s and not in the allowed SPIFFE ID overrides",
+		SpiffeIDAnnotation, id, SpiffeIDPath(namespace, serviceAccount))
+}
+
+// PodServiceAccount is the service account the pods of podSpec run as
+func PodServiceAccount(podSpec *corev1.PodSpec) string {
+	if podSpec.ServiceAccountName == "" {
+		return "default"
+	}
+	return podSpec.ServiceAccountName
+}
+
+// InjectSpiffeIDOverride makes client-registration register id instead of the SPIFFE ID of
+// the SVID, or of namespace/name without SPIRE
+func (m *PodMutator) InjectSpiffeIDOverride(podSpec *corev1.PodSpec, id string) {
+	if id == "" {
+		return
+	}
+	for _, containers := range [][]corev1.Container{podSpec.InitContainers, podSpec.Containers} {
+		for i := range containers {
+			if containers[i].Name != ClientRegistrationContainerName {
+				continue
+			}
+			setEnv(&containers[i], "CLIENT_NAME", id)
+			setEnv(&containers[i], "SPIFFE_ID", id)
+		}
+	}
+	mutatorLog.Info("Overriding the client SPIFFE ID", "spiffeID", id)
+}
+
+// ValidateTrustDomain checks the characters of a SPIFFE trust domain
+func ValidateTrustDomain(trustDomain string) error {
+	for _, c := range trustDomain {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+			return fmt.Errorf("trust domain %q may only contain lowercase letters, digits, '.', '-' and '_'", trustDomain)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"context"
+	"regexp"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("SPIFFE ID override", func() {
+	var mutator *PodMutator
+	BeforeEach(func() {
+		mutator = NewPodMutator(nil, true)
+	})
+	inject := func(labels, annotations map[string]string) (*corev1.PodTemplateSpec, error) {
+		podTemplate := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			ServiceAccountName: "agent-sa",
+			Containers:         []corev1.Container{{Name: "app"}},
+		}}
+		podTemplate.Annotations = annotations
+		_, err := mutator.InjectAuthBridge(context.Background(), podTemplate, "team1", "agent", labels)
+		return podTemplate, err
+	}
+	registrationEnv := func(podTemplate *corev1.PodTemplateSpec) map[string]string {
+		env := map[string]string{}
+		for _, c := range podTemplate.Spec.InitContainers {
+			if c.Name == ClientRegistrationContainerName {
+				for _, e := range c.Env {
+					env[e.Name] = e.Value
+				}
+			}
+		}
+		return env
+	}
+
+	It("accepts SPIFFE IDs and rejects other values", func() {
+		id, err := SpiffeIDOverride(map[string]string{SpiffeIDAnnotation: "spiffe://example.org/agents/team1/agent"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(Equal("spiffe://example.org/agents/team1/agent"))
+
+		id, err = SpiffeIDOverride(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(BeEmpty())
+
+		for _, invalid := range []string{"", "team1/agent", "spiffe://example.org", "spiffe:///ns/team1", "spiffe://Example.org/a", "spiffe://example.org/a//b"} {
+			_, err := SpiffeIDOverride(map[string]string{SpiffeIDAnnotation: invalid})
+			Expect(err).To(HaveOccurred(), invalid)
+		}
+	})
+
+	It("registers the annotated SPIFFE ID with and without SPIRE", func() {
+		mutator.AllowedSpiffeIDOverrides = []*regexp.Regexp{regexp.MustCompile(`^spiffe://example\.org/agents/`)}
+		annotations := map[string]string{SpiffeIDAnnotation: "spiffe://example.org/agents/agent"}
+		for _, spire := range []string{SpireEnabledValue, SpireDisabledValue} {
+			podTemplate, err := inject(map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue, SpireEnableLabel: spire}, annotations)
+			Expect(err).NotTo(HaveOccurred())
+			env := registrationEnv(podTemplate)
+			Expect(env).To(HaveKeyWithValue("CLIENT_NAME", "spiffe://example.org/agents/agent"), spire)
+			Expect(env).To(HaveKeyWithValue("SPIFFE_ID", "spiffe://example.org/agents/agent"), spire)
+		}
+
+		podTemplate, err := inject(map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registrationEnv(podTemplate)).To(And(HaveKeyWithValue("CLIENT_NAME", "team1/agent"), Not(HaveKey("SPIFFE_ID"))))
+	})
+
+	It("only allows overrides of other identities that match the allowed patterns", func() {
+		labels := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+		own := map[string]string{SpiffeIDAnnotation: "spiffe://other.example/ns/team1/sa/agent-sa"}
+		_, err := inject(labels, own)
+		Expect(err).NotTo(HaveOccurred())
+		mutator.SpiffeTrustDomain = "example.org"
+		_, err = inject(labels, own)
+		Expect(err).To(MatchError(ContainSubstring("not in the allowed SPIFFE ID overrides")))
+
+		for _, other := range []string{"spiffe://example.org/ns/team2/sa/agent-sa", "spiffe://example.org/ns/team1/sa/default",
+			"spiffe://example.org/agents/agent"} {
+			_, err := inject(labels, map[string]string{SpiffeIDAnnotation: other})
+			Expect(err).To(MatchError(ContainSubstring("not in the allowed SPIFFE ID overrides")), other)
+		}
+
+		mutator.AllowedSpiffeIDOverrides = []*regexp.Regexp{regexp.MustCompile(`^spiffe://example\.org/ns/team2/`)}
+		_, err = inject(labels, map[string]string{SpiffeIDAnnotation: "spiffe://example.org/ns/team2/sa/agent-sa"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mutator.CheckSpiffeIDOverride("spiffe://example.org/ns/team1/sa/default", "team1", PodServiceAccount(&corev1.PodSpec{}))).
+			To(Succeed())
+	})
+
+	It("rejects workloads with an invalid annotation", func() {
+		_, err := inject(map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue},
+			map[string]string{SpiffeIDAnnotation: "agent"})
+		Expect(err).To(MatchError(ContainSubstring(SpiffeIDAnnotation)))
+	})
+})
@@ -0,0 +1,53 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PodTemplateUnchanged reports whether an UPDATE of a workload of the given kind leaves the
+// pod template and the workload labels, the only inputs of the injection decision besides
+// the namespace, as they were. Unparseable objects count as changed.
+func PodTemplateUnchanged(kind string, oldRaw, newRaw []byte) bool {
+	if len(oldRaw) == 0 {
+		return false
+	}
+	var oldObj, newObj map[string]interface{}
+	if err := json.Unmarshal(oldRaw, &oldObj); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(newRaw, &newObj); err != nil {
+		return false
+	}
+
+	templatePath := []string{"spec", "template"}
+	if kind == "CronJob" {
+		templatePath = []string{"spec", "jobTemplate", "spec", "template"}
+	}
+	for _, path := range [][]string{templatePath, {"metadata", "labels"}} {
+		oldValue, _, _ := unstructured.NestedFieldNoCopy(oldObj, path...)
+		newValue, _, _ := unstructured.NestedFieldNoCopy(newObj, path...)
+		if !reflect.DeepEqual(oldValue, newValue) {
+			return false
+		}
+	}
+	return true
+}
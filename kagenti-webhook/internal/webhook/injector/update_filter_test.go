@@ -0,0 +1,75 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("PodTemplateUnchanged", func() {
+	marshal := func(obj interface{}) []byte {
+		raw, err := json.Marshal(obj)
+		Expect(err).NotTo(HaveOccurred())
+		return raw
+	}
+
+	deployment := func(annotations, labels map[string]string, image string) []byte {
+		return marshal(&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "agent", Labels: labels, Annotations: annotations},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: image}},
+			}}},
+		})
+	}
+
+	optedIn := map[string]string{AuthBridgeInjectLabel: AuthBridgeInjectValue}
+
+	It("ignores changes to workload annotations", func() {
+		Expect(PodTemplateUnchanged("Deployment",
+			deployment(nil, optedIn, "app:v1"),
+			deployment(map[string]string{"owner": "team1"}, optedIn, "app:v1"))).To(BeTrue())
+	})
+
+	It("detects pod template and label changes", func() {
+		Expect(PodTemplateUnchanged("Deployment",
+			deployment(nil, optedIn, "app:v1"), deployment(nil, optedIn, "app:v2"))).To(BeFalse())
+		Expect(PodTemplateUnchanged("Deployment",
+			deployment(nil, nil, "app:v1"), deployment(nil, optedIn, "app:v1"))).To(BeFalse())
+	})
+
+	It("looks at the job template of CronJobs", func() {
+		cronJob := func(image string) []byte {
+			cj := &batchv1.CronJob{Spec: batchv1.CronJobSpec{Schedule: "* * * * *"}}
+			cj.Spec.JobTemplate.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Image: image}}
+			return marshal(cj)
+		}
+		Expect(PodTemplateUnchanged("CronJob", cronJob("app:v1"), cronJob("app:v1"))).To(BeTrue())
+		Expect(PodTemplateUnchanged("CronJob", cronJob("app:v1"), cronJob("app:v2"))).To(BeFalse())
+	})
+
+	It("treats a missing old object as changed", func() {
+		Expect(PodTemplateUnchanged("Deployment", nil, deployment(nil, nil, "app:v1"))).To(BeFalse())
+	})
+})
@@ -17,14 +17,69 @@ limitations under the License.
 package injector
 
 import (
+	"fmt"
+	"path"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
 )
 
+// DefaultSpireCSIDriver is the SPIFFE CSI driver that publishes the Workload API socket
+const DefaultSpireCSIDriver = "csi.spiffe.io"
+
+// SpireSocketSource is where the spire-agent-socket volume comes from. Clusters without the
+// SPIFFE CSI driver expose the agent's socket directory through a hostPath instead.
+type SpireSocketSource struct {
+	// CSIDriver is used unless HostPath is set
+	CSIDriver string
+	// HostPath is the node directory holding the SPIRE agent socket, e.g. /run/spire/agent-sockets
+	HostPath string
+}
+
+// DefaultSpireSocketSource uses the SPIFFE CSI driver
+func DefaultSpireSocketSource() SpireSocketSource {
+	return SpireSocketSource{CSIDriver: DefaultSpireCSIDriver}
+}
+
+// Validate checks that exactly one usable source is configured
+func (s SpireSocketSource) Validate() error {
+	if s.HostPath != "" {
+		if !path.IsAbs(s.HostPath) {
+			return fmt.Errorf("SPIRE socket hostPath must be absolute, got %q", s.HostPath)
+		}
+		return nil
+	}
+	if s.CSIDriver == "" {
+		return fmt.Errorf("SPIRE socket needs a CSI driver or a hostPath")
+	}
+	return nil
+}
+
+// BuildSpireSocketVolume creates the spire-agent-socket volume from the configured source
+func BuildSpireSocketVolume(source SpireSocketSource) corev1.Volume {
+	volume := corev1.Volume{Name: "spire-agent-socket"}
+	if source.HostPath != "" {
+		volume.HostPath = &corev1.HostPathVolumeSource{
+			Path: source.HostPath,
+			Type: ptr.To(corev1.HostPathDirectory),
+		}
+		return volume
+	}
+	volume.CSI = &corev1.CSIVolumeSource{
+		Driver:   source.CSIDriver,
+		ReadOnly: ptr.To(true),
+	}
+	return volume
+}
+
 // BuildRequiredVolumes creates all volumes required for sidecar containers (with SPIRE)
 func BuildRequiredVolumes() []corev1.Volume {
-	// Helper for pointer to bool
-	isReadOnly := true
+	return BuildRequiredVolumesWithSpireSocket(DefaultSpireSocketSource())
+}
 
+// BuildRequiredVolumesWithSpireSocket creates all volumes required for sidecar containers
+// (with SPIRE), taking the Workload API socket from source
+func BuildRequiredVolumesWithSpireSocket(source SpireSocketSource) []corev1.Volume {
 	return []corev1.Volume{
 		{
 			Name: "shared-data",
@@ -32,16 +87,7 @@ func BuildRequiredVolumes() []corev1.Volume {
 				EmptyDir: &corev1.EmptyDirVolumeSource{},
 			},
 		},
-		{
-			// Updated from HostPath to CSI
-			Name: "spire-agent-socket",
-			VolumeSource: corev1.VolumeSource{
-				CSI: &corev1.CSIVolumeSource{
-					Driver:   "csi.spiffe.io",
-					ReadOnly: &isReadOnly,
-				},
-			},
-		},
+		BuildSpireSocketVolume(source),
 		{
 			Name: "spiffe-helper-config",
 			VolumeSource: corev1.VolumeSource{
@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package injector
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("SPIRE socket volume", func() {
+	socketVolume := func(mutator *PodMutator) corev1.Volume {
+		podSpec := &corev1.PodSpec{}
+		Expect(mutator.InjectVolumesWithSpireOption(podSpec, true)).To(Succeed())
+		for _, vol := range podSpec.Volumes {
+			if vol.Name == "spire-agent-socket" {
+				return vol
+			}
+		}
+		Fail("spire-agent-socket volume not injected")
+		return corev1.Volume{}
+	}
+
+	It("uses the SPIFFE CSI driver by default", func() {
+		vol := socketVolume(NewPodMutator(nil, true))
+		Expect(vol.CSI).NotTo(BeNil())
+		Expect(vol.CSI.Driver).To(Equal(DefaultSpireCSIDriver))
+		Expect(vol.HostPath).To(BeNil())
+	})
+
+	It("uses a custom CSI driver or a hostPath", func() {
+		mutator := NewPodMutator(nil, true)
+		mutator.SpireSocket = SpireSocketSource{CSIDriver: "csi.example.com"}
+		Expect(socketVolume(mutator).CSI.Driver).To(Equal("csi.example.com"))
+
+		mutator.SpireSocket.HostPath = "/run/spire/agent-sockets"
+		vol := socketVolume(mutator)
+		Expect(vol.CSI).To(BeNil())
+		Expect(vol.HostPath.Path).To(Equal("/run/spire/agent-sockets"))
+		Expect(*vol.HostPath.Type).To(Equal(corev1.HostPathDirectory))
+	})
+
+	It("rejects unusable sources", func() {
+		Expect(SpireSocketSource{HostPath: "run/spire"}.Validate()).NotTo(Succeed())
+		Expect(SpireSocketSource{}.Validate()).NotTo(Succeed())
+		Expect(DefaultSpireSocketSource().Validate()).To(Succeed())
+	})
+})
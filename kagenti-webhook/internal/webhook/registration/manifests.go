@@ -0,0 +1,140 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"fmt"
+	"io"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultTargetPort is the port of the manager's webhook server
+const DefaultTargetPort = int32(9443)
+
+// ManagerRules are the permissions the admission handlers need: namespace lookups, the
+// ConfigMap and ResourceQuota checks and the workloads the injection status refers to
+var ManagerRules = []rbacv1.PolicyRule{
+	{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch"}},
+	{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list", "watch"}},
+	{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get", "list", "watch"}},
+	{APIGroups: []string{""}, Resources: []string{"resourcequotas"}, Verbs: []string{"get", "list", "watch"}},
+	{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "daemonsets"}, Verbs: []string{"get", "list", "watch"}},
+	{APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: []string{"get", "list", "watch"}},
+}
+
+// ManifestOptions describes the objects returned by Manifests. Options.Name names the
+// MutatingWebhookConfiguration; the Service is Options.ServiceName in Options.ServiceNamespace.
+type ManifestOptions struct {
+	Options
+	// ValidatingName names the ValidatingWebhookConfiguration
+	ValidatingName string
+	// TargetPort is the webhook server port of the manager pods
+	TargetPort int32
+	// Selector selects the manager pods behind the Service
+	Selector map[string]string
+	// ServiceAccountName, if set, is bound to a ClusterRole with the ManagerRules
+	ServiceAccountName string
+	// Labels are added to every object
+	Labels map[string]string
+}
+
+// Manifests returns the webhook configurations, Service and RBAC of the webhook as the
+// handlers registered at runtime expect them
+func Manifests(opts ManifestOptions) []client.Object {
+	r := NewRegistrar(nil, opts.Options)
+	if opts.TargetPort == 0 {
+		opts.TargetPort = DefaultTargetPort
+	}
+	meta := func(name, namespace string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: opts.Labels}
+	}
+
+	mutating := &admissionregistrationv1.MutatingWebhookConfiguration{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "admissionregistration.k8s.io/v1", Kind: "MutatingWebhookConfiguration"},
+		ObjectMeta: meta(r.Options.Name, ""),
+		Webhooks:   r.DesiredWebhooks(),
+	}
+	r.setAnnotations(&mutating.ObjectMeta)
+	validating := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "admissionregistration.k8s.io/v1", Kind: "ValidatingWebhookConfiguration"},
+		ObjectMeta: meta(opts.ValidatingName, ""),
+		Webhooks:   r.DesiredValidatingWebhooks(),
+	}
+	r.setAnnotations(&validating.ObjectMeta)
+	service := &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: meta(r.Options.ServiceName, r.Options.ServiceNamespace),
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name:       "webhook",
+				Port:       r.Options.ServicePort,
+				TargetPort: intstr.FromInt32(opts.TargetPort),
+				Protocol:   corev1.ProtocolTCP,
+			}},
+			Selector: opts.Selector,
+		},
+	}
+	objects := []client.Object{mutating, validating, service}
+	if opts.ServiceAccountName == "" {
+		return objects
+	}
+
+	roleName := opts.ServiceAccountName + "-manager-role"
+	return append(objects,
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			ObjectMeta: meta(roleName, ""),
+			Rules:      ManagerRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: meta(opts.ServiceAccountName+"-manager-rolebinding", ""),
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: roleName},
+			Subjects: []rbacv1.Subject{{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      opts.ServiceAccountName,
+				Namespace: r.Options.ServiceNamespace,
+			}},
+		})
+}
+
+// WriteManifests writes objects as a multi-document YAML stream, without their empty status
+func WriteManifests(w io.Writer, objects []client.Object) error {
+	for _, obj := range objects {
+		fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return fmt.Errorf("failed to render %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		delete(fields, "status")
+		out, err := yaml.Marshal(fields)
+		if err != nil {
+			return fmt.Errorf("failed to render %s %s: %w", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), err)
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
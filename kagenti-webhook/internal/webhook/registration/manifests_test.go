@@ -0,0 +1,130 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Manifests", func() {
+	opts := ManifestOptions{
+		Options: Options{
+			Name:             "kagenti-webhook-mutating-webhook-configuration",
+			ServiceName:      "kagenti-webhook-webhook-service",
+			ServiceNamespace: "kagenti-webhook-system",
+			CAInjectFrom:     "kagenti-webhook-system/kagenti-webhook-serving-cert",
+		},
+		ValidatingName:     "kagenti-webhook-validating-webhook-configuration",
+		Selector:           map[string]string{"control-plane": "controller-manager"},
+		ServiceAccountName: "kagenti-webhook",
+	}
+
+	It("renders the webhooks the Registrar manages, the Service and the RBAC", func() {
+		objects := Manifests(opts)
+		Expect(objects).To(HaveLen(5))
+
+		mutating := objects[0].(*admissionregistrationv1.MutatingWebhookConfiguration)
+		Expect(mutating.Webhooks).To(Equal(NewRegistrar(nil, opts.Options).DesiredWebhooks()))
+		Expect(mutating.Annotations).To(HaveKeyWithValue(CAInjectFromAnnotation, opts.CAInjectFrom))
+
+		validating := objects[1].(*admissionregistrationv1.ValidatingWebhookConfiguration)
+		Expect(validating.Name).To(Equal(opts.ValidatingName))
+		paths := []string{}
+		for _, wh := range validating.Webhooks {
+			Expect(wh.ClientConfig.Service.Name).To(Equal(opts.ServiceName))
+			Expect(wh.NamespaceSelector.MatchExpressions[0].Values).To(ContainElement("kagenti-webhook-system"))
+			paths = append(paths, *wh.ClientConfig.Service.Path)
+		}
+		Expect(paths).To(Equal([]string{AgentValidatePath, MCPServerValidatePath}))
+
+		service := objects[2].(*corev1.Service)
+		Expect(service.Namespace).To(Equal("kagenti-webhook-system"))
+		Expect(service.Spec.Ports).To(Equal([]corev1.ServicePort{{
+			Name: "webhook", Port: DefaultServicePort, TargetPort: intstr.FromInt32(DefaultTargetPort), Protocol: corev1.ProtocolTCP,
+		}}))
+
+		binding := objects[4].(*rbacv1.ClusterRoleBinding)
+		Expect(binding.RoleRef.Name).To(Equal(objects[3].GetName()))
+		Expect(binding.Subjects).To(ConsistOf(rbacv1.Subject{
+			Kind: rbacv1.ServiceAccountKind, Name: "kagenti-webhook", Namespace: "kagenti-webhook-system",
+		}))
+
+		withoutRBAC := opts
+		withoutRBAC.ServiceAccountName = ""
+		Expect(Manifests(withoutRBAC)).To(HaveLen(3))
+	})
+
+	It("writes a YAML stream that reads back into the same objects", func() {
+		var out bytes.Buffer
+		Expect(WriteManifests(&out, Manifests(opts))).To(Succeed())
+		Expect(out.String()).NotTo(ContainSubstring("status:"))
+
+		documents := strings.Split(strings.TrimPrefix(out.String(), "---\n"), "---\n")
+		Expect(documents).To(HaveLen(5))
+		service := &corev1.Service{}
+		Expect(yaml.UnmarshalStrict([]byte(documents[2]), service)).To(Succeed())
+		Expect(service.Kind).To(Equal("Service"))
+		Expect(service.Spec.Selector).To(Equal(opts.Selector))
+	})
+
+	It("matches the AuthBridge webhooks of the chart", func() {
+		// Render the template with the default release names: drop the control structures
+		// and fill in the includes
+		template, err := os.ReadFile("../../../../charts/kagenti-webhook/templates/authbridge-mutatingwebhook.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		rendered := regexp.MustCompile(`(?s)[ \t]*\{\{-.*?\}\}\n?`).ReplaceAllString(string(template), "")
+		rendered = strings.NewReplacer(
+			`{{ include "kagenti-webhook.fullname" . }}`, "kagenti-webhook",
+			`{{ include "kagenti-webhook.namespace" . }}`, "kagenti-webhook-system",
+		).Replace(rendered)
+		Expect(rendered).NotTo(ContainSubstring("{{"))
+		chart := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(yaml.UnmarshalStrict([]byte(rendered), chart)).To(Succeed())
+
+		desired := NewRegistrar(nil, opts.Options).DesiredWebhooks()[:2]
+		Expect(chart.Webhooks).To(HaveLen(len(desired)))
+		for i, wh := range chart.Webhooks {
+			want := desired[i]
+			Expect(wh.Name).To(Equal(want.Name))
+			Expect(wh.ClientConfig.Service.Name).To(Equal(want.ClientConfig.Service.Name))
+			Expect(wh.ClientConfig.Service.Namespace).To(Equal(want.ClientConfig.Service.Namespace))
+			Expect(wh.ClientConfig.Service.Path).To(Equal(want.ClientConfig.Service.Path))
+			Expect(wh.FailurePolicy).To(Equal(want.FailurePolicy))
+			Expect(wh.TimeoutSeconds).To(Equal(want.TimeoutSeconds))
+			Expect(wh.NamespaceSelector).To(Equal(want.NamespaceSelector), wh.Name)
+			Expect(wh.ObjectSelector).To(Equal(want.ObjectSelector), wh.Name)
+			// The chart leaves the rule scope to the API server default
+			for j := range wh.Rules {
+				wh.Rules[j].Scope = ptr.To(admissionregistrationv1.AllScopes)
+			}
+			Expect(wh.Rules).To(Equal(want.Rules), wh.Name)
+		}
+	})
+})
@@ -0,0 +1,343 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var registrationLog = logf.Log.WithName("webhook-registration")
+
+// Paths of the handlers; the webhook server registers them under these paths
+const (
+	AuthBridgePath = "/mutate-workloads-authbridge"
+	AgentPath      = "/mutate-agent-kagenti-dev-v1alpha1-agent"
+	MCPServerPath  = "/mutate-toolhive-stacklok-dev-v1alpha1-mcpserver"
+	NamespacePath  = "/mutate-namespaces"
+
+	AgentValidatePath     = "/validate-agent-kagenti-dev-v1alpha1-agent"
+	MCPServerValidatePath = "/validate-toolhive-stacklok-dev-v1alpha1-mcpserver"
+
+	// CAInjectFromAnnotation lets cert-manager's cainjector fill in the caBundle
+	CAInjectFromAnnotation = "cert-manager.io/inject-ca-from"
+
+	// namespaceLabel mirrors injector.DefaultNamespaceLabel; a namespace opts in with "true"
+	// and out with "false"
+	namespaceLabel = "kagenti-enabled"
+	// injectLabel and injectValue mirror injector.AuthBridgeInjectLabel and
+	// injector.AuthBridgeInjectValue, the per-workload opt-in
+	injectLabel = "kagenti.io/inject"
+	injectValue = "enabled"
+
+	DefaultServicePort    = int32(443)
+	DefaultTimeoutSeconds = int32(10)
+)
+
+// DefaultExcludedNamespaces are never sent to the webhooks, in addition to the webhook's own namespace
+var DefaultExcludedNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// DefaultOperations re-inject workloads whose pod template is replaced on update
+var DefaultOperations = []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+
+// ParseOperations validates a comma-separated list of webhook operations; CREATE is required
+func ParseOperations(value string) ([]admissionregistrationv1.OperationType, error) {
+	operations := []admissionregistrationv1.OperationType{}
+	for _, op := range strings.Split(value, ",") {
+		operation := admissionregistrationv1.OperationType(strings.ToUpper(strings.TrimSpace(op)))
+		switch operation {
+		case admissionregistrationv1.Create, admissionregistrationv1.Update:
+			if !slices.Contains(operations, operation) {
+				operations = append(operations, operation)
+			}
+		default:
+			return nil, fmt.Errorf("webhook operations must be CREATE or CREATE,UPDATE, got %q", value)
+		}
+	}
+	if !slices.Contains(operations, admissionregistrationv1.Create) {
+		return nil, fmt.Errorf("webhook operations must include CREATE, got %q", value)
+	}
+	return operations, nil
+}
+
+// Options describes the MutatingWebhookConfiguration managed by the Registrar
+type Options struct {
+	// Name of the MutatingWebhookConfiguration
+	Name string
+	// ServiceName, ServiceNamespace and ServicePort locate the webhook Service
+	ServiceName      string
+	ServiceNamespace string
+	ServicePort      int32
+	FailurePolicy    admissionregistrationv1.FailurePolicyType
+	// Operations the rules match; CREATE alone leaves existing workloads to the drift check
+	Operations     []admissionregistrationv1.OperationType
+	TimeoutSeconds int32
+	// ExcludedNamespaces are skipped by every webhook; ServiceNamespace is always excluded
+	ExcludedNamespaces []string
+	// CAInjectFrom, if set, is written to the cert-manager.io/inject-ca-from annotation
+	CAInjectFrom string
+	// NamespaceWebhook adds the webhook recording the onboarding of kagenti-enabled namespaces
+	NamespaceWebhook bool
+}
+
+// Registrar creates or updates the webhook's MutatingWebhookConfiguration so that the
+// rules, namespaceSelector and failurePolicy always match what the handlers expect.
+// An existing caBundle is preserved; it is owned by the certificate provider.
+type Registrar struct {
+	Client  client.Client
+	Options Options
+}
+
+// NewRegistrar returns a Registrar with unset options replaced by defaults
+func NewRegistrar(c client.Client, opts Options) *Registrar {
+	if opts.ServicePort == 0 {
+		opts.ServicePort = DefaultServicePort
+	}
+	if opts.FailurePolicy == "" {
+		opts.FailurePolicy = admissionregistrationv1.Fail
+	}
+	if len(opts.Operations) == 0 {
+		opts.Operations = DefaultOperations
+	}
+	if opts.TimeoutSeconds == 0 {
+		opts.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if opts.ExcludedNamespaces == nil {
+		opts.ExcludedNamespaces = DefaultExcludedNamespaces
+	}
+	return &Registrar{Client: c, Options: opts}
+}
+
+// Ensure creates the MutatingWebhookConfiguration or brings an existing one in line with
+// the desired webhooks. Every replica may call it; conflicting updates are retried.
+func (r *Registrar) Ensure(ctx context.Context) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		err := r.Client.Get(ctx, client.ObjectKey{Name: r.Options.Name}, existing)
+		if apierrors.IsNotFound(err) {
+			cfg := &admissionregistrationv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: r.Options.Name},
+				Webhooks:   r.DesiredWebhooks(),
+			}
+			r.setAnnotations(&cfg.ObjectMeta)
+			if err := r.Client.Create(ctx, cfg); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					// Another replica created it first; retry as an update
+					return apierrors.NewConflict(admissionregistrationv1.Resource("mutatingwebhookconfigurations"), r.Options.Name, err)
+				}
+				return fmt.Errorf("failed to create MutatingWebhookConfiguration %s: %w", r.Options.Name, err)
+			}
+			registrationLog.Info("Created MutatingWebhookConfiguration", "name", r.Options.Name)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get MutatingWebhookConfiguration %s: %w", r.Options.Name, err)
+		}
+
+		caBundles := map[string][]byte{}
+		for _, wh := range existing.Webhooks {
+			caBundles[wh.Name] = wh.ClientConfig.CABundle
+		}
+		webhooks := r.DesiredWebhooks()
+		for i := range webhooks {
+			webhooks[i].ClientConfig.CABundle = caBundles[webhooks[i].Name]
+		}
+		existing.Webhooks = webhooks
+		r.setAnnotations(&existing.ObjectMeta)
+
+		if err := r.Client.Update(ctx, existing); err != nil {
+			if apierrors.IsConflict(err) {
+				return err
+			}
+			return fmt.Errorf("failed to update MutatingWebhookConfiguration %s: %w", r.Options.Name, err)
+		}
+		registrationLog.Info("Updated MutatingWebhookConfiguration", "name", r.Options.Name)
+		return nil
+	})
+}
+
+// DesiredWebhooks returns the AuthBridge, Agent and MCPServer webhooks, and the namespace
+// webhook if enabled, as the handlers expect them
+func (r *Registrar) DesiredWebhooks() []admissionregistrationv1.MutatingWebhook {
+	webhooks := append(r.authBridgeWebhooks(),
+		r.webhook("magent-v1alpha1.kb.io", AgentPath, r.namespaceSelector(), []admissionregistrationv1.RuleWithOperations{
+			r.rule("agent.kagenti.dev", "v1alpha1", "agents"),
+		}),
+		r.webhook("mmcpserver-v1alpha1.kb.io", MCPServerPath, r.namespaceSelector(), []admissionregistrationv1.RuleWithOperations{
+			r.rule("toolhive.stacklok.dev", "v1alpha1", "mcpservers"),
+		}),
+	)
+	if r.Options.NamespaceWebhook {
+		webhooks = append(webhooks, r.namespaceWebhook())
+	}
+	return webhooks
+}
+
+// authBridgeWebhooks send the AuthBridge handler the workloads it may inject, and no
+// others, so that failurePolicy Fail cannot block unrelated workloads while the webhook is
+// down. inject.kagenti.io sees every workload of namespaces labelled kagenti-enabled=true,
+// where workloads without a kagenti.io/inject key are injected. inject-workloads.kagenti.io
+// sees the workloads labelled kagenti.io/inject=enabled in the other namespaces, except
+// those labelled kagenti-enabled=false. The handler makes the final decision.
+func (r *Registrar) authBridgeWebhooks() []admissionregistrationv1.MutatingWebhook {
+	rules := func() []admissionregistrationv1.RuleWithOperations {
+		return []admissionregistrationv1.RuleWithOperations{
+			r.rule("apps", "v1", "deployments", "statefulsets", "daemonsets"),
+			r.rule("batch", "v1", "jobs", "cronjobs"),
+		}
+	}
+
+	enabledNamespaces := r.namespaceSelector()
+	enabledNamespaces.MatchExpressions = append(enabledNamespaces.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      namespaceLabel,
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   []string{"true"},
+	})
+	otherNamespaces := r.namespaceSelector()
+	otherNamespaces.MatchExpressions = append(otherNamespaces.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      namespaceLabel,
+		Operator: metav1.LabelSelectorOpNotIn,
+		Values:   []string{"true", "false"},
+	})
+	optedIn := r.webhook("inject-workloads.kagenti.io", AuthBridgePath, otherNamespaces, rules())
+	optedIn.ObjectSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      injectLabel,
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   []string{injectValue},
+	}}}
+
+	return []admissionregistrationv1.MutatingWebhook{
+		r.webhook("inject.kagenti.io", AuthBridgePath, enabledNamespaces, rules()),
+		optedIn,
+	}
+}
+
+// namespaceWebhook sees the namespaces that carry the kagenti-enabled label before or
+// after the change, on every CREATE and UPDATE whatever Options.Operations says. It never
+// blocks a namespace: it only records a condition.
+func (r *Registrar) namespaceWebhook() admissionregistrationv1.MutatingWebhook {
+	rule := r.rule("", "v1", "namespaces")
+	rule.Operations = []admissionregistrationv1.OperationType{admissionregistrationv1.Create, admissionregistrationv1.Update}
+	rule.Scope = ptr.To(admissionregistrationv1.ClusterScope)
+	wh := r.webhook("namespaces.kagenti.io", NamespacePath, r.namespaceSelector(), []admissionregistrationv1.RuleWithOperations{rule})
+	wh.FailurePolicy = ptr.To(admissionregistrationv1.Ignore)
+	wh.ObjectSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      namespaceLabel,
+		Operator: metav1.LabelSelectorOpExists,
+	}}}
+	return wh
+}
+
+// DesiredValidatingWebhooks returns the Agent and MCPServer validating webhooks
+func (r *Registrar) DesiredValidatingWebhooks() []admissionregistrationv1.ValidatingWebhook {
+	return []admissionregistrationv1.ValidatingWebhook{
+		r.validatingWebhook("vagent-v1alpha1.kb.io", AgentValidatePath, []admissionregistrationv1.RuleWithOperations{
+			r.rule("agent.kagenti.dev", "v1alpha1", "agents"),
+		}),
+		r.validatingWebhook("vmcpserver-v1alpha1.kb.io", MCPServerValidatePath, []admissionregistrationv1.RuleWithOperations{
+			r.rule("toolhive.stacklok.dev", "v1alpha1", "mcpservers"),
+		}),
+	}
+}
+
+func (r *Registrar) validatingWebhook(name, path string, rules []admissionregistrationv1.RuleWithOperations) admissionregistrationv1.ValidatingWebhook {
+	wh := r.webhook(name, path, r.namespaceSelector(), rules)
+	return admissionregistrationv1.ValidatingWebhook{
+		Name:                    wh.Name,
+		AdmissionReviewVersions: wh.AdmissionReviewVersions,
+		ClientConfig:            wh.ClientConfig,
+		Rules:                   wh.Rules,
+		FailurePolicy:           wh.FailurePolicy,
+		MatchPolicy:             wh.MatchPolicy,
+		SideEffects:             wh.SideEffects,
+		TimeoutSeconds:          wh.TimeoutSeconds,
+		NamespaceSelector:       wh.NamespaceSelector,
+		ObjectSelector:          wh.ObjectSelector,
+	}
+}
+
+func (r *Registrar) webhook(name, path string, selector *metav1.LabelSelector, rules []admissionregistrationv1.RuleWithOperations) admissionregistrationv1.MutatingWebhook {
+	return admissionregistrationv1.MutatingWebhook{
+		Name:                    name,
+		AdmissionReviewVersions: []string{"v1"},
+		ClientConfig: admissionregistrationv1.WebhookClientConfig{
+			Service: &admissionregistrationv1.ServiceReference{
+				Name:      r.Options.ServiceName,
+				Namespace: r.Options.ServiceNamespace,
+				Path:      ptr.To(path),
+				Port:      ptr.To(r.Options.ServicePort),
+			},
+		},
+		Rules:              rules,
+		FailurePolicy:      ptr.To(r.Options.FailurePolicy),
+		MatchPolicy:        ptr.To(admissionregistrationv1.Equivalent),
+		SideEffects:        ptr.To(admissionregistrationv1.SideEffectClassNone),
+		TimeoutSeconds:     ptr.To(r.Options.TimeoutSeconds),
+		ReinvocationPolicy: ptr.To(admissionregistrationv1.NeverReinvocationPolicy),
+		NamespaceSelector:  selector,
+		ObjectSelector:     &metav1.LabelSelector{},
+	}
+}
+
+// namespaceSelector excludes the configured namespaces and the webhook's own namespace,
+// so a broken webhook can never block its own recovery.
+func (r *Registrar) namespaceSelector() *metav1.LabelSelector {
+	excluded := append([]string{}, r.Options.ExcludedNamespaces...)
+	if r.Options.ServiceNamespace != "" {
+		excluded = append(excluded, r.Options.ServiceNamespace)
+	}
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      corev1.LabelMetadataName,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   excluded,
+		}},
+	}
+}
+
+func (r *Registrar) setAnnotations(meta *metav1.ObjectMeta) {
+	if r.Options.CAInjectFrom == "" {
+		return
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[CAInjectFromAnnotation] = r.Options.CAInjectFrom
+}
+
+func (r *Registrar) rule(group, version string, resources ...string) admissionregistrationv1.RuleWithOperations {
+	return admissionregistrationv1.RuleWithOperations{
+		Operations: slices.Clone(r.Options.Operations),
+		Rule: admissionregistrationv1.Rule{
+			APIGroups:   []string{group},
+			APIVersions: []string{version},
+			Resources:   resources,
+			Scope:       ptr.To(admissionregistrationv1.AllScopes),
+		},
+	}
+}
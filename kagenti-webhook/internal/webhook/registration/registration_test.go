@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registration
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Registrar", func() {
+	var (
+		ctx       context.Context
+		scheme    *runtime.Scheme
+		registrar *Registrar
+	)
+
+	const configName = "kagenti-webhook-mutating-webhook-configuration"
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		scheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	})
+
+	newRegistrar := func(objs ...client.Object) {
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+		registrar = NewRegistrar(k8sClient, Options{
+			Name:             configName,
+			ServiceName:      "kagenti-webhook-webhook-service",
+			ServiceNamespace: "kagenti-webhook-system",
+		})
+	}
+
+	getConfig := func() *admissionregistrationv1.MutatingWebhookConfiguration {
+		cfg := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		Expect(registrar.Client.Get(ctx, client.ObjectKey{Name: configName}, cfg)).To(Succeed())
+		return cfg
+	}
+
+	It("creates the configuration with the expected webhooks", func() {
+		newRegistrar()
+		Expect(registrar.Ensure(ctx)).To(Succeed())
+
+		cfg := getConfig()
+		Expect(cfg.Webhooks).To(HaveLen(4))
+		paths := []string{}
+		for _, wh := range cfg.Webhooks {
+			Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1.Fail))
+			Expect(*wh.SideEffects).To(Equal(admissionregistrationv1.SideEffectClassNone))
+			Expect(wh.ClientConfig.Service.Name).To(Equal("kagenti-webhook-webhook-service"))
+			Expect(wh.NamespaceSelector.MatchExpressions[0].Values).To(ContainElements("kube-system", "kagenti-webhook-system"))
+			paths = append(paths, *wh.ClientConfig.Service.Path)
+		}
+		Expect(paths).To(ConsistOf(AuthBridgePath, AuthBridgePath, AgentPath, MCPServerPath))
+	})
+
+	It("sends the AuthBridge handler only the workloads of opted-in namespaces and opted-in workloads", func() {
+		newRegistrar()
+		webhooks := registrar.DesiredWebhooks()
+
+		namespaces := webhooks[0]
+		Expect(namespaces.Name).To(Equal("inject.kagenti.io"))
+		Expect(namespaces.NamespaceSelector.MatchExpressions).To(ContainElement(metav1.LabelSelectorRequirement{
+			Key: "kagenti-enabled", Operator: metav1.LabelSelectorOpIn, Values: []string{"true"},
+		}))
+		Expect(namespaces.ObjectSelector).To(Equal(&metav1.LabelSelector{}))
+
+		workloads := webhooks[1]
+		Expect(workloads.Name).To(Equal("inject-workloads.kagenti.io"))
+		Expect(*workloads.ClientConfig.Service.Path).To(Equal(AuthBridgePath))
+		Expect(workloads.NamespaceSelector.MatchExpressions).To(ContainElements(
+			HaveField("Values", ContainElement("kagenti-webhook-system")),
+			metav1.LabelSelectorRequirement{Key: "kagenti-enabled", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"true", "false"}},
+		))
+		Expect(workloads.ObjectSelector.MatchExpressions).To(ConsistOf(metav1.LabelSelectorRequirement{
+			Key: "kagenti.io/inject", Operator: metav1.LabelSelectorOpIn, Values: []string{"enabled"},
+		}))
+		Expect(workloads.Rules).To(Equal(namespaces.Rules))
+	})
+
+	It("adds the namespace webhook when enabled, which never blocks namespaces", func() {
+		registrar = NewRegistrar(nil, Options{Name: configName, ServiceNamespace: "kagenti-webhook-system", NamespaceWebhook: true})
+		webhooks := registrar.DesiredWebhooks()
+		Expect(webhooks).To(HaveLen(5))
+		namespaces := webhooks[4]
+		Expect(*namespaces.ClientConfig.Service.Path).To(Equal(NamespacePath))
+		Expect(*namespaces.FailurePolicy).To(Equal(admissionregistrationv1.Ignore))
+		Expect(namespaces.Rules).To(ConsistOf(HaveField("Rule.Resources", []string{"namespaces"})))
+		Expect(namespaces.ObjectSelector.MatchExpressions).To(ConsistOf(HaveField("Key", namespaceLabel)))
+		Expect(namespaces.NamespaceSelector.MatchExpressions[0].Values).To(ContainElement("kagenti-webhook-system"))
+	})
+
+	It("repairs drifted webhooks and preserves the caBundle", func() {
+		drifted := &admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: configName},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{{
+				Name:                    "inject.kagenti.io",
+				AdmissionReviewVersions: []string{"v1"},
+				ClientConfig:            admissionregistrationv1.WebhookClientConfig{CABundle: []byte("ca")},
+				FailurePolicy:           ptr.To(admissionregistrationv1.Ignore),
+			}},
+		}
+		newRegistrar(drifted)
+		Expect(registrar.Ensure(ctx)).To(Succeed())
+
+		cfg := getConfig()
+		Expect(cfg.Webhooks).To(HaveLen(4))
+		for _, wh := range cfg.Webhooks {
+			Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1.Fail))
+			if wh.Name == "inject.kagenti.io" {
+				Expect(wh.ClientConfig.CABundle).To(Equal([]byte("ca")))
+				Expect(wh.NamespaceSelector.MatchExpressions).To(ContainElement(metav1.LabelSelectorRequirement{
+					Key:      "kagenti-enabled",
+					Operator: metav1.LabelSelectorOpIn,
+					Values:   []string{"true"},
+				}))
+			}
+		}
+	})
+
+	It("honours the cert-manager CA injection annotation and failure policy override", func() {
+		newRegistrar()
+		registrar.Options.FailurePolicy = admissionregistrationv1.Ignore
+		registrar.Options.CAInjectFrom = "kagenti-webhook-system/kagenti-webhook-serving-cert"
+		Expect(registrar.Ensure(ctx)).To(Succeed())
+
+		cfg := getConfig()
+		Expect(cfg.Annotations).To(HaveKeyWithValue(CAInjectFromAnnotation, "kagenti-webhook-system/kagenti-webhook-serving-cert"))
+		for _, wh := range cfg.Webhooks {
+			Expect(*wh.FailurePolicy).To(Equal(admissionregistrationv1.Ignore))
+		}
+	})
+
+	It("restricts the rules to CREATE when configured", func() {
+		newRegistrar()
+		operations, err := ParseOperations("create")
+		Expect(err).NotTo(HaveOccurred())
+		registrar.Options.Operations = operations
+		Expect(registrar.Ensure(ctx)).To(Succeed())
+
+		for _, wh := range getConfig().Webhooks {
+			for _, rule := range wh.Rules {
+				Expect(rule.Operations).To(Equal([]admissionregistrationv1.OperationType{admissionregistrationv1.Create}))
+			}
+		}
+	})
+
+	It("rejects operations without CREATE or unsupported ones", func() {
+		Expect(ParseOperations("CREATE, update")).To(Equal(DefaultOperations))
+		_, err := ParseOperations("UPDATE")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseOperations("CREATE,DELETE")
+		Expect(err).To(HaveOccurred())
+	})
+})
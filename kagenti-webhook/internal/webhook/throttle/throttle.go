@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package throttle bounds the number of admission requests the webhook server handles at once
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
+)
+
+var throttleLog = logf.Log.WithName("admission-throttle")
+
+var (
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kagenti_webhook_admissions_in_flight",
+		Help: "Admission requests being handled by the throttled webhooks",
+	})
+	throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kagenti_webhook_admissions_throttled_total",
+		Help: "Admission requests rejected because the concurrency limit stayed reached",
+	}, []string{"path"})
+)
+
+func init() {
+	obs.Registry.MustRegister(inFlight, throttled)
+}
+
+// Limiter lets at most a fixed number of admission requests run at once, across all webhooks
+// registered through it. Further requests wait for a free slot up to a timeout, which must
+// stay below the webhook timeoutSeconds, and are then rejected with 429 so the API server
+// reports an error instead of timing out.
+type Limiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewLimiter returns a limiter for max concurrent requests that waits up to wait for a slot
+func NewLimiter(max int, wait time.Duration) *Limiter {
+	return &Limiter{slots: make(chan struct{}, max), wait: wait}
+}
+
+// Server wraps a webhook server so that every admission webhook registered on it is limited
+func (l *Limiter) Server(server webhook.Server) webhook.Server {
+	return &limitedServer{Server: server, limiter: l}
+}
+
+type limitedServer struct {
+	webhook.Server
+	limiter *Limiter
+}
+
+// Register limits admission webhooks and passes other handlers through unchanged
+func (s *limitedServer) Register(path string, hook http.Handler) {
+	if wh, ok := hook.(*admission.Webhook); ok {
+		wh.Handler = s.limiter.Handler(path, wh.Handler)
+	}
+	s.Server.Register(path, hook)
+}
+
+// Handler runs next once a slot is free
+func (l *Limiter) Handler(path string, next admission.Handler) admission.Handler {
+	return admission.HandlerFunc(func(ctx context.Context, req admission.Request) admission.Response {
+		if !l.acquire(ctx) {
+			throttled.WithLabelValues(path).Inc()
+			throttleLog.Info("Rejecting admission request, concurrency limit reached", "path", path,
+				"kind", req.Kind.Kind, "namespace", req.Namespace, "name", req.Name, "limit", cap(l.slots))
+			return admission.Errored(http.StatusTooManyRequests,
+				fmt.Errorf("more than %d admission requests in progress, retry later", cap(l.slots)))
+		}
+		defer l.release()
+		return next.Handle(ctx, req)
+	})
+}
+
+func (l *Limiter) acquire(ctx context.Context) bool {
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		inFlight.Inc()
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *Limiter) release() {
+	inFlight.Dec()
+	<-l.slots
+}
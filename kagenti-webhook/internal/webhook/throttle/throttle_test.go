@@ -0,0 +1,79 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package throttle
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Limiter", func() {
+	var (
+		release chan struct{}
+		started chan struct{}
+		handler admission.Handler
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		started = make(chan struct{}, 2)
+		handler = NewLimiter(1, 50*time.Millisecond).Handler("/mutate", admission.HandlerFunc(
+			func(context.Context, admission.Request) admission.Response {
+				started <- struct{}{}
+				<-release
+				return admission.Allowed("")
+			}))
+	})
+
+	It("rejects requests that find no free slot in time", func() {
+		before := testutil.ToFloat64(throttled.WithLabelValues("/mutate"))
+		done := make(chan admission.Response)
+		go func() { done <- handler.Handle(context.Background(), admission.Request{}) }()
+		Eventually(started).Should(Receive())
+
+		resp := handler.Handle(context.Background(), admission.Request{})
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Code).To(BeEquivalentTo(http.StatusTooManyRequests))
+		Expect(testutil.ToFloat64(throttled.WithLabelValues("/mutate"))).To(Equal(before + 1))
+
+		close(release)
+		Expect((<-done).Allowed).To(BeTrue())
+		// the slot is free again
+		Expect(handler.Handle(context.Background(), admission.Request{}).Allowed).To(BeTrue())
+	})
+
+	It("lets waiting requests run once a slot frees up", func() {
+		first := make(chan admission.Response)
+		go func() { first <- handler.Handle(context.Background(), admission.Request{}) }()
+		Eventually(started).Should(Receive())
+
+		second := make(chan admission.Response)
+		go func() { second <- handler.Handle(context.Background(), admission.Request{}) }()
+		release <- struct{}{}
+		Eventually(started).Should(Receive())
+		close(release)
+		Expect((<-first).Allowed).To(BeTrue())
+		Expect((<-second).Allowed).To(BeTrue())
+	})
+})
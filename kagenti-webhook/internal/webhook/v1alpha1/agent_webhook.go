@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
 	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -40,6 +41,8 @@ func SetupAgentWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMutator
 		For(&agentsv1alpha1.Agent{}).
 		WithValidator(&AgentCustomValidator{}).
 		WithDefaulter(&AgentCustomDefaulter{Mutator: mutator}).
+		WithDefaulterCustomPath(registration.AgentPath).
+		WithValidatorCustomPath(registration.AgentValidatePath).
 		Complete()
 }
 
@@ -19,12 +19,19 @@ package v1alpha1
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/obs"
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -46,7 +53,7 @@ func SetupAuthBridgeWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMu
 		decoder: admission.NewDecoder(mgr.GetScheme()),
 	}
 
-	mgr.GetWebhookServer().Register("/mutate-workloads-authbridge", &admission.Webhook{
+	mgr.GetWebhookServer().Register(registration.AuthBridgePath, &admission.Webhook{
 		Handler: webhook,
 	})
 
@@ -55,81 +62,52 @@ func SetupAuthBridgeWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMu
 
 // Handle processes admission requests for workload resources
 func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	// Dry-run requests get the same patch as real ones; the mutator skips side effects
+	dryRun := injector.IsDryRun(ctx)
 	authbridgelog.Info("AuthBridge webhook called",
 		"kind", req.Kind.Kind,
 		"namespace", req.Namespace,
 		"name", req.Name,
-		"operation", req.Operation)
-
-	var podSpec *corev1.PodSpec
-	var resourceName string
-	var mutatedObj interface{}
-	var labels map[string]string
-
-	// Extract PodSpec based on resource type
-	switch req.Kind.Kind {
-	case "Deployment":
-		var deployment appsv1.Deployment
-		if err := w.decoder.Decode(req, &deployment); err != nil {
-			authbridgelog.Error(err, "Failed to decode Deployment")
-			return admission.Errored(http.StatusBadRequest, err)
-		}
-		podSpec = &deployment.Spec.Template.Spec
-		resourceName = deployment.Name
-		mutatedObj = &deployment
-		labels = deployment.Labels
-
-	case "StatefulSet":
-		var statefulset appsv1.StatefulSet
-		if err := w.decoder.Decode(req, &statefulset); err != nil {
-			authbridgelog.Error(err, "Failed to decode StatefulSet")
-			return admission.Errored(http.StatusBadRequest, err)
-		}
-		podSpec = &statefulset.Spec.Template.Spec
-		resourceName = statefulset.Name
-		mutatedObj = &statefulset
-		labels = statefulset.Labels
-
-	case "DaemonSet":
-		var daemonset appsv1.DaemonSet
-		if err := w.decoder.Decode(req, &daemonset); err != nil {
-			authbridgelog.Error(err, "Failed to decode DaemonSet")
-			return admission.Errored(http.StatusBadRequest, err)
-		}
-		podSpec = &daemonset.Spec.Template.Spec
-		resourceName = daemonset.Name
-		mutatedObj = &daemonset
-		labels = daemonset.Labels
-
-	case "Job":
-		var job batchv1.Job
-		if err := w.decoder.Decode(req, &job); err != nil {
-			authbridgelog.Error(err, "Failed to decode Job")
-			return admission.Errored(http.StatusBadRequest, err)
-		}
-		podSpec = &job.Spec.Template.Spec
-		resourceName = job.Name
-		mutatedObj = &job
-		labels = job.Labels
-
-	case "CronJob":
-		var cronjob batchv1.CronJob
-		if err := w.decoder.Decode(req, &cronjob); err != nil {
-			authbridgelog.Error(err, "Failed to decode CronJob")
-			return admission.Errored(http.StatusBadRequest, err)
-		}
-		podSpec = &cronjob.Spec.JobTemplate.Spec.Template.Spec
-		resourceName = cronjob.Name
-		mutatedObj = &cronjob
-		labels = cronjob.Labels
-
-	default:
+		"operation", req.Operation,
+		"dryRun", dryRun)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("k8s.kind", req.Kind.Kind),
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name),
+		attribute.String("admission.operation", string(req.Operation)),
+		attribute.Bool("admission.dry_run", dryRun))
+
+	_, decodeSpan := obs.StartSpan(ctx, "decode")
+	workload, err := w.decode(req)
+	obs.EndSpan(decodeSpan, err)
+	if err != nil {
+		authbridgelog.Error(err, "Failed to decode workload")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if workload == nil {
 		authbridgelog.Info("Unsupported resource kind", "kind", req.Kind.Kind)
 		return admission.Allowed("unsupported kind")
 	}
+	podTemplate, resourceName, mutatedObj, labels := workload.podTemplate, workload.name, workload.obj, workload.labels
+
+	// Scaling up an injected workload leaves its pod template unchanged, so the rotation
+	// check runs before the shortcuts below
+	if err := injector.CheckCredentialRotation(&podTemplate.Spec, req.Kind.Kind, workload.replicas); err != nil {
+		return w.denyRotation(req, resourceName, err)
+	}
+
+	// Controllers and tools that only touch annotations can cause UPDATE storms; with the
+	// same pod template and labels as the stored object there is nothing to re-evaluate
+	if req.Operation == admissionv1.Update && injector.PodTemplateUnchanged(req.Kind.Kind, req.OldObject.Raw, req.Object.Raw) {
+		authbridgelog.V(1).Info("Skipping - pod template and labels unchanged",
+			"kind", req.Kind.Kind,
+			"namespace", req.Namespace,
+			"name", req.Name)
+		return admission.Allowed("pod template unchanged")
+	}
 
 	// Check if already injected (idempotency)
-	if w.isAlreadyInjected(podSpec) {
+	if injector.IsInjected(&podTemplate.ObjectMeta) {
 		authbridgelog.Info("Skipping - sidecars already injected",
 			"kind", req.Kind.Kind,
 			"namespace", req.Namespace,
@@ -137,7 +115,7 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 		return admission.Allowed("already injected")
 	}
 
-	if mutated, err := w.Mutator.InjectAuthBridge(ctx, podSpec, req.Namespace, resourceName, labels); err != nil {
+	if mutated, err := w.Mutator.InjectAuthBridge(ctx, podTemplate, req.Namespace, resourceName, labels); err != nil {
 		authbridgelog.Error(err, "Failed to mutate pod spec",
 			"kind", req.Kind.Kind,
 			"namespace", req.Namespace,
@@ -151,8 +129,28 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 		return admission.Allowed("injection not enabled")
 	}
 
+	if err := injector.CheckCredentialRotation(&podTemplate.Spec, req.Kind.Kind, workload.replicas); err != nil {
+		return w.denyRotation(req, resourceName, err)
+	}
+
+	warnings, err := w.Mutator.CheckRequiredConfigMaps(ctx, req.Namespace, injector.IsSpireEnabled(labels), &podTemplate.Spec)
+	if err != nil {
+		authbridgelog.Info("Denying workload with missing ConfigMaps",
+			"kind", req.Kind.Kind,
+			"namespace", req.Namespace,
+			"name", resourceName,
+			"reason", err.Error())
+		return admission.Denied(err.Error())
+	}
+	// The pods of an updated workload already count towards the quota while they are replaced
+	if req.Operation == admissionv1.Create {
+		warnings = append(warnings, w.Mutator.CheckResourceQuota(ctx, req.Namespace, &podTemplate.Spec, workload.replicas)...)
+	}
+
 	// Marshal the mutated object
+	_, marshalSpan := obs.StartSpan(ctx, "marshal")
 	marshaledMutated, err := json.Marshal(mutatedObj)
+	obs.EndSpan(marshalSpan, err)
 	if err != nil {
 		authbridgelog.Error(err, "Failed to marshal mutated resource")
 		return admission.Errored(http.StatusInternalServerError, err)
@@ -161,18 +159,96 @@ func (w *AuthBridgeWebhook) Handle(ctx context.Context, req admission.Request) a
 	authbridgelog.Info("Successfully mutated resource",
 		"kind", req.Kind.Kind,
 		"namespace", req.Namespace,
-		"name", resourceName)
+		"name", resourceName,
+		"dryRun", dryRun)
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledMutated).WithWarnings(warnings...)
+}
 
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledMutated)
+// denyRotation denies a workload whose pods would rotate a client secret they share
+func (w *AuthBridgeWebhook) denyRotation(req admission.Request, name string, err error) admission.Response {
+	authbridgelog.Info("Denying credential rotation for more than one pod",
+		"kind", req.Kind.Kind,
+		"namespace", req.Namespace,
+		"name", name,
+		"reason", err.Error())
+	return admission.Denied(err.Error())
 }
 
-func (w *AuthBridgeWebhook) isAlreadyInjected(podSpec *corev1.PodSpec) bool {
-	for _, container := range podSpec.Containers {
-		if container.Name == injector.SpiffeHelperContainerName || container.Name == injector.ClientRegistrationContainerName {
-			return true
+// decodedWorkload is the object of an admission request and the parts of it the webhook mutates
+type decodedWorkload struct {
+	podTemplate *corev1.PodTemplateSpec
+	name        string
+	obj         interface{}
+	labels      map[string]string
+	// replicas is the number of pods the workload runs at once, for the quota and
+	// credential rotation checks
+	replicas int32
+}
+
+// decode extracts the pod template of the supported workload kinds; it returns nil for
+// other kinds
+func (w *AuthBridgeWebhook) decode(req admission.Request) (*decodedWorkload, error) {
+	workload := &decodedWorkload{replicas: 1}
+	switch req.Kind.Kind {
+	case "Deployment":
+		var deployment appsv1.Deployment
+		if err := w.decoder.Decode(req, &deployment); err != nil {
+			return nil, fmt.Errorf("failed to decode Deployment: %w", err)
+		}
+		workload.podTemplate = &deployment.Spec.Template
+		workload.name = deployment.Name
+		workload.obj = &deployment
+		workload.labels = deployment.Labels
+		workload.replicas = ptr.Deref(deployment.Spec.Replicas, 1)
+
+	case "StatefulSet":
+		var statefulset appsv1.StatefulSet
+		if err := w.decoder.Decode(req, &statefulset); err != nil {
+			return nil, fmt.Errorf("failed to decode StatefulSet: %w", err)
+		}
+		workload.podTemplate = &statefulset.Spec.Template
+		workload.name = statefulset.Name
+		workload.obj = &statefulset
+		workload.labels = statefulset.Labels
+		workload.replicas = ptr.Deref(statefulset.Spec.Replicas, 1)
+
+	case "DaemonSet":
+		var daemonset appsv1.DaemonSet
+		if err := w.decoder.Decode(req, &daemonset); err != nil {
+			return nil, fmt.Errorf("failed to decode DaemonSet: %w", err)
 		}
+		workload.podTemplate = &daemonset.Spec.Template
+		workload.name = daemonset.Name
+		workload.obj = &daemonset
+		workload.labels = daemonset.Labels
+
+	case "Job":
+		var job batchv1.Job
+		if err := w.decoder.Decode(req, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode Job: %w", err)
+		}
+		workload.podTemplate = &job.Spec.Template
+		workload.name = job.Name
+		workload.obj = &job
+		workload.labels = job.Labels
+		workload.replicas = ptr.Deref(job.Spec.Parallelism, 1)
+
+	case "CronJob":
+		var cronjob batchv1.CronJob
+		if err := w.decoder.Decode(req, &cronjob); err != nil {
+			return nil, fmt.Errorf("failed to decode CronJob: %w", err)
+		}
+		workload.podTemplate = &cronjob.Spec.JobTemplate.Spec.Template
+		workload.name = cronjob.Name
+		workload.obj = &cronjob
+		workload.labels = cronjob.Labels
+		workload.replicas = ptr.Deref(cronjob.Spec.JobTemplate.Spec.Parallelism, 1)
+
+	default:
+		return nil, nil
 	}
-	return false
+	return workload, nil
 }
 
 // +kubebuilder:webhook:path=/mutate-workloads-authbridge,mutating=true,failurePolicy=fail,sideEffects=None,groups=apps;batch,resources=deployments;statefulsets;daemonsets;jobs;cronjobs,verbs=create;update,versions=v1,name=inject.kagenti.io,admissionReviewVersions=v1
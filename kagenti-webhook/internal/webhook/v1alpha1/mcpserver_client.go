@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+)
+
+// Keycloak client attributes describing the MCP server
+const (
+	mcpTransportAttribute  = "kagenti.io/mcp-transport"
+	mcpProxyModeAttribute  = "kagenti.io/mcp-proxy-mode"
+	mcpPortAttribute       = "kagenti.io/mcp-port"
+	mcpTargetPortAttribute = "kagenti.io/mcp-target-port"
+	mcpToolsAttribute      = "kagenti.io/mcp-tools"
+)
+
+// Defaults of the MCPServer CRD, for objects admitted before the API server applied them
+const (
+	defaultMCPServerTransport = "stdio"
+	defaultMCPServerProxyMode = "sse"
+	defaultMCPServerPort      = 8080
+)
+
+// mcpServerURL is the URL of the Service toolhive puts in front of the MCP server proxy
+func mcpServerURL(mcpserver *toolhivestacklokdevv1alpha1.MCPServer) string {
+	port := mcpserver.Spec.Port
+	if port == 0 {
+		port = defaultMCPServerPort
+	}
+	return fmt.Sprintf("http://mcp-%s-proxy.%s.svc.cluster.local:%d", mcpserver.Name, mcpserver.Namespace, port)
+}
+
+// mcpServerClientMetadata makes the registered client self-describing: the redirect URIs and
+// audience point at the MCP server's Service, and the transport, ports and tool filter are
+// stored as client attributes
+func mcpServerClientMetadata(mcpserver *toolhivestacklokdevv1alpha1.MCPServer) injector.ClientMetadata {
+	spec := mcpserver.Spec
+	transport := spec.Transport
+	if transport == "" {
+		transport = defaultMCPServerTransport
+	}
+	url := mcpServerURL(mcpserver)
+	port := spec.Port
+	if port == 0 {
+		port = defaultMCPServerPort
+	}
+
+	attributes := map[string]string{
+		mcpTransportAttribute: transport,
+		mcpPortAttribute:      strconv.Itoa(int(port)),
+	}
+	description := fmt.Sprintf("MCP server %s/%s (%s", mcpserver.Namespace, mcpserver.Name, transport)
+	if transport == "stdio" {
+		proxyMode := spec.ProxyMode
+		if proxyMode == "" {
+			proxyMode = defaultMCPServerProxyMode
+		}
+		attributes[mcpProxyModeAttribute] = proxyMode
+		description += " proxied as " + proxyMode
+	}
+	description += ") at " + url
+	if spec.TargetPort != 0 {
+		attributes[mcpTargetPortAttribute] = strconv.Itoa(int(spec.TargetPort))
+	}
+	if len(spec.ToolsFilter) > 0 {
+		attributes[mcpToolsAttribute] = strings.Join(spec.ToolsFilter, ",")
+	}
+
+	return injector.ClientMetadata{
+		Description:  description,
+		RedirectURIs: []string{url + "/*"},
+		Audiences:    []string{url},
+		Attributes:   attributes,
+	}
+}
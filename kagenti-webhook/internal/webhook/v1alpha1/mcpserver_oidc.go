@@ -0,0 +1,98 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// mcpServerServiceAccount is the service account toolhive runs the MCP server as
+func mcpServerServiceAccount(mcpserver *toolhivestacklokdevv1alpha1.MCPServer) string {
+	if mcpserver.Spec.ServiceAccount != nil {
+		return *mcpserver.Spec.ServiceAccount
+	}
+	return mcpserver.Name + "-sa"
+}
+
+// mcpServerClientID is the Keycloak client ID client-registration registers for the MCPServer:
+// the kagenti.io/spiffe-id annotation if set, otherwise derived; it is unknown with SPIRE
+// unless the trust domain is configured
+func mcpServerClientID(mutator *injector.PodMutator, mcpserver *toolhivestacklokdevv1alpha1.MCPServer) string {
+	if id, err := injector.SpiffeIDOverride(mcpserver.Annotations); id != "" || err != nil {
+		return id
+	}
+	if !mutator.IsMCPServerSpireEnabled(mcpserver.Labels) {
+		return mcpserver.Namespace + "/" + mcpserver.Name
+	}
+	if mutator.SpiffeTrustDomain == "" {
+		return ""
+	}
+	return "spiffe://" + mutator.SpiffeTrustDomain + injector.SpiffeIDPath(mcpserver.Namespace, mcpServerServiceAccount(mcpserver))
+}
+
+// defaultOIDCConfig lets the thv proxy validate the tokens callers exchange for the registered
+// client: the issuer is the realm of the namespace's Keycloak annotations or environments
+// ConfigMap and the audience is the client ID. An OIDC configuration set on the MCPServer
+// is never replaced.
+func (d *MCPServerCustomDefaulter) defaultOIDCConfig(ctx context.Context, mcpserver *toolhivestacklokdevv1alpha1.MCPServer) error {
+	if mcpserver.Spec.OIDCConfig != nil || d.Mutator.Client == nil {
+		return nil
+	}
+
+	var keycloakURL, realm string
+	if profile, err := injector.NamespaceIDPProfile(ctx, d.Mutator.Client, mcpserver.Namespace); err != nil {
+		return err
+	} else if profile != nil {
+		keycloakURL, realm = profile.KeycloakURL, profile.KeycloakRealm
+	} else {
+		environments := &corev1.ConfigMap{}
+		err := d.Mutator.Client.Get(ctx, client.ObjectKey{Namespace: mcpserver.Namespace, Name: injector.EnvironmentsConfigMap}, environments)
+		if apierrors.IsNotFound(err) {
+			mcpserverlog.Info("Skipping OIDC defaults, environments ConfigMap not found", "name", mcpserver.Name)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		keycloakURL, realm = environments.Data["KEYCLOAK_URL"], environments.Data["KEYCLOAK_REALM"]
+	}
+	if keycloakURL == "" || realm == "" {
+		mcpserverlog.Info("Skipping OIDC defaults, Keycloak URL or realm not set", "name", mcpserver.Name)
+		return nil
+	}
+
+	issuer := strings.TrimSuffix(keycloakURL, "/") + "/realms/" + realm
+	mcpserver.Spec.OIDCConfig = &toolhivestacklokdevv1alpha1.OIDCConfigRef{
+		Type: "inline",
+		Inline: &toolhivestacklokdevv1alpha1.InlineOIDCConfig{
+			Issuer:   issuer,
+			Audience: mcpServerClientID(d.Mutator, mcpserver),
+			JWKSURL:  issuer + "/protocol/openid-connect/certs",
+			// Keycloak usually runs in the cluster
+			JWKSAllowPrivateIP: true,
+		},
+	}
+	mcpserverlog.Info("Defaulted OIDC configuration", "name", mcpserver.Name, "issuer", issuer,
+		"audience", mcpserver.Spec.OIDCConfig.Inline.Audience)
+	return nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Namespace annotations capping the resources of the MCPServers in the namespace
+const (
+	MCPServerMaxCPUAnnotation    = "kagenti.io/mcpserver-max-cpu"
+	MCPServerMaxMemoryAnnotation = "kagenti.io/mcpserver-max-memory"
+)
+
+// PolicyAction is what admission does with an MCPServer that violates the policy
+type PolicyAction string
+
+const (
+	// PolicyActionWarn admits the MCPServer and returns one admission warning per violation
+	PolicyActionWarn PolicyAction = "warn"
+	// PolicyActionDeny rejects the MCPServer
+	PolicyActionDeny PolicyAction = "deny"
+)
+
+// ParsePolicyAction validates a policy action value
+func ParsePolicyAction(value string) (PolicyAction, error) {
+	switch action := PolicyAction(strings.ToLower(strings.TrimSpace(value))); action {
+	case PolicyActionWarn, PolicyActionDeny:
+		return action, nil
+	default:
+		return "", fmt.Errorf("policy action must be %s or %s, got %q", PolicyActionWarn, PolicyActionDeny, value)
+	}
+}
+
+// MCPServerPolicy restricts what tenants may run as MCPServers. Both checks are opt-in: the
+// registry check applies once AllowedRegistries is set, the resource check in namespaces
+// annotated with a ceiling.
+type MCPServerPolicy struct {
+	// AllowedRegistries are registries, optionally followed by a path (ghcr.io/kagenti), the
+	// MCPServer images must come from; Docker Hub images belong to docker.io
+	AllowedRegistries []string
+	// Action is what admission does with violations; empty means warn
+	Action PolicyAction
+}
+
+// check returns the policy violations of mcpserver; images of the injected sidecars are
+// always allowed, and so are the namespace's missing or unreadable ceilings
+func (p MCPServerPolicy) check(ctx context.Context, c client.Client, mutator *injector.PodMutator,
+	mcpserver *toolhivestacklokdevv1alpha1.MCPServer) (field.ErrorList, error) {
+	var violations field.ErrorList
+	spec := field.NewPath("spec")
+
+	if len(p.AllowedRegistries) > 0 {
+		sidecars := sidecarImages(mutator)
+		for _, image := range mcpServerImages(mcpserver) {
+			if image.image == "" || sidecars[image.image] || p.registryAllowed(image.image) {
+				continue
+			}
+			violations = append(violations, field.Forbidden(image.path, fmt.Sprintf(
+				"image %q is not from an allowed registry (%s)", image.image, strings.Join(p.AllowedRegistries, ", "))))
+		}
+	}
+	if c == nil {
+		return violations, nil
+	}
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: mcpserver.Namespace}, namespace); err != nil {
+		mcpserverlog.Error(err, "Failed to look up namespace resource ceilings", "namespace", mcpserver.Namespace)
+		return violations, nil
+	}
+	resourcesPath := spec.Child("resources")
+	for _, ceiling := range []struct {
+		annotation, name string
+		limit, request   string
+	}{
+		{MCPServerMaxCPUAnnotation, "cpu", mcpserver.Spec.Resources.Limits.CPU, mcpserver.Spec.Resources.Requests.CPU},
+		{MCPServerMaxMemoryAnnotation, "memory", mcpserver.Spec.Resources.Limits.Memory, mcpserver.Spec.Resources.Requests.Memory},
+	} {
+		value, ok := namespace.Annotations[ceiling.annotation]
+		if !ok {
+			continue
+		}
+		maximum, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation on namespace %s: %w", ceiling.annotation, mcpserver.Namespace, err)
+		}
+		if ceiling.limit == "" {
+			violations = append(violations, field.Required(resourcesPath.Child("limits", ceiling.name),
+				fmt.Sprintf("namespace %s caps MCPServers at %s", mcpserver.Namespace, maximum.String())))
+		}
+		for _, requested := range []struct {
+			path  *field.Path
+			value string
+		}{{resourcesPath.Child("limits", ceiling.name), ceiling.limit}, {resourcesPath.Child("requests", ceiling.name), ceiling.request}} {
+			if requested.value == "" {
+				continue
+			}
+			quantity, err := resource.ParseQuantity(requested.value)
+			if err != nil {
+				violations = append(violations, field.Invalid(requested.path, requested.value, err.Error()))
+			} else if quantity.Cmp(maximum) > 0 {
+				violations = append(violations, field.Invalid(requested.path, requested.value,
+					fmt.Sprintf("exceeds the ceiling of %s in namespace %s", maximum.String(), mcpserver.Namespace)))
+			}
+		}
+	}
+	return violations, nil
+}
+
+type imageField struct {
+	path  *field.Path
+	image string
+}
+
+// mcpServerImages lists the MCP server image and those of the pod template containers
+func mcpServerImages(mcpserver *toolhivestacklokdevv1alpha1.MCPServer) []imageField {
+	spec := field.NewPath("spec")
+	images := []imageField{{spec.Child("image"), mcpserver.Spec.Image}}
+	if mcpserver.Spec.PodTemplateSpec == nil {
+		return images
+	}
+	podSpec := &mcpserver.Spec.PodTemplateSpec.Spec
+	podSpecPath := spec.Child("podTemplateSpec", "spec")
+	for i, c := range podSpec.InitContainers {
+		images = append(images, imageField{podSpecPath.Child("initContainers").Index(i).Child("image"), c.Image})
+	}
+	for i, c := range podSpec.Containers {
+		images = append(images, imageField{podSpecPath.Child("containers").Index(i).Child("image"), c.Image})
+	}
+	return images
+}
+
+// registryAllowed reports whether image comes from one of the allowed registries
+func (p MCPServerPolicy) registryAllowed(image string) bool {
+	repository, ok := imageRepository(image)
+	if !ok {
+		return false
+	}
+	for _, allowed := range p.AllowedRegistries {
+		allowed = strings.TrimSuffix(allowed, "/")
+		if repository == allowed || strings.HasPrefix(repository, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// imageRepository returns the image name with its registry and without tag or digest, the
+// way the container runtime resolves it; toolhive's protocol images (uvx://, npx://, go://)
+// are built in the cluster and have none
+func imageRepository(image string) (string, bool) {
+	if strings.Contains(image, "://") {
+		return "", false
+	}
+	name, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndexByte(name, ':'); i > strings.LastIndexByte(name, '/') {
+		name = name[:i]
+	}
+	first, _, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return name, true
+	}
+	if !found {
+		name = "library/" + name
+	}
+	return "docker.io/" + name, true
+}
+
+// sidecarImages are the images of the containers the webhook injects
+func sidecarImages(mutator *injector.PodMutator) map[string]bool {
+	images := map[string]bool{}
+	if mutator == nil {
+		return images
+	}
+	podSpec := &corev1.PodSpec{}
+	_ = mutator.InjectInitContainersWithConfig(podSpec, mutator.ProxyInitDefaults)
+	_ = mutator.InjectSidecarsWithSpireOption(podSpec, "", "", true)
+	for _, c := range podSpec.InitContainers {
+		images[c.Image] = true
+	}
+	return images
+}
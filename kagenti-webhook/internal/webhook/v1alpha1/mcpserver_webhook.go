@@ -19,12 +19,19 @@ package v1alpha1
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"slices"
 
 	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
 	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
@@ -35,11 +42,13 @@ import (
 var mcpserverlog = logf.Log.WithName("mcpserver-resource")
 
 // SetupMCPServerWebhookWithManager registers the webhook for MCPServer in the manager.
-func SetupMCPServerWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMutator) error {
+func SetupMCPServerWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMutator, policy MCPServerPolicy) error {
 	return ctrl.NewWebhookManagedBy(mgr).
 		For(&toolhivestacklokdevv1alpha1.MCPServer{}).
-		WithValidator(&MCPServerCustomValidator{}).
+		WithValidator(&MCPServerCustomValidator{Mutator: mutator, Policy: policy}).
 		WithDefaulter(&MCPServerCustomDefaulter{Mutator: mutator}).
+		WithDefaulterCustomPath(registration.MCPServerPath).
+		WithValidatorCustomPath(registration.MCPServerValidatePath).
 		Complete()
 }
 
@@ -72,14 +81,27 @@ func (d *MCPServerCustomDefaulter) Default(ctx context.Context, obj runtime.Obje
 		}
 	}
 
-	// Use shared pod mutator for injection
-	return d.Mutator.MutatePodSpec(
+	// Use shared pod mutator for injection, honouring the kagenti.io/inject and kagenti.io/spire labels
+	if err := d.Mutator.MutateMCPServerPodTemplate(
 		ctx,
-		&mcpserver.Spec.PodTemplateSpec.Spec,
+		mcpserver.Spec.PodTemplateSpec,
 		mcpserver.Namespace,
 		mcpserver.Name,
+		mcpserver.Labels,
 		mcpserver.Annotations,
-	)
+	); err != nil {
+		return err
+	}
+
+	podSpec := &mcpserver.Spec.PodTemplateSpec.Spec
+	if !injector.ClientRegistrationInjected(podSpec) {
+		return nil
+	}
+	injector.InjectClientMetadata(podSpec, mcpServerClientMetadata(mcpserver))
+	if d.Mutator.MCPServerOIDCDefaults {
+		return d.defaultOIDCConfig(ctx, mcpserver)
+	}
+	return nil
 }
 
 // TODO(user): change verbs to "verbs=create;update;delete" if you want to enable deletion validation.
@@ -93,11 +115,20 @@ func (d *MCPServerCustomDefaulter) Default(ctx context.Context, obj runtime.Obje
 // NOTE: The +kubebuilder:object:generate=false marker prevents controller-gen from generating DeepCopy methods,
 // as this struct is used only for temporary operations and does not need to be deeply copied.
 type MCPServerCustomValidator struct {
-	// TODO(user): Add more fields as needed for validation
+	// Mutator, if set, decides whether the MCPServer will be injected; the injection checks are skipped without it
+	Mutator *injector.PodMutator
+	// Policy restricts the images and resources of MCPServers
+	Policy MCPServerPolicy
 }
 
 var _ webhook.CustomValidator = &MCPServerCustomValidator{}
 
+// Transports and proxy modes of the MCPServer CRD, in case an older CRD without the enums is installed
+var (
+	mcpServerTransports = []string{"stdio", "streamable-http", "sse"}
+	mcpServerProxyModes = []string{"sse", "streamable-http"}
+)
+
 // ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type MCPServer.
 func (v *MCPServerCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	mcpserver, ok := obj.(*toolhivestacklokdevv1alpha1.MCPServer)
@@ -106,9 +137,7 @@ func (v *MCPServerCustomValidator) ValidateCreate(ctx context.Context, obj runti
 	}
 	mcpserverlog.Info("Validation for MCPServer upon creation", "name", mcpserver.GetName())
 
-	// TODO(user): fill in your validation logic upon object creation.
-
-	return nil, nil
+	return v.validate(ctx, mcpserver, nil)
 }
 
 // ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type MCPServer.
@@ -117,11 +146,17 @@ func (v *MCPServerCustomValidator) ValidateUpdate(ctx context.Context, oldObj, n
 	if !ok {
 		return nil, fmt.Errorf("expected a MCPServer object for the newObj but got %T", newObj)
 	}
+	old, ok := oldObj.(*toolhivestacklokdevv1alpha1.MCPServer)
+	if !ok {
+		return nil, fmt.Errorf("expected a MCPServer object for the oldObj but got %T", oldObj)
+	}
 	mcpserverlog.Info("Validation for MCPServer upon update", "name", mcpserver.GetName())
 
-	// TODO(user): fill in your validation logic upon object update.
-
-	return nil, nil
+	// Finalizers must be removable whatever the namespace looks like by now
+	if mcpserver.DeletionTimestamp != nil {
+		return nil, nil
+	}
+	return v.validate(ctx, mcpserver, old)
 }
 
 // ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type MCPServer.
@@ -132,7 +167,165 @@ func (v *MCPServerCustomValidator) ValidateDelete(ctx context.Context, obj runti
 	}
 	mcpserverlog.Info("Validation for MCPServer upon deletion", "name", mcpserver.GetName())
 
-	// TODO(user): fill in your validation logic upon object deletion.
-
 	return nil, nil
 }
+
+// validate checks the transport and ports and, when the MCPServer will be injected, that the
+// sidecars can run: the target port is free, the client ID fits Keycloak and the sidecar
+// ConfigMaps exist. Pod template overrides of injected containers and volumes are warnings,
+// and so are policy violations unless the policy denies them. On update, old is the stored
+// object: what it already got wrong, and ConfigMaps missing for an MCPServer that was
+// already injected, are warnings, so an update is only denied for what it changes.
+func (v *MCPServerCustomValidator) validate(ctx context.Context, mcpserver, old *toolhivestacklokdevv1alpha1.MCPServer) (admission.Warnings, error) {
+	var wasInjected bool
+	var oldErrs field.ErrorList
+	if old != nil {
+		// An old object that cannot be checked is held to the full checks
+		var err error
+		if v.Mutator != nil {
+			wasInjected, err = v.Mutator.MCPServerNeedsMutation(ctx, old.Spec.PodTemplateSpec, old.Namespace, old.Name,
+				old.Labels, old.Annotations)
+		}
+		if err == nil {
+			oldErrs, _, err = v.check(ctx, old, true)
+		}
+		if err != nil {
+			mcpserverlog.Info("Failed to check the stored MCPServer, checking the update in full", "name", old.Name, "error", err.Error())
+			wasInjected, oldErrs = false, nil
+		}
+	}
+
+	allErrs, warnings, err := v.check(ctx, mcpserver, wasInjected)
+	if err != nil {
+		return warnings, err
+	}
+	allErrs = slices.DeleteFunc(allErrs, func(e *field.Error) bool {
+		unchanged := slices.ContainsFunc(oldErrs, func(o *field.Error) bool {
+			return o.Type == e.Type && o.Field == e.Field && reflect.DeepEqual(o.BadValue, e.BadValue)
+		})
+		if unchanged {
+			warnings = append(warnings, e.Error()+" (unchanged by this update)")
+		}
+		return unchanged
+	})
+	if len(allErrs) > 0 {
+		return warnings, apierrors.NewInvalid(
+			toolhivestacklokdevv1alpha1.GroupVersion.WithKind("MCPServer").GroupKind(), mcpserver.Name, allErrs)
+	}
+	return warnings, nil
+}
+
+// check returns the field errors and warnings of validate; with tolerateConfigMaps, missing
+// ConfigMaps are warnings even when the ConfigMap check denies
+func (v *MCPServerCustomValidator) check(ctx context.Context, mcpserver *toolhivestacklokdevv1alpha1.MCPServer, tolerateConfigMaps bool) (field.ErrorList, admission.Warnings, error) {
+	var warnings admission.Warnings
+	var allErrs field.ErrorList
+	spec := field.NewPath("spec")
+
+	if transport := mcpserver.Spec.Transport; transport != "" && !slices.Contains(mcpServerTransports, transport) {
+		allErrs = append(allErrs, field.NotSupported(spec.Child("transport"), transport, mcpServerTransports))
+	}
+	if proxyMode := mcpserver.Spec.ProxyMode; proxyMode != "" {
+		if !slices.Contains(mcpServerProxyModes, proxyMode) {
+			allErrs = append(allErrs, field.NotSupported(spec.Child("proxyMode"), proxyMode, mcpServerProxyModes))
+		} else if mcpserver.Spec.Transport != "" && mcpserver.Spec.Transport != "stdio" {
+			warnings = append(warnings, fmt.Sprintf("spec.proxyMode is ignored with the %s transport", mcpserver.Spec.Transport))
+		}
+	}
+	for _, port := range []struct {
+		name  string
+		value int32
+	}{{"port", mcpserver.Spec.Port}, {"targetPort", mcpserver.Spec.TargetPort}} {
+		// 0 leaves the port to the toolhive default
+		if port.value < 0 || port.value > 65535 {
+			allErrs = append(allErrs, field.Invalid(spec.Child(port.name), port.value, "must be between 1 and 65535, or 0 for the default"))
+		}
+	}
+
+	var c client.Client
+	if v.Mutator != nil {
+		c = v.Mutator.Client
+	}
+	violations, err := v.Policy.check(ctx, c, v.Mutator, mcpserver)
+	if err != nil {
+		return nil, warnings, err
+	}
+	if v.Policy.Action == PolicyActionDeny {
+		allErrs = append(allErrs, violations...)
+	} else {
+		for _, violation := range violations {
+			warnings = append(warnings, violation.Error())
+		}
+	}
+
+	if v.Mutator != nil {
+		injectErrs, injectWarnings, err := v.validateInjection(ctx, mcpserver, tolerateConfigMaps)
+		if err != nil {
+			return nil, warnings, err
+		}
+		allErrs = append(allErrs, injectErrs...)
+		warnings = append(warnings, injectWarnings...)
+	}
+	return allErrs, warnings, nil
+}
+
+func (v *MCPServerCustomValidator) validateInjection(ctx context.Context, mcpserver *toolhivestacklokdevv1alpha1.MCPServer, tolerateConfigMaps bool) (field.ErrorList, admission.Warnings, error) {
+	inject, err := v.Mutator.MCPServerNeedsMutation(ctx, mcpserver.Spec.PodTemplateSpec, mcpserver.Namespace, mcpserver.Name,
+		mcpserver.Labels, mcpserver.Annotations)
+	if err != nil || !inject {
+		return nil, nil, err
+	}
+	spireEnabled := v.Mutator.IsMCPServerSpireEnabled(mcpserver.Labels)
+
+	var allErrs field.ErrorList
+	spec := field.NewPath("spec")
+	if owner, ok := v.Mutator.InjectedPorts(spireEnabled)[mcpserver.Spec.TargetPort]; ok {
+		allErrs = append(allErrs, field.Invalid(spec.Child("targetPort"), mcpserver.Spec.TargetPort,
+			fmt.Sprintf("is used by the injected %s container", owner)))
+	}
+
+	// The kagenti.io/spiffe-id annotation replaces the derived SPIFFE ID and client ID
+	spiffeID, err := injector.SpiffeIDOverride(mcpserver.Annotations)
+	if err == nil {
+		err = v.Mutator.CheckSpiffeIDOverride(spiffeID, mcpserver.Namespace, mcpServerServiceAccount(mcpserver))
+	}
+	switch clientID := mcpserver.Namespace + "/" + mcpserver.Name; {
+	case err != nil:
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "annotations").Key(injector.SpiffeIDAnnotation),
+			mcpserver.Annotations[injector.SpiffeIDAnnotation], err.Error()))
+	case spiffeID != "":
+	case spireEnabled:
+		serviceAccount := mcpServerServiceAccount(mcpserver)
+		saPath := spec.Child("serviceAccount")
+		if msgs := validation.IsDNS1123Subdomain(serviceAccount); len(msgs) > 0 {
+			for _, msg := range msgs {
+				allErrs = append(allErrs, field.Invalid(saPath, serviceAccount, msg))
+			}
+		} else if err := injector.ValidateSpiffeID(v.Mutator.SpiffeTrustDomain,
+			injector.SpiffeIDPath(mcpserver.Namespace, serviceAccount)); err != nil {
+			allErrs = append(allErrs, field.Invalid(saPath, serviceAccount, err.Error()))
+		}
+	case len(clientID) > injector.MaxClientIDLength:
+		allErrs = append(allErrs, field.Invalid(field.NewPath("metadata", "name"), mcpserver.Name,
+			fmt.Sprintf("client ID %q is longer than the %d characters Keycloak allows", clientID, injector.MaxClientIDLength)))
+	}
+
+	// the mutating webhook runs first, so an injected pod template has the final key references
+	var podSpec *corev1.PodSpec
+	if template := mcpserver.Spec.PodTemplateSpec; template != nil && injector.IsInjected(&template.ObjectMeta) {
+		podSpec = &template.Spec
+	}
+	warnings, err := v.Mutator.CheckRequiredConfigMaps(ctx, mcpserver.Namespace, spireEnabled, podSpec)
+	if err != nil && tolerateConfigMaps {
+		// The denial names every missing ConfigMap and key
+		warnings, err = admission.Warnings{err.Error()}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if mcpserver.Spec.PodTemplateSpec != nil {
+		warnings = append(warnings, v.Mutator.SidecarConflicts(&mcpserver.Spec.PodTemplateSpec.Spec,
+			mcpserver.Namespace, mcpserver.Name, spireEnabled)...)
+	}
+	return allErrs, warnings, nil
+}
@@ -19,9 +19,16 @@ package v1alpha1
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
 	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
-	// TODO (user): Add any additional imports if needed
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("MCPServer Webhook", func() {
@@ -49,39 +56,224 @@ var _ = Describe("MCPServer Webhook", func() {
 	})
 
 	Context("When creating MCPServer under Defaulting Webhook", func() {
-		// TODO (user): Add logic for defaulting webhooks
-		// Example:
-		// It("Should apply defaults when a required field is empty", func() {
-		//     By("simulating a scenario where defaults should be applied")
-		//     obj.SomeFieldWithDefault = ""
-		//     By("calling the Default method to apply defaults")
-		//     defaulter.Default(ctx, obj)
-		//     By("checking that the default values are set")
-		//     Expect(obj.SomeFieldWithDefault).To(Equal("default_value"))
-		// })
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			defaulter.Mutator = injector.NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tools"}},
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: injector.EnvironmentsConfigMap, Namespace: "tools"},
+					Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak:8080/", "KEYCLOAK_REALM": "kagenti"},
+				}).Build(), true)
+			obj.Namespace = "tools"
+			obj.Name = "fetch"
+			obj.Annotations = map[string]string{injector.DefaultCRAnnotation: "true"}
+		})
+
+		It("Should point the OIDC configuration at the registered client", func() {
+			defaulter.Mutator.SpiffeTrustDomain = "example.org"
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.OIDCConfig.Type).To(Equal("inline"))
+			Expect(*obj.Spec.OIDCConfig.Inline).To(MatchFields(IgnoreExtras, Fields{
+				"Issuer":   Equal("http://keycloak:8080/realms/kagenti"),
+				"Audience": Equal("spiffe://example.org/ns/tools/sa/fetch-sa"),
+				"JWKSURL":  Equal("http://keycloak:8080/realms/kagenti/protocol/openid-connect/certs"),
+			}))
+		})
+
+		It("Should use the static client ID without SPIRE", func() {
+			obj.Labels = map[string]string{injector.SpireEnableLabel: injector.SpireDisabledValue}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.OIDCConfig.Inline.Audience).To(Equal("tools/fetch"))
+		})
+
+		It("Should keep an existing OIDC configuration and skip MCPServers that are not injected", func() {
+			obj.Spec.OIDCConfig = &toolhivestacklokdevv1alpha1.OIDCConfigRef{Type: "kubernetes"}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(obj.Spec.OIDCConfig.Inline).To(BeNil())
+
+			other := &toolhivestacklokdevv1alpha1.MCPServer{}
+			other.Namespace, other.Name = "tools", "other"
+			Expect(defaulter.Default(ctx, other)).To(Succeed())
+			Expect(other.Spec.OIDCConfig).To(BeNil())
+		})
+
+		It("Should describe the MCP server on the registered client", func() {
+			obj.Spec.Transport = "stdio"
+			obj.Spec.Port = 8000
+			obj.Spec.ToolsFilter = []string{"fetch", "search"}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+
+			var registration corev1.Container
+			for _, c := range obj.Spec.PodTemplateSpec.Spec.InitContainers {
+				if c.Name == injector.ClientRegistrationContainerName {
+					registration = c
+				}
+			}
+			url := "http://mcp-fetch-proxy.tools.svc.cluster.local:8000"
+			Expect(registration.Env).To(ContainElements(
+				corev1.EnvVar{Name: injector.ClientDescriptionEnv, Value: "MCP server tools/fetch (stdio proxied as sse) at " + url},
+				corev1.EnvVar{Name: injector.ClientRedirectURIsEnv, Value: url + "/*"},
+				corev1.EnvVar{Name: injector.ClientAudiencesEnv, Value: url},
+				corev1.EnvVar{Name: injector.ClientAttributesEnv, Value: `{"kagenti.io/mcp-port":"8000",` +
+					`"kagenti.io/mcp-proxy-mode":"sse","kagenti.io/mcp-tools":"fetch,search","kagenti.io/mcp-transport":"stdio"}`},
+			))
+		})
 	})
 
 	Context("When creating or updating MCPServer under Validating Webhook", func() {
-		// TODO (user): Add logic for validating webhooks
-		// Example:
-		// It("Should deny creation if a required field is missing", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = ""
-		//     Expect(validator.ValidateCreate(ctx, obj)).Error().To(HaveOccurred())
-		// })
-		//
-		// It("Should admit creation if all required fields are present", func() {
-		//     By("simulating an invalid creation scenario")
-		//     obj.SomeRequiredField = "valid_value"
-		//     Expect(validator.ValidateCreate(ctx, obj)).To(BeNil())
-		// })
-		//
-		// It("Should validate updates correctly", func() {
-		//     By("simulating a valid update scenario")
-		//     oldObj.SomeRequiredField = "updated_value"
-		//     obj.SomeRequiredField = "updated_value"
-		//     Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeNil())
-		// })
+		BeforeEach(func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			validator.Mutator = injector.NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tools"}}).Build(), true)
+			obj.Namespace = "tools"
+			obj.Name = "fetch"
+			obj.Spec.Image = "fetch:latest"
+		})
+
+		It("Should admit a plain MCPServer without injection checks", func() {
+			obj.Spec.Transport = "streamable-http"
+			obj.Spec.TargetPort = injector.EnvoyAdminPort
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeEmpty())
+		})
+
+		It("Should deny unsupported transports and invalid ports", func() {
+			obj.Spec.Transport = "websocket"
+			obj.Spec.Port = 70000
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(And(ContainSubstring("spec.transport"), ContainSubstring("spec.port"))))
+		})
+
+		It("Should warn about a proxy mode that is ignored", func() {
+			obj.Spec.Transport = "sse"
+			obj.Spec.ProxyMode = "streamable-http"
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(ConsistOf(ContainSubstring("spec.proxyMode is ignored")))
+		})
+
+		It("Should check the sidecars when the MCPServer will be injected", func() {
+			obj.Annotations = map[string]string{injector.DefaultCRAnnotation: "true"}
+			obj.Spec.TargetPort = injector.EnvoyAdminPort
+			obj.Spec.ServiceAccount = ptr.To("Fetch_SA")
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(And(
+				ContainSubstring("is used by the injected envoy-proxy container"),
+				ContainSubstring("spec.serviceAccount"))))
+		})
+
+		It("Should warn about missing ConfigMaps and overridden sidecars", func() {
+			obj.Labels = map[string]string{
+				injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+				injector.SpireEnableLabel:      injector.SpireDisabledValue,
+			}
+			obj.Spec.PodTemplateSpec = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: injector.EnvoyProxyContainerName, Image: "envoy:custom"}},
+			}}
+			warnings, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElements(
+				ContainSubstring(`ConfigMap "envoy-config" not found`),
+				ContainSubstring(`container "envoy-proxy" overrides the injected sidecar`)))
+
+			validator.Mutator.ConfigMapCheck = injector.ConfigMapCheckDeny
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("missing AuthBridge ConfigMaps")))
+		})
+
+		It("Should deny SPIFFE ID overrides of another service account", func() {
+			obj.Annotations = map[string]string{
+				injector.DefaultCRAnnotation: "true",
+				injector.SpiffeIDAnnotation:  "spiffe://example.org/ns/tools/sa/fetch-sa",
+			}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).NotTo(HaveOccurred())
+
+			obj.Spec.ServiceAccount = ptr.To("fetch")
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("not in the allowed SPIFFE ID overrides")))
+		})
+
+		It("Should deny on update only what the update changes", func() {
+			obj.Annotations = map[string]string{injector.DefaultCRAnnotation: "true"}
+			obj.Spec.TargetPort = injector.EnvoyAdminPort
+			oldObj = obj.DeepCopy()
+			obj.Spec.Image = "fetch:v2"
+			warnings, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ContainElement(And(
+				ContainSubstring("is used by the injected envoy-proxy container"),
+				ContainSubstring("unchanged by this update"))))
+
+			obj.Spec.TargetPort = injector.ExtProcPort
+			_, err = validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("is used by the injected")))
+		})
+
+		It("Should not deny updates of injected MCPServers for ConfigMaps missing by now", func() {
+			validator.Mutator.ConfigMapCheck = injector.ConfigMapCheckDeny
+			obj.Labels = map[string]string{
+				injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+				injector.SpireEnableLabel:      injector.SpireDisabledValue,
+			}
+			oldObj = obj.DeepCopy()
+			obj.Spec.Image = "fetch:v2"
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(ContainElement(ContainSubstring("missing AuthBridge ConfigMaps")))
+
+			By("denying an update that turns injection on")
+			oldObj.Labels = nil
+			_, err := validator.ValidateUpdate(ctx, oldObj, obj)
+			Expect(err).To(MatchError(ContainSubstring("missing AuthBridge ConfigMaps")))
+
+			By("admitting whatever an MCPServer being deleted looks like")
+			obj.DeletionTimestamp = ptr.To(metav1.Now())
+			obj.Spec.Port = 70000
+			Expect(validator.ValidateUpdate(ctx, oldObj, obj)).To(BeEmpty())
+		})
+
+		It("Should hold images to the allowed registries", func() {
+			validator.Policy = MCPServerPolicy{AllowedRegistries: []string{"ghcr.io/kagenti", "docker.io/library"}}
+			obj.Spec.PodTemplateSpec = &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+				{Name: "helper", Image: "quay.io/tenant/helper:1.0"},
+			}}}
+			Expect(validator.ValidateCreate(ctx, obj)).To(ConsistOf(
+				ContainSubstring(`spec.podTemplateSpec.spec.containers[0].image: Forbidden: image "quay.io/tenant/helper:1.0"`)))
+
+			obj.Spec.Image = "uvx://mcp-server-fetch"
+			validator.Policy.Action = PolicyActionDeny
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(And(ContainSubstring("spec.image"), ContainSubstring("quay.io/tenant/helper"))))
+		})
+
+		It("Should allow the injected sidecar images whatever the registries", func() {
+			validator.Policy = MCPServerPolicy{AllowedRegistries: []string{"ghcr.io/kagenti/"}, Action: PolicyActionDeny}
+			obj.Spec.Image = "ghcr.io/kagenti/fetch@sha256:0123"
+			obj.Labels = map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue}
+			defaulter := MCPServerCustomDefaulter{Mutator: validator.Mutator}
+			Expect(defaulter.Default(ctx, obj)).To(Succeed())
+			Expect(validator.ValidateCreate(ctx, obj)).Error().NotTo(HaveOccurred())
+		})
+
+		It("Should keep resources within the namespace ceilings", func() {
+			scheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+			validator.Mutator = injector.NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tools", Annotations: map[string]string{
+					MCPServerMaxCPUAnnotation:    "500m",
+					MCPServerMaxMemoryAnnotation: "256Mi",
+				}}}).Build(), true)
+			validator.Policy.Action = PolicyActionDeny
+			obj.Spec.Resources.Limits = toolhivestacklokdevv1alpha1.ResourceList{CPU: "1", Memory: "128Mi"}
+			_, err := validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring(`spec.resources.limits.cpu: Invalid value: "1": exceeds the ceiling of 500m`)))
+
+			obj.Spec.Resources.Limits = toolhivestacklokdevv1alpha1.ResourceList{CPU: "250m"}
+			obj.Spec.Resources.Requests.Memory = "64Mi"
+			_, err = validator.ValidateCreate(ctx, obj)
+			Expect(err).To(MatchError(ContainSubstring("spec.resources.limits.memory: Required value")))
+
+			obj.Spec.Resources.Limits.Memory = "256Mi"
+			Expect(validator.ValidateCreate(ctx, obj)).To(BeEmpty())
+		})
 	})
 
 })
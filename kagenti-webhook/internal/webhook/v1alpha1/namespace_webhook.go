@@ -0,0 +1,102 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var namespacelog = logf.Log.WithName("namespace-webhook")
+
+// NamespaceWebhook records the onboarding of a namespace the moment it is labelled
+// kagenti-enabled=true. The namespace-config controller then provisions the defaults and
+// turns the Pending condition into the outcome; the webhook itself has no side effects.
+type NamespaceWebhook struct {
+	Mutator *injector.PodMutator
+	decoder admission.Decoder
+}
+
+// SetupNamespaceWebhookWithManager registers the namespace webhook with the manager
+func SetupNamespaceWebhookWithManager(mgr ctrl.Manager, mutator *injector.PodMutator) error {
+	mgr.GetWebhookServer().Register(registration.NamespacePath, &admission.Webhook{
+		Handler: &NamespaceWebhook{
+			Mutator: mutator,
+			decoder: admission.NewDecoder(mgr.GetScheme()),
+		},
+	})
+	return nil
+}
+
+// Handle marks newly enabled namespaces Pending and drops the condition of namespaces
+// whose label is removed
+func (w *NamespaceWebhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	namespace := &corev1.Namespace{}
+	if err := w.decoder.DecodeRaw(req.Object, namespace); err != nil {
+		namespacelog.Error(err, "Failed to decode namespace")
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	wasEnabled := false
+	if req.Operation == admissionv1.Update {
+		old := &corev1.Namespace{}
+		if err := w.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			namespacelog.Error(err, "Failed to decode namespace")
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		wasEnabled = old.Labels[injector.DefaultNamespaceLabel] == "true"
+	}
+	enabled := namespace.Labels[injector.DefaultNamespaceLabel] == "true"
+
+	var warnings []string
+	switch {
+	case enabled && !wasEnabled:
+		if w.Mutator.IsNamespaceExcluded(namespace.Name) {
+			warnings = append(warnings, fmt.Sprintf("namespace %s is excluded from injection; the %s label has no effect",
+				namespace.Name, injector.DefaultNamespaceLabel))
+			return admission.Allowed("namespace excluded").WithWarnings(warnings...)
+		}
+		injector.SetOnboardingCondition(&namespace.ObjectMeta, metav1.ConditionFalse, injector.OnboardingReasonPending,
+			"Provisioning the namespace defaults")
+		namespacelog.Info("Onboarding namespace", "namespace", namespace.Name, "operation", req.Operation)
+	case !enabled && wasEnabled:
+		if _, ok := namespace.Annotations[injector.NamespaceOnboardingAnnotation]; !ok {
+			return admission.Allowed("no onboarding condition")
+		}
+		delete(namespace.Annotations, injector.NamespaceOnboardingAnnotation)
+		namespacelog.Info("Namespace left AuthBridge", "namespace", namespace.Name)
+	default:
+		return admission.Allowed("onboarding unchanged")
+	}
+
+	marshaled, err := json.Marshal(namespace)
+	if err != nil {
+		namespacelog.Error(err, "Failed to marshal namespace")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled).WithWarnings(warnings...)
+}
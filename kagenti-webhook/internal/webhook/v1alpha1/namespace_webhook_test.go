@@ -0,0 +1,142 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachineryruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("Namespace Webhook", func() {
+	var wh *NamespaceWebhook
+
+	BeforeEach(func() {
+		scheme := apimachineryruntime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		wh = &NamespaceWebhook{
+			Mutator: injector.NewPodMutator(fake.NewClientBuilder().WithScheme(scheme).Build(), true),
+			decoder: admission.NewDecoder(scheme),
+		}
+	})
+
+	namespace := func(name string, labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations}}
+	}
+	raw := func(ns *corev1.Namespace) apimachineryruntime.RawExtension {
+		marshaled, err := json.Marshal(ns)
+		Expect(err).NotTo(HaveOccurred())
+		return apimachineryruntime.RawExtension{Raw: marshaled}
+	}
+	handle := func(operation admissionv1.Operation, ns, old *corev1.Namespace) admission.Response {
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: operation, Object: raw(ns)}}
+		if old != nil {
+			req.OldObject = raw(old)
+		}
+		resp := wh.Handle(ctx, req)
+		Expect(resp.Allowed).To(BeTrue(), "%v", resp.Result)
+		return resp
+	}
+	// expectPending checks that the response adds the Pending condition to annotations
+	expectPending := func(resp admission.Response, annotations map[string]string) {
+		Expect(resp.Patches).To(HaveLen(1))
+		patch := resp.Patches[0]
+		Expect(patch.Operation).To(Equal("add"))
+		value := patch.Value
+		if annotations == nil {
+			Expect(patch.Path).To(Equal("/metadata/annotations"))
+			value = patch.Value.(map[string]interface{})[injector.NamespaceOnboardingAnnotation]
+		} else {
+			Expect(patch.Path).To(Equal("/metadata/annotations/kagenti.io~1onboarding"))
+		}
+		meta := &metav1.ObjectMeta{Annotations: map[string]string{injector.NamespaceOnboardingAnnotation: value.(string)}}
+		condition := injector.OnboardingCondition(meta)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Type).To(Equal(injector.OnboardedCondition))
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(injector.OnboardingReasonPending))
+	}
+	enabled := map[string]string{injector.DefaultNamespaceLabel: "true"}
+
+	It("Should mark a namespace created with the label Pending", func() {
+		resp := handle(admissionv1.Create, namespace("team1", enabled, nil), nil)
+		expectPending(resp, nil)
+		Expect(resp.Warnings).To(BeEmpty())
+	})
+
+	It("Should mark a namespace Pending when the label is added", func() {
+		annotations := map[string]string{"owner": "team1"}
+		resp := handle(admissionv1.Update, namespace("team1", enabled, annotations), namespace("team1", nil, annotations))
+		expectPending(resp, annotations)
+
+		disabled := map[string]string{injector.DefaultNamespaceLabel: "false"}
+		resp = handle(admissionv1.Update, namespace("team1", enabled, annotations), namespace("team1", disabled, annotations))
+		expectPending(resp, annotations)
+	})
+
+	It("Should drop the condition when the label is removed", func() {
+		annotations := map[string]string{"owner": "team1", injector.NamespaceOnboardingAnnotation: `{"type":"Onboarded"}`}
+		resp := handle(admissionv1.Update, namespace("team1", nil, annotations), namespace("team1", enabled, annotations))
+		Expect(resp.Patches).To(HaveLen(1))
+		Expect(resp.Patches[0].Operation).To(Equal("remove"))
+		Expect(resp.Patches[0].Path).To(Equal("/metadata/annotations/kagenti.io~1onboarding"))
+
+		// without a condition there is nothing to drop
+		resp = handle(admissionv1.Update, namespace("team1", nil, map[string]string{"owner": "team1"}),
+			namespace("team1", enabled, nil))
+		Expect(resp.Patches).To(BeEmpty())
+	})
+
+	It("Should warn that the label has no effect on an excluded namespace", func() {
+		resp := handle(admissionv1.Create, namespace("kube-system", enabled, nil), nil)
+		Expect(resp.Patches).To(BeEmpty())
+		Expect(resp.Warnings).To(ConsistOf(ContainSubstring("namespace kube-system is excluded from injection")))
+	})
+
+	It("Should leave namespaces whose label did not change", func() {
+		condition := map[string]string{injector.NamespaceOnboardingAnnotation: `{"type":"Onboarded","status":"True"}`}
+		for _, update := range []struct{ ns, old *corev1.Namespace }{
+			{ns: namespace("team1", enabled, condition), old: namespace("team1", enabled, condition)},
+			{ns: namespace("team1", nil, nil), old: namespace("team1", nil, nil)},
+		} {
+			resp := handle(admissionv1.Update, update.ns, update.old)
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Warnings).To(BeEmpty())
+		}
+		Expect(handle(admissionv1.Create, namespace("team1", nil, nil), nil).Patches).To(BeEmpty())
+	})
+
+	It("Should reject a namespace it cannot decode", func() {
+		resp := wh.Handle(ctx, admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+			Operation: admissionv1.Create,
+			Object:    apimachineryruntime.RawExtension{Raw: []byte("not json")},
+		}})
+		Expect(resp.Allowed).To(BeFalse())
+		Expect(resp.Result.Code).To(BeEquivalentTo(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,238 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/registration"
+	agentsv1alpha1 "github.com/kagenti/operator/api/v1alpha1"
+	toolhivestacklokdevv1alpha1 "github.com/stacklok/toolhive/cmd/thv-operator/api/v1alpha1"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachineryruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "rewrite the golden patches in testdata/")
+
+const (
+	enabledNamespace = "injection-enabled"
+	plainNamespace   = "injection-plain"
+)
+
+// The API server applies webhook patches without returning them, so these specs send
+// AdmissionReviews straight to the webhook server. Namespace lookups and ConfigMap checks
+// still go to the envtest API server.
+var _ = Describe("Webhook integration", func() {
+	BeforeEach(func() {
+		for _, ns := range []*corev1.Namespace{
+			{ObjectMeta: metav1.ObjectMeta{Name: enabledNamespace, Labels: map[string]string{injector.DefaultNamespaceLabel: "true"}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: plainNamespace}},
+		} {
+			Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, ns))).To(Succeed())
+		}
+		environments := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: injector.EnvironmentsConfigMap, Namespace: enabledNamespace},
+			Data:       map[string]string{"KEYCLOAK_URL": "http://keycloak.keycloak:8080", "KEYCLOAK_REALM": "kagenti"},
+		}
+		Expect(client.IgnoreAlreadyExists(k8sClient.Create(ctx, environments))).To(Succeed())
+	})
+
+	DescribeTable("patches AuthBridge workloads",
+		func(golden string, deployment *appsv1.Deployment) {
+			response := review(registration.AuthBridgePath, "apps", "v1", "Deployment", "deployments", deployment)
+			expectPatch(response, golden)
+		},
+		Entry("pod template label opts in", "deployment-pod-label",
+			testDeployment(plainNamespace, nil, map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue})),
+		Entry("namespace label opts in", "deployment-namespace-label",
+			testDeployment(enabledNamespace, nil, nil)),
+		Entry("SPIRE adds spiffe-helper", "deployment-spire",
+			testDeployment(plainNamespace, map[string]string{injector.SpireEnableLabel: injector.SpireEnabledValue},
+				map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue})),
+		Entry("pod template opt-out overrides the namespace", "",
+			testDeployment(enabledNamespace, nil, map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeDisabledValue})),
+		Entry("no opt-in leaves the workload alone", "",
+			testDeployment(plainNamespace, nil, nil)),
+		Entry("excluded namespaces are never injected", "",
+			testDeployment("kube-system", nil, map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue})),
+	)
+
+	DescribeTable("patches Agents",
+		func(golden string, agent *agentsv1alpha1.Agent) {
+			response := review(registration.AgentPath, "agent.kagenti.dev", "v1alpha1", "Agent", "agents", agent)
+			expectPatch(response, golden)
+		},
+		Entry("annotation opts in", "agent-annotation",
+			testAgent(plainNamespace, map[string]string{injector.DefaultCRAnnotation: "true"})),
+		Entry("namespace label opts in", "agent-namespace-label",
+			testAgent(enabledNamespace, nil)),
+		Entry("annotation opts out", "",
+			testAgent(enabledNamespace, map[string]string{injector.DefaultCRAnnotation: "false"})),
+	)
+
+	DescribeTable("patches MCPServers",
+		func(golden string, server *toolhivestacklokdevv1alpha1.MCPServer) {
+			response := review(registration.MCPServerPath, "toolhive.stacklok.dev", "v1alpha1", "MCPServer", "mcpservers", server)
+			expectPatch(response, golden)
+		},
+		Entry("annotation opts in", "mcpserver-annotation",
+			testMCPServer(plainNamespace, nil, map[string]string{injector.DefaultCRAnnotation: "true"})),
+		Entry("label opts in without SPIRE", "mcpserver-label-no-spire",
+			testMCPServer(plainNamespace, map[string]string{
+				injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue,
+				injector.SpireEnableLabel:      injector.SpireDisabledValue,
+			}, nil)),
+		Entry("label opts out of an enabled namespace", "mcpserver-plain",
+			testMCPServer(enabledNamespace, map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeDisabledValue}, nil)),
+		Entry("no opt-in only adds an empty pod template", "mcpserver-plain",
+			testMCPServer(plainNamespace, nil, nil)),
+		Entry("Keycloak realm in the namespace sets the OIDC configuration", "mcpserver-oidc",
+			testMCPServer(enabledNamespace, map[string]string{injector.SpireEnableLabel: injector.SpireDisabledValue}, nil)),
+	)
+
+	It("injects Deployments applied through the API server", func() {
+		deployment := testDeployment(plainNamespace, nil, map[string]string{injector.AuthBridgeInjectLabel: injector.AuthBridgeInjectValue})
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+		DeferCleanup(func() { Expect(k8sClient.Delete(ctx, deployment)).To(Succeed()) })
+
+		stored := &appsv1.Deployment{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(deployment), stored)).To(Succeed())
+		Expect(injector.IsInjected(&stored.Spec.Template.ObjectMeta)).To(BeTrue())
+		var names []string
+		for _, c := range stored.Spec.Template.Spec.InitContainers {
+			names = append(names, c.Name)
+		}
+		Expect(names).To(Equal([]string{
+			injector.ProxyInitContainerName, injector.ClientRegistrationContainerName, injector.EnvoyProxyContainerName,
+		}))
+	})
+})
+
+func testDeployment(namespace string, labels, podLabels map[string]string) *appsv1.Deployment {
+	selector := map[string]string{"app": "weather"}
+	templateLabels := map[string]string{"app": "weather"}
+	for k, v := range podLabels {
+		templateLabels[k] = v
+	}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "weather", Namespace: namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: templateLabels},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "agent", Image: "weather:latest"}}},
+			},
+		},
+	}
+}
+
+func testAgent(namespace string, annotations map[string]string) *agentsv1alpha1.Agent {
+	return &agentsv1alpha1.Agent{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "agent.kagenti.dev/v1alpha1", Kind: "Agent"},
+		ObjectMeta: metav1.ObjectMeta{Name: "weather", Namespace: namespace, Annotations: annotations},
+		Spec: agentsv1alpha1.AgentSpec{
+			PodTemplateSpec: &corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "agent", Image: "weather:latest"}}},
+			},
+		},
+	}
+}
+
+func testMCPServer(namespace string, labels, annotations map[string]string) *toolhivestacklokdevv1alpha1.MCPServer {
+	return &toolhivestacklokdevv1alpha1.MCPServer{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "toolhive.stacklok.dev/v1alpha1", Kind: "MCPServer"},
+		ObjectMeta: metav1.ObjectMeta{Name: "fetch", Namespace: namespace, Labels: labels, Annotations: annotations},
+		Spec:       toolhivestacklokdevv1alpha1.MCPServerSpec{Image: "fetch:latest"},
+	}
+}
+
+// review sends a CREATE AdmissionReview for obj to the webhook server and returns the response
+func review(path, group, version, kind, resource string, obj client.Object) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(obj)
+	Expect(err).NotTo(HaveOccurred())
+	body, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("integration-" + obj.GetNamespace() + "-" + obj.GetName()),
+			Kind:      metav1.GroupVersionKind{Group: group, Version: version, Kind: kind},
+			Resource:  metav1.GroupVersionResource{Group: group, Version: version, Resource: resource},
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+			Operation: admissionv1.Create,
+			Object:    apimachineryruntime.RawExtension{Raw: raw},
+		},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := httpClient.Post(webhookURL+path, "application/json", bytes.NewReader(body))
+	Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = resp.Body.Close() }()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+	var result admissionv1.AdmissionReview
+	Expect(json.NewDecoder(resp.Body).Decode(&result)).To(Succeed())
+	Expect(result.Response).NotTo(BeNil())
+	Expect(result.Response.Allowed).To(BeTrue(), "%v", result.Response.Result)
+	return result.Response
+}
+
+// expectPatch compares the response patch with testdata/<golden>.json, or expects no patch
+// when golden is empty. Run with -update-golden to rewrite the files after an intended change.
+func expectPatch(response *admissionv1.AdmissionResponse, golden string) {
+	if golden == "" {
+		Expect(response.Patch).To(BeEmpty())
+		return
+	}
+	Expect(response.Patch).NotTo(BeEmpty())
+
+	// jsonpatch does not order the operations on object fields, so they are sorted first
+	var operations []map[string]interface{}
+	Expect(json.Unmarshal(response.Patch, &operations)).To(Succeed())
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i]["path"].(string) < operations[j]["path"].(string)
+	})
+	actual, err := json.MarshalIndent(operations, "", "  ")
+	Expect(err).NotTo(HaveOccurred())
+
+	path := filepath.Join("testdata", golden+".json")
+	if *updateGolden {
+		Expect(os.MkdirAll("testdata", 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, append(actual, '\n'), 0o644)).To(Succeed())
+		return
+	}
+	expected, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred(), "missing golden file; run the suite with -update-golden")
+	Expect(actual).To(MatchJSON(expected), "patch differs from %s", path)
+}
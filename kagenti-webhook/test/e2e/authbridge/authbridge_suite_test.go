@@ -0,0 +1,86 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authbridge
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/keycloak"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/test/e2e/framework"
+)
+
+// Optional environment variables, see framework.ConfigFromEnv:
+// - E2E_CLUSTER_NAME: kind cluster to create or reuse (default kagenti-e2e)
+// - E2E_KEEP_CLUSTER=true: keep the cluster after the run for debugging
+// - E2E_SKIP_BUILD=true: use images that were built and tagged before
+// - E2E_SKIP_SPIRE=true: register static client IDs instead of SPIFFE IDs
+// - E2E_KEYCLOAK_PORT: host port Keycloak is published on (default 8080)
+var (
+	cfg     framework.Config
+	root    string
+	cluster *framework.Cluster
+	kc      *keycloak.Client
+)
+
+// TestAuthBridge runs the AuthBridge flow on a throwaway kind cluster: the webhook injects
+// the sidecars into a labeled Deployment, which registers with Keycloak and whose outbound
+// requests reach the demo app with an exchanged token
+func TestAuthBridge(t *testing.T) {
+	RegisterFailHandler(Fail)
+	_, _ = fmt.Fprintf(GinkgoWriter, "Starting AuthBridge end-to-end suite\n")
+	RunSpecs(t, "AuthBridge e2e suite")
+}
+
+var _ = BeforeSuite(func(ctx SpecContext) {
+	cfg = framework.ConfigFromEnv()
+	var err error
+	root, err = framework.RepoRoot()
+	Expect(err).NotTo(HaveOccurred())
+
+	By("creating the kind cluster")
+	cluster, err = framework.CreateCluster(ctx, cfg)
+	Expect(err).NotTo(HaveOccurred(), "Failed to create the kind cluster")
+
+	By("building and loading the images")
+	Expect(cluster.BuildImages(ctx, cfg, root)).To(Succeed())
+
+	if !cfg.SkipSPIRE {
+		By("installing SPIRE")
+		Expect(cluster.InstallSPIRE(ctx)).To(Succeed())
+	}
+
+	By("deploying Keycloak and the demo realm")
+	kc, err = cluster.DeployKeycloak(ctx, cfg)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(framework.SetupDemoRealm(ctx, kc, agentScope, agentClientID())).To(Succeed())
+
+	By("installing the webhook chart")
+	Expect(cluster.InstallWebhook(ctx, root)).To(Succeed())
+}, NodeTimeout(30*time.Minute))
+
+var _ = AfterSuite(func(ctx SpecContext) {
+	if cluster == nil || cfg.KeepCluster {
+		return
+	}
+	By("deleting the kind cluster")
+	Expect(cluster.Delete(ctx)).To(Succeed())
+}, NodeTimeout(5*time.Minute))
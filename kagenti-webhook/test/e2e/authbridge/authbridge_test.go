@@ -0,0 +1,163 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authbridge
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/authctl"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/keycloak"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/test/e2e/framework"
+)
+
+const (
+	// namespace and serviceAccount are those of AuthBridge/k8s/agent-deployment-webhook.yaml
+	namespace      = "team1"
+	serviceAccount = "agent"
+	agentScope     = "agent-" + namespace + "-" + serviceAccount + "-aud"
+
+	tokenURL  = "http://keycloak-service.keycloak.svc:8080/realms/demo/protocol/openid-connect/token"
+	targetURL = "http://auth-target-service:8081/test"
+)
+
+// agentClientID is the client ID client-registration registers for the agent
+func agentClientID() string {
+	if cfg.SkipSPIRE {
+		return namespace + "/" + serviceAccount
+	}
+	return "spiffe://" + framework.TrustDomain + injector.SpiffeIDPath(namespace, serviceAccount)
+}
+
+var _ = Describe("AuthBridge", Ordered, func() {
+	var clientID, clientSecret string
+
+	// agent runs a command in the agent's application container
+	agent := func(ctx SpecContext, command ...string) (string, error) {
+		return cluster.Exec(ctx, namespace, "agent", "agent", command...)
+	}
+
+	// token requests a token from inside the agent pod, like the demo does
+	token := func(ctx SpecContext, grant ...string) string {
+		args := []string{"curl", "-sf", "-X", "POST", tokenURL,
+			"--data-urlencode", "client_id=" + clientID, "--data-urlencode", "client_secret=" + clientSecret}
+		for _, param := range grant {
+			args = append(args, "--data-urlencode", param)
+		}
+		output, err := agent(ctx, args...)
+		Expect(err).NotTo(HaveOccurred())
+		var response authctl.TokenResponse
+		Expect(json.Unmarshal([]byte(output), &response)).To(Succeed(), output)
+		Expect(response.AccessToken).NotTo(BeEmpty())
+		return response.AccessToken
+	}
+
+	// callTarget sends the token to auth-target through the agent's outbound Envoy
+	callTarget := func(ctx SpecContext, accessToken string) string {
+		output, err := agent(ctx, "curl", "-s", "-H", "Authorization: Bearer "+accessToken, targetURL)
+		Expect(err).NotTo(HaveOccurred())
+		return strings.TrimSpace(output)
+	}
+
+	BeforeAll(func(ctx SpecContext) {
+		manifests := filepath.Join(root, "AuthBridge", "k8s")
+		Expect(cluster.EnsureNamespace(ctx, namespace, nil)).To(Succeed())
+		Expect(cluster.ApplyFile(ctx, filepath.Join(manifests, "configmaps-webhook.yaml"))).To(Succeed())
+		Expect(cluster.ApplyFile(ctx, filepath.Join(manifests, "auth-target-deployment-webhook.yaml"))).To(Succeed())
+
+		var mutations []framework.Mutation
+		if cfg.SkipSPIRE {
+			mutations = append(mutations, framework.WithLabel("Deployment", injector.SpireEnableLabel, "disabled"))
+		}
+		Expect(cluster.ApplyFile(ctx, filepath.Join(manifests, "agent-deployment-webhook.yaml"), mutations...)).To(Succeed())
+
+		Expect(cluster.WaitForDeployment(ctx, namespace, "auth-target", 5*time.Minute)).To(Succeed())
+		Expect(cluster.WaitForDeployment(ctx, namespace, "agent", 10*time.Minute)).To(Succeed())
+	}, NodeTimeout(20*time.Minute))
+
+	It("injects the AuthBridge sidecars into the labeled Deployment", func(ctx SpecContext) {
+		pod, err := cluster.PodFor(ctx, namespace, map[string]string{"app": "agent"})
+		Expect(err).NotTo(HaveOccurred())
+
+		containers := []string{}
+		for _, container := range pod.Spec.Containers {
+			containers = append(containers, container.Name)
+		}
+		Expect(containers).To(ContainElements("agent", injector.EnvoyProxyContainerName, injector.ClientRegistrationContainerName))
+		if !cfg.SkipSPIRE {
+			Expect(containers).To(ContainElement(injector.SpiffeHelperContainerName))
+		}
+		initContainers := []string{}
+		for _, container := range pod.Spec.InitContainers {
+			initContainers = append(initContainers, container.Name)
+		}
+		Expect(initContainers).To(ContainElement(injector.ProxyInitContainerName))
+	}, SpecTimeout(time.Minute))
+
+	It("registers the workload with Keycloak", func(ctx SpecContext) {
+		Eventually(func(g Gomega) {
+			output, err := agent(ctx, "cat", "/shared/client-id.txt")
+			g.Expect(err).NotTo(HaveOccurred())
+			clientID = strings.TrimSpace(output)
+			output, err = agent(ctx, "cat", "/shared/client-secret.txt")
+			g.Expect(err).NotTo(HaveOccurred())
+			clientSecret = strings.TrimSpace(output)
+			g.Expect(clientSecret).NotTo(BeEmpty())
+		}).WithContext(ctx).WithPolling(5 * time.Second).Should(Succeed())
+		Expect(clientID).To(Equal(agentClientID()))
+
+		registered, err := kc.GetClient(ctx, clientID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registered.Attributes).To(HaveKeyWithValue(keycloak.TokenExchangeAttribute, "true"))
+	}, SpecTimeout(5*time.Minute))
+
+	It("delivers a token exchanged for the target audience", func(ctx SpecContext) {
+		accessToken := token(ctx, "grant_type=client_credentials")
+		_, claims, err := authctl.DecodeToken(accessToken)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims["aud"]).To(SatisfyAny(Equal(clientID), ContainElement(clientID)))
+
+		Expect(callTarget(ctx, accessToken)).To(Equal("authorized"))
+		Eventually(func(g Gomega) {
+			logs, err := cluster.Kubectl(ctx, "logs", "-n", namespace, "deployment/auth-target")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(logs).To(MatchRegexp(`\[JWT Debug\] Audience: \[.*\b` + framework.TargetAudience + `\b.*\]`))
+		}).WithContext(ctx).Should(Succeed())
+	}, SpecTimeout(2*time.Minute))
+
+	It("preserves the user subject through the exchange", func(ctx SpecContext) {
+		accessToken := token(ctx, "grant_type=password", "username="+framework.DemoUser, "password="+framework.DemoPassword)
+		Expect(callTarget(ctx, accessToken)).To(Equal("authorized"))
+		Eventually(func(g Gomega) {
+			logs, err := cluster.Kubectl(ctx, "logs", "-n", namespace, "deployment/auth-target")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(logs).To(ContainSubstring("[JWT Debug] Preferred Username: " + framework.DemoUser))
+		}).WithContext(ctx).Should(Succeed())
+	}, SpecTimeout(2*time.Minute))
+
+	It("rejects requests without a token", func(ctx SpecContext) {
+		output, err := agent(ctx, "curl", "-s", "-o", "/dev/null", "-w", "%{http_code}", targetURL)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal("401"))
+	}, SpecTimeout(time.Minute))
+})
@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// keycloakNodePort is the NodePort of keycloak-service, mapped to Config.KeycloakPort
+const keycloakNodePort = 30080
+
+// kindConfig publishes Keycloak on the host, so that the suite can reach the admin API
+const kindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+- role: control-plane
+  extraPortMappings:
+  - containerPort: %d
+    hostPort: %s
+    protocol: TCP
+`
+
+// Cluster is a kind cluster and a client for it
+type Cluster struct {
+	Name       string
+	Kubeconfig string
+	Client     client.Client
+	// created is set when this run created the cluster and may therefore delete it
+	created bool
+}
+
+// CreateCluster creates the kind cluster, or reuses a running one with the same name, and
+// writes its kubeconfig to a temporary file so the user's kubeconfig is never touched
+func CreateCluster(ctx context.Context, cfg Config) (*Cluster, error) {
+	cluster := &Cluster{Name: cfg.ClusterName}
+	output, err := Run(ctx, "", nil, "kind", "get", "clusters")
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(strings.Fields(output), cfg.ClusterName) {
+		config := fmt.Sprintf(kindConfig, keycloakNodePort, cfg.KeycloakPort)
+		if _, err := Run(ctx, "", []byte(config), "kind", "create", "cluster", "--name", cfg.ClusterName, "--config", "-", "--wait", "2m"); err != nil {
+			return nil, err
+		}
+		cluster.created = true
+	}
+
+	kubeconfig, err := Run(ctx, "", nil, "kind", "get", "kubeconfig", "--name", cfg.ClusterName)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Kubeconfig = filepath.Join(os.TempDir(), "kagenti-e2e-"+cfg.ClusterName+".kubeconfig")
+	if err := os.WriteFile(cluster.Kubeconfig, []byte(kubeconfig), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write kubeconfig: %w", err)
+	}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	if cluster.Client, err = client.New(restConfig, client.Options{Scheme: scheme}); err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return cluster, nil
+}
+
+// Delete removes the cluster if this run created it
+func (c *Cluster) Delete(ctx context.Context) error {
+	if !c.created {
+		return nil
+	}
+	if _, err := Run(ctx, "", nil, "kind", "delete", "cluster", "--name", c.Name); err != nil {
+		return err
+	}
+	return os.Remove(c.Kubeconfig)
+}
+
+// LoadImages copies locally built images onto the cluster nodes
+func (c *Cluster) LoadImages(ctx context.Context, images ...string) error {
+	for _, image := range images {
+		if _, err := Run(ctx, "", nil, "kind", "load", "docker-image", image, "--name", c.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kubectl runs kubectl against the cluster
+func (c *Cluster) Kubectl(ctx context.Context, args ...string) (string, error) {
+	return Run(ctx, "", nil, "kubectl", append([]string{"--kubeconfig", c.Kubeconfig}, args...)...)
+}
+
+// Exec runs command in a container of the first pod of the deployment and returns stdout
+// and stderr
+func (c *Cluster) Exec(ctx context.Context, namespace, deployment, container string, command ...string) (string, error) {
+	args := []string{"exec", "-n", namespace, "deployment/" + deployment, "-c", container, "--"}
+	return c.Kubectl(ctx, append(args, command...)...)
+}
+
+// Helm runs helm against the cluster
+func (c *Cluster) Helm(ctx context.Context, args ...string) (string, error) {
+	return Run(ctx, "", nil, "helm", append([]string{"--kubeconfig", c.Kubeconfig}, args...)...)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/webhook/injector"
+)
+
+const (
+	// WebhookNamespace is where the webhook chart is installed
+	WebhookNamespace = "kagenti-webhook-system"
+	// WebhookImage is the locally built manager image
+	WebhookImage = "localhost/kagenti-webhook:e2e"
+	// ClientRegistrationImage is the locally built kagenti-client-registration image
+	ClientRegistrationImage = "localhost/client-registration:e2e"
+	// DemoAppImage is the token-validating target used by the AuthBridge manifests
+	DemoAppImage = "localhost/demo-app:latest"
+
+	// TrustDomain matches the SPIFFE IDs the AuthBridge demo realm is set up for
+	TrustDomain = "localtest.me"
+
+	spireChartRepo = "https://spiffe.github.io/helm-charts-hardened/"
+	spireNamespace = "spire-system"
+
+	installTimeout = 5 * time.Minute
+)
+
+// image is a container image built from a Dockerfile in the repository
+type image struct {
+	tag        string
+	dockerfile string
+	context    string
+}
+
+// images are the images a run builds, with paths relative to the repository root
+var images = []image{
+	{tag: WebhookImage, dockerfile: "kagenti-webhook/Dockerfile", context: "kagenti-webhook"},
+	{tag: injector.DefaultEnvoyImage, dockerfile: "AuthBridge/AuthProxy/Dockerfile.envoy", context: "AuthBridge/AuthProxy"},
+	{tag: injector.DefaultProxyInitImage, dockerfile: "AuthBridge/AuthProxy/Dockerfile.init", context: "AuthBridge/AuthProxy"},
+	{tag: ClientRegistrationImage, dockerfile: "AuthBridge/client-registration/Dockerfile", context: "AuthBridge/client-registration"},
+	{tag: DemoAppImage, dockerfile: "AuthBridge/AuthProxy/quickstart/demo-app/Dockerfile", context: "AuthBridge/AuthProxy"},
+}
+
+// BuildImages builds the webhook, sidecar and demo images from the working tree, unless
+// cfg.SkipBuild is set, and loads them onto the cluster
+func (c *Cluster) BuildImages(ctx context.Context, cfg Config, root string) error {
+	tags := make([]string, 0, len(images))
+	for _, img := range images {
+		tags = append(tags, img.tag)
+		if cfg.SkipBuild {
+			continue
+		}
+		if _, err := Run(ctx, root, nil, cfg.ContainerTool, "build", "-t", img.tag, "-f", img.dockerfile, img.context); err != nil {
+			return fmt.Errorf("failed to build %s: %w", img.tag, err)
+		}
+	}
+	return c.LoadImages(ctx, tags...)
+}
+
+// InstallSPIRE installs the SPIRE server, agents and the SPIFFE CSI driver with the demo
+// trust domain; the default ClusterSPIFFEID gives pods spiffe://<domain>/ns/<ns>/sa/<sa>
+func (c *Cluster) InstallSPIRE(ctx context.Context) error {
+	if _, err := c.Helm(ctx, "upgrade", "--install", "spire-crds", "spire-crds", "--repo", spireChartRepo,
+		"-n", spireNamespace, "--create-namespace", "--wait"); err != nil {
+		return fmt.Errorf("failed to install the SPIRE CRDs: %w", err)
+	}
+	if _, err := c.Helm(ctx, "upgrade", "--install", "spire", "spire", "--repo", spireChartRepo,
+		"-n", spireNamespace, "--wait", "--timeout", installTimeout.String(),
+		"--set", "global.spire.trustDomain="+TrustDomain,
+		"--set", "global.spire.clusterName="+c.Name); err != nil {
+		return fmt.Errorf("failed to install SPIRE: %w", err)
+	}
+	return nil
+}
+
+// webhookValues points the injected containers at the locally built images
+var webhookValues = fmt.Sprintf(`sidecars:
+  images:
+    envoy-proxy: %s
+    proxy-init: %s
+    kagenti-client-registration: %s
+  imagePullPolicy: IfNotPresent
+`, injector.DefaultEnvoyImage, injector.DefaultProxyInitImage, ClientRegistrationImage)
+
+// InstallWebhook installs the chart from the working tree with self-signed serving
+// certificates, so that the cluster needs no cert-manager
+func (c *Cluster) InstallWebhook(ctx context.Context, root string) error {
+	values := filepath.Join(os.TempDir(), "kagenti-e2e-"+c.Name+"-values.yaml")
+	if err := os.WriteFile(values, []byte(webhookValues), 0o600); err != nil {
+		return fmt.Errorf("failed to write chart values: %w", err)
+	}
+	defer func() { _ = os.Remove(values) }()
+
+	_, err := c.Helm(ctx, "upgrade", "--install", "kagenti-webhook", filepath.Join(root, "charts", "kagenti-webhook"),
+		"-n", WebhookNamespace, "--create-namespace", "--wait", "--timeout", installTimeout.String(),
+		"-f", values,
+		"--set", "namespaceOverride="+WebhookNamespace,
+		"--set", "namespace.create=false",
+		"--set", "image.repository=localhost/kagenti-webhook",
+		"--set", "image.tag=e2e",
+		"--set", "image.pullPolicy=IfNotPresent",
+		"--set", "certManager.enabled=false",
+		"--set", "selfSignedCerts.enabled=true")
+	if err != nil {
+		return fmt.Errorf("failed to install the webhook chart: %w", err)
+	}
+	return nil
+}
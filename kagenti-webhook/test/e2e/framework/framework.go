@@ -0,0 +1,105 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package framework provisions the throwaway clusters the AuthBridge end-to-end tests
+// run in: a kind cluster with Keycloak, optionally SPIRE, the locally built images and
+// the webhook chart. Everything is driven from Go; external tools (kind, docker, helm)
+// are only executed, never scripted.
+package framework
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" //nolint:golint,revive
+)
+
+// Config selects the cluster and components of a run; see ConfigFromEnv
+type Config struct {
+	// ClusterName is the kind cluster, created unless it already exists
+	ClusterName string
+	// KeepCluster leaves the cluster running after the suite, for debugging
+	KeepCluster bool
+	// SkipBuild expects the images to be built and tagged already
+	SkipBuild bool
+	// SkipSPIRE runs the flow with static client IDs instead of SPIFFE IDs
+	SkipSPIRE bool
+	// KeycloakPort is the host port Keycloak is published on
+	KeycloakPort string
+	// ContainerTool builds the images, docker by default
+	ContainerTool string
+}
+
+// ConfigFromEnv reads E2E_CLUSTER_NAME, E2E_KEEP_CLUSTER, E2E_SKIP_BUILD, E2E_SKIP_SPIRE,
+// E2E_KEYCLOAK_PORT and CONTAINER_TOOL
+func ConfigFromEnv() Config {
+	return Config{
+		ClusterName:   envOr("E2E_CLUSTER_NAME", "kagenti-e2e"),
+		KeepCluster:   os.Getenv("E2E_KEEP_CLUSTER") == "true",
+		SkipBuild:     os.Getenv("E2E_SKIP_BUILD") == "true",
+		SkipSPIRE:     os.Getenv("E2E_SKIP_SPIRE") == "true",
+		KeycloakPort:  envOr("E2E_KEYCLOAK_PORT", "8080"),
+		ContainerTool: envOr("CONTAINER_TOOL", "docker"),
+	}
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// RepoRoot returns the root of the kagenti-extensions checkout, the parent of the
+// directory holding the webhook's go.mod
+func RepoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return filepath.Dir(dir), nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("failed to find go.mod above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// Run executes the command in dir and returns its combined output; the output is part of
+// the error so that failures explain themselves in the test report
+func Run(ctx context.Context, dir string, stdin []byte, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	command := strings.Join(cmd.Args, " ")
+	_, _ = fmt.Fprintf(GinkgoWriter, "running: %s\n", command)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("%s failed with error: (%v) %s", command, err, string(output))
+	}
+	return string(output), nil
+}
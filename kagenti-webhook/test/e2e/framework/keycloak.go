@@ -0,0 +1,171 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/ptr"
+
+	"github.com/kagenti/kagenti-extensions/kagenti-webhook/internal/keycloak"
+)
+
+const (
+	// KeycloakNamespace and the keycloak-service name match AuthBridge/k8s/configmaps-webhook.yaml
+	KeycloakNamespace = "keycloak"
+	// KeycloakRealm is the demo realm
+	KeycloakRealm = "demo"
+	// TargetAudience is the client the agent's tokens are exchanged for
+	TargetAudience = "auth-target"
+
+	// DemoUser and DemoPassword are the user of the subject preservation check
+	DemoUser     = "alice"
+	DemoPassword = "alice123"
+
+	keycloakAdmin = "admin"
+)
+
+// keycloakManifest runs Keycloak in development mode. The frontend hostname is fixed, so
+// tokens carry the issuer auth-target expects however Keycloak is reached.
+var keycloakManifest = fmt.Sprintf(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: %[1]s
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: keycloak
+  namespace: %[1]s
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: keycloak
+  template:
+    metadata:
+      labels:
+        app: keycloak
+    spec:
+      containers:
+      - name: keycloak
+        image: quay.io/keycloak/keycloak:26.3
+        args: ["start-dev"]
+        env:
+        - name: KC_BOOTSTRAP_ADMIN_USERNAME
+          value: %[2]s
+        - name: KC_BOOTSTRAP_ADMIN_PASSWORD
+          value: %[2]s
+        - name: KC_HOSTNAME
+          value: http://keycloak.localtest.me:8080
+        - name: KC_HOSTNAME_BACKCHANNEL_DYNAMIC
+          value: "true"
+        - name: KC_HEALTH_ENABLED
+          value: "true"
+        ports:
+        - containerPort: 8080
+        readinessProbe:
+          httpGet:
+            path: /health/ready
+            port: 9000
+          periodSeconds: 5
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: keycloak-service
+  namespace: %[1]s
+spec:
+  type: NodePort
+  selector:
+    app: keycloak
+  ports:
+  - port: 8080
+    targetPort: 8080
+    nodePort: %[3]d
+`, KeycloakNamespace, keycloakAdmin, keycloakNodePort)
+
+// DeployKeycloak runs Keycloak and returns an admin client for the demo realm once the
+// admin API answers on the host port
+func (c *Cluster) DeployKeycloak(ctx context.Context, cfg Config) (*keycloak.Client, error) {
+	if err := c.Apply(ctx, []byte(keycloakManifest)); err != nil {
+		return nil, err
+	}
+	if err := c.WaitForDeployment(ctx, KeycloakNamespace, "keycloak", installTimeout); err != nil {
+		return nil, err
+	}
+
+	kc := keycloak.NewClient("http://localhost:"+cfg.KeycloakPort, KeycloakRealm, keycloakAdmin, keycloakAdmin)
+	// the NodePort may lag behind the readiness probe
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, time.Minute, true, func(ctx context.Context) (bool, error) {
+		return kc.EnsureRealm(ctx) == nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the Keycloak admin API: %w", err)
+	}
+	return kc, nil
+}
+
+// SetupDemoRealm configures the realm like AuthBridge/setup_keycloak-webhook.py: the
+// auth-target client, a realm default scope adding agentClientID to token audiences, the
+// optional auth-target-aud scope requested by the exchange, and the demo user. The scopes
+// only apply to clients registered afterwards.
+func SetupDemoRealm(ctx context.Context, kc *keycloak.Client, agentScope, agentClientID string) error {
+	if err := kc.EnsureRealm(ctx); err != nil {
+		return err
+	}
+	_, err := kc.EnsureClient(ctx, keycloak.ClientRepresentation{
+		ClientID:               TargetAudience,
+		Name:                   "Auth Target",
+		Enabled:                ptr.To(true),
+		PublicClient:           ptr.To(false),
+		StandardFlowEnabled:    ptr.To(false),
+		ServiceAccountsEnabled: ptr.To(true),
+		Attributes:             map[string]string{keycloak.TokenExchangeAttribute: "true"},
+	})
+	if err != nil {
+		return err
+	}
+
+	agentScopeID, err := kc.EnsureClientScope(ctx, keycloak.AudienceScope(agentScope, agentClientID))
+	if err != nil {
+		return err
+	}
+	if err := kc.AddRealmDefaultClientScope(ctx, agentScopeID, false); err != nil {
+		return err
+	}
+	targetScopeID, err := kc.EnsureClientScope(ctx, keycloak.AudienceScope(TargetAudience+"-aud", TargetAudience))
+	if err != nil {
+		return err
+	}
+	if err := kc.AddRealmDefaultClientScope(ctx, targetScopeID, true); err != nil {
+		return err
+	}
+
+	return kc.EnsureUser(ctx, keycloak.UserRepresentation{
+		Username:      DemoUser,
+		Email:         DemoUser + "@example.com",
+		FirstName:     "Alice",
+		LastName:      "Demo",
+		Enabled:       ptr.To(true),
+		EmailVerified: ptr.To(true),
+		Credentials:   []keycloak.CredentialRepresentation{{Type: "password", Value: DemoPassword}},
+	})
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package framework
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fieldOwner is the server-side apply field manager of everything the suite creates
+const fieldOwner = "kagenti-e2e"
+
+// pollInterval is how often the wait helpers check the cluster
+const pollInterval = 2 * time.Second
+
+// Mutation edits a decoded object before it is applied
+type Mutation func(obj *unstructured.Unstructured)
+
+// ApplyFile server-side applies every document of a multi-document YAML file
+func (c *Cluster) ApplyFile(ctx context.Context, file string, mutations ...Mutation) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	if err := c.Apply(ctx, content, mutations...); err != nil {
+		return fmt.Errorf("failed to apply %s: %w", file, err)
+	}
+	return nil
+}
+
+// Apply server-side applies every document of a multi-document YAML manifest
+func (c *Cluster) Apply(ctx context.Context, manifest []byte, mutations ...Mutation) error {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifest), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode manifest: %w", err)
+		}
+		// comment-only documents decode to nothing
+		if len(obj.Object) == 0 {
+			continue
+		}
+		for _, mutate := range mutations {
+			mutate(obj)
+		}
+		if err := c.Client.Apply(ctx, client.ApplyConfigurationFromUnstructured(obj), client.FieldOwner(fieldOwner), client.ForceOwnership); err != nil {
+			return fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+}
+
+// EnsureNamespace creates the namespace with the given labels unless it exists
+func (c *Cluster) EnsureNamespace(ctx context.Context, name string, labels map[string]string) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	if err := c.Client.Create(ctx, ns); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// WaitForDeployment waits until all replicas of the deployment's latest generation are
+// updated and available
+func (c *Cluster) WaitForDeployment(ctx context.Context, namespace, name string, timeout time.Duration) error {
+	var last string
+	err := wait.PollUntilContextTimeout(ctx, pollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		deployment := &appsv1.Deployment{}
+		if err := c.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); err != nil {
+			last = err.Error()
+			return false, nil
+		}
+		status := deployment.Status
+		want := int32(1)
+		if deployment.Spec.Replicas != nil {
+			want = *deployment.Spec.Replicas
+		}
+		last = fmt.Sprintf("%d/%d replicas available", status.AvailableReplicas, want)
+		return status.ObservedGeneration >= deployment.Generation &&
+			status.UpdatedReplicas == want && status.AvailableReplicas == want, nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s did not become available: %s: %w", namespace, name, last, err)
+	}
+	return nil
+}
+
+// PodFor returns the first pod matching the labels
+func (c *Cluster) PodFor(ctx context.Context, namespace string, labels map[string]string) (*corev1.Pod, error) {
+	pods := &corev1.PodList{}
+	if err := c.Client.List(ctx, pods, client.InNamespace(namespace), client.MatchingLabels(labels)); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pod in %s matches %v", namespace, labels)
+	}
+	return &pods.Items[0], nil
+}
+
+// WithLabel sets a metadata label on every object of the kind
+func WithLabel(kind, key, value string) Mutation {
+	return func(obj *unstructured.Unstructured) {
+		if obj.GetKind() != kind {
+			return
+		}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[key] = value
+		obj.SetLabels(labels)
+	}
+}